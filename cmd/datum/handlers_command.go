@@ -0,0 +1,5 @@
+//go:build (!slim && !no_command) || with_command
+
+package main
+
+import _ "github.com/jprybylski/datum/internal/handlers/command"
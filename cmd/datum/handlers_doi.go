@@ -0,0 +1,5 @@
+//go:build (!slim && !no_doi) || with_doi
+
+package main
+
+import _ "github.com/jprybylski/datum/internal/handlers/doi"
@@ -0,0 +1,5 @@
+//go:build (!slim && !no_dvc) || with_dvc
+
+package main
+
+import _ "github.com/jprybylski/datum/internal/handlers/dvc"
@@ -0,0 +1,5 @@
+//go:build (!slim && !no_file) || with_file
+
+package main
+
+import _ "github.com/jprybylski/datum/internal/handlers/file"
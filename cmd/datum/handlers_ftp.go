@@ -0,0 +1,5 @@
+//go:build (!slim && !no_ftp) || with_ftp
+
+package main
+
+import _ "github.com/jprybylski/datum/internal/handlers/ftp"
@@ -1,4 +1,4 @@
-//go:build git
+//go:build git || with_git
 
 package main
 
@@ -0,0 +1,5 @@
+//go:build (!slim && !no_githubrelease) || with_githubrelease
+
+package main
+
+import _ "github.com/jprybylski/datum/internal/handlers/githubrelease"
@@ -0,0 +1,5 @@
+//go:build (!slim && !no_http) || with_http
+
+package main
+
+import _ "github.com/jprybylski/datum/internal/handlers/http"
@@ -0,0 +1,5 @@
+//go:build (!slim && !no_huggingface) || with_huggingface
+
+package main
+
+import _ "github.com/jprybylski/datum/internal/handlers/huggingface"
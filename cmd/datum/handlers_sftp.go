@@ -0,0 +1,5 @@
+//go:build (!slim && !no_sftp) || with_sftp
+
+package main
+
+import _ "github.com/jprybylski/datum/internal/handlers/sftp"
@@ -0,0 +1,5 @@
+//go:build (!slim && !no_sql) || with_sql
+
+package main
+
+import _ "github.com/jprybylski/datum/internal/handlers/sql"
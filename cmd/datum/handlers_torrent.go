@@ -0,0 +1,5 @@
+//go:build (!slim && !no_torrent) || with_torrent
+
+package main
+
+import _ "github.com/jprybylski/datum/internal/handlers/torrent"
@@ -8,22 +8,39 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/jprybylski/datum/internal/core"
-	// Side-effect imports: These imports don't use any exported symbols,
-	// but they run init() functions that register handlers with the registry.
-	// The underscore (_) tells Go we're importing for side effects only.
-	//
-	// Go learning note: init() functions in these packages run automatically
-	// before main(), registering their handlers in the global registry.
-	_ "github.com/jprybylski/datum/internal/handlers/command"
-	_ "github.com/jprybylski/datum/internal/handlers/file"
-	_ "github.com/jprybylski/datum/internal/handlers/http"
+	"github.com/jprybylski/datum/internal/daemon"
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/service"
 )
 
+// Handlers are linked in by the handlers_*.go files next to this one, one per
+// handler. Each is a side-effect import: it uses no exported symbols, but the
+// handler package's init() registers it in the global registry before main()
+// runs. Each file has its own build constraint, so a build picks its handlers
+// with tags alone:
+//
+//	go build ./cmd/datum                                 # every handler but git
+//	go build -tags git ./cmd/datum                       # every handler
+//	go build -tags no_command ./cmd/datum                # all but git and command
+//	go build -tags "slim with_http with_file" ./cmd/datum # only http and file
+//
+// Go learning note: a //go:build line is a boolean expression over tags, so
+// "(!slim && !no_http) || with_http" reads "on by default, unless slim or
+// no_http is given, and always with with_http".
+
 // usage prints help text to stdout.
 //
 // This is called when the user provides no arguments or an invalid command.
@@ -33,16 +50,258 @@ func usage() {
 	fmt.Print(`datum - verify/fetch external data by config+lock
 
 Usage:
-  datum [--config .data.yaml] [--lock .data.lock.yaml] check
-  datum [--config .data.yaml] [--lock .data.lock.yaml] fetch [ID ...]
+  datum [global flags] init [--force]
+  datum [global flags] adopt [--type TYPE] [--target-dir DIR] DIR
+  datum [global flags] check [--tags T,...] [--exclude-tags T,...] [--sample N|P%] [--honor-cache] [--interactive] [--metrics-file PATH] [--output text|json]
+  datum [global flags] fetch [--transactional] [--tags T,...] [--exclude-tags T,...] [--output text|json] [ID ...]
+  datum [global flags] update [ID ...]
+  datum [global flags] outdated [--discover]
+  datum [global flags] diff [--content] [--max-size SIZE] [ID ...]
+  datum [global flags] bump ID VERSION
+  datum [global flags] verify [ID ...]
+  datum [global flags] list [--json]
+  datum [global flags] validate
+  datum [global flags] lock verify [--tlog]
+  datum lock diff [--json] OLD.lock.yaml NEW.lock.yaml
+  datum [global flags] lock promote FROM TO [ID ...]
+  datum [global flags] cat ID
+  datum [global flags] probe URL|PATH
+  datum handlers
+  datum daemon [--socket PATH] [--ttl DURATION]
+  datum daemon status [--socket PATH]
+  datum [global flags] watch [--interval 1h] [--health ADDR] [--metrics-file PATH]
+  datum [global flags] watch install-service [--interval 1h] [--name NAME] [--user] [--log-file PATH] [--env-file PATH] [--dry-run]
+  datum [global flags] status [--remote]
+  datum [global flags] status --sizes
+  datum [global flags] status --slowest N
+  datum [global flags] sync-vcs
+  datum [global flags] fix-urls [--yes]
+  datum [global flags] pin push [--backend ipfs] [ID ...]
+  datum [global flags] bench [-n RUNS] [--fingerprint-only] [--cpuprofile FILE] [ID ...]
+  datum [global flags] export [--format sha256sums] [-o SHA256SUMS]
+  datum [global flags] gc --tmp
+  datum [global flags] cache list
+  datum [global flags] cache gc [--max-size SIZE] [--max-age AGE]
+  datum [global flags] cache clear
+  datum [global flags] prune [--delete-targets] [--yes]
+  datum [global flags] policy update
+  datum [global flags] report usage [--hosts] [-o FILE]
+
+Global flags:
+  --config PATH       config file (default .data.yaml)
+  --lock PATH         lockfile (default .data.lock.yaml)
+  --profile NAME      use the profile's lockfile, e.g. .data.lock.NAME.yaml ($DATUM_PROFILE)
+  --lock-out PATH     write the updated lockfile here instead of --lock
+  --no-write-lock     never write the lockfile
+  --jobs N            datasets processed concurrently by check/fetch (default: number of CPUs)
+  --retry-run N       after check/fetch, rerun the datasets that failed, up to N more passes
+  --skip-unknown-handlers  skip datasets needing handlers this build lacks, instead of stopping
+  --scratch-dir DIR   put temp files and caches under DIR ($DATUM_SCRATCH_DIR)
+  --status-file PATH  bookkeeping file (default .data.status.yaml next to --lock)
+  --config-sha256 HEX refuse to run unless the config has this SHA256 ($DATUM_CONFIG_SHA256)
+  --allow-commands    let the config run command sources without allow_command_sources ($DATUM_ALLOW_COMMANDS)
+  --allowed-hosts LIST  only let sources use these comma-separated hosts, e.g. data.gov,*.census.gov ($DATUM_ALLOWED_HOSTS)
+  --quiet             only print warnings and errors, and no download progress
+  --verbose           also print debug lines: timings and remote fingerprints
+  --log-format FORMAT status lines on stderr as text (default) or json, one object per line
+  --locale LANG       language of text status lines: en (default), de, es, or auto from $LANG ($DATUM_LOCALE)
+  --daemon            send network source operations to the shared daemon ($DATUM_DAEMON; socket: $DATUM_DAEMON_SOCKET)
+  --max-bandwidth RATE  cap all downloads together, e.g. 10MB/s ($DATUM_MAX_BANDWIDTH)
+  --timeout DURATION  limit each dataset's source operations, e.g. 10m (datasets can set their own timeout)
+  --fail-on WHAT      exit 1 on: stale (any change or error), error (errors only) or never (default: per policy)
+  --run-id ID         identify this run in output, reports and changed lock entries ($DATUM_RUN_ID; default: random UUID)
 `)
 }
 
+// outputFlags registers --output (and its shorthand --json) on a subcommand's
+// flag set and returns the selected format once fs is parsed.
+//
+// Go learning note: flag.BoolFunc lets --json set the same variable as --output,
+// so both spellings end up in one place.
+func outputFlags(fs *flag.FlagSet) *string {
+	output := fs.String("output", "text", "output format: text or json")
+	fs.BoolFunc("json", "shorthand for --output json", func(string) error {
+		*output = "json"
+		return nil
+	})
+	return output
+}
+
+// tagFlags registers --tags and --exclude-tags, which select datasets by tag.
+func tagFlags(fs *flag.FlagSet, opts *core.Options) {
+	list := func(dst *[]string) func(string) error {
+		return func(v string) error {
+			for _, tag := range strings.Split(v, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					*dst = append(*dst, tag)
+				}
+			}
+			return nil
+		}
+	}
+	fs.Func("tags", "only datasets with any of these comma-separated tags", list(&opts.Tags))
+	fs.Func("exclude-tags", "leave out datasets with any of these comma-separated tags", list(&opts.ExcludeTags))
+}
+
+// setOutput applies the --output format. For json, the report goes to stdout
+// and anything else the command prints moves to stderr with the status lines,
+// so stdout stays parseable while a person watching the run still sees progress.
+func setOutput(output string, opts *core.Options) {
+	switch output {
+	case "text":
+	case "json":
+		opts.Report = os.Stdout
+		os.Stdout = os.Stderr
+	default:
+		fmt.Fprintf(os.Stderr, "datum: unknown --output %q (want text or json)\n", output)
+		os.Exit(2)
+	}
+}
+
+// interruptible makes Ctrl-C (or SIGTERM) cancel the run through opts.Context
+// instead of killing the process: downloads in flight are aborted, leaving
+// their targets untouched, and the lockfile is still written with everything
+// that finished. A second Ctrl-C quits at once.
+//
+// Go learning note: signal.NotifyContext cancels its context on the first
+// signal. Calling stop then restores the default handling, which is what makes
+// the second Ctrl-C fatal.
+func interruptible(opts *core.Options) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		fmt.Fprintln(os.Stderr, "datum: interrupted, saving the lockfile (Ctrl-C again to quit now)")
+	}()
+	opts.Context = ctx
+}
+
+// runDaemon runs "datum daemon" in the foreground until interrupted, or with
+// "status", asks the running one what it has shared so far.
+func runDaemon(args []string) int {
+	status := len(args) > 0 && args[0] == "status"
+	if status {
+		args = args[1:]
+	}
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	socket := fs.String("socket", daemon.DefaultSocket(), "unix socket to listen on or query ($DATUM_DAEMON_SOCKET)")
+	ttl := fs.Duration("ttl", daemon.DefaultTTL, "how long fingerprints are reused across requests")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		usage()
+		return 2
+	}
+
+	if status {
+		stats, err := daemon.Ping(context.Background(), *socket)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "datum: no daemon on %s: %v\n", *socket, err)
+			return 1
+		}
+		fmt.Printf("socket:        %s\n", *socket)
+		fmt.Printf("up since:      %s\n", stats.Started.Format(time.RFC3339))
+		fmt.Printf("requests:      %d\n", stats.Requests)
+		fmt.Printf("fingerprints:  %d run, %d reused\n", stats.FingerprintsRun, stats.FingerprintsHit)
+		fmt.Printf("fetches:       %d downloaded, %d shared (%d bytes)\n", stats.Fetches, stats.FetchesShared, stats.BytesSharedTotal)
+		return 0
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "datum: daemon listening on %s (Ctrl-C to stop)\n", *socket)
+	if err := (&daemon.Server{TTL: *ttl}).Serve(ctx, *socket); err != nil {
+		fmt.Fprintf(os.Stderr, "datum: daemon: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runWatch runs "datum watch": a check every --interval until interrupted,
+// with another one right away on SIGHUP.
+func runWatch(cfgPath, lockPath string, args []string, opts core.Options) int {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	var w core.WatchOptions
+	fs.DurationVar(&w.Interval, "interval", service.DefaultInterval, "time between checks")
+	fs.StringVar(&w.HealthAddr, "health", "", "serve GET /healthz on this address, e.g. :8080")
+	fs.StringVar(&opts.MetricsFile, "metrics-file", "", "write Prometheus metrics here (textfile collector format) after each check")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		usage()
+		return 2
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	reload := make(chan struct{})
+	go func() {
+		for range hup {
+			reload <- struct{}{}
+		}
+	}()
+	w.Reload = reload
+
+	interruptible(&opts)
+	return core.Watch(cfgPath, lockPath, w, opts)
+}
+
+// installService runs "datum watch install-service": it schedules datum
+// check in the current directory, passing along the global flags given on
+// this command line, so the job checks exactly what this run would.
+//
+// Go learning note: flag.Visit walks only the flags that were set, which is
+// what keeps defaults out of the generated command line.
+func installService(args []string) int {
+	if len(args) == 0 || args[0] != "install-service" {
+		fmt.Fprintln(os.Stderr, "datum: usage: datum [global flags] watch install-service [flags]")
+		return 2
+	}
+	fs := flag.NewFlagSet("install-service", flag.ExitOnError)
+	var spec service.Spec
+	fs.DurationVar(&spec.Interval, "interval", service.DefaultInterval, "time between checks")
+	fs.StringVar(&spec.Name, "name", "", "unit or task name (default datum-<directory>)")
+	fs.BoolVar(&spec.User, "user", false, "install a systemd user unit (no root needed)")
+	fs.StringVar(&spec.LogFile, "log-file", "", "append output to this file (default: the journal; on Windows, the cache directory)")
+	fs.StringVar(&spec.EnvFile, "env-file", "", "systemd EnvironmentFile holding credentials, e.g. HF_TOKEN=...")
+	dryRun := fs.Bool("dry-run", false, "print what would be installed instead of installing it")
+	fs.Parse(args[1:])
+	if fs.NArg() > 0 {
+		usage()
+		return 2
+	}
+
+	var err error
+	if spec.Dir, err = os.Getwd(); err == nil {
+		if spec.Binary, err = os.Executable(); err == nil {
+			spec.Binary, err = filepath.EvalSymlinks(spec.Binary)
+		}
+	}
+	if err == nil && spec.LogFile != "" {
+		spec.LogFile, err = filepath.Abs(spec.LogFile)
+	}
+	if err == nil && spec.EnvFile != "" {
+		spec.EnvFile, err = filepath.Abs(spec.EnvFile)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "datum: %v\n", err)
+		return 1
+	}
+	flag.Visit(func(f *flag.Flag) {
+		spec.Args = append(spec.Args, "--"+f.Name+"="+f.Value.String())
+	})
+
+	if err := service.Install(spec, *dryRun, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "datum: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
 // main is the program entry point.
 //
 // Execution flow:
-//  1. Parse command-line flags (--config, --lock)
-//  2. Get the subcommand (check or fetch)
+//  1. Parse command-line flags (--config, --lock, ...)
+//  2. Get the subcommand (check, fetch, or lock)
 //  3. Dispatch to the appropriate core function
 //  4. Exit with the returned status code
 //
@@ -54,14 +313,106 @@ Usage:
 func main() {
 	// Define command-line flags
 	// StringVar binds a flag to a variable. Format: (varPtr, flagName, defaultValue, description)
-	var cfgPath, lockPath string
+	var cfgPath, lockPath, scratchDir, configSHA, profile string
+	var quiet, verbose, useDaemon, allowCommands bool
+	var logFormat, locale, maxBandwidth, hosts string
+	var opts core.Options
 	flag.StringVar(&cfgPath, "config", ".data.yaml", "path to config YAML")
 	flag.StringVar(&lockPath, "lock", ".data.lock.yaml", "path to lock YAML")
+	flag.StringVar(&profile, "profile", os.Getenv("DATUM_PROFILE"), "lockfile profile, e.g. prod or dev (default $DATUM_PROFILE)")
+	flag.StringVar(&opts.LockOut, "lock-out", "", "write the updated lockfile to this path instead of --lock")
+	flag.BoolVar(&opts.NoWriteLock, "no-write-lock", false, "never write the lockfile")
+	flag.IntVar(&opts.Jobs, "jobs", runtime.NumCPU(), "number of datasets processed concurrently")
+	flag.IntVar(&opts.RetryRun, "retry-run", 0, "rerun failed datasets up to N more passes")
+	flag.BoolVar(&opts.SkipUnknownHandlers, "skip-unknown-handlers", false, "skip datasets whose source types have no handler in this build")
+	flag.StringVar(&opts.StatusFile, "status-file", "", "path to status YAML (default .data.status.yaml next to the lock)")
+	flag.StringVar(&configSHA, "config-sha256", os.Getenv("DATUM_CONFIG_SHA256"), "required SHA256 of the config file (default $DATUM_CONFIG_SHA256)")
+	flag.BoolVar(&allowCommands, "allow-commands", os.Getenv("DATUM_ALLOW_COMMANDS") != "", "allow command sources even if the config doesn't set allow_command_sources (default $DATUM_ALLOW_COMMANDS set)")
+	flag.StringVar(&hosts, "allowed-hosts", os.Getenv("DATUM_ALLOWED_HOSTS"), "comma-separated hosts sources may use, e.g. data.gov,*.census.gov (default $DATUM_ALLOWED_HOSTS, else any)")
+	flag.StringVar(&scratchDir, "scratch-dir", fsutil.ScratchDir(), "directory for temp files and caches (default $DATUM_SCRATCH_DIR)")
+	flag.BoolVar(&quiet, "quiet", false, "only report warnings and errors, and no download progress")
+	flag.BoolVar(&verbose, "verbose", false, "also report debug lines (timings, fingerprints)")
+	flag.StringVar(&logFormat, "log-format", "text", "status line format: text or json")
+	flag.StringVar(&locale, "locale", os.Getenv("DATUM_LOCALE"), "language of text status lines: en, de, es or auto (default $DATUM_LOCALE)")
+	flag.BoolVar(&useDaemon, "daemon", os.Getenv("DATUM_DAEMON") != "", "run network source operations in the shared daemon (default $DATUM_DAEMON set)")
+	flag.StringVar(&maxBandwidth, "max-bandwidth", os.Getenv("DATUM_MAX_BANDWIDTH"), "combined download rate limit, e.g. 10MB/s (default $DATUM_MAX_BANDWIDTH, else unlimited)")
+	flag.StringVar(&opts.FailOn, "fail-on", "", "which results exit 1: stale, error or never (default: each dataset's policy)")
+	flag.DurationVar(&opts.Timeout, "timeout", 0, "time limit for each dataset's source operations (0 = none)")
+	flag.StringVar(&opts.RunID, "run-id", os.Getenv("DATUM_RUN_ID"), "ID recorded for this run, e.g. the CI job ID (default $DATUM_RUN_ID, else a random UUID)")
 
 	// Parse flags from os.Args[1:]
 	// After this call, flag.Args() contains non-flag arguments (the subcommand and its args)
 	flag.Parse()
 
+	if err := core.ValidateFailOn(opts.FailOn); err != nil {
+		fmt.Fprintf(os.Stderr, "datum: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Redirect temp files and caches before any handler runs
+	fsutil.SetScratchDir(scratchDir)
+
+	// Status lines and long fetches' progress go to stderr, which keeps
+	// stdout clean for reports, tables and `datum cat`
+	level := "info"
+	switch {
+	case quiet && verbose:
+		fmt.Fprintln(os.Stderr, "datum: --quiet and --verbose are mutually exclusive")
+		os.Exit(2)
+	case quiet:
+		level = "warn"
+	case verbose:
+		level = "debug"
+	}
+	if err := core.SetLogging(os.Stderr, level, logFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "datum: %v\n", err)
+		os.Exit(2)
+	}
+	if !quiet {
+		core.SetProgressOutput(os.Stderr)
+	}
+	// JSON records are for log collectors, which want the same messages
+	// whatever the machine's language
+	if logFormat == "text" {
+		if err := core.SetLocale(locale); err != nil {
+			fmt.Fprintf(os.Stderr, "datum: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	// One cap for every download of the run (or, for "datum daemon", of
+	// every repository it serves)
+	if maxBandwidth != "" {
+		rate, err := httputil.ParseBandwidth(maxBandwidth)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "datum: --max-bandwidth: %v\n", err)
+			os.Exit(2)
+		}
+		httputil.SetMaxBandwidth(rate)
+	}
+
+	// Trusted config mode: every config load is checked against this hash
+	core.RequireConfigSHA256(configSHA)
+	core.AllowCommands(allowCommands)
+	var allowedHosts []string
+	for _, host := range strings.Split(hosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			allowedHosts = append(allowedHosts, host)
+		}
+	}
+	core.AllowHosts(allowedHosts)
+
+	// Profiles select among multiple lockfiles derived from --lock.
+	// baseLock is kept for commands that address several profiles at once.
+	baseLock := lockPath
+	if profile != "" {
+		if err := core.ValidateProfile(profile); err != nil {
+			fmt.Fprintf(os.Stderr, "datum: %v\n", err)
+			os.Exit(2)
+		}
+		lockPath = core.ProfileLockPath(lockPath, profile)
+	}
+
 	// Require at least one non-flag argument (the subcommand)
 	if flag.NArg() < 1 {
 		usage()
@@ -71,20 +422,309 @@ func main() {
 	// Get the subcommand (first non-flag argument)
 	cmd := flag.Arg(0)
 
+	// Hand network work to the shared daemon. Without one, the run goes
+	// ahead on its own: the daemon saves work, it isn't needed for it.
+	if useDaemon && cmd != "daemon" {
+		if err := daemon.Connect(daemon.DefaultSocket()); err != nil {
+			fmt.Fprintf(os.Stderr, "datum: no daemon (%v); working without it\n", err)
+		}
+	}
+
 	// Dispatch to the appropriate handler based on subcommand
 	switch cmd {
+	case "init":
+		// Scaffold a config and an empty lockfile
+		fs := flag.NewFlagSet("init", flag.ExitOnError)
+		force := fs.Bool("force", false, "overwrite existing files")
+		fs.Parse(flag.Args()[1:])
+		os.Exit(core.Init(cfgPath, lockPath, *force))
+
+	case "adopt":
+		// Pin files that already exist: config stubs plus lock entries
+		fs := flag.NewFlagSet("adopt", flag.ExitOnError)
+		sourceType := fs.String("type", "file", "source type for the new datasets (non-file types get stubs to fill in)")
+		targetDir := fs.String("target-dir", "", "put targets under this directory instead of using the files in place")
+		fs.Parse(flag.Args()[1:])
+		if fs.NArg() != 1 {
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(core.Adopt(cfgPath, lockPath, fs.Arg(0), *sourceType, *targetDir, opts))
+
 	case "check":
 		// Verify all datasets against the lockfile
-		code := core.Check(cfgPath, lockPath)
+		fs := flag.NewFlagSet("check", flag.ExitOnError)
+		fs.StringVar(&opts.Sample, "sample", "", "only check N datasets (or P%), least recently covered first")
+		fs.BoolVar(&opts.HonorCache, "honor-cache", false, "skip re-fingerprinting HTTP sources whose last response is still fresh")
+		fs.StringVar(&opts.MetricsFile, "metrics-file", "", "write Prometheus metrics here (textfile collector format) after the check")
+		interactive := fs.Bool("interactive", false, "ask whether to accept each changed dataset (fail policy), pinning approvals immediately")
+		tagFlags(fs, &opts)
+		output := outputFlags(fs)
+		fs.Parse(flag.Args()[1:])
+		setOutput(*output, &opts)
+		if *interactive {
+			// Prompts need someone to answer them; piped input would accept blindly
+			if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+				fmt.Fprintln(os.Stderr, "datum: --interactive needs a terminal on stdin")
+				os.Exit(2)
+			}
+			opts.Interactive = os.Stdin
+		}
+		interruptible(&opts)
+		code := core.CheckWithOptions(cfgPath, lockPath, opts)
 		os.Exit(code)
 
 	case "fetch":
 		// Fetch specific datasets (or all if none specified)
 		// flag.Args() returns all non-flag arguments, [1:] skips the subcommand itself
-		ids := flag.Args()[1:]
-		code := core.Fetch(cfgPath, lockPath, ids)
+		fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+		fs.BoolVar(&opts.Transactional, "transactional", false, "replace targets and write the lock only if every dataset is fetched")
+		tagFlags(fs, &opts)
+		output := outputFlags(fs)
+		fs.Parse(flag.Args()[1:])
+		setOutput(*output, &opts)
+		ids := fs.Args()
+		interruptible(&opts)
+		code := core.FetchWithOptions(cfgPath, lockPath, ids, opts)
 		os.Exit(code)
 
+	case "update":
+		// Accept upstream changes: refetch and re-pin whatever the policy
+		interruptible(&opts)
+		os.Exit(core.Update(cfgPath, lockPath, flag.Args()[1:], opts))
+
+	case "verify":
+		// Hash local targets against the lockfile, offline
+		os.Exit(core.Verify(cfgPath, lockPath, flag.Args()[1:], opts))
+
+	case "bump":
+		// Set a dataset's version, refetch it and update the lock
+		if flag.NArg() != 3 {
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(core.Bump(cfgPath, lockPath, flag.Arg(1), flag.Arg(2), opts))
+
+	case "outdated":
+		// Report datasets that are behind upstream, read-only
+		fs := flag.NewFlagSet("outdated", flag.ExitOnError)
+		discover := fs.Bool("discover", false, "also look for newer versions using discover blocks")
+		fs.Parse(flag.Args()[1:])
+		os.Exit(core.Outdated(cfgPath, lockPath, *discover, opts))
+
+	case "diff":
+		// Preview what fetch would change, read-only
+		fs := flag.NewFlagSet("diff", flag.ExitOnError)
+		content := fs.Bool("content", false, "download changed datasets and show a line diff against the local copy")
+		maxSize := fs.String("max-size", "1MiB", "largest file shown line by line with --content")
+		fs.Parse(flag.Args()[1:])
+		limit := ""
+		if *content {
+			limit = *maxSize
+		}
+		interruptible(&opts)
+		os.Exit(core.Diff(cfgPath, lockPath, fs.Args(), limit, opts))
+
+	case "validate":
+		// Check the config strictly, reporting every problem
+		if flag.NArg() != 1 {
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(core.Validate(cfgPath))
+
+	case "list":
+		// List the configured datasets, read-only
+		fs := flag.NewFlagSet("list", flag.ExitOnError)
+		asJSON := fs.Bool("json", false, "emit a JSON array")
+		fs.Parse(flag.Args()[1:])
+		if fs.NArg() > 0 {
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(core.List(cfgPath, *asJSON))
+
+	case "cat":
+		// Stream one dataset's verified pinned content to stdout
+		if flag.NArg() != 2 {
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(core.Cat(cfgPath, lockPath, flag.Arg(1)))
+
+	case "probe":
+		// Ask the handlers how they would serve a location, and suggest a dataset
+		if flag.NArg() != 2 {
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(core.Probe(flag.Arg(1), opts))
+
+	case "handlers":
+		// List the handlers compiled into this binary
+		os.Exit(core.Handlers())
+
+	case "daemon":
+		// Serve source operations to the datum commands of every repository
+		os.Exit(runDaemon(flag.Args()[1:]))
+
+	case "watch":
+		// Keep checking in the foreground, or schedule this repository's
+		// check with the operating system
+		if flag.NArg() > 1 && flag.Arg(1) == "install-service" {
+			os.Exit(installService(flag.Args()[1:]))
+		}
+		os.Exit(runWatch(cfgPath, lockPath, flag.Args()[1:], opts))
+
+	case "status":
+		// Report local state without touching anything
+		fs := flag.NewFlagSet("status", flag.ExitOnError)
+		sizes := fs.Bool("sizes", false, "report disk usage per tag group against quotas")
+		slowest := fs.Int("slowest", 0, "list the N datasets with the slowest recorded operations")
+		remote := fs.Bool("remote", false, "ask each source whether it changed (fingerprints only, nothing is fetched)")
+		fs.Parse(flag.Args()[1:])
+		switch {
+		case *sizes:
+			os.Exit(core.GroupSizes(cfgPath))
+		case *slowest > 0:
+			os.Exit(core.Slowest(cfgPath, lockPath, *slowest, opts))
+		case fs.NArg() > 0:
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(core.StatusTable(cfgPath, lockPath, *remote, opts))
+
+	case "sync-vcs":
+		// Regenerate the managed .gitignore/.gitattributes block
+		os.Exit(core.SyncVCS(cfgPath))
+
+	case "fix-urls":
+		// Rewrite sources that have permanently moved
+		fs := flag.NewFlagSet("fix-urls", flag.ExitOnError)
+		yes := fs.Bool("yes", false, "rewrite without asking for confirmation")
+		fs.Parse(flag.Args()[1:])
+		os.Exit(core.FixURLs(cfgPath, *yes, os.Stdin))
+
+	case "pin":
+		// Publish pinned artifacts to a content-addressed network: "pin push"
+		if flag.Arg(1) != "push" {
+			usage()
+			os.Exit(2)
+		}
+		fs := flag.NewFlagSet("pin push", flag.ExitOnError)
+		backend := fs.String("backend", "ipfs", "content-addressed backend (ipfs)")
+		fs.Parse(flag.Args()[2:])
+		os.Exit(core.PinPush(cfgPath, lockPath, *backend, fs.Args()))
+
+	case "bench":
+		// Measure fingerprint/fetch latency without touching targets or the lock
+		fs := flag.NewFlagSet("bench", flag.ExitOnError)
+		var bo core.BenchOptions
+		fs.IntVar(&bo.Runs, "n", 5, "runs per dataset and operation")
+		fs.BoolVar(&bo.FingerprintOnly, "fingerprint-only", false, "only measure fingerprinting")
+		fs.StringVar(&bo.CPUProfile, "cpuprofile", "", "write a pprof CPU profile to this file")
+		fs.Parse(flag.Args()[1:])
+		os.Exit(core.Bench(cfgPath, fs.Args(), bo))
+
+	case "export":
+		// Export pinned hashes for tools that don't know about datum
+		fs := flag.NewFlagSet("export", flag.ExitOnError)
+		format := fs.String("format", "sha256sums", "output format (sha256sums)")
+		out := fs.String("o", "SHA256SUMS", "output file, or - for stdout")
+		fs.Parse(flag.Args()[1:])
+		os.Exit(core.Export(cfgPath, lockPath, *format, *out))
+
+	case "gc":
+		// Remove temp files left behind by crashed runs
+		fs := flag.NewFlagSet("gc", flag.ExitOnError)
+		tmp := fs.Bool("tmp", false, "remove temp files of datum runs that are no longer running")
+		fs.Parse(flag.Args()[1:])
+		os.Exit(core.GC(cfgPath, *tmp))
+
+	case "cache":
+		// Cache maintenance: "cache list|gc|clear"
+		switch flag.Arg(1) {
+		case "list":
+			os.Exit(core.CacheList(os.Stdout))
+		case "gc":
+			fs := flag.NewFlagSet("cache gc", flag.ExitOnError)
+			maxSize := fs.String("max-size", "", "trim the shared file cache to this size, least recently used first (e.g. 10GiB)")
+			maxAge := fs.String("max-age", "", "remove cached files and git clones not used for this long (e.g. 30d)")
+			fs.Parse(flag.Args()[2:])
+			os.Exit(core.CacheGC(*maxSize, *maxAge))
+		case "clear":
+			os.Exit(core.CacheClear())
+		}
+		usage()
+		os.Exit(2)
+
+	case "prune":
+		// Drop lock entries of datasets removed from the config
+		fs := flag.NewFlagSet("prune", flag.ExitOnError)
+		deleteTargets := fs.Bool("delete-targets", false, "also delete the files those entries pinned")
+		yes := fs.Bool("yes", false, "delete without asking for confirmation")
+		fs.Parse(flag.Args()[1:])
+		if fs.NArg() > 0 {
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(core.Prune(cfgPath, lockPath, *deleteTargets, *yes, os.Stdin, opts))
+
+	case "policy":
+		// Organization policy bundle: "policy update" re-pins it
+		if flag.Arg(1) != "update" || flag.NArg() != 2 {
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(core.UpdatePolicy(cfgPath, lockPath, opts))
+
+	case "report":
+		// Summaries generated on request: "report usage" aggregates past runs
+		if flag.Arg(1) != "usage" {
+			usage()
+			os.Exit(2)
+		}
+		fs := flag.NewFlagSet("report usage", flag.ExitOnError)
+		hosts := fs.Bool("hosts", false, "break sources down by host, not only by type")
+		out := fs.String("o", "-", "output file, or - for stdout")
+		fs.Parse(flag.Args()[2:])
+		if fs.NArg() > 0 {
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(core.UsageReportJSON(lockPath, *hosts, *out, opts))
+
+	case "lock":
+		// Lockfile maintenance commands: "lock <subcommand>"
+		switch flag.Arg(1) {
+		case "verify":
+			// Validate the lockfile offline against the config
+			fs := flag.NewFlagSet("lock verify", flag.ExitOnError)
+			withLog := fs.Bool("tlog", false, "also verify every pin against the transparency log")
+			fs.Parse(flag.Args()[2:])
+			os.Exit(core.VerifyLock(cfgPath, lockPath, *withLog))
+		case "diff":
+			// Compare two lockfiles (e.g. from two releases)
+			fs := flag.NewFlagSet("lock diff", flag.ExitOnError)
+			asJSON := fs.Bool("json", false, "emit a JSON report")
+			fs.Parse(flag.Args()[2:])
+			if fs.NArg() != 2 {
+				usage()
+				os.Exit(2)
+			}
+			os.Exit(core.DiffLocks(fs.Arg(0), fs.Arg(1), *asJSON))
+		case "promote":
+			// Copy pins from one profile's lockfile into another's
+			if flag.NArg() < 4 {
+				usage()
+				os.Exit(2)
+			}
+			os.Exit(core.PromoteLock(baseLock, flag.Arg(2), flag.Arg(3), flag.Args()[4:]))
+		default:
+			usage()
+			os.Exit(2)
+		}
+
 	default:
 		// Unknown subcommand - show usage and exit
 		usage()
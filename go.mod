@@ -4,12 +4,17 @@ go 1.23.0
 
 require (
 	github.com/go-git/go-git/v5 v5.13.0
+	github.com/go-sql-driver/mysql v1.9.3
+	github.com/klauspost/compress v1.18.0
+	github.com/lib/pq v1.10.9
+	github.com/ulikunitz/xz v0.5.9
 	golang.org/x/crypto v0.36.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	dario.cat/mergo v1.0.0 // indirect
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/Microsoft/go-winio v0.6.1 // indirect
 	github.com/ProtonMail/go-crypto v1.1.3 // indirect
 	github.com/cloudflare/circl v1.6.1 // indirect
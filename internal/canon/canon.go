@@ -0,0 +1,155 @@
+// Package canon computes content fingerprints that ignore volatile details.
+//
+// Some sources regenerate their data on every request: a JSON export with a
+// "generated_at" timestamp, a CSV served with Windows line endings by one
+// mirror and Unix ones by another. Hashing the raw bytes makes those look
+// like a change every time. Handlers that fingerprint by content call Hash,
+// which applies a source's registry.Canonicalize settings first.
+package canon
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Hash returns the hex SHA256 of r's content after canonicalizing it as c
+// says. A nil c hashes the bytes as they are.
+//
+// Line-ending normalization streams, so it's fine on huge files; the JSON
+// options need the whole document in memory.
+func Hash(r io.Reader, c *registry.Canonicalize) (string, error) {
+	h := sha256.New()
+	switch {
+	case c == nil:
+		if _, err := io.Copy(h, r); err != nil {
+			return "", err
+		}
+	case c.SortKeys || len(c.StripFields) > 0:
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return "", err
+		}
+		if c.LineEndings {
+			b = bytes.TrimPrefix(b, bom) // JSON whitespace already covers CR
+		}
+		out, err := JSON(b, c.StripFields)
+		if err != nil {
+			return "", err
+		}
+		h.Write(out)
+	case c.LineEndings:
+		if err := normalizeLines(h, r); err != nil {
+			return "", err
+		}
+	default:
+		if _, err := io.Copy(h, r); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Validate checks c without any content.
+func Validate(c *registry.Canonicalize) error {
+	for _, f := range c.StripFields {
+		if f == "" || strings.HasPrefix(f, ".") || strings.HasSuffix(f, ".") || strings.Contains(f, "..") {
+			return fmt.Errorf("canonicalize.strip_fields: invalid field %q", f)
+		}
+	}
+	return nil
+}
+
+// bom is the UTF-8 byte order mark.
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+// normalizeLines copies r to w with CRLF and lone CR turned into LF, and a
+// leading byte order mark dropped.
+//
+// Go learning note: a CR at the end of one read can be followed by the LF at
+// the start of the next, so the reader is consumed a byte at a time through
+// bufio rather than by rewriting whole chunks.
+func normalizeLines(w io.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	if head, err := br.Peek(len(bom)); err == nil && bytes.Equal(head, bom) {
+		br.Discard(len(bom))
+	}
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if c == '\r' {
+			if next, err := br.Peek(1); err == nil && next[0] == '\n' {
+				br.Discard(1)
+			}
+			c = '\n'
+		}
+		bw.WriteByte(c)
+	}
+	return bw.Flush()
+}
+
+// JSON returns the canonical form of the JSON document b: strip removed (see
+// registry.Canonicalize.StripFields), object keys sorted, no insignificant
+// whitespace. Numbers are kept exactly as written.
+func JSON(b []byte, strip []string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber() // Re-encoding 1.10 as 1.1 would change nothing, but 2^63 would lose precision
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("canonicalize: content is not valid JSON: %w", err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("canonicalize: content is not a single JSON document")
+	}
+	for _, field := range strip {
+		if strings.Contains(field, ".") {
+			stripPath(v, strings.Split(field, "."))
+		} else {
+			stripEverywhere(v, field)
+		}
+	}
+	// encoding/json writes map keys sorted, which is the canonical order
+	return json.Marshal(v)
+}
+
+// stripPath deletes the field at path (object keys from the root).
+func stripPath(v any, path []string) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		delete(obj, path[0])
+		return
+	}
+	stripPath(obj[path[0]], path[1:])
+}
+
+// stripEverywhere deletes name from every object in v, at any depth.
+func stripEverywhere(v any, name string) {
+	switch x := v.(type) {
+	case map[string]any:
+		delete(x, name)
+		for _, child := range x {
+			stripEverywhere(child, name)
+		}
+	case []any:
+		for _, child := range x {
+			stripEverywhere(child, name)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package canon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func sha(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestHash(t *testing.T) {
+	lines := &registry.Canonicalize{LineEndings: true}
+	sorted := &registry.Canonicalize{SortKeys: true}
+	strip := &registry.Canonicalize{StripFields: []string{"generated_at", "meta.request_id"}}
+
+	tests := []struct {
+		name    string
+		a, b    string
+		c       *registry.Canonicalize
+		sameFor bool // Whether a and b should hash the same
+	}{
+		{"raw bytes differ", "a\r\nb\r\n", "a\nb\n", nil, false},
+		{"CRLF vs LF", "a\r\nb\r\n", "a\nb\n", lines, true},
+		{"lone CR", "a\rb", "a\nb", lines, true},
+		{"BOM", "\xEF\xBB\xBFid,x\n", "id,x\n", lines, true},
+		{"content still matters", "a\r\nb\r\n", "a\nc\n", lines, false},
+		{"key order and whitespace", `{"b": 1, "a": [1, 2]}`, `{"a":[1,2],"b":1}`, sorted, true},
+		{"numbers kept exactly", `{"a": 1.10}`, `{"a": 1.1}`, sorted, false},
+		{"timestamp at any depth", `{"x":1,"generated_at":"mon","rows":[{"generated_at":"mon","v":2}]}`, `{"rows":[{"v":2,"generated_at":"tue"}],"generated_at":"tue","x":1}`, strip, true},
+		{"dotted path only from the root", `{"meta":{"request_id":"a"},"data":{"request_id":"a"}}`, `{"meta":{"request_id":"b"},"data":{"request_id":"b"}}`, strip, false},
+		{"dotted path", `{"meta":{"request_id":"a","v":1}}`, `{"meta":{"request_id":"b","v":1}}`, strip, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ha, err := Hash(strings.NewReader(tt.a), tt.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hb, err := Hash(strings.NewReader(tt.b), tt.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (ha == hb) != tt.sameFor {
+				t.Errorf("Hash(%q) == Hash(%q) is %v, want %v", tt.a, tt.b, ha == hb, tt.sameFor)
+			}
+		})
+	}
+
+	if got, _ := Hash(strings.NewReader("plain"), nil); got != sha("plain") {
+		t.Errorf("Hash(nil canonicalize) = %s, want the plain sha256", got)
+	}
+	if got, _ := Hash(strings.NewReader("a\r\n"), lines); got != sha("a\n") {
+		t.Errorf("Hash(line_endings) = %s, want sha256 of the normalized text", got)
+	}
+}
+
+func TestHash_InvalidJSON(t *testing.T) {
+	c := &registry.Canonicalize{SortKeys: true}
+	for _, doc := range []string{"<html>", `{"a":1} {"b":2}`} {
+		if _, err := Hash(strings.NewReader(doc), c); err == nil {
+			t.Errorf("Hash(%q) succeeded", doc)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(&registry.Canonicalize{StripFields: []string{"generated_at", "meta.ts"}}); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	for _, f := range []string{"", ".ts", "meta.", "a..b"} {
+		if err := Validate(&registry.Canonicalize{StripFields: []string{f}}); err == nil {
+			t.Errorf("Validate(strip %q) succeeded", f)
+		}
+	}
+}
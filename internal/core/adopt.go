@@ -0,0 +1,251 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// adoptedDataset is the stub written to the config for each adopted file,
+// with its keys in the order people write them.
+type adoptedDataset struct {
+	ID     string          `yaml:"id"`
+	Source registry.Source `yaml:"source"`
+	Target string          `yaml:"target"`
+}
+
+// Adopt bootstraps pinning for data that already exists: every file under dir
+// becomes a dataset in the config, and its current hash is recorded in the
+// lockfile, so the very next check verifies it.
+//
+// With sourceType "file" (the default) each dataset's source is the file
+// itself, so the pin is complete: check re-hashes the file, and fetch copies
+// it to its target. Other types get a stub source to fill in (a URL, say),
+// with a comment saying so; their lock entries carry the local hash but no
+// remote fingerprint yet, so the first check reports them as changed until
+// they are fetched or accepted.
+//
+// Targets are the files themselves, or the same relative paths under
+// targetDir when it's set (for adopting a share into the repository).
+//
+// Hidden files and directories (.git, .data.yaml, ...) are skipped, as are
+// files already used as a target or file source by the config. The config is
+// created if it doesn't exist yet, and otherwise edited as a yaml.Node tree
+// so its comments survive.
+//
+// Returns:
+//   - 0: Files adopted (or nothing new to adopt)
+//   - 1: A file couldn't be hashed or a write failed
+//   - 2: Bad arguments or config error
+func Adopt(cfgPath, lockPath, dir, sourceType, targetDir string, opts Options) int {
+	if requiredConfigSHA256 != "" {
+		logln("adopt error: adopt edits the config, which --config-sha256 forbids")
+		return 2
+	}
+	sourceType = firstNonEmpty(sourceType, "file")
+	opts = opts.withRunID()
+	if _, ok := registry.Get(sourceType); !ok {
+		logf("adopt error: unknown source type %q\n", sourceType)
+		return 2
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		logf("adopt error: %s is not a directory\n", dir)
+		return 2
+	}
+
+	// Start from the existing config, or an empty one
+	cfgBytes, err := os.ReadFile(cfgPath)
+	taken := map[string]bool{}   // Dataset IDs in use
+	tracked := map[string]bool{} // Absolute paths the config already covers
+	switch {
+	case err == nil:
+		cfg, err := readConfig(cfgPath)
+		if err != nil {
+			logf("config error: %v\n", err)
+			return 2
+		}
+		for _, ds := range cfg.Datasets {
+			taken[ds.ID] = true
+			tracked[absPath(ds.Target)] = true
+			for _, src := range ds.GetSources() {
+				if src.Type == "file" {
+					tracked[absPath(src.Path)] = true
+				}
+			}
+		}
+	case os.IsNotExist(err):
+		cfgBytes = []byte("version: 1\ndatasets: []\n")
+	default:
+		logf("config error: %v\n", err)
+		return 2
+	}
+	for _, p := range []string{cfgPath, lockPath, firstNonEmpty(opts.LockOut, lockPath), firstNonEmpty(opts.StatusFile, defaultStatusPath(lockPath))} {
+		tracked[absPath(p)] = true
+	}
+
+	lk, _ := readLock(lockPath)
+	if lk.Items == nil {
+		lk.Items = map[string]*LockItem{}
+	}
+
+	// Walk the directory; WalkDir visits entries in lexical order, so IDs
+	// and the config come out in a stable order
+	now := time.Now().UTC()
+	var added []adoptedDataset
+	exit := 0
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || tracked[absPath(path)] {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		h, err := HashFile(path)
+		if err != nil {
+			logf("[ERR ] %s: %v\n", path, err)
+			exit = 1
+			return nil
+		}
+		id := uniqueID(datasetIDFor(rel), taken)
+		ds := adoptedDataset{ID: id, Source: registry.Source{Type: sourceType}, Target: path}
+		if targetDir != "" {
+			ds.Target = filepath.Join(targetDir, rel)
+		}
+		item := &LockItem{Target: ds.Target, LocalSHA256: h, Size: fileSize(path), CheckedAt: &now, RunID: opts.RunID}
+		if sourceType == "file" {
+			ds.Source.Path = path
+			item.RemoteFingerprint = "sha256:" + h // What the file handler will report
+		}
+		lk.Items[id] = item
+		added = append(added, ds)
+		logf("[OK  ] %s: adopted %s (%s)\n", id, path, formatBytes(item.Size))
+		return nil
+	})
+	if err != nil {
+		logf("adopt error: %v\n", err)
+		return 1
+	}
+	if len(added) == 0 {
+		logf("[INFO] nothing new to adopt under %s\n", dir)
+		return exit
+	}
+
+	updated, err := appendDatasets(cfgBytes, added, sourceType != "file")
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	if err := fsutil.WriteFileAtomic(cfgPath, bytes.NewReader(updated)); err != nil {
+		logf("config write error: %v\n", err)
+		return 1
+	}
+	lk.Version = 1
+	if err := saveLock(lockPath, lk, opts); err != nil {
+		logf("lock write error: %v\n", err)
+		return 1
+	}
+
+	logf("[INFO] added %d datasets to %s\n", len(added), cfgPath)
+	switch {
+	case sourceType != "file":
+		logf("[INFO] fill in each %s source, then run: datum fetch\n", sourceType)
+	case targetDir != "":
+		logf("[INFO] run 'datum fetch' to copy them into %s\n", targetDir)
+	}
+	return exit
+}
+
+// appendDatasets adds datasets to the end of the config document's datasets
+// list (creating the list if needed). With todo set, each gets a comment
+// asking for its source to be filled in.
+func appendDatasets(b []byte, datasets []adoptedDataset, todo bool) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config is not a YAML mapping")
+	}
+	root := doc.Content[0]
+	list := mappingValue(root, "datasets")
+	if list == nil {
+		list = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "datasets"}, list)
+	}
+	if list.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("config datasets is not a list")
+	}
+	list.Style = 0 // An empty "datasets: []" would otherwise stay in flow style
+
+	for _, ds := range datasets {
+		var n yaml.Node
+		if err := n.Encode(ds); err != nil {
+			return nil, err
+		}
+		if todo {
+			n.HeadComment = fmt.Sprintf("TODO: set the %s source for %s", ds.Source.Type, ds.Target)
+		}
+		list.Content = append(list.Content, &n)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// nonIDChars matches runs of characters that don't belong in a dataset ID.
+var nonIDChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// datasetIDFor derives a dataset ID from a file's path relative to the adopted
+// directory: "raw/Census 2020.csv" becomes "raw_census_2020".
+func datasetIDFor(rel string) string {
+	rel = strings.TrimSuffix(rel, filepath.Ext(rel))
+	id := strings.Trim(nonIDChars.ReplaceAllString(strings.ToLower(rel), "_"), "_")
+	return firstNonEmpty(id, "dataset")
+}
+
+// uniqueID returns id, or id_2, id_3, ... if it's taken, and marks the result taken.
+func uniqueID(id string, taken map[string]bool) string {
+	candidate := id
+	for n := 2; taken[candidate]; n++ {
+		candidate = fmt.Sprintf("%s_%d", id, n)
+	}
+	taken[candidate] = true
+	return candidate
+}
+
+// absPath returns path made absolute, or path itself if that fails.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
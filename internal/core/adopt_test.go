@@ -0,0 +1,166 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// mockFileHandler stands in for the file handler, which core can't import:
+// its fingerprint is the file's sha256, like the real one.
+type mockFileHandler struct{}
+
+func (m *mockFileHandler) Name() string { return "file" }
+
+func (m *mockFileHandler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	h, err := HashFile(src.Path)
+	return "sha256:" + h, err
+}
+
+func (m *mockFileHandler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	b, err := os.ReadFile(src.Path)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(dest), 0o755)
+	return os.WriteFile(dest, b, 0o644)
+}
+
+func init() {
+	registry.Register(&mockFileHandler{})
+}
+
+func TestDatasetIDFor(t *testing.T) {
+	tests := map[string]string{
+		"census.csv":                "census",
+		"raw/Census 2020.csv":       "raw_census_2020",
+		filepath.Join("a", "b.tar"): "a_b",
+		"---.txt":                   "dataset",
+	}
+	for rel, want := range tests {
+		if got := datasetIDFor(rel); got != want {
+			t.Errorf("datasetIDFor(%q) = %q, want %q", rel, got, want)
+		}
+	}
+	taken := map[string]bool{"census": true}
+	if got := uniqueID("census", taken); got != "census_2" {
+		t.Errorf("uniqueID() = %q, want census_2", got)
+	}
+	if got := uniqueID("census", taken); got != "census_3" {
+		t.Errorf("second uniqueID() = %q, want census_3", got)
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	// setup creates a data directory with two files, a hidden one and a
+	// nested one, and returns it with config and lock paths next to it
+	setup := func(t *testing.T) (dir, cfgPath, lockPath string) {
+		root := t.TempDir()
+		dir = filepath.Join(root, "data")
+		os.MkdirAll(filepath.Join(dir, "raw"), 0o755)
+		os.MkdirAll(filepath.Join(dir, ".cache"), 0o755)
+		os.WriteFile(filepath.Join(dir, "census.csv"), []byte("a,b\n"), 0o644)
+		os.WriteFile(filepath.Join(dir, "census.json"), []byte("{}"), 0o644)
+		os.WriteFile(filepath.Join(dir, "raw", "counts.tsv"), []byte("1\t2\n"), 0o644)
+		os.WriteFile(filepath.Join(dir, ".DS_Store"), []byte("x"), 0o644)
+		os.WriteFile(filepath.Join(dir, ".cache", "junk"), []byte("x"), 0o644)
+		return dir, filepath.Join(root, ".data.yaml"), filepath.Join(root, ".data.lock.yaml")
+	}
+
+	t.Run("new config, then check passes", func(t *testing.T) {
+		dir, cfgPath, lockPath := setup(t)
+		if code := Adopt(cfgPath, lockPath, dir, "", "", Options{}); code != 0 {
+			t.Fatalf("Adopt() = %d, want 0", code)
+		}
+		cfg, err := readConfig(cfgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, ds := range cfg.Datasets {
+			ids = append(ids, ds.ID)
+		}
+		if got := strings.Join(ids, " "); got != "census census_2 raw_counts" {
+			t.Errorf("adopted %q, want census census_2 raw_counts (hidden files skipped)", got)
+		}
+		if ds := cfg.Datasets[0]; ds.Source.Type != "file" || ds.Source.Path != ds.Target {
+			t.Errorf("dataset = %+v, want a file source pinning the file in place", ds)
+		}
+		if code := Check(cfgPath, lockPath); code != 0 {
+			t.Errorf("Check() after adopt = %d, want 0", code)
+		}
+	})
+
+	t.Run("existing config keeps its datasets and comments", func(t *testing.T) {
+		dir, cfgPath, lockPath := setup(t)
+		os.WriteFile(cfgPath, []byte(`version: 1
+# hand-written
+datasets:
+  - id: census
+    source: {type: mock}
+    target: `+filepath.Join(dir, "census.csv")+`
+`), 0o644)
+		if code := Adopt(cfgPath, lockPath, dir, "", "", Options{}); code != 0 {
+			t.Fatalf("Adopt() = %d, want 0", code)
+		}
+		b, _ := os.ReadFile(cfgPath)
+		cfg, err := readConfig(cfgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), "# hand-written") || len(cfg.Datasets) != 3 || cfg.Datasets[1].ID != "census_2" {
+			t.Errorf("config after adopt (census.csv is already a target):\n%s", b)
+		}
+
+		// Adopting again finds nothing new
+		if code := Adopt(cfgPath, lockPath, dir, "", "", Options{}); code != 0 {
+			t.Errorf("second Adopt() = %d, want 0", code)
+		}
+		if cfg, _ := readConfig(cfgPath); len(cfg.Datasets) != 3 {
+			t.Errorf("second adopt changed the config to %d datasets", len(cfg.Datasets))
+		}
+	})
+
+	t.Run("target dir", func(t *testing.T) {
+		dir, cfgPath, lockPath := setup(t)
+		targets := filepath.Join(filepath.Dir(dir), "local")
+		if code := Adopt(cfgPath, lockPath, dir, "file", targets, Options{}); code != 0 {
+			t.Fatalf("Adopt() = %d, want 0", code)
+		}
+		if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+			t.Fatalf("Fetch() = %d, want 0", code)
+		}
+		if b, err := os.ReadFile(filepath.Join(targets, "raw", "counts.tsv")); err != nil || string(b) != "1\t2\n" {
+			t.Errorf("fetched target = %q, %v", b, err)
+		}
+	})
+
+	t.Run("other source type", func(t *testing.T) {
+		dir, cfgPath, lockPath := setup(t)
+		if code := Adopt(cfgPath, lockPath, dir, "mock", "", Options{}); code != 0 {
+			t.Fatalf("Adopt() = %d, want 0", code)
+		}
+		b, _ := os.ReadFile(cfgPath)
+		if !strings.Contains(string(b), "# TODO: set the mock source for") {
+			t.Errorf("stubs have no TODO comment:\n%s", b)
+		}
+		lk, _ := readLock(lockPath)
+		if item := lk.Items["census"]; item == nil || item.LocalSHA256 == "" || item.RemoteFingerprint != "" {
+			t.Errorf("lock entry = %+v, want the local hash only", item)
+		}
+	})
+
+	t.Run("bad arguments", func(t *testing.T) {
+		dir, cfgPath, lockPath := setup(t)
+		if code := Adopt(cfgPath, lockPath, dir, "nosuchtype", "", Options{}); code != 2 {
+			t.Errorf("unknown type: Adopt() = %d, want 2", code)
+		}
+		if code := Adopt(cfgPath, lockPath, filepath.Join(dir, "census.csv"), "", "", Options{}); code != 2 {
+			t.Errorf("file instead of directory: Adopt() = %d, want 2", code)
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Archive members: upstream releases often bundle the one file a project needs
+// inside a large zip or tar. A source's archive_path names that file: the
+// archive is fetched as usual and only the member is written to the target.
+// This works with any source type, unlike the http handler's member setting,
+// which reads a single zip member with range requests.
+//
+// The lock's local_sha256 is the member's hash and raw_sha256 the archive's.
+// When the archive's fingerprint changes, check fetches it once more and
+// compares the member with the lock: an archive that was rebuilt around an
+// unchanged member doesn't make the dataset stale. A compressed tar needs
+// decompress as well (decompress: gzip for .tar.gz).
+
+// validateArchivePath checks a source's archive_path setting.
+func validateArchivePath(src registry.Source) error {
+	if src.ArchivePath == "" {
+		return nil
+	}
+	if memberName(src.ArchivePath) == "" || strings.HasSuffix(src.ArchivePath, "/") {
+		return fmt.Errorf("archive_path: %q must name a file inside the archive", src.ArchivePath)
+	}
+	return nil
+}
+
+// memberName normalizes an archive member's name for comparison: slashes,
+// no leading "./" or "/", no trailing slash.
+func memberName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, `\`, "/")), "/")
+}
+
+// unpackMember replaces the zip or tar archive at file with its member name.
+// The archive's format is told from its content, not its name.
+func unpackMember(file, name string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	head := make([]byte, 4)
+	n, _ := io.ReadFull(in, head)
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var member io.Reader
+	if bytes.HasPrefix(head[:n], []byte("PK")) {
+		member, err = zipMember(in, name)
+	} else {
+		member, err = tarMember(in, name)
+	}
+	if err != nil {
+		return err
+	}
+	if c, ok := member.(io.Closer); ok {
+		defer c.Close()
+	}
+	tmp := file + ".member"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if _, err := io.Copy(out, member); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close() // Windows can't rename over an open file
+	return os.Rename(tmp, file)
+}
+
+// zipMember opens name in the zip archive f. archive/zip checks the member's
+// CRC-32 as it's read.
+func zipMember(f *os.File, name string) (io.Reader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return nil, fmt.Errorf("not a zip archive: %w", err)
+	}
+	want := memberName(name)
+	for _, zf := range zr.File {
+		if memberName(zf.Name) != want {
+			continue
+		}
+		if zf.FileInfo().IsDir() {
+			return nil, errors.New("is a directory in the archive")
+		}
+		return zf.Open()
+	}
+	return nil, errors.New("not found in the zip archive")
+}
+
+// tarMember finds name in the tar archive r and returns a reader positioned
+// at its content.
+func tarMember(r io.Reader, name string) (io.Reader, error) {
+	tr := tar.NewReader(r)
+	want := memberName(name)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.New("not found in the tar archive")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a tar archive (set decompress for a compressed one): %w", err)
+		}
+		if memberName(hdr.Name) != want {
+			continue
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			return nil, errors.New("is not a regular file in the archive")
+		}
+		return tr, nil
+	}
+}
+
+// archiveMemberUnchanged reports whether the archive src serves now still
+// holds the content pinned in item, by fetching and reshaping it in a
+// temporary directory. Errors count as changed: the regular update path
+// reports them.
+func archiveMemberUnchanged(ctx context.Context, f registry.Fetcher, src registry.Source, ds Dataset, item *LockItem) bool {
+	dir, err := fsutil.MkdirTemp("datum-archive-*")
+	if err != nil {
+		return false
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, filepath.Base(ds.Target))
+	src.Progress = newProgress(ds.ID)
+	if err := f.Fetch(ctx, src, dest); err != nil {
+		return false
+	}
+	if _, err := reshape(dest, src); err != nil {
+		return false
+	}
+	if ds.Transform != "" {
+		if err := applyTransform(ctx, ds, src, dest); err != nil {
+			return false
+		}
+	}
+	h, err := HashFile(dest)
+	return err == nil && h == item.LocalSHA256
+}
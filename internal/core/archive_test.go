@@ -0,0 +1,138 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// writeZip writes a zip archive of files (name -> content) to path.
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// writeTar writes a tar archive of files (name -> content) to path.
+func writeTar(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "./release/", Typeflag: tar.TypeDir, Mode: 0o755})
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+func TestUnpackMember(t *testing.T) {
+	files := map[string]string{"./release/codes.csv": "a,b\n1,2\n", "./release/README": "hi\n"}
+	for format, write := range map[string]func(*testing.T, string, map[string]string){"zip": writeZip, "tar": writeTar} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "archive")
+			write(t, path, files)
+			if err := unpackMember(path, "release/codes.csv"); err != nil {
+				t.Fatal(err)
+			}
+			if got := mustRead(t, path); got != "a,b\n1,2\n" {
+				t.Errorf("member = %q", got)
+			}
+
+			write(t, path, files)
+			if err := unpackMember(path, "release/missing.csv"); err == nil || !strings.Contains(err.Error(), "not found") {
+				t.Errorf("unpackMember(missing) = %v, want not found", err)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "data.csv")
+	os.WriteFile(path, []byte("just,text\n"), 0o644)
+	if err := unpackMember(path, "x.csv"); err == nil {
+		t.Error("unpackMember(plain file) succeeded")
+	}
+}
+
+func TestValidateArchivePath(t *testing.T) {
+	for _, p := range []string{"codes.csv", "release/codes.csv", "./release/codes.csv"} {
+		if err := validateArchivePath(registry.Source{ArchivePath: p}); err != nil {
+			t.Errorf("validateArchivePath(%q) = %v", p, err)
+		}
+	}
+	for _, p := range []string{"/", ".", "release/"} {
+		if err := validateArchivePath(registry.Source{ArchivePath: p}); err == nil {
+			t.Errorf("validateArchivePath(%q) succeeded", p)
+		}
+	}
+	if err := validateSlice(registry.Source{Type: "http", Member: "a.csv", ArchivePath: "a.csv"}); err == nil {
+		t.Error("validateSlice(member and archive_path) succeeded")
+	}
+}
+
+func TestCheck_ArchivePath(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "release.zip")
+	writeZip(t, src, map[string]string{"data/codes.csv": "a,b\n1,2\n", "README": "v1\n"})
+	target := filepath.Join(dir, "codes.csv")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: codes
+    source:
+      type: mockpath
+      path: `+src+`
+      archive_path: data/codes.csv
+    target: `+target+`
+`), 0o644)
+	lockPath := filepath.Join(dir, "lock.yaml")
+
+	if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+		t.Fatalf("Fetch() = %d, want 0", code)
+	}
+	if got := mustRead(t, target); got != "a,b\n1,2\n" {
+		t.Errorf("target = %q, want just the member", got)
+	}
+	lk, _ := readLock(lockPath)
+	item := lk.Items["codes"]
+	raw, _ := HashFile(src)
+	local, _ := HashFile(target)
+	if item.RawSHA256 != raw || item.LocalSHA256 != local || item.Slice != "archive_path=data/codes.csv" {
+		t.Errorf("lock entry = %+v; want raw_sha256 of the archive, local_sha256 of the member", item)
+	}
+
+	// A new release with the same member isn't a change, and is recorded
+	writeZip(t, src, map[string]string{"data/codes.csv": "a,b\n1,2\n", "README": "v2\n"})
+	if code := Check(cfgPath, lockPath); code != 0 {
+		t.Errorf("Check() after an unrelated change = %d, want 0", code)
+	}
+	lk, _ = readLock(lockPath)
+	if fp, _ := HashFile(src); lk.Items["codes"].RemoteFingerprint != fp {
+		t.Errorf("lock fingerprint = %q, want the new archive's %q", lk.Items["codes"].RemoteFingerprint, fp)
+	}
+
+	writeZip(t, src, map[string]string{"data/codes.csv": "a,b\n1,3\n", "README": "v2\n"})
+	if code := Check(cfgPath, lockPath); code != 1 {
+		t.Errorf("Check() after the member changed = %d, want 1", code)
+	}
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// AuthProfile is a named set of credentials, declared once under auth_profiles
+// and selected per dataset with auth.profile.
+//
+// Handlers read credentials from well-known environment variables
+// (AWS_ACCESS_KEY_ID, GIT_TOKEN, GOOGLE_APPLICATION_CREDENTIALS for a command's
+// tools, ...). A profile redirects those names to the variables holding one
+// team's or service account's credentials:
+//
+//	auth_profiles:
+//	  team-a:
+//	    env:
+//	      AWS_ACCESS_KEY_ID: TEAM_A_AWS_ACCESS_KEY_ID
+//	      AWS_SECRET_ACCESS_KEY: TEAM_A_AWS_SECRET_ACCESS_KEY
+//	    token_env: TEAM_A_TOKEN
+//
+// Like the signing settings, a profile only names variables, never secrets,
+// so the config stays safe to commit. Values are read when a handler needs
+// them, so a profile whose variables are unset only fails its own datasets.
+type AuthProfile struct {
+	// Env maps a variable handlers read to the variable that holds its value
+	Env map[string]string `yaml:"env,omitempty"`
+
+	// TokenEnv names a variable holding a scoped bearer token, sent by the
+	// http handler as "Authorization: Bearer <token>" (unless the source signs)
+	TokenEnv string `yaml:"token_env,omitempty"`
+}
+
+// DatasetAuth is a dataset's auth block.
+type DatasetAuth struct {
+	Profile string `yaml:"profile,omitempty"` // Name of an entry in auth_profiles
+}
+
+// applyAuthProfiles resolves every dataset's auth.profile and attaches the
+// resulting registry.Credentials to each of its sources, so handlers see the
+// identity without core having to pass it around separately.
+//
+// Go learning note: Datasets and Sources are slices of structs (not pointers),
+// so we index into them to modify the elements in place - ranging by value
+// would only change copies.
+func applyAuthProfiles(c *Config) error {
+	for name, p := range c.AuthProfiles {
+		for to, from := range p.Env {
+			if to == "" || from == "" {
+				return fmt.Errorf("auth_profiles.%s.env: variable names must not be empty", name)
+			}
+		}
+	}
+	for i := range c.Datasets {
+		ds := &c.Datasets[i]
+		name := ds.Auth.Profile
+		if name == "" {
+			continue
+		}
+		p, ok := c.AuthProfiles[name]
+		if !ok {
+			return fmt.Errorf("dataset %d (%s): auth: unknown profile %q", i, ds.ID, name)
+		}
+		creds := &registry.Credentials{Profile: name, Env: p.Env, TokenEnv: p.TokenEnv}
+		if ds.Source.Type != "" {
+			ds.Source.Credentials = creds
+		}
+		for j := range ds.Sources {
+			ds.Sources[j].Credentials = creds
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyAuthProfiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(tmpDir, "config.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	cfg, err := readConfig(write(`version: 1
+auth_profiles:
+  team-a:
+    env:
+      GIT_TOKEN: TEAM_A_GIT_TOKEN
+    token_env: TEAM_A_TOKEN
+datasets:
+  - id: owned
+    auth:
+      profile: team-a
+    sources:
+      - type: http
+        url: https://a.example.com/x.csv
+      - type: http
+        url: https://mirror.example.com/x.csv
+    target: x.csv
+  - id: public
+    source:
+      type: http
+      url: https://example.com/y.csv
+    target: y.csv
+`))
+	if err != nil {
+		t.Fatalf("readConfig() error = %v", err)
+	}
+	for _, src := range cfg.Datasets[0].GetSources() {
+		c := src.Credentials
+		if c == nil || c.Profile != "team-a" || c.TokenEnv != "TEAM_A_TOKEN" || c.Env["GIT_TOKEN"] != "TEAM_A_GIT_TOKEN" {
+			t.Errorf("%s: credentials = %+v, want team-a's", src.URL, c)
+		}
+	}
+	if c := cfg.Datasets[1].Source.Credentials; c != nil {
+		t.Errorf("dataset without auth got credentials %+v", c)
+	}
+
+	_, err = readConfig(write(`version: 1
+datasets:
+  - id: owned
+    auth:
+      profile: team-b
+    source:
+      type: http
+      url: https://example.com/x.csv
+    target: x.csv
+`))
+	if err == nil || !strings.Contains(err.Error(), `unknown profile "team-b"`) {
+		t.Errorf("readConfig() with unknown profile error = %v", err)
+	}
+}
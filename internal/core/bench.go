@@ -0,0 +1,228 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// BenchOptions controls Bench.
+type BenchOptions struct {
+	Runs            int    // Repetitions per dataset and operation (minimum 1)
+	FingerprintOnly bool   // Skip the fetch measurements
+	CPUProfile      string // Write a pprof CPU profile here ("" = none)
+}
+
+// benchResult holds the measurements of one operation against one source type.
+type benchResult struct {
+	Handler string
+	Op      string // "fingerprint" or "fetch"
+	Times   []time.Duration
+	Bytes   int64 // Total bytes fetched across all runs
+}
+
+// Bench measures fingerprint and fetch latency for datasets.
+//
+// Each selected dataset's primary source is fingerprinted and fetched Runs
+// times. Fetches go to a scratch directory, never to the configured targets, and
+// neither the lockfile nor the status file is touched. The report lists latency
+// percentiles per dataset and then aggregated per handler, along with throughput
+// (operations per second for fingerprints, bytes per second for fetches), which
+// helps pick a --jobs level and spot slow sources.
+//
+// Parameters:
+//   - cfgPath: Path to the configuration file (.data.yaml)
+//   - ids: Dataset IDs to benchmark; empty means all
+//   - bo: Number of runs, fetch toggle, and optional CPU profile path
+//
+// Returns:
+//   - 0: All measurements succeeded
+//   - 1: One or more operations failed (the rest are still reported)
+//   - 2: Configuration error, unknown dataset ID, or the profile couldn't be written
+func Bench(cfgPath string, ids []string, bo BenchOptions) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	datasets, err := selectDatasets(cfg, ids)
+	if err != nil {
+		logf("bench error: %v\n", err)
+		return 2
+	}
+	if bo.Runs < 1 {
+		bo.Runs = 1
+	}
+
+	if bo.CPUProfile != "" {
+		f, err := os.Create(bo.CPUProfile)
+		if err != nil {
+			logf("bench error: %v\n", err)
+			return 2
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			logf("bench error: %v\n", err)
+			return 2
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	scratch, err := fsutil.MkdirTemp("datum-bench-*")
+	if err != nil {
+		logf("bench error: %v\n", err)
+		return 2
+	}
+	defer os.RemoveAll(scratch)
+
+	ctx := context.Background()
+	exit := 0
+	var perDataset []benchRow
+	for _, ds := range datasets {
+		src := ds.GetSources()[0]
+		f, ok := registry.Get(src.Type)
+		if !ok {
+			logf("[ERR ] %s: unknown source.type=%q\n", ds.ID, src.Type)
+			exit = 1
+			continue
+		}
+
+		fp := &benchResult{Handler: src.Type, Op: "fingerprint"}
+		for i := 0; i < bo.Runs; i++ {
+			start := time.Now()
+			if _, err := f.Fingerprint(ctx, src); err != nil {
+				logf("[ERR ] %s: fingerprint: %v\n", ds.ID, err)
+				exit = 1
+				break
+			}
+			fp.Times = append(fp.Times, time.Since(start))
+		}
+		perDataset = append(perDataset, benchRow{ds.ID, fp})
+
+		if bo.FingerprintOnly {
+			continue
+		}
+		fe := &benchResult{Handler: src.Type, Op: "fetch"}
+		dest := filepath.Join(scratch, ds.ID, filepath.Base(ds.Target))
+		for i := 0; i < bo.Runs; i++ {
+			start := time.Now()
+			if err := f.Fetch(ctx, src, dest); err != nil {
+				logf("[ERR ] %s: fetch: %v\n", ds.ID, err)
+				exit = 1
+				break
+			}
+			fe.Times = append(fe.Times, time.Since(start))
+			fe.Bytes += fileSize(dest)
+		}
+		perDataset = append(perDataset, benchRow{ds.ID, fe})
+	}
+
+	fmt.Printf("%-24s %-10s %-12s %5s %10s %10s %10s %14s\n", "DATASET", "HANDLER", "OP", "RUNS", "P50", "P90", "MAX", "THROUGHPUT")
+	for _, row := range perDataset {
+		printBenchRow(row.id, row.res)
+	}
+
+	// Aggregate per handler and operation
+	byHandler := map[string]*benchResult{}
+	var keys []string
+	for _, row := range perDataset {
+		key := row.res.Handler + "/" + row.res.Op
+		agg := byHandler[key]
+		if agg == nil {
+			agg = &benchResult{Handler: row.res.Handler, Op: row.res.Op}
+			byHandler[key] = agg
+			keys = append(keys, key)
+		}
+		agg.Times = append(agg.Times, row.res.Times...)
+		agg.Bytes += row.res.Bytes
+	}
+	sort.Strings(keys)
+	fmt.Println()
+	for _, key := range keys {
+		printBenchRow("(all)", byHandler[key])
+	}
+
+	return exit
+}
+
+// benchRow pairs a dataset ID with its measurements, preserving report order.
+type benchRow struct {
+	id  string
+	res *benchResult
+}
+
+// printBenchRow prints one line of the bench report.
+func printBenchRow(id string, r *benchResult) {
+	if len(r.Times) == 0 {
+		fmt.Printf("%-24s %-10s %-12s %5d %10s %10s %10s %14s\n", id, r.Handler, r.Op, 0, "-", "-", "-", "-")
+		return
+	}
+	var total time.Duration
+	for _, d := range r.Times {
+		total += d
+	}
+	throughput := "-"
+	if secs := total.Seconds(); secs > 0 {
+		if r.Op == "fetch" {
+			throughput = formatBytes(int64(float64(r.Bytes)/secs)) + "/s"
+		} else {
+			throughput = fmt.Sprintf("%.1f op/s", float64(len(r.Times))/secs)
+		}
+	}
+	fmt.Printf("%-24s %-10s %-12s %5d %10s %10s %10s %14s\n", id, r.Handler, r.Op, len(r.Times),
+		roundDuration(percentile(r.Times, 50)), roundDuration(percentile(r.Times, 90)), roundDuration(percentile(r.Times, 100)), throughput)
+}
+
+// percentile returns the p-th percentile (nearest-rank) of durations.
+func percentile(durations []time.Duration, p int) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * n)
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// roundDuration trims a duration to a readable precision.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+// selectDatasets returns the datasets named by ids in config order, or all of
+// them when ids is empty. Unknown IDs are an error.
+func selectDatasets(cfg *Config, ids []string) ([]Dataset, error) {
+	if len(ids) == 0 {
+		return cfg.Datasets, nil
+	}
+	want := map[string]bool{}
+	for _, id := range ids {
+		want[id] = true
+	}
+	var out []Dataset
+	for _, ds := range cfg.Datasets {
+		if want[ds.ID] {
+			out = append(out, ds)
+			delete(want, ds.ID)
+		}
+	}
+	for _, id := range ids {
+		if want[id] {
+			return nil, fmt.Errorf("no dataset with ID %q", id)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	ms := func(n ...int) []time.Duration {
+		var out []time.Duration
+		for _, v := range n {
+			out = append(out, time.Duration(v)*time.Millisecond)
+		}
+		return out
+	}
+	durations := ms(50, 10, 40, 20, 30, 60, 70, 80, 90, 100)
+
+	tests := []struct {
+		p    int
+		want time.Duration
+	}{
+		{50, 50 * time.Millisecond},
+		{90, 90 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+		{1, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(durations, tt.p); got != tt.want {
+			t.Errorf("percentile(p%d) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile(nil) = %v, want 0", got)
+	}
+	if durations[0] != 50*time.Millisecond {
+		t.Error("percentile must not reorder its input")
+	}
+}
+
+func TestBench(t *testing.T) {
+	tmpDir := t.TempDir()
+	target := filepath.Join(tmpDir, "data.txt")
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := `version: 1
+datasets:
+  - id: ok
+    source:
+      type: mock
+    target: ` + target + `
+  - id: broken
+    source:
+      type: mockfail
+    target: ` + filepath.Join(tmpDir, "broken.txt") + `
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("successful dataset", func(t *testing.T) {
+		profile := filepath.Join(tmpDir, "cpu.pprof")
+		if code := Bench(configPath, []string{"ok"}, BenchOptions{Runs: 3, CPUProfile: profile}); code != 0 {
+			t.Errorf("Bench() = %d, want 0", code)
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Error("Bench() must not write the configured target")
+		}
+		if fi, err := os.Stat(profile); err != nil || fi.Size() == 0 {
+			t.Errorf("CPU profile not written: %v", err)
+		}
+	})
+
+	t.Run("failing fetch", func(t *testing.T) {
+		if code := Bench(configPath, nil, BenchOptions{Runs: 2}); code != 1 {
+			t.Errorf("Bench() = %d, want 1", code)
+		}
+	})
+
+	t.Run("unknown dataset", func(t *testing.T) {
+		if code := Bench(configPath, []string{"nope"}, BenchOptions{Runs: 1}); code != 2 {
+			t.Errorf("Bench() = %d, want 2", code)
+		}
+	})
+}
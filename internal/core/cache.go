@@ -0,0 +1,502 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Shared cache: with defaults.cache set, every file datum fetches is also
+// kept in a content-addressed store under the cache directory, shared by all
+// configs (and repositories) of the user:
+//
+//	<cache dir>/cas/objects/ab/abcdef...   file contents, named by SHA256
+//	<cache dir>/cas/index/0123...          source + fingerprint -> SHA256
+//	<cache dir>/cas/CACHEDIR.TAG           marks the store as datum's
+//
+// Before downloading, fetch asks the source for its fingerprint; if the
+// same source with the same fingerprint was fetched before, by this config
+// or any other, the file is copied (cache: copy) or hard-linked (cache:
+// link) from the store instead. Objects are verified against their names
+// whenever they're used, so a damaged one is dropped and downloaded again.
+// "datum cache gc" trims the store, least recently used first, along with the
+// caches handlers keep themselves (see CacheGC). Neither it nor "datum cache
+// clear" deletes anything from a store without the tag (or, for one written
+// before the tag was, anything but objects and index), in case the cache
+// directory turns out to be somebody else's.
+//
+// Only datasets fetched straight to their target take part: not directory
+// sources, command sources (whose output depends on where they run), or
+// datasets that are decompressed, extracted, sliced, transformed or under a
+// quota. Datasets with handling rules (see Handling) never leave their
+// target directories, so they aren't cached either.
+
+// cacheModes are the values of defaults.cache and a dataset's cache.
+var cacheModes = []string{"copy", "link", "off"}
+
+// validateCacheMode checks a cache setting.
+func validateCacheMode(mode string) error {
+	if mode != "" && !slices.Contains(cacheModes, mode) {
+		return fmt.Errorf("cache: unknown mode %q (want copy, link or off)", mode)
+	}
+	return nil
+}
+
+// cacheModeFor returns how ds uses the shared cache from src: "copy",
+// "link", or "" for not at all.
+func (c *Config) cacheModeFor(ds Dataset, src registry.Source) string {
+	mode := firstNonEmpty(ds.Cache, c.Defaults.Cache)
+	if mode == "" || mode == "off" || src.Type == "command" || reshapes(src) || ds.Transform != "" || len(c.quotasFor(ds)) > 0 {
+		return ""
+	}
+	if h := c.handlingFor(ds); len(h.TargetDirs) > 0 || h.RequireEncrypted || h.NoMirror {
+		return ""
+	}
+	return mode
+}
+
+// cacheDir returns the root of the shared cache.
+func cacheDir() string {
+	return filepath.Join(fsutil.CacheDir(), "cas")
+}
+
+// cacheTag is the Cache Directory Tagging marker (https://bford.info/cachedir/)
+// that says the store is datum's, and tells backup tools to skip it.
+const (
+	cacheTag          = "CACHEDIR.TAG"
+	cacheTagSignature = "Signature: 8a477f597d28d172789f06886806bc55"
+)
+
+// tagCacheDir creates the shared cache's directory with its tag, if need be.
+func tagCacheDir() error {
+	tag := filepath.Join(cacheDir(), cacheTag)
+	if _, err := os.Stat(tag); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(cacheDir(), 0o755); err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(tag, strings.NewReader(cacheTagSignature+"\n# datum's shared file cache: see \"datum cache\"\n"))
+}
+
+// checkCacheDir refuses to let the shared cache's directory be emptied
+// unless it's datum's: tagged, or holding nothing but objects and index.
+// A directory that doesn't exist has nothing to lose.
+func checkCacheDir() error {
+	entries, err := os.ReadDir(cacheDir())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if b, err := os.ReadFile(filepath.Join(cacheDir(), cacheTag)); err == nil && strings.HasPrefix(string(b), cacheTagSignature) {
+		return nil
+	}
+	for _, e := range entries {
+		if !e.IsDir() || (e.Name() != "objects" && e.Name() != "index") {
+			return fmt.Errorf("%s doesn't look like datum's file cache (it holds %s and has no %s), so it's left alone", cacheDir(), e.Name(), cacheTag)
+		}
+	}
+	return nil
+}
+
+// cacheObject returns where the content with the given SHA256 is stored.
+func cacheObject(hash string) string {
+	return filepath.Join(cacheDir(), "objects", hash[:2], hash)
+}
+
+// cacheIndex returns the index entry for src at fingerprint fp, which holds
+// the SHA256 of what was fetched.
+//
+// The key covers every configured field of src, not just where it points:
+// the fingerprint of an http source covers the whole file whatever its range
+// or member, and a sql source's fingerprint_query stays the same whatever
+// query or format it guards, so sources differing only in such fields would
+// otherwise share an entry and get each other's content.
+func cacheIndex(src registry.Source, fp string) string {
+	h := sha256.New()
+	spec, err := yaml.Marshal(src) // Stable: struct fields in order, map keys sorted
+	if err != nil {
+		spec = []byte(fmt.Sprintf("%#v", src))
+	}
+	for _, b := range [][]byte{spec, []byte(fp)} {
+		h.Write(b)
+		h.Write([]byte{0})
+	}
+	return filepath.Join(cacheDir(), "index", hex.EncodeToString(h.Sum(nil)))
+}
+
+// fetchCached is fetchTarget, unless the shared cache already has what src
+// would deliver: then that is copied or linked to ds's target, and cached
+// is true.
+func fetchCached(ctx context.Context, f registry.Fetcher, src registry.Source, ds Dataset, cfg *Config, item *LockItem) (raw string, fetched, cached bool, err error) {
+	if mode := cfg.cacheModeFor(ds, src); mode != "" && cfg.checkHandling(ds) == nil && cacheGet(ctx, f, src, ds.Target, mode) {
+		return "", true, true, nil
+	}
+	raw, fetched, err = fetchTarget(ctx, f, src, ds, cfg, item)
+	return raw, fetched, false, err
+}
+
+// cacheGet installs src's current content at target from the cache, and
+// reports whether it could. Anything that goes wrong is a miss: the caller
+// downloads as usual.
+func cacheGet(ctx context.Context, f registry.Fetcher, src registry.Source, target, mode string) bool {
+	fp, err := f.Fingerprint(ctx, src)
+	if err != nil {
+		return false
+	}
+	b, err := os.ReadFile(cacheIndex(src, fp))
+	if err != nil {
+		return false
+	}
+	hash := strings.TrimSpace(string(b))
+	if len(hash) != 64 {
+		return false
+	}
+	obj := cacheObject(hash)
+	if got, err := HashFile(obj); err != nil || got != hash {
+		os.Remove(obj) // Damaged; the fetch puts a good copy back
+		return false
+	}
+	if mode == "copy" {
+		// For cache gc, which removes the least recently used first. A
+		// linked object's times are its targets' too, and aren't touched
+		now := time.Now()
+		os.Chtimes(obj, now, now)
+	}
+	if got, err := HashFile(target); err == nil && got == hash {
+		return true // Already there
+	}
+	return installCached(obj, target, mode) == nil
+}
+
+// installCached puts the cache object obj at target: a hard link in link
+// mode, where the filesystem allows, otherwise a copy.
+func installCached(obj, target, mode string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if mode == "link" {
+		tmp := fsutil.StagingPath(target)
+		os.Remove(tmp)
+		if err := os.Link(obj, tmp); err == nil {
+			if err := os.Rename(tmp, target); err != nil {
+				os.Remove(tmp)
+				return err
+			}
+			return nil
+		}
+	}
+	r, err := os.Open(obj)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := fsutil.WriteFileAtomic(target, r); err != nil {
+		return err
+	}
+	return os.Chmod(target, 0o644) // Not the object's read-only mode
+}
+
+// cachePut adds the target of ds, just fetched from src at fingerprint fp
+// and hashing to hash, to the shared cache. In link mode the object is a
+// hard link to the target where possible, so it takes no extra space.
+func cachePut(cfg *Config, ds Dataset, src registry.Source, fp, hash string) error {
+	mode := cfg.cacheModeFor(ds, src)
+	if mode == "" || fp == "" || hash == "" {
+		return nil
+	}
+	if fi, err := os.Stat(ds.Target); err != nil || !fi.Mode().IsRegular() {
+		return nil // Directory sources aren't cached
+	}
+	if err := tagCacheDir(); err != nil {
+		return err
+	}
+	obj := cacheObject(hash)
+	if _, err := os.Stat(obj); err != nil {
+		if err := os.MkdirAll(filepath.Dir(obj), 0o755); err != nil {
+			return err
+		}
+		linked := mode == "link" && os.Link(ds.Target, obj) == nil
+		if !linked {
+			r, err := os.Open(ds.Target)
+			if err != nil {
+				return err
+			}
+			err = fsutil.WriteFileAtomic(obj, r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+		}
+		// Objects are never changed in place; with links, that goes for
+		// the targets sharing them too
+		os.Chmod(obj, 0o444)
+	}
+	return fsutil.WriteFileAtomic(cacheIndex(src, fp), strings.NewReader(hash+"\n"))
+}
+
+// noteFetch reports how a fetch of ds went when it didn't download anything.
+func (r *datasetResult) noteFetch(ds Dataset, fetched, cached bool) {
+	switch {
+	case cached:
+		r.printf("[INFO] %s: taken from the shared cache, not downloaded\n", ds.ID)
+		r.report.Cached = true
+	case !fetched:
+		r.printf("[INFO] %s: not modified since the last fetch, kept %s\n", ds.ID, ds.Target)
+		r.report.NotModified = true
+	}
+}
+
+// storeInCache is cachePut, warning about failures: the
+// fetch itself went fine.
+func (r *datasetResult) storeInCache(cfg *Config, ds Dataset, src registry.Source, fp, hash string) {
+	if err := cachePut(cfg, ds, src, fp, hash); err != nil {
+		r.printf("[WARN] %s: shared cache: %v\n", ds.ID, err)
+	}
+}
+
+// cacheKeepers returns the registered handlers that keep caches of their
+// own (see registry.CacheKeeper), by name.
+func cacheKeepers() map[string]registry.CacheKeeper {
+	keepers := map[string]registry.CacheKeeper{}
+	for _, name := range registry.Names() {
+		f, _ := registry.Get(name)
+		if k, ok := f.(registry.CacheKeeper); ok {
+			keepers[name] = k
+		}
+	}
+	return keepers
+}
+
+// cacheObjects returns the shared cache's objects, least recently used first.
+func cacheObjects() (objects []cachedObject, total int64) {
+	filepath.WalkDir(filepath.Join(cacheDir(), "objects"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if fi, err := d.Info(); err == nil {
+			objects = append(objects, cachedObject{path, fi.Size(), fi.ModTime()})
+			total += fi.Size()
+		}
+		return nil
+	})
+	sort.Slice(objects, func(i, j int) bool { return objects[i].used.Before(objects[j].used) })
+	return objects, total
+}
+
+// cachedObject is a file in the shared cache.
+type cachedObject struct {
+	path string
+	size int64
+	used time.Time
+}
+
+// CacheList prints what datum keeps cached: the shared file cache as a whole,
+// then each entry of the handlers' own caches (the git handler's clones),
+// most recently used first, with their sizes.
+//
+// Returns:
+//   - 0: Success
+//   - 1: A handler's cache couldn't be read
+func CacheList(w io.Writer) int {
+	type row struct {
+		kind, source string
+		size         int64
+		used         time.Time
+	}
+	var rows []row
+	objects, total := cacheObjects()
+	if len(objects) > 0 {
+		rows = append(rows, row{"files", fmt.Sprintf("%s (%d files)", cacheDir(), len(objects)), total, objects[len(objects)-1].used})
+	}
+	exit := 0
+	keepers := cacheKeepers()
+	for _, name := range slices.Sorted(maps.Keys(keepers)) {
+		entries, err := keepers[name].CacheEntries()
+		if err != nil {
+			logf("[ERR ] %s cache: %v\n", name, err)
+			exit = 1
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].LastUsed.After(entries[j].LastUsed) })
+		for _, e := range entries {
+			rows = append(rows, row{name, firstNonEmpty(e.Source, e.Path), e.Size, e.LastUsed})
+		}
+	}
+	if len(rows) == 0 {
+		logln("[INFO] nothing cached")
+		return exit
+	}
+	kindW := len("CACHE")
+	for _, r := range rows {
+		kindW = max(kindW, len(r.kind))
+	}
+	fmt.Fprintf(w, "%-*s  %10s  %-16s  %s\n", kindW, "CACHE", "SIZE", "LAST USED", "SOURCE")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%-*s  %10s  %-16s  %s\n", kindW, r.kind, formatBytes(r.size), r.used.Local().Format("2006-01-02 15:04"), r.source)
+	}
+	return exit
+}
+
+// CacheGC trims what datum keeps cached. maxSize (e.g. "10GiB") caps the
+// shared file cache, removing the least recently used objects first; maxAge
+// (e.g. "30d") removes objects and handler cache entries (git clones) not
+// used for that long. Entries that are kept are compacted (git gc). Index
+// entries whose object is gone are dropped. Targets linked to a removed
+// object keep their data.
+//
+// Returns:
+//   - 0: Success
+//   - 1: Something couldn't be removed or compacted
+//   - 2: Invalid size or age
+func CacheGC(maxSize, maxAge string) int {
+	if maxSize == "" && maxAge == "" {
+		logf("cache gc: want --max-size, --max-age or both\n")
+		return 2
+	}
+	limit := int64(-1)
+	if maxSize != "" {
+		var err error
+		if limit, err = httputil.ParseByteSize(maxSize); err != nil {
+			logf("cache gc: --max-size: want a size like 10GiB\n")
+			return 2
+		}
+	}
+	var cutoff time.Time
+	if maxAge != "" {
+		age, err := parseInterval(maxAge)
+		if err != nil {
+			logf("cache gc: --max-age: want an age like 30d\n")
+			return 2
+		}
+		cutoff = time.Now().Add(-age)
+	}
+
+	objects, total := cacheObjects()
+	exit := 0
+	if err := checkCacheDir(); err != nil {
+		logf("[ERR ] files: %v\n", err)
+		objects, exit = nil, 1
+	}
+	removed, freed := 0, int64(0)
+	for _, o := range objects {
+		if o.used.After(cutoff) && (limit < 0 || total-freed <= limit) {
+			continue
+		}
+		if err := os.Remove(o.path); err != nil {
+			logf("[ERR ] %v\n", err)
+			exit = 1
+			continue
+		}
+		removed++
+		freed += o.size
+	}
+	dropStaleIndex()
+	logf("[INFO] files: removed %d object(s), freeing %s; %s left\n", removed, formatBytes(freed), formatBytes(total-freed))
+
+	keepers := cacheKeepers()
+	for _, name := range slices.Sorted(maps.Keys(keepers)) {
+		k := keepers[name]
+		entries, err := k.CacheEntries()
+		if err != nil {
+			logf("[ERR ] %s cache: %v\n", name, err)
+			exit = 1
+		}
+		expired, compacted := 0, 0
+		for _, e := range entries {
+			source := firstNonEmpty(e.Source, e.Path)
+			if e.LastUsed.Before(cutoff) {
+				if err := k.RemoveCacheEntry(e); err != nil {
+					logf("[ERR ] %s cache: %s: %v\n", name, source, err)
+					exit = 1
+					continue
+				}
+				logf("[INFO] %s: removed %s, unused since %s\n", name, source, e.LastUsed.Local().Format("2006-01-02"))
+				expired++
+				continue
+			}
+			if err := k.CompactCacheEntry(e); err != nil {
+				logf("[ERR ] %s cache: compacting %s: %v\n", name, source, err)
+				exit = 1
+				continue
+			}
+			compacted++
+		}
+		if len(entries) > 0 {
+			logf("[INFO] %s: removed %d entries, compacted %d\n", name, expired, compacted)
+		}
+	}
+	return exit
+}
+
+// dropStaleIndex removes the shared cache's index entries pointing at
+// removed (or never written) objects.
+func dropStaleIndex() {
+	entries, _ := os.ReadDir(filepath.Join(cacheDir(), "index"))
+	for _, e := range entries {
+		path := filepath.Join(cacheDir(), "index", e.Name())
+		b, err := os.ReadFile(path)
+		hash := strings.TrimSpace(string(b))
+		if err == nil && len(hash) == 64 {
+			if _, err := os.Stat(cacheObject(hash)); err == nil {
+				continue
+			}
+		}
+		os.Remove(path)
+	}
+}
+
+// CacheClear empties every cache datum keeps: the shared file cache and the
+// handlers' own. Nothing is lost but time; the next fetch downloads what it
+// needs again.
+//
+// Returns:
+//   - 0: Success
+//   - 1: Something couldn't be removed
+func CacheClear() int {
+	exit := 0
+	_, total := cacheObjects()
+	if err := checkCacheDir(); err != nil {
+		logf("[ERR ] files: %v\n", err)
+		total, exit = 0, 1
+	} else if err := os.RemoveAll(cacheDir()); err != nil {
+		logf("[ERR ] %v\n", err)
+		exit = 1
+	}
+	freed := total
+	keepers := cacheKeepers()
+	for _, name := range slices.Sorted(maps.Keys(keepers)) {
+		entries, err := keepers[name].CacheEntries()
+		if err != nil {
+			logf("[ERR ] %s cache: %v\n", name, err)
+			exit = 1
+		}
+		for _, e := range entries {
+			if err := keepers[name].RemoveCacheEntry(e); err != nil {
+				logf("[ERR ] %s cache: %s: %v\n", name, firstNonEmpty(e.Source, e.Path), err)
+				exit = 1
+				continue
+			}
+			freed += e.Size
+		}
+	}
+	logf("[INFO] cleared the caches, freeing %s\n", formatBytes(freed))
+	return exit
+}
@@ -0,0 +1,269 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// countingHandler serves the same content for a URL every time, counting
+// the downloads.
+type countingHandler struct{ fetches atomic.Int32 }
+
+func (h *countingHandler) Name() string { return "mockcount" }
+
+func (h *countingHandler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	return "v1", nil
+}
+
+func (h *countingHandler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	h.fetches.Add(1)
+	return os.WriteFile(dest, []byte("content of "+src.URL), 0o644)
+}
+
+var counting = &countingHandler{}
+
+// keeperHandler keeps a cache of its own, in memory.
+type keeperHandler struct {
+	entries   []registry.CacheEntry
+	compacted []string
+}
+
+func (h *keeperHandler) Name() string { return "mockkeep" }
+
+func (h *keeperHandler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	return "v1", nil
+}
+
+func (h *keeperHandler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	return os.WriteFile(dest, nil, 0o644)
+}
+
+func (h *keeperHandler) CacheEntries() ([]registry.CacheEntry, error) {
+	return slices.Clone(h.entries), nil
+}
+
+func (h *keeperHandler) RemoveCacheEntry(e registry.CacheEntry) error {
+	h.entries = slices.DeleteFunc(h.entries, func(x registry.CacheEntry) bool { return x.Path == e.Path })
+	return nil
+}
+
+func (h *keeperHandler) CompactCacheEntry(e registry.CacheEntry) error {
+	h.compacted = append(h.compacted, e.Source)
+	return nil
+}
+
+var keeper = &keeperHandler{}
+
+func init() {
+	registry.Register(counting)
+	registry.Register(keeper)
+}
+
+func TestFetch_SharedCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	fetchRepo := func(mode string) (target string, rep Report) {
+		t.Helper()
+		dir := t.TempDir()
+		target = filepath.Join(dir, "data.csv")
+		cfgPath := filepath.Join(dir, "config.yaml")
+		os.WriteFile(cfgPath, []byte(`version: 1
+defaults:
+  cache: `+mode+`
+datasets:
+  - id: shared
+    source:
+      type: mockcount
+      url: https://example.com/shared.csv
+    target: `+target+`
+`), 0o644)
+		var out bytes.Buffer
+		if code := FetchWithOptions(cfgPath, filepath.Join(dir, "lock.yaml"), nil, Options{Report: &out}); code != 0 {
+			t.Fatalf("FetchWithOptions() = %d, want 0", code)
+		}
+		json.Unmarshal(out.Bytes(), &rep)
+		return target, rep
+	}
+	before := counting.fetches.Load()
+	downloads := func() int32 { return counting.fetches.Load() - before }
+
+	first, rep := fetchRepo("copy")
+	if downloads() != 1 || rep.Datasets[0].Cached {
+		t.Fatalf("first fetch: %d download(s), cached %v; want a download", downloads(), rep.Datasets[0].Cached)
+	}
+	hash := mustHash(t, first)
+	obj := cacheObject(hash)
+	if got := mustHash(t, obj); got != hash {
+		t.Fatalf("cache object hash = %s, want %s", got, hash)
+	}
+
+	// Another repository fetching the same source gets it from the cache
+	second, rep := fetchRepo("copy")
+	if downloads() != 1 || !rep.Datasets[0].Cached {
+		t.Errorf("second fetch: %d download(s), cached %v; want it from the cache", downloads(), rep.Datasets[0].Cached)
+	}
+	if mustHash(t, second) != hash {
+		t.Error("target from the cache doesn't match the download")
+	}
+
+	// In link mode the target shares the object's storage
+	linked, _ := fetchRepo("link")
+	a, _ := os.Stat(linked)
+	b, _ := os.Stat(obj)
+	if !os.SameFile(a, b) {
+		t.Error("link mode: target isn't a hard link to the cache object")
+	}
+
+	// A damaged object is dropped and the data downloaded again
+	os.Chmod(obj, 0o644)
+	os.WriteFile(obj, []byte("bit rot"), 0o644)
+	if _, rep := fetchRepo("copy"); downloads() != 2 || rep.Datasets[0].Cached {
+		t.Errorf("fetch with a damaged object: %d download(s), cached %v; want a new download", downloads(), rep.Datasets[0].Cached)
+	}
+	if mustHash(t, obj) != hash {
+		t.Error("the damaged object wasn't replaced")
+	}
+
+	// gc trims the cache, index entries included
+	if code := CacheGC("0", ""); code != 0 {
+		t.Fatalf("CacheGC() = %d, want 0", code)
+	}
+	if _, err := os.Stat(obj); err == nil {
+		t.Error("CacheGC(0) kept an object")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(cacheDir(), "index")); len(entries) != 0 {
+		t.Errorf("CacheGC(0) kept %d index entries", len(entries))
+	}
+	if code := CacheGC("lots", ""); code != 2 {
+		t.Errorf("CacheGC(invalid size) = %d, want 2", code)
+	}
+}
+
+func TestCacheGC_HandlerCaches(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	keeper.entries = []registry.CacheEntry{
+		{Path: "/cache/old", Source: "https://example.com/old.git", Size: 2048, LastUsed: time.Now().Add(-60 * 24 * time.Hour)},
+		{Path: "/cache/new", Source: "https://example.com/new.git", Size: 1024, LastUsed: time.Now()},
+	}
+	keeper.compacted = nil
+	defer func() { keeper.entries = nil }()
+
+	var out bytes.Buffer
+	if code := CacheList(&out); code != 0 {
+		t.Fatalf("CacheList() = %d, want 0", code)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 3 || !strings.Contains(lines[1], "new.git") {
+		t.Errorf("CacheList() =\n%s\nwant a header and both entries, most recently used first", out.String())
+	}
+
+	for _, args := range [][2]string{{"", ""}, {"", "soon"}} {
+		if code := CacheGC(args[0], args[1]); code != 2 {
+			t.Errorf("CacheGC(%q, %q) = %d, want 2", args[0], args[1], code)
+		}
+	}
+	if code := CacheGC("", "30d"); code != 0 {
+		t.Fatalf("CacheGC() = %d, want 0", code)
+	}
+	if len(keeper.entries) != 1 || keeper.entries[0].Path != "/cache/new" {
+		t.Errorf("entries after CacheGC(30d) = %v, want only the recently used one", keeper.entries)
+	}
+	if !slices.Equal(keeper.compacted, []string{"https://example.com/new.git"}) {
+		t.Errorf("compacted %v, want the entry that was kept", keeper.compacted)
+	}
+
+	if code := CacheClear(); code != 0 {
+		t.Fatalf("CacheClear() = %d, want 0", code)
+	}
+	if len(keeper.entries) != 0 {
+		t.Errorf("entries after CacheClear() = %v, want none", keeper.entries)
+	}
+}
+
+func TestCacheClear_ForeignDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	notes := filepath.Join(cacheDir(), "notes.txt")
+	if err := os.MkdirAll(cacheDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(notes, []byte("not datum's"), 0o644)
+
+	if code := CacheClear(); code != 1 {
+		t.Errorf("CacheClear() = %d, want 1 for a directory that isn't datum's", code)
+	}
+	if code := CacheGC("", "1s"); code != 1 {
+		t.Errorf("CacheGC() = %d, want 1 for a directory that isn't datum's", code)
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Fatalf("the directory was emptied anyway: %v", err)
+	}
+
+	// Once tagged, it's datum's to clear
+	if err := tagCacheDir(); err != nil {
+		t.Fatal(err)
+	}
+	if code := CacheClear(); code != 0 {
+		t.Errorf("CacheClear() = %d, want 0 for a tagged directory", code)
+	}
+	if _, err := os.Stat(cacheDir()); !os.IsNotExist(err) {
+		t.Errorf("the tagged directory is still there: %v", err)
+	}
+}
+
+func TestCacheIndex(t *testing.T) {
+	base := registry.Source{Type: "http", URL: "https://example.com/a.csv"}
+	variants := []registry.Source{
+		{Type: "http", URL: "https://example.com/a.csv", Range: "0-9"},
+		{Type: "http", URL: "https://example.com/a.csv", Range: "10-19"},
+		{Type: "http", URL: "https://example.com/a.zip", Member: "a.csv"},
+		{Type: "http", URL: "https://example.com/a.csv", Method: "POST", Body: "{}"},
+		{Type: "http", URL: "https://example.com/a.csv", Headers: map[string]string{"Accept": "text/csv"}},
+		{Type: "sql", URL: "postgres://db/x", Query: "select 1", FingerprintQuery: "select max(t) from x"},
+		{Type: "sql", URL: "postgres://db/x", Query: "select 2", FingerprintQuery: "select max(t) from x"},
+		{Type: "sql", URL: "postgres://db/x", Query: "select 2", FingerprintQuery: "select max(t) from x", Format: "json"},
+	}
+	seen := map[string]int{cacheIndex(base, "v1"): -1}
+	for i, src := range variants {
+		key := cacheIndex(src, "v1")
+		if j, ok := seen[key]; ok {
+			t.Errorf("variant %d shares its cache entry with %d", i, j)
+		}
+		seen[key] = i
+	}
+	if cacheIndex(base, "v1") != cacheIndex(base, "v1") {
+		t.Error("cacheIndex() isn't stable")
+	}
+}
+
+func TestCacheModeFor(t *testing.T) {
+	cfg := &Config{Defaults: Defaults{Cache: "copy"}}
+	src := registry.Source{Type: "http", URL: "https://example.com/a.csv"}
+	tests := []struct {
+		name string
+		ds   Dataset
+		src  registry.Source
+		want string
+	}{
+		{"default", Dataset{}, src, "copy"},
+		{"overridden", Dataset{Cache: "link"}, src, "link"},
+		{"off", Dataset{Cache: "off"}, src, ""},
+		{"transformed", Dataset{Transform: "sort {{dest}}"}, src, ""},
+		{"decompressed", Dataset{}, registry.Source{Type: "http", Decompress: "gzip"}, ""},
+		{"command", Dataset{}, registry.Source{Type: "command"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.cacheModeFor(tt.ds, tt.src); got != tt.want {
+				t.Errorf("cacheModeFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
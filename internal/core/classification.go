@@ -0,0 +1,124 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// classificationLevels are the labels a dataset's classification may have,
+// from least to most sensitive.
+var classificationLevels = []string{"public", "internal", "restricted"}
+
+// encryptedMarker is the file that marks a directory as encrypted at rest.
+//
+// Whether a directory is encrypted can't be read reliably from the OS (LUKS,
+// fscrypt, BitLocker and network volumes all look different), so the admin who
+// sets up the encrypted volume creates this file at its root. Because the
+// marker lives inside the volume, it disappears when the volume isn't mounted,
+// and a fetch can't write restricted data to the bare directory underneath.
+const encryptedMarker = ".datum-encrypted"
+
+// Handling is how data of one classification must be handled, from the
+// config's classifications block:
+//
+//	classifications:
+//	  restricted:
+//	    target_dirs: [secure/]
+//	    require_encrypted: true
+//	    no_mirror: true
+//
+// Rules are checked when the config is loaded (target_dirs) and before each
+// fetch (require_encrypted); no_mirror makes "datum pin push" refuse the
+// dataset. A classification without rules is just a label.
+type Handling struct {
+	// TargetDirs are the directories targets must be inside; empty allows any
+	TargetDirs []string `yaml:"target_dirs,omitempty"`
+
+	// RequireEncrypted requires the target's directory, or one of its
+	// parents, to hold the encrypted-volume marker (see encryptedMarker)
+	RequireEncrypted bool `yaml:"require_encrypted,omitempty"`
+
+	// NoMirror forbids publishing copies of the data elsewhere
+	NoMirror bool `yaml:"no_mirror,omitempty"`
+}
+
+// classificationOf returns ds's classification, defaulting to the config's.
+func (c *Config) classificationOf(ds Dataset) string {
+	return firstNonEmpty(ds.Classification, c.Defaults.Classification)
+}
+
+// handlingFor returns the handling rules for ds's classification.
+func (c *Config) handlingFor(ds Dataset) Handling {
+	return c.Classifications[c.classificationOf(ds)]
+}
+
+// validateClassifications checks the classification labels and the rules
+// that can be checked without touching the filesystem.
+func validateClassifications(c *Config) error {
+	for name := range c.Classifications {
+		if !slices.Contains(classificationLevels, name) {
+			return fmt.Errorf("classifications.%s: unknown classification (want %s)", name, strings.Join(classificationLevels, ", "))
+		}
+	}
+	if l := c.Defaults.Classification; l != "" && !slices.Contains(classificationLevels, l) {
+		return fmt.Errorf("defaults.classification: unknown classification %q (want %s)", l, strings.Join(classificationLevels, ", "))
+	}
+	for i, ds := range c.Datasets {
+		if l := ds.Classification; l != "" && !slices.Contains(classificationLevels, l) {
+			return fmt.Errorf("dataset %d (%s): unknown classification %q (want %s)", i, ds.ID, l, strings.Join(classificationLevels, ", "))
+		}
+		h := c.handlingFor(ds)
+		if len(h.TargetDirs) > 0 && !slices.ContainsFunc(h.TargetDirs, func(dir string) bool { return pathWithin(ds.Target, dir) }) {
+			return fmt.Errorf("dataset %d (%s): %s data must be stored under %s, not %s",
+				i, ds.ID, c.classificationOf(ds), strings.Join(h.TargetDirs, " or "), ds.Target)
+		}
+	}
+	return nil
+}
+
+// checkHandling checks the rules that depend on the filesystem, just before
+// ds is fetched.
+func (c *Config) checkHandling(ds Dataset) error {
+	if !c.handlingFor(ds).RequireEncrypted {
+		return nil
+	}
+	if !encryptedDir(filepath.Dir(ds.Target)) {
+		return fmt.Errorf("%s data must be stored on an encrypted volume, and no %s marks one above %s",
+			c.classificationOf(ds), encryptedMarker, ds.Target)
+	}
+	return nil
+}
+
+// encryptedDir reports whether dir, or one of its parents, holds the
+// encrypted-volume marker. Directories that don't exist yet are skipped over.
+func encryptedDir(dir string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, encryptedMarker)); err == nil {
+			return true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
+
+// pathWithin reports whether path is dir or inside it, comparing absolute
+// paths so "secure/../public/x" doesn't count as inside "secure/".
+func pathWithin(path, dir string) bool {
+	p, err1 := filepath.Abs(path)
+	d, err2 := filepath.Abs(dir)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	rel, err := filepath.Rel(d, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPathWithin(t *testing.T) {
+	tests := []struct {
+		path, dir string
+		want      bool
+	}{
+		{"secure/a.csv", "secure", true},
+		{"secure/sub/a.csv", "secure/", true},
+		{"secure", "secure", true},
+		{"secure/../public/a.csv", "secure", false},
+		{"secure-old/a.csv", "secure", false},
+		{"a.csv", "secure", false},
+	}
+	for _, tt := range tests {
+		if got := pathWithin(tt.path, tt.dir); got != tt.want {
+			t.Errorf("pathWithin(%q, %q) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestClassificationConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(body string) string {
+		path := filepath.Join(dir, "config.yaml")
+		os.WriteFile(path, []byte(body), 0o644)
+		return path
+	}
+	rules := "version: 1\nclassifications:\n  restricted:\n    target_dirs: [" + filepath.Join(dir, "secure") + "]\n"
+
+	cfg, err := readConfig(write(rules + `defaults:
+  classification: restricted
+datasets:
+  - id: patients
+    source: {type: mock}
+    target: ` + filepath.Join(dir, "secure", "patients.csv") + `
+  - id: codes
+    classification: public
+    source: {type: mock}
+    target: ` + filepath.Join(dir, "codes.csv") + `
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.classificationOf(cfg.Datasets[0]); got != "restricted" {
+		t.Errorf("default classification = %q, want restricted", got)
+	}
+
+	for name, tc := range map[string]struct{ body, want string }{
+		"outside target_dirs": {rules + "datasets:\n  - id: x\n    classification: restricted\n    source: {type: mock}\n    target: " + filepath.Join(dir, "x.csv") + "\n", "must be stored under"},
+		"unknown label":       {"version: 1\ndatasets:\n  - id: x\n    classification: secret\n    source: {type: mock}\n    target: x.csv\n", `unknown classification "secret"`},
+		"unknown rules":       {"version: 1\nclassifications:\n  top_secret: {no_mirror: true}\ndatasets: []\n", "classifications.top_secret"},
+	} {
+		_, err := readConfig(write(tc.body))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error = %v, want it to mention %q", name, err, tc.want)
+		}
+	}
+}
+
+func TestClassificationHandling(t *testing.T) {
+	tmpDir := t.TempDir()
+	secure := filepath.Join(tmpDir, "vault", "data")
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := "version: 1\nclassifications:\n  restricted:\n    require_encrypted: true\n    no_mirror: true\ndatasets:\n" +
+		"  - id: patients\n    classification: restricted\n    source:\n      type: mock\n    target: " + filepath.Join(secure, "patients.csv") + "\n"
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	// Without the marker (volume not mounted) nothing is written
+	if code := Fetch(configPath, lockPath, nil); code != 1 {
+		t.Errorf("fetch without an encrypted volume = %d, want 1", code)
+	}
+	if fileExists(filepath.Join(secure, "patients.csv")) {
+		t.Error("restricted data was written outside an encrypted volume")
+	}
+
+	os.MkdirAll(filepath.Join(tmpDir, "vault"), 0o755)
+	os.WriteFile(filepath.Join(tmpDir, "vault", encryptedMarker), nil, 0o644)
+	if code := Fetch(configPath, lockPath, nil); code != 0 {
+		t.Errorf("fetch onto a marked volume = %d, want 0", code)
+	}
+
+	if code := PinPush(configPath, lockPath, "ipfs", nil); code != 1 {
+		t.Errorf("pin push of no_mirror data = %d, want 1", code)
+	}
+}
@@ -11,12 +11,23 @@
 package core
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/jprybylski/datum/internal/canon"
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
 	"github.com/jprybylski/datum/internal/registry"
+	runrt "github.com/jprybylski/datum/internal/runtime"
 )
 
 // Config represents the structure of the .data.yaml configuration file.
@@ -27,9 +38,39 @@ import (
 // Go learning note: Struct tags (like `yaml:"version"`) tell the YAML library
 // how to map between YAML field names and Go struct fields.
 type Config struct {
-	Version  int       `yaml:"version"`  // Config file format version (currently 1)
-	Defaults Defaults  `yaml:"defaults"` // Default settings for all datasets
-	Datasets []Dataset `yaml:"datasets"` // List of data sources to track
+	Version  int               `yaml:"version"`          // Config file format version (currently 1)
+	Defaults Defaults          `yaml:"defaults"`         // Default settings for all datasets
+	Datasets []Dataset         `yaml:"datasets"`         // List of data sources to track
+	Quotas   map[string]string `yaml:"quotas,omitempty"` // Disk quota per tag, e.g. {geo: 10GB}
+
+	// Include lists globs of further files whose datasets are added (see include.go)
+	Include []string `yaml:"include,omitempty"`
+
+	// AuthProfiles are named credential sets that datasets select with auth.profile
+	AuthProfiles map[string]AuthProfile `yaml:"auth_profiles,omitempty"`
+
+	// TransparencyLog, when set, witnesses every pin in an append-only log
+	TransparencyLog *TransparencyLog `yaml:"transparency_log,omitempty"`
+
+	// PolicyBundle is a signed, pinned organization policy the config must follow
+	PolicyBundle *PolicyBundle `yaml:"policy_bundle,omitempty"`
+
+	// Classifications are the handling rules for each classification label
+	Classifications map[string]Handling `yaml:"classifications,omitempty"`
+
+	// Exceptions relax the fail policy of single datasets until a date
+	Exceptions []Exception `yaml:"exceptions,omitempty"`
+
+	// Notify lists webhooks told about stale, failed and updated datasets
+	Notify []Notifier `yaml:"notify,omitempty"`
+
+	// AllowCommandSources opts the config in to command sources, which are
+	// refused otherwise (see AllowCommands)
+	AllowCommandSources bool `yaml:"allow_command_sources,omitempty"`
+
+	// Security limits what sources may do, such as the hosts they may
+	// point at (see hosts.go)
+	Security *Security `yaml:"security,omitempty"`
 }
 
 // Defaults specifies default settings that apply to all datasets unless overridden.
@@ -37,8 +78,49 @@ type Config struct {
 // This avoids repetition in the configuration file - common settings can be
 // specified once and overridden per-dataset as needed.
 type Defaults struct {
-	Policy string `yaml:"policy"` // Default policy: "fail", "update", or "log"
-	Algo   string `yaml:"algo"`   // Hash algorithm (currently only "sha256" is supported)
+	Policy        string `yaml:"policy"`                   // Default policy: "fail", "update", or "log"
+	Algo          string `yaml:"algo"`                     // Hash algorithm (currently only "sha256" is supported)
+	ReverifyEvery string `yaml:"reverify_every,omitempty"` // Cadence for re-hashing local copies (e.g. "7d")
+	Order         string `yaml:"order,omitempty"`          // Processing order within a priority: "" (config order) or "size"
+	TargetsInGit  string `yaml:"targets_in_git,omitempty"` // Maintain a .gitignore ("ignore") or .gitattributes ("lfs") block for targets
+
+	// CheckWritesLock is when check writes the lockfile: "always" (the
+	// default), "changed" (only when a pin changed, so check alone never
+	// dirties a git tree with timestamps) or "never" (as --no-write-lock).
+	// fetch always writes it.
+	CheckWritesLock string `yaml:"check_writes_lock,omitempty"`
+
+	// Connection budget shared by all HTTP traffic (http sources, git over
+	// https, discovery), whatever --jobs is. Zero means the default:
+	// unlimited in total, httputil.DefaultPerHost per host. Negative per-host
+	// means unlimited.
+	MaxConnections        int `yaml:"max_connections,omitempty"`          // Requests in flight at once, across all hosts
+	MaxConnectionsPerHost int `yaml:"max_connections_per_host,omitempty"` // Requests in flight at once to any one host
+
+	Owner string `yaml:"owner,omitempty"` // User to own fetched targets (name or ID; needs root)
+	Group string `yaml:"group,omitempty"` // Group for fetched targets (name or ID)
+
+	Mtime          string            `yaml:"mtime,omitempty"`           // Target modification time: "fetch" (default) or "source"
+	PreserveXattrs bool              `yaml:"preserve_xattrs,omitempty"` // Carry a target's extended attributes (e.g. SELinux label) over to its replacement
+	Xattrs         map[string]string `yaml:"xattrs,omitempty"`          // Extended attributes to set on every fetched target
+
+	Retries      int    `yaml:"retries,omitempty"`       // Retries after a transient source failure (5xx, timeout); default 0
+	RetryBackoff string `yaml:"retry_backoff,omitempty"` // Wait before the first retry, doubled each time (default "1s")
+
+	// TmpDir is where downloads are staged before being renamed over their
+	// targets, for targets on the same filesystem (see fsutil.SetTmpDir).
+	TmpDir string `yaml:"tmp_dir,omitempty"`
+
+	// Env is exported to every dataset's commands (see applyEnv)
+	Env map[string]string `yaml:"env,omitempty"`
+
+	// Classification labels datasets without their own (see Handling)
+	Classification string `yaml:"classification,omitempty"`
+
+	// Cache keeps fetched files in the shared cache and takes them from
+	// there when a source hasn't changed: "copy", "link" or "off" (the
+	// default; see cache.go)
+	Cache string `yaml:"cache,omitempty"`
 }
 
 // Dataset represents a single external data source to track.
@@ -58,12 +140,103 @@ type Defaults struct {
 // the next source is attempted. The final policy judgment is applied only after
 // all sources have been tried.
 type Dataset struct {
-	ID      string            `yaml:"id"`                // Unique identifier for this dataset
-	Desc    string            `yaml:"desc"`              // Human-readable description
-	Target  string            `yaml:"target"`            // Local file path where data will be saved
-	Policy  string            `yaml:"policy"`            // Policy override (empty uses default)
-	Source  registry.Source   `yaml:"source,omitempty"`  // Single data source (backward compatible)
-	Sources []registry.Source `yaml:"sources,omitempty"` // Multiple data sources with fallback
+	ID       string            `yaml:"id"`                 // Unique identifier for this dataset
+	Desc     string            `yaml:"desc"`               // Human-readable description
+	Target   string            `yaml:"target"`             // Local file path where data will be saved
+	Policy   string            `yaml:"policy"`             // Policy override (empty uses default)
+	Priority int               `yaml:"priority,omitempty"` // Higher priorities are processed first (default 0)
+	Tags     []string          `yaml:"tags,omitempty"`     // Group labels (used for quotas and --tags)
+	Source   registry.Source   `yaml:"source,omitempty"`   // Single data source (backward compatible)
+	Sources  []registry.Source `yaml:"sources,omitempty"`  // Multiple data sources with fallback
+
+	// ReverifyEvery re-hashes the local target against the lock on this cadence
+	// (e.g. "24h", "7d") to catch bit-rot, regardless of policy. Overrides the default.
+	ReverifyEvery string `yaml:"reverify_every,omitempty"`
+
+	// Auth selects the credentials this dataset is fetched with (see AuthProfile)
+	Auth DatasetAuth `yaml:"auth,omitempty"`
+
+	// Discover finds newer versions of version-pinned sources (see Discover)
+	Discover *Discover `yaml:"discover,omitempty"`
+
+	// Version is substituted for {{version}} in the dataset's sources; see "datum bump"
+	Version string `yaml:"version,omitempty"`
+
+	// Owner and Group override defaults.owner and defaults.group for this target
+	Owner string `yaml:"owner,omitempty"`
+	Group string `yaml:"group,omitempty"`
+
+	// Mtime overrides defaults.mtime; Xattrs are added to (and override) defaults.xattrs
+	Mtime  string            `yaml:"mtime,omitempty"`
+	Xattrs map[string]string `yaml:"xattrs,omitempty"`
+
+	// Retries and RetryBackoff override defaults.retries and defaults.retry_backoff
+	// (a pointer, so "retries: 0" can turn retrying off for one dataset)
+	Retries      *int   `yaml:"retries,omitempty"`
+	RetryBackoff string `yaml:"retry_backoff,omitempty"`
+
+	// Timeout limits the dataset's source operations, retries included
+	// (e.g. "10m"). Overrides the --timeout flag.
+	Timeout string `yaml:"timeout,omitempty"`
+
+	// Env is added to (and overrides) defaults.env for this dataset's commands
+	Env map[string]string `yaml:"env,omitempty"`
+
+	// Severity is "error" (the default) or "warn": a warn dataset's changes
+	// and errors are reported but never fail the run (see exitcode.go)
+	Severity string `yaml:"severity,omitempty"`
+
+	// Transform is a shell command that rewrites the fetched data at {{dest}}
+	// in place before it's hashed (see transform.go)
+	Transform string `yaml:"transform,omitempty"`
+
+	// Classification is "public", "internal" or "restricted"; the config's
+	// classifications block says how each must be handled
+	Classification string `yaml:"classification,omitempty"`
+
+	// Cache overrides defaults.cache for this dataset
+	Cache string `yaml:"cache,omitempty"`
+
+	// DependsOn lists datasets that must be processed before this one; if
+	// one of them fails, this one is skipped (see depends.go)
+	DependsOn []string `yaml:"depends_on,omitempty"`
+
+	// Each expands the dataset into one dataset per combination of these
+	// variables' values (see expandEach)
+	Each Each `yaml:"each,omitempty"`
+
+	// versioned records that some source uses {{version}} (set by applyVersions)
+	versioned bool
+
+	// file is the included file the dataset is defined in, or empty for the
+	// config itself (set by applyIncludes)
+	file string
+}
+
+// requiredConfigSHA256 is the expected SHA256 of the config file, if any.
+// Set once at startup via RequireConfigSHA256.
+var requiredConfigSHA256 string
+
+// RequireConfigSHA256 makes every subsequent config load fail unless the file's
+// SHA256 equals want (hex, case-insensitive). An empty want disables the check.
+//
+// This lets automation assert it is running against an approved config revision:
+// the hash is computed over the exact bytes that are parsed, so the file can't
+// be swapped between verification and use.
+func RequireConfigSHA256(want string) {
+	requiredConfigSHA256 = strings.ToLower(strings.TrimSpace(want))
+}
+
+// allowCommands is whether command sources may run whatever the config says.
+// Set once at startup via AllowCommands.
+var allowCommands bool
+
+// AllowCommands lets every config use command sources (--allow-commands).
+// Without it, only configs that set allow_command_sources can: a command
+// source runs arbitrary shell from a file anyone with commit access can edit,
+// so a checkout must not start running one without somebody opting in.
+func AllowCommands(allow bool) {
+	allowCommands = allow
 }
 
 // readConfig loads and parses the configuration file from disk.
@@ -87,12 +260,25 @@ func readConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	// In trusted config mode, refuse anything but the approved revision
+	if requiredConfigSHA256 != "" {
+		sum := sha256.Sum256(b)
+		if got := hex.EncodeToString(sum[:]); got != requiredConfigSHA256 {
+			return nil, fmt.Errorf("%s: sha256 %s does not match required %s (config changed or tampered with)", path, got, requiredConfigSHA256)
+		}
+	}
+
 	// Parse the YAML into a Config struct
 	var c Config
 	if err := yaml.Unmarshal(b, &c); err != nil {
 		return nil, err
 	}
 
+	// Bring in the datasets of included files
+	if err := applyIncludes(&c, path); err != nil {
+		return nil, err
+	}
+
 	// Apply default values if not specified in the configuration
 	// This ensures the config always has valid values even if the user
 	// doesn't explicitly set them
@@ -103,12 +289,119 @@ func readConfig(path string) (*Config, error) {
 		c.Defaults.Algo = "sha256" // Default to SHA256 hashing
 	}
 
-	// Validate dataset configurations
+	if c.Defaults.Order != "" && c.Defaults.Order != "size" {
+		return nil, fmt.Errorf("defaults.order: unknown order %q (want \"size\" or empty)", c.Defaults.Order)
+	}
+	if _, ok := vcsFiles[c.Defaults.TargetsInGit]; c.Defaults.TargetsInGit != "" && !ok {
+		return nil, fmt.Errorf("defaults.targets_in_git: unknown mode %q (want \"ignore\" or \"lfs\")", c.Defaults.TargetsInGit)
+	}
+	if err := validateCacheMode(c.Defaults.Cache); err != nil {
+		return nil, fmt.Errorf("defaults.%w", err)
+	}
+	switch c.Defaults.CheckWritesLock {
+	case "", "always", "changed", "never":
+	default:
+		return nil, fmt.Errorf("defaults.check_writes_lock: unknown mode %q (want \"always\", \"changed\" or \"never\")", c.Defaults.CheckWritesLock)
+	}
+	for tag, q := range c.Quotas {
+		if _, err := httputil.ParseByteSize(q); err != nil {
+			return nil, fmt.Errorf("quotas.%s: %w", tag, err)
+		}
+	}
+	if err := validateTransparencyLog(c.TransparencyLog); err != nil {
+		return nil, err
+	}
+	if err := validateNotify(c.Notify); err != nil {
+		return nil, err
+	}
+	if err := validatePolicyBundle(c.PolicyBundle); err != nil {
+		return nil, err
+	}
+	if err := validateTargetAttrs(c.Defaults.Mtime, c.Defaults.Xattrs); err != nil {
+		return nil, fmt.Errorf("defaults.%w", err)
+	}
+	if err := validateRetries(c.Defaults.Retries, c.Defaults.RetryBackoff); err != nil {
+		return nil, fmt.Errorf("defaults.%w", err)
+	}
+	if c.Defaults.MaxConnections < 0 {
+		return nil, fmt.Errorf("defaults.max_connections: must not be negative (got %d)", c.Defaults.MaxConnections)
+	}
+	if c.Defaults.MaxConnectionsPerHost == 0 {
+		c.Defaults.MaxConnectionsPerHost = httputil.DefaultPerHost
+	}
+	// The budget is process-wide, like the handler registry: the config being
+	// run decides it for every HTTP client
+	httputil.DefaultBudget.SetLimits(c.Defaults.MaxConnections, c.Defaults.MaxConnectionsPerHost)
+	fsutil.SetTmpDir(c.Defaults.TmpDir)
+
+	if c.Defaults.ReverifyEvery != "" {
+		if _, err := parseInterval(c.Defaults.ReverifyEvery); err != nil {
+			return nil, fmt.Errorf("defaults.reverify_every: %w", err)
+		}
+	}
+
+	// Substitute ${VAR} from the environment, then expand templated datasets,
+	// before anything looks at individual datasets
+	if err := expandEnvVars(&c); err != nil {
+		return nil, err
+	}
+	if err := expandEach(&c); err != nil {
+		return nil, err
+	}
+
+	// Validate dataset configurations, reporting every broken one at once
+	var dsErrs []error
 	for i, ds := range c.Datasets {
 		if err := validateDataset(&ds); err != nil {
-			return nil, fmt.Errorf("dataset %d (%s): %w", i, ds.ID, err)
+			dsErrs = append(dsErrs, fmt.Errorf("%s: %w", datasetRef(i, ds), err))
 		}
 	}
+	if len(dsErrs) > 0 {
+		return nil, errors.Join(dsErrs...)
+	}
+
+	// Two datasets writing the same files would overwrite each other's data
+	// and lock entries
+	if errs := datasetConflicts(&c); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if errs := checkDependencies(&c); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := checkCommandsAllowed(&c); err != nil {
+		return nil, err
+	}
+
+	if err := validateExceptions(&c); err != nil {
+		return nil, err
+	}
+
+	// Targets must be where their classification allows
+	if err := validateClassifications(&c); err != nil {
+		return nil, err
+	}
+
+	// Attach each dataset's credentials to its sources
+	if err := applyAuthProfiles(&c); err != nil {
+		return nil, err
+	}
+
+	// Expand {{version}} in sources
+	if err := applyVersions(&c); err != nil {
+		return nil, err
+	}
+
+	// Export env maps to sources and expand {{env.NAME}}
+	if err := applyEnv(&c); err != nil {
+		return nil, err
+	}
+
+	// Sources may only point at allowed hosts, checked once every
+	// placeholder in their URLs is filled in
+	if err := checkAllowedHosts(&c); err != nil {
+		return nil, err
+	}
 
 	return &c, nil
 }
@@ -119,7 +412,8 @@ func readConfig(path string) (*Config, error) {
 //   - A single "source" field, OR
 //   - A "sources" list with at least one source
 //
-// It's an error to specify both, or to specify neither.
+// It's an error to specify both, or to specify neither. Optional settings
+// with their own syntax (such as reverify_every) are validated here too.
 func validateDataset(ds *Dataset) error {
 	hasSource := ds.Source.Type != ""
 	hasSources := len(ds.Sources) > 0
@@ -132,6 +426,235 @@ func validateDataset(ds *Dataset) error {
 		return fmt.Errorf("dataset cannot have both 'source' and 'sources' specified (use only one)")
 	}
 
+	if ds.ReverifyEvery != "" {
+		if _, err := parseInterval(ds.ReverifyEvery); err != nil {
+			return fmt.Errorf("reverify_every: %w", err)
+		}
+	}
+
+	if err := validateTargetAttrs(ds.Mtime, ds.Xattrs); err != nil {
+		return err
+	}
+	if err := validateSeverity(ds.Severity); err != nil {
+		return err
+	}
+	if err := validateCacheMode(ds.Cache); err != nil {
+		return err
+	}
+
+	retries := 0
+	if ds.Retries != nil {
+		retries = *ds.Retries
+	}
+	if err := validateRetries(retries, ds.RetryBackoff); err != nil {
+		return err
+	}
+	if err := validateTimeout(ds.Timeout); err != nil {
+		return err
+	}
+
+	if ds.Discover != nil {
+		if err := validateDiscover(ds.Discover); err != nil {
+			return err
+		}
+	}
+
+	for _, src := range ds.GetSources() {
+		if err := validateSlice(src); err != nil {
+			return err
+		}
+		if err := validateExtract(src); err != nil {
+			return err
+		}
+		if err := validateDecompress(src); err != nil {
+			return err
+		}
+		if err := validateArchivePath(src); err != nil {
+			return err
+		}
+		if err := validateMirrors(src); err != nil {
+			return err
+		}
+		if src.Canonicalize != nil {
+			if src.Type != "http" && src.Type != "file" {
+				return fmt.Errorf("canonicalize: only supported by http and file sources")
+			}
+			if err := canon.Validate(src.Canonicalize); err != nil {
+				return err
+			}
+		}
+		if src.RateLimit != nil {
+			if src.Type != "http" && src.Type != "ftp" && src.Type != "sftp" {
+				return fmt.Errorf("rate_limit: only supported by http, ftp and sftp sources")
+			}
+			if err := httputil.ValidateRateLimit(src.RateLimit); err != nil {
+				return err
+			}
+		}
+		if err := validateCommand(src); err != nil {
+			return err
+		}
+		if err := validateQuery(src); err != nil {
+			return err
+		}
+		if err := validateRequest(src); err != nil {
+			return err
+		}
+		if src.Sign != nil {
+			if err := httputil.ValidateSigning(src.Sign); err != nil {
+				return err
+			}
+		}
+		if err := httputil.ValidateAuth(src); err != nil {
+			return err
+		}
+		if err := httputil.ValidateNetwork(src); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// datasetRef names the i-th dataset in messages, with the file it comes from
+// if it was included.
+func datasetRef(i int, ds Dataset) string {
+	if ds.file != "" {
+		return fmt.Sprintf("dataset %d (%s, in %s)", i, ds.ID, ds.file)
+	}
+	return fmt.Sprintf("dataset %d (%s)", i, ds.ID)
+}
+
+// datasetConflicts reports dataset IDs used more than once, targets written
+// by more than one dataset, and targets inside another dataset's (directory)
+// target. Targets are compared as cleaned paths, so "data/./a.csv" is
+// "data/a.csv".
+func datasetConflicts(c *Config) []error {
+	var errs []error
+	ids := map[string]int{}
+	targets := map[string]int{}
+	for i, ds := range c.Datasets {
+		if first, ok := ids[ds.ID]; ok && ds.ID != "" {
+			errs = append(errs, fmt.Errorf("%s: id already used by %s", datasetRef(i, ds), datasetRef(first, c.Datasets[first])))
+		} else {
+			ids[ds.ID] = i
+		}
+		if ds.Target == "" {
+			continue
+		}
+		target := filepath.Clean(ds.Target)
+		if first, ok := targets[target]; ok {
+			errs = append(errs, fmt.Errorf("%s: target %s is also the target of %s", datasetRef(i, ds), ds.Target, datasetRef(first, c.Datasets[first])))
+		} else {
+			targets[target] = i
+		}
+	}
+	for i, ds := range c.Datasets {
+		if ds.Target == "" {
+			continue
+		}
+		for dir := filepath.Dir(filepath.Clean(ds.Target)); ; dir = filepath.Dir(dir) {
+			if j, ok := targets[dir]; ok && j != i {
+				errs = append(errs, fmt.Errorf("%s: target %s is inside %s's target %s", datasetRef(i, ds), ds.Target, datasetRef(j, c.Datasets[j]), c.Datasets[j].Target))
+				break
+			}
+			if parent := filepath.Dir(dir); parent == dir {
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// checkCommandsAllowed refuses a config with command sources or transforms
+// unless they are allowed, by --allow-commands or the config's
+// allow_command_sources.
+func checkCommandsAllowed(c *Config) error {
+	if allowCommands || c.AllowCommandSources {
+		return nil
+	}
+	var ids []string
+	for _, ds := range c.Datasets {
+		if strings.TrimSpace(ds.Transform) != "" {
+			ids = append(ids, ds.ID)
+			continue
+		}
+		for _, src := range ds.GetSources() {
+			if src.Type == "command" {
+				ids = append(ids, ds.ID)
+				break
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return fmt.Errorf("command sources are disabled, and %s would run shell commands; review them, then pass --allow-commands or set allow_command_sources: true", strings.Join(ids, ", "))
+}
+
+// validateCommand checks a command source's shell, fetch_args, cmd_timeout
+// and workdir.
+func validateCommand(src registry.Source) error {
+	if src.CmdTimeout == "" && src.Workdir == "" && src.Shell == "" && len(src.FetchArgs) == 0 {
+		return nil
+	}
+	if src.Type != "command" {
+		return fmt.Errorf("shell, fetch_args, cmd_timeout, workdir: only supported by command sources")
+	}
+	if src.Shell != "" && !slices.Contains(runrt.Shells, src.Shell) {
+		return fmt.Errorf("shell: unknown shell %q (want %s)", src.Shell, strings.Join(runrt.Shells, ", "))
+	}
+	if len(src.FetchArgs) > 0 && strings.TrimSpace(src.FetchCmd) != "" {
+		return fmt.Errorf("fetch_cmd, fetch_args: set one or the other")
+	}
+	if src.CmdTimeout != "" {
+		if d, err := time.ParseDuration(src.CmdTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("cmd_timeout: invalid duration %q (e.g. \"30s\", \"10m\")", src.CmdTimeout)
+		}
+	}
+	if src.Workdir != "" && !filepath.IsLocal(src.Workdir) {
+		return fmt.Errorf("workdir: %q must be a relative path that stays inside datum's working directory", src.Workdir)
+	}
+	return nil
+}
+
+// validateQuery checks a sql source's query settings.
+func validateQuery(src registry.Source) error {
+	if src.Type != "sql" {
+		if src.Query != "" || src.FingerprintQuery != "" || src.Format != "" {
+			return fmt.Errorf("query, fingerprint_query, format: only supported by sql sources")
+		}
+		return nil
+	}
+	if strings.TrimSpace(src.Query) == "" {
+		return fmt.Errorf("query: required for sql sources")
+	}
+	if src.Format != "" && src.Format != "csv" && src.Format != "json" {
+		return fmt.Errorf("format: unknown format %q (want \"csv\" or \"json\")", src.Format)
+	}
+	return nil
+}
+
+// validateRequest checks an http source's method, body and content_type.
+func validateRequest(src registry.Source) error {
+	if src.Method == "" && src.Body == "" && src.ContentType == "" {
+		return nil
+	}
+	if src.Type != "http" {
+		return fmt.Errorf("method, body, content_type: only supported by http sources")
+	}
+	switch strings.ToUpper(src.Method) {
+	case "", "GET":
+		if src.Body != "" {
+			return fmt.Errorf("body: only sent with method: POST")
+		}
+	case "POST":
+		if src.Member != "" {
+			return fmt.Errorf("member: needs a GET source (the archive is read with range requests)")
+		}
+	default:
+		return fmt.Errorf("method: unsupported method %q (want \"GET\" or \"POST\")", src.Method)
+	}
 	return nil
 }
 
@@ -3,7 +3,10 @@ package core
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/jprybylski/datum/internal/httputil"
 )
 
 func TestReadConfig(t *testing.T) {
@@ -73,4 +76,222 @@ datasets:
 			t.Error("readConfig() expected error for invalid YAML, got nil")
 		}
 	})
+	t.Run("invalid signing", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "sign.yaml")
+		content := `version: 1
+datasets:
+  - id: signed
+    source:
+      type: http
+      url: https://bucket.example.com/data.csv
+      sign:
+        scheme: sigv4
+    target: data/signed.csv
+`
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readConfig(path); err == nil || !strings.Contains(err.Error(), "region") {
+			t.Errorf("readConfig() error = %v, want missing region", err)
+		}
+	})
+	t.Run("canonicalize and auth", func(t *testing.T) {
+		for _, tc := range []struct{ source, want string }{
+			{"type: command\n      fetch_cmd: cp a {{dest}}\n      canonicalize:\n        line_endings: true", "canonicalize"},
+			{"type: http\n      url: https://example.com/x\n      canonicalize:\n        strip_fields: [meta.]", "strip_fields"},
+			{"type: http\n      url: https://example.com/x\n      headers:\n        Authorization: Bearer abc", "Authorization"},
+			{"type: command\n      fetch_cmd: cp a {{dest}}\n      rate_limit:\n        requests: 1/s", "rate_limit"},
+			{"type: http\n      url: https://example.com/x\n      rate_limit:\n        requests: fast", "rate_limit.requests"},
+			{"type: http\n      url: https://example.com/x\n      rate_limit: {}", "rate_limit"},
+			{"type: http\n      url: https://example.com/x\n      cmd_timeout: 5s", "cmd_timeout"},
+			{"type: command\n      fetch_cmd: cp a {{dest}}\n      cmd_timeout: soon", "cmd_timeout"},
+			{"type: command\n      fetch_cmd: cp a {{dest}}\n      workdir: ../elsewhere", "workdir"},
+			{"type: command\n      fetch_cmd: cp a {{dest}}\n      shell: zsh", "shell"},
+			{"type: command\n      fetch_cmd: cp a {{dest}}\n      fetch_args: [cp, a, '{{dest}}']", "fetch_args"},
+			{"type: http\n      url: https://example.com/x\n      shell: bash", "shell"},
+			{"type: http\n      url: https://example.com/x\n      proxy: corp-proxy:3128", "proxy"},
+			{"type: http\n      url: https://example.com/x\n      client_cert: me.pem", "client_key"},
+			{"type: file\n      path: a.csv\n      ca_file: ca.pem", "ca_file"},
+			{"type: http\n      url: https://example.com/x\n      query: SELECT 1", "query"},
+			{"type: sql\n      url: postgres://db/x", "query"},
+			{"type: sql\n      url: postgres://db/x\n      query: SELECT 1\n      format: xml", "format"},
+			{"type: file\n      path: a.csv\n      method: POST", "method"},
+			{"type: http\n      url: https://example.com/x\n      method: DELETE", "method"},
+			{"type: http\n      url: https://example.com/x\n      body: '{}'", "body"},
+			{"type: http\n      url: https://example.com/x.zip\n      method: POST\n      member: a.csv", "member"},
+		} {
+			path := filepath.Join(tmpDir, "canon.yaml")
+			content := "version: 1\ndatasets:\n  - id: x\n    source:\n      " + tc.source + "\n    target: data/x\n"
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readConfig(path); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("readConfig() error = %v, want it to mention %s", err, tc.want)
+			}
+		}
+	})
+	t.Run("command sources need opting in", func(t *testing.T) {
+		t.Cleanup(func() { AllowCommands(false) })
+		path := filepath.Join(tmpDir, "commands.yaml")
+		content := "version: 1\ndatasets:\n  - id: x\n    source:\n      type: command\n      fetch_cmd: cp a {{dest}}\n    target: data/x\n"
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readConfig(path); err == nil || !strings.Contains(err.Error(), "--allow-commands") {
+			t.Errorf("readConfig() error = %v, want command sources refused", err)
+		}
+		AllowCommands(true)
+		if _, err := readConfig(path); err != nil {
+			t.Errorf("readConfig() with --allow-commands error = %v", err)
+		}
+		AllowCommands(false)
+		if err := os.WriteFile(path, []byte("allow_command_sources: true\n"+content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readConfig(path); err != nil {
+			t.Errorf("readConfig() with allow_command_sources error = %v", err)
+		}
+	})
+	t.Run("allowed hosts", func(t *testing.T) {
+		t.Cleanup(func() { AllowHosts(nil) })
+		path := filepath.Join(tmpDir, "hosts.yaml")
+		load := func(security, source string) error {
+			t.Helper()
+			content := "version: 1\n" + security + "datasets:\n  - id: x\n    source:\n      " + source + "\n    target: data/x\n"
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := readConfig(path)
+			return err
+		}
+		allowed := "security:\n  allowed_hosts: [data.gov, \"*.example.com\"]\n"
+		for _, tc := range []struct {
+			source string
+			want   string // Substring of the error; "" if the source is allowed
+		}{
+			{"type: http\n      url: https://data.gov/x.csv", ""},
+			{"type: http\n      url: https://files.example.com/x.csv", ""},
+			{"type: http\n      url: https://example.com/x.csv", "example.com is not allowed by security.allowed_hosts"},
+			{"type: http\n      url: https://data.gov/x.csv\n      mirrors: [https://evil.test/x.csv]", "evil.test"},
+			{"type: git\n      url: git@evil.test:org/repo.git\n      path: x.csv", "evil.test"},
+			{"type: git\n      url: git@git.example.com:org/repo.git\n      path: x.csv", ""},
+			{"type: http\n      url: /relative/x.csv", "can't tell which host"},
+			{"type: file\n      path: a.csv", ""},
+			{"type: torrent\n      url: https://data.gov/x.torrent", "torrent sources"},
+			{"type: huggingface\n      url: https://evil.test/datasets/org/data\n      path: x.csv", "evil.test"},
+			{"type: huggingface\n      url: datasets/org/data\n      path: x.csv", ""},
+			{"type: sql\n      url: postgres://db.example.com/warehouse\n      query: select 1", ""},
+			{"type: sql\n      url: mysql://reader@evil.test/warehouse\n      query: select 1", "evil.test"},
+			{"type: sql\n      url: postgres://db.example.com/warehouse?host=evil.test\n      query: select 1", "url's parameters"},
+			{"type: http\n      url: https://data.gov/v1.csv\n    discover:\n      url: https://evil.test/releases/\n      pattern: 'v(\\d+)'", "discover: host evil.test"},
+			{"type: http\n      url: https://data.gov/v1.csv\n    discover:\n      url: https://data.gov/releases/\n      pattern: 'v(\\d+)'", ""},
+		} {
+			err := load(allowed, tc.source)
+			if tc.want == "" && err != nil {
+				t.Errorf("readConfig(%q) error = %v, want it allowed", tc.source, err)
+			}
+			if tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+				t.Errorf("readConfig(%q) error = %v, want it to mention %s", tc.source, err, tc.want)
+			}
+		}
+		if err := load(allowed+"notify:\n  - url: https://evil.test/hook\n", "type: file\n      path: a.csv"); err == nil || !strings.Contains(err.Error(), "notify[0]: host evil.test") {
+			t.Errorf("readConfig() with a webhook off the allowed hosts error = %v, want it refused", err)
+		}
+		if err := load("security:\n  allowed_hosts: [https://data.gov]\n", "type: file\n      path: a.csv"); err == nil || !strings.Contains(err.Error(), "invalid host") {
+			t.Errorf("readConfig() with a URL among the allowed hosts error = %v, want it refused", err)
+		}
+
+		// The flag's list applies too, and the config can't widen it
+		AllowHosts([]string{"data.gov"})
+		if err := load("", "type: http\n      url: https://example.com/x.csv"); err == nil || !strings.Contains(err.Error(), "--allowed-hosts") {
+			t.Errorf("readConfig() error = %v, want the host refused by --allowed-hosts", err)
+		}
+		if err := load("security:\n  allowed_hosts: [example.com]\n", "type: http\n      url: https://example.com/x.csv"); err == nil {
+			t.Error("readConfig() let security.allowed_hosts allow a host --allowed-hosts doesn't")
+		}
+		if err := load("", "type: http\n      url: https://DATA.gov:8443/x.csv"); err != nil {
+			t.Errorf("readConfig() with an allowed host error = %v", err)
+		}
+	})
+	t.Run("connection limits", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "conns.yaml")
+		content := `version: 1
+defaults:
+  max_connections: -1
+datasets: []
+`
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readConfig(path); err == nil || !strings.Contains(err.Error(), "max_connections") {
+			t.Errorf("readConfig() error = %v, want negative max_connections rejected", err)
+		}
+
+		content = "version: 1\ndatasets: []\n"
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := readConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Defaults.MaxConnectionsPerHost != httputil.DefaultPerHost {
+			t.Errorf("MaxConnectionsPerHost = %d, want default %d", cfg.Defaults.MaxConnectionsPerHost, httputil.DefaultPerHost)
+		}
+	})
+	t.Run("conflicting datasets", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "conflicts.yaml")
+		ds := func(id, target string) string {
+			return "  - id: " + id + "\n    source: {type: file, path: " + id + ".csv}\n    target: " + target + "\n"
+		}
+		for _, tc := range []struct{ datasets, want string }{
+			{ds("a", "data/a.csv") + ds("a", "data/b.csv"), "dataset 1 (a): id already used by dataset 0 (a)"},
+			{ds("a", "data/a.csv") + ds("b", "./data/a.csv"), "dataset 1 (b): target ./data/a.csv is also the target of dataset 0 (a)"},
+			{ds("tree", "data/tree") + ds("leaf", "data/tree/sub/leaf.csv"), "dataset 1 (leaf): target data/tree/sub/leaf.csv is inside dataset 0 (tree)'s target data/tree"},
+			{ds("leaf", "data/tree/leaf.csv") + ds("tree", "data/tree/"), "dataset 0 (leaf): target data/tree/leaf.csv is inside dataset 1 (tree)'s target data/tree/"},
+		} {
+			os.WriteFile(path, []byte("version: 1\ndatasets:\n"+tc.datasets), 0o644)
+			if _, err := readConfig(path); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("readConfig() error = %v, want %q", err, tc.want)
+			}
+		}
+
+		// Neighbours whose names share a prefix don't conflict
+		os.WriteFile(path, []byte("version: 1\ndatasets:\n"+ds("a", "data/tree")+ds("b", "data/tree-2/b.csv")+ds("c", "data/tree.csv")), 0o644)
+		if _, err := readConfig(path); err != nil {
+			t.Errorf("readConfig() = %v", err)
+		}
+	})
+}
+
+func TestRequireConfigSHA256(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	content := "version: 1\ndatasets: []\n"
+	os.WriteFile(configPath, []byte(content), 0o644)
+	const other = "0000000000000000000000000000000000000000000000000000000000000000"
+	defer RequireConfigSHA256("")
+
+	h, _ := HashFile(configPath)
+
+	t.Run("matching hash loads", func(t *testing.T) {
+		RequireConfigSHA256(strings.ToUpper(h))
+		if _, err := readConfig(configPath); err != nil {
+			t.Errorf("readConfig() error = %v", err)
+		}
+	})
+
+	t.Run("mismatched hash is refused", func(t *testing.T) {
+		RequireConfigSHA256(other)
+		if _, err := readConfig(configPath); err == nil {
+			t.Error("readConfig() expected error for mismatched hash, got nil")
+		}
+	})
+
+	t.Run("empty disables the check", func(t *testing.T) {
+		RequireConfigSHA256("")
+		if _, err := readConfig(configPath); err != nil {
+			t.Errorf("readConfig() error = %v", err)
+		}
+	})
 }
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Decompression on the fly: upstream often publishes a single file
+// compressed (data.csv.gz), while a project wants to read it as it is. A
+// source's decompress setting stores the decompressed content at the target.
+// The lock keeps both hashes: local_sha256 of the decompressed target, and
+// raw_sha256 of the compressed download, so either can be checked against
+// what upstream publishes. Archives of several files are not handled here.
+
+// decompressors open a reader for each supported format.
+var decompressors = map[string]func(r io.Reader) (io.Reader, error){
+	"gzip": func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	},
+	"bzip2": func(r io.Reader) (io.Reader, error) {
+		return bzip2.NewReader(r), nil
+	},
+	"xz": func(r io.Reader) (io.Reader, error) {
+		return xz.NewReader(r)
+	},
+	"zstd": func(r io.Reader) (io.Reader, error) {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	},
+}
+
+// validateDecompress checks a source's decompress setting.
+func validateDecompress(src registry.Source) error {
+	if src.Decompress == "" {
+		return nil
+	}
+	if _, ok := decompressors[src.Decompress]; !ok {
+		return fmt.Errorf("decompress: unknown format %q (want gzip, bzip2, xz or zstd)", src.Decompress)
+	}
+	return nil
+}
+
+// decompressFile replaces the file at path with its decompressed content.
+// A file that isn't in format fails without being changed.
+func decompressFile(path, format string) error {
+	open, ok := decompressors[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := open(in)
+	if err != nil {
+		return fmt.Errorf("not %s data: %w", format, err)
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	tmp := path + ".decompressed"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close() // Windows can't rename over an open file
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+const plainCSV = "a,b\n1,2\n"
+
+// compressed returns plainCSV in format.
+func compressed(t *testing.T, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	switch format {
+	case "gzip":
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(plainCSV))
+		w.Close()
+	case "xz":
+		w, err := xz.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(plainCSV))
+		w.Close()
+	case "zstd":
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(plainCSV))
+		w.Close()
+	case "bzip2":
+		// The standard library only reads bzip2; this is plainCSV from bzip2 -9
+		buf.WriteString("\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\xbf\x87\x40\x7f\x00\x00\x03\x59\x00\x00\x10\x00\x04\x30\x00\x30\x00\x20\x00\x30\xc0\x08\x69\xb2\x88\x23\x27\x8b\xb9\x22\x9c\x28\x48\x5f\xc3\xa0\x3f\x80")
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressFile(t *testing.T) {
+	for _, format := range []string{"gzip", "bzip2", "xz", "zstd"} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data")
+			os.WriteFile(path, compressed(t, format), 0o644)
+			if err := decompressFile(path, format); err != nil {
+				t.Fatal(err)
+			}
+			if got := mustRead(t, path); got != plainCSV {
+				t.Errorf("decompressed = %q, want %q", got, plainCSV)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "data")
+	os.WriteFile(path, []byte(plainCSV), 0o644)
+	if err := decompressFile(path, "gzip"); err == nil || !strings.Contains(err.Error(), "not gzip") {
+		t.Errorf("decompressFile(plain text) = %v, want a format error", err)
+	}
+	if got := mustRead(t, path); got != plainCSV {
+		t.Errorf("failed decompression changed the file to %q", got)
+	}
+}
+
+func TestValidateDecompress(t *testing.T) {
+	for _, format := range []string{"", "gzip", "bzip2", "xz", "zstd"} {
+		if err := validateDecompress(registry.Source{Decompress: format}); err != nil {
+			t.Errorf("validateDecompress(%q) = %v", format, err)
+		}
+	}
+	if err := validateDecompress(registry.Source{Decompress: "zip"}); err == nil {
+		t.Error("validateDecompress(zip) succeeded")
+	}
+}
+
+func TestFetch_Decompress(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "data.csv.gz")
+	os.WriteFile(src, compressed(t, "gzip"), 0o644)
+	target := filepath.Join(dir, "data.csv")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: data
+    source:
+      type: mockpath
+      path: `+src+`
+      decompress: gzip
+      lines: 2-
+    target: `+target+`
+`), 0o644)
+	lockPath := filepath.Join(dir, "lock.yaml")
+
+	if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+		t.Fatalf("Fetch() = %d, want 0", code)
+	}
+	if got := mustRead(t, target); got != "1,2\n" {
+		t.Errorf("target = %q, want the decompressed data rows", got)
+	}
+	lk, _ := readLock(lockPath)
+	item := lk.Items["data"]
+	raw, _ := HashFile(src)
+	local, _ := HashFile(target)
+	if item.RawSHA256 != raw || item.LocalSHA256 != local || item.Slice != "decompress=gzip,lines=2-" {
+		t.Errorf("lock entry = %+v; want raw_sha256 of the download, local_sha256 of the decompressed target", item)
+	}
+	if code := Check(cfgPath, lockPath); code != 0 {
+		t.Errorf("Check() = %d, want 0", code)
+	}
+}
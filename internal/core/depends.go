@@ -0,0 +1,214 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Dependencies: a dataset can name others that must be processed first,
+// e.g. a command source that post-processes another dataset's download:
+//
+//	- id: roads_raw
+//	  source: {type: http, url: https://example.com/roads.zip}
+//	  target: data/raw/roads.zip
+//	- id: roads
+//	  depends_on: [roads_raw]
+//	  source:
+//	    type: command
+//	    fetch_cmd: unzip -p data/raw/roads.zip roads.csv > {{dest}}
+//	    ...
+//	  target: data/roads.csv
+//
+// Dependencies come before their dependents in the processing order,
+// whatever their priorities or defaults.order say, and a dependent's work
+// only starts once its dependencies are done. If one of them ended in an error (or was
+// skipped itself), the dependent is skipped, with status "skipped" and the
+// dependency named, rather than run against missing or outdated input.
+// Dependencies left out of the run (by IDs, --tags or --sample) aren't waited
+// for.
+
+// checkDependencies reports depends_on entries naming unknown datasets or
+// the dataset itself, and dependency cycles.
+func checkDependencies(c *Config) []error {
+	var errs []error
+	index := map[string]int{}
+	for i, ds := range c.Datasets {
+		if _, ok := index[ds.ID]; !ok {
+			index[ds.ID] = i
+		}
+	}
+	for i, ds := range c.Datasets {
+		for _, dep := range ds.DependsOn {
+			switch _, ok := index[dep]; {
+			case dep == ds.ID:
+				errs = append(errs, fmt.Errorf("%s: depends_on: a dataset can't depend on itself", datasetRef(i, ds)))
+			case !ok:
+				errs = append(errs, fmt.Errorf("%s: depends_on: no dataset with id %q", datasetRef(i, ds), dep))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	// Depth-first search; reaching a dataset that is still on the path
+	// closes a cycle
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := make([]int, len(c.Datasets))
+	var path []string
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case onPath:
+			start := slices.Index(path, c.Datasets[i].ID)
+			return fmt.Errorf("%s: depends_on: cycle %s", datasetRef(i, c.Datasets[i]), strings.Join(append(path[start:], c.Datasets[i].ID), " -> "))
+		case done:
+			return nil
+		}
+		state[i] = onPath
+		path = append(path, c.Datasets[i].ID)
+		for _, dep := range c.Datasets[i].DependsOn {
+			if err := visit(index[dep]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+		return nil
+	}
+	for i := range c.Datasets {
+		if err := visit(i); err != nil {
+			return []error{err}
+		}
+	}
+	return nil
+}
+
+// dependencyOrder moves each dataset's dependencies ahead of it, keeping
+// the given order otherwise: a dataset that is already after its
+// dependencies stays where it is. Dependencies not among datasets are
+// ignored. Cycles were refused when the config was read.
+func dependencyOrder(datasets []Dataset) []Dataset {
+	index := make(map[string]int, len(datasets))
+	for i, ds := range datasets {
+		index[ds.ID] = i
+	}
+	out := make([]Dataset, 0, len(datasets))
+	placed := make([]bool, len(datasets))
+	var place func(i int)
+	place = func(i int) {
+		if placed[i] {
+			return
+		}
+		placed[i] = true // Before the dependencies, so a cycle can't recurse forever
+		for _, dep := range datasets[i].DependsOn {
+			if j, ok := index[dep]; ok {
+				place(j)
+			}
+		}
+		out = append(out, datasets[i])
+	}
+	for i := range datasets {
+		place(i)
+	}
+	return out
+}
+
+// dependencyGate holds back each dataset's work until its dependencies
+// are done, and skips it if one of them failed.
+//
+// Workers start in processing order (see forEachDataset) and dependencies
+// come first in it, so a dependency's work has always started by the time a
+// dependent waits for it: waiting can't deadlock, however few jobs there are.
+type dependencyGate struct {
+	deps    [][]int         // Indices of each dataset's dependencies in the run
+	ids     []string        // Dataset IDs, for messages
+	done    []chan struct{} // Closed when the dataset's result of this pass is known
+	failed  []string        // Why a finished dataset blocks its dependents ("" = it doesn't)
+	blocked []bool          // The dataset was skipped for a failed dependency
+}
+
+// newDependencyGate returns a gate for datasets, in processing order, or
+// nil if none of them depends on another one in the run.
+func newDependencyGate(datasets []Dataset) *dependencyGate {
+	index := make(map[string]int, len(datasets))
+	for i, ds := range datasets {
+		index[ds.ID] = i
+	}
+	g := &dependencyGate{
+		deps:    make([][]int, len(datasets)),
+		ids:     make([]string, len(datasets)),
+		done:    make([]chan struct{}, len(datasets)),
+		failed:  make([]string, len(datasets)),
+		blocked: make([]bool, len(datasets)),
+	}
+	needed := false
+	for i, ds := range datasets {
+		g.ids[i] = ds.ID
+		g.done[i] = make(chan struct{})
+		for _, dep := range ds.DependsOn {
+			if j, ok := index[dep]; ok && j < i {
+				g.deps[i] = append(g.deps[i], j)
+				needed = true
+			}
+		}
+	}
+	if !needed {
+		return nil
+	}
+	return g
+}
+
+// reset prepares the datasets in todo to be run again, by another pass of
+// forEachDatasetRetrying. Call it only while no work is running.
+func (g *dependencyGate) reset(todo []int) {
+	if g == nil {
+		return
+	}
+	for _, i := range todo {
+		g.done[i] = make(chan struct{})
+		g.failed[i], g.blocked[i] = "", false
+	}
+}
+
+// run does the work of dataset i once its dependencies are done, or skips
+// it if one of them failed. It runs on a worker goroutine.
+func (g *dependencyGate) run(i int, work func(i int) *datasetResult) *datasetResult {
+	if g == nil {
+		return work(i)
+	}
+	// Results are written before done is closed, so dependents waiting on
+	// it see them
+	defer close(g.done[i])
+	for _, j := range g.deps[i] {
+		<-g.done[j]
+		if g.failed[j] != "" {
+			reason := fmt.Sprintf("dependency %s %s", g.ids[j], g.failed[j])
+			res := newDatasetResult(g.ids[i])
+			res.printf("[SKIP] %s: %s\n", g.ids[i], reason)
+			res.report.Status, res.report.Error = "skipped", reason
+			res.exit = 1
+			g.failed[i], g.blocked[i] = "was skipped", true
+			return res
+		}
+	}
+	res := work(i)
+	switch res.report.Status {
+	case "error":
+		g.failed[i] = "failed"
+	case "skipped":
+		g.failed[i] = "was skipped"
+	}
+	return res
+}
+
+// retry reports whether dataset i, just applied, was skipped for a failed
+// dependency: it gets another go if its dependency is retried.
+func (g *dependencyGate) retry(i int) bool {
+	return g != nil && g.blocked[i]
+}
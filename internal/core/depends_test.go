@@ -0,0 +1,114 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckDependencies(t *testing.T) {
+	tests := []struct {
+		name     string
+		datasets []Dataset
+		want     string
+	}{
+		{"valid", []Dataset{{ID: "a"}, {ID: "b", DependsOn: []string{"a"}}, {ID: "c", DependsOn: []string{"a", "b"}}}, ""},
+		{"unknown", []Dataset{{ID: "a", DependsOn: []string{"nope"}}}, `dataset 0 (a): depends_on: no dataset with id "nope"`},
+		{"itself", []Dataset{{ID: "a", DependsOn: []string{"a"}}}, "dataset 0 (a): depends_on: a dataset can't depend on itself"},
+		{"cycle", []Dataset{{ID: "a", DependsOn: []string{"c"}}, {ID: "b", DependsOn: []string{"a"}}, {ID: "c", DependsOn: []string{"b"}}}, "dataset 0 (a): depends_on: cycle a -> c -> b -> a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, err := range checkDependencies(&Config{Datasets: tt.datasets}) {
+				got = append(got, err.Error())
+			}
+			if strings.Join(got, "\n") != tt.want {
+				t.Errorf("checkDependencies() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderDatasets_Dependencies(t *testing.T) {
+	datasets := []Dataset{
+		{ID: "report", Priority: 10, DependsOn: []string{"clean"}},
+		{ID: "codes"},
+		{ID: "clean", DependsOn: []string{"raw"}},
+		{ID: "raw"},
+	}
+	// Priority puts report first, but what it needs comes before it
+	var got []string
+	for _, ds := range orderDatasets(datasets, &Lock{}, "") {
+		got = append(got, ds.ID)
+	}
+	if strings.Join(got, ",") != "raw,clean,report,codes" {
+		t.Errorf("orderDatasets() = %s, want raw,clean,report,codes", got)
+	}
+}
+
+func TestFetch_Dependencies(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "source.csv")
+	os.WriteFile(src, []byte("a,b\n"), 0o644)
+	raw := filepath.Join(dir, "raw.csv")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: derived
+    depends_on: [raw]
+    source:
+      type: mockpath
+      path: `+raw+`
+    target: `+filepath.Join(dir, "derived.csv")+`
+  - id: raw
+    source:
+      type: mockpath
+      path: `+src+`
+    target: `+raw+`
+  - id: broken
+    source:
+      type: mockfail
+    target: `+filepath.Join(dir, "broken.txt")+`
+  - id: after_broken
+    depends_on: [broken]
+    source:
+      type: mock
+    target: `+filepath.Join(dir, "after_broken.txt")+`
+  - id: last
+    depends_on: [after_broken]
+    source:
+      type: mock
+    target: `+filepath.Join(dir, "last.txt")+`
+`), 0o644)
+
+	var out bytes.Buffer
+	code := FetchWithOptions(cfgPath, filepath.Join(dir, "lock.yaml"), nil, Options{Jobs: 4, Report: &out})
+	if code != 1 {
+		t.Errorf("FetchWithOptions() = %d, want 1", code)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "derived.csv")); string(b) != "a,b\n" {
+		t.Errorf("derived.csv = %q; its dependency wasn't fetched first", b)
+	}
+
+	var rep Report
+	if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]DatasetReport{}
+	for _, d := range rep.Datasets {
+		got[d.ID] = d
+	}
+	if d := got["after_broken"]; d.Status != "skipped" || d.Error != "dependency broken failed" {
+		t.Errorf("after_broken = %s %q, want skipped for its failed dependency", d.Status, d.Error)
+	}
+	if d := got["last"]; d.Status != "skipped" || d.Error != "dependency after_broken was skipped" {
+		t.Errorf("last = %s %q, want skipped along with its dependency", d.Status, d.Error)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "after_broken.txt")); err == nil {
+		t.Error("after_broken was fetched despite its failed dependency")
+	}
+}
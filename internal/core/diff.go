@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jprybylski/datum/internal/httputil"
+)
+
+// Diff previews what `datum fetch` would change, without changing anything:
+// the "plan" to review before approving data updates.
+//
+// Each selected dataset's remote fingerprint is compared with the lock, as
+// outdated does, and every difference is listed with the fingerprint parts
+// that moved. Lock entries whose dataset is gone from the config are listed
+// too. With contentLimit set (a size such as "1MiB"), the new version of each
+// changed dataset is downloaded to a temporary directory and shown as a line
+// diff against the local copy; binary content and files over the limit are
+// summarised by size and hash instead.
+//
+// Parameters:
+//   - cfgPath: Path to the configuration file
+//   - lockPath: Path to the lockfile
+//   - ids: Datasets to include (all if empty)
+//   - contentLimit: Size limit for content diffs; "" shows fingerprints only
+//   - opts: Jobs sets the concurrency
+//
+// Returns:
+//   - 0: Nothing would change
+//   - 1: Some dataset would change, or couldn't be checked
+//   - 2: Configuration error
+func Diff(cfgPath, lockPath string, ids []string, contentLimit string, opts Options) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	lk, err := readLock(lockPath)
+	if err != nil {
+		logf("lock error: %v\n", err)
+		return 2
+	}
+	var limit int64
+	if contentLimit != "" {
+		if limit, err = httputil.ParseByteSize(contentLimit); err != nil {
+			logf("config error: --max-size: %v\n", err)
+			return 2
+		}
+	}
+
+	which := map[string]bool{}
+	for _, id := range ids {
+		which[id] = true
+	}
+	var datasets []Dataset
+	configured := map[string]bool{}
+	for _, ds := range orderDatasets(cfg.Datasets, lk, cfg.Defaults.Order) {
+		configured[ds.ID] = true
+		if len(which) == 0 || which[ds.ID] {
+			datasets = append(datasets, ds)
+		}
+	}
+	items := make([]*LockItem, len(datasets))
+	for i, ds := range datasets {
+		items[i] = lk.Items[ds.ID].clone()
+	}
+
+	ctx := opts.runContext()
+	exit := 0
+	counts := map[string]int{}
+	forEachDataset(opts.Jobs, len(datasets), func(i int) *datasetResult {
+		return diffDataset(ctx, datasets[i], items[i], limit)
+	}, func(i int, res *datasetResult) {
+		counts[res.report.Status]++
+		if res.exit > exit {
+			exit = res.exit
+		}
+	})
+
+	// Entries a fetch would never touch again, since nothing configures them
+	var orphans []string
+	for id := range lk.Items {
+		if !configured[id] && (len(which) == 0 || which[id]) {
+			orphans = append(orphans, id)
+		}
+	}
+	sort.Strings(orphans)
+	for _, id := range orphans {
+		logf("[GONE] %s: in the lockfile but not the config\n", id)
+		exit = max(exit, 1)
+	}
+
+	logf("Plan: %d to fetch, %d new, %d unchanged", counts["changed"], counts["new"], counts["ok"])
+	if len(orphans) > 0 {
+		logf(", %d only in the lockfile", len(orphans))
+	}
+	if counts["error"] > 0 {
+		logf(", %d failed", counts["error"])
+	}
+	logln()
+	return exit
+}
+
+// diffDataset compares one dataset's source with its lock entry for Diff,
+// writing any difference (and, with limit > 0, a content diff) to the
+// result. It runs on a worker goroutine and only reads item, a private copy.
+// The report's status says what a fetch would do: "new", "changed", "ok" or
+// "error".
+func diffDataset(ctx context.Context, ds Dataset, item *LockItem, limit int64) *datasetResult {
+	res := newDatasetResult(ds.ID)
+	src, fp, err := firstFingerprintSource(ctx, ds.GetSources())
+	switch {
+	case err != nil:
+		res.printf("[ERR ] %s: fingerprint: %v\n", ds.ID, err)
+		res.fail(err)
+		res.exit = 1
+		return res
+	case item == nil || item.RemoteFingerprint == "":
+		res.printf("[NEW ] %s: fetch would pin %s\n", ds.ID, fp)
+		res.report.Status = "new"
+		item = nil // An entry without a fingerprint counts as none
+	case fp != item.RemoteFingerprint:
+		res.printf("[CHG ] %s: changed upstream\n", ds.ID)
+		res.report.Status = "changed"
+	case !fileExists(ds.Target):
+		res.printf("[CHG ] %s: unchanged upstream, but %s is missing\n", ds.ID, ds.Target)
+		res.report.Status = "changed"
+		res.exit = 1
+		return res
+	default:
+		res.report.Status = "ok"
+		return res
+	}
+	res.exit = 1
+	res.explainChange(ds, item, fp, src, true)
+	if limit > 0 {
+		writeContentDiff(ctx, &res.out, ds, limit)
+	}
+	return res
+}
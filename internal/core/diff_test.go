@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestDiffDataset(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "a.txt")
+	ds := Dataset{ID: "a", Target: target, Source: registry.Source{Type: "mock"}}
+	ctx := context.Background()
+
+	res := diffDataset(ctx, ds, nil, 0)
+	if res.report.Status != "new" || res.exit != 1 || !strings.Contains(res.out.String(), "[NEW ] a: fetch would pin mock-fp") {
+		t.Errorf("not locked: status %q, exit %d, output:\n%s", res.report.Status, res.exit, res.out.String())
+	}
+
+	os.WriteFile(target, []byte("old data\n"), 0o644)
+	res = diffDataset(ctx, ds, &LockItem{RemoteFingerprint: "old-fp"}, maxDiffBytes)
+	out := res.out.String()
+	if res.report.Status != "changed" || res.exit != 1 || !strings.Contains(out, "[CHG ] a: changed upstream") {
+		t.Errorf("changed: status %q, exit %d, output:\n%s", res.report.Status, res.exit, out)
+	}
+	// The content diff compares the local copy with what the mock serves
+	for _, want := range []string{"-old data", "+mock data", "datum update a"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("changed: output lacks %q:\n%s", want, out)
+		}
+	}
+	if got, _ := os.ReadFile(target); string(got) != "old data\n" {
+		t.Errorf("diff modified the target: %q", got)
+	}
+
+	res = diffDataset(ctx, ds, &LockItem{RemoteFingerprint: "mock-fp"}, 0)
+	if res.report.Status != "ok" || res.exit != 0 || res.out.Len() != 0 {
+		t.Errorf("unchanged: status %q, exit %d, output %q", res.report.Status, res.exit, res.out.String())
+	}
+
+	os.Remove(target)
+	if res := diffDataset(ctx, ds, &LockItem{RemoteFingerprint: "mock-fp"}, 0); res.report.Status != "changed" || !strings.Contains(res.out.String(), "missing") {
+		t.Errorf("missing target: status %q, output %q", res.report.Status, res.out.String())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	lockPath := filepath.Join(dir, "lock.yaml")
+	target := filepath.Join(dir, "a.txt")
+	os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: a
+    source: {type: mock}
+    target: `+target+`
+`), 0o644)
+	os.WriteFile(target, []byte("mock data"), 0o644)
+	lock := `version: 1
+items:
+  a:
+    local_sha256: x
+    remote_fingerprint: mock-fp
+`
+	os.WriteFile(lockPath, []byte(lock), 0o644)
+
+	if code := Diff(cfgPath, lockPath, nil, "", Options{}); code != 0 {
+		t.Errorf("Diff() with nothing to change = %d, want 0", code)
+	}
+
+	os.WriteFile(lockPath, []byte(lock+`  removed:
+    local_sha256: y
+    remote_fingerprint: z
+`), 0o644)
+	if code := Diff(cfgPath, lockPath, nil, "", Options{}); code != 1 {
+		t.Errorf("Diff() with an orphaned lock entry = %d, want 1", code)
+	}
+	if code := Diff(cfgPath, lockPath, []string{"a"}, "", Options{}); code != 0 {
+		t.Errorf("Diff(a) = %d, want 0 (the orphan isn't selected)", code)
+	}
+	if code := Diff(cfgPath, lockPath, nil, "lots", Options{}); code != 2 {
+		t.Errorf("Diff() with a bad --max-size = %d, want 2", code)
+	}
+
+	before, _ := os.ReadFile(lockPath)
+	Diff(cfgPath, lockPath, nil, "1MiB", Options{})
+	if after, _ := os.ReadFile(lockPath); string(after) != string(before) {
+		t.Error("Diff() wrote the lockfile")
+	}
+}
@@ -0,0 +1,260 @@
+package core
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Discover tells "datum outdated --discover" where to look for newer versions
+// of a dataset whose pinned URL (or git ref) names a specific version.
+//
+// Such datasets never look stale to check: data-v1.2.csv keeps serving the
+// same bytes after data-v1.3.csv is published next to it. Discovery lists the
+// available versions, compares them with the pinned one, and suggests the
+// updated URL. It never edits the config.
+//
+// Example:
+//
+//	discover:
+//	  url: https://example.com/releases/        # directory listing or API response
+//	  pattern: 'data-v(\d+\.\d+)\.csv'          # first capture group is the version
+type Discover struct {
+	Type     string            `yaml:"type,omitempty"`     // "listing" (default) or "s3"
+	URL      string            `yaml:"url"`                // Listing page, API endpoint, or bucket URL
+	Prefix   string            `yaml:"prefix,omitempty"`   // s3: only list keys under this prefix
+	Pattern  string            `yaml:"pattern"`            // Regex whose first capture group is a version
+	Template string            `yaml:"template,omitempty"` // Suggested URL/ref with {{version}} (default: pinned value with the version swapped)
+	Sign     *registry.Signing `yaml:"sign,omitempty"`     // Request signing, e.g. for private buckets
+
+	// PinPattern locates the version in the pinned URL/ref when it is written
+	// differently there than in the listing (default: Pattern)
+	PinPattern string `yaml:"pin_pattern,omitempty"`
+}
+
+// discoverers maps each discover.type to the function listing candidate
+// strings (page text, object keys) that the pattern is matched against.
+var discoverers = map[string]func(ctx context.Context, client *http.Client, d *Discover) ([]string, error){
+	"listing": listPage,
+	"s3":      listS3Keys,
+}
+
+// validateDiscover checks a discover block's syntax without touching the network.
+func validateDiscover(d *Discover) error {
+	if _, ok := discoverers[firstNonEmpty(d.Type, "listing")]; !ok {
+		return fmt.Errorf("discover.type: unknown type %q (want \"listing\" or \"s3\")", d.Type)
+	}
+	if d.URL == "" {
+		return errors.New("discover: missing url")
+	}
+	re, err := regexp.Compile(d.Pattern)
+	if err != nil {
+		return fmt.Errorf("discover.pattern: %w", err)
+	}
+	if re.NumSubexp() < 1 {
+		return errors.New("discover.pattern: needs a capture group around the version")
+	}
+	if d.PinPattern != "" {
+		re, err := regexp.Compile(d.PinPattern)
+		if err != nil {
+			return fmt.Errorf("discover.pin_pattern: %w", err)
+		}
+		if re.NumSubexp() < 1 {
+			return errors.New("discover.pin_pattern: needs a capture group around the version")
+		}
+	}
+	if d.Sign != nil {
+		if err := httputil.ValidateSigning(d.Sign); err != nil {
+			return fmt.Errorf("discover: %w", err)
+		}
+	}
+	return nil
+}
+
+// discovery is the outcome of running a dataset's discover block.
+type discovery struct {
+	pinned  string // Version found in the pinned URL/ref ("" if it doesn't match)
+	latest  string // Newest version available
+	suggest string // Pinned URL/ref rewritten for latest
+	field   string // Which source field suggest replaces: "url" or "ref"
+}
+
+// discoverLatest lists the versions available for ds and picks the newest.
+func discoverLatest(ctx context.Context, ds Dataset) (*discovery, error) {
+	d := ds.Discover
+	re := regexp.MustCompile(d.Pattern) // validated when the config was read
+	src := ds.GetSources()[0]
+
+	client := &http.Client{Timeout: 60 * time.Second, Transport: &httputil.BudgetTransport{}}
+	if src.Hosts != nil {
+		client.CheckRedirect = checkRedirectHost(src.Hosts)
+	}
+	auth := src // The listing is authenticated like the source, but signed as discover says
+	auth.Sign = d.Sign
+	if t := httputil.NewAuthTransport(client.Transport, auth); t != nil {
+		client.Transport = t
+	}
+	candidates, err := discoverers[firstNonEmpty(d.Type, "listing")](ctx, client, d)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &discovery{}
+	for _, c := range candidates {
+		for _, m := range re.FindAllStringSubmatch(c, -1) {
+			if v := m[1]; v != "" && (res.latest == "" || compareVersions(v, res.latest) > 0) {
+				res.latest = v
+			}
+		}
+	}
+	if res.latest == "" {
+		return nil, fmt.Errorf("discover: no versions matching %q at %s", d.Pattern, d.URL)
+	}
+
+	// Find the pinned version in the source URL, or failing that the git ref
+	pinRe := re
+	if d.PinPattern != "" {
+		pinRe = regexp.MustCompile(d.PinPattern)
+	}
+	res.field = "url"
+	pinnedValue := src.URL
+	loc := pinRe.FindStringSubmatchIndex(pinnedValue)
+	if loc == nil && src.Ref != "" {
+		res.field, pinnedValue = "ref", src.Ref
+		loc = pinRe.FindStringSubmatchIndex(pinnedValue)
+	}
+	if loc != nil {
+		res.pinned = pinnedValue[loc[2]:loc[3]]
+	}
+
+	switch {
+	case d.Template != "":
+		res.suggest = strings.ReplaceAll(d.Template, "{{version}}", res.latest)
+	case loc != nil:
+		res.suggest = pinnedValue[:loc[2]] + res.latest + pinnedValue[loc[3]:]
+	}
+	return res, nil
+}
+
+// listPage returns the body of d.URL as the only candidate. Directory indexes,
+// release pages and JSON APIs all work, as long as the pattern finds the versions.
+func listPage(ctx context.Context, client *http.Client, d *Discover) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("discover GET %s: %s", d.URL, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, err
+	}
+	return []string{string(b)}, nil
+}
+
+// s3ListResult is the part of an S3 ListObjectsV2 response we need.
+type s3ListResult struct {
+	Keys                  []string `xml:"Contents>Key"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+}
+
+// maxListPages bounds how many ListObjectsV2 pages (1000 keys each) are read.
+const maxListPages = 100
+
+// listS3Keys lists the object keys under d.Prefix in the bucket at d.URL,
+// following continuation tokens.
+func listS3Keys(ctx context.Context, client *http.Client, d *Discover) ([]string, error) {
+	base, err := url.Parse(d.URL)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	token := ""
+	for page := 0; page < maxListPages; page++ {
+		q := url.Values{"list-type": {"2"}}
+		if d.Prefix != "" {
+			q.Set("prefix", d.Prefix)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u := *base
+		u.RawQuery = q.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var res s3ListResult
+		if resp.StatusCode >= 400 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("discover list %s: %s", d.URL, resp.Status)
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("discover list %s: %w", d.URL, err)
+		}
+		keys = append(keys, res.Keys...)
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = res.NextContinuationToken
+	}
+	return keys, nil
+}
+
+// compareVersions orders version strings naturally: runs of digits compare
+// numerically and everything else byte-wise, so "1.10" > "1.9" and
+// "2024-11" > "2024-02". Returns -1, 0 or 1.
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		ca, ra := versionChunk(a)
+		cb, rb := versionChunk(b)
+		na, errA := strconv.ParseUint(ca, 10, 64)
+		nb, errB := strconv.ParseUint(cb, 10, 64)
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			if na < nb {
+				return -1
+			}
+			return 1
+		case (errA != nil || errB != nil) && ca != cb:
+			return strings.Compare(ca, cb)
+		}
+		a, b = ra, rb
+	}
+	return strings.Compare(a, b)
+}
+
+// versionChunk splits off the leading run of digits or of non-digits.
+func versionChunk(s string) (chunk, rest string) {
+	digit := s[0] >= '0' && s[0] <= '9'
+	i := 1
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9') == digit {
+		i++
+	}
+	return s[:i], s[i:]
+}
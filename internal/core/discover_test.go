@@ -0,0 +1,156 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10", "1.9", 1},
+		{"1.2", "1.2", 0},
+		{"1.2", "1.2.1", -1},
+		{"2024-11", "2024-02", 1},
+		{"v2", "v10", -1},
+		{"1.0-rc1", "1.0-rc2", -1},
+		{"20250101", "20241231", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDiscoverLatest(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="data-v1.9.csv">data-v1.9.csv</a> <a href="data-v1.10.csv">data-v1.10.csv</a> <a href="notes.txt">notes</a>`)
+	})
+	// Two pages of ListObjectsV2 results
+	mux.HandleFunc("/bucket", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("list-type") != "2" || r.URL.Query().Get("prefix") != "exports/" {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("continuation-token") == "" {
+			fmt.Fprint(w, `<ListBucketResult><Contents><Key>exports/2024-11.parquet</Key></Contents><IsTruncated>true</IsTruncated><NextContinuationToken>p2</NextContinuationToken></ListBucketResult>`)
+			return
+		}
+		fmt.Fprint(w, `<ListBucketResult><Contents><Key>exports/2025-02.parquet</Key></Contents><IsTruncated>false</IsTruncated></ListBucketResult>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	ctx := context.Background()
+
+	ds := Dataset{
+		ID:       "versioned",
+		Source:   registry.Source{Type: "http", URL: "https://example.com/releases/data-v1.9.csv"},
+		Discover: &Discover{URL: server.URL + "/releases/", Pattern: `data-v(\d+\.\d+)\.csv`},
+	}
+	got, err := discoverLatest(ctx, ds)
+	if err != nil {
+		t.Fatalf("discoverLatest() error = %v", err)
+	}
+	if got.pinned != "1.9" || got.latest != "1.10" || got.field != "url" || got.suggest != "https://example.com/releases/data-v1.10.csv" {
+		t.Errorf("listing discovery = %+v", got)
+	}
+
+	ds = Dataset{
+		ID:     "s3",
+		Source: registry.Source{Type: "git", URL: "https://example.com/repo.git", Ref: "snapshot-2024-11"},
+		Discover: &Discover{Type: "s3", URL: server.URL + "/bucket", Prefix: "exports/",
+			Pattern: `(\d{4}-\d{2})\.parquet`, PinPattern: `snapshot-(.+)`, Template: "snapshot-{{version}}"},
+	}
+	got, err = discoverLatest(ctx, ds)
+	if err != nil {
+		t.Fatalf("discoverLatest(s3) error = %v", err)
+	}
+	if got.pinned != "2024-11" || got.latest != "2025-02" || got.field != "ref" || got.suggest != "snapshot-2025-02" {
+		t.Errorf("s3 discovery = %+v", got)
+	}
+
+	ds.Discover = &Discover{URL: server.URL + "/releases/", Pattern: `release-(\d+)`}
+	if _, err := discoverLatest(ctx, ds); err == nil {
+		t.Error("discoverLatest() with no matching versions should fail")
+	}
+}
+
+func TestValidateDiscover(t *testing.T) {
+	bad := []Discover{
+		{URL: "https://example.com/", Pattern: `data-v\d+`},                         // no capture group
+		{URL: "https://example.com/", Pattern: `(`},                                 // invalid regex
+		{Pattern: `v(\d+)`},                                                         // no url
+		{Type: "ftp", URL: "https://example.com/", Pattern: `v(\d+)`},               // unknown type
+		{URL: "https://example.com/", Pattern: `v(\d+)`, Sign: &registry.Signing{}}, // bad signing
+		{URL: "https://example.com/", Pattern: `v(\d+)`, PinPattern: `v\d+`},        // pin_pattern without group
+	}
+	for i, d := range bad {
+		if err := validateDiscover(&d); err == nil {
+			t.Errorf("validateDiscover(%d: %+v) = nil, want error", i, d)
+		}
+	}
+	if err := validateDiscover(&Discover{URL: "https://example.com/", Pattern: `v(\d+)`}); err != nil {
+		t.Errorf("validateDiscover(valid) = %v", err)
+	}
+}
+
+func TestOutdated(t *testing.T) {
+	newest := "1.2"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `["1.0", "1.1", "%s"]`, newest)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := fmt.Sprintf(`version: 1
+datasets:
+  - id: versioned
+    source:
+      type: mock
+      url: https://example.com/data-1.2.csv
+    target: %s
+    discover:
+      url: %s
+      pattern: '"(\d+\.\d+)"'
+      pin_pattern: 'data-(\d+\.\d+)\.csv'
+`, filepath.Join(tmpDir, "data.csv"), server.URL)
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	if code := Outdated(configPath, lockPath, false, Options{}); code != 1 {
+		t.Errorf("Outdated() before fetch = %d, want 1", code)
+	}
+	if code := FetchWithOptions(configPath, lockPath, nil, Options{}); code != 0 {
+		t.Fatalf("FetchWithOptions() = %d", code)
+	}
+	before, _ := os.ReadFile(lockPath)
+
+	if code := Outdated(configPath, lockPath, true, Options{}); code != 0 {
+		t.Errorf("Outdated(--discover) on newest version = %d, want 0", code)
+	}
+	newest = "1.10"
+	if code := Outdated(configPath, lockPath, false, Options{}); code != 0 {
+		t.Errorf("Outdated() without --discover = %d, want 0 (fingerprint unchanged)", code)
+	}
+	if code := Outdated(configPath, lockPath, true, Options{}); code != 1 {
+		t.Errorf("Outdated(--discover) with newer version = %d, want 1", code)
+	}
+
+	if after, _ := os.ReadFile(lockPath); string(after) != string(before) {
+		t.Error("Outdated() modified the lockfile")
+	}
+}
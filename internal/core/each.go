@@ -0,0 +1,277 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Each is a dataset's "each" block: template variables and their values, in
+// the order they're written.
+type Each []EachVar
+
+// EachVar is one variable of an each block.
+type EachVar struct {
+	Name   string
+	Values EachValues
+}
+
+// UnmarshalYAML reads the block's mapping, keeping its order.
+//
+// Go learning note: decoding into a Go map would lose the order the
+// variables were written in, which decides the order of the expanded
+// datasets. A yaml.Node keeps it: a mapping node's Content alternates keys
+// and values.
+func (e *Each) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: each must map variable names to values", n.Line)
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		var v EachValues
+		if err := n.Content[i+1].Decode(&v); err != nil {
+			return err
+		}
+		*e = append(*e, EachVar{Name: n.Content[i].Value, Values: v})
+	}
+	return nil
+}
+
+// MarshalYAML writes the block back as a mapping.
+func (e Each) MarshalYAML() (any, error) {
+	n := &yaml.Node{Kind: yaml.MappingNode}
+	for _, v := range e {
+		var val yaml.Node
+		if err := val.Encode(v.Values); err != nil {
+			return nil, err
+		}
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: v.Name}, &val)
+	}
+	return n, nil
+}
+
+// EachValues lists the values of one "each" variable. In the config it is
+// either a YAML list, or a string: a range "2020..2024" (zero-padded like
+// its bounds, so "01..12" gives 01, 02, ... 12) or "glob:PATTERN", the names
+// of the files matching PATTERN.
+type EachValues struct {
+	List []string
+	Spec string // Range or glob, expanded by expandEach
+}
+
+// UnmarshalYAML accepts a list or a string.
+//
+// Go learning note: implementing yaml.Unmarshaler lets one field take more
+// than one shape in the config; the node's Kind says which one we were given.
+func (v *EachValues) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.SequenceNode {
+		return n.Decode(&v.List)
+	}
+	return n.Decode(&v.Spec)
+}
+
+// MarshalYAML writes the values back the way they were given.
+func (v EachValues) MarshalYAML() (any, error) {
+	if v.Spec != "" {
+		return v.Spec, nil
+	}
+	return v.List, nil
+}
+
+// eachVar matches a variable name usable in {{...}}.
+var eachVar = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// expandEach replaces every dataset that has an "each" block with one dataset
+// per combination of its variables' values, substituting {{name}} in the
+// ID, description, target, depends_on and source fields:
+//
+//   - id: monthly_{{year}}_{{month}}
+//     each:
+//     year: 2020..2024
+//     month: 01..12
+//     source:
+//     type: http
+//     url: https://example.com/data/{{year}}-{{month}}.csv
+//     target: data/monthly/{{year}}-{{month}}.csv
+//
+// becomes 60 ordinary datasets, monthly_2020_01 to monthly_2024_12, each with
+// its own lock entry. Variables are combined in the order they're written,
+// the last one varying fastest. Every variable must appear in the ID and the target, or
+// the expanded datasets would collide.
+func expandEach(c *Config) error {
+	var out []Dataset
+	for i, ds := range c.Datasets {
+		if len(ds.Each) == 0 {
+			out = append(out, ds)
+			continue
+		}
+		expanded, err := expandDataset(ds)
+		if err != nil {
+			return fmt.Errorf("dataset %d (%s): each: %w", i, ds.ID, err)
+		}
+		out = append(out, expanded...)
+	}
+	c.Datasets = out
+	return nil
+}
+
+// expandDataset returns the datasets ds's each block expands into.
+func expandDataset(ds Dataset) ([]Dataset, error) {
+	names := make([]string, len(ds.Each))
+	values := make([][]string, len(ds.Each))
+	for i, v := range ds.Each {
+		name := v.Name
+		names[i] = name
+		placeholder := "{{" + name + "}}"
+		switch {
+		case !eachVar.MatchString(name):
+			return nil, fmt.Errorf("invalid variable name %q (use lowercase letters, digits and _)", name)
+		case slices.Contains(names[:i], name):
+			return nil, fmt.Errorf("variable %q is listed twice", name)
+		case placeholder == versionVar:
+			return nil, fmt.Errorf("%s is reserved for the dataset's version", versionVar)
+		case !strings.Contains(ds.ID, placeholder) || !strings.Contains(ds.Target, placeholder):
+			return nil, fmt.Errorf("%s must appear in both id and target, so each expansion is a separate dataset", placeholder)
+		}
+		vals, err := eachValues(v.Values)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if len(vals) == 0 {
+			return nil, fmt.Errorf("%s: no values", name)
+		}
+		values[i] = vals
+	}
+
+	// Walk the combinations like an odometer: idx[i] indexes values[i]
+	var out []Dataset
+	idx := make([]int, len(names))
+	for {
+		vars := map[string]string{}
+		for i, name := range names {
+			vars[name] = values[i][idx[i]]
+		}
+		out = append(out, substituteDataset(ds, vars))
+
+		i := len(idx) - 1
+		for ; i >= 0; i-- {
+			if idx[i]++; idx[i] < len(values[i]) {
+				break
+			}
+			idx[i] = 0
+		}
+		if i < 0 {
+			return out, nil
+		}
+	}
+}
+
+// eachValues expands one variable's values.
+func eachValues(v EachValues) ([]string, error) {
+	if v.Spec == "" {
+		return v.List, nil
+	}
+	if pattern, ok := strings.CutPrefix(v.Spec, "glob:"); ok {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("glob %q: %w", pattern, err)
+		}
+		names := make([]string, len(matches))
+		for i, m := range matches {
+			names[i] = filepath.Base(m)
+		}
+		return names, nil
+	}
+	return expandRange(v.Spec)
+}
+
+// expandRange expands "FIRST..LAST" into the integers between, inclusive.
+// A bound written with leading zeros pads every value to its width.
+func expandRange(s string) ([]string, error) {
+	lo, hi, ok := strings.Cut(s, "..")
+	first, err1 := strconv.Atoi(lo)
+	last, err2 := strconv.Atoi(hi)
+	if !ok || err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("invalid value %q (want a list, a range like 2020..2024, or glob:PATTERN)", s)
+	}
+	if first > last {
+		return nil, fmt.Errorf("range %q runs backwards", s)
+	}
+	if last-first >= 10000 {
+		return nil, fmt.Errorf("range %q has more than 10000 values", s)
+	}
+	width := 0
+	if len(lo) > 1 && lo[0] == '0' {
+		width = len(lo)
+	}
+	var vals []string
+	for n := first; n <= last; n++ {
+		vals = append(vals, fmt.Sprintf("%0*d", width, n))
+	}
+	return vals, nil
+}
+
+// substituteDataset returns a copy of ds with {{name}} replaced by each
+// variable's value, and no each block.
+func substituteDataset(ds Dataset, vars map[string]string) Dataset {
+	pairs := make([]string, 0, 2*len(vars))
+	for name, v := range vars {
+		pairs = append(pairs, "{{"+name+"}}", v)
+	}
+	r := strings.NewReplacer(pairs...)
+
+	ds.Each = nil
+	ds.ID = r.Replace(ds.ID)
+	ds.Desc = r.Replace(ds.Desc)
+	ds.Target = r.Replace(ds.Target)
+	if ds.DependsOn != nil {
+		deps := make([]string, len(ds.DependsOn))
+		for i, dep := range ds.DependsOn {
+			deps[i] = r.Replace(dep)
+		}
+		ds.DependsOn = deps
+	}
+	if ds.Env != nil {
+		env := make(map[string]string, len(ds.Env))
+		for name, v := range ds.Env {
+			env[name] = r.Replace(v)
+		}
+		ds.Env = env
+	}
+	if ds.Source.Type != "" {
+		substituteSource(&ds.Source, r)
+	}
+	ds.Sources = append([]registry.Source(nil), ds.Sources...) // Don't share the original's
+	for i := range ds.Sources {
+		substituteSource(&ds.Sources[i], r)
+	}
+	return ds
+}
+
+// substituteSource applies r to the source's templated string fields.
+func substituteSource(src *registry.Source, r *strings.Replacer) {
+	src.Mirrors = slices.Clone(src.Mirrors) // Don't share the original's
+	src.FetchArgs = slices.Clone(src.FetchArgs)
+	for _, field := range sourceTemplateFields(src) {
+		*field = r.Replace(*field)
+	}
+}
+
+// sourceTemplateFields returns the source fields that may hold placeholders
+// ({{version}}, each variables).
+func sourceTemplateFields(src *registry.Source) []*string {
+	fields := []*string{&src.URL, &src.Path, &src.Ref, &src.FingerprintCmd, &src.FetchCmd, &src.Member}
+	for i := range src.Mirrors {
+		fields = append(fields, &src.Mirrors[i])
+	}
+	for i := range src.FetchArgs {
+		fields = append(fields, &src.FetchArgs[i])
+	}
+	return fields
+}
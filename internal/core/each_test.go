@@ -0,0 +1,138 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"2020..2023", []string{"2020", "2021", "2022", "2023"}, false},
+		{"01..03", []string{"01", "02", "03"}, false},
+		{"8..11", []string{"8", "9", "10", "11"}, false},
+		{"5..5", []string{"5"}, false},
+		{"2024..2020", nil, true},
+		{"a..z", nil, true},
+		{"2020", nil, true},
+		{"0..100000", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := expandRange(tt.in)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandRange(%q) = %v, %v; want %v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestExpandEach(t *testing.T) {
+	dir := t.TempDir()
+	write := func(body string) string {
+		path := filepath.Join(dir, "config.yaml")
+		os.WriteFile(path, []byte(body), 0o644)
+		return path
+	}
+
+	cfg, err := readConfig(write(`version: 1
+datasets:
+  - id: plain
+    source: {type: mock}
+    target: plain.csv
+  - id: monthly_{{year}}_{{month}}
+    desc: Sales for {{month}}/{{year}}
+    each:
+      year: 2020..2021
+      month: ["01", "02", "03"]
+    sources:
+      - type: http
+        url: https://example.com/{{year}}/{{month}}.csv
+      - type: http
+        url: https://mirror.example.com/{{year}}-{{month}}.csv
+    target: data/{{year}}/{{month}}.csv
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Datasets) != 7 {
+		t.Fatalf("got %d datasets, want 1 + 2*3", len(cfg.Datasets))
+	}
+	var ids []string
+	for _, ds := range cfg.Datasets {
+		ids = append(ids, ds.ID)
+	}
+	want := []string{"plain", "monthly_2020_01", "monthly_2020_02", "monthly_2020_03", "monthly_2021_01", "monthly_2021_02", "monthly_2021_03"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+	ds := cfg.Datasets[5]
+	if ds.Target != "data/2021/02.csv" || ds.Desc != "Sales for 02/2021" || ds.Each != nil {
+		t.Errorf("expanded dataset = %+v", ds)
+	}
+	if ds.Sources[0].URL != "https://example.com/2021/02.csv" || ds.Sources[1].URL != "https://mirror.example.com/2021-02.csv" {
+		t.Errorf("sources = %+v", ds.Sources)
+	}
+	if cfg.Datasets[1].Sources[0].URL != "https://example.com/2020/01.csv" {
+		t.Error("expanded datasets share their sources")
+	}
+
+	// Globs expand to the names of the matching files
+	os.MkdirAll(filepath.Join(dir, "incoming"), 0o755)
+	for _, name := range []string{"b.csv", "a.csv", "notes.txt"} {
+		os.WriteFile(filepath.Join(dir, "incoming", name), nil, 0o644)
+	}
+	cfg, err = readConfig(write(`version: 1
+datasets:
+  - id: raw_{{file}}
+    each:
+      file: glob:` + filepath.Join(dir, "incoming", "*.csv") + `
+    source:
+      type: file
+      path: ` + filepath.Join(dir, "incoming") + `/{{file}}
+    target: data/{{file}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Datasets) != 2 || cfg.Datasets[0].ID != "raw_a.csv" || !strings.HasSuffix(cfg.Datasets[1].Source.Path, "incoming/b.csv") {
+		t.Errorf("glob expansion = %+v", cfg.Datasets)
+	}
+
+	for name, body := range map[string]string{
+		"variable not in target": `id: a_{{y}}
+    each: {y: 1..2}
+    target: data.csv`,
+		"variable not in id": `id: a
+    each: {y: 1..2}
+    target: data-{{y}}.csv`,
+		"reserved name": `id: a_{{version}}
+    each: {version: [1, 2]}
+    target: data-{{version}}.csv`,
+		"bad range": `id: a_{{y}}
+    each: {y: 2024..2020}
+    target: data-{{y}}.csv`,
+		"no values": `id: a_{{y}}
+    each: {y: []}
+    target: data-{{y}}.csv`,
+		"listed twice": `id: a_{{y}}
+    each: {y: 1..2, y: 3..4}
+    target: data-{{y}}.csv`,
+		"bad name": `id: a_{{Y}}
+    each: {Y: 1..2}
+    target: data-{{Y}}.csv`,
+	} {
+		_, err := readConfig(write(`version: 1
+datasets:
+  - ` + body + `
+    source: {type: mock}
+`))
+		if err == nil || !strings.Contains(err.Error(), "each:") {
+			t.Errorf("%s: error = %v, want an each error", name, err)
+		}
+	}
+}
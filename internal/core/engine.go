@@ -17,6 +17,10 @@ import (
 //  3. Applies the dataset's policy (fail, update, or log)
 //  4. Updates the lockfile (only for "update" policy)
 //
+// Datasets are processed concurrently (see Options.Jobs). Each dataset's output
+// is buffered and printed as one group, in processing order, and the lockfile
+// is written once at the end.
+//
 // Policies explained:
 //   - "fail": Exit with error if remote has changed (strict mode for CI/CD) - does not update lockfile
 //   - "update": Automatically fetch new data if remote has changed - updates lockfile
@@ -34,213 +38,514 @@ import (
 // Go learning note: This function demonstrates error handling with exit codes,
 // similar to Unix command conventions. The main() function will pass this to os.Exit().
 func Check(cfgPath, lockPath string) int {
+	return CheckWithOptions(cfgPath, lockPath, Options{})
+}
+
+// CheckWithOptions is Check with explicit engine options (see Options).
+func CheckWithOptions(cfgPath, lockPath string, opts Options) (exit int) {
+	// The JSON report (if requested) is written however the run ends
+	opts = opts.withRunID()
+	rep := newReport("check", opts.RunID)
+	var st *Status
+	defer func() {
+		if err := rep.write(opts.Report, exit); err != nil {
+			logf("report write error: %v\n", err)
+		}
+		if err := writeMetrics(opts.MetricsFile, rep, st, exit); err != nil {
+			logf("metrics write error: %v\n", err)
+		}
+	}()
+
 	// Load configuration file
 	cfg, err := readConfig(cfgPath)
 	if err != nil {
-		fmt.Printf("config error: %v\n", err)
+		logf("config error: %v\n", err)
+		rep.Error = err.Error()
 		return 2
 	}
+	if cfg.Defaults.CheckWritesLock == "never" {
+		opts.NoWriteLock = true
+	}
+	cleanupOnStartup(cfg)
+	logf("[INFO] run %s\n", opts.RunID)
 
 	// Load lockfile (or create empty one if it doesn't exist)
 	lk, _ := readLock(lockPath)
 	if lk.Items == nil {
 		lk.Items = map[string]*LockItem{}
 	}
+	before := lk.clone() // For check_writes_lock: changed
+
+	// The organization's policy, if any, must hold before anything is touched
+	if err := applyOrgPolicy(opts.runContext(), cfg, lk); err != nil {
+		logf("policy error: %v\n", err)
+		rep.Error = err.Error()
+		return 2
+	}
+
+	// Load non-pin bookkeeping (re-verification times, observed fingerprints)
+	statusPath := firstNonEmpty(opts.StatusFile, defaultStatusPath(lockPath))
+	st, err = readStatus(statusPath)
+	if err != nil {
+		logf("[WARN] status file %s: %v (starting fresh)\n", statusPath, err)
+		st = &Status{Version: 1, Items: map[string]*StatusItem{}}
+	}
 
 	// Create context for handler operations (enables timeout/cancellation)
-	ctx := context.Background()
+	// exit tracks the highest severity exit code
+	ctx := opts.runContext()
 	now := time.Now().UTC()
-	exit := 0 // Track highest severity exit code
-
-	// Process each dataset defined in the configuration
-	for _, ds := range cfg.Datasets {
-		// Determine which policy to use (dataset-specific or default)
-		policy := firstNonEmpty(ds.Policy, cfg.Defaults.Policy)
-
-		// Get all sources for this dataset (supports both single and multiple sources)
-		sources := ds.GetSources()
-
-		// Try each source in order until one succeeds
-		var fp string
-		var lastErr error
-		sourceSucceeded := false
-
-		for i, source := range sources {
-			// Look up the handler for this source type (http, file, git, command)
-			f, ok := registry.Get(source.Type)
-			if !ok {
-				lastErr = fmt.Errorf("unknown source.type=%q", source.Type)
-				if len(sources) > 1 {
-					fmt.Printf("[WARN] %s: source %d/%d: %v (trying next source)\n", ds.ID, i+1, len(sources), lastErr)
-				}
-				continue
-			}
 
-			// Compute the current remote fingerprint
-			// Different handlers use different strategies (ETag, file hash, git SHA, etc.)
-			var err error
-			fp, err = f.Fingerprint(ctx, source)
-			if err != nil {
-				lastErr = err
-				if len(sources) > 1 {
-					fmt.Printf("[WARN] %s: source %d/%d: fingerprint: %v (trying next source)\n", ds.ID, i+1, len(sources), err)
-				}
-				continue
+	// Datasets this binary has no handler for are reported together up front
+	selected := selectByTags(orderDatasets(cfg.Datasets, lk, cfg.Defaults.Order), opts.Tags, opts.ExcludeTags)
+	datasets, skipped, ok := preflightHandlers(selected, opts.SkipUnknownHandlers)
+	if !ok {
+		rep.Error = "datasets need handlers this build doesn't have"
+		return 2
+	}
+	rep.Datasets = append(rep.Datasets, skipped...)
+
+	// In sampling mode only check the least recently covered subset
+	if opts.Sample != "" && len(datasets) > 0 {
+		k, err := parseSampleSize(opts.Sample, len(datasets))
+		if err != nil {
+			logf("config error: %v\n", err)
+			rep.Error = err.Error()
+			return 2
+		}
+		datasets = sampleDatasets(datasets, st, k)
+		logf("[INFO] sampling %d of %d datasets (least recently covered first)\n", len(datasets), len(selected))
+		for _, ds := range datasets {
+			st.item(ds.ID).CoveredAt = &now
+		}
+	}
+
+	// Snapshot each dataset's lock entry and status item up front: workers get
+	// private copies, so they never share a map with the goroutine applying results
+	items := make([]*LockItem, len(datasets))
+	statuses := make([]*StatusItem, len(datasets))
+	for i, ds := range datasets {
+		items[i] = lk.Items[ds.ID].clone()
+		statuses[i] = st.Items[ds.ID].clone()
+	}
+
+	// With --interactive, changed datasets are reviewed as their results come in
+	var rv *reviewer
+	if opts.Interactive != nil {
+		rv = newReviewer(opts.Interactive)
+	}
+
+	// Process the datasets concurrently; results are applied in order. A
+	// retried dataset's result replaces its earlier one, so the report and
+	// exit code are assembled per dataset at the end
+	reports := make([]DatasetReport, len(datasets))
+	exits := make([]int, len(datasets))
+	forEachDatasetRetrying(ctx, opts.RetryRun, opts.Jobs, len(datasets), newDependencyGate(datasets), func(i int) *datasetResult {
+		if ctx.Err() != nil {
+			return interruptedResult(datasets[i].ID)
+		}
+		dctx, cancel := withDatasetTimeout(ctx, datasets[i], opts.Timeout)
+		defer cancel()
+		return checkDataset(dctx, cfg, datasets[i], items[i].clone(), statuses[i], opts, now)
+	}, func(i int, res *datasetResult) {
+		id := datasets[i].ID
+		accepted := false
+		if rv != nil && res.report.Status == "changed" {
+			if fres := rv.review(ctx, cfg, datasets[i], lk.Items[id].clone(), statuses[i], now); fres != nil {
+				fres.statusChanged = fres.statusChanged || res.statusChanged
+				fres.report.Changes = res.report.Changes
+				res, accepted = fres, true
+			}
+		}
+		if res.lock != nil {
+			stampRun(res.lock, lk.Items[id], opts.RunID)
+			lk.Items[id] = res.lock
+		}
+		if res.statusChanged {
+			st.Items[id] = statuses[i]
+		}
+		// Pin each accepted version as soon as it's approved
+		if accepted && res.exit == 0 {
+			lk.Version = 1
+			if err := saveLock(lockPath, lk, opts); err != nil {
+				logf("lock write error: %v\n", err)
+				res.exit = 1
 			}
+		}
+		st.usage().recordUsage(datasets[i], res)
+		st.item(id).recordCheck(res.report.Status, now)
+		reports[i], exits[i] = res.report, datasetExit(datasets[i], res.report.Status, res.exit, opts.FailOn)
+	})
+	rep.Datasets = append(rep.Datasets, reports...)
+	for _, code := range exits {
+		exit = max(exit, code)
+	}
+
+	// An interrupted run still saves what finished: every entry below is
+	// either from a completed dataset or untouched from the previous lock
+	if ctx.Err() != nil {
+		logf("[WARN] run interrupted; unfinished datasets keep their previous lock entries\n")
+	}
+
+	// Keep .gitignore/.gitattributes in step with the configured targets
+	maybeSyncVCSFiles(cfg, cfgPath, opts)
+
+	// Have the transparency log witness new pins, unless the run was cut
+	// short or the indices couldn't be recorded; either way the next run
+	// submits whatever is still missing
+	if ctx.Err() == nil && !opts.NoWriteLock {
+		if code := witnessPins(ctx, cfg, lk, opts.RunID); code > exit {
+			exit = code
+		}
+	}
+
+	// Write updated lockfile back to disk, unless the config only wants
+	// changed pins written and nothing but check times moved
+	lk.Version = 1
+	lk.LastChecked = &now
+	if cfg.Defaults.CheckWritesLock == "changed" && !pinsChanged(before, lk) {
+		logf("[DBG ] no pins changed, lockfile left as it was\n")
+	} else if err := saveLock(lockPath, lk, opts); err != nil {
+		logf("lock write error: %v\n", err)
+		if exit == 0 {
+			exit = 1
+		}
+	}
 
-			// Source succeeded!
-			sourceSucceeded = true
-			break
+	// Tell the configured webhooks what needs attention, unless the run
+	// was cut short
+	if len(cfg.Notify) > 0 && ctx.Err() == nil {
+		sendNotifications(ctx, cfg, rep, st)
+	}
+
+	// Every run adds to the usage tally (see Usage), so there is always
+	// something to save. The status file lives next to the lock by default,
+	// so a read-only run only writes it when it was explicitly pointed
+	// somewhere else
+	st.usage().recordRun(rep.StartedAt, exit)
+	if !opts.NoWriteLock || opts.StatusFile != "" {
+		st.Version = 1
+		if err := writeStatus(statusPath, st); err != nil {
+			logf("[WARN] status write error: %v\n", err)
 		}
+	}
+	return exit
+}
 
-		// If all sources failed, handle the error
-		if !sourceSucceeded {
+// checkDataset checks one dataset against its lock entry and applies its policy.
+//
+// It runs on a worker goroutine, so it must not touch shared state: item and si
+// are private copies of the dataset's lock entry and status item (item is nil on
+// the first run), and all output goes to the result's buffer. The caller applies
+// the returned lock entry and status changes.
+func checkDataset(ctx context.Context, cfg *Config, ds Dataset, item *LockItem, si *StatusItem, opts Options, now time.Time) *datasetResult {
+	res := newDatasetResult(ds.ID)
+	if item != nil {
+		res.report.OldFingerprint = item.RemoteFingerprint
+	}
+
+	// Determine which policy to use (dataset-specific or default)
+	policy := firstNonEmpty(ds.Policy, cfg.Defaults.Policy)
+
+	// An exception turns fail into log until it expires
+	exc, excActive := cfg.exceptionFor(ds.ID, now)
+	if policy == "fail" && excActive {
+		policy = "log"
+		res.report.Exception = exc
+		res.printf("[WARN] %s: fail policy relaxed until %s by exception: %s\n", ds.ID, exc.Expires, exc.Reason)
+	}
+
+	// Periodically re-hash the local copy against the pin (bit-rot detection)
+	reverifyEvery := firstNonEmpty(ds.ReverifyEvery, cfg.Defaults.ReverifyEvery)
+	localModified := false
+	if reverifyEvery != "" {
+		start := time.Now()
+		due, ok, detail := reverifyLocal(ds, reverifyEvery, item, si, now)
+		if due {
+			res.timeOp(opVerify, si, start, now)
+			switch {
+			case ok:
+				res.printf("[OK  ] %s: local copy re-verified\n", ds.ID)
+			case policy == "update":
+				localModified = true
+				res.printf("[WARN] %s: %s\n", ds.ID, detail)
+			case policy == "log":
+				localModified = true
+				res.printf("[STALE] %s: %s\n", ds.ID, detail)
+			default:
+				localModified = true
+				res.printf("[FAIL] %s: %s\n", ds.ID, detail)
+				res.exit = 1
+			}
+		}
+	}
+
+	// Get all sources for this dataset (supports both single and multiple sources)
+	sources := ds.GetSources()
+	retries := cfg.retryPolicyFor(ds)
+
+	// Try each source in order until one succeeds
+	var fp string
+	var lastErr error
+	var usedSource registry.Source
+	sourceSucceeded := false
+
+	for i, source := range sources {
+		// Look up the handler for this source type (http, file, git, command)
+		f, ok := registry.Get(source.Type)
+		if !ok {
+			lastErr = fmt.Errorf("unknown source.type=%q", source.Type)
 			if len(sources) > 1 {
-				fmt.Printf("[ERR ] %s: all %d sources failed, last error: %v\n", ds.ID, len(sources), lastErr)
-			} else {
-				fmt.Printf("[ERR ] %s: fingerprint: %v\n", ds.ID, lastErr)
+				res.printf("[WARN] %s: source %d/%d: %v (trying next source)\n", ds.ID, i+1, len(sources), lastErr)
 			}
-			if exit == 0 {
-				exit = 1 // Operational error
+			continue
+		}
+
+		// Compute the current remote fingerprint
+		// Different handlers use different strategies (ETag, file hash, git SHA, etc.)
+		fromCache := false
+		start := time.Now()
+		err := res.retry(ctx, retries, "fingerprint", func() (err error) {
+			fp, fromCache, err = fingerprintSource(ctx, f, source, si, opts.HonorCache, now)
+			return err
+		})
+		if err != nil {
+			lastErr = err
+			if len(sources) > 1 {
+				res.printf("[WARN] %s: source %d/%d: fingerprint: %v (trying next source)\n", ds.ID, i+1, len(sources), err)
 			}
 			continue
 		}
 
-		// Get the lock entry for this dataset (may be nil if this is the first run)
-		item := lk.Items[ds.ID]
+		// Source succeeded!
+		if fromCache {
+			res.printf("[INFO] %s: cached response fresh until %s, not re-fingerprinting\n", ds.ID, si.FreshUntil.Format(time.RFC3339))
+		} else {
+			res.timeOp(opFingerprint, si, start, now)
+		}
+		sourceSucceeded = true
+		usedSource = source
+		break
+	}
 
-		// Compute local file hash if the file exists
-		localHash := ""
-		if fileExists(ds.Target) {
-			if h, err := HashFile(ds.Target); err == nil {
-				localHash = h
-			} else {
-				fmt.Printf("[ERR ] %s: local hash: %v\n", ds.ID, err)
-			}
+	// If all sources failed, handle the error
+	if !sourceSucceeded {
+		if len(sources) > 1 {
+			res.printf("[ERR ] %s: all %d sources failed, last error: %v\n", ds.ID, len(sources), lastErr)
+		} else {
+			res.printf("[ERR ] %s: fingerprint: %v\n", ds.ID, lastErr)
 		}
+		res.fail(lastErr)
+		if res.exit == 0 {
+			res.exit = 1 // Operational error
+		}
+		return res
+	}
 
-		// Determine if the remote source has changed since last check
-		// It's stale if we have no lock entry, or if the fingerprint differs
-		stale := (item == nil) || (item.RemoteFingerprint != fp)
-
-		// Apply the policy based on whether the remote is stale
-		switch policy {
-		case "update":
-			// UPDATE policy: Automatically fetch if remote changed or local file is missing
-			if stale || !fileExists(ds.Target) {
-				fmt.Printf("[UPD ] %s: refreshing\n", ds.ID)
-
-				// Try each source in order until one succeeds for fetching
-				fetchSucceeded := false
-				var fetchErr error
-				for i, source := range sources {
-					f, ok := registry.Get(source.Type)
-					if !ok {
-						fetchErr = fmt.Errorf("unknown source.type=%q", source.Type)
-						if len(sources) > 1 {
-							fmt.Printf("[WARN] %s: source %d/%d: %v (trying next source)\n", ds.ID, i+1, len(sources), fetchErr)
-						}
-						continue
-					}
+	// Another mirror may have answered than the one that was pinned: the
+	// source still matches the lock if any of its mirrors does
+	if item != nil && item.RemoteFingerprint != fp && len(usedSource.Mirrors) > 0 {
+		if m := mirrorMatching(ctx, usedSource, item.RemoteFingerprint); m != "" {
+			res.printf("[INFO] %s: mirror %s matches the lock\n", ds.ID, m)
+			fp = item.RemoteFingerprint
+		}
+	}
 
-					if err := f.Fetch(ctx, source, ds.Target); err != nil {
-						fetchErr = err
-						if len(sources) > 1 {
-							fmt.Printf("[WARN] %s: source %d/%d: fetch: %v (trying next source)\n", ds.ID, i+1, len(sources), err)
-						}
-						continue
-					}
+	// An archive rebuilt around an unchanged member isn't a change: record
+	// its new fingerprint and carry on
+	if item != nil && item.RemoteFingerprint != fp && usedSource.ArchivePath != "" && item.LocalSHA256 != "" {
+		if f, ok := registry.Get(usedSource.Type); ok && archiveMemberUnchanged(ctx, f, usedSource, ds, item) {
+			res.printf("[INFO] %s: archive changed, but not %s in it\n", ds.ID, usedSource.ArchivePath)
+			item = item.clone()
+			item.RemoteFingerprint = fp
+			res.lock = item
+		}
+	}
+
+	res.report.Source = firstNonEmpty(usedSource.URL, usedSource.Path)
+	res.report.NewFingerprint = fp
+	res.printf("[DBG ] %s: remote fingerprint %s from %s\n", ds.ID, fp, res.report.Source)
+
+	// A source that answers through a permanent redirect works today but is
+	// recorded under a dead URL - say so, without failing the check
+	if moved := relocation(ctx, usedSource); moved != "" {
+		res.printf("[MOVED] %s: %s -> %s (run 'datum fix-urls')\n", ds.ID, usedSource.URL, moved)
+	}
+
+	// Remember what the remote looked like, without touching the pin
+	if reverifyEvery != "" {
+		si.ObservedFingerprint = fp
+		si.ObservedAt = &now
+		res.statusChanged = true
+	}
+
+	// Compute local file hash if the file exists
+	localHash := ""
+	if fileExists(ds.Target) {
+		start := time.Now()
+		if h, _, err := HashPath(ds.Target); err == nil {
+			localHash = h
+			res.timeOp(opVerify, si, start, now)
+		} else {
+			res.printf("[ERR ] %s: local hash: %v\n", ds.ID, err)
+			res.fail(fmt.Errorf("local hash: %w", err))
+		}
+	}
 
-					// Fetch succeeded! Now get the fingerprint from this source
-					if newFp, err := f.Fingerprint(ctx, source); err == nil {
-						fp = newFp
+	// Determine if the remote source has changed since last check
+	// It's stale if we have no lock entry, or if the fingerprint differs
+	stale := (item == nil) || (item.RemoteFingerprint != fp)
+
+	// Apply the policy based on whether the remote is stale
+	switch policy {
+	case "update":
+		// UPDATE policy: Automatically fetch if remote changed or local file is missing
+		// (or failed re-verification)
+		// A changed transform needs the data fetched again to run on
+		retransform := item != nil && item.LocalSHA256 != "" && item.Transform != ds.Transform
+		if stale || localModified || retransform || !fileExists(ds.Target) {
+			res.printf("[UPD ] %s: refreshing\n", ds.ID)
+
+			// Try each source in order until one succeeds for fetching
+			fetchSucceeded := false
+			var fetchErr error
+			saved := savedXattrs(ds, cfg) // before the fetch replaces the target
+			var raw string
+			for i, source := range sources {
+				f, ok := registry.Get(source.Type)
+				if !ok {
+					fetchErr = fmt.Errorf("unknown source.type=%q", source.Type)
+					if len(sources) > 1 {
+						res.printf("[WARN] %s: source %d/%d: %v (trying next source)\n", ds.ID, i+1, len(sources), fetchErr)
 					}
-					fetchSucceeded = true
-					break
+					continue
 				}
 
-				if !fetchSucceeded {
+				start := time.Now()
+				fetched, cached := true, false
+				err := res.retry(ctx, retries, "fetch", func() (err error) {
+					raw, fetched, cached, err = fetchCached(ctx, f, source, ds, cfg, item)
+					return err
+				})
+				if err != nil {
+					fetchErr = err
 					if len(sources) > 1 {
-						fmt.Printf("[ERR ] %s: all %d sources failed to fetch, last error: %v\n", ds.ID, len(sources), fetchErr)
-					} else {
-						fmt.Printf("[ERR ] %s: fetch: %v\n", ds.ID, fetchErr)
+						res.printf("[WARN] %s: source %d/%d: fetch: %v (trying next source)\n", ds.ID, i+1, len(sources), err)
 					}
-					fmt.Printf("[INFO] %s: source may be inaccessible - please verify the source configuration\n", ds.ID)
-					// Record the failure in the lock file
+					continue
+				}
+				res.timeOp(opFetch, si, start, now)
+				res.noteFetch(ds, fetched, cached)
+				for _, err := range finishTarget(ctx, f, source, ds, cfg, saved) {
+					res.printf("[WARN] %s: %v\n", ds.ID, err)
+				}
+
+				// Fetch succeeded! Now get the fingerprint from this source
+				if newFp, err := f.Fingerprint(ctx, source); err == nil {
+					fp = newFp
+				}
+				fetchSucceeded = true
+				usedSource = source
+				break
+			}
+
+			if !fetchSucceeded {
+				if len(sources) > 1 {
+					res.printf("[ERR ] %s: all %d sources failed to fetch, last error: %v\n", ds.ID, len(sources), fetchErr)
+				} else {
+					res.printf("[ERR ] %s: fetch: %v\n", ds.ID, fetchErr)
+				}
+				res.printf("[INFO] %s: source may be inaccessible - please verify the source configuration\n", ds.ID)
+				res.fail(fetchErr)
+				// Record the failure in the lock file, unless the run was
+				// interrupted: that says nothing about the source
+				if !interrupted(fetchErr) {
 					if item == nil {
 						item = &LockItem{}
-						lk.Items[ds.ID] = item
 					}
 					item.InaccessibleAt = &now
 					item.InaccessibleError = fetchErr.Error()
-					if exit == 0 {
-						exit = 1
-					}
-					continue
+					res.lock = item
 				}
-
-				// Update lockfile with new fingerprint and local hash
-				// Clear inaccessible status since fetch succeeded
-				h, _ := HashFile(ds.Target)
-				lk.Items[ds.ID] = &LockItem{LocalSHA256: h, RemoteFingerprint: fp, CheckedAt: &now, InaccessibleAt: nil, InaccessibleError: ""}
-			} else {
-				// Remote hasn't changed - just update the lock timestamps
-				if item == nil {
-					item = &LockItem{}
-					lk.Items[ds.ID] = item
+				if res.exit == 0 {
+					res.exit = 1
 				}
-				item.LocalSHA256 = localHash
-				item.RemoteFingerprint = fp
-				item.CheckedAt = &now
-				fmt.Printf("[OK  ] %s: up-to-date\n", ds.ID)
+				return res
 			}
 
-		case "log":
-			// LOG policy: Report changes but don't fail or update
-			if stale {
-				lockfp := "<nil>"
-				if item != nil {
-					lockfp = item.RemoteFingerprint
-				}
-				fmt.Printf("[STALE] %s: remote changed (lock=%q -> now=%q)\n", ds.ID, lockfp, fp)
-			} else {
-				fmt.Printf("[OK  ] %s: up-to-date\n", ds.ID)
-			}
-			// Don't update the lock - we want to keep reporting stale status until actually updated
-
-		case "fail":
-			// FAIL policy: Exit with error if remote has changed (strict mode)
-			if stale {
-				lockfp := "<nil>"
-				if item != nil {
-					lockfp = item.RemoteFingerprint
-				}
-				fmt.Printf("[FAIL] %s: remote changed (lock=%q -> now=%q)\n", ds.ID, lockfp, fp)
-				exit = 1 // Mark as failed, but continue checking other datasets
-			} else {
-				fmt.Printf("[OK  ] %s: up-to-date\n", ds.ID)
+			// Update lockfile with new fingerprint and local hash
+			// Clear inaccessible status since fetch succeeded
+			h, files, _ := HashPath(ds.Target)
+			res.storeInCache(cfg, ds, usedSource, fp, h)
+			res.lock = &LockItem{Target: ds.Target, LocalSHA256: h, RemoteFingerprint: fp, Size: fileSize(ds.Target), Files: files, Slice: sliceSpec(usedSource), RawSHA256: raw, Transform: ds.Transform, CheckedAt: &now, InaccessibleAt: nil, InaccessibleError: ""}
+			res.report.NewFingerprint = fp
+			res.setStatus("updated")
+		} else {
+			// Remote hasn't changed - just update the lock timestamps
+			if item == nil {
+				item = &LockItem{}
 			}
-			// Don't update the lock - we want to keep failing until actually updated
+			item.LocalSHA256 = localHash
+			item.RemoteFingerprint = fp
+			item.CheckedAt = &now
+			res.lock = item
+			res.printf("[OK  ] %s: up-to-date\n", ds.ID)
+			res.setStatus("ok")
+		}
 
-		default:
-			// Unknown policy - treat as "fail" with a warning
-			fmt.Printf("[WARN] %s: unknown policy=%q (treating as 'fail')\n", ds.ID, policy)
-			if stale {
-				exit = 1
+	case "log":
+		// LOG policy: Report changes but don't fail or update
+		if stale {
+			lockfp := "<nil>"
+			if item != nil {
+				lockfp = item.RemoteFingerprint
+			}
+			res.printf("[STALE] %s: remote changed (lock=%q -> now=%q)\n", ds.ID, lockfp, fp)
+			res.explainChange(ds, item, fp, usedSource, false)
+			res.setStatus("stale")
+		} else {
+			res.printf("[OK  ] %s: up-to-date\n", ds.ID)
+			res.setStatus("ok")
+		}
+		// Don't update the lock - we want to keep reporting stale status until actually updated
+
+	case "fail":
+		// FAIL policy: Exit with error if remote has changed (strict mode)
+		if stale {
+			lockfp := "<nil>"
+			if item != nil {
+				lockfp = item.RemoteFingerprint
+			}
+			res.printf("[FAIL] %s: remote changed (lock=%q -> now=%q)\n", ds.ID, lockfp, fp)
+			res.explainChange(ds, item, fp, usedSource, true)
+			if exc != nil {
+				res.printf("[INFO] %s: exception expired %s (%s)\n", ds.ID, exc.Expires, exc.Reason)
 			}
+			res.exit = 1 // Mark as failed, but continue checking other datasets
+			res.setStatus("changed")
+		} else {
+			res.printf("[OK  ] %s: up-to-date\n", ds.ID)
+			res.setStatus("ok")
+		}
+		// Don't update the lock - we want to keep failing until actually updated
+
+	default:
+		// Unknown policy - treat as "fail" with a warning
+		res.printf("[WARN] %s: unknown policy=%q (treating as 'fail')\n", ds.ID, policy)
+		if stale {
+			res.exit = 1
+			res.explainChange(ds, item, fp, usedSource, false)
+			res.setStatus("changed")
+		} else {
+			res.setStatus("ok")
 		}
 	}
 
-	// Write updated lockfile back to disk
-	lk.Version = 1
-	lk.LastChecked = &now
-	if err := writeLock(lockPath, lk); err != nil {
-		fmt.Printf("lock write error: %v\n", err)
-		if exit == 0 {
-			exit = 1
-		}
+	// A local copy that failed re-verification matters even if upstream didn't move
+	if localModified && res.report.Status == "ok" {
+		res.report.Status = "modified"
 	}
-	return exit
+	return res
 }
 
 // Fetch downloads data from external sources and updates the lockfile.
@@ -264,12 +569,36 @@ func Check(cfgPath, lockPath string) int {
 // Go learning note: The ids parameter is a slice (dynamic array). Passing an empty
 // slice vs. nil slice doesn't matter here - we check length with len(which) > 0.
 func Fetch(cfgPath, lockPath string, ids []string) int {
+	return FetchWithOptions(cfgPath, lockPath, ids, Options{})
+}
+
+// FetchWithOptions is Fetch with explicit engine options (see Options).
+func FetchWithOptions(cfgPath, lockPath string, ids []string, opts Options) int {
+	exit, _ := runFetch(cfgPath, lockPath, ids, opts)
+	return exit
+}
+
+// runFetch is FetchWithOptions, also returning the run's report for callers
+// that summarize it (see Update).
+func runFetch(cfgPath, lockPath string, ids []string, opts Options) (exit int, rep *Report) {
+	// The JSON report (if requested) is written however the run ends
+	opts = opts.withRunID()
+	rep = newReport("fetch", opts.RunID)
+	defer func() {
+		if err := rep.write(opts.Report, exit); err != nil {
+			logf("report write error: %v\n", err)
+		}
+	}()
+
 	// Load configuration file
 	cfg, err := readConfig(cfgPath)
 	if err != nil {
-		fmt.Printf("config error: %v\n", err)
-		return 2
+		logf("config error: %v\n", err)
+		rep.Error = err.Error()
+		return 2, rep
 	}
+	cleanupOnStartup(cfg)
+	logf("[INFO] run %s\n", opts.RunID)
 
 	// Build a set of IDs to fetch (if specific IDs were requested)
 	// Go learning note: Using a map[string]bool as a "set" is a common Go idiom.
@@ -285,101 +614,252 @@ func Fetch(cfgPath, lockPath string, ids []string) int {
 		lk.Items = map[string]*LockItem{}
 	}
 
+	// The organization's policy, if any, must hold before anything is touched
+	if err := applyOrgPolicy(opts.runContext(), cfg, lk); err != nil {
+		logf("policy error: %v\n", err)
+		rep.Error = err.Error()
+		return 2, rep
+	}
+
+	// Load non-pin bookkeeping (timings)
+	statusPath := firstNonEmpty(opts.StatusFile, defaultStatusPath(lockPath))
+	st, err := readStatus(statusPath)
+	if err != nil {
+		logf("[WARN] status file %s: %v (starting fresh)\n", statusPath, err)
+		st = &Status{Version: 1, Items: map[string]*StatusItem{}}
+	}
+
 	// Create context for handler operations
-	ctx := context.Background()
+	// exit tracks the highest severity exit code
+	ctx := opts.runContext()
 	now := time.Now().UTC()
-	exit := 0 // Track highest severity exit code
 
-	// Process each dataset (or just the requested ones)
-	for _, ds := range cfg.Datasets {
+	// Select the requested datasets, highest priority first
+	var datasets []Dataset
+	for _, ds := range selectByTags(orderDatasets(cfg.Datasets, lk, cfg.Defaults.Order), opts.Tags, opts.ExcludeTags) {
 		// Skip datasets not in the requested set (if IDs were specified)
 		// If len(which) == 0, fetch all datasets
 		if len(which) > 0 && !which[ds.ID] {
 			continue
 		}
+		datasets = append(datasets, ds)
+	}
+	datasets, skipped, ok := preflightHandlers(datasets, opts.SkipUnknownHandlers)
+	if !ok {
+		rep.Error = "datasets need handlers this build doesn't have"
+		return 2, rep
+	}
+	rep.Datasets = append(rep.Datasets, skipped...)
+	items := make([]*LockItem, len(datasets))
+	statuses := make([]*StatusItem, len(datasets))
+	for i, ds := range datasets {
+		items[i] = lk.Items[ds.ID].clone()
+		statuses[i] = st.Items[ds.ID].clone()
+	}
 
-		// Get all sources for this dataset (supports both single and multiple sources)
-		sources := ds.GetSources()
+	// A transaction fetches into a staging area (see transaction.go). Its
+	// datasets can't read each other's new data, so depends_on is refused
+	gate := newDependencyGate(datasets)
+	var txn *fetchTxn
+	if opts.Transactional {
+		if gate != nil {
+			err := fmt.Errorf("--transactional: datasets with depends_on can't be fetched in a transaction, as dependents would read their dependencies' old data")
+			logf("config error: %v\n", err)
+			rep.Error = err.Error()
+			return 2, rep
+		}
+		txn = newFetchTxn(datasets)
+		defer txn.discard()
+	}
 
-		// Try each source in order until one succeeds
-		fmt.Printf("[FETCH] %s\n", ds.ID)
-		fetchSucceeded := false
-		var fp string
-		var lastErr error
+	// Fetch concurrently; results are applied in order, and a retried
+	// dataset's result replaces its earlier one (see Check)
+	reports := make([]DatasetReport, len(datasets))
+	exits := make([]int, len(datasets))
+	forEachDatasetRetrying(ctx, opts.RetryRun, opts.Jobs, len(datasets), gate, func(i int) *datasetResult {
+		if ctx.Err() != nil {
+			return interruptedResult(datasets[i].ID)
+		}
+		ds := datasets[i]
+		if txn != nil {
+			ds = txn.stage(i, ds)
+		}
+		dctx, cancel := withDatasetTimeout(ctx, ds, opts.Timeout)
+		defer cancel()
+		return fetchDataset(dctx, cfg, ds, items[i].clone(), statuses[i], now)
+	}, func(i int, res *datasetResult) {
+		id := datasets[i].ID
+		if res.lock != nil {
+			res.lock.Target = datasets[i].Target // Not the staging path
+			stampRun(res.lock, lk.Items[id], opts.RunID)
+			lk.Items[id] = res.lock
+		}
+		if res.statusChanged {
+			st.Items[id] = statuses[i]
+		}
+		st.usage().recordUsage(datasets[i], res)
+		st.item(id).recordCheck(res.report.Status, now)
+		reports[i], exits[i] = res.report, datasetExit(datasets[i], res.report.Status, res.exit, opts.FailOn)
+	})
+	rep.Datasets = append(rep.Datasets, reports...)
+	for _, code := range exits {
+		exit = max(exit, code)
+	}
 
-		for i, source := range sources {
-			// Look up the handler for this source type
-			f, ok := registry.Get(source.Type)
-			if !ok {
-				lastErr = fmt.Errorf("unknown source.type=%q", source.Type)
-				if len(sources) > 1 {
-					fmt.Printf("[WARN] %s: source %d/%d: %v (trying next source)\n", ds.ID, i+1, len(sources), lastErr)
-				}
-				continue
-			}
+	// A transaction's targets are moved into place only if every dataset
+	// was fetched; otherwise the lock isn't written either
+	lockOpts := opts
+	if txn != nil && !txn.finish(ctx, reports, rep) {
+		exit = max(exit, 1)
+		lockOpts.NoWriteLock = true
+	}
 
-			// Fetch the data from the source
-			if err := f.Fetch(ctx, source, ds.Target); err != nil {
-				lastErr = err
-				if len(sources) > 1 {
-					fmt.Printf("[WARN] %s: source %d/%d: fetch: %v (trying next source)\n", ds.ID, i+1, len(sources), err)
-				}
-				continue
-			}
+	// An interrupted run still saves what finished: every entry below is
+	// either from a completed dataset or untouched from the previous lock
+	if ctx.Err() != nil && txn == nil {
+		logf("[WARN] run interrupted; unfinished datasets keep their previous lock entries\n")
+	}
 
-			// Compute fingerprint after fetching
-			// This ensures we record the exact state of what we just fetched
-			var err error
-			fp, err = f.Fingerprint(ctx, source)
-			if err != nil {
-				lastErr = err
-				if len(sources) > 1 {
-					fmt.Printf("[WARN] %s: source %d/%d: fingerprint after fetch: %v (trying next source)\n", ds.ID, i+1, len(sources), err)
-				}
-				continue
-			}
+	// Keep .gitignore/.gitattributes in step with the configured targets
+	maybeSyncVCSFiles(cfg, cfgPath, opts)
 
-			// Source succeeded!
-			fetchSucceeded = true
-			break
+	// Have the transparency log witness new pins, unless the run was cut
+	// short or the indices couldn't be recorded; either way the next run
+	// submits whatever is still missing
+	if ctx.Err() == nil && !lockOpts.NoWriteLock {
+		if code := witnessPins(ctx, cfg, lk, opts.RunID); code > exit {
+			exit = code
 		}
+	}
 
-		// If all sources failed, handle the error
-		if !fetchSucceeded {
+	// Write updated lockfile back to disk
+	lk.Version = 1
+	lk.LastChecked = &now
+	if err := saveLock(lockPath, lk, lockOpts); err != nil {
+		logf("lock write error: %v\n", err)
+		if exit == 0 {
+			exit = 1
+		}
+	}
+
+	// Count the run toward the usage tally. Same rule as Check: a read-only
+	// run only writes an explicitly placed status file
+	st.usage().recordRun(rep.StartedAt, exit)
+	if !opts.NoWriteLock || opts.StatusFile != "" {
+		st.Version = 1
+		if err := writeStatus(statusPath, st); err != nil {
+			logf("[WARN] status write error: %v\n", err)
+		}
+	}
+	return exit, rep
+}
+
+// fetchDataset fetches one dataset from the first source that works.
+//
+// Like checkDataset it runs on a worker goroutine: item and si are private copies
+// of the dataset's lock entry (nil if there is none) and status item, and output
+// goes to the result.
+func fetchDataset(ctx context.Context, cfg *Config, ds Dataset, item *LockItem, si *StatusItem, now time.Time) *datasetResult {
+	res := newDatasetResult(ds.ID)
+	if item != nil {
+		res.report.OldFingerprint = item.RemoteFingerprint
+	}
+
+	// Get all sources for this dataset (supports both single and multiple sources)
+	sources := ds.GetSources()
+	retries := cfg.retryPolicyFor(ds)
+
+	// Try each source in order until one succeeds
+	res.printf("[FETCH] %s\n", ds.ID)
+	fetchSucceeded := false
+	var fp string
+	var lastErr error
+	var usedSource registry.Source
+	var raw string
+
+	saved := savedXattrs(ds, cfg) // before the fetch replaces the target
+	for i, source := range sources {
+		// Look up the handler for this source type
+		f, ok := registry.Get(source.Type)
+		if !ok {
+			lastErr = fmt.Errorf("unknown source.type=%q", source.Type)
 			if len(sources) > 1 {
-				fmt.Printf("[ERR ] %s: all %d sources failed, last error: %v\n", ds.ID, len(sources), lastErr)
-			} else {
-				fmt.Printf("[ERR ] %s: fetch: %v\n", ds.ID, lastErr)
+				res.printf("[WARN] %s: source %d/%d: %v (trying next source)\n", ds.ID, i+1, len(sources), lastErr)
 			}
-			fmt.Printf("[INFO] %s: source may be inaccessible - please verify the source configuration\n", ds.ID)
-			// Record the failure in the lock file
-			item := lk.Items[ds.ID]
-			if item == nil {
-				item = &LockItem{}
-				lk.Items[ds.ID] = item
+			continue
+		}
+
+		// Fetch the data from the source
+		start := time.Now()
+		fetched, cached := true, false
+		err := res.retry(ctx, retries, "fetch", func() (err error) {
+			raw, fetched, cached, err = fetchCached(ctx, f, source, ds, cfg, item)
+			return err
+		})
+		if err != nil {
+			lastErr = err
+			if len(sources) > 1 {
+				res.printf("[WARN] %s: source %d/%d: fetch: %v (trying next source)\n", ds.ID, i+1, len(sources), err)
 			}
-			item.InaccessibleAt = &now
-			item.InaccessibleError = lastErr.Error()
-			if exit == 0 {
-				exit = 1
+			continue
+		}
+		res.timeOp(opFetch, si, start, now)
+		res.noteFetch(ds, fetched, cached)
+		for _, err := range finishTarget(ctx, f, source, ds, cfg, saved) {
+			res.printf("[WARN] %s: %v\n", ds.ID, err)
+		}
+
+		// Compute fingerprint after fetching
+		// This ensures we record the exact state of what we just fetched
+		start = time.Now()
+		err = res.retry(ctx, retries, "fingerprint after fetch", func() (err error) {
+			fp, err = f.Fingerprint(ctx, source)
+			return err
+		})
+		if err != nil {
+			lastErr = err
+			if len(sources) > 1 {
+				res.printf("[WARN] %s: source %d/%d: fingerprint after fetch: %v (trying next source)\n", ds.ID, i+1, len(sources), err)
 			}
 			continue
 		}
 
-		// Compute local file hash and update lockfile
-		// Clear inaccessible status since fetch succeeded
-		h, _ := HashFile(ds.Target)
-		lk.Items[ds.ID] = &LockItem{LocalSHA256: h, RemoteFingerprint: fp, CheckedAt: &now, InaccessibleAt: nil, InaccessibleError: ""}
+		// Source succeeded!
+		res.timeOp(opFingerprint, si, start, now)
+		res.report.Source = firstNonEmpty(source.URL, source.Path)
+		fetchSucceeded = true
+		usedSource = source
+		break
 	}
 
-	// Write updated lockfile back to disk
-	lk.Version = 1
-	lk.LastChecked = &now
-	if err := writeLock(lockPath, lk); err != nil {
-		fmt.Printf("lock write error: %v\n", err)
-		if exit == 0 {
-			exit = 1
+	// If all sources failed, handle the error
+	if !fetchSucceeded {
+		if len(sources) > 1 {
+			res.printf("[ERR ] %s: all %d sources failed, last error: %v\n", ds.ID, len(sources), lastErr)
+		} else {
+			res.printf("[ERR ] %s: fetch: %v\n", ds.ID, lastErr)
+		}
+		res.printf("[INFO] %s: source may be inaccessible - please verify the source configuration\n", ds.ID)
+		res.fail(lastErr)
+		// Record the failure in the lock file, unless the run was interrupted
+		if !interrupted(lastErr) {
+			if item == nil {
+				item = &LockItem{}
+			}
+			item.InaccessibleAt = &now
+			item.InaccessibleError = lastErr.Error()
+			res.lock = item
 		}
+		res.exit = 1
+		return res
 	}
-	return exit
+
+	// Compute local file hash and update lockfile
+	// Clear inaccessible status since fetch succeeded
+	h, files, _ := HashPath(ds.Target)
+	res.storeInCache(cfg, ds, usedSource, fp, h)
+	res.lock = &LockItem{Target: ds.Target, LocalSHA256: h, RemoteFingerprint: fp, Size: fileSize(ds.Target), Files: files, Slice: sliceSpec(usedSource), RawSHA256: raw, Transform: ds.Transform, CheckedAt: &now, InaccessibleAt: nil, InaccessibleError: ""}
+	res.report.NewFingerprint = fp
+	res.setStatus("fetched")
+	return res
 }
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jprybylski/datum/internal/registry"
 )
@@ -302,3 +304,78 @@ datasets:
 		}
 	})
 }
+
+func TestCheckWithOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "opts_config.yaml")
+	targetFile := filepath.Join(tmpDir, "opts_target.txt")
+	configContent := `version: 1
+datasets:
+  - id: opts
+    source:
+      type: mock
+    target: ` + targetFile + `
+    policy: update
+`
+	os.WriteFile(configPath, []byte(configContent), 0o644)
+
+	t.Run("lock-out redirects the lockfile", func(t *testing.T) {
+		lockPath := filepath.Join(tmpDir, "in.lock.yaml")
+		outPath := filepath.Join(tmpDir, "out.lock.yaml")
+
+		code := CheckWithOptions(configPath, lockPath, Options{LockOut: outPath})
+		if code != 0 {
+			t.Errorf("CheckWithOptions() = %d, want 0", code)
+		}
+		if fileExists(lockPath) {
+			t.Error("lockPath should not be written when LockOut is set")
+		}
+		lk, err := readLock(outPath)
+		if err != nil {
+			t.Fatalf("readLock() error = %v", err)
+		}
+		if lk.Items["opts"] == nil || lk.Items["opts"].RemoteFingerprint != "mock-fp" {
+			t.Errorf("redirected lock missing updated entry: %+v", lk.Items["opts"])
+		}
+	})
+
+	t.Run("no-write-lock leaves lockfile untouched", func(t *testing.T) {
+		lockPath := filepath.Join(tmpDir, "ro.lock.yaml")
+
+		code := CheckWithOptions(configPath, lockPath, Options{NoWriteLock: true})
+		if code != 0 {
+			t.Errorf("CheckWithOptions() = %d, want 0", code)
+		}
+		if fileExists(lockPath) {
+			t.Error("lockfile should not be written with NoWriteLock")
+		}
+	})
+	t.Run("check_writes_lock", func(t *testing.T) {
+		for _, mode := range []string{"changed", "never"} {
+			cfgPath := filepath.Join(tmpDir, mode+".yaml")
+			lockPath := filepath.Join(tmpDir, mode+".lock.yaml")
+			content := strings.Replace(configContent, "datasets:", "defaults:\n  check_writes_lock: "+mode+"\ndatasets:", 1)
+			if err := os.WriteFile(cfgPath, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if code := CheckWithOptions(cfgPath, lockPath, Options{}); code != 0 {
+				t.Fatalf("%s: CheckWithOptions() = %d, want 0", mode, code)
+			}
+			if got := fileExists(lockPath); got != (mode == "changed") {
+				t.Errorf("%s: lockfile written = %v on the first check", mode, got)
+			}
+			if mode == "never" {
+				continue
+			}
+			// A second check only re-confirms the pin, which changed mode doesn't write
+			before, _ := os.ReadFile(lockPath)
+			time.Sleep(10 * time.Millisecond)
+			if code := CheckWithOptions(cfgPath, lockPath, Options{}); code != 0 {
+				t.Fatalf("%s: second CheckWithOptions() = %d, want 0", mode, code)
+			}
+			if after, _ := os.ReadFile(lockPath); string(after) != string(before) {
+				t.Errorf("%s: lockfile rewritten though no pin changed:\n%s\n->\n%s", mode, before, after)
+			}
+		}
+	})
+}
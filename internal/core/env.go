@@ -0,0 +1,98 @@
+package core
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// envName is what a variable in an env map may be called: a portable
+// environment variable name.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envRef matches an {{env.NAME}} placeholder.
+var envRef = regexp.MustCompile(`\{\{env\.([^{}]*)\}\}`)
+
+// applyEnv gives every source the variables of defaults.env and its dataset's
+// env (the dataset's win), and expands {{env.NAME}} in the source's fields.
+//
+//	defaults:
+//	  env:
+//	    REGION: us-east-1
+//	datasets:
+//	  - id: export
+//	    env:
+//	      EXPORT_FORMAT: parquet
+//	    source:
+//	      type: command
+//	      fetch_cmd: ./export.sh --region {{env.REGION}} > {{dest}}
+//
+// The command handler exports the variables to fetch_cmd and fingerprint_cmd,
+// so scripts see the same values on every machine instead of whatever the CI
+// runner happens to set. Values are taken literally; a placeholder naming a
+// variable that isn't in the map is a config error.
+//
+// Go learning note: maps.Clone and maps.Copy (Go 1.21) replace the usual
+// hand-written loops for copying one map into another.
+func applyEnv(c *Config) error {
+	if err := validateEnv(c.Defaults.Env); err != nil {
+		return fmt.Errorf("defaults.env: %w", err)
+	}
+	for i := range c.Datasets {
+		ds := &c.Datasets[i]
+		if err := validateEnv(ds.Env); err != nil {
+			return fmt.Errorf("dataset %d (%s): env: %w", i, ds.ID, err)
+		}
+		env := maps.Clone(c.Defaults.Env)
+		if env == nil {
+			env = ds.Env
+		} else {
+			maps.Copy(env, ds.Env)
+		}
+
+		if ds.Source.Type != "" {
+			if err := expandEnv(&ds.Source, env); err != nil {
+				return fmt.Errorf("dataset %d (%s): %w", i, ds.ID, err)
+			}
+		}
+		for j := range ds.Sources {
+			if err := expandEnv(&ds.Sources[j], env); err != nil {
+				return fmt.Errorf("dataset %d (%s): %w", i, ds.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateEnv checks the variable names of an env map.
+func validateEnv(env map[string]string) error {
+	for name := range env {
+		if !envName.MatchString(name) {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+	}
+	return nil
+}
+
+// expandEnv replaces {{env.NAME}} in the source's fields with env's values
+// and attaches env to the source for its handler.
+func expandEnv(src *registry.Source, env map[string]string) error {
+	var missing string
+	for _, field := range sourceTemplateFields(src) {
+		*field = envRef.ReplaceAllStringFunc(*field, func(ref string) string {
+			name := envRef.FindStringSubmatch(ref)[1]
+			v, ok := env[name]
+			if !ok && missing == "" {
+				missing = ref
+			}
+			return v
+		})
+	}
+	if missing != "" {
+		return fmt.Errorf("%s: the variable isn't set in env", missing)
+	}
+	src.Env = env
+	return nil
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnv(t *testing.T) {
+	dir := t.TempDir()
+	write := func(body string) string {
+		path := filepath.Join(dir, "config.yaml")
+		os.WriteFile(path, []byte(body), 0o644)
+		return path
+	}
+
+	cfg, err := readConfig(write(`version: 1
+defaults:
+  env:
+    REGION: us-east-1
+    FORMAT: csv
+datasets:
+  - id: export
+    env:
+      FORMAT: parquet
+    source:
+      type: mock
+      url: https://example.com/{{env.REGION}}/data.{{env.FORMAT}}
+    target: export.parquet
+  - id: plain
+    sources:
+      - type: mock
+        url: https://example.com/{{env.REGION}}.csv
+    target: plain.csv
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	export, plain := cfg.Datasets[0], cfg.Datasets[1]
+	if export.Source.URL != "https://example.com/us-east-1/data.parquet" {
+		t.Errorf("url = %q, want the dataset's FORMAT over the default", export.Source.URL)
+	}
+	if env := export.Source.Env; env["REGION"] != "us-east-1" || env["FORMAT"] != "parquet" {
+		t.Errorf("export env = %v", env)
+	}
+	if plain.Sources[0].URL != "https://example.com/us-east-1.csv" || plain.Sources[0].Env["FORMAT"] != "csv" {
+		t.Errorf("plain source = %+v", plain.Sources[0])
+	}
+	if cfg.Defaults.Env["FORMAT"] != "csv" {
+		t.Errorf("defaults.env was modified: %v", cfg.Defaults.Env)
+	}
+
+	for name, tc := range map[string]struct{ body, want string }{
+		"unset variable": {`  - id: a
+    source: {type: mock, url: "https://example.com/{{env.NOPE}}"}
+    target: a.csv`, "{{env.NOPE}}"},
+		"bad name": {`  - id: a
+    env: {"MY-VAR": x}
+    source: {type: mock}
+    target: a.csv`, "MY-VAR"},
+	} {
+		_, err := readConfig(write("version: 1\ndatasets:\n" + tc.body + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error = %v, want it to mention %s", name, err, tc.want)
+		}
+	}
+}
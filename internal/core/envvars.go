@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// envVarRef matches ${NAME} and ${NAME:-default}, and the escaped form $${...}.
+var envVarRef = regexp.MustCompile(`\$(\$?)\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// expandEnvVars replaces ${NAME} and ${NAME:-default} in every dataset's
+// target and source fields (url, path, ref, member and the commands) with
+// environment variables, so one config can serve environments whose buckets
+// and hosts differ:
+//
+//	source:
+//	  type: http
+//	  url: https://${DATA_HOST:-data.example.org}/exports/${BUCKET}/sales.csv
+//	target: ${DATA_DIR:-data}/sales.csv
+//
+// A variable is looked up in the dataset's env, then defaults.env, then the
+// process environment. The default applies when the variable is unset or
+// empty, as in the shell. Every variable without a default that isn't set
+// is listed in one error, so a new environment can be fixed in one go.
+//
+// Commands are expanded too, which means a ${...} meant for the shell itself
+// (a loop variable, say) must be written $${...}; plain $NAME is left alone.
+//
+// Go learning note: regexp's ReplaceAllStringFunc hands each match to a
+// function, which is how the lookup and the missing-variable bookkeeping
+// happen in a single pass over each field.
+func expandEnvVars(c *Config) error {
+	missing := map[string]bool{}
+	for i := range c.Datasets {
+		ds := &c.Datasets[i]
+		lookup := func(name string) (string, bool) {
+			if v, ok := ds.Env[name]; ok {
+				return v, true
+			}
+			if v, ok := c.Defaults.Env[name]; ok {
+				return v, true
+			}
+			return os.LookupEnv(name)
+		}
+
+		fields := []*string{&ds.Target}
+		if ds.Source.Type != "" {
+			fields = append(fields, sourceTemplateFields(&ds.Source)...)
+		}
+		for j := range ds.Sources {
+			fields = append(fields, sourceTemplateFields(&ds.Sources[j])...)
+		}
+		for _, field := range fields {
+			*field = envVarRef.ReplaceAllStringFunc(*field, func(ref string) string {
+				m := envVarRef.FindStringSubmatch(ref)
+				escaped, name, def := m[1] != "", m[2], m[3]
+				if escaped {
+					return ref[1:]
+				}
+				v, ok := lookup(name)
+				if def != "" && v == "" {
+					return strings.TrimPrefix(def, ":-")
+				}
+				if !ok {
+					missing[name] = true
+				}
+				return v
+			})
+		}
+	}
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return fmt.Errorf("missing environment variables: %s (set them, or write ${NAME:-default})", strings.Join(names, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnvVars(t *testing.T) {
+	dir := t.TempDir()
+	write := func(body string) string {
+		path := filepath.Join(dir, "config.yaml")
+		os.WriteFile(path, []byte(body), 0o644)
+		return path
+	}
+	t.Setenv("DATUM_TEST_BUCKET", "prod-exports")
+	t.Setenv("DATUM_TEST_EMPTY", "")
+
+	cfg, err := readConfig(write(`version: 1
+defaults:
+  env:
+    REGION: eu-west-1
+datasets:
+  - id: sales
+    env:
+      REGION: us-east-1
+    sources:
+      - type: mock
+        url: https://${DATUM_TEST_HOST:-data.example.org}/${DATUM_TEST_BUCKET}/${REGION}/sales.csv
+      - type: mock
+        fetch_cmd: for f in a b; do echo $${f} $HOME; done > ${DATUM_TEST_EMPTY:-out}.csv
+    target: ${DATUM_TEST_DIR:-data}/sales.csv
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := cfg.Datasets[0]
+	if got := ds.Sources[0].URL; got != "https://data.example.org/prod-exports/us-east-1/sales.csv" {
+		t.Errorf("url = %q", got)
+	}
+	if got := ds.Sources[1].FetchCmd; got != "for f in a b; do echo ${f} $HOME; done > out.csv" {
+		t.Errorf("fetch_cmd = %q", got)
+	}
+	if ds.Target != "data/sales.csv" {
+		t.Errorf("target = %q", ds.Target)
+	}
+
+	_, err = readConfig(write(`version: 1
+datasets:
+  - id: a
+    source: {type: mock, url: "https://${DATUM_TEST_NO_HOST}/a"}
+    target: ${DATUM_TEST_NO_DIR}/a.csv
+  - id: b
+    source: {type: mock, url: "https://${DATUM_TEST_NO_HOST}/b"}
+    target: ${DATUM_TEST_EMPTY}b.csv
+`))
+	if err == nil || !strings.Contains(err.Error(), "missing environment variables: DATUM_TEST_NO_DIR, DATUM_TEST_NO_HOST (") {
+		t.Errorf("error = %v, want both missing variables listed once", err)
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Exception temporarily relaxes a dataset's fail policy, from the config's
+// exceptions block:
+//
+//	exceptions:
+//	  - dataset: census
+//	    expires: 2026-11-01
+//	    reason: upstream republishing after the 2026-10 incident (INC-2291)
+//
+// Until it expires, a change that would fail the check is reported as a
+// warning instead, like the log policy does, and the exception is named in
+// the output and the JSON report. From the expiry date on (UTC) the dataset
+// fails again without anyone having to remember to undo anything, and the
+// config's history shows who allowed what, why and for how long.
+type Exception struct {
+	Dataset string `yaml:"dataset" json:"dataset"`
+	Expires string `yaml:"expires" json:"expires"` // YYYY-MM-DD or an RFC 3339 time
+	Reason  string `yaml:"reason" json:"reason"`
+}
+
+// expiry returns when the exception stops applying.
+func (e Exception) expiry() (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, e.Expires); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, e.Expires)
+}
+
+// validateExceptions checks that every exception names a configured dataset,
+// ends on a valid date, and says why it exists. Expired exceptions are fine:
+// they just no longer apply.
+func validateExceptions(c *Config) error {
+	for i, e := range c.Exceptions {
+		if !slices.ContainsFunc(c.Datasets, func(ds Dataset) bool { return ds.ID == e.Dataset }) {
+			return fmt.Errorf("exceptions[%d]: unknown dataset %q", i, e.Dataset)
+		}
+		if e.Expires == "" {
+			return fmt.Errorf("exceptions[%d] (%s): expires is required", i, e.Dataset)
+		}
+		if _, err := e.expiry(); err != nil {
+			return fmt.Errorf("exceptions[%d] (%s): expires %q: want a date like 2026-11-01", i, e.Dataset, e.Expires)
+		}
+		if e.Reason == "" {
+			return fmt.Errorf("exceptions[%d] (%s): reason is required", i, e.Dataset)
+		}
+	}
+	return nil
+}
+
+// exceptionFor returns the exception for dataset id that runs longest, and
+// whether it still applies at now. It returns nil if the dataset has none.
+func (c *Config) exceptionFor(id string, now time.Time) (exc *Exception, active bool) {
+	var until time.Time
+	for i, e := range c.Exceptions {
+		t, err := e.expiry()
+		if e.Dataset != id || err != nil {
+			continue
+		}
+		if exc == nil || t.After(until) {
+			exc, until = &c.Exceptions[i], t
+		}
+	}
+	return exc, exc != nil && now.Before(until)
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExceptionFor(t *testing.T) {
+	cfg := &Config{Exceptions: []Exception{
+		{Dataset: "a", Expires: "2026-11-01", Reason: "incident"},
+		{Dataset: "a", Expires: "2026-10-20", Reason: "older"},
+		{Dataset: "b", Expires: "2026-10-01T12:00:00Z", Reason: "done"},
+	}}
+	day := func(s string) time.Time { t, _ := time.Parse(time.DateOnly, s); return t }
+
+	if exc, active := cfg.exceptionFor("a", day("2026-10-25")); !active || exc.Reason != "incident" {
+		t.Errorf("a on 2026-10-25 = %v, %v; want the longest exception, active", exc, active)
+	}
+	if exc, active := cfg.exceptionFor("a", day("2026-11-01")); active || exc == nil {
+		t.Errorf("a on its expiry date = %v, %v; want expired", exc, active)
+	}
+	if _, active := cfg.exceptionFor("b", day("2026-10-02")); active {
+		t.Error("b is active after its expiry time")
+	}
+	if exc, _ := cfg.exceptionFor("c", day("2026-10-02")); exc != nil {
+		t.Errorf("c has exception %v", exc)
+	}
+}
+
+func TestCheckException(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+	write := func(exceptions string) {
+		config := "version: 1\ndefaults:\n  policy: fail\ndatasets:\n  - id: x\n    source:\n      type: mock\n    target: " +
+			filepath.Join(tmpDir, "x.txt") + "\n" + exceptions
+		os.WriteFile(configPath, []byte(config), 0o644)
+	}
+	// A lock entry whose fingerprint the mock source no longer matches
+	os.WriteFile(lockPath, []byte("version: 1\nitems:\n  x:\n    remote_fingerprint: old-fp\n"), 0o644)
+
+	write("exceptions:\n  - dataset: x\n    expires: 2999-01-01\n    reason: upstream incident\n")
+	var buf strings.Builder
+	if code := CheckWithOptions(configPath, lockPath, Options{Report: &buf}); code != 0 {
+		t.Errorf("check with an active exception = %d, want 0", code)
+	}
+	if !strings.Contains(buf.String(), `"reason": "upstream incident"`) || !strings.Contains(buf.String(), `"status": "stale"`) {
+		t.Errorf("report doesn't record the exception:\n%s", buf.String())
+	}
+
+	write("exceptions:\n  - dataset: x\n    expires: 2000-01-01\n    reason: upstream incident\n")
+	if code := Check(configPath, lockPath); code != 1 {
+		t.Errorf("check with an expired exception = %d, want 1", code)
+	}
+
+	for exceptions, want := range map[string]string{
+		"exceptions:\n  - {dataset: y, expires: 2999-01-01, reason: r}\n": `unknown dataset "y"`,
+		"exceptions:\n  - {dataset: x, expires: soon, reason: r}\n":       "want a date",
+		"exceptions:\n  - {dataset: x, expires: 2999-01-01}\n":            "reason is required",
+	} {
+		write(exceptions)
+		if _, err := readConfig(configPath); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: error = %v, want %q", exceptions, err, want)
+		}
+	}
+}
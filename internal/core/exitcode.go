@@ -0,0 +1,62 @@
+package core
+
+import "fmt"
+
+// Exit-code policy: by default each dataset's policy decides whether it fails
+// the run (fail trips on upstream changes, log and update don't), and any
+// error does. Configs that mix critical data with datasets kept only for
+// monitoring need more say than that:
+//
+//   - --fail-on stale: any dataset that changed upstream or locally fails the
+//     run, whatever its policy, and so does any error
+//   - --fail-on error: only errors fail the run; changes are reported only
+//   - --fail-on never: nothing a dataset does fails the run
+//
+// and a dataset with severity: warn never fails the run at all, so a flaky
+// monitoring-only source can't break the build. Configuration errors exit 2
+// regardless, and so does anything else that stops the run before datasets
+// are processed; a lockfile that can't be written still exits 1.
+
+// failOnModes are the accepted --fail-on values; "" keeps each dataset's policy.
+var failOnModes = map[string]bool{"": true, "stale": true, "error": true, "never": true}
+
+// ValidateFailOn checks a --fail-on value.
+func ValidateFailOn(mode string) error {
+	if !failOnModes[mode] {
+		return fmt.Errorf("--fail-on: unknown value %q (want stale, error or never)", mode)
+	}
+	return nil
+}
+
+// validateSeverity checks a dataset's severity.
+func validateSeverity(severity string) error {
+	switch severity {
+	case "", "error", "warn":
+		return nil
+	}
+	return fmt.Errorf("severity: unknown value %q (want warn or error)", severity)
+}
+
+// datasetExit is the exit code a dataset's result adds to the run, given
+// its severity and the --fail-on mode. code is what its policy decided and
+// status its report's status.
+func datasetExit(ds Dataset, status string, code int, failOn string) int {
+	if ds.Severity == "warn" {
+		return 0
+	}
+	errored := status == "error" || status == "interrupted"
+	switch failOn {
+	case "never":
+		return 0
+	case "error":
+		if errored {
+			return max(code, 1)
+		}
+		return 0
+	case "stale":
+		if errored || status == "stale" || status == "changed" || status == "modified" {
+			return max(code, 1)
+		}
+	}
+	return code
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDatasetExit(t *testing.T) {
+	tests := []struct {
+		severity, status string
+		code             int
+		failOn           string
+		want             int
+	}{
+		{"", "changed", 1, "", 1},
+		{"", "stale", 0, "", 0},
+		{"", "error", 1, "", 1},
+		{"warn", "changed", 1, "", 0},
+		{"warn", "error", 1, "stale", 0},
+		{"error", "stale", 0, "stale", 1},
+		{"", "modified", 0, "stale", 1},
+		{"", "ok", 0, "stale", 0},
+		{"", "changed", 1, "error", 0},
+		{"", "error", 1, "error", 1},
+		{"", "interrupted", 1, "error", 1},
+		{"", "error", 1, "never", 0},
+	}
+	for _, tt := range tests {
+		ds := Dataset{ID: "x", Severity: tt.severity}
+		if got := datasetExit(ds, tt.status, tt.code, tt.failOn); got != tt.want {
+			t.Errorf("datasetExit(severity %q, %s, %d, --fail-on %q) = %d, want %d", tt.severity, tt.status, tt.code, tt.failOn, got, tt.want)
+		}
+	}
+	if err := ValidateFailOn("sometimes"); err == nil {
+		t.Error("ValidateFailOn(sometimes) succeeded")
+	}
+}
+
+func TestCheckWithOptions_Severity(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "source.csv")
+	os.WriteFile(src, []byte("a\n"), 0o644)
+	cfgPath := filepath.Join(dir, "config.yaml")
+	lockPath := filepath.Join(dir, "lock.yaml")
+	writeConfig := func(severity string) {
+		os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: monitor
+    severity: `+severity+`
+    source:
+      type: mockpath
+      path: `+src+`
+    target: `+filepath.Join(dir, "monitor.csv")+`
+`), 0o644)
+	}
+	writeConfig("warn")
+	if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+		t.Fatalf("Fetch() = %d, want 0", code)
+	}
+	os.WriteFile(src, []byte("b\n"), 0o644)
+
+	if code := CheckWithOptions(cfgPath, lockPath, Options{NoWriteLock: true}); code != 0 {
+		t.Errorf("Check() of a changed warn dataset = %d, want 0", code)
+	}
+	writeConfig("error")
+	if code := CheckWithOptions(cfgPath, lockPath, Options{NoWriteLock: true}); code != 1 {
+		t.Errorf("Check() of a changed error dataset = %d, want 1", code)
+	}
+	if code := CheckWithOptions(cfgPath, lockPath, Options{NoWriteLock: true, FailOn: "error"}); code != 0 {
+		t.Errorf("Check(--fail-on error) of a changed dataset = %d, want 0", code)
+	}
+	writeConfig("loud")
+	if code := Check(cfgPath, lockPath); code != 2 {
+		t.Errorf("Check() with severity: loud = %d, want 2", code)
+	}
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// exportFormats maps each supported --format value to its writer.
+var exportFormats = map[string]func(w io.Writer, entries []exportEntry) error{
+	"sha256sums": writeSHA256Sums,
+}
+
+// exportEntry is one pinned target as recorded in the lockfile.
+type exportEntry struct {
+	ID     string
+	Target string
+	SHA256 string
+}
+
+// Export writes the lockfile's pinned target hashes in a tool-neutral format.
+//
+// The "sha256sums" format matches the output of GNU sha256sum, so downstream
+// consumers can verify data with `sha256sum -c SHA256SUMS` without installing
+// datum. Paths are written exactly as configured in each dataset's target
+// (with forward slashes), so the file should be checked from the directory
+// datum normally runs in.
+//
+// The lock pins a directory target by its tree hash (see HashTree), which
+// sha256sum can't check, so a directory is exported as one line per file in
+// it, hashed from disk - but only when the directory still matches its
+// pinned tree hash; otherwise it's skipped with a warning.
+//
+// Parameters:
+//   - cfgPath: Path to the configuration file (.data.yaml)
+//   - lockPath: Path to the lockfile (.data.lock.yaml)
+//   - format: Output format (currently only "sha256sums")
+//   - out: Output file path, or "-" for stdout
+//
+// Returns:
+//   - 0: Every dataset was exported
+//   - 1: One or more datasets had no pinned hash, or a directory no longer
+//     matches its own (the rest are still written)
+//   - 2: Configuration error, unknown format, or the output couldn't be written
+func Export(cfgPath, lockPath, format, out string) int {
+	write, ok := exportFormats[format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "export: unknown format %q\n", format)
+		return 2
+	}
+
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		return 2
+	}
+	lk, err := readLock(lockPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lock error: %v\n", err)
+		return 2
+	}
+
+	exit := 0
+	var entries []exportEntry
+	for _, ds := range cfg.Datasets {
+		item := lk.Items[ds.ID]
+		if item == nil || item.LocalSHA256 == "" {
+			fmt.Fprintf(os.Stderr, "[WARN] %s: no local_sha256 in lockfile, skipping\n", ds.ID)
+			exit = 1
+			continue
+		}
+		if item.Files > 0 {
+			files, err := exportDir(ds.ID, ds.Target, item.LocalSHA256)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[WARN] %s: %v, skipping\n", ds.ID, err)
+				exit = 1
+				continue
+			}
+			entries = append(entries, files...)
+			continue
+		}
+		entries = append(entries, exportEntry{ID: ds.ID, Target: filepath.ToSlash(ds.Target), SHA256: item.LocalSHA256})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Target < entries[j].Target })
+
+	var buf bytes.Buffer
+	if err := write(&buf, entries); err != nil {
+		fmt.Fprintf(os.Stderr, "export error: %v\n", err)
+		return 2
+	}
+
+	if out == "-" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = os.WriteFile(out, buf.Bytes(), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export error: %v\n", err)
+		return 2
+	}
+	if out != "-" {
+		logf("wrote %d entries to %s\n", len(entries), out)
+	}
+	return exit
+}
+
+// exportDir returns an entry for each regular file under the directory
+// target, after checking the directory against its pinned tree hash.
+// Symlinks are left out: sha256sum would follow them, HashTree doesn't.
+func exportDir(id, target, pinned string) ([]exportEntry, error) {
+	tree, _, err := HashTree(target)
+	if err != nil {
+		return nil, fmt.Errorf("directory target: %w", err)
+	}
+	if tree != pinned {
+		return nil, fmt.Errorf("directory %s doesn't match its pinned tree hash (run datum verify)", target)
+	}
+	var entries []exportEntry
+	err = filepath.WalkDir(target, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		sum, err := HashFile(path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, exportEntry{ID: id, Target: filepath.ToSlash(path), SHA256: sum})
+		return nil
+	})
+	return entries, err
+}
+
+// writeSHA256Sums writes entries in GNU coreutils "sha256sum" text format.
+// As there, a name holding a backslash or line break is escaped, and its
+// line starts with a backslash so "sha256sum -c" knows to unescape it.
+func writeSHA256Sums(w io.Writer, entries []exportEntry) error {
+	for _, e := range entries {
+		name, prefix := e.Target, ""
+		if strings.ContainsAny(name, "\\\n\r") {
+			name, prefix = sumsEscaper.Replace(name), "\\"
+		}
+		if _, err := fmt.Fprintf(w, "%s%s  %s\n", prefix, e.SHA256, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sumsEscaper escapes a name the way sha256sum does.
+var sumsEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
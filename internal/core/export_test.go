@@ -0,0 +1,124 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	os.WriteFile(configPath, []byte(`version: 1
+datasets:
+  - id: b
+    source:
+      type: mock
+    target: data/b.csv
+  - id: a
+    source:
+      type: mock
+    target: data/a.csv
+`), 0o644)
+
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+	os.WriteFile(lockPath, []byte(`version: 1
+items:
+  a:
+    local_sha256: aaaa
+  b:
+    local_sha256: bbbb
+`), 0o644)
+
+	t.Run("sha256sums sorted by target", func(t *testing.T) {
+		out := filepath.Join(tmpDir, "SHA256SUMS")
+		if code := Export(configPath, lockPath, "sha256sums", out); code != 0 {
+			t.Fatalf("Export() = %d, want 0", code)
+		}
+		got, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		want := "aaaa  data/a.csv\nbbbb  data/b.csv\n"
+		if string(got) != want {
+			t.Errorf("Export() wrote %q, want %q", got, want)
+		}
+	})
+
+	t.Run("unpinned dataset returns 1", func(t *testing.T) {
+		partial := filepath.Join(tmpDir, "partial.yaml")
+		os.WriteFile(partial, []byte("version: 1\nitems:\n  a:\n    local_sha256: aaaa\n"), 0o644)
+		out := filepath.Join(tmpDir, "PARTIAL")
+
+		if code := Export(configPath, partial, "sha256sums", out); code != 1 {
+			t.Errorf("Export() = %d, want 1", code)
+		}
+		if got, _ := os.ReadFile(out); string(got) != "aaaa  data/a.csv\n" {
+			t.Errorf("Export() wrote %q, want only the pinned entry", got)
+		}
+	})
+
+	t.Run("directory target lists its files", func(t *testing.T) {
+		dir := filepath.Join(tmpDir, "images")
+		os.MkdirAll(filepath.Join(dir, "sub"), 0o755)
+		os.WriteFile(filepath.Join(dir, "cat.png"), []byte("cat"), 0o644)
+		os.WriteFile(filepath.Join(dir, "sub", "dog.png"), []byte("dog"), 0o644)
+		tree, _, err := HashTree(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dirConfig := filepath.Join(tmpDir, "dir.yaml")
+		os.WriteFile(dirConfig, []byte("version: 1\ndatasets:\n  - id: images\n    source:\n      type: mock\n    target: "+dir+"\n"), 0o644)
+		dirLock := filepath.Join(tmpDir, "dir.lock.yaml")
+		os.WriteFile(dirLock, []byte("version: 1\nitems:\n  images:\n    local_sha256: "+tree+"\n    files: 2\n"), 0o644)
+
+		out := filepath.Join(tmpDir, "DIRSUMS")
+		if code := Export(dirConfig, dirLock, "sha256sums", out); code != 0 {
+			t.Fatalf("Export() = %d, want 0", code)
+		}
+		catSum, _ := HashFile(filepath.Join(dir, "cat.png"))
+		dogSum, _ := HashFile(filepath.Join(dir, "sub", "dog.png"))
+		want := catSum + "  " + filepath.ToSlash(filepath.Join(dir, "cat.png")) + "\n" +
+			dogSum + "  " + filepath.ToSlash(filepath.Join(dir, "sub", "dog.png")) + "\n"
+		if got, _ := os.ReadFile(out); string(got) != want {
+			t.Errorf("Export() wrote %q, want %q", got, want)
+		}
+
+		// A directory that changed since it was pinned isn't vouched for
+		os.WriteFile(filepath.Join(dir, "cat.png"), []byte("not a cat"), 0o644)
+		if code := Export(dirConfig, dirLock, "sha256sums", out); code != 1 {
+			t.Errorf("Export() of a changed directory = %d, want 1", code)
+		}
+		if got, _ := os.ReadFile(out); len(got) != 0 {
+			t.Errorf("Export() of a changed directory wrote %q, want nothing", got)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		if code := Export(configPath, lockPath, "xml", filepath.Join(tmpDir, "x")); code != 2 {
+			t.Errorf("Export() = %d, want 2", code)
+		}
+	})
+}
+
+func TestWriteSHA256Sums_Escaping(t *testing.T) {
+	sum := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	var out bytes.Buffer
+	err := writeSHA256Sums(&out, []exportEntry{
+		{Target: "data/plain.csv", SHA256: sum},
+		{Target: "data/two\nlines.csv", SHA256: sum},
+		{Target: "data/back\\slash.csv", SHA256: sum},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As sha256sum writes them: escaped names get a leading backslash
+	want := sum + "  data/plain.csv\n" +
+		"\\" + sum + "  data/two\\nlines.csv\n" +
+		"\\" + sum + "  data/back\\\\slash.csv\n"
+	if out.String() != want {
+		t.Errorf("writeSHA256Sums() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
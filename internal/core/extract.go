@@ -0,0 +1,399 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// JSON extraction: many APIs wrap the data a project cares about in an
+// envelope (paging links, request IDs, timestamps) that changes on every
+// request. A source's extract setting keeps only the selected part, so the
+// target - and its local_sha256 - only change when the data does. The hash of
+// the full response is kept in the lock as raw_sha256, for provenance.
+//
+// Two path syntaxes are accepted, covering what people usually pass to jq or
+// JMESPath for this, without the rest of either language (filters, functions,
+// pipes):
+//
+//	jmespath: data.results   items[0]   items[-1].id   items[*].name   "odd key".x
+//	jq:       .data.results  .items[0]  .items[-1].id  .items[].name   .["odd key"].x
+//
+// They differ the way the real tools do: a JMESPath projection ([*]) collects
+// its results into one array, skipping nulls, and looking up a field of
+// something that isn't an object gives null; jq's [] produces each result on
+// its own, and indexing the wrong type of value is an error.
+
+// pathStep is one step of a parsed path expression.
+type pathStep struct {
+	kind  byte   // 'f' field, 'i' index, '*' every array element
+	field string // For 'f'
+	index int    // For 'i'; negative counts from the end
+}
+
+// jsonPath is a parsed extract expression.
+type jsonPath struct {
+	steps []pathStep
+	jq    bool // jq semantics rather than JMESPath
+}
+
+// validateExtract checks a source's extract setting.
+func validateExtract(src registry.Source) error {
+	if src.Extract == nil {
+		return nil
+	}
+	_, err := parseExtract(src.Extract)
+	return err
+}
+
+// parseExtract parses whichever expression e sets.
+func parseExtract(e *registry.Extract) (*jsonPath, error) {
+	switch {
+	case e.JMESPath != "" && e.JQ != "":
+		return nil, fmt.Errorf("extract: set jmespath or jq, not both")
+	case e.JMESPath != "":
+		steps, err := parseJMESPath(e.JMESPath)
+		if err != nil {
+			return nil, fmt.Errorf("extract.jmespath: %w", err)
+		}
+		return &jsonPath{steps: steps}, nil
+	case e.JQ != "":
+		steps, err := parseJQ(e.JQ)
+		if err != nil {
+			return nil, fmt.Errorf("extract.jq: %w", err)
+		}
+		return &jsonPath{steps: steps, jq: true}, nil
+	}
+	return nil, fmt.Errorf("extract: needs jmespath or jq")
+}
+
+// extractSpec describes e for the lock's slice field, e.g. "jq=.data".
+func extractSpec(e *registry.Extract) string {
+	if e.JQ != "" {
+		return "jq=" + e.JQ
+	}
+	return "jmespath=" + e.JMESPath
+}
+
+// pathLexer is a cursor over an expression, shared by both parsers.
+type pathLexer struct {
+	s   string
+	pos int
+}
+
+func (l *pathLexer) done() bool { return l.pos >= len(l.s) }
+func (l *pathLexer) peek() byte { return l.s[l.pos] }
+
+func (l *pathLexer) errorf(format string, args ...any) error {
+	return fmt.Errorf("at offset %d of %q: %s", l.pos, l.s, fmt.Sprintf(format, args...))
+}
+
+// identifier reads a bare field name: letters, digits and underscores, not
+// starting with a digit.
+func (l *pathLexer) identifier() (string, error) {
+	start := l.pos
+	for !l.done() {
+		c := l.peek()
+		if c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || l.pos > start && '0' <= c && c <= '9' {
+			l.pos++
+			continue
+		}
+		break
+	}
+	if l.pos == start {
+		return "", l.errorf("expected a field name")
+	}
+	return l.s[start:l.pos], nil
+}
+
+// quoted reads a JSON string literal, for field names that aren't identifiers.
+func (l *pathLexer) quoted() (string, error) {
+	end := l.pos + 1
+	for end < len(l.s) && l.s[end] != '"' {
+		if l.s[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(l.s) {
+		return "", l.errorf("unterminated string")
+	}
+	name, err := strconv.Unquote(l.s[l.pos : end+1])
+	if err != nil {
+		return "", l.errorf("bad string: %v", err)
+	}
+	l.pos = end + 1
+	return name, nil
+}
+
+// field reads a field name, bare or quoted.
+func (l *pathLexer) field() (pathStep, error) {
+	var name string
+	var err error
+	if !l.done() && l.peek() == '"' {
+		name, err = l.quoted()
+	} else {
+		name, err = l.identifier()
+	}
+	return pathStep{kind: 'f', field: name}, err
+}
+
+// bracket reads what follows a '[': an index, '*' (JMESPath) or nothing (jq),
+// or a quoted field name (jq), and the closing ']'.
+func (l *pathLexer) bracket(jq bool) (pathStep, error) {
+	l.pos++ // '['
+	end := strings.IndexByte(l.s[l.pos:], ']')
+	if jq && !l.done() && l.peek() == '"' {
+		step, err := l.field()
+		if err != nil {
+			return step, err
+		}
+		if l.done() || l.peek() != ']' {
+			return step, l.errorf("expected ]")
+		}
+		l.pos++
+		return step, nil
+	}
+	if end < 0 {
+		return pathStep{}, l.errorf("missing ]")
+	}
+	inner := strings.TrimSpace(l.s[l.pos : l.pos+end])
+	var step pathStep
+	switch {
+	case inner == "*" && !jq, inner == "" && jq:
+		step = pathStep{kind: '*'}
+	default:
+		n, err := strconv.Atoi(inner)
+		if err != nil {
+			iterate := "[*]"
+			if jq {
+				iterate = "[]"
+			}
+			return step, l.errorf("unsupported [%s] (only indexes and %s are)", inner, iterate)
+		}
+		step = pathStep{kind: 'i', index: n}
+	}
+	l.pos += end + 1
+	return step, nil
+}
+
+// parseJMESPath parses a JMESPath subexpression such as "data.items[*].id".
+func parseJMESPath(expr string) ([]pathStep, error) {
+	l := &pathLexer{s: strings.TrimSpace(expr)}
+	var steps []pathStep
+	for first := true; !l.done(); first = false {
+		var step pathStep
+		var err error
+		switch c := l.peek(); {
+		case c == '[':
+			step, err = l.bracket(false)
+		case c == '.' && !first:
+			l.pos++
+			step, err = l.field()
+		case first:
+			step, err = l.field()
+		default:
+			err = l.errorf("unexpected %q", c)
+		}
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// parseJQ parses a jq path such as ".data.items[].id". "." alone selects the
+// whole document, which still reformats it.
+func parseJQ(expr string) ([]pathStep, error) {
+	l := &pathLexer{s: strings.TrimSpace(expr)}
+	if l.done() || l.peek() != '.' {
+		return nil, l.errorf("a jq path starts with '.'")
+	}
+	var steps []pathStep
+	for !l.done() {
+		var step pathStep
+		var err error
+		switch c := l.peek(); c {
+		case '[':
+			step, err = l.bracket(true)
+		case '.':
+			l.pos++
+			if l.done() || l.peek() == '[' {
+				continue // ".", ".[0]"
+			}
+			step, err = l.field()
+		default:
+			err = l.errorf("unexpected %q", c)
+		}
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// jsonNull is how a missing value is written out.
+var jsonNull = json.RawMessage("null")
+
+// eval applies steps to v, returning the results: always one for JMESPath,
+// any number (one per element iterated) for jq.
+//
+// Go learning note: values stay json.RawMessage all the way through, and only
+// the containers on the path are decoded. Whatever is selected is written out
+// byte for byte (re-indented), so object keys keep their original order -
+// decoding into map[string]any would sort them.
+func (p *jsonPath) eval(v json.RawMessage, steps []pathStep) ([]json.RawMessage, error) {
+	if len(steps) == 0 {
+		return []json.RawMessage{v}, nil
+	}
+	step, rest := steps[0], steps[1:]
+	kind := jsonKind(v)
+	if kind == 'n' {
+		if p.jq && step.kind == '*' {
+			return nil, fmt.Errorf("cannot iterate over null")
+		}
+		return p.eval(jsonNull, rest) // Looking into null gives null, in both
+	}
+
+	switch step.kind {
+	case 'f':
+		if kind != '{' {
+			if p.jq {
+				return nil, fmt.Errorf("cannot index %s with %q", jsonKindName(kind), step.field)
+			}
+			return p.eval(jsonNull, rest)
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(v, &obj); err != nil {
+			return nil, err
+		}
+		field, ok := obj[step.field]
+		if !ok {
+			field = jsonNull
+		}
+		return p.eval(field, rest)
+
+	case 'i':
+		if kind != '[' {
+			if p.jq {
+				return nil, fmt.Errorf("cannot index %s with a number", jsonKindName(kind))
+			}
+			return p.eval(jsonNull, rest)
+		}
+		var arr []json.RawMessage
+		if err := json.Unmarshal(v, &arr); err != nil {
+			return nil, err
+		}
+		i := step.index
+		if i < 0 {
+			i += len(arr)
+		}
+		if i < 0 || i >= len(arr) {
+			return p.eval(jsonNull, rest)
+		}
+		return p.eval(arr[i], rest)
+
+	default: // '*'
+		if kind != '[' {
+			if p.jq {
+				return nil, fmt.Errorf("cannot iterate over %s", jsonKindName(kind))
+			}
+			return p.eval(jsonNull, rest)
+		}
+		var arr []json.RawMessage
+		if err := json.Unmarshal(v, &arr); err != nil {
+			return nil, err
+		}
+		var out []json.RawMessage
+		for _, elem := range arr {
+			results, err := p.eval(elem, rest)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, results...)
+		}
+		if p.jq {
+			return out, nil
+		}
+		// A JMESPath projection is one array, without the nulls
+		kept := []json.RawMessage{}
+		for _, r := range out {
+			if jsonKind(r) != 'n' {
+				kept = append(kept, r)
+			}
+		}
+		b, err := json.Marshal(kept)
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{b}, nil
+	}
+}
+
+// jsonKind returns a JSON value's first significant byte: '{', '[', '"', or
+// 'n' for null, 't'/'f' for booleans and a digit or '-' for numbers.
+func jsonKind(v json.RawMessage) byte {
+	v = bytes.TrimSpace(v)
+	if len(v) == 0 {
+		return 'n'
+	}
+	return v[0]
+}
+
+// jsonKindName names a jsonKind for messages.
+func jsonKindName(kind byte) string {
+	switch kind {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
+// extractJSON replaces the JSON document at path with the part e selects,
+// indented with two spaces. jq expressions that produce several values write
+// each on its own, like jq does.
+func extractJSON(path string, e *registry.Extract) error {
+	p, err := parseExtract(e)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(b) {
+		return fmt.Errorf("extract: response is not valid JSON")
+	}
+	results, err := p.eval(b, p.steps)
+	if err != nil {
+		return fmt.Errorf("extract: %w", err)
+	}
+
+	var out bytes.Buffer
+	for _, r := range results {
+		if err := json.Indent(&out, bytes.TrimSpace(r), "", "  "); err != nil {
+			return err
+		}
+		out.WriteByte('\n')
+	}
+	tmp := path + ".extract"
+	if err := os.WriteFile(tmp, out.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+const extractDoc = `{
+  "request_id": "abc123",
+  "data": {"results": [
+    {"name": "b", "id": 2, "tags": ["x"]},
+    {"name": "a", "id": 1},
+    {"id": 3}
+  ]},
+  "count": 3
+}`
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		e    registry.Extract
+		want string
+	}{
+		{"jmespath field", registry.Extract{JMESPath: "count"}, "3\n"},
+		{"jmespath nested, key order kept", registry.Extract{JMESPath: "data.results[1]"}, "{\n  \"name\": \"a\",\n  \"id\": 1\n}\n"},
+		{"jmespath negative index", registry.Extract{JMESPath: "data.results[-1].id"}, "3\n"},
+		{"jmespath projection skips nulls", registry.Extract{JMESPath: "data.results[*].name"}, "[\n  \"b\",\n  \"a\"\n]\n"},
+		{"jmespath nested projection", registry.Extract{JMESPath: "data.results[*].tags[*]"}, "[\n  [\n    \"x\"\n  ]\n]\n"},
+		{"jmespath missing is null", registry.Extract{JMESPath: "nope.deeper"}, "null\n"},
+		{"jmespath quoted key", registry.Extract{JMESPath: `"request_id"`}, "\"abc123\"\n"},
+		{"jq identity", registry.Extract{JQ: "."}, ""}, // Checked below
+		{"jq field", registry.Extract{JQ: ".data.results[0].id"}, "2\n"},
+		{"jq iterate", registry.Extract{JQ: ".data.results[].id"}, "2\n1\n3\n"},
+		{"jq bracketed key", registry.Extract{JQ: `.["data"].results[1].name`}, "\"a\"\n"},
+		{"jq missing is null", registry.Extract{JQ: ".data.results[0].missing"}, "null\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "resp.json")
+			os.WriteFile(path, []byte(extractDoc), 0o644)
+			if err := extractJSON(path, &tt.e); err != nil {
+				t.Fatal(err)
+			}
+			got := mustRead(t, path)
+			if tt.e.JQ == "." {
+				if !strings.HasPrefix(got, "{\n  \"request_id\": \"abc123\",\n  \"data\": {") {
+					t.Errorf("identity = %q, want the whole document reindented", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractJSON_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		e    registry.Extract
+		want string
+	}{
+		{"not json", "<html>", registry.Extract{JQ: ".data"}, "not valid JSON"},
+		{"jq indexes a string", extractDoc, registry.Extract{JQ: ".request_id.x"}, "cannot index string"},
+		{"jq iterates an object", extractDoc, registry.Extract{JQ: ".data[]"}, "cannot iterate over object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "resp.json")
+			os.WriteFile(path, []byte(tt.doc), 0o644)
+			if err := extractJSON(path, &tt.e); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	// JMESPath is forgiving where jq isn't
+	path := filepath.Join(t.TempDir(), "resp.json")
+	os.WriteFile(path, []byte(extractDoc), 0o644)
+	if err := extractJSON(path, &registry.Extract{JMESPath: "request_id.x"}); err != nil || mustRead(t, path) != "null\n" {
+		t.Errorf("jmespath field of a string: %v, %q; want null", err, mustRead(t, path))
+	}
+}
+
+func TestValidateExtract(t *testing.T) {
+	bad := map[string]registry.Extract{
+		"both":             {JMESPath: "a", JQ: ".a"},
+		"neither":          {},
+		"jq without dot":   {JQ: "data"},
+		"jmespath filter":  {JMESPath: "items[?id > 1]"},
+		"jq pipe":          {JQ: ".items | length"},
+		"unclosed bracket": {JMESPath: "items[0"},
+		"trailing dot":     {JMESPath: "data."},
+	}
+	for name, e := range bad {
+		if err := validateExtract(registry.Source{Extract: &e}); err == nil {
+			t.Errorf("%s: validateExtract(%+v) succeeded", name, e)
+		}
+	}
+	for _, e := range []registry.Extract{{JMESPath: "data.results[*].id"}, {JQ: ".data.results[].id"}, {JQ: "."}, {JQ: ".[0]"}} {
+		if err := validateExtract(registry.Source{Extract: &e}); err != nil {
+			t.Errorf("validateExtract(%+v) = %v", e, err)
+		}
+	}
+}
+
+func TestFetch_Extract(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "response.json")
+	os.WriteFile(src, []byte(extractDoc), 0o644)
+	target := filepath.Join(dir, "results.json")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: results
+    source:
+      type: mockpath
+      path: `+src+`
+      extract:
+        jq: .data.results
+    target: `+target+`
+`), 0o644)
+	lockPath := filepath.Join(dir, "lock.yaml")
+
+	if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+		t.Fatalf("Fetch() = %d, want 0", code)
+	}
+	if got := mustRead(t, target); !strings.HasPrefix(got, "[\n  {\n    \"name\": \"b\"") {
+		t.Errorf("target = %q, want just the results array", got)
+	}
+	lk, _ := readLock(lockPath)
+	item := lk.Items["results"]
+	raw, _ := HashFile(src)
+	local, _ := HashFile(target)
+	if item.RawSHA256 != raw || item.LocalSHA256 != local || item.Slice != "jq=.data.results" {
+		t.Errorf("lock entry = %+v; want raw_sha256 of the response, local_sha256 of the extract, and the expression", item)
+	}
+	if code := Check(cfgPath, lockPath); code != 0 {
+		t.Errorf("Check() = %d, want 0", code)
+	}
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// fingerprintSource computes src's fingerprint, using the status file as an HTTP cache.
+//
+// For handlers implementing registry.CacheAwareFetcher the caching metadata is
+// always recorded in si, the dataset's status item. When honorCache is set and
+// the recorded response for this same source is still fresh, the recorded
+// fingerprint is returned without contacting the source (fromCache = true).
+// Other handlers are simply asked for a fingerprint and si is left untouched.
+func fingerprintSource(ctx context.Context, f registry.Fetcher, src registry.Source, si *StatusItem, honorCache bool, now time.Time) (fp string, fromCache bool, err error) {
+	cf, ok := f.(registry.CacheAwareFetcher)
+	if !ok {
+		fp, err = f.Fingerprint(ctx, src)
+		return fp, false, err
+	}
+
+	if honorCache && si.CacheURL == src.URL && si.ObservedFingerprint != "" &&
+		si.FreshUntil != nil && now.Before(*si.FreshUntil) {
+		return si.ObservedFingerprint, true, nil
+	}
+
+	fp, info, err := cf.FingerprintCached(ctx, src)
+	if err != nil {
+		return "", false, err
+	}
+
+	si.CacheURL = src.URL
+	si.CacheControl = info.CacheControl
+	si.Expires = info.Expires
+	si.Age = info.Age
+	si.FreshUntil = nil
+	if !info.FreshUntil.IsZero() {
+		freshUntil := info.FreshUntil.UTC()
+		si.FreshUntil = &freshUntil
+	}
+	si.ObservedFingerprint = fp
+	si.ObservedAt = &now
+	return fp, false, nil
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// mockCachedHandler serves a fingerprint that stays fresh for an hour, counting calls
+type mockCachedHandler struct {
+	mockHandler
+	calls int
+}
+
+func (m *mockCachedHandler) Name() string { return "mockcached" }
+
+func (m *mockCachedHandler) FingerprintCached(ctx context.Context, src registry.Source) (string, registry.CacheInfo, error) {
+	m.calls++
+	return "cached-fp", registry.CacheInfo{
+		CacheControl: "max-age=3600",
+		FreshUntil:   time.Now().Add(time.Hour),
+	}, nil
+}
+
+func TestFingerprintSource(t *testing.T) {
+	ctx := context.Background()
+	h := &mockCachedHandler{}
+	src := registry.Source{Type: "mockcached", URL: "https://example.com/a.csv"}
+	si := &StatusItem{}
+	now := time.Now().UTC()
+
+	fp, fromCache, err := fingerprintSource(ctx, h, src, si, true, now)
+	if err != nil || fp != "cached-fp" || fromCache {
+		t.Fatalf("first call = %q, %v, %v; want cached-fp from the handler", fp, fromCache, err)
+	}
+	if si.CacheControl != "max-age=3600" || si.FreshUntil == nil || si.CacheURL != src.URL {
+		t.Fatalf("caching metadata not recorded: %+v", si)
+	}
+
+	t.Run("fresh response is reused", func(t *testing.T) {
+		fp, fromCache, err := fingerprintSource(ctx, h, src, si, true, now.Add(time.Minute))
+		if err != nil || fp != "cached-fp" || !fromCache {
+			t.Errorf("got %q, %v, %v; want cached-fp from cache", fp, fromCache, err)
+		}
+		if h.calls != 1 {
+			t.Errorf("handler called %d times, want 1", h.calls)
+		}
+	})
+
+	t.Run("cache ignored unless honored", func(t *testing.T) {
+		if _, fromCache, _ := fingerprintSource(ctx, h, src, si, false, now.Add(time.Minute)); fromCache {
+			t.Error("fromCache = true with honorCache off")
+		}
+	})
+
+	t.Run("stale response is refreshed", func(t *testing.T) {
+		if _, fromCache, _ := fingerprintSource(ctx, h, src, si, true, now.Add(2*time.Hour)); fromCache {
+			t.Error("fromCache = true after FreshUntil")
+		}
+	})
+
+	t.Run("changed URL is refreshed", func(t *testing.T) {
+		moved := src
+		moved.URL = "https://example.com/b.csv"
+		if _, fromCache, _ := fingerprintSource(ctx, h, moved, si, true, now.Add(time.Minute)); fromCache {
+			t.Error("fromCache = true for a different source URL")
+		}
+	})
+
+	t.Run("non-cache-aware handlers", func(t *testing.T) {
+		plain := &StatusItem{}
+		fp, fromCache, err := fingerprintSource(ctx, &mockHandler{}, registry.Source{Type: "mock"}, plain, true, now)
+		if err != nil || fp != "mock-fp" || fromCache {
+			t.Errorf("got %q, %v, %v; want mock-fp", fp, fromCache, err)
+		}
+		if *plain != (StatusItem{}) {
+			t.Errorf("status item modified for a handler without caching metadata: %+v", plain)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+)
+
+// GC removes leftovers that datum no longer needs.
+//
+// With tmp set, it removes the temp files and staging directories left behind
+// by runs that crashed or were killed mid-download (see
+// fsutil.CleanStaleTemps). check and fetch do the same quietly on startup;
+// GC lists what it removed.
+//
+// Returns:
+//   - 0: Success
+//   - 1: Something couldn't be removed
+//   - 2: Configuration error, or nothing to collect was selected
+func GC(cfgPath string, tmp bool) int {
+	if !tmp {
+		logln("gc: nothing selected (use --tmp)")
+		return 2
+	}
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	removed, errs := cleanStaleTemps(cfg)
+	for _, path := range removed {
+		logf("[DEL ] %s\n", path)
+	}
+	for _, err := range errs {
+		logf("[ERR ] %v\n", err)
+	}
+	logf("[INFO] removed %d stale temp file(s)\n", len(removed))
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// tempDirs returns every directory cfg's runs stage temp files in: the
+// directory of each target, plus tmp_dir and the scratch directory.
+func tempDirs(cfg *Config) []string {
+	seen := map[string]bool{}
+	for _, ds := range cfg.Datasets {
+		seen[filepath.Dir(ds.Target)] = true
+	}
+	for _, dir := range fsutil.StagingDirs() {
+		seen[dir] = true
+	}
+	dirs := make([]string, 0, len(seen))
+	for dir := range seen {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// cleanStaleTemps removes temp files left by crashed runs from all of cfg's
+// temp directories, carrying on past directories it can't clean.
+func cleanStaleTemps(cfg *Config) (removed []string, errs []error) {
+	for _, dir := range tempDirs(cfg) {
+		paths, err := fsutil.CleanStaleTemps(dir)
+		removed = append(removed, paths...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", dir, err))
+		}
+	}
+	return removed, errs
+}
+
+// cleanupOnStartup is cleanStaleTemps for check and fetch: one summary line
+// when something was removed, warnings for what couldn't be.
+func cleanupOnStartup(cfg *Config) {
+	removed, errs := cleanStaleTemps(cfg)
+	if len(removed) > 0 {
+		logf("[INFO] removed %d stale temp file(s) left by interrupted runs\n", len(removed))
+	}
+	for _, err := range errs {
+		logf("[WARN] temp cleanup: %v\n", err)
+	}
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGC(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: a
+    source: {type: mock}
+    target: `+filepath.Join(dir, "data", "a.csv")+`
+`), 0o644)
+
+	if code := GC(cfgPath, false); code != 2 {
+		t.Errorf("GC() without --tmp = %d, want 2", code)
+	}
+
+	// A temp file from a run that has since exited
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(dir, "data", fmt.Sprintf(".a.csv.datum-%d-42.tmp", cmd.Process.Pid))
+	os.MkdirAll(filepath.Dir(stale), 0o755)
+	os.WriteFile(stale, []byte("half"), 0o644)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(stale, old, old)
+
+	if code := GC(cfgPath, true); code != 0 {
+		t.Errorf("GC() = %d, want 0", code)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale temp file was not removed")
+	}
+
+	// fetch cleans up on startup too
+	os.WriteFile(stale, []byte("half"), 0o644)
+	os.Chtimes(stale, old, old)
+	if code := Fetch(cfgPath, filepath.Join(dir, "lock.yaml"), nil); code != 0 {
+		t.Errorf("Fetch() = %d, want 0", code)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("fetch did not remove the stale temp file")
+	}
+}
@@ -3,8 +3,13 @@ package core
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 )
 
 // HashFile computes the SHA256 hash of a file's contents.
@@ -47,6 +52,76 @@ func HashFile(path string) (string, error) {
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
+// HashTree computes a deterministic, merkle-style SHA256 hash of a directory
+// tree, and counts the regular files in it.
+//
+// Each directory is summarised as one line per entry, sorted by name:
+//
+//	file <sha256 of contents> <name>
+//	dir <tree hash of subdirectory> <name>
+//	link <sha256 of link target> <name>
+//
+// and its hash is the SHA256 of those lines. The root's hash therefore changes
+// whenever any file's contents, any name, or the shape of the tree changes, but
+// not with modification times, permissions or the order the filesystem lists
+// entries in - so the same tree hashes the same on every machine.
+//
+// Symlinks are hashed by where they point, never followed, so a link out of
+// the tree can't pull outside data into the hash (or loop forever). Other
+// special files (sockets, devices) are ignored.
+//
+// Go learning note: os.ReadDir already returns entries sorted by filename,
+// which is what makes the result independent of the underlying filesystem.
+func HashTree(dir string) (hash string, files int, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", 0, err
+	}
+	h := sha256.New()
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		switch {
+		case e.IsDir():
+			sub, n, err := HashTree(path)
+			if err != nil {
+				return "", 0, err
+			}
+			files += n
+			fmt.Fprintf(h, "dir %s %s\n", sub, e.Name())
+		case e.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return "", 0, err
+			}
+			sum := sha256.Sum256([]byte(filepath.ToSlash(target)))
+			fmt.Fprintf(h, "link %s %s\n", hex.EncodeToString(sum[:]), e.Name())
+		case e.Type().IsRegular():
+			sum, err := HashFile(path)
+			if err != nil {
+				return "", 0, err
+			}
+			files++
+			fmt.Fprintf(h, "file %s %s\n", sum, e.Name())
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), files, nil
+}
+
+// HashPath hashes a dataset's target, whichever kind it is: HashFile for a
+// file, HashTree for a directory. files is the number of files in a directory
+// tree, and 0 for a plain file.
+func HashPath(path string) (hash string, files int, err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", 0, err
+	}
+	if fi.IsDir() {
+		return HashTree(path)
+	}
+	hash, err = HashFile(path)
+	return hash, 0, err
+}
+
 // fileExists checks whether a file or directory exists at the given path.
 //
 // This is a simple utility function used throughout the codebase to verify
@@ -86,3 +161,27 @@ func firstNonEmpty(a, b string) string {
 	}
 	return b
 }
+
+// parseInterval parses a cadence such as "36h", "7d", or "2w".
+//
+// time.ParseDuration stops at hours, but re-verification cadences are naturally
+// expressed in days or weeks, so "d" and "w" suffixes are accepted as well
+// (a day is always 24h here - calendar and DST details don't matter for a cadence).
+func parseInterval(s string) (time.Duration, error) {
+	if n := len(s); n > 1 && (s[n-1] == 'd' || s[n-1] == 'w') {
+		count, err := strconv.ParseFloat(s[:n-1], 64)
+		if err != nil || count < 0 {
+			return 0, fmt.Errorf("invalid interval %q", s)
+		}
+		unit := 24 * time.Hour
+		if s[n-1] == 'w' {
+			unit *= 7
+		}
+		return time.Duration(count * float64(unit)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid interval %q", s)
+	}
+	return d, nil
+}
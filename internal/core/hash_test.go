@@ -3,6 +3,7 @@ package core
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -154,3 +155,124 @@ func TestFirstNonEmpty(t *testing.T) {
 		})
 	}
 }
+
+// writeTree creates files (path -> content) under dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHashTree(t *testing.T) {
+	files := map[string]string{"a.csv": "1,2\n", "sub/b.csv": "3,4\n", "sub/deeper/c.txt": "x"}
+	one, two := t.TempDir(), t.TempDir()
+	writeTree(t, one, files)
+	writeTree(t, two, files)
+	os.Chmod(filepath.Join(two, "a.csv"), 0o600) // Permissions don't count
+
+	h1, n1, err := HashTree(one)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, n2, _ := HashTree(two)
+	if h1 != h2 || n1 != 3 || n2 != 3 {
+		t.Errorf("identical trees: %s (%d files) vs %s (%d files)", h1, n1, h2, n2)
+	}
+	if len(h1) != 64 {
+		t.Errorf("hash %q is not hex sha256", h1)
+	}
+
+	changes := map[string]func(dir string){
+		"edited":  func(dir string) { os.WriteFile(filepath.Join(dir, "sub", "b.csv"), []byte("3,5\n"), 0o644) },
+		"renamed": func(dir string) { os.Rename(filepath.Join(dir, "a.csv"), filepath.Join(dir, "z.csv")) },
+		"moved":   func(dir string) { os.Rename(filepath.Join(dir, "a.csv"), filepath.Join(dir, "sub", "a.csv")) },
+		"added":   func(dir string) { os.Mkdir(filepath.Join(dir, "empty"), 0o755) },
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, files)
+			change(dir)
+			if h, _, _ := HashTree(dir); h == h1 {
+				t.Errorf("tree hash unchanged after the tree was %s", name)
+			}
+		})
+	}
+}
+
+func TestHashPath(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"f.txt": "hello", "d/g.txt": "world"})
+
+	h, n, err := HashPath(filepath.Join(dir, "f.txt"))
+	want, _ := HashFile(filepath.Join(dir, "f.txt"))
+	if err != nil || h != want || n != 0 {
+		t.Errorf("HashPath(file) = %s, %d, %v; want %s, 0", h, n, err, want)
+	}
+	h, n, err = HashPath(filepath.Join(dir, "d"))
+	want, _, _ = HashTree(filepath.Join(dir, "d"))
+	if err != nil || h != want || n != 1 {
+		t.Errorf("HashPath(dir) = %s, %d, %v; want %s, 1", h, n, err, want)
+	}
+	if _, _, err := HashPath(filepath.Join(dir, "missing")); err == nil {
+		t.Error("HashPath(missing) succeeded")
+	}
+}
+
+func TestFetch_DirectoryTarget(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "share")
+	writeTree(t, src, map[string]string{"2023.csv": "a\n", "2024.csv": "b\n", "notes/readme.txt": "hi"})
+	target := filepath.Join(dir, "data", "share")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: share
+    source:
+      type: mockpath
+      path: `+src+`
+    target: `+target+`
+`), 0o644)
+	lockPath := filepath.Join(dir, "lock.yaml")
+
+	if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+		t.Fatalf("Fetch() = %d, want 0", code)
+	}
+	if b, _ := os.ReadFile(filepath.Join(target, "notes", "readme.txt")); string(b) != "hi" {
+		t.Errorf("notes/readme.txt = %q, want the tree mirrored", b)
+	}
+	lk, _ := readLock(lockPath)
+	item := lk.Items["share"]
+	tree, _, _ := HashTree(src)
+	if item.LocalSHA256 != tree || item.Files != 3 || item.Size != 6 {
+		t.Errorf("lock entry = %+v; want tree hash %s, 3 files, 6 bytes", item, tree)
+	}
+	if code := Check(cfgPath, lockPath); code != 0 {
+		t.Errorf("Check() = %d, want 0", code)
+	}
+
+	// A file removed upstream shows up as a change, and a refetch drops it locally
+	os.Remove(filepath.Join(src, "2023.csv"))
+	if code := Check(cfgPath, lockPath); code != 1 {
+		t.Errorf("Check() after removing a source file = %d, want 1", code)
+	}
+	if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+		t.Fatalf("refetch = %d, want 0", code)
+	}
+	if _, err := os.Stat(filepath.Join(target, "2023.csv")); !os.IsNotExist(err) {
+		t.Errorf("2023.csv still in the target: %v", err)
+	}
+	if lk, _ := readLock(lockPath); lk.Items["share"].Files != 2 {
+		t.Errorf("files = %d after refetch, want 2", lk.Items["share"].Files)
+	}
+	if b, _ := os.ReadFile(lockPath); !strings.Contains(string(b), "files: 2") {
+		t.Errorf("lockfile doesn't record the file count:\n%s", b)
+	}
+}
@@ -0,0 +1,227 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Host allowlist: security.allowed_hosts in the config, and --allowed-hosts
+// on the command line, limit which hosts sources may point at. A config
+// naming any other host is refused when it's loaded, before anything is
+// fetched, so a pull request can't quietly aim a dataset at a server its
+// author controls. When both lists are set a host must be on
+// both: the config can narrow what CI allows, but not widen it. The http
+// handler also refuses redirects to hosts off the lists. The same goes for
+// discover blocks and notify webhooks, which datum sends requests to as well.
+//
+//	security:
+//	  allowed_hosts: [data.gov, "*.census.gov", github.com]
+
+// Security holds the config's security policy.
+type Security struct {
+	// AllowedHosts are the hosts sources may point at: a name, or
+	// "*.example.com" for any subdomain of example.com. Empty allows any.
+	AllowedHosts []string `yaml:"allowed_hosts,omitempty"`
+}
+
+// allowedHosts is the allowlist from --allowed-hosts, set once at startup
+// via AllowHosts. Empty allows any host.
+var allowedHosts []string
+
+// AllowHosts limits every config's sources to hosts matching patterns
+// (--allowed-hosts), on top of the config's own security.allowed_hosts.
+func AllowHosts(patterns []string) {
+	allowedHosts = patterns
+}
+
+// validateHostPatterns checks an allowlist's entries.
+func validateHostPatterns(patterns []string) error {
+	for _, p := range patterns {
+		name := strings.TrimPrefix(p, "*.")
+		if name == "" || strings.ContainsAny(name, "*/:@ ") {
+			return fmt.Errorf("invalid host %q (want a name like data.gov, or *.example.com for its subdomains)", p)
+		}
+	}
+	return nil
+}
+
+// hostPolicy returns the allowlists that apply to c's sources, or nil if
+// there are none.
+func (c *Config) hostPolicy() *registry.HostPolicy {
+	var p registry.HostPolicy
+	for _, list := range [][]string{allowedHosts, c.security().AllowedHosts} {
+		if len(list) > 0 {
+			p.Lists = append(p.Lists, list)
+		}
+	}
+	if len(p.Lists) == 0 {
+		return nil
+	}
+	return &p
+}
+
+// security returns c's security policy, empty if it has none.
+func (c *Config) security() Security {
+	if c.Security == nil {
+		return Security{}
+	}
+	return *c.Security
+}
+
+// checkAllowedHosts refuses sources, discover blocks and webhooks pointing
+// at hosts off the allowlists, naming the list that rejects each one, and
+// hands the sources the policy for checking redirects. A webhook read from
+// url_env is only known when it's sent, and is checked then.
+func checkAllowedHosts(c *Config) error {
+	if err := validateHostPatterns(allowedHosts); err != nil {
+		return fmt.Errorf("--allowed-hosts: %w", err)
+	}
+	if err := validateHostPatterns(c.security().AllowedHosts); err != nil {
+		return fmt.Errorf("security.allowed_hosts: %w", err)
+	}
+	policy := c.hostPolicy()
+	if policy == nil {
+		return nil
+	}
+	var errs []error
+	for i := range c.Datasets {
+		ds := &c.Datasets[i]
+		sources := []*registry.Source{&ds.Source}
+		for j := range ds.Sources {
+			sources = append(sources, &ds.Sources[j])
+		}
+		for _, src := range sources {
+			if src.Type == "" {
+				continue
+			}
+			hosts, err := sourceHosts(*src)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", datasetRef(i, *ds), err))
+			}
+			for _, host := range hosts {
+				if err := c.checkHost(host); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", datasetRef(i, *ds), err))
+				}
+			}
+			src.Hosts = policy
+		}
+		if ds.Discover != nil {
+			if err := c.checkURLHost(ds.Discover.URL); err != nil {
+				errs = append(errs, fmt.Errorf("%s: discover: %w", datasetRef(i, *ds), err))
+			}
+		}
+	}
+	for i, n := range c.Notify {
+		if n.URL == "" {
+			continue
+		}
+		if err := c.checkURLHost(n.URL); err != nil {
+			// The URL may carry a secret token, so the error names the entry
+			errs = append(errs, fmt.Errorf("notify[%d]: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkURLHost is checkHost for the host of the URL raw.
+func (c *Config) checkURLHost(raw string) error {
+	host := urlHost(raw)
+	if host == "" {
+		return errors.New("can't tell which host the url is on, so it can't be checked against the allowed hosts")
+	}
+	return c.checkHost(host)
+}
+
+// checkRedirectHost follows redirects, up to net/http's usual limit of 10,
+// to hosts the policy allows only.
+func checkRedirectHost(hosts *registry.HostPolicy) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !hosts.Allows(req.URL.Hostname()) {
+			return fmt.Errorf("redirected to %s, which isn't among the allowed hosts", req.URL.Hostname())
+		}
+		return nil
+	}
+}
+
+// checkHost reports which allowlist, if any, host is missing from.
+func (c *Config) checkHost(host string) error {
+	lists := []struct {
+		name     string
+		patterns []string
+	}{{"--allowed-hosts", allowedHosts}, {"security.allowed_hosts", c.security().AllowedHosts}}
+	for _, l := range lists {
+		if len(l.patterns) > 0 && !(&registry.HostPolicy{Lists: [][]string{l.patterns}}).Allows(host) {
+			return fmt.Errorf("host %s is not allowed by %s", host, l.name)
+		}
+	}
+	return nil
+}
+
+// sourceHosts returns the hosts src points at, for the source types the
+// allowlist covers; others (files, commands) have none. Torrents can't be
+// covered, and are refused, as are postgres URLs whose parameters name a
+// host of their own, which lib/pq connects to instead. Some hosts are only known when fetching: a dvc
+// source's remote usually comes from .dvc/config, a huggingface short form
+// goes to $HF_ENDPOINT, and a DOI leads to whichever repository holds it.
+// Those handlers check src.Hosts themselves, as the github-release handler
+// does for the API and the storage it redirects to.
+func sourceHosts(src registry.Source) ([]string, error) {
+	var urls []string
+	switch src.Type {
+	case "http":
+		urls = append([]string{src.URL}, src.Mirrors...)
+	case "git", "ftp", "sftp":
+		urls = []string{src.URL}
+	case "sql":
+		if u, err := url.Parse(src.URL); err == nil && (u.Query().Has("host") || u.Query().Has("hostaddr")) {
+			return nil, errors.New("sql: a host in the url's parameters can't be checked against the allowed hosts; put it in the url's host instead")
+		}
+		urls = []string{src.URL}
+	case "huggingface":
+		if !strings.Contains(src.URL, "://") {
+			return nil, nil
+		}
+		urls = []string{src.URL}
+	case "torrent":
+		return nil, errors.New("torrent sources download from whatever peers the swarm offers, so they can't be kept to allowed hosts")
+	default:
+		return nil, nil
+	}
+	var hosts []string
+	for _, raw := range urls {
+		host := urlHost(raw)
+		if host == "" {
+			return hosts, fmt.Errorf("can't tell which host %q is on, so it can't be checked against the allowed hosts", raw)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// urlHost returns the host of a URL, or of a git scp-style address
+// (git@github.com:org/repo.git), without the port; "" if there is none.
+func urlHost(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.Scheme != "" && u.Host != "" {
+		return strings.ToLower(u.Hostname())
+	}
+	if !strings.Contains(raw, "://") {
+		if addr, _, ok := strings.Cut(raw, ":"); ok {
+			_, host, _ := strings.Cut(addr, "@")
+			if host == "" {
+				host = addr
+			}
+			if host != "" && !strings.ContainsAny(host, "/\\") {
+				return strings.ToLower(host)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Includes: a large repository can split its datasets across files, e.g. one
+// per team, and list them in the top-level config:
+//
+//	version: 1
+//	include:
+//	  - teams/*.data.yaml
+//	datasets:
+//	  - ...
+//
+// Patterns are globs relative to the config's directory. Each included file
+// holds only a datasets list (and optionally version: 1); defaults, policies
+// and everything else come from the top-level config. The included datasets
+// are appended after the config's own, file by file in sorted order, before
+// anything else looks at them, so duplicate IDs and targets across files are
+// caught like any others (see datasetConflicts). Paths inside included
+// datasets mean the same as in the top-level config: targets are relative to
+// where datum runs, not to the included file.
+//
+// Commands that edit the config (bump, pin push, fix-urls) edit the file
+// each dataset came from.
+
+// includedConfig is what an included file may contain.
+type includedConfig struct {
+	Version  int       `yaml:"version,omitempty"`
+	Datasets []Dataset `yaml:"datasets"`
+}
+
+// includedFiles returns the files the patterns match, relative to cfgPath's
+// directory, sorted and without repeats. A pattern without wildcards must
+// match an existing file; one with wildcards may match nothing.
+func includedFiles(cfgPath string, patterns []string) ([]string, error) {
+	dir := filepath.Dir(cfgPath)
+	self, _ := filepath.Abs(cfgPath)
+	var files []string
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "" {
+			return nil, fmt.Errorf("include: empty pattern")
+		}
+		full := p
+		if !filepath.IsAbs(p) {
+			full = filepath.Join(dir, p)
+		}
+		matches, err := filepath.Glob(full)
+		if err != nil {
+			return nil, fmt.Errorf("include: %q: %w", p, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(p, `*?[`) {
+			return nil, fmt.Errorf("include: %s: no such file", p)
+		}
+		for _, m := range matches {
+			if abs, _ := filepath.Abs(m); abs == self {
+				continue // a pattern like *.yaml may match the config itself
+			}
+			files = append(files, m)
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+// applyIncludes appends the datasets of the config's included files.
+func applyIncludes(c *Config, cfgPath string) error {
+	if len(c.Include) == 0 {
+		return nil
+	}
+	// The hash covers only the top-level file, so it can't vouch for these
+	if requiredConfigSHA256 != "" {
+		return fmt.Errorf("include: not allowed with a required config SHA256, which can't cover included files")
+	}
+	files, err := includedFiles(cfgPath, c.Include)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		datasets, err := readIncluded(file)
+		if err != nil {
+			return err
+		}
+		for i := range datasets {
+			datasets[i].file = file
+		}
+		c.Datasets = append(c.Datasets, datasets...)
+	}
+	return nil
+}
+
+// readIncluded reads the datasets of an included file.
+func readIncluded(path string) ([]Dataset, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+	var keys map[string]yaml.Node
+	if err := yaml.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("include: %s: %w", path, err)
+	}
+	for key := range keys {
+		if key != "version" && key != "datasets" {
+			return nil, fmt.Errorf("include: %s: %s: only datasets (and version) may be set in an included file", path, key)
+		}
+	}
+	var inc includedConfig
+	if err := yaml.Unmarshal(b, &inc); err != nil {
+		return nil, fmt.Errorf("include: %s: %w", path, err)
+	}
+	if inc.Version != 0 && inc.Version != 1 {
+		return nil, fmt.Errorf("include: %s: unsupported version %d (want 1)", path, inc.Version)
+	}
+	return inc.Datasets, nil
+}
+
+// configFiles returns the config file and every file it includes, for
+// commands that edit datasets in place.
+func configFiles(cfgPath string, cfg *Config) []string {
+	files := []string{cfgPath}
+	seen := map[string]bool{cfgPath: true}
+	for _, ds := range cfg.Datasets {
+		if ds.file != "" && !seen[ds.file] {
+			seen[ds.file] = true
+			files = append(files, ds.file)
+		}
+	}
+	return files
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig_Include(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "teams"), 0o755)
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte(`version: 1
+include:
+  - teams/*.data.yaml
+datasets:
+  - id: shared
+    source: {type: file, path: shared.csv}
+    target: data/shared.csv
+`), 0o644)
+	geo := filepath.Join(dir, "teams", "geo.data.yaml")
+	os.WriteFile(geo, []byte("datasets:\n  - id: counties\n    source: {type: file, path: counties.csv}\n    target: data/geo/counties.csv\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "teams", "bio.data.yaml"), []byte("version: 1\ndatasets:\n  - id: genes\n    source: {type: file, path: genes.csv}\n    target: data/bio/genes.csv\n"), 0o644)
+
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, ds := range cfg.Datasets {
+		ids = append(ids, ds.ID)
+	}
+	if got := strings.Join(ids, ","); got != "shared,genes,counties" {
+		t.Errorf("datasets = %s, want the config's own, then each included file's in sorted order", got)
+	}
+	if cfg.Datasets[2].file != geo {
+		t.Errorf("counties comes from %q, want %q", cfg.Datasets[2].file, geo)
+	}
+
+	for _, tc := range []struct{ geo, want string }{
+		{"datasets:\n  - id: shared\n    source: {type: file, path: s.csv}\n    target: data/geo/s.csv\n", "dataset 2 (shared, in " + geo + "): id already used by dataset 0 (shared)"},
+		{"defaults:\n  policy: update\ndatasets: []\n", "only datasets (and version) may be set"},
+	} {
+		os.WriteFile(geo, []byte(tc.geo), 0o644)
+		if _, err := readConfig(cfgPath); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("readConfig() error = %v, want %q", err, tc.want)
+		}
+	}
+
+	os.WriteFile(cfgPath, []byte("version: 1\ninclude: [teams/missing.yaml]\ndatasets: []\n"), 0o644)
+	if _, err := readConfig(cfgPath); err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("readConfig() with a missing include = %v", err)
+	}
+
+	// A required hash can't vouch for included files
+	h, _ := HashFile(cfgPath)
+	RequireConfigSHA256(h)
+	defer RequireConfigSHA256("")
+	if _, err := readConfig(cfgPath); err == nil || !strings.Contains(err.Error(), "SHA256") {
+		t.Errorf("readConfig() with includes and a required hash = %v", err)
+	}
+}
+
+func TestBump_IncludedDataset(t *testing.T) {
+	dir := t.TempDir()
+	for _, v := range []string{"1.0", "1.1"} {
+		os.WriteFile(filepath.Join(dir, "data-"+v+".csv"), []byte("data "+v), 0o644)
+	}
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte("version: 1\ninclude: [team.yaml]\ndatasets: []\n"), 0o644)
+	team := filepath.Join(dir, "team.yaml")
+	os.WriteFile(team, []byte(`datasets:
+  - id: release
+    version: "1.0"
+    source:
+      type: mockpath
+      path: `+filepath.Join(dir, "data-{{version}}.csv")+`
+    target: `+filepath.Join(dir, "release.csv")+`
+`), 0o644)
+	lockPath := filepath.Join(dir, "lock.yaml")
+	if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+		t.Fatalf("Fetch() = %d, want 0", code)
+	}
+	if code := Bump(cfgPath, lockPath, "release", "1.1", Options{}); code != 0 {
+		t.Fatalf("Bump() = %d, want 0", code)
+	}
+	if got := mustRead(t, team); !strings.Contains(got, `version: "1.1"`) {
+		t.Errorf("included file after bump:\n%s", got)
+	}
+	if got := mustRead(t, cfgPath); got != "version: 1\ninclude: [team.yaml]\ndatasets: []\n" {
+		t.Errorf("config after bump:\n%s", got)
+	}
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"os"
+	"strings"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+)
+
+// scaffoldConfig is the .data.yaml written by Init.
+//
+// It has to be a valid config as-is (so check and fetch work straight away),
+// which is why the example dataset is live rather than commented out. The
+// comments point at the settings people most often reach for next.
+const scaffoldConfig = `# Datum configuration: the datasets this repository depends on.
+# Fetch them with "datum fetch", verify them with "datum check".
+# Schema for editor completion: https://github.com/jprybylski/datum/blob/main/data-schema.json
+version: 1
+
+defaults:
+  policy: fail      # what check does when a source changes: fail | update | log
+  algo: sha256
+
+datasets:
+  # An example dataset - replace it with your own.
+  - id: example
+    desc: Example CSV downloaded over HTTPS
+    source:
+      type: http
+      url: https://example.com/data.csv
+    target: data/example.csv
+    # policy: update          # override the default for this dataset
+    # tags: [reference]       # group datasets (used by quotas)
+
+  # Other source types:
+  #
+  # - id: local_copy
+  #   desc: File on a shared drive
+  #   source:
+  #     type: file
+  #     path: /mnt/shared/data.csv
+  #   target: data/local_copy.csv
+  #
+  # - id: scripted
+  #   desc: Anything a shell command can download (needs allow_command_sources: true)
+  #   source:
+  #     type: command
+  #     fingerprint_cmd: curl -sI https://example.com/data.csv | grep -i etag
+  #     fetch_cmd: curl -sfo {{dest}} https://example.com/data.csv
+  #   target: data/scripted.csv
+`
+
+// Init scaffolds a new workspace: a commented example config and an empty lockfile.
+//
+// Existing files are never overwritten unless force is set, and the check is
+// done for both files before either is written, so a refused init leaves the
+// directory exactly as it was.
+//
+// Parameters:
+//   - cfgPath: Where to write the config (typically .data.yaml)
+//   - lockPath: Where to write the lockfile (typically .data.lock.yaml)
+//   - force: Overwrite existing files
+//
+// Returns:
+//   - 0: Both files written
+//   - 1: A file already exists (without force) or a write failed
+func Init(cfgPath, lockPath string, force bool) int {
+	if !force {
+		var existing []string
+		for _, p := range []string{cfgPath, lockPath} {
+			if _, err := os.Stat(p); err == nil {
+				existing = append(existing, p)
+			}
+		}
+		if len(existing) > 0 {
+			logf("[ERR ] %s already exists (use --force to overwrite)\n", strings.Join(existing, " and "))
+			return 1
+		}
+	}
+
+	if err := fsutil.WriteFileAtomic(cfgPath, strings.NewReader(scaffoldConfig)); err != nil {
+		logf("[ERR ] %s: %v\n", cfgPath, err)
+		return 1
+	}
+	if err := writeLock(lockPath, &Lock{Version: 1, Items: map[string]*LockItem{}}); err != nil {
+		logf("[ERR ] %s: %v\n", lockPath, err)
+		return 1
+	}
+	logf("[OK  ] wrote %s and %s\n", cfgPath, lockPath)
+	logln("[INFO] edit the example dataset, then run: datum fetch")
+	return 0
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInit(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, ".data.yaml")
+	lockPath := filepath.Join(tmpDir, ".data.lock.yaml")
+
+	if code := Init(cfgPath, lockPath, false); code != 0 {
+		t.Fatalf("Init() = %d, want 0", code)
+	}
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("scaffolded config does not load: %v", err)
+	}
+	if len(cfg.Datasets) != 1 || cfg.Datasets[0].ID != "example" {
+		t.Errorf("scaffolded datasets = %+v, want the example", cfg.Datasets)
+	}
+	lk, err := readLock(lockPath)
+	if err != nil || lk.Version != 1 || len(lk.Items) != 0 {
+		t.Errorf("scaffolded lock = %+v, %v; want empty version 1", lk, err)
+	}
+
+	// A second init must not touch either file
+	if err := os.WriteFile(cfgPath, []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(lockPath)
+	if code := Init(cfgPath, lockPath, false); code != 1 {
+		t.Errorf("Init() over an existing config = %d, want 1", code)
+	}
+	if b, _ := os.ReadFile(cfgPath); string(b) != "mine" {
+		t.Errorf("refused init overwrote the config: %q", b)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("refused init wrote the lockfile (err = %v)", err)
+	}
+
+	if code := Init(cfgPath, lockPath, true); code != 0 {
+		t.Errorf("Init(force) = %d, want 0", code)
+	}
+	if b, _ := os.ReadFile(cfgPath); string(b) != scaffoldConfig {
+		t.Error("Init(force) did not rewrite the config")
+	}
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// reviewer walks a person through the datasets whose fail policy tripped
+// during `datum check --interactive`, one at a time, instead of leaving them
+// to run `datum fetch` for each change afterwards.
+//
+// For each changed dataset it asks whether to (a)ccept the new version, (k)eep
+// failing, or show a (d)iff first. An accepted version is fetched and pinned
+// right away, and the lockfile written before the next question, so stopping
+// halfway (Ctrl-C, or closing the input) keeps every decision already made.
+//
+// Go learning note: the reviewer only ever runs inside forEachDataset's apply
+// callback, which is called on the engine's own goroutine. That's what makes it
+// safe to read from the terminal and write the lock here while workers are
+// still checking later datasets in the background.
+type reviewer struct {
+	in     *bufio.Reader
+	closed bool // Input ended; keep failing without asking
+}
+
+func newReviewer(in io.Reader) *reviewer {
+	return &reviewer{in: bufio.NewReader(in)}
+}
+
+// review asks what to do about ds, whose source no longer matches its lock
+// entry item (nil if it was never locked). It returns the fetch result when
+// the change was accepted, and nil when the dataset should keep failing.
+func (r *reviewer) review(ctx context.Context, cfg *Config, ds Dataset, item *LockItem, si *StatusItem, now time.Time) *datasetResult {
+	for !r.closed {
+		fmt.Printf("    %s: (a)ccept new version, (k)eep failing, (d)iff? [a/K/d] ", ds.ID)
+		line, err := r.in.ReadString('\n')
+		if err != nil && line == "" {
+			r.closed = true
+			fmt.Println()
+			break
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "a", "accept":
+			res := fetchDataset(ctx, cfg, ds, item, si, now)
+			stdlog.Write(res.out.Bytes())
+			if res.exit == 0 {
+				res.setStatus("updated")
+			}
+			return res
+		case "", "k", "keep":
+			return nil
+		case "d", "diff":
+			writeContentDiff(ctx, stdlog, ds, maxDiffBytes)
+		default:
+			fmt.Println("    please answer a, k or d")
+		}
+	}
+	return nil
+}
+
+// writeContentDiff downloads the new version of ds to a temporary directory
+// and writes to w how it differs from the local copy: a line diff for text,
+// or sizes and hashes for binary files and files over limit bytes.
+func writeContentDiff(ctx context.Context, w io.Writer, ds Dataset, limit int64) {
+	tmp, err := os.MkdirTemp("", "datum-diff-")
+	if err != nil {
+		fmt.Fprintf(w, "    cannot diff: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	newPath := filepath.Join(tmp, filepath.Base(ds.Target))
+
+	// The first source that delivers wins, as in fetch
+	var lastErr error
+	fetched := false
+	for _, src := range ds.GetSources() {
+		f, ok := registry.Get(src.Type)
+		if !ok {
+			lastErr = fmt.Errorf("unknown source.type=%q", src.Type)
+			continue
+		}
+		src.Progress = newProgress(ds.ID)
+		if lastErr = f.Fetch(ctx, src, newPath); lastErr == nil {
+			fetched = true
+			break
+		}
+	}
+	if !fetched {
+		fmt.Fprintf(w, "    cannot fetch the new version for a diff: %v\n", lastErr)
+		return
+	}
+
+	oldSize, newSize := fileSize(ds.Target), fileSize(newPath)
+	if isDir(ds.Target) || isDir(newPath) {
+		oldHash, oldFiles, _ := HashPath(ds.Target)
+		newHash, newFiles, _ := HashPath(newPath)
+		fmt.Fprintf(w, "    directory, not shown line by line\n")
+		fmt.Fprintf(w, "    local  %s in %d files  %s\n", formatBytes(oldSize), oldFiles, orNone(oldHash))
+		fmt.Fprintf(w, "    new    %s in %d files  %s\n", formatBytes(newSize), newFiles, newHash)
+		return
+	}
+	var old, cur []byte
+	if oldSize <= limit && newSize <= limit {
+		old, _ = os.ReadFile(ds.Target) // A missing local copy diffs as empty
+		cur, err = os.ReadFile(newPath)
+		if err != nil {
+			fmt.Fprintf(w, "    cannot diff: %v\n", err)
+			return
+		}
+	}
+	if old == nil && oldSize > 0 || cur == nil && newSize > 0 || !isText(old) || !isText(cur) {
+		oldHash, _ := HashFile(ds.Target)
+		newHash, _ := HashFile(newPath)
+		fmt.Fprintf(w, "    binary or large content, not shown line by line\n")
+		fmt.Fprintf(w, "    local  %s  %s\n", formatBytes(oldSize), orNone(oldHash))
+		fmt.Fprintf(w, "    new    %s  %s\n", formatBytes(newSize), newHash)
+		return
+	}
+
+	lines := unifiedDiff(string(old), string(cur))
+	if lines == nil {
+		fmt.Fprintln(w, "    content is identical; only the source's fingerprint changed")
+		return
+	}
+	fmt.Fprintf(w, "    --- %s (local)\n", ds.Target)
+	fmt.Fprintf(w, "    +++ %s (new)\n", ds.Target)
+	for _, l := range lines {
+		fmt.Fprintf(w, "    %s\n", l)
+	}
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck_Interactive(t *testing.T) {
+	// setup writes a fail-policy config whose lock no longer matches the mock source
+	setup := func(t *testing.T) (cfgPath, lockPath, target string) {
+		dir := t.TempDir()
+		target = filepath.Join(dir, "data.txt")
+		os.WriteFile(target, []byte("old data"), 0o644)
+		cfgPath = filepath.Join(dir, "config.yaml")
+		os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: d1
+    source:
+      type: mock
+    target: `+target+`
+    policy: fail
+`), 0o644)
+		lockPath = filepath.Join(dir, "lock.yaml")
+		writeLock(lockPath, &Lock{Version: 1, Items: map[string]*LockItem{"d1": {RemoteFingerprint: "old-fp"}}})
+		return cfgPath, lockPath, target
+	}
+
+	tests := []struct {
+		name     string
+		answers  string
+		wantExit int
+		wantFP   string
+	}{
+		{"accept", "a\n", 0, "mock-fp"},
+		{"diff then accept", "d\naccept\n", 0, "mock-fp"},
+		{"keep", "k\n", 1, "old-fp"},
+		{"default is keep", "\n", 1, "old-fp"},
+		{"unrecognised then keep", "yes\nk\n", 1, "old-fp"},
+		{"no input", "", 1, "old-fp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgPath, lockPath, target := setup(t)
+			code := CheckWithOptions(cfgPath, lockPath, Options{Interactive: strings.NewReader(tt.answers)})
+			if code != tt.wantExit {
+				t.Errorf("exit = %d, want %d", code, tt.wantExit)
+			}
+			lk, _ := readLock(lockPath)
+			if got := lk.Items["d1"].RemoteFingerprint; got != tt.wantFP {
+				t.Errorf("locked fingerprint = %q, want %q", got, tt.wantFP)
+			}
+			if b, _ := os.ReadFile(target); tt.wantExit == 0 && string(b) != "mock data" {
+				t.Errorf("target = %q after accepting", b)
+			}
+		})
+	}
+
+	t.Run("report", func(t *testing.T) {
+		cfgPath, lockPath, _ := setup(t)
+		var rep strings.Builder
+		CheckWithOptions(cfgPath, lockPath, Options{Interactive: strings.NewReader("a\n"), Report: &rep})
+		if !strings.Contains(rep.String(), `"status": "updated"`) || !strings.Contains(rep.String(), `"changes"`) {
+			t.Errorf("report does not show the accepted change:\n%s", rep.String())
+		}
+	})
+}
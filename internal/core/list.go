@@ -0,0 +1,86 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ListEntry describes one configured dataset, for "datum list --json".
+type ListEntry struct {
+	ID     string   `json:"id"`
+	Type   string   `json:"type"` // Source types in fallback order, comma-separated
+	Target string   `json:"target"`
+	Policy string   `json:"policy"` // Effective policy, defaults applied
+	Desc   string   `json:"desc,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// List prints every configured dataset with its source type, target and
+// effective policy, in config order. It reads only the config: nothing is
+// fetched or hashed, and the lockfile isn't consulted.
+//
+// Parameters:
+//   - cfgPath: Path to the configuration file (.data.yaml)
+//   - asJSON: Emit a JSON array of ListEntry instead of a table
+//
+// Returns:
+//   - 0: Datasets listed (possibly none)
+//   - 2: Configuration error
+func List(cfgPath string, asJSON bool) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	entries := listEntries(cfg)
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			fmt.Fprintf(os.Stderr, "list: %v\n", err)
+			return 2
+		}
+		return 0
+	}
+	printList(os.Stdout, entries)
+	return 0
+}
+
+// listEntries describes cfg's datasets.
+func listEntries(cfg *Config) []ListEntry {
+	entries := []ListEntry{}
+	for _, ds := range cfg.Datasets {
+		var types []string
+		for _, src := range ds.GetSources() {
+			types = append(types, src.Type)
+		}
+		entries = append(entries, ListEntry{
+			ID:     ds.ID,
+			Type:   strings.Join(types, ","),
+			Target: ds.Target,
+			Policy: firstNonEmpty(ds.Policy, cfg.Defaults.Policy),
+			Desc:   ds.Desc,
+			Tags:   ds.Tags,
+		})
+	}
+	return entries
+}
+
+// printList writes entries as a table.
+func printList(w io.Writer, entries []ListEntry) {
+	if len(entries) == 0 {
+		logln("[INFO] no datasets configured")
+		return
+	}
+	idW, typeW := len("DATASET"), len("TYPE")
+	for _, e := range entries {
+		idW, typeW = max(idW, len(e.ID)), max(typeW, len(e.Type))
+	}
+	fmt.Fprintf(w, "%-*s  %-*s  %-6s  %s\n", idW, "DATASET", typeW, "TYPE", "POLICY", "TARGET")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%-*s  %-*s  %-6s  %s\n", idW, e.ID, typeW, e.Type, e.Policy, e.Target)
+	}
+}
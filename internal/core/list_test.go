@@ -0,0 +1,59 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`version: 1
+defaults:
+  policy: log
+datasets:
+  - id: census
+    desc: County population
+    tags: [demographics]
+    source:
+      type: http
+      url: https://example.com/census.csv
+    target: data/census.csv
+  - id: codes
+    policy: update
+    sources:
+      - type: http
+        url: https://example.com/codes.csv
+      - type: file
+        path: backup/codes.csv
+    target: data/codes.csv
+`), 0o644)
+	cfg, err := readConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := listEntries(cfg)
+	want := []ListEntry{
+		{ID: "census", Type: "http", Target: "data/census.csv", Policy: "log", Desc: "County population", Tags: []string{"demographics"}},
+		{ID: "codes", Type: "http,file", Target: "data/codes.csv", Policy: "update"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("listEntries() = %+v, want %+v", entries, want)
+	}
+	for i := range want {
+		got, w := entries[i], want[i]
+		if got.ID != w.ID || got.Type != w.Type || got.Target != w.Target || got.Policy != w.Policy || got.Desc != w.Desc || strings.Join(got.Tags, ",") != strings.Join(w.Tags, ",") {
+			t.Errorf("entries[%d] = %+v, want %+v", i, got, w)
+		}
+	}
+
+	var buf bytes.Buffer
+	printList(&buf, entries)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "DATASET") || !strings.HasPrefix(lines[2], "codes    http,file  update  data/codes.csv") {
+		t.Errorf("table =\n%s", buf.String())
+	}
+}
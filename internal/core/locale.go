@@ -0,0 +1,133 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// catalogs translate the commonest status lines, keyed by the English format
+// string exactly as the engine writes it. A line without an entry is printed
+// in English, so a catalog can cover as much or as little as its translator
+// had time for.
+//
+// Only the words are translated. The [TAG ] in front stays as it is, as
+// scripts (and the logger's levels) match on it; dates stay in ISO 8601 and
+// sizes in IEC units, whatever the locale; and a translation must keep its
+// key's verbs, in the same order (TestCatalogVerbs checks).
+var catalogs = map[string]map[string]string{
+	"de": {
+		"[OK  ] %s: up-to-date\n":                                                          "[OK  ] %s: aktuell\n",
+		"[OK  ] %s: up to date\n":                                                          "[OK  ] %s: aktuell\n",
+		"[OK  ] %s: local copy re-verified\n":                                              "[OK  ] %s: lokale Kopie erneut geprüft\n",
+		"[OK  ] %s: %s is the newest version\n":                                            "[OK  ] %s: %s ist die neueste Version\n",
+		"[CHG ] %s: changed upstream\n":                                                    "[CHG ] %s: an der Quelle geändert\n",
+		"[CHG ] %s: unchanged upstream, but %s is missing\n":                               "[CHG ] %s: an der Quelle unverändert, aber %s fehlt\n",
+		"[STALE] %s: not fetched yet\n":                                                    "[STALE] %s: noch nicht abgerufen\n",
+		"[STALE] %s: changed upstream (%s -> %s)\n":                                        "[STALE] %s: an der Quelle geändert (%s -> %s)\n",
+		"[STALE] %s: remote changed (lock=%q -> now=%q)\n":                                 "[STALE] %s: Quelle geändert (Lock=%q -> jetzt=%q)\n",
+		"[STALE] %s: version %s available (pinned %s)\n":                                   "[STALE] %s: Version %s verfügbar (festgelegt: %s)\n",
+		"[FAIL] %s: remote changed (lock=%q -> now=%q)\n":                                  "[FAIL] %s: Quelle geändert (Lock=%q -> jetzt=%q)\n",
+		"[NEW ] %s: fetch would pin %s\n":                                                  "[NEW ] %s: fetch würde %s festlegen\n",
+		"[UPD ] %s: refreshing\n":                                                          "[UPD ] %s: wird aktualisiert\n",
+		"[INFO] %s: not modified since the last fetch, kept %s\n":                          "[INFO] %s: seit dem letzten Abruf unverändert, %s behalten\n",
+		"[INFO] %s: mirror %s matches the lock\n":                                          "[INFO] %s: Spiegel %s stimmt mit dem Lock überein\n",
+		"[INFO] %s: cached response fresh until %s, not re-fingerprinting\n":               "[INFO] %s: zwischengespeicherte Antwort gültig bis %s, kein neuer Fingerabdruck\n",
+		"[INFO] %s: source may be inaccessible - please verify the source configuration\n": "[INFO] %s: Quelle evtl. nicht erreichbar - bitte die Quellkonfiguration prüfen\n",
+		"[ERR ] %s: %s is missing\n":                                                       "[ERR ] %s: %s fehlt\n",
+		"[ERR ] %s: %s was modified (sha256 %s, lock %s)\n":                                "[ERR ] %s: %s wurde verändert (sha256 %s, Lock %s)\n",
+		"[ERR ] %s: not pinned in the lockfile\n":                                          "[ERR ] %s: nicht im Lockfile festgelegt\n",
+		"[ERR ] %s: fingerprint: %v\n":                                                     "[ERR ] %s: Fingerabdruck: %v\n",
+		"[ERR ] %s: fetch: %v\n":                                                           "[ERR ] %s: Abruf: %v\n",
+		"[ERR ] %s: all %d sources failed, last error: %v\n":                               "[ERR ] %s: alle %d Quellen fehlgeschlagen, letzter Fehler: %v\n",
+		"[WARN] %s: source %d/%d: %v (trying next source)\n":                               "[WARN] %s: Quelle %d/%d: %v (nächste Quelle wird versucht)\n",
+		"[WARN] %s: %s: %v (retry %d/%d in %s)\n":                                          "[WARN] %s: %s: %v (Wiederholung %d/%d in %s)\n",
+		"[WARN] run interrupted; unfinished datasets keep their previous lock entries\n":   "[WARN] Lauf unterbrochen; unfertige Datensätze behalten ihre bisherigen Lock-Einträge\n",
+		"[SKIP] %s: run interrupted before this dataset\n":                                 "[SKIP] %s: Lauf vor diesem Datensatz unterbrochen\n",
+		"[INFO] retrying %d failed dataset(s) (pass %d of %d)\n":                           "[INFO] %d fehlgeschlagene Datensätze werden wiederholt (Durchgang %d von %d)\n",
+		"[INFO] sampling %d of %d datasets (least recently covered first)\n":               "[INFO] Stichprobe: %d von %d Datensätzen (am längsten ungeprüfte zuerst)\n",
+	},
+	"es": {
+		"[OK  ] %s: up-to-date\n":                                                          "[OK  ] %s: al día\n",
+		"[OK  ] %s: up to date\n":                                                          "[OK  ] %s: al día\n",
+		"[OK  ] %s: local copy re-verified\n":                                              "[OK  ] %s: copia local verificada de nuevo\n",
+		"[OK  ] %s: %s is the newest version\n":                                            "[OK  ] %s: %s es la versión más reciente\n",
+		"[CHG ] %s: changed upstream\n":                                                    "[CHG ] %s: cambió en el origen\n",
+		"[CHG ] %s: unchanged upstream, but %s is missing\n":                               "[CHG ] %s: sin cambios en el origen, pero falta %s\n",
+		"[STALE] %s: not fetched yet\n":                                                    "[STALE] %s: aún no descargado\n",
+		"[STALE] %s: changed upstream (%s -> %s)\n":                                        "[STALE] %s: cambió en el origen (%s -> %s)\n",
+		"[STALE] %s: remote changed (lock=%q -> now=%q)\n":                                 "[STALE] %s: el origen cambió (lock=%q -> ahora=%q)\n",
+		"[STALE] %s: version %s available (pinned %s)\n":                                   "[STALE] %s: versión %s disponible (fijada: %s)\n",
+		"[FAIL] %s: remote changed (lock=%q -> now=%q)\n":                                  "[FAIL] %s: el origen cambió (lock=%q -> ahora=%q)\n",
+		"[NEW ] %s: fetch would pin %s\n":                                                  "[NEW ] %s: fetch fijaría %s\n",
+		"[UPD ] %s: refreshing\n":                                                          "[UPD ] %s: actualizando\n",
+		"[INFO] %s: not modified since the last fetch, kept %s\n":                          "[INFO] %s: sin cambios desde la última descarga, se conserva %s\n",
+		"[INFO] %s: mirror %s matches the lock\n":                                          "[INFO] %s: el espejo %s coincide con el lock\n",
+		"[INFO] %s: cached response fresh until %s, not re-fingerprinting\n":               "[INFO] %s: respuesta en caché vigente hasta %s, sin nueva huella\n",
+		"[INFO] %s: source may be inaccessible - please verify the source configuration\n": "[INFO] %s: el origen puede estar inaccesible - revise la configuración del origen\n",
+		"[ERR ] %s: %s is missing\n":                                                       "[ERR ] %s: falta %s\n",
+		"[ERR ] %s: %s was modified (sha256 %s, lock %s)\n":                                "[ERR ] %s: %s fue modificado (sha256 %s, lock %s)\n",
+		"[ERR ] %s: not pinned in the lockfile\n":                                          "[ERR ] %s: no está fijado en el lockfile\n",
+		"[ERR ] %s: fingerprint: %v\n":                                                     "[ERR ] %s: huella: %v\n",
+		"[ERR ] %s: fetch: %v\n":                                                           "[ERR ] %s: descarga: %v\n",
+		"[ERR ] %s: all %d sources failed, last error: %v\n":                               "[ERR ] %s: fallaron los %d orígenes, último error: %v\n",
+		"[WARN] %s: source %d/%d: %v (trying next source)\n":                               "[WARN] %s: origen %d/%d: %v (probando el siguiente origen)\n",
+		"[WARN] %s: %s: %v (retry %d/%d in %s)\n":                                          "[WARN] %s: %s: %v (reintento %d/%d en %s)\n",
+		"[WARN] run interrupted; unfinished datasets keep their previous lock entries\n":   "[WARN] ejecución interrumpida; los conjuntos sin terminar conservan sus entradas anteriores del lock\n",
+		"[SKIP] %s: run interrupted before this dataset\n":                                 "[SKIP] %s: ejecución interrumpida antes de este conjunto\n",
+		"[INFO] retrying %d failed dataset(s) (pass %d of %d)\n":                           "[INFO] reintentando %d conjunto(s) fallido(s) (pasada %d de %d)\n",
+		"[INFO] sampling %d of %d datasets (least recently covered first)\n":               "[INFO] muestreando %d de %d conjuntos (los revisados hace más tiempo primero)\n",
+	},
+}
+
+// messages is the catalog status lines are translated with, or nil for
+// English. Set once at startup via SetLocale.
+var messages map[string]string
+
+// SetLocale picks the language of status lines: "en" (or "" or "C") for
+// English, a catalog's name such as "de" or "es", or "auto" to follow
+// $LC_ALL, $LC_MESSAGES and $LANG, falling back to English. Region and
+// encoding suffixes are ignored, so "de_AT.UTF-8" means "de".
+//
+// Reports, tables and JSON output are not translated: they are read by
+// programs as often as by people.
+func SetLocale(name string) error {
+	auto := name == "auto"
+	if auto {
+		name = firstNonEmpty(os.Getenv("LC_ALL"), firstNonEmpty(os.Getenv("LC_MESSAGES"), os.Getenv("LANG")))
+	}
+	lang, _, _ := strings.Cut(strings.ToLower(name), ".")
+	lang, _, _ = strings.Cut(lang, "_")
+	lang, _, _ = strings.Cut(lang, "-")
+	switch lang {
+	case "", "en", "c", "posix":
+		messages = nil
+		return nil
+	}
+	cat, ok := catalogs[lang]
+	if !ok && !auto {
+		return fmt.Errorf("unknown locale %q (want en, %s or auto)", name, strings.Join(Locales(), ", "))
+	}
+	messages = cat
+	return nil
+}
+
+// Locales lists the languages with a catalog, English aside.
+func Locales() []string {
+	var names []string
+	for name := range catalogs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tr returns the translation of a status line's format string, or format
+// itself when the catalog has none.
+func tr(format string) string {
+	if t, ok := messages[format]; ok {
+		return t
+	}
+	return format
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestCatalogVerbs checks that every translation keeps its key's formatting
+// verbs in order, and still starts with the key's tag.
+func TestCatalogVerbs(t *testing.T) {
+	verb := regexp.MustCompile(`%[-+# 0]*[0-9]*(?:\.[0-9]+)?[a-zA-Z%]`)
+	for lang, cat := range catalogs {
+		for key, msg := range cat {
+			if want, got := verb.FindAllString(key, -1), verb.FindAllString(msg, -1); !slices.Equal(want, got) {
+				t.Errorf("%s: %q has verbs %v, want %v", lang, msg, got, want)
+			}
+			if tag := statusLine.FindString(key); !strings.HasPrefix(msg, strings.TrimSuffix(tag, "%s: ")) {
+				t.Errorf("%s: %q doesn't keep the tag of %q", lang, msg, key)
+			}
+		}
+	}
+}
+
+// TestCatalogKeys checks that every key is still a format string the package
+// writes, so a reworded line doesn't silently go back to English.
+func TestCatalogKeys(t *testing.T) {
+	files, _ := filepath.Glob("*.go")
+	var src strings.Builder
+	for _, f := range files {
+		if !strings.HasSuffix(f, "_test.go") && f != "locale.go" {
+			b, err := os.ReadFile(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			src.Write(b)
+		}
+	}
+	for lang, cat := range catalogs {
+		for key := range cat {
+			if !strings.Contains(src.String(), strconv.Quote(key)) {
+				t.Errorf("%s: no status line %q in the package", lang, key)
+			}
+		}
+	}
+}
+
+func TestSetLocale(t *testing.T) {
+	t.Cleanup(func() { SetLocale("en") })
+
+	if err := SetLocale("de"); err != nil {
+		t.Fatal(err)
+	}
+	if got := tr("[STALE] %s: not fetched yet\n"); got != "[STALE] %s: noch nicht abgerufen\n" {
+		t.Errorf("tr() in de = %q", got)
+	}
+	if got := tr("[INFO] something new\n"); got != "[INFO] something new\n" {
+		t.Errorf("tr() of a line without a translation = %q, want it unchanged", got)
+	}
+
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "es_MX.UTF-8")
+	if err := SetLocale("auto"); err != nil || messages == nil || messages["[UPD ] %s: refreshing\n"] != "[UPD ] %s: actualizando\n" {
+		t.Errorf("SetLocale(auto) with LANG=es_MX.UTF-8 = %v, want the es catalog", err)
+	}
+	t.Setenv("LANG", "ja_JP.UTF-8")
+	if err := SetLocale("auto"); err != nil || messages != nil {
+		t.Errorf("SetLocale(auto) with LANG=ja_JP.UTF-8 = %v, want English", err)
+	}
+
+	if err := SetLocale("klingon"); err == nil {
+		t.Error("SetLocale(klingon) succeeded")
+	}
+	if err := SetLocale("C"); err != nil || messages != nil {
+		t.Errorf("SetLocale(C) = %v, want English", err)
+	}
+}
@@ -1,10 +1,14 @@
 package core
 
 import (
+	"bytes"
 	"os"
+	"path/filepath"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/jprybylski/datum/internal/fsutil"
 )
 
 // Lock represents the lockfile structure that tracks dataset fingerprints.
@@ -17,6 +21,9 @@ type Lock struct {
 	Version     int                  `yaml:"version"`                // Lockfile format version (currently 1)
 	LastChecked *time.Time           `yaml:"last_checked,omitempty"` // Timestamp of last check operation
 	Items       map[string]*LockItem `yaml:"items"`                  // Map of dataset ID to lock item
+
+	// PolicyBundle pins the organization policy (see PolicyBundle)
+	PolicyBundle *LockItem `yaml:"policy_bundle,omitempty"`
 }
 
 // LockItem stores the verification state for a single dataset.
@@ -27,11 +34,37 @@ type Lock struct {
 //   - When it was last verified
 //   - If the source became inaccessible, when and why
 type LockItem struct {
+	Target            string     `yaml:"target,omitempty"`             // Where the local file was written, so prune can find it once the dataset is gone
 	LocalSHA256       string     `yaml:"local_sha256,omitempty"`       // SHA256 hash of the local file
 	RemoteFingerprint string     `yaml:"remote_fingerprint,omitempty"` // Remote fingerprint (ETag, git SHA, etc.)
+	Size              int64      `yaml:"size,omitempty"`               // Size of the local file in bytes (total, for a directory)
+	Files             int        `yaml:"files,omitempty"`              // Number of files, when the target is a directory (see HashTree)
+	Slice             string     `yaml:"slice,omitempty"`              // Part of the source the local file holds, e.g. "bytes=0-1023" (see slice.go)
+	RawSHA256         string     `yaml:"raw_sha256,omitempty"`         // SHA256 of the data as downloaded, when decompress, archive_path, extract or transform changed it
+	Transform         string     `yaml:"transform,omitempty"`          // The dataset's transform command the local file went through
 	CheckedAt         *time.Time `yaml:"checked_at,omitempty"`         // Last verification timestamp
 	InaccessibleAt    *time.Time `yaml:"inaccessible_at,omitempty"`    // When the source became inaccessible
 	InaccessibleError string     `yaml:"inaccessible_error,omitempty"` // Error message when fetch failed
+	RunID             string     `yaml:"run_id,omitempty"`             // Run that last changed this entry (see Options.RunID)
+	TlogIndex         *int64     `yaml:"tlog_index,omitempty"`         // Transparency log entry witnessing this pin (see TransparencyLog)
+}
+
+// clone returns a copy of the item that can be modified independently, or nil for nil.
+// The time fields are shared, which is safe because they are replaced, never mutated.
+func (it *LockItem) clone() *LockItem {
+	if it == nil {
+		return nil
+	}
+	c := *it
+	return &c
+}
+
+// raw returns the item's RawSHA256, or "" for nil.
+func (it *LockItem) raw() string {
+	if it == nil {
+		return ""
+	}
+	return it.RawSHA256
 }
 
 // readLock loads the lockfile from disk.
@@ -74,8 +107,9 @@ func readLock(path string) (*Lock, error) {
 
 // writeLock saves the lockfile to disk atomically.
 //
-// To prevent corruption from crashes or interrupts, this function uses atomic writes:
-//  1. Write to a temporary file (.data.lock.yaml.tmp)
+// To prevent corruption from crashes or interrupts, this function uses atomic writes
+// via fsutil.WriteFileAtomic:
+//  1. Write to a temporary file (.data.lock.yaml.tmp, or under the scratch directory)
 //  2. Rename the temporary file to the final name
 //
 // On Unix systems, rename is atomic, so the lockfile is never in a partially-written state.
@@ -85,10 +119,10 @@ func readLock(path string) (*Lock, error) {
 //   - l: The Lock struct to serialize
 //
 // Returns:
-//   - An error if marshaling, writing, or renaming fails
+//   - An error if the parent directory is missing, or marshaling or writing fails
 //
-// Go learning note: The 0o644 is an octal file permission (readable by all, writable by owner).
-// The 'o' prefix indicates octal notation (base 8), a Go 1.13+ feature.
+// Go learning note: Unlike target files, we don't create missing parent directories
+// here - a lockfile path in a nonexistent directory is almost always a typo.
 func writeLock(path string, l *Lock) error {
 	// Marshal the Lock struct to YAML bytes
 	b, err := yaml.Marshal(l)
@@ -96,13 +130,8 @@ func writeLock(path string, l *Lock) error {
 		return err
 	}
 
-	// Write to a temporary file first (atomic write pattern)
-	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
 		return err
 	}
-
-	// Atomically rename temporary file to final destination
-	// If this succeeds, the file is guaranteed to be complete
-	return os.Rename(tmp, path)
+	return fsutil.WriteFileAtomic(path, bytes.NewReader(b))
 }
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffLocks(t *testing.T) {
+	oldLk := &Lock{Version: 1, Items: map[string]*LockItem{
+		"same":    {LocalSHA256: "s1", RemoteFingerprint: "f1"},
+		"bumped":  {LocalSHA256: "s1", RemoteFingerprint: "f1"},
+		"dropped": {LocalSHA256: "s1", RemoteFingerprint: "f1"},
+	}}
+	newLk := &Lock{Version: 1, Items: map[string]*LockItem{
+		"same":   {LocalSHA256: "s1", RemoteFingerprint: "f1"},
+		"bumped": {LocalSHA256: "s2", RemoteFingerprint: "f2", RunID: "job-7"},
+		"new":    {LocalSHA256: "s3", RemoteFingerprint: "f3"},
+	}}
+
+	changes := diffLocks(oldLk, newLk)
+
+	want := []struct{ id, change string }{
+		{"bumped", "changed"},
+		{"dropped", "removed"},
+		{"new", "added"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("diffLocks() returned %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, w := range want {
+		if changes[i].ID != w.id || changes[i].Change != w.change {
+			t.Errorf("changes[%d] = %s/%s, want %s/%s", i, changes[i].ID, changes[i].Change, w.id, w.change)
+		}
+	}
+	if changes[0].OldFingerprint != "f1" || changes[0].NewFingerprint != "f2" {
+		t.Errorf("fingerprint transition = %q -> %q, want f1 -> f2", changes[0].OldFingerprint, changes[0].NewFingerprint)
+	}
+	if changes[0].RunID != "job-7" {
+		t.Errorf("changed entry run = %q, want the new lock's job-7", changes[0].RunID)
+	}
+}
+
+func TestDiffLocksCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	a := filepath.Join(tmpDir, "a.yaml")
+	b := filepath.Join(tmpDir, "b.yaml")
+	os.WriteFile(a, []byte("version: 1\nitems:\n  x:\n    remote_fingerprint: f1\n"), 0o644)
+	os.WriteFile(b, []byte("version: 1\nitems:\n  x:\n    remote_fingerprint: f2\n"), 0o644)
+
+	tests := []struct {
+		name     string
+		old, new string
+		asJSON   bool
+		want     int
+	}{
+		{"identical", a, a, false, 0},
+		{"changed", a, b, false, 1},
+		{"changed json", a, b, true, 1},
+		{"missing file", a, filepath.Join(tmpDir, "nope.yaml"), false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffLocks(tt.old, tt.new, tt.asJSON); got != tt.want {
+				t.Errorf("DiffLocks() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// fingerprintFormats describes the fingerprint shapes each built-in handler produces.
+//
+// These are used by VerifyLock to detect lock entries whose fingerprint could not
+// have come from the configured source type (e.g. an "etag:" value recorded for a
+// git source), which usually means the lockfile was hand-edited or merged badly.
+// Handler types missing from this map (such as "command", whose fingerprint is
+// whatever the user's command prints) are not format-checked.
+var fingerprintFormats = map[string]*regexp.Regexp{
+	"http":           regexp.MustCompile(`^(etag:.+|lm:.*\|len:.*|sha256:[0-9a-f]{64}|crc32:[0-9a-f]{8}\|size:[0-9]+)$`),
+	"file":           regexp.MustCompile(`^(sha256:[0-9a-f]{64}|tree:[0-9a-f]{64}\|files:[0-9]+)$`),
+	"git":            regexp.MustCompile(`^git(blob|tree):[0-9a-f]{40}$`),
+	"huggingface":    regexp.MustCompile(`^(sha256:[0-9a-f]{64}|gitblob:[0-9a-f]{40})$`),
+	"sql":            regexp.MustCompile(`^(sha256|query):[0-9a-f]{64}$`),
+	"doi":            regexp.MustCompile(`^(md5:[0-9a-f]{32}|sha1:[0-9a-f]{40}|sha256:[0-9a-f]{64}|sha512:[0-9a-f]{128})$`),
+	"torrent":        regexp.MustCompile(`^btih:[0-9a-f]{40}$`),
+	"dvc":            regexp.MustCompile(`^md5:[0-9a-f]{32}(\.dir)?$`),
+	"github-release": regexp.MustCompile(`^(sha256:[0-9a-f]{64}|asset:[A-Za-z0-9_=-]+)$`),
+}
+
+// sha256Hex matches a lowercase hex-encoded SHA256 digest as written by HashFile.
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// lockIssue is a single problem found while verifying a lockfile.
+type lockIssue struct {
+	ID    string // Dataset ID the issue refers to (empty for file-level issues)
+	Fatal bool   // true for errors, false for warnings
+	Msg   string // Human-readable description
+}
+
+// VerifyLock validates the lockfile's structure and its consistency with the configuration.
+//
+// Unlike Check, this never contacts any remote source. It reports:
+//   - Lockfiles that can't be parsed strictly (unknown keys, wrong types)
+//   - Entries with missing or malformed fields
+//   - Fingerprints whose format doesn't match the dataset's handler type
+//   - Orphaned lock entries (no matching dataset) and datasets with no lock entry
+//
+// With withLog, it also asks the config's transparency log whether it
+// witnessed each pin (see TransparencyLog); that is the only network access.
+//
+// Parameters:
+//   - cfgPath: Path to the configuration file (.data.yaml)
+//   - lockPath: Path to the lockfile (.data.lock.yaml)
+//   - withLog: Verify every pin against the transparency log
+//
+// Returns:
+//   - 0: The lockfile is consistent
+//   - 1: One or more errors were found
+//   - 2: Configuration error or unreadable lockfile
+func VerifyLock(cfgPath, lockPath string, withLog bool) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+
+	lk, err := readLockStrict(lockPath)
+	if err != nil {
+		logf("lock error: %v\n", err)
+		return 2
+	}
+
+	issues := verifyLock(cfg, lk)
+	if withLog {
+		issues = append(issues, verifyWitnessed(context.Background(), cfg, lk)...)
+	}
+	errs, warns := 0, 0
+	for _, is := range issues {
+		tag := "[WARN]"
+		if is.Fatal {
+			tag = "[ERR ]"
+			errs++
+		} else {
+			warns++
+		}
+		if is.ID == "" {
+			logf("%s %s\n", tag, is.Msg)
+		} else {
+			logf("%s %s: %s\n", tag, is.ID, is.Msg)
+		}
+	}
+	logf("lock verify: %d error(s), %d warning(s)\n", errs, warns)
+
+	if errs > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readLockStrict loads a lockfile, rejecting unknown keys and missing files.
+//
+// readLock is deliberately lenient so a first run can start from nothing; when
+// verifying, a missing or sloppy lockfile is exactly what we want to report.
+func readLockStrict(path string) (*Lock, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	var l Lock
+	if err := dec.Decode(&l); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &l, nil
+}
+
+// verifyLock compares a parsed lockfile against the configuration and returns
+// all issues found, ordered with file-level issues first and then by dataset ID.
+func verifyLock(cfg *Config, lk *Lock) []lockIssue {
+	var issues []lockIssue
+
+	if lk.Version != 1 {
+		issues = append(issues, lockIssue{Fatal: true, Msg: fmt.Sprintf("unsupported lock version %d (want 1)", lk.Version)})
+	}
+
+	datasets := map[string]*Dataset{}
+	for i := range cfg.Datasets {
+		datasets[cfg.Datasets[i].ID] = &cfg.Datasets[i]
+	}
+
+	// Visit every ID mentioned by either side so output order is stable
+	ids := make([]string, 0, len(datasets)+len(lk.Items))
+	for id := range datasets {
+		ids = append(ids, id)
+	}
+	for id := range lk.Items {
+		if _, ok := datasets[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		ds, inConfig := datasets[id]
+		item, inLock := lk.Items[id]
+
+		switch {
+		case !inConfig:
+			issues = append(issues, lockIssue{ID: id, Fatal: true, Msg: "orphaned lock entry (no dataset with this ID in config)"})
+			continue
+		case !inLock:
+			issues = append(issues, lockIssue{ID: id, Fatal: true, Msg: "no lock entry (run 'datum fetch " + id + "')"})
+			continue
+		case item == nil:
+			issues = append(issues, lockIssue{ID: id, Fatal: true, Msg: "empty lock entry"})
+			continue
+		}
+
+		issues = append(issues, verifyLockItem(ds, item)...)
+	}
+
+	return issues
+}
+
+// verifyLockItem checks the fields of a single lock entry.
+//
+// An entry that only records an inaccessible source (the first fetch never
+// succeeded) legitimately has no hashes, so those are downgraded to warnings.
+func verifyLockItem(ds *Dataset, item *LockItem) []lockIssue {
+	var issues []lockIssue
+	add := func(fatal bool, format string, args ...any) {
+		issues = append(issues, lockIssue{ID: ds.ID, Fatal: fatal, Msg: fmt.Sprintf(format, args...)})
+	}
+	neverFetched := item.InaccessibleAt != nil && item.LocalSHA256 == "" && item.RemoteFingerprint == ""
+
+	switch {
+	case item.LocalSHA256 == "":
+		add(!neverFetched, "missing local_sha256")
+	case !sha256Hex.MatchString(item.LocalSHA256):
+		add(true, "malformed local_sha256 %q (want 64 lowercase hex characters)", item.LocalSHA256)
+	}
+
+	if item.RemoteFingerprint == "" {
+		add(!neverFetched, "missing remote_fingerprint")
+	} else if types, ok := fingerprintMatchesSources(item.RemoteFingerprint, ds.GetSources()); !ok {
+		add(true, "remote_fingerprint %q does not match the format of source type %s", item.RemoteFingerprint, types)
+	}
+
+	if item.CheckedAt == nil {
+		add(false, "missing checked_at")
+	}
+	if item.InaccessibleAt != nil {
+		add(false, "source marked inaccessible since %s: %s", item.InaccessibleAt.Format(time.RFC3339), item.InaccessibleError)
+	}
+	return issues
+}
+
+// fingerprintMatchesSources reports whether fp could have been produced by any of
+// the dataset's sources. With multiple sources the recorded fingerprint comes from
+// whichever one succeeded, so a match against any of them is sufficient.
+//
+// The returned string lists the checked source types for error messages.
+func fingerprintMatchesSources(fp string, sources []registry.Source) (string, bool) {
+	var types []string
+	for _, src := range sources {
+		re, known := fingerprintFormats[src.Type]
+		if !known || re.MatchString(fp) {
+			return "", true
+		}
+		types = append(types, fmt.Sprintf("%q", src.Type))
+	}
+	return strings.Join(types, " or "), false
+}
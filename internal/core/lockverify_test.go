@@ -0,0 +1,116 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyLock(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	configContent := `version: 1
+datasets:
+  - id: web
+    source:
+      type: http
+      url: https://example.com/data.csv
+    target: data/web.csv
+  - id: repo
+    source:
+      type: git
+      url: https://example.com/repo.git
+      ref: main
+      path: LICENSE
+    target: data/LICENSE
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	const goodLock = `version: 1
+items:
+  web:
+    local_sha256: 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824
+    remote_fingerprint: 'etag:"abc"'
+    checked_at: 2025-10-24T12:00:00Z
+  repo:
+    local_sha256: 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824
+    remote_fingerprint: gitblob:0123456789abcdef0123456789abcdef01234567
+    checked_at: 2025-10-24T12:00:00Z
+`
+
+	tests := []struct {
+		name     string
+		lock     string
+		wantCode int
+	}{
+		{"consistent lockfile", goodLock, 0},
+		{"orphaned entry", goodLock + `  removed:
+    local_sha256: 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824
+    remote_fingerprint: sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824
+    checked_at: 2025-10-24T12:00:00Z
+`, 1},
+		{"unknown key", goodLock + "    local_sha: typo\n", 2},
+		{"wrong fingerprint format for git", strings.Replace(goodLock, "gitblob:0123456789abcdef0123456789abcdef01234567", `etag:"abc"`, 1), 1},
+		{"malformed local hash", strings.Replace(goodLock, "local_sha256: 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824\n    remote_fingerprint: 'etag", "local_sha256: XYZ\n    remote_fingerprint: 'etag", 1), 1},
+		{"unsupported version", strings.Replace(goodLock, "version: 1", "version: 7", 1), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lockPath := filepath.Join(tmpDir, "lock.yaml")
+			if err := os.WriteFile(lockPath, []byte(tt.lock), 0o644); err != nil {
+				t.Fatalf("failed to create test lock: %v", err)
+			}
+			if code := VerifyLock(configPath, lockPath, false); code != tt.wantCode {
+				t.Errorf("VerifyLock() = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	t.Run("missing lockfile", func(t *testing.T) {
+		if code := VerifyLock(configPath, filepath.Join(tmpDir, "nope.yaml"), false); code != 2 {
+			t.Errorf("VerifyLock() = %d, want 2", code)
+		}
+	})
+}
+
+func TestVerifyLockItem(t *testing.T) {
+	ds := &Dataset{ID: "d"}
+	ds.Source.Type = "http"
+
+	t.Run("missing fields are errors", func(t *testing.T) {
+		issues := verifyLockItem(ds, &LockItem{})
+		fatal := 0
+		for _, is := range issues {
+			if is.Fatal {
+				fatal++
+			}
+		}
+		if fatal != 2 {
+			t.Errorf("got %d fatal issues, want 2 (local_sha256 and remote_fingerprint): %+v", fatal, issues)
+		}
+	})
+
+	t.Run("never-fetched entry only warns", func(t *testing.T) {
+		now := time.Date(2025, 10, 24, 12, 0, 0, 0, time.UTC)
+		issues := verifyLockItem(ds, &LockItem{InaccessibleAt: &now, InaccessibleError: "boom"})
+		for _, is := range issues {
+			if is.Fatal {
+				t.Errorf("unexpected fatal issue: %s", is.Msg)
+			}
+		}
+	})
+
+	t.Run("command fingerprints are not format-checked", func(t *testing.T) {
+		cmd := &Dataset{ID: "c"}
+		cmd.Source.Type = "command"
+		if _, ok := fingerprintMatchesSources("anything goes", cmd.GetSources()); !ok {
+			t.Error("command fingerprint should always match")
+		}
+	})
+}
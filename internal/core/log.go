@@ -0,0 +1,174 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel orders status lines by importance; --quiet and --verbose move the
+// cut-off.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota // [DBG ] lines, only shown with --verbose
+	LevelInfo                  // Progress as usual: [OK  ], [FETCH], [INFO], ...
+	LevelWarn                  // Something to look at: [WARN], [CHG ], [STALE], ...
+	LevelError                 // Something failed: [ERR ], [FAIL], "config error: ..."
+)
+
+// String returns the level's name as used in JSON log records.
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "info"
+}
+
+// tagLevels gives the level of each status tag. Tags not listed are info.
+var tagLevels = map[string]LogLevel{
+	"DBG":   LevelDebug,
+	"WARN":  LevelWarn,
+	"CHG":   LevelWarn,
+	"STALE": LevelWarn,
+	"MOVED": LevelWarn,
+	"GONE":  LevelWarn,
+	"ERR":   LevelError,
+	"FAIL":  LevelError,
+}
+
+// statusLine splits "[TAG ] dataset: message" into its parts. The dataset is
+// only recognized right after a tag, where the engine always puts it.
+var statusLine = regexp.MustCompile(`^\[([A-Z ]+?) *\] (?:([^\s:/]+): )?`)
+
+// logger is where status lines go: the [OK  ]-style progress of every
+// command, as opposed to its actual output (tables, reports, data), which
+// is written straight to stdout.
+//
+// Status lines are formatted with plain Printf-style calls throughout the
+// engine, so the level of a line is read from its tag rather than passed in.
+// Indented lines continue the line before them (a change explanation under
+// its [CHG ], say) and share its level and dataset.
+type logger struct {
+	mu      sync.Mutex
+	w       io.Writer // nil = os.Stdout at the time of writing
+	min     LogLevel
+	json    bool
+	now     func() time.Time
+	partial []byte   // Text written without its newline yet
+	level   LogLevel // Level of the last complete line
+	dataset string   // Dataset of the last complete line
+}
+
+// stdlog is the logger logf writes to. Set once at startup via SetLogging;
+// until then it prints every level but debug as text to stdout, which is what
+// tests and library callers see.
+var stdlog = &logger{min: LevelInfo, now: time.Now}
+
+// SetLogging sends status lines to w (the CLI passes stderr, keeping stdout
+// for reports and data), drops those below level ("debug", "info", "warn" or
+// "error") and writes them in format: "text" as they are, or "json" as one
+// object per line for log collectors:
+//
+//	{"time":"2026-10-16T09:14:03Z","level":"warn","tag":"CHG","dataset":"census","msg":"upstream changed"}
+//
+// Go learning note: the package-level logger is the same pattern as
+// SetProgressOutput - one setting for the whole process, fixed before any
+// work starts - so none of the hundred-odd call sites need a logger passed in.
+func SetLogging(w io.Writer, level, format string) error {
+	min, ok := map[string]LogLevel{"debug": LevelDebug, "info": LevelInfo, "warn": LevelWarn, "error": LevelError}[level]
+	if !ok {
+		return fmt.Errorf("unknown log level %q (want debug, info, warn or error)", level)
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+	stdlog.mu.Lock()
+	defer stdlog.mu.Unlock()
+	stdlog.w, stdlog.min, stdlog.json = w, min, format == "json"
+	return nil
+}
+
+// logf writes a status line (or part of one) to the logger, translated if
+// the locale has it.
+func logf(format string, args ...any) {
+	stdlog.Write(fmt.Appendf(nil, tr(format), args...))
+}
+
+// logln is logf for Println-style arguments.
+func logln(args ...any) {
+	stdlog.Write(fmt.Appendln(nil, args...))
+}
+
+// Write logs every complete line in p, holding back a trailing partial line
+// until the rest of it arrives. It never fails: status output is best effort.
+func (l *logger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	buf := append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.line(string(buf[:i]))
+		buf = buf[i+1:]
+	}
+	l.partial = append([]byte(nil), buf...)
+	return len(p), nil
+}
+
+// line classifies one complete line and writes it if its level is shown.
+func (l *logger) line(s string) {
+	tag, msg := "", s
+	switch m := statusLine.FindStringSubmatch(s); {
+	case m != nil:
+		tag, msg = m[1], s[len(m[0]):]
+		l.level, l.dataset = LevelInfo, m[2]
+		if lv, ok := tagLevels[tag]; ok {
+			l.level = lv
+		}
+	case s != "" && (s[0] == ' ' || s[0] == '\t'):
+		// A continuation: keep the level and dataset of the line above
+		msg = strings.TrimSpace(s)
+	case strings.Contains(strings.SplitN(s, ":", 2)[0], "error"):
+		l.level, l.dataset = LevelError, ""
+	default:
+		l.level, l.dataset = LevelInfo, ""
+	}
+	if l.level < l.min {
+		return
+	}
+
+	w := l.w
+	if w == nil {
+		w = os.Stdout
+	}
+	if !l.json {
+		fmt.Fprintln(w, s)
+		return
+	}
+	if msg == "" {
+		return
+	}
+	rec := struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Tag     string `json:"tag,omitempty"`
+		Dataset string `json:"dataset,omitempty"`
+		Msg     string `json:"msg"`
+	}{l.now().UTC().Format(time.RFC3339Nano), l.level.String(), tag, l.dataset, msg}
+	line, _ := json.Marshal(rec)
+	w.Write(append(line, '\n'))
+}
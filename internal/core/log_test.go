@@ -0,0 +1,97 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggerLevels(t *testing.T) {
+	var out bytes.Buffer
+	l := &logger{w: &out, min: LevelWarn, now: time.Now}
+
+	l.Write([]byte("[OK  ] census: up-to-date\n"))
+	l.Write([]byte("[CHG ] weather: upstream changed\n    size 1 KiB -> 2 KiB\n"))
+	l.Write([]byte("[INFO] genome: cached\n    detail of an info line\n"))
+	l.Write([]byte("config error: no datasets\n"))
+	l.Write([]byte("verify: 3 ok\n"))
+
+	want := "[CHG ] weather: upstream changed\n    size 1 KiB -> 2 KiB\nconfig error: no datasets\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestLoggerPartialLines(t *testing.T) {
+	var out bytes.Buffer
+	l := &logger{w: &out, min: LevelInfo, now: time.Now}
+
+	l.Write([]byte("Plan: 1 to fetch"))
+	l.Write([]byte(", 2 failed"))
+	if out.Len() != 0 {
+		t.Fatalf("wrote a partial line: %q", out.String())
+	}
+	l.Write([]byte("\n"))
+	if want := "Plan: 1 to fetch, 2 failed\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestLoggerDebug(t *testing.T) {
+	var out bytes.Buffer
+	l := &logger{w: &out, min: LevelInfo, now: time.Now}
+	l.Write([]byte("[DBG ] census: fetch took 12ms\n"))
+	if out.Len() != 0 {
+		t.Errorf("debug line shown at info: %q", out.String())
+	}
+
+	l.min = LevelDebug
+	l.Write([]byte("[DBG ] census: fetch took 12ms\n"))
+	if !strings.Contains(out.String(), "fetch took") {
+		t.Errorf("debug line missing at debug: %q", out.String())
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var out bytes.Buffer
+	clock := time.Date(2026, 10, 16, 9, 14, 3, 0, time.UTC)
+	l := &logger{w: &out, min: LevelInfo, json: true, now: func() time.Time { return clock }}
+
+	l.Write([]byte("[CHG ] census: upstream changed\n    size 1 KiB -> 2 KiB\n[INFO] retrying 1 failed dataset(s)\n"))
+
+	type record struct {
+		Time, Level, Tag, Dataset, Msg string
+	}
+	var got []record
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var r record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("not JSON: %q: %v", line, err)
+		}
+		got = append(got, r)
+	}
+	want := []record{
+		{"2026-10-16T09:14:03Z", "warn", "CHG", "census", "upstream changed"},
+		{"2026-10-16T09:14:03Z", "warn", "", "census", "size 1 KiB -> 2 KiB"},
+		{"2026-10-16T09:14:03Z", "info", "INFO", "", "retrying 1 failed dataset(s)"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d: %s", len(got), len(want), out.String())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSetLoggingRejectsUnknown(t *testing.T) {
+	if err := SetLogging(nil, "loud", "text"); err == nil {
+		t.Error("accepted level loud")
+	}
+	if err := SetLogging(nil, "info", "xml"); err == nil {
+		t.Error("accepted format xml")
+	}
+}
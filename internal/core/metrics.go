@@ -0,0 +1,138 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+)
+
+// Metrics export: "datum check --metrics-file PATH" writes the run's results
+// in the Prometheus text format, for node-exporter's textfile collector
+// (point --collector.textfile.directory at PATH's directory and name the
+// file *.prom). Each dataset checked gets a series per metric, labelled
+// dataset="<id>":
+//
+//	datum_dataset_stale                        1 if it no longer matches its pin (stale, changed or modified)
+//	datum_dataset_error                        1 if the check ended in an error (e.g. the source is inaccessible)
+//	datum_dataset_last_check_timestamp_seconds when a check last completed without an error
+//	datum_dataset_check_duration_seconds       how long this run's check took
+//	datum_dataset_fetch_duration_seconds       how long the last download took
+//	datum_dataset_failures_total               checks and fetches that ended in an error, ever
+//
+// plus datum_run_timestamp_seconds, datum_run_duration_seconds and
+// datum_run_exit_code for the run itself, so a run that stopped on a config
+// error still shows up. The timestamps and the failure counter live in the
+// status file, so they carry over between runs (and sampled checks). The
+// file is replaced atomically, so the collector never reads half of it.
+
+// metric is one metric family in the export.
+type metric struct {
+	name, typ, help string
+}
+
+var (
+	metricStale     = metric{"datum_dataset_stale", "gauge", "Whether the dataset no longer matches its pin (changed upstream or modified locally)."}
+	metricError     = metric{"datum_dataset_error", "gauge", "Whether the dataset's last check ended in an error."}
+	metricCheckedAt = metric{"datum_dataset_last_check_timestamp_seconds", "gauge", "When a check of the dataset last completed without an error."}
+	metricCheckTime = metric{"datum_dataset_check_duration_seconds", "gauge", "How long the dataset's check took this run."}
+	metricFetchTime = metric{"datum_dataset_fetch_duration_seconds", "gauge", "How long the dataset's last download took."}
+	metricFailures  = metric{"datum_dataset_failures_total", "counter", "Checks and fetches of the dataset that ended in an error."}
+	metricRunAt     = metric{"datum_run_timestamp_seconds", "gauge", "When the last run started."}
+	metricRunTime   = metric{"datum_run_duration_seconds", "gauge", "How long the last run took."}
+	metricRunExit   = metric{"datum_run_exit_code", "gauge", "The last run's exit code."}
+)
+
+// recordCheck notes the outcome of a check or fetch of the dataset in its
+// status item, for the metrics export.
+func (si *StatusItem) recordCheck(status string, now time.Time) {
+	switch status {
+	case "error":
+		si.Failures++
+	case "", "interrupted", "skipped":
+	default:
+		si.CheckedAt = &now
+	}
+}
+
+// writeMetrics writes the run's metrics to path. st may be nil if the run
+// stopped before the status file was read. An empty path does nothing.
+func writeMetrics(path string, rep *Report, st *Status, exit int) error {
+	if path == "" {
+		return nil
+	}
+	var b bytes.Buffer
+	family := func(m metric) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+	}
+	series := func(m metric, id string, v float64) {
+		fmt.Fprintf(&b, "%s{dataset=\"%s\"} %s\n", m.name, escapeLabel(id), strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	datasets := []DatasetReport{}
+	for _, d := range rep.Datasets {
+		if d.Status != "skipped" && d.Status != "interrupted" {
+			datasets = append(datasets, d)
+		}
+	}
+	item := func(id string) *StatusItem {
+		if st == nil || st.Items[id] == nil {
+			return &StatusItem{}
+		}
+		return st.Items[id]
+	}
+
+	if len(datasets) > 0 {
+		family(metricStale)
+		for _, d := range datasets {
+			series(metricStale, d.ID, boolValue(d.Status == "stale" || d.Status == "changed" || d.Status == "modified"))
+		}
+		family(metricError)
+		for _, d := range datasets {
+			series(metricError, d.ID, boolValue(d.Status == "error"))
+		}
+		family(metricCheckedAt)
+		for _, d := range datasets {
+			if at := item(d.ID).CheckedAt; at != nil {
+				series(metricCheckedAt, d.ID, float64(at.Unix()))
+			}
+		}
+		family(metricCheckTime)
+		for _, d := range datasets {
+			series(metricCheckTime, d.ID, d.DurationMS/1000)
+		}
+		family(metricFetchTime)
+		for _, d := range datasets {
+			if t := item(d.ID).FetchTime; t > 0 {
+				series(metricFetchTime, d.ID, t.Seconds())
+			}
+		}
+		family(metricFailures)
+		for _, d := range datasets {
+			series(metricFailures, d.ID, float64(item(d.ID).Failures))
+		}
+	}
+
+	family(metricRunAt)
+	fmt.Fprintf(&b, "%s %d\n", metricRunAt.name, rep.StartedAt.Unix())
+	family(metricRunTime)
+	fmt.Fprintf(&b, "%s %s\n", metricRunTime.name, strconv.FormatFloat(time.Since(rep.StartedAt).Seconds(), 'f', -1, 64))
+	family(metricRunExit)
+	fmt.Fprintf(&b, "%s %d\n", metricRunExit.name, exit)
+	return fsutil.WriteFileAtomic(path, &b)
+}
+
+// escapeLabel escapes a label value for the Prometheus text format.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// boolValue is 1 for true and 0 for false.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
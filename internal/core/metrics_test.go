@@ -0,0 +1,80 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckWithOptions_MetricsFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "source.csv")
+	os.WriteFile(src, []byte("a\n"), 0o644)
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: codes
+    policy: log
+    source:
+      type: mockpath
+      path: `+src+`
+    target: `+filepath.Join(dir, "codes.csv")+`
+`), 0o644)
+	lockPath := filepath.Join(dir, "lock.yaml")
+	metricsPath := filepath.Join(dir, "datum.prom")
+	opts := Options{MetricsFile: metricsPath}
+	if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+		t.Fatalf("Fetch() = %d, want 0", code)
+	}
+
+	wantLines := func(want ...string) {
+		t.Helper()
+		got := mustRead(t, metricsPath)
+		for _, line := range want {
+			if !strings.Contains(got, line+"\n") {
+				t.Errorf("metrics missing %q:\n%s", line, got)
+			}
+		}
+	}
+	CheckWithOptions(cfgPath, lockPath, opts)
+	wantLines(
+		"# TYPE datum_dataset_stale gauge",
+		`datum_dataset_stale{dataset="codes"} 0`,
+		`datum_dataset_error{dataset="codes"} 0`,
+		"# TYPE datum_dataset_failures_total counter",
+		`datum_dataset_failures_total{dataset="codes"} 0`,
+		"datum_run_exit_code 0",
+	)
+	if got := mustRead(t, metricsPath); !strings.Contains(got, `datum_dataset_last_check_timestamp_seconds{dataset="codes"} `) {
+		t.Errorf("metrics missing the last check time:\n%s", got)
+	}
+
+	os.WriteFile(src, []byte("b\n"), 0o644)
+	CheckWithOptions(cfgPath, lockPath, opts)
+	wantLines(`datum_dataset_stale{dataset="codes"} 1`)
+
+	// Failures accumulate across runs in the status file
+	os.Remove(src)
+	CheckWithOptions(cfgPath, lockPath, opts)
+	CheckWithOptions(cfgPath, lockPath, opts)
+	wantLines(
+		`datum_dataset_error{dataset="codes"} 1`,
+		`datum_dataset_failures_total{dataset="codes"} 2`,
+		"datum_run_exit_code 1",
+	)
+
+	// A config error still records the run
+	os.WriteFile(cfgPath, []byte("version: 1\ndatasets: [\n"), 0o644)
+	CheckWithOptions(cfgPath, lockPath, opts)
+	wantLines("datum_run_exit_code 2")
+	if got := mustRead(t, metricsPath); strings.Contains(got, "datum_dataset_") {
+		t.Errorf("metrics after a config error list datasets:\n%s", got)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("escapeLabel() = %q", got)
+	}
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// validateMirrors checks a source's mirror list.
+func validateMirrors(src registry.Source) error {
+	if len(src.Mirrors) == 0 {
+		return nil
+	}
+	if src.Type != "http" {
+		return fmt.Errorf("mirrors: only supported by http sources (list other fallbacks under sources)")
+	}
+	if src.URL == "" {
+		return fmt.Errorf("mirrors: the source needs a url too")
+	}
+	for _, m := range src.Mirrors {
+		if u, err := url.Parse(m); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("mirrors: %q is not an http(s) URL", m)
+		}
+	}
+	return nil
+}
+
+// mirrorMatching returns the first of src's URL and mirrors whose fingerprint
+// is want, or "" if none is.
+//
+// Mirrors serve the same content, but not necessarily with the same ETag or
+// Last-Modified, so the fingerprint of whichever mirror answered first may
+// differ from the one in the lock when nothing changed. Asking each mirror
+// tells a real change from a different mirror answering. Mirrors that fail
+// are skipped: this only looks for a match.
+func mirrorMatching(ctx context.Context, src registry.Source, want string) string {
+	f, ok := registry.Get(src.Type)
+	if !ok {
+		return ""
+	}
+	for _, m := range src.Mirrored() {
+		if fp, err := f.Fingerprint(ctx, m); err == nil && fp == want {
+			return m.URL
+		}
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// mockMirrorHandler fingerprints each URL differently, as mirrors sending
+// their own ETags for the same content do
+type mockMirrorHandler struct{ mockHandler }
+
+func (m *mockMirrorHandler) Name() string { return "mockmirror" }
+
+func (m *mockMirrorHandler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	return "etag:" + src.URL, nil
+}
+
+func init() {
+	registry.Register(&mockMirrorHandler{})
+}
+
+func TestValidateMirrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  registry.Source
+		want string
+	}{
+		{"ok", registry.Source{Type: "http", URL: "https://a.example.org/x", Mirrors: []string{"http://b.example.org/x"}}, ""},
+		{"none", registry.Source{Type: "file", Path: "x"}, ""},
+		{"not http", registry.Source{Type: "sftp", URL: "sftp://a/x", Mirrors: []string{"sftp://b/x"}}, "only supported by http"},
+		{"no url", registry.Source{Type: "http", Mirrors: []string{"https://b.example.org/x"}}, "needs a url"},
+		{"bad mirror", registry.Source{Type: "http", URL: "https://a.example.org/x", Mirrors: []string{"b.example.org/x"}}, "not an http(s) URL"},
+	}
+	for _, tt := range tests {
+		err := validateMirrors(tt.src)
+		if (tt.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: validateMirrors() = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCheckMirrorMatchesLock(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "x.csv")
+	os.WriteFile(target, []byte("data"), 0o644)
+	h, _, _ := HashPath(target)
+	cfg := &Config{Defaults: Defaults{Policy: "fail"}}
+	ds := Dataset{ID: "x", Target: target, Source: registry.Source{
+		Type: "mockmirror", URL: "https://a.example.org/x", Mirrors: []string{"https://b.example.org/x"},
+	}}
+
+	// Pinned from the second mirror; the first one answers now
+	item := &LockItem{LocalSHA256: h, RemoteFingerprint: "etag:https://b.example.org/x"}
+	res := checkDataset(context.Background(), cfg, ds, item.clone(), &StatusItem{}, Options{}, time.Now())
+	if res.exit != 0 || !strings.Contains(res.out.String(), "mirror https://b.example.org/x matches the lock") {
+		t.Errorf("exit %d, output:\n%s", res.exit, res.out.String())
+	}
+
+	// No mirror has the pinned version: that's a change
+	item.RemoteFingerprint = "etag:elsewhere"
+	if res := checkDataset(context.Background(), cfg, ds, item, &StatusItem{}, Options{}, time.Now()); res.exit != 1 {
+		t.Errorf("exit %d for a fingerprint no mirror has, want 1", res.exit)
+	}
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// builtinTypes are the handler types that ship with datum. A binary may
+// still lack some of them: git needs a build tag, and slim builds leave
+// handlers out.
+var builtinTypes = []string{"command", "doi", "dvc", "file", "ftp", "git", "github-release", "http", "huggingface", "sftp", "sql", "torrent"}
+
+// buildHints tell how to get a built-in handler that takes more than the
+// default build, or whose build tags aren't named after its type (tags can't
+// hold a hyphen).
+var buildHints = map[string]string{
+	"git":            "rebuild with the git tag: go build -tags git ./cmd/datum",
+	"github-release": "this build leaves it out; rebuild without -tags no_githubrelease (or, for a slim build, with -tags with_githubrelease)",
+}
+
+// handlerHint tells how to get a handler for typ, which this binary lacks.
+func handlerHint(typ string) string {
+	if hint, ok := buildHints[typ]; ok {
+		return hint
+	}
+	if slices.Contains(builtinTypes, typ) {
+		return fmt.Sprintf("this build leaves it out; rebuild without -tags no_%s (or, for a slim build, with -tags with_%s)", typ, typ)
+	}
+	return fmt.Sprintf("datum has no such handler (a typo?); this binary has: %s", strings.Join(registry.Names(), ", "))
+}
+
+// preflightHandlers finds, before anything runs, the datasets none of whose
+// sources this binary has a handler for, and reports them together, grouped
+// by type, with how to get each handler. Interleaved with the other results
+// they were easy to miss.
+//
+// With skip set (--skip-unknown-handlers) the run goes on without them: they
+// are returned as skipped reports, and the rest are runnable. Otherwise ok is
+// false and the caller stops with exit code 2, as for any config this binary
+// can't serve. Datasets with at least one usable source run either way.
+func preflightHandlers(datasets []Dataset, skip bool) (runnable []Dataset, skipped []DatasetReport, ok bool) {
+	users := map[string][]string{} // Missing type -> IDs of the datasets it strands
+	for _, ds := range datasets {
+		sources := ds.GetSources()
+		var missing []string
+		for _, src := range sources {
+			if _, ok := registry.Get(src.Type); !ok && !slices.Contains(missing, src.Type) {
+				missing = append(missing, src.Type)
+			}
+		}
+		if len(missing) == 0 || slices.ContainsFunc(sources, func(src registry.Source) bool {
+			return !slices.Contains(missing, src.Type)
+		}) {
+			if len(missing) > 0 {
+				logf("[WARN] %s: no %s handler in this build; only its other sources will be tried\n", ds.ID, strings.Join(missing, ", "))
+			}
+			runnable = append(runnable, ds)
+			continue
+		}
+		for _, typ := range missing {
+			users[typ] = append(users[typ], ds.ID)
+		}
+		skipped = append(skipped, DatasetReport{
+			ID:     ds.ID,
+			Status: "skipped",
+			Error:  fmt.Sprintf("no handler for source.type=%q in this build", missing[0]),
+		})
+	}
+	if len(skipped) == 0 {
+		return runnable, nil, true
+	}
+
+	tag := "[ERR ]"
+	if skip {
+		tag = "[WARN]"
+	}
+	logf("%s %d dataset(s) need handlers this datum doesn't have:\n", tag, len(skipped))
+	types := make([]string, 0, len(users))
+	for typ := range users {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	for _, typ := range types {
+		logf("    %s: %s\n", typ, strings.Join(users[typ], ", "))
+		logf("      %s\n", handlerHint(typ))
+	}
+	if !skip {
+		logf("    rerun with --skip-unknown-handlers to go ahead with the other datasets\n")
+		return nil, nil, false
+	}
+	for _, r := range skipped {
+		logf("[SKIP] %s: %s\n", r.ID, r.Error)
+	}
+	return runnable, skipped, true
+}
+
+// Handlers prints the handlers compiled into this binary and the optional
+// capabilities each has, then the built-in ones this build leaves out. It's
+// how to tell what a slim build can serve.
+func Handlers() int {
+	fmt.Printf("%-12s %s\n", "HANDLER", "CAPABILITIES")
+	for _, name := range registry.Names() {
+		f, _ := registry.Get(name)
+		caps := strings.Join(capabilities(f), ", ")
+		fmt.Printf("%-12s %s\n", name, firstNonEmpty(caps, "-"))
+	}
+	first := true
+	for _, typ := range builtinTypes {
+		if _, ok := registry.Get(typ); ok {
+			continue
+		}
+		if first {
+			fmt.Println("\nnot in this build:")
+			first = false
+		}
+		fmt.Printf("  %-12s %s\n", typ, handlerHint(typ))
+	}
+	return 0
+}
+
+// capabilities names the optional interfaces f implements.
+func capabilities(f registry.Fetcher) []string {
+	var caps []string
+	if _, ok := f.(registry.CacheAwareFetcher); ok {
+		caps = append(caps, "cache")
+	}
+	if _, ok := f.(registry.ConditionalFetcher); ok {
+		caps = append(caps, "conditional")
+	}
+	if _, ok := f.(registry.ModTimer); ok {
+		caps = append(caps, "modtime")
+	}
+	if _, ok := f.(registry.Prober); ok {
+		caps = append(caps, "probe")
+	}
+	if _, ok := f.(registry.Relocator); ok {
+		caps = append(caps, "relocate")
+	}
+	return caps
+}
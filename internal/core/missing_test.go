@@ -0,0 +1,93 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSkipUnknownHandlers(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := `version: 1
+datasets:
+  - id: fine
+    source:
+      type: mock
+    target: ` + filepath.Join(tmpDir, "fine.txt") + `
+  - id: needs_git
+    source:
+      type: git
+      url: https://example.org/repo.git
+      path: x.csv
+    target: ` + filepath.Join(tmpDir, "x.csv") + `
+  - id: has_fallback
+    sources:
+      - type: gitt
+      - type: mock
+    target: ` + filepath.Join(tmpDir, "fallback.txt") + `
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	// Without the flag nothing runs
+	if code := FetchWithOptions(configPath, lockPath, nil, Options{}); code != 2 {
+		t.Errorf("fetch = %d, want 2", code)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "fine.txt")); !os.IsNotExist(err) {
+		t.Error("fetch went ahead despite the missing handler")
+	}
+
+	var buf strings.Builder
+	if code := FetchWithOptions(configPath, lockPath, nil, Options{SkipUnknownHandlers: true, Report: &buf}); code != 0 {
+		t.Errorf("fetch --skip-unknown-handlers = %d, want 0", code)
+	}
+	var rep Report
+	if err := json.Unmarshal([]byte(buf.String()), &rep); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, d := range rep.Datasets {
+		got[d.ID] = d.Status
+	}
+	want := map[string]string{"fine": "fetched", "needs_git": "skipped", "has_fallback": "fetched"}
+	for id, status := range want {
+		if got[id] != status {
+			t.Errorf("%s: status %q, want %q (report: %v)", id, got[id], status, got)
+		}
+	}
+
+	if code := CheckWithOptions(configPath, lockPath, Options{SkipUnknownHandlers: true}); code != 0 {
+		t.Errorf("check --skip-unknown-handlers = %d, want 0", code)
+	}
+	if code := CheckWithOptions(configPath, lockPath, Options{}); code != 2 {
+		t.Errorf("check = %d, want 2", code)
+	}
+}
+
+func TestHandlerHint(t *testing.T) {
+	for typ, want := range map[string]string{
+		"git":            "-tags git",
+		"http":           "-tags no_http",
+		"github-release": "-tags no_githubrelease",
+		"htp":            "no such handler",
+	} {
+		if got := handlerHint(typ); !strings.Contains(got, want) {
+			t.Errorf("handlerHint(%q) = %q, want it to mention %q", typ, got, want)
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	if got := capabilities(&mockProber{name: "mockprobe"}); !slices.Contains(got, "probe") {
+		t.Errorf("capabilities(prober) = %v, want probe among them", got)
+	}
+	if got := Handlers(); got != 0 {
+		t.Errorf("Handlers() = %d, want 0", got)
+	}
+}
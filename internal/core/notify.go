@@ -0,0 +1,229 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/httputil"
+)
+
+// Notifier is one entry of the config's notify block: a webhook that check
+// POSTs to when datasets need attention, once per run, listing them all.
+//
+//	notify:
+//	  - url_env: SLACK_WEBHOOK_URL   # webhook URLs are secrets: keep them out of the config
+//	    format: slack
+//	    on: [stale, error]
+//	  - url: https://hooks.example.com/datum
+//
+// Events are "stale" (changed upstream or modified locally, whatever the
+// policy: stale, changed or modified datasets), "error" (the dataset couldn't be
+// checked, e.g. its source is inaccessible) and "updated" (update policy
+// fetched the new version). Without on, all three are sent. A dataset that
+// stays stale or failing is only reported again when that changes.
+type Notifier struct {
+	URL    string   `yaml:"url,omitempty"`     // Webhook URL
+	URLEnv string   `yaml:"url_env,omitempty"` // Variable holding the webhook URL, instead of url
+	Format string   `yaml:"format,omitempty"`  // "json" (default, see notifyPayload), "slack" or "teams"
+	On     []string `yaml:"on,omitempty"`      // Events to send; default all
+}
+
+// notifyEvents are the events a notifier can subscribe to.
+var notifyEvents = []string{"stale", "error", "updated"}
+
+// notifyPayload is the body of a json-format notification.
+//
+// Field names are part of datum's interface for webhook receivers: add
+// fields freely, but don't rename or remove them.
+type notifyPayload struct {
+	Command  string        `json:"command"`
+	RunID    string        `json:"run_id"`
+	Time     time.Time     `json:"time"`
+	Datasets []notifyEvent `json:"datasets"`
+}
+
+// notifyEvent is one dataset in a notification.
+type notifyEvent struct {
+	ID             string `json:"id"`
+	Event          string `json:"event"`  // "stale", "error" or "updated"
+	Status         string `json:"status"` // As in the JSON report (see DatasetReport)
+	Source         string `json:"source,omitempty"`
+	OldFingerprint string `json:"old_fingerprint,omitempty"`
+	NewFingerprint string `json:"new_fingerprint,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Remediation    string `json:"remediation,omitempty"`
+}
+
+// validateNotify checks the notify block.
+func validateNotify(notifiers []Notifier) error {
+	for i, n := range notifiers {
+		switch {
+		case (n.URL == "") == (n.URLEnv == ""):
+			return fmt.Errorf("notify[%d]: set exactly one of url and url_env", i)
+		case n.URL != "" && !strings.HasPrefix(n.URL, "https://") && !strings.HasPrefix(n.URL, "http://"):
+			return fmt.Errorf("notify[%d].url must be an http(s) URL, got %q", i, n.URL)
+		}
+		switch n.Format {
+		case "", "json", "slack", "teams":
+		default:
+			return fmt.Errorf("notify[%d].format: unknown format %q (want json, slack or teams)", i, n.Format)
+		}
+		for _, ev := range n.On {
+			if !slices.Contains(notifyEvents, ev) {
+				return fmt.Errorf("notify[%d].on: unknown event %q (want stale, error or updated)", i, ev)
+			}
+		}
+	}
+	return nil
+}
+
+// datasetEvent is the notification event for a dataset's report, or "" if
+// it needs none.
+func datasetEvent(status string) string {
+	switch status {
+	case "stale", "changed", "modified":
+		return "stale"
+	case "error":
+		return "error"
+	case "updated":
+		return "updated"
+	}
+	return ""
+}
+
+// sendNotifications posts the run's events to every notifier that wants
+// any of them. A dataset is only reported again once something changes:
+// it's still stale, but upstream moved again; it recovered and failed
+// again. What was last sent is kept in its status item. Failures are
+// warnings: a webhook being down mustn't fail a check whose data is fine.
+func sendNotifications(ctx context.Context, cfg *Config, rep *Report, st *Status) {
+	// Work out each dataset's news first, then remember it for next time
+	news := map[string]string{}
+	for _, d := range rep.Datasets {
+		if d.Status == "skipped" || d.Status == "interrupted" {
+			continue
+		}
+		ev := datasetEvent(d.Status)
+		key := ""
+		if ev != "" {
+			key = ev + " " + d.NewFingerprint
+		}
+		si := st.item(d.ID)
+		if ev != "" && (key != si.Notified || ev == "updated") {
+			news[d.ID] = ev
+		}
+		si.Notified = key
+	}
+	if len(news) == 0 {
+		return
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second, Transport: &httputil.BudgetTransport{}}
+	hosts := cfg.hostPolicy()
+	if hosts != nil {
+		client.CheckRedirect = checkRedirectHost(hosts)
+	}
+	for i, n := range cfg.Notify {
+		on := n.On
+		if len(on) == 0 {
+			on = notifyEvents
+		}
+		payload := notifyPayload{Command: rep.Command, RunID: rep.RunID, Time: rep.StartedAt, Datasets: []notifyEvent{}}
+		for _, d := range rep.Datasets {
+			if ev := news[d.ID]; ev != "" && slices.Contains(on, ev) {
+				payload.Datasets = append(payload.Datasets, notifyEvent{
+					ID: d.ID, Event: ev, Status: d.Status, Source: d.Source,
+					OldFingerprint: d.OldFingerprint, NewFingerprint: d.NewFingerprint,
+					Error: d.Error, Remediation: d.Remediation,
+				})
+			}
+		}
+		if len(payload.Datasets) == 0 {
+			continue
+		}
+		hook := n.URL
+		if n.URLEnv != "" {
+			if hook = os.Getenv(n.URLEnv); hook == "" {
+				logf("[WARN] notify[%d]: $%s is not set, notification not sent\n", i, n.URLEnv)
+				continue
+			}
+			if hosts != nil {
+				if err := cfg.checkURLHost(hook); err != nil {
+					logf("[WARN] notify[%d]: $%s: %v; notification not sent\n", i, n.URLEnv, err)
+					continue
+				}
+			}
+		}
+		if err := postNotification(ctx, client, hook, n.Format, payload); err != nil {
+			// The URL may carry a secret token, so it's left out of the message
+			logf("[WARN] notify[%d]: %v\n", i, err)
+			continue
+		}
+		logf("[DBG ] notify[%d]: sent %d dataset(s)\n", i, len(payload.Datasets))
+	}
+}
+
+// postNotification sends payload to the webhook hook in the given format.
+func postNotification(ctx context.Context, client *http.Client, hook, format string, payload notifyPayload) error {
+	var body any = payload
+	switch format {
+	case "slack":
+		body = map[string]string{"text": notifyText(payload, "\n")}
+	case "teams":
+		// Teams renders a single newline as a space
+		body = map[string]string{"text": notifyText(payload, "\n\n")}
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		// The client's error quotes the URL; keep only the cause
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("POST: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("POST: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// notifyText renders payload as chat lines, one per dataset.
+func notifyText(payload notifyPayload, sep string) string {
+	lines := []string{fmt.Sprintf("datum %s (run %s):", payload.Command, payload.RunID)}
+	for _, d := range payload.Datasets {
+		line := fmt.Sprintf("• %s: %s", d.ID, d.Status)
+		switch {
+		case d.Error != "":
+			line += ": " + d.Error
+		case d.NewFingerprint != "":
+			line += fmt.Sprintf(" (%s -> %s)", firstNonEmpty(d.OldFingerprint, "<none>"), d.NewFingerprint)
+		}
+		if d.Remediation != "" {
+			line += "; to accept: " + d.Remediation
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, sep)
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck_Notify(t *testing.T) {
+	posts := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		posts <- b
+	}))
+	defer srv.Close()
+	t.Setenv("DATUM_TEST_SLACK", srv.URL)
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "source.csv")
+	os.WriteFile(src, []byte("a\n"), 0o644)
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte(`version: 1
+notify:
+  - url: `+srv.URL+`
+  - url_env: DATUM_TEST_SLACK
+    format: slack
+    on: [error]
+datasets:
+  - id: codes
+    policy: log
+    source:
+      type: mockpath
+      path: `+src+`
+    target: `+filepath.Join(dir, "codes.csv")+`
+`), 0o644)
+	lockPath := filepath.Join(dir, "lock.yaml")
+	if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+		t.Fatalf("Fetch() = %d, want 0", code)
+	}
+	sent := func() []string {
+		var got []string
+		for {
+			select {
+			case b := <-posts:
+				got = append(got, string(b))
+			default:
+				return got
+			}
+		}
+	}
+
+	Check(cfgPath, lockPath)
+	if got := sent(); len(got) != 0 {
+		t.Errorf("an up-to-date check notified: %q", got)
+	}
+
+	os.WriteFile(src, []byte("b\n"), 0o644)
+	Check(cfgPath, lockPath)
+	got := sent()
+	if len(got) != 1 {
+		t.Fatalf("stale check sent %d notifications, want 1 (the slack one only wants errors)", len(got))
+	}
+	var payload notifyPayload
+	if err := json.Unmarshal([]byte(got[0]), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Datasets) != 1 || payload.Datasets[0].Event != "stale" || payload.Datasets[0].NewFingerprint == "" || payload.Datasets[0].OldFingerprint == payload.Datasets[0].NewFingerprint {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	// Still stale, nothing new to say
+	Check(cfgPath, lockPath)
+	if got := sent(); len(got) != 0 {
+		t.Errorf("a dataset still stale was reported again: %q", got)
+	}
+
+	os.Remove(src)
+	Check(cfgPath, lockPath)
+	got = sent()
+	if len(got) != 2 {
+		t.Fatalf("failing check sent %d notifications, want 2", len(got))
+	}
+	var slack map[string]string
+	json.Unmarshal([]byte(got[1]), &slack)
+	if !strings.Contains(slack["text"], "codes: error") {
+		t.Errorf("slack message = %q", slack["text"])
+	}
+}
+
+func TestValidateNotify(t *testing.T) {
+	for _, n := range []Notifier{
+		{},
+		{URL: "https://a", URLEnv: "B"},
+		{URL: "hooks.example.com"},
+		{URL: "https://a", Format: "email"},
+		{URL: "https://a", On: []string{"fetched"}},
+	} {
+		if err := validateNotify([]Notifier{n}); err == nil {
+			t.Errorf("validateNotify(%+v) succeeded", n)
+		}
+	}
+	if err := validateNotify([]Notifier{{URLEnv: "HOOK", Format: "teams", On: []string{"stale", "updated"}}}); err != nil {
+		t.Errorf("validateNotify() = %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Options controls engine behavior beyond the config and lock paths.
+//
+// The zero value reproduces the default behavior of Check and Fetch, so callers
+// only need to set the fields they care about.
+type Options struct {
+	// LockOut redirects lockfile writes to another path, leaving lockPath untouched.
+	// Empty means write back to lockPath.
+	LockOut string
+
+	// NoWriteLock skips writing the lockfile entirely (e.g. read-only workspaces).
+	NoWriteLock bool
+
+	// StatusFile is where non-pin bookkeeping (re-verification times, observed
+	// fingerprints) is kept. Empty means .data.status.yaml next to the lockfile.
+	StatusFile string
+
+	// Sample limits Check to a subset of datasets per run, either a percentage
+	// ("10%") or a count ("25"). The least recently covered datasets are chosen,
+	// so repeated runs cover the whole config. Empty checks everything.
+	Sample string
+
+	// Tags limits Check and Fetch to datasets tagged with any of these;
+	// ExcludeTags leaves out datasets tagged with any of those (see
+	// selectByTags). Empty selects every dataset.
+	Tags        []string
+	ExcludeTags []string
+
+	// HonorCache makes Check reuse the last observed fingerprint of sources whose
+	// HTTP response is still fresh (Cache-Control max-age / Expires), instead of
+	// asking the server again.
+	HonorCache bool
+
+	// SkipUnknownHandlers lets Check and Fetch go ahead when some datasets
+	// need handlers this binary lacks: those are reported up front and
+	// skipped. Without it such a config stops the run with exit code 2
+	// before anything is done.
+	SkipUnknownHandlers bool
+
+	// Jobs is how many datasets Check and Fetch process concurrently.
+	// Zero or less means runtime.NumCPU().
+	Jobs int
+
+	// RetryRun is how many more passes Check and Fetch make over the
+	// datasets that ended in an error, once the others are done (see
+	// forEachDatasetRetrying). Zero means a single pass.
+	RetryRun int
+
+	// Interactive, when non-nil, makes Check ask what to do about each dataset
+	// whose fail policy tripped (accept the new version, keep failing, or see
+	// a diff), reading the answers from it. Accepted versions are fetched and
+	// written to the lockfile immediately.
+	Interactive io.Reader
+
+	// Report receives a JSON summary of the run (see Report) when non-nil.
+	// Human-readable output still goes to stdout; the CLI moves it to stderr
+	// so the two don't mix.
+	Report io.Writer
+
+	// MetricsFile, when set, is where Check writes the run's results in the
+	// Prometheus text format, for node-exporter's textfile collector (see
+	// metrics.go). It's written however the run ends.
+	MetricsFile string
+
+	// Timeout limits how long each dataset's source operations may take, for
+	// datasets without their own timeout. Zero means no limit.
+	Timeout time.Duration
+
+	// Context, when set, cancels the run once it's done: operations in flight
+	// are aborted, datasets not yet started are skipped, and the lockfile is
+	// still written with everything that finished. The CLI cancels it on
+	// SIGINT/SIGTERM. Nil means the run can't be cancelled.
+	Context context.Context
+
+	// FailOn decides which dataset results fail the run (exit code 1):
+	// "stale" (any change or error), "error" (errors only) or "never".
+	// Empty leaves it to each dataset's policy. Datasets with severity warn
+	// never fail it (see exitcode.go).
+	FailOn string
+
+	// Transactional makes Fetch all or nothing: targets are downloaded to
+	// staging paths and only moved into place, and the lock written, once
+	// every dataset has been fetched (see transaction.go).
+	Transactional bool
+
+	// RunID identifies this run in its output, its JSON report, and the lock
+	// entries it changes (run_id). Pass a CI job's ID to trace every lock
+	// change back to the job that made it; a retried job reusing its ID
+	// writes the same stamps. Empty means a random UUID per run.
+	RunID string
+}
+
+// saveLock writes the updated lockfile according to the options.
+func saveLock(lockPath string, lk *Lock, opts Options) error {
+	if opts.NoWriteLock {
+		return nil
+	}
+	return writeLock(firstNonEmpty(opts.LockOut, lockPath), lk)
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// orderDatasets returns datasets in processing order.
+//
+// Datasets with a higher priority come first, so failures in critical data
+// surface before the rest of a long run. Within the same priority the config
+// order is kept, unless order is "size": then the smallest datasets go first
+// to maximize early completions. Sizes come from the lockfile, falling back to
+// the local target; datasets of unknown size go last. Whatever the order,
+// dependencies come before their dependents (see dependencyOrder).
+func orderDatasets(datasets []Dataset, lk *Lock, order string) []Dataset {
+	out := make([]Dataset, len(datasets))
+	copy(out, datasets)
+
+	sizes := make(map[string]int64, len(out))
+	if order == "size" {
+		for _, ds := range out {
+			sizes[ds.ID] = knownSize(ds, lk)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Priority != out[j].Priority {
+			return out[i].Priority > out[j].Priority
+		}
+		if order == "size" {
+			si, sj := sizes[out[i].ID], sizes[out[j].ID]
+			if (si < 0) != (sj < 0) {
+				return sj < 0 // known sizes before unknown
+			}
+			return si < sj
+		}
+		return false
+	})
+	return dependencyOrder(out)
+}
+
+// knownSize returns the best known size of a dataset in bytes, or -1 if unknown.
+func knownSize(ds Dataset, lk *Lock) int64 {
+	if item := lk.Items[ds.ID]; item != nil && item.Size > 0 {
+		return item.Size
+	}
+	if fi, err := os.Stat(ds.Target); err == nil && !fi.IsDir() {
+		return fi.Size()
+	}
+	return -1
+}
+
+// fileSize returns the size of the file at path, or 0 if it can't be stat'ed.
+// For a directory it's the total size of the regular files inside it.
+func fileSize(path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if !fi.IsDir() {
+		return fi.Size()
+	}
+	var total int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
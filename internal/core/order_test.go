@@ -0,0 +1,56 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOrderDatasets(t *testing.T) {
+	tmpDir := t.TempDir()
+	small := filepath.Join(tmpDir, "small.txt")
+	os.WriteFile(small, []byte("x"), 0o644)
+
+	datasets := []Dataset{
+		{ID: "plain"},
+		{ID: "unknown-size", Target: filepath.Join(tmpDir, "missing.txt")},
+		{ID: "critical", Priority: 10},
+		{ID: "big"},
+		{ID: "small", Target: small},
+	}
+	lk := &Lock{Items: map[string]*LockItem{
+		"plain": {Size: 500},
+		"big":   {Size: 1 << 30},
+	}}
+
+	ids := func(ds []Dataset) string {
+		var out []string
+		for _, d := range ds {
+			out = append(out, d.ID)
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		order string
+		want  string
+	}{
+		{"", "critical,plain,unknown-size,big,small"},
+		{"size", "critical,small,plain,big,unknown-size"},
+	}
+	for _, tt := range tests {
+		t.Run("order="+tt.order, func(t *testing.T) {
+			if got := ids(orderDatasets(datasets, lk, tt.order)); got != tt.want {
+				t.Errorf("orderDatasets() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("input is not modified", func(t *testing.T) {
+		orderDatasets(datasets, lk, "size")
+		if datasets[0].ID != "plain" {
+			t.Error("orderDatasets() reordered its input slice")
+		}
+	})
+}
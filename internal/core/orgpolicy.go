@@ -0,0 +1,353 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// PolicyBundle is the config's policy_bundle block: where to get an
+// organization-wide policy (see OrgPolicy) and the key it must be signed with.
+//
+//	policy_bundle:
+//	  source: {type: http, url: https://policy.example.org/datum/policy.yaml}
+//	  target: .datum/policy.yaml
+//	  public_key: 3q2+7w...   # base64 ed25519 public key
+//
+// The bundle is pinned like a dataset: "datum policy update" downloads it
+// together with its detached signature (the source's URL or path plus ".sig"),
+// verifies the signature, and records the bundle's SHA256 in the lockfile.
+// Check and fetch then apply the local copy only if it still matches both the
+// pin and the signature, so the policy can't change without a signed release
+// and a reviewed lockfile change.
+type PolicyBundle struct {
+	Source    registry.Source `yaml:"source"`     // Where the bundle is published
+	Target    string          `yaml:"target"`     // Local copy; its signature is kept next to it as TARGET.sig
+	PublicKey string          `yaml:"public_key"` // Base64 ed25519 key the bundle must be signed with
+}
+
+// OrgPolicy is the content of a policy bundle: rules every dataset in the
+// config must follow. Breaking one is a config error.
+type OrgPolicy struct {
+	Version int `yaml:"version"`
+
+	// AllowedHosts lists the hosts sources may use; "*.example.org" matches
+	// any subdomain. Empty allows every host. Sources without a URL (file,
+	// command) aren't restricted.
+	AllowedHosts []string `yaml:"allowed_hosts,omitempty"`
+
+	// TagPolicies requires datasets with a tag to use a policy, e.g.
+	// {pii: fail}, so sensitive data can't be updated silently.
+	TagPolicies map[string]string `yaml:"tag_policies,omitempty"`
+
+	// RequireTransparencyLog requires a transparency_log, so every pin is
+	// witnessed (see TransparencyLog)
+	RequireTransparencyLog bool `yaml:"require_transparency_log,omitempty"`
+}
+
+// validatePolicyBundle checks the policy_bundle block, if any.
+func validatePolicyBundle(b *PolicyBundle) error {
+	if b == nil {
+		return nil
+	}
+	if b.Source.Type == "" || (b.Source.URL == "" && b.Source.Path == "") {
+		return fmt.Errorf("policy_bundle.source needs a type and a url or path")
+	}
+	if b.Target == "" {
+		return fmt.Errorf("policy_bundle.target is required")
+	}
+	if _, err := b.publicKey(); err != nil {
+		return fmt.Errorf("policy_bundle.public_key: %w", err)
+	}
+	return nil
+}
+
+// publicKey decodes the bundle's public key.
+func (b *PolicyBundle) publicKey() (ed25519.PublicKey, error) {
+	k, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	if len(k) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("want a %d-byte ed25519 key, got %d bytes", ed25519.PublicKeySize, len(k))
+	}
+	return ed25519.PublicKey(k), nil
+}
+
+// verify checks sig, a base64 ed25519 signature, over bundle.
+func (b *PolicyBundle) verify(bundle, sig []byte) error {
+	key, err := b.publicKey()
+	if err != nil {
+		return err
+	}
+	s, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || !ed25519.Verify(key, bundle, s) {
+		return errors.New("bad signature: the bundle wasn't signed with policy_bundle.public_key")
+	}
+	return nil
+}
+
+// signatureSource returns where the bundle's detached signature is published.
+func signatureSource(src registry.Source) registry.Source {
+	if src.URL != "" {
+		src.URL += ".sig"
+	}
+	if src.Path != "" {
+		src.Path += ".sig"
+	}
+	return src
+}
+
+// parseOrgPolicy reads a bundle's content, rejecting unknown keys so a
+// misspelled rule can't be silently ignored.
+func parseOrgPolicy(b []byte) (*OrgPolicy, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	var p OrgPolicy
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	if p.Version != 1 {
+		return nil, fmt.Errorf("unsupported policy version %d (want 1)", p.Version)
+	}
+	for tag, policy := range p.TagPolicies {
+		if !slices.Contains([]string{"fail", "update", "log"}, policy) {
+			return nil, fmt.Errorf("tag_policies.%s: unknown policy %q", tag, policy)
+		}
+	}
+	return &p, nil
+}
+
+// loadOrgPolicy returns the config's org policy, or nil if it has none. The
+// local copy must match both its pin in the lock and its signature. A missing
+// copy (say, in a fresh clone) is downloaded again, but only the pinned
+// version is accepted.
+func loadOrgPolicy(ctx context.Context, cfg *Config, lk *Lock) (*OrgPolicy, error) {
+	b := cfg.PolicyBundle
+	if b == nil {
+		return nil, nil
+	}
+	if lk.PolicyBundle == nil || lk.PolicyBundle.LocalSHA256 == "" {
+		return nil, errors.New("policy bundle isn't pinned in the lockfile (run 'datum policy update')")
+	}
+	if !fileExists(b.Target) {
+		if err := restorePolicyBundle(ctx, b, lk.PolicyBundle.LocalSHA256); err != nil {
+			return nil, fmt.Errorf("policy bundle %s is missing and couldn't be restored: %w", b.Target, err)
+		}
+	}
+	bundle, err := os.ReadFile(b.Target)
+	if err != nil {
+		return nil, fmt.Errorf("policy bundle: %w", err)
+	}
+	if h := fmt.Sprintf("%x", sha256.Sum256(bundle)); h != lk.PolicyBundle.LocalSHA256 {
+		return nil, fmt.Errorf("policy bundle %s has sha256 %s, but the lock pins %s", b.Target, h, lk.PolicyBundle.LocalSHA256)
+	}
+	sig, err := os.ReadFile(b.Target + ".sig")
+	if err != nil {
+		return nil, fmt.Errorf("policy bundle signature: %w", err)
+	}
+	if err := b.verify(bundle, sig); err != nil {
+		return nil, fmt.Errorf("policy bundle %s: %w", b.Target, err)
+	}
+	p, err := parseOrgPolicy(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("policy bundle %s: %w", b.Target, err)
+	}
+	return p, nil
+}
+
+// enforce checks the config against the policy and returns every violation.
+func (p *OrgPolicy) enforce(cfg *Config) error {
+	var errs []error
+	if p.RequireTransparencyLog && cfg.TransparencyLog == nil {
+		errs = append(errs, errors.New("the organization policy requires a transparency_log"))
+	}
+	for _, ds := range cfg.Datasets {
+		for _, src := range ds.GetSources() {
+			for _, m := range src.Mirrored() {
+				if host := sourceHost(m); host != "" && !p.hostAllowed(host) {
+					errs = append(errs, fmt.Errorf("%s: host %s isn't in the organization's allowed_hosts", ds.ID, host))
+				}
+			}
+		}
+		policy := firstNonEmpty(ds.Policy, cfg.Defaults.Policy)
+		for _, tag := range ds.Tags {
+			if want, ok := p.TagPolicies[tag]; ok && policy != want {
+				errs = append(errs, fmt.Errorf("%s: datasets tagged %s must use policy %s, not %s", ds.ID, tag, want, policy))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hostAllowed reports whether host matches an entry of AllowedHosts.
+func (p *OrgPolicy) hostAllowed(host string) bool {
+	if len(p.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, allowed := range p.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceHost returns the host a source's URL points at, or "" if it has none.
+func sourceHost(src registry.Source) string {
+	if src.URL == "" {
+		return ""
+	}
+	u, err := url.Parse(src.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// applyOrgPolicy loads the config's org policy, if any, and enforces it.
+func applyOrgPolicy(ctx context.Context, cfg *Config, lk *Lock) error {
+	p, err := loadOrgPolicy(ctx, cfg, lk)
+	if err != nil || p == nil {
+		return err
+	}
+	return p.enforce(cfg)
+}
+
+// UpdatePolicy downloads the config's policy bundle and its signature,
+// verifies them, and pins the bundle in the lockfile.
+//
+// Nothing is written unless the signature is valid and the bundle parses, so
+// a compromised or broken release can't replace the policy in force.
+//
+// Returns:
+//   - 0: The bundle is pinned (changed or not)
+//   - 1: It couldn't be downloaded or failed verification
+//   - 2: Configuration error
+func UpdatePolicy(cfgPath, lockPath string, opts Options) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	b := cfg.PolicyBundle
+	if b == nil {
+		logln("config error: no policy_bundle in the config")
+		return 2
+	}
+	lk, err := readLock(lockPath)
+	if err != nil {
+		logf("lock error: %v\n", err)
+		return 2
+	}
+	opts = opts.withRunID()
+
+	bundle, sig, err := downloadPolicyBundle(opts.runContext(), b)
+	if err != nil {
+		logf("[ERR ] policy bundle: %v\n", err)
+		return 1
+	}
+
+	h := fmt.Sprintf("%x", sha256.Sum256(bundle))
+	if old := lk.PolicyBundle; old != nil && old.LocalSHA256 == h && fileExists(b.Target) {
+		logf("[OK  ] policy bundle: unchanged (sha256 %s)\n", h)
+		return 0
+	}
+	if err := writePolicyBundle(b, bundle, sig); err != nil {
+		logf("[ERR ] policy bundle: %v\n", err)
+		return 1
+	}
+	now := time.Now().UTC()
+	lk.Version = 1
+	lk.PolicyBundle = &LockItem{LocalSHA256: h, Size: int64(len(bundle)), CheckedAt: &now, RunID: opts.RunID}
+	if err := saveLock(lockPath, lk, opts); err != nil {
+		logf("lock write error: %v\n", err)
+		return 1
+	}
+	logf("[UPD ] policy bundle: pinned sha256 %s\n", h)
+
+	// Say right away if the config breaks the new policy
+	if err := applyOrgPolicy(opts.runContext(), cfg, lk); err != nil {
+		logf("[WARN] the config breaks the new policy: %v\n", err)
+	}
+	return 0
+}
+
+// downloadPolicyBundle fetches the bundle and its signature, and returns them
+// once the signature checks out and the bundle parses.
+func downloadPolicyBundle(ctx context.Context, b *PolicyBundle) (bundle, sig []byte, err error) {
+	dir, err := fsutil.MkdirTemp("datum-policy-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if bundle, err = fetchBytes(ctx, b.Source, filepath.Join(dir, "bundle")); err != nil {
+		return nil, nil, err
+	}
+	if sig, err = fetchBytes(ctx, signatureSource(b.Source), filepath.Join(dir, "bundle.sig")); err != nil {
+		return nil, nil, fmt.Errorf("signature: %w", err)
+	}
+	if err := b.verify(bundle, sig); err != nil {
+		return nil, nil, err
+	}
+	if _, err := parseOrgPolicy(bundle); err != nil {
+		return nil, nil, err
+	}
+	return bundle, sig, nil
+}
+
+// restorePolicyBundle downloads the bundle into its target, provided the
+// published bundle is still the pinned one.
+func restorePolicyBundle(ctx context.Context, b *PolicyBundle, pin string) error {
+	bundle, sig, err := downloadPolicyBundle(ctx, b)
+	if err != nil {
+		return err
+	}
+	if h := fmt.Sprintf("%x", sha256.Sum256(bundle)); h != pin {
+		return fmt.Errorf("the published bundle has sha256 %s, but the lock pins %s (review it, then run 'datum policy update')", h, pin)
+	}
+	return writePolicyBundle(b, bundle, sig)
+}
+
+// writePolicyBundle writes the bundle and its signature to the target.
+func writePolicyBundle(b *PolicyBundle, bundle, sig []byte) error {
+	if err := fsutil.WriteFileAtomic(b.Target, bytes.NewReader(bundle)); err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(b.Target+".sig", bytes.NewReader(sig))
+}
+
+// fetchBytes fetches src into dest with its handler and returns the content.
+// It's for small files such as policy bundles.
+func fetchBytes(ctx context.Context, src registry.Source, dest string) ([]byte, error) {
+	f, ok := registry.Get(src.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown source.type=%q", src.Type)
+	}
+	if err := f.Fetch(ctx, src, dest); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(dest)
+}
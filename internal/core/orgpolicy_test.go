@@ -0,0 +1,133 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestPolicyBundle(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := t.TempDir()
+	published := filepath.Join(tmpDir, "published", "policy.yaml")
+	os.MkdirAll(filepath.Dir(published), 0o755)
+	publish := func(body string, key ed25519.PrivateKey) {
+		t.Helper()
+		os.WriteFile(published, []byte(body), 0o644)
+		sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(body)))
+		os.WriteFile(published+".sig", []byte(sig+"\n"), 0o644)
+	}
+
+	target := filepath.Join(tmpDir, "policy.yaml")
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	writeConfig := func(datasets string) {
+		t.Helper()
+		config := "version: 1\npolicy_bundle:\n  source: {type: file, path: " + published + "}\n  target: " + target +
+			"\n  public_key: " + base64.StdEncoding.EncodeToString(pub) + "\ndatasets:\n" + datasets
+		if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	compliant := "  - id: census\n    tags: [pii]\n    source: {type: mock, url: https://data.example.org/census.csv}\n    target: " + filepath.Join(tmpDir, "census.csv") + "\n"
+	writeConfig(compliant)
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	// Nothing runs until the bundle is pinned
+	if code := Check(configPath, lockPath); code != 2 {
+		t.Errorf("check without a pinned bundle = %d, want 2", code)
+	}
+
+	// A bundle signed with another key is refused
+	_, other, _ := ed25519.GenerateKey(nil)
+	policy := "version: 1\nallowed_hosts: ['*.example.org']\ntag_policies: {pii: fail}\n"
+	publish(policy, other)
+	if code := UpdatePolicy(configPath, lockPath, Options{}); code != 1 || fileExists(target) {
+		t.Errorf("update with a bad signature = %d (target written: %v), want 1 and nothing written", code, fileExists(target))
+	}
+
+	publish(policy, priv)
+	if code := UpdatePolicy(configPath, lockPath, Options{}); code != 0 {
+		t.Fatalf("update = %d", code)
+	}
+	lk, _ := readLock(lockPath)
+	if lk.PolicyBundle == nil || lk.PolicyBundle.LocalSHA256 == "" || !fileExists(target+".sig") {
+		t.Fatalf("bundle not pinned: %+v", lk.PolicyBundle)
+	}
+	if code := Fetch(configPath, lockPath, nil); code != 0 {
+		t.Errorf("fetch of a compliant config = %d, want 0", code)
+	}
+
+	// A missing local copy is restored, as long as upstream is still the pinned one
+	os.Remove(target)
+	if code := Check(configPath, lockPath); code != 0 || !fileExists(target) {
+		t.Errorf("check with the bundle missing = %d (restored: %v), want 0", code, fileExists(target))
+	}
+	publish(policy+"require_transparency_log: true\n", priv)
+	os.Remove(target)
+	if code := Check(configPath, lockPath); code != 2 {
+		t.Errorf("check restoring a bundle that changed upstream = %d, want 2", code)
+	}
+	publish(policy, priv)
+
+	// The local copy must match the pin
+	if err := os.WriteFile(target, []byte("version: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code := Check(configPath, lockPath); code != 2 {
+		t.Errorf("check with an edited bundle = %d, want 2", code)
+	}
+	os.Remove(target)
+
+	// Violations are config errors
+	for name, datasets := range map[string]string{
+		"host":       "  - id: x\n    policy: fail\n    source: {type: mock, url: https://evil.example.com/x.csv}\n    target: x.csv\n",
+		"tag policy": "  - id: x\n    tags: [pii]\n    policy: update\n    source: {type: mock, url: https://data.example.org/x.csv}\n    target: x.csv\n",
+	} {
+		writeConfig(datasets)
+		if code := Check(configPath, lockPath); code != 2 {
+			t.Errorf("%s violation: check = %d, want 2", name, code)
+		}
+	}
+}
+
+func TestOrgPolicyEnforce(t *testing.T) {
+	p, err := parseOrgPolicy([]byte("version: 1\nallowed_hosts: [data.gov, '*.example.org']\ntag_policies: {pii: fail}\nrequire_transparency_log: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, want := range map[string]bool{
+		"data.gov": true, "DATA.GOV": true, "www.data.gov": false,
+		"a.example.org": true, "example.org": false, "example.org.evil.com": false,
+	} {
+		if got := p.hostAllowed(host); got != want {
+			t.Errorf("hostAllowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+
+	cfg := &Config{Defaults: Defaults{Policy: "fail"}, Datasets: []Dataset{
+		{ID: "ok", Tags: []string{"pii"}, Source: registry.Source{Type: "mock", URL: "https://a.example.org/x"}},
+		{ID: "loose", Tags: []string{"pii"}, Policy: "log", Source: registry.Source{Type: "mock", URL: "https://data.gov/y"}},
+	}}
+	err = p.enforce(cfg)
+	if err == nil || !strings.Contains(err.Error(), "loose: datasets tagged pii must use policy fail") || !strings.Contains(err.Error(), "transparency_log") {
+		t.Errorf("enforce() = %v", err)
+	}
+
+	for name, body := range map[string]string{
+		"unknown key":    "version: 1\nallowed_host: [x]\n",
+		"unknown policy": "version: 1\ntag_policies: {pii: strict}\n",
+		"no version":     "allowed_hosts: [x]\n",
+	} {
+		if _, err := parseOrgPolicy([]byte(body)); err == nil {
+			t.Errorf("%s: parsed without error", name)
+		}
+	}
+}
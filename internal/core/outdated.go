@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Outdated reports which datasets are behind, without changing anything.
+//
+// Each dataset's remote fingerprint is compared with the lock, like check does,
+// but no policy is applied and nothing is fetched or written. With discover
+// set, datasets that have a discover block are also checked for newer
+// versions than the one their URL or ref pins, and the updated URL/ref is
+// suggested (see Discover).
+//
+// Parameters:
+//   - cfgPath: Path to the configuration file
+//   - lockPath: Path to the lockfile
+//   - discover: Also run discover blocks
+//   - opts: Jobs sets the concurrency
+//
+// Returns:
+//   - 0: Everything is current
+//   - 1: Some dataset is outdated, or couldn't be checked
+//   - 2: Configuration error
+func Outdated(cfgPath, lockPath string, discover bool, opts Options) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	lk, err := readLock(lockPath)
+	if err != nil {
+		logf("lock error: %v\n", err)
+		return 2
+	}
+
+	ctx := context.Background()
+	datasets := orderDatasets(cfg.Datasets, lk, cfg.Defaults.Order)
+	items := make([]*LockItem, len(datasets))
+	for i, ds := range datasets {
+		items[i] = lk.Items[ds.ID].clone()
+	}
+
+	exit := 0
+	forEachDataset(opts.Jobs, len(datasets), func(i int) *datasetResult {
+		return outdatedDataset(ctx, datasets[i], items[i], discover)
+	}, func(i int, res *datasetResult) {
+		if res.exit > exit {
+			exit = res.exit
+		}
+	})
+	return exit
+}
+
+// outdatedDataset checks one dataset for Outdated. It runs on a worker
+// goroutine and only reads item, a private copy of the lock entry.
+func outdatedDataset(ctx context.Context, ds Dataset, item *LockItem, discover bool) *datasetResult {
+	res := newDatasetResult(ds.ID)
+
+	switch fp, err := firstFingerprint(ctx, ds.GetSources()); {
+	case err != nil:
+		res.printf("[ERR ] %s: fingerprint: %v\n", ds.ID, err)
+		res.exit = 1
+	case item == nil || item.RemoteFingerprint == "":
+		res.printf("[STALE] %s: not fetched yet\n", ds.ID)
+		res.exit = 1
+	case fp != item.RemoteFingerprint:
+		res.printf("[STALE] %s: changed upstream (%s -> %s)\n", ds.ID, item.RemoteFingerprint, fp)
+		res.exit = 1
+	default:
+		res.printf("[OK  ] %s: up to date\n", ds.ID)
+	}
+
+	if !discover || ds.Discover == nil {
+		return res
+	}
+	found, err := discoverLatest(ctx, ds)
+	switch {
+	case err != nil:
+		res.printf("[ERR ] %s: %v\n", ds.ID, err)
+		res.exit = 1
+	case found.pinned == "":
+		res.printf("[WARN] %s: pinned source doesn't match discover.pattern; newest available is %s\n", ds.ID, found.latest)
+		if found.suggest != "" {
+			res.printf("         suggested %s: %s\n", found.field, found.suggest)
+		}
+		res.exit = 1
+	case compareVersions(found.latest, found.pinned) > 0:
+		res.printf("[STALE] %s: version %s available (pinned %s)\n", ds.ID, found.latest, found.pinned)
+		res.printf("         suggested %s: %s\n", found.field, found.suggest)
+		res.exit = 1
+	default:
+		res.printf("[OK  ] %s: %s is the newest version\n", ds.ID, found.pinned)
+	}
+	return res
+}
+
+// firstFingerprint returns the fingerprint of the first source that can be fingerprinted.
+func firstFingerprint(ctx context.Context, sources []registry.Source) (string, error) {
+	_, fp, err := firstFingerprintSource(ctx, sources)
+	return fp, err
+}
+
+// firstFingerprintSource is firstFingerprint, also returning the source that
+// answered.
+func firstFingerprintSource(ctx context.Context, sources []registry.Source) (registry.Source, string, error) {
+	var lastErr error
+	for _, src := range sources {
+		f, ok := registry.Get(src.Type)
+		if !ok {
+			lastErr = fmt.Errorf("unknown source.type=%q", src.Type)
+			continue
+		}
+		fp, err := f.Fingerprint(ctx, src)
+		if err == nil {
+			return src, fp, nil
+		}
+		lastErr = err
+	}
+	return registry.Source{}, "", lastErr
+}
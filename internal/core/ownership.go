@@ -0,0 +1,27 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+)
+
+// applyOwnership sets the owner and group of a freshly fetched target, so data
+// under a shared directory is usable by the whole analysis group rather than
+// only the account datum ran as.
+//
+// The dataset's owner/group override the defaults. With neither set, a target
+// in a setgid directory still takes on that directory's group (see
+// fsutil.SetOwnership).
+//
+// A failure is returned for the caller to report as a warning: the data itself
+// was fetched correctly and is recorded in the lock, so it shouldn't fail the
+// run when, say, a developer without root fetches a config meant for CI.
+func applyOwnership(ds Dataset, cfg *Config) error {
+	owner := firstNonEmpty(ds.Owner, cfg.Defaults.Owner)
+	group := firstNonEmpty(ds.Group, cfg.Defaults.Group)
+	if err := fsutil.SetOwnership(ds.Target, owner, group); err != nil {
+		return fmt.Errorf("ownership: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestApplyOwnership(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing ownership needs root")
+	}
+	dir := t.TempDir()
+	cfg := &Config{Defaults: Defaults{Owner: "4242", Group: "4343"}}
+	tests := []struct {
+		name     string
+		ds       Dataset
+		uid, gid uint32
+	}{
+		{"defaults", Dataset{ID: "a"}, 4242, 4343},
+		{"dataset overrides group", Dataset{ID: "b", Group: "4444"}, 4242, 4444},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.ds.Target = filepath.Join(dir, tt.ds.ID+".csv")
+			if err := os.WriteFile(tt.ds.Target, []byte("x"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyOwnership(tt.ds, cfg); err != nil {
+				t.Fatal(err)
+			}
+			fi, _ := os.Stat(tt.ds.Target)
+			st := fi.Sys().(*syscall.Stat_t)
+			if st.Uid != tt.uid || st.Gid != tt.gid {
+				t.Errorf("owner = %d:%d, want %d:%d", st.Uid, st.Gid, tt.uid, tt.gid)
+			}
+		})
+	}
+}
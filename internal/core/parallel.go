@@ -0,0 +1,74 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// datasetResult is everything processing one dataset produced.
+//
+// Workers build these instead of printing or updating the lock directly; the
+// engine applies them one at a time, in dataset order, so output stays grouped
+// per dataset and the lockfile is only written once at the end.
+type datasetResult struct {
+	out           bytes.Buffer  // Output lines for this dataset
+	lock          *LockItem     // New lock entry (nil = leave the lock unchanged)
+	statusChanged bool          // The worker's status item copy should be stored
+	exit          int           // 0 = ok, 1 = failure
+	report        DatasetReport // Machine-readable summary (see Report)
+}
+
+// printf appends a line of output for the dataset, translated if the locale
+// has it.
+func (r *datasetResult) printf(format string, args ...any) {
+	fmt.Fprintf(&r.out, tr(format), args...)
+}
+
+// forEachDataset runs work for datasets 0..n-1 on up to jobs goroutines.
+//
+// apply is called on the calling goroutine with each result in index order, as
+// soon as that result and all earlier ones are ready; the dataset's buffered
+// output is printed just before. Each result's report records how long its work
+// took. jobs < 1 means runtime.NumCPU().
+//
+// Go learning note: the buffered channel sem works as a counting semaphore -
+// sending blocks once jobs workers are running, and each worker frees a slot
+// when it finishes. Giving every dataset its own result channel lets apply
+// consume them in order regardless of which worker finishes first.
+func forEachDataset(jobs, n int, work func(i int) *datasetResult, apply func(i int, res *datasetResult)) {
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+
+	results := make([]chan *datasetResult, n)
+	for i := range results {
+		results[i] = make(chan *datasetResult, 1)
+	}
+
+	var wg sync.WaitGroup
+	go func() {
+		sem := make(chan struct{}, jobs)
+		for i := 0; i < n; i++ {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				start := time.Now()
+				res := work(i)
+				res.report.DurationMS = milliseconds(time.Since(start))
+				results[i] <- res
+			}(i)
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		res := <-results[i]
+		stdlog.Write(res.out.Bytes())
+		apply(i, res)
+	}
+	wg.Wait()
+}
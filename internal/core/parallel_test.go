@@ -0,0 +1,82 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachDataset(t *testing.T) {
+	const n = 8
+	var running, peak int32
+	var applied []int
+
+	forEachDataset(3, n, func(i int) *datasetResult {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if cur <= p || atomic.CompareAndSwapInt32(&peak, p, cur) {
+				break
+			}
+		}
+		// Later datasets finish first, so ordering must come from forEachDataset
+		time.Sleep(time.Duration(n-i) * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return &datasetResult{exit: i}
+	}, func(i int, res *datasetResult) {
+		if res.exit != i {
+			t.Errorf("apply(%d) got the result of dataset %d", i, res.exit)
+		}
+		applied = append(applied, i)
+	})
+
+	if len(applied) != n {
+		t.Fatalf("applied %d results, want %d", len(applied), n)
+	}
+	for i, got := range applied {
+		if got != i {
+			t.Errorf("applied[%d] = %d, want results in dataset order", i, got)
+		}
+	}
+	if peak > 3 {
+		t.Errorf("%d workers ran at once, want at most 3", peak)
+	}
+}
+
+func TestCheckWithJobs(t *testing.T) {
+	tmpDir := t.TempDir()
+	var b strings.Builder
+	b.WriteString("version: 1\ndefaults:\n  policy: update\ndatasets:\n")
+	for i := 0; i < 12; i++ {
+		fmt.Fprintf(&b, "  - id: d%02d\n    source:\n      type: mock\n    target: %s\n", i, filepath.Join(tmpDir, fmt.Sprintf("d%02d.txt", i)))
+	}
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	if code := CheckWithOptions(configPath, lockPath, Options{Jobs: 4}); code != 0 {
+		t.Fatalf("CheckWithOptions() = %d, want 0", code)
+	}
+	lk, err := readLock(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lk.Items) != 12 {
+		t.Errorf("lock has %d items, want 12", len(lk.Items))
+	}
+	for id, item := range lk.Items {
+		if item.RemoteFingerprint != "mock-fp" || item.LocalSHA256 == "" {
+			t.Errorf("%s: incomplete lock entry %+v", id, item)
+		}
+	}
+
+	if code := FetchWithOptions(configPath, lockPath, nil, Options{Jobs: 4}); code != 0 {
+		t.Errorf("FetchWithOptions() = %d, want 0", code)
+	}
+}
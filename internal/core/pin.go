@@ -0,0 +1,326 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// pinBackend publishes files to a content-addressed network.
+type pinBackend interface {
+	// push uploads and pins the file at path, returning its content identifier.
+	push(ctx context.Context, path string) (string, error)
+	// source returns a fetchable source for a content identifier.
+	source(cid string) registry.Source
+}
+
+// pinBackends maps each supported --backend value to its constructor.
+//
+// Only IPFS is implemented; Sia and Arweave would slot in here with their own
+// upload APIs and gateway URLs.
+var pinBackends = map[string]func() pinBackend{
+	"ipfs": newIPFSBackend,
+}
+
+// ipfsBackend talks to an IPFS node's RPC API (kubo) and serves content back
+// through an HTTP gateway, so the recorded fallback is a plain http source.
+type ipfsBackend struct {
+	api     string // RPC API base URL ($IPFS_API, default http://127.0.0.1:5001)
+	gateway string // Gateway base URL ($IPFS_GATEWAY, default https://ipfs.io)
+	client  *http.Client
+}
+
+func newIPFSBackend() pinBackend {
+	return &ipfsBackend{
+		api:     strings.TrimSuffix(firstNonEmpty(os.Getenv("IPFS_API"), "http://127.0.0.1:5001"), "/"),
+		gateway: strings.TrimSuffix(firstNonEmpty(os.Getenv("IPFS_GATEWAY"), "https://ipfs.io"), "/"),
+		client:  &http.Client{Timeout: 30 * time.Minute, Transport: &httputil.BudgetTransport{}},
+	}
+}
+
+// push streams the file to /api/v0/add as multipart form data and pins it.
+func (b *ipfsBackend) push(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Stream the body through a pipe so large targets aren't held in memory
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", filepath.Base(path))
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.api+"/api/v0/add?pin=true&cid-version=1", pr)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("ipfs add: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var out struct{ Hash string }
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("ipfs add: %w", err)
+	}
+	if out.Hash == "" {
+		return "", fmt.Errorf("ipfs add: no CID in response")
+	}
+	return out.Hash, nil
+}
+
+func (b *ipfsBackend) source(cid string) registry.Source {
+	return registry.Source{Type: "http", URL: b.gateway + "/ipfs/" + cid}
+}
+
+// PinPush publishes locked artifacts to a content-addressed network.
+//
+// Each selected dataset's target is verified against the lockfile (only pinned
+// data is published), uploaded to the backend, and the resulting gateway URL is
+// appended to the dataset's sources in the config as a fallback. Datasets with
+// a single "source:" are converted to a "sources:" list. If the origin ever
+// disappears, fetch and check fall through to the published copy.
+//
+// Parameters:
+//   - cfgPath: Path to the configuration file (.data.yaml)
+//   - lockPath: Path to the lockfile (.data.lock.yaml)
+//   - backend: Backend name (currently only "ipfs")
+//   - ids: Dataset IDs to publish; empty means all
+//
+// Returns:
+//   - 0: Every selected dataset was published and recorded
+//   - 1: One or more datasets couldn't be published (the rest are still recorded)
+//   - 2: Configuration error or unknown backend
+func PinPush(cfgPath, lockPath, backend string, ids []string) int {
+	newBackend, ok := pinBackends[backend]
+	if !ok {
+		logf("pin error: unknown backend %q\n", backend)
+		return 2
+	}
+	b := newBackend()
+
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	lk, err := readLock(lockPath)
+	if err != nil {
+		logf("lock error: %v\n", err)
+		return 2
+	}
+
+	selected := map[string]bool{}
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	ctx := context.Background()
+	exit := 0
+	added := map[string]registry.Source{}
+	found := map[string]bool{}
+	for _, ds := range cfg.Datasets {
+		if len(selected) > 0 && !selected[ds.ID] {
+			continue
+		}
+		found[ds.ID] = true
+
+		if cfg.handlingFor(ds).NoMirror {
+			logf("[ERR ] %s: %s data may not be mirrored, refusing to publish\n", ds.ID, cfg.classificationOf(ds))
+			exit = 1
+			continue
+		}
+		item := lk.Items[ds.ID]
+		if item == nil || item.LocalSHA256 == "" {
+			logf("[ERR ] %s: not pinned in the lockfile (run 'datum fetch %s')\n", ds.ID, ds.ID)
+			exit = 1
+			continue
+		}
+		if h, _, err := HashPath(ds.Target); err != nil || h != item.LocalSHA256 {
+			logf("[ERR ] %s: %s does not match the lockfile, refusing to publish\n", ds.ID, ds.Target)
+			exit = 1
+			continue
+		}
+
+		cid, err := b.push(ctx, ds.Target)
+		if err != nil {
+			logf("[ERR ] %s: %v\n", ds.ID, err)
+			exit = 1
+			continue
+		}
+		src := b.source(cid)
+		if hasSourceURL(ds.GetSources(), src.URL) {
+			logf("[OK  ] %s: %s (already a fallback source)\n", ds.ID, cid)
+			continue
+		}
+		added[ds.ID] = src
+		logf("[OK  ] %s: %s -> %s\n", ds.ID, cid, src.URL)
+	}
+
+	for _, id := range ids {
+		if !found[id] {
+			logf("[ERR ] %s: no such dataset\n", id)
+			exit = 1
+		}
+	}
+
+	if len(added) == 0 {
+		return exit
+	}
+	// Each source goes into the file that defines its dataset
+	byFile := map[string]map[string]registry.Source{}
+	for _, ds := range cfg.Datasets {
+		if src, ok := added[ds.ID]; ok {
+			file := firstNonEmpty(ds.file, cfgPath)
+			if byFile[file] == nil {
+				byFile[file] = map[string]registry.Source{}
+			}
+			byFile[file][ds.ID] = src
+		}
+	}
+	for _, file := range configFiles(cfgPath, cfg) {
+		if len(byFile[file]) == 0 {
+			continue
+		}
+		b0, err := os.ReadFile(file)
+		if err != nil {
+			logf("config error: %v\n", err)
+			return 2
+		}
+		out, err := addFallbackSources(b0, byFile[file])
+		if err != nil {
+			logf("config error: %s: %v\n", file, err)
+			return 2
+		}
+		if err := fsutil.WriteFileAtomic(file, bytes.NewReader(out)); err != nil {
+			logf("write config error: %v\n", err)
+			return 1
+		}
+		logf("recorded %d fallback source(s) in %s\n", len(byFile[file]), file)
+	}
+	return exit
+}
+
+// hasSourceURL reports whether any of sources already points at url.
+func hasSourceURL(sources []registry.Source, url string) bool {
+	for _, s := range sources {
+		if s.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+// addFallbackSources appends a source to each listed dataset in the config document.
+//
+// The document is edited as a yaml.Node tree so comments survive; a dataset's
+// single "source:" mapping is turned into a "sources:" list first. The result is
+// re-encoded with two-space indentation.
+func addFallbackSources(b []byte, added map[string]registry.Source) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("empty config")
+	}
+	datasets := mappingValue(doc.Content[0], "datasets")
+	if datasets == nil || datasets.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("config has no datasets list")
+	}
+
+	done := map[string]bool{}
+	for _, ds := range datasets.Content {
+		id := mappingValue(ds, "id")
+		if id == nil {
+			continue
+		}
+		src, ok := added[id.Value]
+		if !ok {
+			continue
+		}
+		var srcNode yaml.Node
+		if err := srcNode.Encode(src); err != nil {
+			return nil, err
+		}
+
+		if list := mappingValue(ds, "sources"); list != nil {
+			list.Content = append(list.Content, &srcNode)
+		} else {
+			for i := 0; i+1 < len(ds.Content); i += 2 {
+				if ds.Content[i].Value == "source" {
+					ds.Content[i].Value = "sources"
+					ds.Content[i+1] = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{ds.Content[i+1], &srcNode}}
+					break
+				}
+			}
+		}
+		done[id.Value] = true
+	}
+
+	var missing []string
+	for id := range added {
+		if !done[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("datasets not found in config: %s", strings.Join(missing, ", "))
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mappingValue returns the value node for key in a YAML mapping node, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
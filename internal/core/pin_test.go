@@ -0,0 +1,113 @@
+package core
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPinPush(t *testing.T) {
+	var uploaded string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v0/add" || r.URL.Query().Get("pin") != "true" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(f)
+		uploaded = string(b)
+		w.Write([]byte(`{"Name":"a.csv","Hash":"bafytestcid","Size":"9"}`))
+	}))
+	defer api.Close()
+	t.Setenv("IPFS_API", api.URL)
+	t.Setenv("IPFS_GATEWAY", "https://gw.example")
+
+	tmpDir := t.TempDir()
+	target := filepath.Join(tmpDir, "a.csv")
+	if err := os.WriteFile(target, []byte("mock data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum, _ := HashFile(target)
+
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := `version: 1
+datasets:
+  # published to IPFS
+  - id: a
+    desc: single source
+    source:
+      type: mock
+      url: https://origin.example/a.csv
+    target: ` + target + `
+  - id: b
+    desc: not pinned
+    source:
+      type: mock
+    target: ` + filepath.Join(tmpDir, "b.csv") + `
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+	if err := writeLock(lockPath, &Lock{Version: 1, Items: map[string]*LockItem{"a": {LocalSHA256: sum, RemoteFingerprint: "mock-fp"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("unknown backend", func(t *testing.T) {
+		if code := PinPush(configPath, lockPath, "floppy", nil); code != 2 {
+			t.Errorf("PinPush() = %d, want 2", code)
+		}
+	})
+
+	t.Run("publishes pinned targets", func(t *testing.T) {
+		if code := PinPush(configPath, lockPath, "ipfs", []string{"a"}); code != 0 {
+			t.Fatalf("PinPush() = %d, want 0", code)
+		}
+		if uploaded != "mock data" {
+			t.Errorf("uploaded %q, want target content", uploaded)
+		}
+		cfg, err := readConfig(configPath)
+		if err != nil {
+			t.Fatalf("rewritten config does not load: %v", err)
+		}
+		sources := cfg.Datasets[0].GetSources()
+		if len(sources) != 2 || sources[0].URL != "https://origin.example/a.csv" || sources[1].URL != "https://gw.example/ipfs/bafytestcid" {
+			t.Errorf("sources = %+v, want origin then IPFS gateway fallback", sources)
+		}
+		if b, _ := os.ReadFile(configPath); !strings.Contains(string(b), "# published to IPFS") {
+			t.Error("comment lost while rewriting config")
+		}
+	})
+
+	t.Run("already recorded", func(t *testing.T) {
+		before, _ := os.ReadFile(configPath)
+		if code := PinPush(configPath, lockPath, "ipfs", []string{"a"}); code != 0 {
+			t.Fatalf("PinPush() = %d, want 0", code)
+		}
+		if after, _ := os.ReadFile(configPath); string(after) != string(before) {
+			t.Error("config rewritten although the fallback was already present")
+		}
+	})
+
+	t.Run("unpinned dataset", func(t *testing.T) {
+		if code := PinPush(configPath, lockPath, "ipfs", []string{"b"}); code != 1 {
+			t.Errorf("PinPush() = %d, want 1", code)
+		}
+	})
+
+	t.Run("modified target is refused", func(t *testing.T) {
+		os.WriteFile(target, []byte("tampered"), 0o644)
+		defer os.WriteFile(target, []byte("mock data"), 0o644)
+		if code := PinPush(configPath, lockPath, "ipfs", []string{"a"}); code != 1 {
+			t.Errorf("PinPush() = %d, want 1", code)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// probeTimeout bounds each handler's probe when --timeout isn't set, so one
+// unreachable host doesn't hold up the rest.
+const probeTimeout = 30 * time.Second
+
+// Probe asks every handler whether it could serve location (a URL or path),
+// and prints what each one found: the fingerprint strategies that would work
+// (an ETag from HEAD, a remote sha256sum, a git blob), checksum headers, refs,
+// and so on. It ends with a dataset stanza, ready to paste into the config,
+// for the handler that fits best.
+//
+// Handlers answer through the optional registry.Prober interface; those that
+// don't implement it (command, say) are listed as not probeable. A handler
+// that recognizes its own kind of location (a git remote) is preferred over
+// one that merely can read it (any web server answers http).
+//
+// The status lines go to the log; the stanza is the command's output, on
+// stdout, so "datum probe URL >> snippet.yaml" keeps just the YAML.
+//
+// Returns:
+//   - 0: At least one handler can serve the location
+//   - 1: None can
+func Probe(location string, opts Options) int {
+	ctx := opts.runContext()
+	var best *registry.ProbeResult
+	for _, name := range registry.Names() {
+		f, _ := registry.Get(name)
+		p, ok := f.(registry.Prober)
+		if !ok {
+			logf("[SKIP] %s: can't be probed\n", name)
+			continue
+		}
+		res, err := probeWith(ctx, p, location, opts.Timeout)
+		switch {
+		case err != nil:
+			logf("[ERR ] %s: %v\n", name, err)
+			continue
+		case res == nil:
+			logf("[SKIP] %s: not a location it serves\n", name)
+			continue
+		}
+		logf("[OK  ] %s: can serve %s\n", name, location)
+		for _, fp := range res.Fingerprints {
+			logf("    fingerprint  %s\n", fp)
+		}
+		for _, note := range res.Notes {
+			logf("    note         %s\n", note)
+		}
+		if best == nil || res.Specific && !best.Specific {
+			best = res
+		}
+	}
+
+	if best == nil {
+		logf("[FAIL] no handler can serve %s\n", location)
+		return 1
+	}
+	stanza, err := suggestedDataset(best)
+	if err != nil {
+		logf("probe error: %v\n", err)
+		return 1
+	}
+	logf("[INFO] suggested dataset (%s), to add under datasets:\n", best.Source.Type)
+	fmt.Print(string(stanza))
+	return 0
+}
+
+// probeWith runs one handler's probe under the run's timeout, or probeTimeout.
+func probeWith(ctx context.Context, p registry.Prober, location string, limit time.Duration) (*registry.ProbeResult, error) {
+	if limit <= 0 {
+		limit = probeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, limit)
+	defer cancel()
+	return p.Probe(ctx, location)
+}
+
+// suggestedDataset renders res as a one-item dataset list, with an ID and a
+// target under data/ derived from the location's last path element, and a
+// TODO comment for anything the probe couldn't fill in.
+func suggestedDataset(res *registry.ProbeResult) ([]byte, error) {
+	src := res.Source
+	base := filepath.Base(src.Path)
+	if src.URL != "" {
+		base = path.Base(src.URL)
+		if u, err := url.Parse(src.URL); err == nil && u.Path != "" {
+			base = path.Base(u.Path)
+		}
+		base = strings.TrimSuffix(base, ".git")
+	}
+	if base == "" || base == "." || base == "/" {
+		base = "dataset"
+	}
+
+	var item yaml.Node
+	if err := item.Encode(adoptedDataset{ID: datasetIDFor(base), Source: src, Target: path.Join("data", base)}); err != nil {
+		return nil, err
+	}
+	for _, todo := range res.ToDo {
+		item.HeadComment += "TODO: set " + todo + "\n"
+	}
+	item.HeadComment = strings.TrimSuffix(item.HeadComment, "\n")
+	list := &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{&item}}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(list); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// mockProber serves probe:// locations; with specific set it claims them as
+// its own kind, and with fail set it can't reach them.
+type mockProber struct {
+	mockHandler
+	name           string
+	specific, fail bool
+}
+
+func (m *mockProber) Name() string { return m.name }
+
+func (m *mockProber) Probe(_ context.Context, location string) (*registry.ProbeResult, error) {
+	if !strings.HasPrefix(location, "probe://") {
+		return nil, nil
+	}
+	if m.fail {
+		return nil, errors.New("unreachable")
+	}
+	res := &registry.ProbeResult{
+		Source:       registry.Source{Type: m.name, URL: location},
+		Fingerprints: []string{"etag (HEAD)"},
+		Specific:     m.specific,
+	}
+	if m.specific {
+		res.ToDo = []string{"source.path: the file to pin"}
+	}
+	return res, nil
+}
+
+func init() {
+	registry.Register(&mockProber{name: "mockprobe"})
+	registry.Register(&mockProber{name: "mockprobeown", specific: true})
+	registry.Register(&mockProber{name: "mockprobedown", fail: true})
+}
+
+func TestProbe(t *testing.T) {
+	if got := Probe("probe://host/data/Sales 2024.csv", Options{}); got != 0 {
+		t.Errorf("Probe() of a served location = %d, want 0", got)
+	}
+	if got := Probe("nothing-serves-this://x", Options{}); got != 1 {
+		t.Errorf("Probe() of an unserved location = %d, want 1", got)
+	}
+}
+
+func TestSuggestedDataset(t *testing.T) {
+	got, err := suggestedDataset(&registry.ProbeResult{
+		Source: registry.Source{Type: "http", URL: "https://example.org/exports/Sales%202024.csv?v=2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `- id: sales_2024
+  source:
+    type: http
+    url: https://example.org/exports/Sales%202024.csv?v=2
+  target: data/Sales 2024.csv
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	got, err = suggestedDataset(&registry.ProbeResult{
+		Source: registry.Source{Type: "git", URL: "git@github.com:org/lookups.git", Ref: "main"},
+		ToDo:   []string{"source.path: the file to pin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(got); !strings.HasPrefix(s, "# TODO: set source.path: the file to pin\n- id: lookups\n") || !strings.Contains(s, "ref: main") {
+		t.Errorf("got:\n%s", s)
+	}
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProfileLockPath returns the lockfile used for a named profile.
+//
+// Profiles let one config be pinned differently per environment: the profile
+// name is inserted before the lockfile's extension, so with the default lock
+// path profile "prod" uses .data.lock.prod.yaml and "dev" uses
+// .data.lock.dev.yaml. An empty profile returns lockPath unchanged.
+func ProfileLockPath(lockPath, profile string) string {
+	if profile == "" {
+		return lockPath
+	}
+	ext := filepath.Ext(lockPath)
+	return strings.TrimSuffix(lockPath, ext) + "." + profile + ext
+}
+
+// ValidateProfile rejects profile names that can't be embedded in a file name.
+func ValidateProfile(profile string) error {
+	if profile == "" {
+		return fmt.Errorf("profile name is empty")
+	}
+	if strings.ContainsAny(profile, `/\`) || strings.HasPrefix(profile, ".") {
+		return fmt.Errorf("invalid profile name %q (no path separators or leading dot)", profile)
+	}
+	return nil
+}
+
+// PromoteLock copies pins from one profile's lockfile into another's.
+//
+// This is how newer data moves between environments: datasets are fetched and
+// validated under one profile (e.g. dev), then their lock entries are promoted
+// into another (e.g. prod) once approved. The next check/fetch under the target
+// profile treats the promoted entries as its pins.
+//
+// Parameters:
+//   - lockPath: The base lockfile path (profiles are derived from it)
+//   - from, to: Profile names to promote from and to
+//   - ids: Dataset IDs to promote; empty means every entry in the source lock
+//
+// Returns:
+//   - 0: Entries were promoted (or were already identical)
+//   - 1: The target lockfile could not be written
+//   - 2: Invalid profile, unreadable source lockfile, or unknown dataset ID
+func PromoteLock(lockPath, from, to string, ids []string) int {
+	for _, p := range []string{from, to} {
+		if err := ValidateProfile(p); err != nil {
+			logf("promote error: %v\n", err)
+			return 2
+		}
+	}
+	if from == to {
+		logf("promote error: source and target profile are both %q\n", from)
+		return 2
+	}
+
+	fromPath, toPath := ProfileLockPath(lockPath, from), ProfileLockPath(lockPath, to)
+
+	// The source lock must exist - promoting from nothing is always a mistake
+	src, err := readLockStrict(fromPath)
+	if err != nil {
+		logf("lock error: %v\n", err)
+		return 2
+	}
+	dst, err := readLock(toPath)
+	if err != nil {
+		logf("lock error: %s: %v\n", toPath, err)
+		return 2
+	}
+
+	if len(ids) == 0 {
+		for id := range src.Items {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+
+	promoted := 0
+	for _, id := range ids {
+		item, ok := src.Items[id]
+		if !ok || item == nil {
+			logf("promote error: %s has no entry for %q\n", fromPath, id)
+			return 2
+		}
+		if old, ok := dst.Items[id]; ok && old != nil && old.LocalSHA256 == item.LocalSHA256 && old.RemoteFingerprint == item.RemoteFingerprint {
+			logf("[OK  ] %s: already pinned in %s\n", id, to)
+			continue
+		}
+		copied := *item
+		dst.Items[id] = &copied
+		logf("[UPD ] %s: %s -> %s (%s)\n", id, from, to, item.RemoteFingerprint)
+		promoted++
+	}
+
+	if promoted == 0 {
+		return 0
+	}
+	if err := writeLock(toPath, dst); err != nil {
+		logf("write lock error: %v\n", err)
+		return 1
+	}
+	logf("promoted %d dataset(s) into %s\n", promoted, toPath)
+	return 0
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfileLockPath(t *testing.T) {
+	tests := []struct {
+		lock, profile, want string
+	}{
+		{".data.lock.yaml", "", ".data.lock.yaml"},
+		{".data.lock.yaml", "prod", ".data.lock.prod.yaml"},
+		{filepath.Join("ci", "pins.yml"), "dev", filepath.Join("ci", "pins.dev.yml")},
+		{"lockfile", "dev", "lockfile.dev"},
+	}
+	for _, tt := range tests {
+		if got := ProfileLockPath(tt.lock, tt.profile); got != tt.want {
+			t.Errorf("ProfileLockPath(%q, %q) = %q, want %q", tt.lock, tt.profile, got, tt.want)
+		}
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	for _, p := range []string{"", "../prod", "a/b", ".hidden"} {
+		if err := ValidateProfile(p); err == nil {
+			t.Errorf("ValidateProfile(%q) expected error, got nil", p)
+		}
+	}
+	if err := ValidateProfile("prod"); err != nil {
+		t.Errorf("ValidateProfile(prod) error = %v", err)
+	}
+}
+
+func TestPromoteLock(t *testing.T) {
+	tmpDir := t.TempDir()
+	lockPath := filepath.Join(tmpDir, ".data.lock.yaml")
+
+	dev := &Lock{Version: 1, Items: map[string]*LockItem{
+		"a": {LocalSHA256: "new-a", RemoteFingerprint: "fp-a2"},
+		"b": {LocalSHA256: "new-b", RemoteFingerprint: "fp-b2"},
+	}}
+	prod := &Lock{Version: 1, Items: map[string]*LockItem{
+		"a": {LocalSHA256: "old-a", RemoteFingerprint: "fp-a1"},
+		"b": {LocalSHA256: "old-b", RemoteFingerprint: "fp-b1"},
+	}}
+	if err := writeLock(ProfileLockPath(lockPath, "dev"), dev); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeLock(ProfileLockPath(lockPath, "prod"), prod); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("selected IDs only", func(t *testing.T) {
+		if code := PromoteLock(lockPath, "dev", "prod", []string{"a"}); code != 0 {
+			t.Fatalf("PromoteLock() = %d, want 0", code)
+		}
+		got, _ := readLock(ProfileLockPath(lockPath, "prod"))
+		if got.Items["a"].RemoteFingerprint != "fp-a2" {
+			t.Errorf("a = %q, want promoted fp-a2", got.Items["a"].RemoteFingerprint)
+		}
+		if got.Items["b"].RemoteFingerprint != "fp-b1" {
+			t.Errorf("b = %q, want untouched fp-b1", got.Items["b"].RemoteFingerprint)
+		}
+	})
+
+	t.Run("all entries into a new profile", func(t *testing.T) {
+		if code := PromoteLock(lockPath, "dev", "staging", nil); code != 0 {
+			t.Fatalf("PromoteLock() = %d, want 0", code)
+		}
+		got, _ := readLock(ProfileLockPath(lockPath, "staging"))
+		if len(got.Items) != 2 {
+			t.Errorf("staging has %d items, want 2", len(got.Items))
+		}
+	})
+
+	t.Run("unknown ID", func(t *testing.T) {
+		if code := PromoteLock(lockPath, "dev", "prod", []string{"nope"}); code != 2 {
+			t.Errorf("PromoteLock() = %d, want 2", code)
+		}
+	})
+
+	t.Run("missing source lock", func(t *testing.T) {
+		if code := PromoteLock(lockPath, "qa", "prod", nil); code != 2 {
+			t.Errorf("PromoteLock() = %d, want 2", code)
+		}
+		if _, err := os.Stat(ProfileLockPath(lockPath, "qa")); !os.IsNotExist(err) {
+			t.Error("source lock should not be created")
+		}
+	})
+
+	t.Run("same profile", func(t *testing.T) {
+		if code := PromoteLock(lockPath, "dev", "dev", nil); code != 2 {
+			t.Errorf("PromoteLock() = %d, want 2", code)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// progressOut is where fetches report progress, or nil for no progress
+// output. Set once at startup via SetProgressOutput.
+var progressOut io.Writer
+
+// progressMu keeps progress lines from concurrent fetches from interleaving.
+var progressMu sync.Mutex
+
+// progressInterval is how often a running transfer reports. Nothing is printed
+// before the first interval is up, so quick fetches stay quiet.
+const progressInterval = 5 * time.Second
+
+// SetProgressOutput makes fetches report how far along they are to w (the CLI
+// passes stderr unless --quiet). A nil w turns progress output off.
+//
+// Unlike the [OK  ]-style lines, which are buffered per dataset and printed in
+// config order, progress lines are written the moment they're due: they're
+// only useful while the transfer is still running.
+func SetProgressOutput(w io.Writer) {
+	progressOut = w
+}
+
+// newProgress returns the registry.Progress a fetch of dataset id reports to,
+// or nil if progress output is off.
+func newProgress(id string) registry.Progress {
+	if progressOut == nil {
+		return nil
+	}
+	return &progressLine{id: id, w: progressOut, now: time.Now}
+}
+
+// progressLine prints a transfer's progress as
+//
+//	[....] census: 1.2 GiB of 4.0 GiB (30%), 45.1 MiB/s
+//
+// at most once per progressInterval.
+type progressLine struct {
+	id    string
+	w     io.Writer
+	now   func() time.Time
+	start time.Time // First update
+	last  time.Time // Last line printed (start until then)
+}
+
+// due reports whether it's time to print another line.
+func (p *progressLine) due() bool {
+	now := p.now()
+	if p.start.IsZero() {
+		p.start, p.last = now, now
+	}
+	if now.Sub(p.last) < progressInterval {
+		return false
+	}
+	p.last = now
+	return true
+}
+
+// Bytes implements registry.Progress.
+func (p *progressLine) Bytes(done, total int64) {
+	if !p.due() {
+		return
+	}
+	msg := formatBytes(done)
+	if total > 0 {
+		msg += fmt.Sprintf(" of %s (%d%%)", formatBytes(total), done*100/total)
+	}
+	if secs := p.last.Sub(p.start).Seconds(); secs > 0 {
+		msg += fmt.Sprintf(", %s/s", formatBytes(int64(float64(done)/secs)))
+	}
+	p.print(msg)
+}
+
+// Status implements registry.Progress.
+func (p *progressLine) Status(text string) {
+	if p.due() {
+		p.print(text)
+	}
+}
+
+func (p *progressLine) print(msg string) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	fmt.Fprintf(p.w, "[....] %s: %s\n", p.id, msg)
+}
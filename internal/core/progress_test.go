@@ -0,0 +1,55 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressLine(t *testing.T) {
+	var out bytes.Buffer
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &progressLine{id: "census", w: &out, now: func() time.Time { return clock }}
+
+	p.Bytes(1<<20, 100<<20) // Starts the clock, too soon to print
+	clock = clock.Add(2 * time.Second)
+	p.Bytes(5<<20, 100<<20)
+	if out.Len() != 0 {
+		t.Fatalf("printed before the interval was up: %q", out.String())
+	}
+
+	clock = clock.Add(8 * time.Second)
+	p.Bytes(50<<20, 100<<20)
+	if want := "[....] census: 50.0 MiB of 100.0 MiB (50%), 5.0 MiB/s\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	clock = clock.Add(progressInterval)
+	p.Bytes(75<<20, -1) // Size unknown: no percentage
+	if want := "[....] census: 75.0 MiB, 5.0 MiB/s\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	p.Status("Receiving objects:  45% (450/1000)")
+	clock = clock.Add(progressInterval)
+	p.Status("Receiving objects:  90% (900/1000)")
+	if got := out.String(); strings.Count(got, "\n") != 1 || !strings.Contains(got, "census: Receiving objects:  90%") {
+		t.Errorf("status output = %q", got)
+	}
+}
+
+func TestNewProgress_Off(t *testing.T) {
+	SetProgressOutput(nil)
+	if p := newProgress("x"); p != nil {
+		t.Errorf("newProgress() = %v with progress output off", p)
+	}
+	var out bytes.Buffer
+	SetProgressOutput(&out)
+	defer SetProgressOutput(nil)
+	if newProgress("x") == nil {
+		t.Error("newProgress() = nil with progress output on")
+	}
+}
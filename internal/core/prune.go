@@ -0,0 +1,125 @@
+package core
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Prune removes lock entries whose dataset is gone from the config, which
+// lock verify reports as orphaned. Their bookkeeping in the status file goes
+// too.
+//
+// With deleteTargets, the files those entries pinned are deleted as well,
+// after a confirmation prompt on in unless yes is set. Declining changes
+// nothing, the lock included. A target is only
+// deleted while it still holds exactly what was pinned, and never while a
+// dataset in the config still writes to it: anything else could be someone's
+// work, and is left with a note. Entries pinned before lock entries recorded
+// their target can't say where their file is.
+//
+// Returns:
+//   - 0: Success, or nothing to prune
+//   - 1: Declined at the prompt, or something couldn't be removed
+//   - 2: Configuration or lockfile error
+func Prune(cfgPath, lockPath string, deleteTargets, yes bool, in io.Reader, opts Options) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	lk, err := readLock(lockPath)
+	if err != nil {
+		logf("lock error: %v\n", err)
+		return 2
+	}
+
+	inUse := map[string]string{} // Target -> dataset
+	known := map[string]bool{}
+	for _, ds := range cfg.Datasets {
+		known[ds.ID] = true
+		inUse[ds.Target] = ds.ID
+	}
+	var orphans []string
+	for id := range lk.Items {
+		if !known[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	sort.Strings(orphans)
+	if len(orphans) == 0 {
+		logln("no orphaned lock entries")
+		return 0
+	}
+
+	var targets []string // Orphans whose target is safe to delete
+	for _, id := range orphans {
+		logf("[DEL ] %s: lock entry\n", id)
+		if !deleteTargets {
+			continue
+		}
+		item := lk.Items[id]
+		switch {
+		case item == nil || item.Target == "":
+			logf("[SKIP] %s: the entry doesn't record its target; delete the file by hand\n", id)
+		case inUse[item.Target] != "":
+			logf("[SKIP] %s: %s is the target of dataset %s\n", id, item.Target, inUse[item.Target])
+		case !fileExists(item.Target):
+			logf("[INFO] %s: %s is already gone\n", id, item.Target)
+		default:
+			if h, _, err := HashPath(item.Target); err != nil || h != item.LocalSHA256 {
+				logf("[SKIP] %s: %s changed since it was pinned; delete it by hand if it isn't needed\n", id, item.Target)
+				continue
+			}
+			logf("[DEL ] %s: %s\n", id, item.Target)
+			targets = append(targets, id)
+		}
+	}
+
+	// The lock is in version control; deleted data may not be anywhere
+	if len(targets) > 0 && !yes {
+		logf("Delete %d target(s)? [y/N] ", len(targets))
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			logln("aborted, nothing changed")
+			return 1
+		}
+	}
+
+	code := 0
+	for _, id := range targets {
+		item := lk.Items[id]
+		remove := os.Remove
+		if item.Files > 0 {
+			remove = os.RemoveAll // A directory target (see HashTree)
+		}
+		if err := remove(item.Target); err != nil && !os.IsNotExist(err) {
+			logf("[ERR ] %s: %v\n", id, err)
+			code = 1
+		}
+	}
+	for _, id := range orphans {
+		delete(lk.Items, id)
+	}
+	if err := saveLock(lockPath, lk, opts); err != nil {
+		logf("write lock error: %v\n", err)
+		return 1
+	}
+
+	statusPath := firstNonEmpty(opts.StatusFile, defaultStatusPath(lockPath))
+	if fileExists(statusPath) {
+		if st, err := readStatus(statusPath); err == nil {
+			for _, id := range orphans {
+				delete(st.Items, id)
+			}
+			if err := writeStatus(statusPath, st); err != nil {
+				logf("[WARN] status write error: %v\n", err)
+			}
+		}
+	}
+	logf("[INFO] pruned %d orphaned dataset(s), deleted %d target(s)\n", len(orphans), len(targets))
+	return code
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	lockPath := filepath.Join(dir, "lock.yaml")
+	kept := filepath.Join(dir, "a.csv")
+	os.WriteFile(cfgPath, []byte("version: 1\ndatasets:\n  - id: a\n    source: {type: mock}\n    target: "+kept+"\n"), 0o644)
+
+	gone := filepath.Join(dir, "b.csv")
+	edited := filepath.Join(dir, "c.csv")
+	for _, p := range []string{kept, gone, edited} {
+		os.WriteFile(p, []byte("pinned\n"), 0o644)
+	}
+	h, _ := HashFile(gone)
+	os.WriteFile(edited, []byte("someone's edits\n"), 0o644)
+	write := func() {
+		writeLock(lockPath, &Lock{Version: 1, Items: map[string]*LockItem{
+			"a":      {Target: kept, LocalSHA256: h},
+			"b":      {Target: gone, LocalSHA256: h},
+			"c":      {Target: edited, LocalSHA256: h},
+			"old":    {LocalSHA256: h},               // Pinned before targets were recorded
+			"shared": {Target: kept, LocalSHA256: h}, // Same file as a
+		}})
+	}
+	items := func() []string {
+		lk, _ := readLock(lockPath)
+		var ids []string
+		for id := range lk.Items {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	// Without --delete-targets only the lock changes
+	write()
+	if code := Prune(cfgPath, lockPath, false, false, strings.NewReader(""), Options{}); code != 0 {
+		t.Fatalf("Prune() = %d, want 0", code)
+	}
+	if ids := items(); len(ids) != 1 || ids[0] != "a" {
+		t.Errorf("lock items after prune = %v, want [a]", ids)
+	}
+	if !fileExists(gone) {
+		t.Error("prune without --delete-targets deleted a target")
+	}
+
+	// Declining the prompt changes nothing
+	write()
+	if code := Prune(cfgPath, lockPath, true, false, strings.NewReader("n\n"), Options{}); code != 1 {
+		t.Errorf("declined Prune() = %d, want 1", code)
+	}
+	if len(items()) != 5 || !fileExists(gone) {
+		t.Error("declined prune changed something")
+	}
+
+	// Only the unmodified, unshared target goes
+	if code := Prune(cfgPath, lockPath, true, false, strings.NewReader("y\n"), Options{}); code != 0 {
+		t.Fatalf("Prune() = %d, want 0", code)
+	}
+	if fileExists(gone) {
+		t.Error("b's target was not deleted")
+	}
+	if !fileExists(edited) || !fileExists(kept) {
+		t.Error("prune deleted a modified or still used target")
+	}
+	if len(items()) != 1 {
+		t.Errorf("lock items after prune = %v, want [a]", items())
+	}
+
+	// Nothing left to prune
+	if code := Prune(cfgPath, lockPath, true, false, strings.NewReader(""), Options{}); code != 0 {
+		t.Errorf("Prune() with nothing to do = %d, want 0", code)
+	}
+}
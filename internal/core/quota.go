@@ -0,0 +1,228 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// formatBytes renders n in IEC units for human-readable output.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// quotasFor returns the byte limits that apply to ds, keyed by tag.
+func (c *Config) quotasFor(ds Dataset) map[string]int64 {
+	out := map[string]int64{}
+	for _, tag := range ds.Tags {
+		if q, ok := c.Quotas[tag]; ok {
+			// Already validated by readConfig
+			limit, _ := httputil.ParseByteSize(q)
+			out[tag] = limit
+		}
+	}
+	return out
+}
+
+// groupUsage sums the current on-disk size of all targets tagged with tag,
+// excluding the dataset skipID (whose size is about to be replaced).
+func groupUsage(c *Config, tag, skipID string) int64 {
+	var used int64
+	for _, ds := range c.Datasets {
+		if ds.ID == skipID || !hasTag(ds, tag) {
+			continue
+		}
+		used += fileSize(ds.Target)
+	}
+	return used
+}
+
+// hasTag reports whether ds is tagged with tag.
+func hasTag(ds Dataset, tag string) bool {
+	for _, t := range ds.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// quotaMu serializes the quota check and install of fetches subject to a
+// quota.
+var quotaMu sync.Mutex
+
+// fetchTarget runs the handler's Fetch for ds, decompressing, extracting and
+// slicing the data and enforcing any group quotas.
+//
+// Without settings that reshape the data (see reshape), a transform or quotas
+// this is simply f.Fetch into the target. Otherwise the data is staged next
+// to the target first, reshaped, transformed (see transform.go), and
+// measured: if installing it would push any of the dataset's groups over
+// quota, the staged copy is discarded and the existing target is left
+// untouched.
+//
+// When the handler supports conditional fetches and the target still matches
+// item, the source is only asked for data that changed since item was
+// recorded; fetched is false if it had none, and the target is left as it is.
+//
+// raw is the SHA256 of the data as fetched, when decompress, archive_path,
+// extract or a transform changed it, and ""
+// otherwise. Nothing is fetched if the target's location breaks the dataset's
+// classification rules (see Handling).
+func fetchTarget(ctx context.Context, f registry.Fetcher, src registry.Source, ds Dataset, cfg *Config, item *LockItem) (raw string, fetched bool, err error) {
+	if err := cfg.checkHandling(ds); err != nil {
+		return item.raw(), false, err
+	}
+	src.Progress = newProgress(ds.ID)
+	fetch := func(dest string) (bool, error) { return true, f.Fetch(ctx, src, dest) }
+	if cf, ok := f.(registry.ConditionalFetcher); ok {
+		if prev := conditionalFingerprint(ds, src, item); prev != "" {
+			fetch = func(dest string) (bool, error) { return cf.FetchIfChanged(ctx, src, dest, prev) }
+		}
+	}
+
+	quotas := cfg.quotasFor(ds)
+	if len(quotas) == 0 && !reshapes(src) && ds.Transform == "" {
+		fetched, err := fetch(ds.Target)
+		return "", fetched, err
+	}
+
+	staging := fsutil.StagingPath(ds.Target)
+	defer os.RemoveAll(staging) // A directory source stages a whole tree
+	if fetched, err := fetch(staging); err != nil || !fetched {
+		return item.raw(), false, err
+	}
+	if raw, err = reshape(staging, src); err != nil {
+		return "", false, err
+	}
+	if ds.Transform != "" {
+		if raw == "" && !isDir(staging) {
+			if raw, err = HashFile(staging); err != nil {
+				return "", false, err
+			}
+		}
+		if err := applyTransform(ctx, ds, src, staging); err != nil {
+			return "", false, err
+		}
+	}
+
+	// Datasets are fetched concurrently. Usage only changes when a target is
+	// installed, so the check and the install are done under one lock, and
+	// two fetches can't both fit under a limit only one of them fits under;
+	// the downloads themselves still run in parallel
+	if len(quotas) > 0 {
+		quotaMu.Lock()
+		defer quotaMu.Unlock()
+	}
+	size := fileSize(staging)
+	for tag, limit := range quotas {
+		used := groupUsage(cfg, tag, ds.ID)
+		if used+size > limit {
+			return "", false, fmt.Errorf("quota exceeded for group %q: %s in use + %s new > %s limit",
+				tag, formatBytes(used), formatBytes(size), formatBytes(limit))
+		}
+	}
+	if isDir(staging) {
+		return "", true, fsutil.ReplaceDir(staging, ds.Target)
+	}
+	return raw, true, os.Rename(staging, ds.Target)
+}
+
+// conditionalFingerprint returns the fingerprint to fetch src conditionally
+// against, or "" when ds must be downloaded regardless: it was never fetched,
+// its slice settings or transform changed, or the target no longer matches the lock.
+func conditionalFingerprint(ds Dataset, src registry.Source, item *LockItem) string {
+	if item == nil || item.RemoteFingerprint == "" || item.LocalSHA256 == "" || item.Slice != sliceSpec(src) || item.Transform != ds.Transform {
+		return ""
+	}
+	if h, _, err := HashPath(ds.Target); err != nil || h != item.LocalSHA256 {
+		return ""
+	}
+	return item.RemoteFingerprint
+}
+
+// isDir reports whether path is a directory.
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// GroupSizes prints the current disk usage of each tag group against its quota.
+//
+// Every tag used by any dataset is listed, plus "(untagged)" for datasets with
+// no tags. A dataset with several tags counts towards each of them.
+//
+// Returns:
+//   - 0: All groups are within quota
+//   - 1: One or more groups exceed their quota
+//   - 2: Configuration error
+func GroupSizes(cfgPath string) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+
+	type group struct {
+		used  int64
+		count int
+	}
+	groups := map[string]*group{}
+	add := func(name string, size int64) {
+		g := groups[name]
+		if g == nil {
+			g = &group{}
+			groups[name] = g
+		}
+		g.used += size
+		g.count++
+	}
+	for _, ds := range cfg.Datasets {
+		size := fileSize(ds.Target)
+		if len(ds.Tags) == 0 {
+			add("(untagged)", size)
+		}
+		for _, tag := range ds.Tags {
+			add(tag, size)
+		}
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	exit := 0
+	fmt.Printf("%-20s %12s %12s %9s\n", "GROUP", "USED", "QUOTA", "DATASETS")
+	for _, name := range names {
+		g := groups[name]
+		quota := "-"
+		note := ""
+		if q, ok := cfg.Quotas[name]; ok {
+			limit, _ := httputil.ParseByteSize(q)
+			quota = formatBytes(limit)
+			if g.used > limit {
+				note = "  OVER QUOTA"
+				exit = 1
+			}
+		}
+		fmt.Printf("%-20s %12s %12s %9d%s\n", name, formatBytes(g.used), quota, g.count, note)
+	}
+	return exit
+}
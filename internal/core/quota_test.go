@@ -0,0 +1,203 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		512:     "512 B",
+		1536:    "1.5 KiB",
+		5 << 30: "5.0 GiB",
+	}
+	for in, want := range tests {
+		if got := formatBytes(in); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFetchQuota(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+	existing := filepath.Join(tmpDir, "existing.txt")
+	target := filepath.Join(tmpDir, "new.txt")
+
+	// mockHandler writes 9 bytes ("mock data"); 5 bytes are already in use
+	os.WriteFile(existing, []byte("12345"), 0o644)
+	writeConfig := func(quota string) {
+		os.WriteFile(configPath, []byte(`version: 1
+quotas:
+  geo: `+quota+`
+datasets:
+  - id: existing
+    tags: [geo]
+    source:
+      type: mock
+    target: `+existing+`
+  - id: new
+    tags: [geo]
+    source:
+      type: mock
+    target: `+target+`
+`), 0o644)
+	}
+
+	t.Run("over quota fails and leaves no target", func(t *testing.T) {
+		writeConfig("10")
+		if code := Fetch(configPath, lockPath, []string{"new"}); code != 1 {
+			t.Errorf("Fetch() = %d, want 1 (quota exceeded)", code)
+		}
+		if fileExists(target) || fileExists(fsutil.StagingPath(target)) {
+			t.Error("target or staging file should not exist after quota failure")
+		}
+		if code := GroupSizes(configPath); code != 0 {
+			t.Errorf("GroupSizes() = %d, want 0 (still within quota)", code)
+		}
+	})
+
+	t.Run("within quota installs target", func(t *testing.T) {
+		writeConfig("14B")
+		if code := Fetch(configPath, lockPath, []string{"new"}); code != 0 {
+			t.Errorf("Fetch() = %d, want 0", code)
+		}
+		if !fileExists(target) {
+			t.Error("target should exist after successful fetch")
+		}
+	})
+
+	t.Run("status reports groups over quota", func(t *testing.T) {
+		writeConfig("10")
+		if code := GroupSizes(configPath); code != 1 {
+			t.Errorf("GroupSizes() = %d, want 1 (14 bytes used of 10)", code)
+		}
+	})
+}
+
+// rendezvousHandler's fetches each wait, up to a second, for the other to
+// start before writing 4 bytes.
+type rendezvousHandler struct {
+	started atomic.Int32
+	both    chan struct{} // Closed once both fetches have started
+}
+
+func (m *rendezvousHandler) Name() string { return "rendezvous" }
+func (m *rendezvousHandler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	return "v1", nil
+}
+func (m *rendezvousHandler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	if m.started.Add(1) == 2 {
+		close(m.both)
+	}
+	select {
+	case <-m.both:
+	case <-time.After(time.Second):
+		return errors.New("the other fetch didn't start while this one was downloading")
+	}
+	return os.WriteFile(dest, []byte("data"), 0o644)
+}
+
+func TestFetchTarget_QuotaDownloadsInParallel(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{Quotas: map[string]string{"geo": "6B"}}
+	for _, id := range []string{"a", "b"} {
+		cfg.Datasets = append(cfg.Datasets, Dataset{ID: id, Tags: []string{"geo"}, Target: filepath.Join(dir, id)})
+	}
+	h := &rendezvousHandler{both: make(chan struct{})}
+
+	// Both download at once, but only one fits: the other is refused
+	errs := make(chan error, 2)
+	for _, ds := range cfg.Datasets {
+		go func() {
+			_, _, err := fetchTarget(context.Background(), h, registry.Source{Type: "rendezvous"}, ds, cfg, nil)
+			errs <- err
+		}()
+	}
+	var quotaErrs int
+	for range 2 {
+		if err := <-errs; err != nil {
+			if !strings.Contains(err.Error(), "quota exceeded") {
+				t.Fatalf("fetchTarget() error = %v", err)
+			}
+			quotaErrs++
+		}
+	}
+	if quotaErrs != 1 {
+		t.Errorf("%d fetches went over quota, want 1", quotaErrs)
+	}
+}
+
+// mockCondHandler serves "v1 data" with fingerprint "v1", and honors
+// conditional fetches against that fingerprint.
+type mockCondHandler struct{ asked []string } // Fingerprints FetchIfChanged was given
+
+func (m *mockCondHandler) Name() string { return "mockcond" }
+func (m *mockCondHandler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	return "v1", nil
+}
+func (m *mockCondHandler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	return os.WriteFile(dest, []byte(`{"v": 1}`), 0o644)
+}
+func (m *mockCondHandler) FetchIfChanged(ctx context.Context, src registry.Source, dest, fp string) (bool, error) {
+	m.asked = append(m.asked, fp)
+	if fp == "v1" {
+		return false, nil
+	}
+	return true, m.Fetch(ctx, src, dest)
+}
+
+func TestFetchTarget_Conditional(t *testing.T) {
+	dir := t.TempDir()
+	ds := Dataset{ID: "d", Target: filepath.Join(dir, "d.json")}
+	cfg := &Config{}
+	src := registry.Source{Type: "mockcond"}
+	h := &mockCondHandler{}
+
+	// First fetch: nothing to compare against
+	if _, fetched, err := fetchTarget(context.Background(), h, src, ds, cfg, nil); err != nil || !fetched || len(h.asked) != 0 {
+		t.Fatalf("first fetch: fetched = %v, err = %v, conditional calls = %v", fetched, err, h.asked)
+	}
+	local, _ := HashFile(ds.Target)
+	item := &LockItem{LocalSHA256: local, RemoteFingerprint: "v1", RawSHA256: "raw"}
+
+	// Intact target: asked conditionally, nothing downloaded
+	os.Chtimes(ds.Target, time.Unix(0, 0), time.Unix(0, 0))
+	if _, fetched, err := fetchTarget(context.Background(), h, src, ds, cfg, item); err != nil || fetched {
+		t.Errorf("intact target: fetched = %v, err = %v; want a conditional skip", fetched, err)
+	}
+	if len(h.asked) != 1 || h.asked[0] != "v1" {
+		t.Errorf("conditional calls = %v, want [v1]", h.asked)
+	}
+	if fi, _ := os.Stat(ds.Target); !fi.ModTime().Equal(time.Unix(0, 0)) {
+		t.Error("target rewritten despite not modified")
+	}
+
+	// Staged fetches (here: extract) keep the recorded raw hash when skipped
+	src.Extract = &registry.Extract{JQ: ".v"}
+	item.Slice = sliceSpec(src)
+	if raw, fetched, err := fetchTarget(context.Background(), h, src, ds, cfg, item); err != nil || fetched || raw != "raw" {
+		t.Errorf("staged skip: raw = %q, fetched = %v, err = %v; want the lock's raw hash kept", raw, fetched, err)
+	}
+	src.Extract = nil
+
+	// A locally modified target is downloaded again, unconditionally
+	os.WriteFile(ds.Target, []byte("edited"), 0o644)
+	h.asked = nil
+	if _, fetched, err := fetchTarget(context.Background(), h, src, ds, cfg, &LockItem{LocalSHA256: local, RemoteFingerprint: "v1"}); err != nil || !fetched || len(h.asked) != 0 {
+		t.Errorf("modified target: fetched = %v, err = %v, conditional calls = %v", fetched, err, h.asked)
+	}
+	if b, _ := os.ReadFile(ds.Target); string(b) != `{"v": 1}` {
+		t.Errorf("target = %q, want it restored", b)
+	}
+}
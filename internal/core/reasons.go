@@ -0,0 +1,141 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// FieldChange is one part of a source's fingerprint that no longer matches the lock.
+//
+// Handlers build fingerprints from whatever the source offers (an ETag, a
+// Last-Modified date and length, a content hash, a git blob ID), so knowing
+// which part moved tells a reviewer a lot: a new ETag with the same length
+// may be a re-upload, a new content hash is a real change.
+type FieldChange struct {
+	Field    string `json:"field"`              // See fingerprintFieldOrder, or "lock_entry" when the dataset isn't locked yet
+	Previous string `json:"previous,omitempty"` // Value in the lock
+	Current  string `json:"current,omitempty"`  // Value observed now
+}
+
+// fingerprintFieldOrder lists the fields fingerprints are split into, in the
+// order they are reported, with their human-readable labels.
+var fingerprintFieldOrder = []struct{ name, label string }{
+	{"etag", "ETag"},
+	{"last_modified", "Last-Modified"},
+	{"content_length", "Content-Length"},
+	{"sha256", "content hash"},
+	{"crc32", "CRC-32"},
+	{"tree", "tree hash"},
+	{"files", "file count"},
+	{"git_blob", "git blob"},
+	{"git_tree", "git tree"},
+	{"query_result", "query result"},
+	{"info_hash", "info hash"},
+	{"asset_id", "release asset"},
+	{"size", "size"},
+	{"mtime", "mtime"},
+	{"fingerprint", "fingerprint"},
+}
+
+// fingerprintKeys maps the prefixes handlers use inside fingerprints to field names.
+var fingerprintKeys = map[string]string{
+	"lm":      "last_modified",
+	"len":     "content_length",
+	"sha256":  "sha256",
+	"crc32":   "crc32",
+	"tree":    "tree",
+	"files":   "files",
+	"gitblob": "git_blob",
+	"gittree": "git_tree",
+	"query":   "query_result",
+	"btih":    "info_hash",
+	"asset":   "asset_id",
+	"size":    "size",
+	"mtime":   "mtime",
+}
+
+// fingerprintFields splits a fingerprint into its named parts, e.g.
+// "lm:Mon, 02 Jan 2006 ...|len:42" into last_modified and content_length.
+// Anything unrecognised (such as command handler output) is one opaque
+// "fingerprint" field.
+func fingerprintFields(fp string) map[string]string {
+	if etag, ok := strings.CutPrefix(fp, "etag:"); ok {
+		return map[string]string{"etag": etag} // ETags may contain anything
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(fp, "|") {
+		key, value, ok := strings.Cut(part, ":")
+		name, known := fingerprintKeys[key]
+		if !ok || !known {
+			return map[string]string{"fingerprint": fp}
+		}
+		fields[name] = value
+	}
+	return fields
+}
+
+// fingerprintChanges lists the parts of the fingerprint that differ between
+// the lock and now. When the fingerprint kind itself changed (say, a server
+// stopped sending ETags), each side's parts show up as added or removed.
+func fingerprintChanges(locked, current string) []FieldChange {
+	was, now := fingerprintFields(locked), fingerprintFields(current)
+	var changes []FieldChange
+	for _, f := range fingerprintFieldOrder {
+		if was[f.name] != now[f.name] {
+			changes = append(changes, FieldChange{Field: f.name, Previous: was[f.name], Current: now[f.name]})
+		}
+	}
+	return changes
+}
+
+// fieldLabel returns the human-readable name of a FieldChange field.
+func fieldLabel(name string) string {
+	for _, f := range fingerprintFieldOrder {
+		if f.name == name {
+			return f.label
+		}
+	}
+	return name
+}
+
+// explainChange records why ds's source no longer matches its lock entry (nil
+// if the dataset was never locked): which fingerprint fields changed, the
+// source that was asked, and the command that accepts the change. The details
+// go into the report, and are printed under the status line when verbose.
+func (r *datasetResult) explainChange(ds Dataset, item *LockItem, fp string, src registry.Source, verbose bool) {
+	if item == nil {
+		r.report.Changes = []FieldChange{{Field: "lock_entry", Current: fp}}
+	} else {
+		r.report.Changes = fingerprintChanges(item.RemoteFingerprint, fp)
+	}
+	r.report.Remediation = "datum update " + ds.ID
+	if !verbose {
+		return
+	}
+
+	width := len("source")
+	for _, c := range r.report.Changes {
+		if c.Field != "lock_entry" {
+			width = max(width, len(fieldLabel(c.Field)))
+		}
+	}
+	if item == nil {
+		r.printf("    %-*s  not in the lockfile yet\n", width, "lock")
+	}
+	for _, c := range r.report.Changes {
+		if c.Field != "lock_entry" {
+			r.printf("    %-*s  %s -> %s\n", width, fieldLabel(c.Field), orNone(c.Previous), orNone(c.Current))
+		}
+	}
+	r.printf("    %-*s  %s (%s)\n", width, "source", firstNonEmpty(src.URL, src.Path), src.Type)
+	r.printf("    to accept the new version after reviewing it: %s\n", r.report.Remediation)
+}
+
+// orNone shows an absent fingerprint field as (none).
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
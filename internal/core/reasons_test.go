@@ -0,0 +1,64 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestFingerprintChanges(t *testing.T) {
+	lm := "Mon, 02 Jan 2006 15:04:05 GMT"
+	tests := []struct {
+		name            string
+		locked, current string
+		want            []FieldChange
+	}{
+		{"etag", `etag:"a|1"`, `etag:"b"`, []FieldChange{{"etag", `"a|1"`, `"b"`}}},
+		{"length only", "lm:" + lm + "|len:10", "lm:" + lm + "|len:12", []FieldChange{{"content_length", "10", "12"}}},
+		{"content hash", "sha256:aa", "sha256:bb", []FieldChange{{"sha256", "aa", "bb"}}},
+		{"kind changed", `etag:"a"`, "lm:" + lm + "|len:10", []FieldChange{
+			{"etag", `"a"`, ""}, {"last_modified", "", lm}, {"content_length", "", "10"},
+		}},
+		{"sftp", "size:1|mtime:2025-01-01T00:00:00Z", "size:1|mtime:2025-02-01T00:00:00Z", []FieldChange{
+			{"mtime", "2025-01-01T00:00:00Z", "2025-02-01T00:00:00Z"},
+		}},
+		{"opaque", "v1 2025-01-01", "v2 2025-02-01", []FieldChange{{"fingerprint", "v1 2025-01-01", "v2 2025-02-01"}}},
+		{"unknown key", "build:7", "build:8", []FieldChange{{"fingerprint", "build:7", "build:8"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fingerprintChanges(tt.locked, tt.current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fingerprintChanges() = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplainChange(t *testing.T) {
+	ds := Dataset{ID: "tracts"}
+	src := registry.Source{Type: "http", URL: "https://example.com/tracts.csv"}
+
+	res := newDatasetResult("tracts")
+	res.explainChange(ds, &LockItem{RemoteFingerprint: "sha256:aa"}, "sha256:bb", src, true)
+	out := res.out.String()
+	for _, want := range []string{
+		"content hash  aa -> bb",
+		"source        https://example.com/tracts.csv (http)",
+		"datum update tracts",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	res = newDatasetResult("tracts")
+	res.explainChange(ds, nil, "sha256:bb", src, false)
+	if res.out.Len() != 0 {
+		t.Errorf("non-verbose explainChange printed %q", res.out.String())
+	}
+	if want := []FieldChange{{Field: "lock_entry", Current: "sha256:bb"}}; !reflect.DeepEqual(res.report.Changes, want) {
+		t.Errorf("unlocked dataset changes = %+v, want %+v", res.report.Changes, want)
+	}
+}
@@ -0,0 +1,245 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// relocation returns the URL src has permanently moved to, or "" if it hasn't
+// moved, its handler can't tell, or the probe failed. Detection is best-effort:
+// a failed probe must never turn a working source into an error.
+func relocation(ctx context.Context, src registry.Source) string {
+	f, ok := registry.Get(src.Type)
+	if !ok || src.URL == "" {
+		return ""
+	}
+	r, ok := f.(registry.Relocator)
+	if !ok {
+		return ""
+	}
+	moved, err := r.Relocated(ctx, src)
+	if err != nil {
+		return ""
+	}
+	return moved
+}
+
+// FixURLs rewrites moved source URLs in the config file (and the files it
+// includes).
+//
+// Every source of every dataset is probed for a permanent move (see
+// registry.Relocator). The proposed rewrites are printed, and unless yes is set
+// the user is asked to confirm on in. Only the URL values are touched; comments,
+// ordering and formatting of the config are preserved.
+//
+// A URL written with placeholders ({{version}}, {{env.NAME}}, ${NAME}, each
+// variables) is rewritten only when the move leaves every placeholder's part
+// alone, so the placeholders are kept; a move that changes what a placeholder
+// fills in is reported for the user to fix by hand rather than hardcoded.
+//
+// Returns:
+//   - 0: Nothing moved, or the config was rewritten
+//   - 1: Moved sources were found but not all rewritten (declined, templated,
+//     or write failed)
+//   - 2: Configuration error
+func FixURLs(cfgPath string, yes bool, in io.Reader) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+
+	ctx := context.Background()
+	moves := map[string]string{}
+	for _, ds := range cfg.Datasets {
+		for _, src := range ds.GetSources() {
+			if _, seen := moves[src.URL]; seen {
+				continue
+			}
+			if moved := relocation(ctx, src); moved != "" {
+				moves[src.URL] = moved
+				logf("[MOVED] %s: %s -> %s\n", ds.ID, src.URL, moved)
+			}
+		}
+	}
+	if len(moves) == 0 {
+		logln("no moved sources found")
+		return 0
+	}
+
+	if !yes {
+		logf("Rewrite %d URL(s) in %s? [y/N] ", len(moves), cfgPath)
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			logln("aborted, config unchanged")
+			return 1
+		}
+	}
+
+	// The URLs may be in the config or in files it includes
+	for _, file := range configFiles(cfgPath, cfg) {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			logf("config error: %v\n", err)
+			return 2
+		}
+		out, n, err := rewriteURLs(b, moves)
+		if err != nil {
+			logf("config error: %s: %v\n", file, err)
+			return 2
+		}
+		if n == 0 {
+			continue
+		}
+		if err := fsutil.WriteFileAtomic(file, bytes.NewReader(out)); err != nil {
+			logf("write config error: %v\n", err)
+			return 1
+		}
+		logf("rewrote %d URL(s) in %s\n", n, file)
+	}
+
+	// Check the result rather than trusting the count: a templated URL whose
+	// move couldn't be carried over still expands to the old one
+	after, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	code := 0
+	for _, ds := range after.Datasets {
+		for _, src := range ds.GetSources() {
+			if moved, ok := moves[src.URL]; ok {
+				logf("[NOT REWRITTEN] %s: %s -> %s (its placeholders would change; edit the config by hand)\n", ds.ID, src.URL, moved)
+				code = 1
+			}
+		}
+	}
+	return code
+}
+
+// rewriteURLs replaces the values of "url:" keys found in moves, returning the
+// new document and the number of values replaced.
+//
+// Rather than re-encoding the YAML (which would reflow indentation and lose some
+// comments), the document is parsed only to locate each url value, and the old
+// text is replaced in place on that line.
+func rewriteURLs(b []byte, moves map[string]string) ([]byte, int, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, 0, err
+	}
+
+	lines := strings.SplitAfter(string(b), "\n")
+	n := 0
+	var walk func(*yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, val := node.Content[i], node.Content[i+1]
+				if key.Value != "url" || val.Kind != yaml.ScalarNode {
+					continue
+				}
+				moved, ok := moves[val.Value]
+				if !ok {
+					moved, ok = templatedMove(val.Value, moves)
+				}
+				if !ok || val.Line < 1 || val.Line > len(lines) {
+					continue
+				}
+				line := lines[val.Line-1]
+				col := val.Column - 1
+				if idx := strings.Index(line[col:], val.Value); idx >= 0 {
+					lines[val.Line-1] = line[:col+idx] + moved + line[col+idx+len(val.Value):]
+					n++
+				}
+			}
+		}
+		for _, c := range node.Content {
+			walk(c)
+		}
+	}
+	walk(&doc)
+
+	return []byte(strings.Join(lines, "")), n, nil
+}
+
+// placeholder matches the parts of a URL filled in when the config is
+// loaded: {{version}}, {{env.NAME}}, each variables and ${NAME}.
+var placeholder = regexp.MustCompile(`\{\{[^{}]*\}\}|\$\$?\{[^{}]*\}`)
+
+// templatedMove returns the URL template raw should become for the moves of
+// the URLs it expands to, keeping its placeholders. It fails when raw has no
+// placeholders or expands to no moved URL, when a move changes a part a
+// placeholder fills in, or when raw's expansions moved in different ways.
+func templatedMove(raw string, moves map[string]string) (string, bool) {
+	spans := placeholder.FindAllStringIndex(raw, -1)
+	if len(spans) == 0 {
+		return "", false
+	}
+	// raw as a pattern: its literal parts, with a group for each placeholder
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, sp := range spans {
+		pattern.WriteString(regexp.QuoteMeta(raw[last:sp[0]]) + "(.*?)")
+		last = sp[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(raw[last:]) + "$")
+	re := regexp.MustCompile(pattern.String())
+
+	result := ""
+	for old, moved := range moves {
+		m := re.FindStringSubmatchIndex(old)
+		if m == nil {
+			continue
+		}
+		// The part of old the move changes, after their common prefix and
+		// before their common suffix
+		start := 0
+		for start < len(old) && start < len(moved) && old[start] == moved[start] {
+			start++
+		}
+		end := 0
+		for end < len(old)-start && end < len(moved)-start && old[len(old)-1-end] == moved[len(moved)-1-end] {
+			end++
+		}
+		from, to := start, len(old)-end
+		// It must lie within one of raw's literal parts, not reach into a
+		// placeholder's
+		rawFrom, rawTo := -1, -1
+		for i := 0; i <= len(spans); i++ {
+			litStart, rawStart := 0, 0
+			if i > 0 {
+				litStart, rawStart = m[1+2*i], spans[i-1][1]
+			}
+			litEnd := len(old)
+			if i < len(spans) {
+				litEnd = m[2+2*i]
+			}
+			if litStart <= from && to <= litEnd {
+				rawFrom, rawTo = rawStart+from-litStart, rawStart+to-litStart
+				break
+			}
+		}
+		if rawFrom < 0 {
+			return "", false
+		}
+		rewritten := raw[:rawFrom] + moved[start:len(moved)-end] + raw[rawTo:]
+		if result != "" && result != rewritten {
+			return "", false
+		}
+		result = rewritten
+	}
+	return result, result != ""
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// mockMovedHandler reports every URL under old.example as moved to new.example
+type mockMovedHandler struct{ mockHandler }
+
+func (m *mockMovedHandler) Name() string { return "mockmoved" }
+
+func (m *mockMovedHandler) Relocated(ctx context.Context, src registry.Source) (string, error) {
+	if strings.Contains(src.URL, "old.example") {
+		return strings.Replace(src.URL, "old.example", "new.example", 1), nil
+	}
+	return "", nil
+}
+
+func init() {
+	registry.Register(&mockMovedHandler{})
+}
+
+func TestRewriteURLs(t *testing.T) {
+	in := `version: 1
+datasets:
+  # keep this comment
+  - id: a
+    source: {type: http, url: "https://old.example/a.csv"}
+    target: a.csv
+  - id: b
+    sources:
+      - type: http
+        url: https://old.example/a.csv   # same file, second mention
+      - type: http
+        url: https://other.example/b.csv
+    target: b.csv
+`
+	out, n, err := rewriteURLs([]byte(in), map[string]string{
+		"https://old.example/a.csv": "https://new.example/a.csv",
+	})
+	if err != nil {
+		t.Fatalf("rewriteURLs() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("rewriteURLs() replaced %d values, want 2", n)
+	}
+	want := strings.ReplaceAll(in, "https://old.example/a.csv", "https://new.example/a.csv")
+	if string(out) != want {
+		t.Errorf("rewriteURLs() =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestTemplatedMove(t *testing.T) {
+	moves := map[string]string{
+		"https://old.example/v2/a.csv":    "https://new.example/v2/a.csv",
+		"https://old.example/2024/b.csv":  "https://old.example/archive/2024/b.csv",
+		"https://old.example/2023/b.csv":  "https://old.example/archive/2023/b.csv",
+		"https://host.example/c.csv":      "https://elsewhere.example/c.csv",
+		"https://old.example/d-x.csv":     "https://new.example/d-x.csv",
+		"https://split.example/1/e.csv":   "https://split.example/e/1.csv",
+		"https://other.example/f.csv":     "https://other.example/g.csv",
+		"https://other.example/f/raw.csv": "https://new.example/f/raw.csv",
+	}
+	tests := []struct{ raw, want string }{
+		{"https://old.example/v{{version}}/a.csv", "https://new.example/v{{version}}/a.csv"},
+		{"https://old.example/{{year}}/b.csv", "https://old.example/archive/{{year}}/b.csv"},
+		{"https://${DATA_HOST}/c.csv", ""}, // The placeholder's part moved
+		{"https://old.example/d-{{env.KIND}}.csv", "https://new.example/d-{{env.KIND}}.csv"},
+		{"https://split.example/{{n}}/e.csv", ""},  // Reaches across the placeholder
+		{"https://other.example/{{name}}.csv", ""}, // The placeholder's part moved
+		{"https://old.example/v2/a.csv", ""},       // No placeholders
+		{"https://unmoved.example/{{version}}.csv", ""},
+	}
+	for _, tt := range tests {
+		got, ok := templatedMove(tt.raw, moves)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("templatedMove(%q) = %q, %v; want %q", tt.raw, got, ok, tt.want)
+		}
+	}
+
+	// Expansions that moved differently can't share one template
+	if got, ok := templatedMove("https://x.example/{{n}}.csv", map[string]string{
+		"https://x.example/1.csv": "https://y.example/1.csv",
+		"https://x.example/2.csv": "https://z.example/2.csv",
+	}); ok {
+		t.Errorf("templatedMove() of diverging moves = %q, want none", got)
+	}
+}
+
+func TestFixURLs(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	content := `version: 1
+datasets:
+  - id: moved
+    source:
+      type: mockmoved
+      url: https://old.example/data.csv
+    target: data.csv
+  - id: fine
+    source:
+      type: mockmoved
+      url: https://fine.example/data.csv
+    target: fine.csv
+`
+	writeConfig := func() {
+		if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("declined", func(t *testing.T) {
+		writeConfig()
+		if code := FixURLs(configPath, false, strings.NewReader("n\n")); code != 1 {
+			t.Errorf("FixURLs() = %d, want 1", code)
+		}
+		if got, _ := os.ReadFile(configPath); string(got) != content {
+			t.Error("config should be unchanged after declining")
+		}
+	})
+
+	t.Run("confirmed", func(t *testing.T) {
+		writeConfig()
+		if code := FixURLs(configPath, false, strings.NewReader("y\n")); code != 0 {
+			t.Fatalf("FixURLs() = %d, want 0", code)
+		}
+		cfg, err := readConfig(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cfg.Datasets[0].Source.URL; got != "https://new.example/data.csv" {
+			t.Errorf("moved URL = %q, want https://new.example/data.csv", got)
+		}
+		if got := cfg.Datasets[1].Source.URL; got != "https://fine.example/data.csv" {
+			t.Errorf("unmoved URL changed to %q", got)
+		}
+	})
+
+	t.Run("templated", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "templated.yaml")
+		t.Setenv("OLD_HOST", "old.example")
+		templated := `version: 1
+datasets:
+  - id: versioned
+    version: "3"
+    source:
+      type: mockmoved
+      url: https://old.example/v{{version}}/data.csv
+    target: v.csv
+  - id: hosted
+    source:
+      type: mockmoved
+      url: https://${OLD_HOST}/data.csv
+    target: h.csv
+`
+		if err := os.WriteFile(path, []byte(templated), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if code := FixURLs(path, true, strings.NewReader("")); code != 1 {
+			t.Errorf("FixURLs() = %d, want 1 for the URL whose placeholder moved", code)
+		}
+		got, _ := os.ReadFile(path)
+		if !strings.Contains(string(got), "url: https://new.example/v{{version}}/data.csv") {
+			t.Errorf("the versioned URL wasn't rewritten around its placeholder:\n%s", got)
+		}
+		if !strings.Contains(string(got), "url: https://${OLD_HOST}/data.csv") {
+			t.Errorf("the placeholder was hardcoded:\n%s", got)
+		}
+	})
+
+	t.Run("nothing to fix", func(t *testing.T) {
+		// The previous subtest already rewrote the config
+		if code := FixURLs(configPath, true, strings.NewReader("")); code != 0 {
+			t.Errorf("FixURLs() = %d, want 0", code)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Report is the machine-readable summary of a check or fetch run, written as
+// JSON to Options.Report.
+//
+// Field names are part of datum's interface for CI pipelines: add fields
+// freely, but don't rename or remove them.
+type Report struct {
+	Command    string          `json:"command"`         // "check" or "fetch"
+	RunID      string          `json:"run_id"`          // See Options.RunID
+	StartedAt  time.Time       `json:"started_at"`      // When the run began (UTC)
+	DurationMS float64         `json:"duration_ms"`     // Wall time of the whole run
+	ExitCode   int             `json:"exit_code"`       // Same as the process exit code
+	Error      string          `json:"error,omitempty"` // Run-level error (e.g. an invalid config)
+	Datasets   []DatasetReport `json:"datasets"`        // One entry per processed dataset, in processing order
+}
+
+// DatasetReport is what happened to one dataset during a run.
+//
+// Status is one of:
+//   - "ok": up to date (check)
+//   - "fetched": downloaded (fetch)
+//   - "updated": changed upstream and refreshed (check, update policy)
+//   - "stale": changed upstream and left alone (check, log policy)
+//   - "changed": changed upstream, which fails the run (check, fail policy)
+//   - "modified": the local copy no longer matches the lock (check, re-verification)
+//   - "error": the dataset couldn't be checked or fetched; see Error
+//   - "interrupted": the run was cancelled before it got to the dataset
+//   - "skipped": no handler for its sources in this build (see
+//     Options.SkipUnknownHandlers), or a dependency failed (see depends.go)
+type DatasetReport struct {
+	ID             string  `json:"id"`
+	Status         string  `json:"status"`
+	Source         string  `json:"source,omitempty"`          // URL or path of the source that answered
+	OldFingerprint string  `json:"old_fingerprint,omitempty"` // Remote fingerprint in the lock before the run
+	NewFingerprint string  `json:"new_fingerprint,omitempty"` // Remote fingerprint observed now
+	Error          string  `json:"error,omitempty"`
+	ErrorKind      string  `json:"error_kind,omitempty"`   // "transient" (5xx, timeout: may pass later) or "permanent" (e.g. 404)
+	Retries        int     `json:"retries,omitempty"`      // Source operations repeated after transient failures
+	Attempts       int     `json:"attempts,omitempty"`     // Pass that produced this result, when the run was retried (see Options.RetryRun)
+	NotModified    bool    `json:"not_modified,omitempty"` // The source answered a conditional fetch with "not modified"
+	Cached         bool    `json:"cached,omitempty"`       // Taken from the shared cache instead of downloaded (see cache.go)
+	DurationMS     float64 `json:"duration_ms"`
+	FingerprintMS  float64 `json:"fingerprint_ms,omitempty"` // Operations timed this run (see StatusItem)
+	FetchMS        float64 `json:"fetch_ms,omitempty"`
+	VerifyMS       float64 `json:"verify_ms,omitempty"`
+
+	// Exception that relaxed the dataset's fail policy this run (see Exception)
+	Exception *Exception `json:"exception,omitempty"`
+
+	// Why the source no longer matches the lock (stale and changed only)
+	Changes     []FieldChange `json:"changes,omitempty"`
+	Remediation string        `json:"remediation,omitempty"` // Command that accepts the change
+}
+
+// timedOp names an operation whose duration is recorded per dataset.
+type timedOp int
+
+const (
+	opFingerprint timedOp = iota
+	opFetch
+	opVerify
+)
+
+// timeOp records how long op, begun at start, took: in the dataset's status
+// item (the latest value, kept across runs for "status --slowest") and in this
+// run's report.
+func (r *datasetResult) timeOp(op timedOp, si *StatusItem, start, now time.Time) {
+	d := time.Since(start)
+	switch op {
+	case opFingerprint:
+		si.FingerprintTime = d
+		r.report.FingerprintMS = milliseconds(d)
+	case opFetch:
+		si.FetchTime = d
+		r.report.FetchMS = milliseconds(d)
+	case opVerify:
+		si.VerifyTime = d
+		r.report.VerifyMS = milliseconds(d)
+	}
+	r.printf("[DBG ] %s: %s took %s\n", r.report.ID, [...]string{"fingerprint", "fetch", "verify"}[op], d.Round(time.Millisecond))
+	si.TimedAt = &now
+	r.statusChanged = true
+}
+
+// newDatasetResult returns an empty result for the dataset id.
+func newDatasetResult(id string) *datasetResult {
+	return &datasetResult{report: DatasetReport{ID: id}}
+}
+
+// setStatus sets the report's status unless an error was already recorded.
+func (r *datasetResult) setStatus(status string) {
+	if r.report.Status != "error" {
+		r.report.Status = status
+	}
+}
+
+// fail marks the dataset's report as an error, keeping the first message.
+func (r *datasetResult) fail(err error) {
+	r.report.Status = "error"
+	if r.report.Error == "" && err != nil {
+		r.report.Error = err.Error()
+		r.report.ErrorKind = errorKind(err)
+	}
+}
+
+// milliseconds converts d for JSON, keeping microsecond precision.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// newReport starts the report for run runID of command.
+func newReport(command, runID string) *Report {
+	return &Report{Command: command, RunID: runID, StartedAt: time.Now().UTC(), Datasets: []DatasetReport{}}
+}
+
+// write finishes the report with the run's exit code and writes it to w as
+// indented JSON. A nil w (no report requested) does nothing.
+func (rep *Report) write(w io.Writer, exit int) error {
+	if w == nil {
+		return nil
+	}
+	rep.ExitCode = exit
+	rep.DurationMS = milliseconds(time.Since(rep.StartedAt))
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
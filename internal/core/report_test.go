@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := "version: 1\ndatasets:\n" +
+		"  - id: good\n    source:\n      type: mock\n      url: https://example.com/good.csv\n    target: " + filepath.Join(tmpDir, "good.txt") + "\n" +
+		"  - id: broken\n    policy: update\n    source:\n      type: mockfail\n    target: " + filepath.Join(tmpDir, "broken.txt") + "\n"
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	run := func(name string, f func(opts Options) int) (int, Report) {
+		t.Helper()
+		var buf bytes.Buffer
+		code := f(Options{Report: &buf})
+		var rep Report
+		if err := json.Unmarshal(buf.Bytes(), &rep); err != nil {
+			t.Fatalf("%s report is not JSON: %v\n%s", name, err, buf.String())
+		}
+		if rep.ExitCode != code || rep.Command != name {
+			t.Errorf("%s report: command %q exit %d, want %q exit %d", name, rep.Command, rep.ExitCode, name, code)
+		}
+		return code, rep
+	}
+	statuses := func(rep Report) map[string]DatasetReport {
+		m := map[string]DatasetReport{}
+		for _, d := range rep.Datasets {
+			m[d.ID] = d
+		}
+		return m
+	}
+
+	code, rep := run("fetch", func(opts Options) int { return FetchWithOptions(configPath, lockPath, nil, opts) })
+	if code != 1 {
+		t.Errorf("fetch exit = %d, want 1", code)
+	}
+	got := statuses(rep)
+	if d := got["good"]; d.Status != "fetched" || d.NewFingerprint != "mock-fp" || d.Source != "https://example.com/good.csv" || d.FetchMS <= 0 {
+		t.Errorf("fetch good = %+v", d)
+	}
+	if d := got["broken"]; d.Status != "error" || !strings.Contains(d.Error, "simulated network error") {
+		t.Errorf("fetch broken = %+v", d)
+	}
+
+	_, rep = run("check", func(opts Options) int { return CheckWithOptions(configPath, lockPath, opts) })
+	got = statuses(rep)
+	if d := got["good"]; d.Status != "ok" || d.OldFingerprint != "mock-fp" || d.NewFingerprint != "mock-fp" {
+		t.Errorf("check good = %+v", d)
+	}
+	if d := got["broken"]; d.Status != "error" || d.Error == "" {
+		t.Errorf("check broken = %+v", d)
+	}
+	if len(rep.Datasets) != 2 || rep.Datasets[0].ID != "good" {
+		t.Errorf("report datasets = %+v, want both in processing order", rep.Datasets)
+	}
+
+	code, rep = run("check", func(opts Options) int {
+		return CheckWithOptions(filepath.Join(tmpDir, "missing.yaml"), lockPath, opts)
+	})
+	if code != 2 || rep.Error == "" || rep.Datasets == nil {
+		t.Errorf("config error report = %+v (exit %d)", rep, code)
+	}
+}
+
+func TestReportChanged(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := "version: 1\ndatasets:\n" +
+		"  - id: strict\n    source:\n      type: mock\n    target: " + filepath.Join(tmpDir, "strict.txt") + "\n" +
+		"  - id: logged\n    policy: log\n    source:\n      type: mock\n    target: " + filepath.Join(tmpDir, "logged.txt") + "\n"
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+	lock := "version: 1\nitems:\n  strict:\n    remote_fingerprint: old-fp\n  logged:\n    remote_fingerprint: old-fp\n"
+	if err := os.WriteFile(lockPath, []byte(lock), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	CheckWithOptions(configPath, lockPath, Options{Report: &buf})
+	var rep Report
+	if err := json.Unmarshal(buf.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"strict": "changed", "logged": "stale"}
+	for _, d := range rep.Datasets {
+		if d.Status != want[d.ID] || d.OldFingerprint != "old-fp" || d.NewFingerprint != "mock-fp" {
+			t.Errorf("%s = %+v, want status %q with old/new fingerprints", d.ID, d, want[d.ID])
+		}
+		wantChange := FieldChange{Field: "fingerprint", Previous: "old-fp", Current: "mock-fp"}
+		if len(d.Changes) != 1 || d.Changes[0] != wantChange || d.Remediation != "datum update "+d.ID {
+			t.Errorf("%s changes = %+v, remediation %q", d.ID, d.Changes, d.Remediation)
+		}
+	}
+}
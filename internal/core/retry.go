@@ -0,0 +1,144 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/jprybylski/datum/internal/httputil"
+)
+
+// Retry timing. Each retry waits twice as long as the one before, starting
+// at the dataset's retry_backoff (defaultRetryBackoff if unset) and capped at
+// maxRetryBackoff, unless the server asked for longer with Retry-After.
+const (
+	defaultRetryBackoff = time.Second
+	maxRetryBackoff     = time.Minute
+)
+
+// retryPolicy says how many times a dataset's source operations are retried
+// after a transient failure, and how long the first retry waits.
+type retryPolicy struct {
+	retries int
+	backoff time.Duration
+}
+
+// retryPolicyFor returns ds's retry settings: its own retries and
+// retry_backoff where set, the defaults otherwise. The durations were checked
+// by readConfig.
+func (c *Config) retryPolicyFor(ds Dataset) retryPolicy {
+	p := retryPolicy{retries: c.Defaults.Retries, backoff: defaultRetryBackoff}
+	if ds.Retries != nil {
+		p.retries = *ds.Retries
+	}
+	if s := firstNonEmpty(ds.RetryBackoff, c.Defaults.RetryBackoff); s != "" {
+		p.backoff, _ = time.ParseDuration(s)
+	}
+	return p
+}
+
+// validateRetries checks a retries / retry_backoff pair from the config.
+func validateRetries(retries int, backoff string) error {
+	if retries < 0 {
+		return fmt.Errorf("retries: must not be negative (got %d)", retries)
+	}
+	if backoff != "" {
+		if d, err := time.ParseDuration(backoff); err != nil || d <= 0 {
+			return fmt.Errorf("retry_backoff: invalid duration %q (e.g. \"500ms\", \"2s\")", backoff)
+		}
+	}
+	return nil
+}
+
+// transient reports whether err is worth retrying: the server or the network
+// was having trouble (5xx, 408, 429, timeouts, refused or reset connections),
+// as opposed to a request that will keep failing the same way (404, 403, a
+// bad URL, a content type mismatch).
+//
+// Errors that don't say either way count as permanent, so a retry never masks
+// a configuration mistake.
+func transient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var se *httputil.StatusError
+	if errors.As(err, &se) {
+		return se.Temporary()
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary // "no such host" is permanent
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// errorKind classifies err for the report: "transient" or "permanent".
+func errorKind(err error) string {
+	if transient(err) {
+		return "transient"
+	}
+	return "permanent"
+}
+
+// retryDelay is how long to wait before retry number attempt (0-based):
+// backoff doubled per attempt, capped, with "equal jitter" - half the delay
+// is fixed and half random - so parallel workers that failed together don't
+// retry in lockstep. A server's Retry-After is honored as a minimum.
+func retryDelay(backoff time.Duration, attempt int, err error) time.Duration {
+	d := backoff
+	for i := 0; i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxRetryBackoff)
+	d = d/2 + rand.N(d/2+1)
+
+	var se *httputil.StatusError
+	if errors.As(err, &se) && se.RetryAfter > d {
+		d = min(se.RetryAfter, maxRetryBackoff)
+	}
+	return d
+}
+
+// retry runs op, repeating it after transient failures as p allows. Each retry
+// is announced in the dataset's output and counted in its report; the last
+// error is returned. what names the operation in messages ("fetch",
+// "fingerprint").
+//
+// Go learning note: the wait is a select on a timer and ctx.Done(), so a
+// cancelled run stops waiting at once instead of sleeping out the backoff.
+func (r *datasetResult) retry(ctx context.Context, p retryPolicy, what string, op func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= p.retries || !transient(err) {
+			return explainTimeout(ctx, err)
+		}
+		if ctx.Err() != nil {
+			return explainTimeout(ctx, ctx.Err()) // No time left for a retry
+		}
+		delay := retryDelay(p.backoff, attempt, err)
+		r.printf("[WARN] %s: %s: %v (retry %d/%d in %s)\n", r.report.ID, what, err, attempt+1, p.retries, delay.Round(time.Millisecond))
+		r.report.Retries++
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return explainTimeout(ctx, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// mockFlakyHandler answers with 503 until its failures run out, and with 404
+// for sources whose path is "gone".
+type mockFlakyHandler struct{ failures atomic.Int32 }
+
+func (m *mockFlakyHandler) Name() string { return "mockflaky" }
+
+func (m *mockFlakyHandler) err(src registry.Source) error {
+	if src.Path == "gone" {
+		return &httputil.StatusError{Method: "GET", URL: "https://example.com/gone", Code: 404, Status: "404 Not Found"}
+	}
+	if m.failures.Add(-1) >= 0 {
+		return &httputil.StatusError{Method: "GET", URL: "https://example.com/flaky", Code: 503, Status: "503 Service Unavailable"}
+	}
+	return nil
+}
+
+func (m *mockFlakyHandler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	if err := m.err(src); err != nil {
+		return "", err
+	}
+	return "flaky-fp", nil
+}
+
+func (m *mockFlakyHandler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	if err := m.err(src); err != nil {
+		return err
+	}
+	return os.WriteFile(dest, []byte("flaky data"), 0o644)
+}
+
+var flaky = &mockFlakyHandler{}
+
+func init() {
+	registry.Register(flaky)
+}
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"503", &httputil.StatusError{Code: 503}, true},
+		{"429", &httputil.StatusError{Code: 429}, true},
+		{"404", &httputil.StatusError{Code: 404}, false},
+		{"wrapped 502", fmt.Errorf("source 1: %w", &httputil.StatusError{Code: 502}), true},
+		{"connection refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{"unknown host", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, false},
+		{"dns timeout", &net.DNSError{Err: "timeout", IsTimeout: true}, true},
+		{"deadline", context.DeadlineExceeded, true},
+		{"cancelled", context.Canceled, false},
+		{"config mistake", errors.New("http: missing source.url"), false},
+	}
+	for _, tt := range tests {
+		if got := transient(tt.err); got != tt.want {
+			t.Errorf("%s: transient() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		for range 20 {
+			if d := retryDelay(time.Second, attempt, nil); d < max/2 || d > max {
+				t.Fatalf("retryDelay(1s, %d) = %v, want between %v and %v", attempt, d, max/2, max)
+			}
+		}
+	}
+	if d := retryDelay(time.Second, 30, nil); d > maxRetryBackoff {
+		t.Errorf("retryDelay after many attempts = %v, want at most %v", d, maxRetryBackoff)
+	}
+	hint := &httputil.StatusError{Code: 429, RetryAfter: 10 * time.Second}
+	if d := retryDelay(time.Millisecond, 0, hint); d != 10*time.Second {
+		t.Errorf("retryDelay with Retry-After = %v, want 10s", d)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	p := retryPolicy{retries: 3, backoff: time.Millisecond}
+	transientErr := &httputil.StatusError{Code: 503, Status: "503 Service Unavailable"}
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		res := newDatasetResult("d1")
+		calls := 0
+		err := res.retry(context.Background(), p, "fetch", func() error {
+			if calls++; calls < 3 {
+				return transientErr
+			}
+			return nil
+		})
+		if err != nil || calls != 3 || res.report.Retries != 2 {
+			t.Errorf("err = %v, calls = %d, retries = %d; want nil, 3, 2", err, calls, res.report.Retries)
+		}
+		if !strings.Contains(res.out.String(), "(retry 2/3 in ") {
+			t.Errorf("output does not announce retries:\n%s", res.out.String())
+		}
+	})
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		res := newDatasetResult("d1")
+		calls := 0
+		err := res.retry(context.Background(), p, "fetch", func() error { calls++; return transientErr })
+		if err != transientErr || calls != 4 {
+			t.Errorf("err = %v, calls = %d; want the 503, 4 calls", err, calls)
+		}
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		res := newDatasetResult("d1")
+		calls := 0
+		res.retry(context.Background(), p, "fetch", func() error {
+			calls++
+			return &httputil.StatusError{Code: 404}
+		})
+		if calls != 1 || res.report.Retries != 0 {
+			t.Errorf("calls = %d, retries = %d; want 1, 0", calls, res.report.Retries)
+		}
+	})
+
+	t.Run("cancellation stops the wait", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		res := newDatasetResult("d1")
+		slow := retryPolicy{retries: 1, backoff: time.Hour}
+		if err := res.retry(ctx, slow, "fetch", func() error { return transientErr }); !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, want context.Canceled", err)
+		}
+	})
+}
+
+func TestRetryConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(body string) string {
+		path := filepath.Join(dir, "config.yaml")
+		os.WriteFile(path, []byte(body), 0o644)
+		return path
+	}
+
+	cfg, err := readConfig(write(`version: 1
+defaults:
+  retries: 3
+  retry_backoff: 250ms
+datasets:
+  - id: a
+    source: {type: mock}
+    target: a.txt
+  - id: b
+    source: {type: mock}
+    target: b.txt
+    retries: 0
+    retry_backoff: 2s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.retryPolicyFor(cfg.Datasets[0]); got != (retryPolicy{3, 250 * time.Millisecond}) {
+		t.Errorf("defaults: %+v", got)
+	}
+	if got := cfg.retryPolicyFor(cfg.Datasets[1]); got != (retryPolicy{0, 2 * time.Second}) {
+		t.Errorf("dataset override: %+v", got)
+	}
+
+	for _, bad := range []string{
+		"defaults:\n  retries: -1\n",
+		"defaults:\n  retry_backoff: soon\n",
+		"datasets:\n  - id: a\n    source: {type: mock}\n    target: a.txt\n    retry_backoff: 0s\n",
+	} {
+		if _, err := readConfig(write("version: 1\n" + bad)); err == nil || !strings.Contains(err.Error(), "retr") {
+			t.Errorf("readConfig(%q) error = %v, want a retries error", bad, err)
+		}
+	}
+}
+
+func TestFetch_Retries(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte(`version: 1
+defaults:
+  retries: 2
+  retry_backoff: 1ms
+datasets:
+  - id: flaky
+    source: {type: mockflaky}
+    target: `+filepath.Join(dir, "flaky.txt")+`
+  - id: gone
+    source: {type: mockflaky, path: gone}
+    target: `+filepath.Join(dir, "gone.txt")+`
+`), 0o644)
+
+	flaky.failures.Store(2)
+	var out strings.Builder
+	code := FetchWithOptions(cfgPath, filepath.Join(dir, "lock.yaml"), nil, Options{Jobs: 1, Report: &out})
+	if code != 1 {
+		t.Errorf("exit = %d, want 1 (gone fails)", code)
+	}
+	var rep Report
+	if err := json.Unmarshal([]byte(out.String()), &rep); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]DatasetReport{}
+	for _, d := range rep.Datasets {
+		got[d.ID] = d
+	}
+	if d := got["flaky"]; d.Status != "fetched" || d.Retries != 2 {
+		t.Errorf("flaky: status %q after %d retries, want fetched after 2", d.Status, d.Retries)
+	}
+	if d := got["gone"]; d.Status != "error" || d.ErrorKind != "permanent" || d.Retries != 0 {
+		t.Errorf("gone: status %q, kind %q, %d retries; want a permanent error, not retried", d.Status, d.ErrorKind, d.Retries)
+	}
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+)
+
+// forEachDatasetRetrying is forEachDataset followed by up to passes more
+// rounds over the datasets whose result was an error, for Options.RetryRun.
+//
+// Retries within a dataset (retries in the config) repeat one operation
+// after an error that looks transient. This repeats whole datasets, whatever
+// the error, once everything else has finished: flaky CI runners fail in ways
+// no error type admits to (a full disk that frees up, a command that loses its
+// network), and a later pass often gets through. Successful datasets aren't
+// touched again, so an expensive fetch is never repeated.
+//
+// apply may see the same i several times; each result replaces the earlier
+// one. Datasets that are changed or interrupted aren't errors and aren't
+// retried, and a cancelled ctx stops after the current pass. Datasets skipped
+// by gate for a failed dependency are retried along with it; gate may be nil.
+func forEachDatasetRetrying(ctx context.Context, passes, jobs, n int, gate *dependencyGate, work func(i int) *datasetResult, apply func(i int, res *datasetResult)) {
+	todo := make([]int, n)
+	for i := range todo {
+		todo[i] = i
+	}
+	for pass := 1; ; pass++ {
+		var failed []int
+		forEachDataset(jobs, len(todo), func(k int) *datasetResult {
+			res := gate.run(todo[k], work)
+			if pass > 1 {
+				res.report.Attempts = pass
+			}
+			return res
+		}, func(k int, res *datasetResult) {
+			apply(todo[k], res)
+			if res.report.Status == "error" || gate.retry(todo[k]) {
+				failed = append(failed, todo[k])
+			}
+		})
+		if len(failed) == 0 {
+			if pass > 1 {
+				logf("[INFO] every dataset retried succeeded on pass %d\n", pass)
+			}
+			return
+		}
+		if pass > passes || ctx.Err() != nil {
+			if pass > 1 {
+				logf("[INFO] %d dataset(s) still failing after %d passes\n", len(failed), pass)
+			}
+			return
+		}
+		logf("[INFO] retrying %d failed dataset(s) (pass %d of %d)\n", len(failed), pass+1, passes+1)
+		todo = failed
+		gate.reset(todo)
+	}
+}
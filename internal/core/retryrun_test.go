@@ -0,0 +1,63 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRetryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := `version: 1
+datasets:
+  - id: steady
+    source:
+      type: mock
+    target: ` + filepath.Join(tmpDir, "steady.txt") + `
+  - id: flaky
+    source:
+      type: mockflaky
+    target: ` + filepath.Join(tmpDir, "flaky.txt") + `
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	// Without run retries the first failure sticks
+	flaky.failures.Store(1)
+	if code := FetchWithOptions(configPath, lockPath, nil, Options{Jobs: 1}); code != 1 {
+		t.Errorf("fetch without --retry-run = %d, want 1", code)
+	}
+
+	// The second pass only repeats the failed dataset
+	flaky.failures.Store(1)
+	os.Remove(filepath.Join(tmpDir, "steady.txt"))
+	var buf strings.Builder
+	if code := FetchWithOptions(configPath, lockPath, nil, Options{Jobs: 1, RetryRun: 2, Report: &buf}); code != 0 {
+		t.Errorf("fetch with --retry-run 2 = %d, want 0", code)
+	}
+	var rep Report
+	if err := json.Unmarshal([]byte(buf.String()), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Datasets) != 2 {
+		t.Fatalf("report has %d datasets, want one per dataset", len(rep.Datasets))
+	}
+	for _, d := range rep.Datasets {
+		want := map[string]int{"steady": 0, "flaky": 2}[d.ID]
+		if d.Status != "fetched" || d.Attempts != want {
+			t.Errorf("%s: status %q after %d attempts, want fetched after %d", d.ID, d.Status, d.Attempts, want)
+		}
+	}
+
+	// A dataset that keeps failing fails the run after the last pass
+	flaky.failures.Store(5)
+	if code := FetchWithOptions(configPath, lockPath, []string{"flaky"}, Options{RetryRun: 2}); code != 1 {
+		t.Errorf("fetch of a broken source = %d, want 1", code)
+	}
+	flaky.failures.Store(0)
+}
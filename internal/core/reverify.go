@@ -0,0 +1,50 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// reverifyLocal re-hashes a dataset's local target against its pin when the
+// re-verification cadence has elapsed.
+//
+// Policies like "fail" and "log" never look at the local file during check, so a
+// long-lived checkout can silently rot (bad disks, stray edits) while the remote
+// fingerprint keeps matching. reverify_every closes that gap without touching
+// the pin itself; the outcome is recorded in the status entry si.
+//
+// Returns:
+//   - due: whether a re-verification was performed this run
+//   - ok: whether the local copy matched the lock (only meaningful if due)
+//   - detail: a description of the mismatch when !ok
+func reverifyLocal(ds Dataset, every string, item *LockItem, si *StatusItem, now time.Time) (due, ok bool, detail string) {
+	interval, err := parseInterval(every)
+	if err != nil {
+		// readConfig already validated this; treat as "never due" defensively
+		return false, false, ""
+	}
+	if si.VerifiedAt != nil && si.VerifiedOK && now.Sub(*si.VerifiedAt) < interval {
+		return false, false, ""
+	}
+
+	switch {
+	case item == nil || item.LocalSHA256 == "":
+		detail = "no local_sha256 in lockfile to verify against"
+	case !fileExists(ds.Target):
+		detail = "local file is missing"
+	default:
+		h, _, err := HashPath(ds.Target)
+		switch {
+		case err != nil:
+			detail = fmt.Sprintf("local hash: %v", err)
+		case h != item.LocalSHA256:
+			detail = fmt.Sprintf("local sha256 %s does not match lock %s", h, item.LocalSHA256)
+		default:
+			ok = true
+		}
+	}
+
+	si.VerifiedAt = &now
+	si.VerifiedOK = ok
+	return true, ok, detail
+}
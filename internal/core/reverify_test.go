@@ -0,0 +1,95 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"36h", 36 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"1.5d", 36 * time.Hour, false},
+		{"soon", 0, true},
+		{"-1d", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseInterval(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseInterval(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseInterval(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckReverify(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	targetFile := filepath.Join(tmpDir, "target.txt")
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+	statusPath := filepath.Join(tmpDir, ".data.status.yaml")
+
+	os.WriteFile(configPath, []byte(`version: 1
+datasets:
+  - id: pinned
+    source:
+      type: mock
+    target: `+targetFile+`
+    policy: fail
+    reverify_every: 7d
+`), 0o644)
+	os.WriteFile(targetFile, []byte("mock data"), 0o644)
+	lockContent := `version: 1
+items:
+  pinned:
+    local_sha256: 2193bef761a9134b6107714e9413f722af42f4e1315f31bd95f1470f133f50ec
+    remote_fingerprint: mock-fp
+`
+	os.WriteFile(lockPath, []byte(lockContent), 0o644)
+
+	t.Run("matching local copy passes and records status", func(t *testing.T) {
+		if code := Check(configPath, lockPath); code != 0 {
+			t.Fatalf("Check() = %d, want 0", code)
+		}
+		st, err := readStatus(statusPath)
+		if err != nil {
+			t.Fatalf("readStatus() error = %v", err)
+		}
+		si := st.Items["pinned"]
+		if si == nil || si.VerifiedAt == nil || !si.VerifiedOK {
+			t.Fatalf("status not recorded: %+v", si)
+		}
+		if si.ObservedFingerprint != "mock-fp" {
+			t.Errorf("ObservedFingerprint = %q, want mock-fp", si.ObservedFingerprint)
+		}
+	})
+
+	t.Run("not re-hashed again within the cadence", func(t *testing.T) {
+		os.WriteFile(targetFile, []byte("rotted"), 0o644)
+		if code := Check(configPath, lockPath); code != 0 {
+			t.Errorf("Check() = %d, want 0 (verification not due yet)", code)
+		}
+	})
+
+	t.Run("bit-rot fails once due without changing the pin", func(t *testing.T) {
+		os.Remove(statusPath)
+		if code := Check(configPath, lockPath); code != 1 {
+			t.Errorf("Check() = %d, want 1 (local copy modified)", code)
+		}
+		lk, _ := readLock(lockPath)
+		if lk.Items["pinned"].LocalSHA256 != "2193bef761a9134b6107714e9413f722af42f4e1315f31bd95f1470f133f50ec" {
+			t.Error("fail policy must not change the pinned hash")
+		}
+	})
+}
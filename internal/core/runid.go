@@ -0,0 +1,97 @@
+package core
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// newRunID returns a random (version 4) UUID identifying one datum run.
+//
+// Go learning note: a UUID is just 16 random bytes with a few bits fixed to
+// mark its version and variant; crypto/rand makes collisions between runners
+// practically impossible, which is all a run ID needs. No dependency required.
+func newRunID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err) // crypto/rand doesn't fail on supported platforms
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// withRunID returns opts with RunID set, generating one if the caller didn't
+// pass its own. Commands call it once, so everything a run writes carries the
+// same ID.
+func (o Options) withRunID() Options {
+	if o.RunID == "" {
+		o.RunID = newRunID()
+	}
+	return o
+}
+
+// stampRun records runID in item when it pins something different from old,
+// the dataset's previous lock entry (nil if it had none). An item that was
+// only re-checked keeps the ID of the run that last changed it, so run_id
+// always answers "which job put this pin here?". New content or a new
+// fingerprint also drops the transparency log index: the log hasn't
+// witnessed that pin yet.
+func stampRun(item, old *LockItem, runID string) {
+	if old == nil || !samePin(item, old) {
+		item.RunID = runID
+	}
+	if old == nil || item.LocalSHA256 != old.LocalSHA256 || item.RemoteFingerprint != old.RemoteFingerprint {
+		item.TlogIndex = nil
+	}
+}
+
+// samePin reports whether two lock entries pin the same state, ignoring
+// when they were checked and by which run.
+func samePin(a, b *LockItem) bool {
+	return a.LocalSHA256 == b.LocalSHA256 &&
+		a.RemoteFingerprint == b.RemoteFingerprint &&
+		a.Size == b.Size &&
+		a.Files == b.Files &&
+		a.Slice == b.Slice &&
+		a.RawSHA256 == b.RawSHA256 &&
+		a.Transform == b.Transform &&
+		a.InaccessibleError == b.InaccessibleError &&
+		(a.InaccessibleAt == nil) == (b.InaccessibleAt == nil)
+}
+
+// clone copies the lock deeply enough that changes to lk's entries, which
+// are replaced or have their fields set in place, don't show in the copy.
+func (lk *Lock) clone() *Lock {
+	c := *lk
+	c.Items = make(map[string]*LockItem, len(lk.Items))
+	for id, it := range lk.Items {
+		c.Items[id] = it.clone()
+	}
+	c.PolicyBundle = lk.PolicyBundle.clone()
+	return &c
+}
+
+// pinsChanged reports whether after pins anything differently from before:
+// an entry added, removed or changed (see samePin), or newly witnessed by
+// the transparency log. Check and run times don't count.
+func pinsChanged(before, after *Lock) bool {
+	if len(before.Items) != len(after.Items) {
+		return true
+	}
+	for id, b := range before.Items {
+		a, ok := after.Items[id]
+		if !ok || !sameEntry(a, b) {
+			return true
+		}
+	}
+	return !sameEntry(after.PolicyBundle, before.PolicyBundle)
+}
+
+// sameEntry is samePin for entries that may be nil, also comparing whether
+// they are witnessed.
+func sameEntry(a, b *LockItem) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return samePin(a, b) && a.Target == b.Target && (a.TlogIndex == nil) == (b.TlogIndex == nil)
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRunID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, b := newRunID(), newRunID()
+	if !uuid.MatchString(a) {
+		t.Errorf("newRunID() = %q, want a version 4 UUID", a)
+	}
+	if a == b {
+		t.Errorf("two run IDs are both %q", a)
+	}
+	if got := (Options{RunID: "ci-42"}).withRunID().RunID; got != "ci-42" {
+		t.Errorf("withRunID replaced the caller's ID with %q", got)
+	}
+}
+
+func TestStampRun(t *testing.T) {
+	now := time.Now()
+	old := &LockItem{LocalSHA256: "aa", RemoteFingerprint: "fp1", RunID: "first"}
+
+	rechecked := &LockItem{LocalSHA256: "aa", RemoteFingerprint: "fp1", CheckedAt: &now, RunID: "first"}
+	stampRun(rechecked, old, "second")
+	if rechecked.RunID != "first" {
+		t.Errorf("re-check stamped run %q, want it to keep first", rechecked.RunID)
+	}
+
+	for name, item := range map[string]*LockItem{
+		"new fingerprint": {LocalSHA256: "bb", RemoteFingerprint: "fp2"},
+		"inaccessible":    {LocalSHA256: "aa", RemoteFingerprint: "fp1", InaccessibleAt: &now, InaccessibleError: "404"},
+	} {
+		stampRun(item, old, "second")
+		if item.RunID != "second" {
+			t.Errorf("%s: run = %q, want second", name, item.RunID)
+		}
+	}
+
+	added := &LockItem{LocalSHA256: "aa"}
+	stampRun(added, nil, "second")
+	if added.RunID != "second" {
+		t.Errorf("new entry: run = %q, want second", added.RunID)
+	}
+}
+
+func TestRunIDInLockAndReport(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := "version: 1\ndatasets:\n" +
+		"  - id: a\n    source:\n      type: mock\n    target: " + filepath.Join(tmpDir, "a.txt") + "\n"
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	var buf bytes.Buffer
+	if code := FetchWithOptions(configPath, lockPath, nil, Options{RunID: "job-1", Report: &buf}); code != 0 {
+		t.Fatalf("fetch exit = %d", code)
+	}
+	var rep Report
+	if err := json.Unmarshal(buf.Bytes(), &rep); err != nil || rep.RunID != "job-1" {
+		t.Errorf("report run_id = %q (%v), want job-1", rep.RunID, err)
+	}
+	lk, _ := readLock(lockPath)
+	if got := lk.Items["a"].RunID; got != "job-1" {
+		t.Errorf("lock run_id after fetch = %q, want job-1", got)
+	}
+	b, _ := os.ReadFile(lockPath)
+	if !strings.Contains(string(b), "run_id: job-1") {
+		t.Errorf("lockfile doesn't record the run:\n%s", b)
+	}
+
+	// A check that finds nothing new leaves the stamp of the run that pinned it
+	if code := CheckWithOptions(configPath, lockPath, Options{RunID: "job-2"}); code != 0 {
+		t.Fatalf("check exit = %d", code)
+	}
+	lk, _ = readLock(lockPath)
+	if got := lk.Items["a"].RunID; got != "job-1" {
+		t.Errorf("lock run_id after an unchanged check = %q, want job-1", got)
+	}
+
+	// Without an ID, each run gets its own
+	buf.Reset()
+	CheckWithOptions(configPath, lockPath, Options{Report: &buf})
+	if err := json.Unmarshal(buf.Bytes(), &rep); err != nil || rep.RunID == "" || rep.RunID == "job-1" {
+		t.Errorf("generated run_id = %q (%v)", rep.RunID, err)
+	}
+}
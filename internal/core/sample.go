@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseSampleSize converts a --sample value into a dataset count out of total.
+//
+// Accepted forms are a percentage ("10%") or an absolute count ("25"). Any
+// non-empty sample selects at least one dataset, so small configs still make
+// progress towards full coverage.
+func parseSampleSize(s string, total int) (int, error) {
+	var n int
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		p, err := strconv.ParseFloat(pct, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, fmt.Errorf("invalid sample %q (want a percentage in (0, 100])", s)
+		}
+		n = int(math.Ceil(float64(total) * p / 100))
+	} else {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			return 0, fmt.Errorf("invalid sample %q (want N or P%%)", s)
+		}
+		n = v
+	}
+	return max(1, min(n, total)), nil
+}
+
+// sampleDatasets picks the k least recently covered datasets.
+//
+// Datasets that have never been covered come first, then the oldest coverage,
+// with config order breaking ties. Because every selected dataset's coverage
+// time is refreshed afterwards, repeated runs walk through the whole config
+// round-robin: each dataset is checked at least once every ceil(n/k) runs.
+func sampleDatasets(datasets []Dataset, st *Status, k int) []Dataset {
+	covered := func(id string) time.Time {
+		if si := st.Items[id]; si != nil && si.CoveredAt != nil {
+			return *si.CoveredAt
+		}
+		return time.Time{}
+	}
+
+	order := make([]int, len(datasets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return covered(datasets[order[a]].ID).Before(covered(datasets[order[b]].ID))
+	})
+
+	// Keep the selection in config order so output reads naturally
+	picked := order[:k]
+	sort.Ints(picked)
+	out := make([]Dataset, 0, k)
+	for _, i := range picked {
+		out = append(out, datasets[i])
+	}
+	return out
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSampleSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		total   int
+		want    int
+		wantErr bool
+	}{
+		{"10%", 100, 10, false},
+		{"10%", 5, 1, false},
+		{"50%", 3, 2, false},
+		{"3", 10, 3, false},
+		{"30", 10, 10, false},
+		{"0", 10, 0, true},
+		{"150%", 10, 0, true},
+		{"lots", 10, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseSampleSize(tt.in, tt.total)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSampleSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSampleSize(%q, %d) = %d, want %d", tt.in, tt.total, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSampleCoversEverything(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	cfg := "version: 1\ndatasets:\n"
+	ids := []string{"a", "b", "c", "d", "e"}
+	for _, id := range ids {
+		cfg += "  - id: " + id + "\n    source:\n      type: mock\n    target: " + filepath.Join(tmpDir, id+".txt") + "\n    policy: update\n"
+	}
+	os.WriteFile(configPath, []byte(cfg), 0o644)
+
+	// 2 per run over 5 datasets: everything is covered after 3 runs
+	for run := 0; run < 3; run++ {
+		if code := CheckWithOptions(configPath, lockPath, Options{Sample: "2"}); code != 0 {
+			t.Fatalf("run %d: CheckWithOptions() = %d, want 0", run, code)
+		}
+	}
+
+	lk, _ := readLock(lockPath)
+	for _, id := range ids {
+		if lk.Items[id] == nil {
+			t.Errorf("dataset %s was never covered by sampled checks", id)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Partial content pinning: some upstream files are huge while a project only
+// needs a small region of them. A source's range (bytes, http only) or lines
+// setting makes the target hold just that region. The lock then records two
+// things: remote_fingerprint still describes the whole upstream file, so any
+// change to it is noticed, and local_sha256 is the hash of the slice, with
+// slice saying which part was kept.
+
+// validateSlice checks a source's range and lines settings.
+func validateSlice(src registry.Source) error {
+	if src.Range != "" {
+		if src.Type != "http" {
+			return fmt.Errorf("range: only supported by http sources (use lines to slice other sources)")
+		}
+		if _, _, err := httputil.ParseRange(src.Range, 0); err != nil {
+			return fmt.Errorf("range: %w", err)
+		}
+	}
+	if src.Lines != "" {
+		if _, _, err := httputil.ParseRange(src.Lines, 1); err != nil {
+			return fmt.Errorf("lines: %w", err)
+		}
+	}
+	if src.Member != "" {
+		if src.Type != "http" {
+			return fmt.Errorf("member: only supported by http sources")
+		}
+		if src.Range != "" {
+			return fmt.Errorf("member: can't be combined with range (use lines to slice the member)")
+		}
+		if src.ArchivePath != "" {
+			return fmt.Errorf("member: can't be combined with archive_path (both pick a file out of an archive)")
+		}
+	}
+	return nil
+}
+
+// sliceSpec describes the part of src a target holds, for the lock: e.g.
+// "member=data/x.csv", "bytes=0-1048575", "decompress=gzip" (see
+// decompress.go), "archive_path=x/y.csv" (see archive.go), "lines=2-1001",
+// "jq=.data" (see extract.go), several of them joined by commas, or "" for
+// all of it.
+func sliceSpec(src registry.Source) string {
+	var spec string
+	if src.Member != "" {
+		spec = "member=" + src.Member
+	}
+	if src.Range != "" {
+		spec = "bytes=" + src.Range
+	}
+	if src.Decompress != "" {
+		spec = strings.TrimPrefix(spec+",decompress="+src.Decompress, ",")
+	}
+	if src.ArchivePath != "" {
+		spec = strings.TrimPrefix(spec+",archive_path="+src.ArchivePath, ",")
+	}
+	if src.Lines != "" {
+		if spec != "" {
+			spec += ","
+		}
+		spec += "lines=" + src.Lines
+	}
+	if src.Extract != nil {
+		spec = strings.TrimPrefix(spec+","+extractSpec(src.Extract), ",")
+	}
+	return spec
+}
+
+// reshapes reports whether src has settings that change its data after the
+// fetch (see reshape).
+func reshapes(src registry.Source) bool {
+	return src.Decompress != "" || src.ArchivePath != "" || src.Extract != nil || src.Lines != ""
+}
+
+// reshape applies src's decompress (see decompress.go), archive_path (see
+// archive.go), extract (see extract.go) and lines settings, in that order, to
+// the data fetched to path. raw is the SHA256 of the data as fetched when any
+// but lines changed it, and "" otherwise.
+func reshape(path string, src registry.Source) (raw string, err error) {
+	if !reshapes(src) {
+		return "", nil
+	}
+	if isDir(path) {
+		return "", fmt.Errorf("%s: source is a directory", reshapeSettings(src))
+	}
+	if src.Decompress != "" || src.ArchivePath != "" || src.Extract != nil {
+		if raw, err = HashFile(path); err != nil {
+			return "", err
+		}
+	}
+	if src.Decompress != "" {
+		if err := decompressFile(path, src.Decompress); err != nil {
+			return "", fmt.Errorf("decompress: %w", err)
+		}
+	}
+	if src.ArchivePath != "" {
+		if err := unpackMember(path, src.ArchivePath); err != nil {
+			return "", fmt.Errorf("archive_path %s: %w", src.ArchivePath, err)
+		}
+	}
+	if src.Extract != nil {
+		if err := extractJSON(path, src.Extract); err != nil {
+			return "", err
+		}
+	}
+	if src.Lines != "" {
+		if err := sliceLines(path, src.Lines); err != nil {
+			return "", fmt.Errorf("lines %s: %w", src.Lines, err)
+		}
+	}
+	return raw, nil
+}
+
+// reshapeSettings names the reshaping settings src uses, for messages.
+func reshapeSettings(src registry.Source) string {
+	var names []string
+	if src.Decompress != "" {
+		names = append(names, "decompress")
+	}
+	if src.ArchivePath != "" {
+		names = append(names, "archive_path")
+	}
+	if src.Extract != nil {
+		names = append(names, "extract")
+	}
+	if src.Lines != "" {
+		names = append(names, "lines "+src.Lines)
+	}
+	return strings.Join(names, ", ")
+}
+
+// sliceLines cuts the file at path down to the lines in spec (see
+// registry.Source.Lines). Lines keep their line endings, and a final line
+// without one is kept as it is.
+//
+// Go learning note: bufio.Reader.ReadString returns the data read so far along
+// with io.EOF, so the last line is handled even without a trailing newline.
+func sliceLines(path, spec string) error {
+	first, last, err := httputil.ParseRange(spec, 1)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := path + ".lines"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	r, w := bufio.NewReader(in), bufio.NewWriter(out)
+	for n := int64(1); last < 0 || n <= last; n++ {
+		line, err := r.ReadString('\n')
+		if n >= first {
+			w.WriteString(line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
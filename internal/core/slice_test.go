@@ -0,0 +1,120 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestSliceLines(t *testing.T) {
+	tests := []struct {
+		content, spec, want string
+	}{
+		{"h\n1\n2\n3\n", "1-2", "h\n1\n"},
+		{"h\n1\n2\n3\n", "3-", "2\n3\n"},
+		{"h\n1\n2", "2-10", "1\n2"}, // no final newline, range past the end
+		{"a\r\nb\r\n", "2-2", "b\r\n"},
+		{"h\n", "5-", ""},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "data")
+		os.WriteFile(path, []byte(tt.content), 0o644)
+		if err := sliceLines(path, tt.spec); err != nil {
+			t.Errorf("sliceLines(%q, %s): %v", tt.content, tt.spec, err)
+			continue
+		}
+		if b, _ := os.ReadFile(path); string(b) != tt.want {
+			t.Errorf("sliceLines(%q, %s) = %q, want %q", tt.content, tt.spec, b, tt.want)
+		}
+	}
+}
+
+func TestValidateSlice(t *testing.T) {
+	valid := []registry.Source{
+		{Type: "http", Range: "0-1023"},
+		{Type: "http", Range: "4096-", Lines: "2-"},
+		{Type: "file", Lines: "1-1000"},
+		{Type: "http", Member: "data/x.csv", Lines: "1-10"},
+	}
+	for _, src := range valid {
+		if err := validateSlice(src); err != nil {
+			t.Errorf("validateSlice(%+v) = %v", src, err)
+		}
+	}
+	invalid := []registry.Source{
+		{Type: "file", Range: "0-10"}, // byte ranges are http only
+		{Type: "http", Range: "10-1"},
+		{Type: "file", Lines: "0-10"}, // lines count from 1
+		{Type: "file", Member: "x.csv"},
+		{Type: "http", Member: "x.csv", Range: "0-10"},
+	}
+	for _, src := range invalid {
+		if err := validateSlice(src); err == nil {
+			t.Errorf("validateSlice(%+v) succeeded", src)
+		}
+	}
+	if got := sliceSpec(registry.Source{Range: "0-99", Lines: "1-5"}); got != "bytes=0-99,lines=1-5" {
+		t.Errorf("sliceSpec() = %q", got)
+	}
+	if got := sliceSpec(registry.Source{Member: "data/x.csv", Lines: "2-"}); got != "member=data/x.csv,lines=2-" {
+		t.Errorf("sliceSpec() = %q", got)
+	}
+}
+
+func TestFetch_Lines(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "huge.csv")
+	os.WriteFile(src, []byte("id,value\n1,a\n2,b\n3,c\n"), 0o644)
+	target := filepath.Join(dir, "head.csv")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: head
+    source:
+      type: mockpath
+      path: `+src+`
+      lines: 1-3
+    target: `+target+`
+`), 0o644)
+	lockPath := filepath.Join(dir, "lock.yaml")
+
+	if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+		t.Fatalf("Fetch() = %d, want 0", code)
+	}
+	if b, _ := os.ReadFile(target); string(b) != "id,value\n1,a\n2,b\n" {
+		t.Errorf("target = %q, want the header and first two rows", b)
+	}
+	lk, _ := readLock(lockPath)
+	item := lk.Items["head"]
+	full, _ := HashFile(src)
+	slice, _ := HashFile(target)
+	if item.RemoteFingerprint != full || item.LocalSHA256 != slice || item.Slice != "lines=1-3" {
+		t.Errorf("lock entry = %+v; want the full source's fingerprint, the slice's hash and its spec", item)
+	}
+	if code := Check(cfgPath, lockPath); code != 0 {
+		t.Errorf("Check() = %d, want 0", code)
+	}
+
+	// A change anywhere upstream is noticed, even outside the slice
+	os.WriteFile(src, []byte("id,value\n1,a\n2,b\n3,CHANGED\n"), 0o644)
+	if code := Check(cfgPath, lockPath); code != 1 {
+		t.Errorf("Check() after an upstream change = %d, want 1", code)
+	}
+
+	os.WriteFile(cfgPath, []byte(strings.Replace(mustRead(t, cfgPath), "lines: 1-3", "lines: 3-1", 1)), 0o644)
+	if _, err := readConfig(cfgPath); err == nil || !strings.Contains(err.Error(), "lines") {
+		t.Errorf("readConfig() with a backwards line range: %v", err)
+	}
+}
+
+func mustRead(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+)
+
+// Status records observations about datasets that must not change the pins.
+//
+// The lockfile is the reviewed, version-controlled record of what data is pinned.
+// The status file (.data.status.yaml by default, next to the lockfile) holds
+// bookkeeping that changes on every run - when a local copy was last re-verified,
+// which remote fingerprint was last observed, when a sampled check last covered
+// it - so it can be cached or ignored by git without dirtying the lock.
+type Status struct {
+	Version int                    `yaml:"version"`
+	Items   map[string]*StatusItem `yaml:"items"`
+	Usage   *Usage                 `yaml:"usage,omitempty"` // Tally for "datum report usage"
+}
+
+// StatusItem is the bookkeeping for a single dataset.
+type StatusItem struct {
+	VerifiedAt          *time.Time `yaml:"verified_at,omitempty"`          // Last local hash re-verification
+	VerifiedOK          bool       `yaml:"verified_ok"`                    // Whether that re-verification matched the lock
+	ObservedFingerprint string     `yaml:"observed_fingerprint,omitempty"` // Remote fingerprint seen on the last check
+	ObservedAt          *time.Time `yaml:"observed_at,omitempty"`          // When ObservedFingerprint was seen
+	CoveredAt           *time.Time `yaml:"covered_at,omitempty"`           // Last time a sampled check included this dataset
+
+	// HTTP caching metadata from the last fingerprint of a cache-aware source
+	CacheURL     string     `yaml:"cache_url,omitempty"`     // Source the metadata belongs to
+	CacheControl string     `yaml:"cache_control,omitempty"` // Raw Cache-Control header
+	Expires      string     `yaml:"expires,omitempty"`       // Raw Expires header
+	Age          string     `yaml:"age,omitempty"`           // Raw Age header
+	FreshUntil   *time.Time `yaml:"fresh_until,omitempty"`   // When the observed fingerprint goes stale
+
+	// How long the most recent operations on this dataset took
+	FingerprintTime time.Duration `yaml:"fingerprint_time,omitempty"` // Remote fingerprint (not served from cache)
+	FetchTime       time.Duration `yaml:"fetch_time,omitempty"`       // Download/copy into the target
+	VerifyTime      time.Duration `yaml:"verify_time,omitempty"`      // Hashing the local target
+	TimedAt         *time.Time    `yaml:"timed_at,omitempty"`         // When the last of these was measured
+
+	// Outcomes, for the metrics export and notifications (see metrics.go, notify.go)
+	CheckedAt *time.Time `yaml:"checked_at,omitempty"` // Last check or fetch that didn't end in an error
+	Failures  int        `yaml:"failures,omitempty"`   // Checks and fetches that did
+	Notified  string     `yaml:"notified,omitempty"`   // Event last sent to the notify webhooks, with its fingerprint
+}
+
+// clone returns a copy of the item that can be modified independently.
+// A nil item yields a new empty one.
+func (si *StatusItem) clone() *StatusItem {
+	if si == nil {
+		return &StatusItem{}
+	}
+	c := *si
+	return &c
+}
+
+// defaultStatusPath returns the status file path used when none is configured.
+func defaultStatusPath(lockPath string) string {
+	return filepath.Join(filepath.Dir(lockPath), ".data.status.yaml")
+}
+
+// readStatus loads the status file, returning an empty Status if it doesn't exist.
+func readStatus(path string) (*Status, error) {
+	st := &Status{Version: 1, Items: map[string]*StatusItem{}}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return st, nil
+	}
+	if err := yaml.Unmarshal(b, st); err != nil {
+		return nil, err
+	}
+	if st.Items == nil {
+		st.Items = map[string]*StatusItem{}
+	}
+	return st, nil
+}
+
+// writeStatus saves the status file atomically.
+func writeStatus(path string, st *Status) error {
+	b, err := yaml.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(path, bytes.NewReader(b))
+}
+
+// usage returns the usage tally, creating it if needed.
+func (st *Status) usage() *Usage {
+	if st.Usage == nil {
+		st.Usage = &Usage{}
+	}
+	return st.Usage
+}
+
+// item returns the status entry for id, creating it if needed.
+func (st *Status) item(id string) *StatusItem {
+	it := st.Items[id]
+	if it == nil {
+		it = &StatusItem{}
+		st.Items[id] = it
+	}
+	return it
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// statusRow is one dataset's line in the status table.
+type statusRow struct {
+	id, policy, local, hash, remote, checked string
+}
+
+// StatusTable prints an overview of every dataset's state without changing
+// anything: not the targets, not the lockfile, not the status file.
+//
+// Columns:
+//   - POLICY: the dataset's effective policy
+//   - LOCAL: whether the target exists
+//   - HASH: whether the target matches the lock's local_sha256 ("ok",
+//     "MODIFIED"), or "unpinned" if the dataset isn't locked yet
+//   - REMOTE: whether the source still matches the lock's remote fingerprint
+//     ("current", "STALE"), "unreachable" if its last fetch failed, or "?" if
+//     unknown. This comes from the fingerprint the last check observed (see
+//     StatusItem) unless remote is set, in which case each source is asked now;
+//     nothing is downloaded either way.
+//   - LAST CHECKED: the lock's checked_at
+//
+// Unlike check, this never records anything, so it's safe to run in a
+// read-only checkout or while another datum process is working.
+//
+// Returns:
+//   - 0: Table printed
+//   - 2: Configuration error
+func StatusTable(cfgPath, lockPath string, remote bool, opts Options) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	lk, _ := readLock(lockPath)
+	statusPath := firstNonEmpty(opts.StatusFile, defaultStatusPath(lockPath))
+	st, err := readStatus(statusPath)
+	if err != nil {
+		logf("[WARN] status file %s: %v\n", statusPath, err)
+		st = &Status{Items: map[string]*StatusItem{}}
+	}
+
+	// Hashing targets and asking sources is slow, so rows are worked out
+	// concurrently; each worker fills in only its own row
+	rows := make([]statusRow, len(cfg.Datasets))
+	ctx := context.Background()
+	forEachDataset(opts.Jobs, len(cfg.Datasets), func(i int) *datasetResult {
+		ds := cfg.Datasets[i]
+		rows[i] = datasetStatusRow(ctx, cfg, ds, lk.Items[ds.ID], st.Items[ds.ID], remote)
+		return newDatasetResult(ds.ID)
+	}, func(int, *datasetResult) {})
+
+	if len(rows) == 0 {
+		logln("[INFO] no datasets configured")
+		return 0
+	}
+	width := len("DATASET")
+	for _, r := range rows {
+		width = max(width, len(r.id))
+	}
+	fmt.Printf("%-*s  %-6s  %-7s  %-8s  %-11s  %s\n", width, "DATASET", "POLICY", "LOCAL", "HASH", "REMOTE", "LAST CHECKED")
+	for _, r := range rows {
+		fmt.Printf("%-*s  %-6s  %-7s  %-8s  %-11s  %s\n", width, r.id, r.policy, r.local, r.hash, r.remote, r.checked)
+	}
+	if !remote {
+		fmt.Println("\nREMOTE is as of each dataset's last check; use --remote to ask the sources now.")
+	}
+	return 0
+}
+
+// datasetStatusRow works out one dataset's row. It runs on a worker
+// goroutine and only reads its arguments.
+func datasetStatusRow(ctx context.Context, cfg *Config, ds Dataset, item *LockItem, si *StatusItem, remote bool) statusRow {
+	r := statusRow{
+		id:      ds.ID,
+		policy:  firstNonEmpty(ds.Policy, cfg.Defaults.Policy),
+		local:   "missing",
+		hash:    "-",
+		remote:  "?",
+		checked: "never",
+	}
+	if fileExists(ds.Target) {
+		r.local = "present"
+	}
+	if item == nil {
+		r.hash = "unpinned"
+		if remote {
+			r.remote = "unpinned"
+		}
+		return r
+	}
+	if item.CheckedAt != nil {
+		r.checked = item.CheckedAt.Local().Format(time.DateTime)
+	}
+	if r.local == "present" && item.LocalSHA256 != "" {
+		if h, _, err := HashPath(ds.Target); err == nil && h == item.LocalSHA256 {
+			r.hash = "ok"
+		} else {
+			r.hash = "MODIFIED"
+		}
+	}
+
+	observed := ""
+	switch {
+	case remote:
+		observed = currentFingerprint(ctx, ds)
+		if observed == "" {
+			r.remote = "unreachable"
+		}
+	case item.InaccessibleAt != nil:
+		r.remote = "unreachable"
+	case si != nil:
+		observed = si.ObservedFingerprint
+	}
+	if observed != "" {
+		r.remote = "current"
+		if observed != item.RemoteFingerprint {
+			r.remote = "STALE"
+		}
+	}
+	return r
+}
+
+// currentFingerprint asks ds's sources for their fingerprint, in order,
+// returning the first answer or "" if none of them answered.
+func currentFingerprint(ctx context.Context, ds Dataset) string {
+	for _, src := range ds.GetSources() {
+		f, ok := registry.Get(src.Type)
+		if !ok {
+			continue
+		}
+		if fp, err := f.Fingerprint(ctx, src); err == nil {
+			return fp
+		}
+	}
+	return ""
+}
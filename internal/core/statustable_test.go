@@ -0,0 +1,76 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestDatasetStatusRow(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "data.txt")
+	os.WriteFile(target, []byte("mock data"), 0o644)
+	h, _ := HashFile(target)
+	cfg := &Config{Defaults: Defaults{Policy: "fail"}}
+	ds := Dataset{ID: "d1", Source: registry.Source{Type: "mock"}, Target: target}
+	checked := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		ds     Dataset
+		item   *LockItem
+		si     *StatusItem
+		remote bool
+		want   statusRow
+	}{
+		{"unpinned", ds, nil, nil, false, statusRow{hash: "unpinned", remote: "?", local: "present"}},
+		{"matching, never observed", ds, &LockItem{LocalSHA256: h, RemoteFingerprint: "mock-fp"}, nil, false,
+			statusRow{local: "present", hash: "ok", remote: "?"}},
+		{"observed stale", ds, &LockItem{LocalSHA256: h, RemoteFingerprint: "old"}, &StatusItem{ObservedFingerprint: "mock-fp"}, false,
+			statusRow{local: "present", hash: "ok", remote: "STALE"}},
+		{"modified, asked now", ds, &LockItem{LocalSHA256: "other", RemoteFingerprint: "mock-fp"}, nil, true,
+			statusRow{local: "present", hash: "MODIFIED", remote: "current"}},
+		{"missing target", Dataset{ID: "d1", Source: registry.Source{Type: "mockfail"}, Target: filepath.Join(dir, "nope")},
+			&LockItem{LocalSHA256: h, RemoteFingerprint: "x", InaccessibleAt: &checked}, nil, false,
+			statusRow{local: "missing", hash: "-", remote: "unreachable"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := datasetStatusRow(ctx, cfg, tt.ds, tt.item, tt.si, tt.remote)
+			if got.local != tt.want.local || got.hash != tt.want.hash || got.remote != tt.want.remote || got.policy != "fail" {
+				t.Errorf("row = %+v, want local %s, hash %s, remote %s", got, tt.want.local, tt.want.hash, tt.want.remote)
+			}
+		})
+	}
+}
+
+func TestStatusTable_ReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "data.txt")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(cfgPath, []byte("version: 1\ndatasets:\n  - id: d1\n    source: {type: mock}\n    target: "+target+"\n"), 0o644)
+	lockPath := filepath.Join(dir, "lock.yaml")
+	if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+		t.Fatal("fetch failed")
+	}
+	os.Remove(defaultStatusPath(lockPath))
+	before, _ := os.ReadFile(lockPath)
+
+	for _, remote := range []bool{false, true} {
+		if code := StatusTable(cfgPath, lockPath, remote, Options{}); code != 0 {
+			t.Errorf("StatusTable(remote=%v) = %d, want 0", remote, code)
+		}
+	}
+	if after, _ := os.ReadFile(lockPath); !bytes.Equal(before, after) {
+		t.Error("status changed the lockfile")
+	}
+	if _, err := os.Stat(defaultStatusPath(lockPath)); err == nil {
+		t.Error("status wrote a status file")
+	}
+}
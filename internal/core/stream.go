@@ -0,0 +1,139 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// FetchTo streams the pinned content of one dataset to w.
+//
+// This is the library-level counterpart to Fetch for callers that want the data
+// without materializing it at the dataset's target. The content is always
+// verified against the lockfile's local_sha256 before any byte reaches w:
+//  1. If the target exists and matches the lock, it is streamed directly (no network)
+//  2. Otherwise the sources are tried in order, fetching into a scratch directory
+//  3. The fetched copy is hashed and rejected if it differs from the pin
+//
+// Neither the target nor the lockfile is modified.
+//
+// Parameters:
+//   - ctx: Context passed through to the handlers
+//   - cfgPath: Path to the configuration file (.data.yaml)
+//   - lockPath: Path to the lockfile (.data.lock.yaml)
+//   - id: The dataset ID to stream
+//   - w: Destination for the verified content
+//
+// Returns:
+//   - An error if the dataset is unknown or unpinned, every source failed, or the
+//     content doesn't match the pinned hash
+func FetchTo(ctx context.Context, cfgPath, lockPath, id string, w io.Writer) error {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
+	lk, err := readLock(lockPath)
+	if err != nil {
+		return fmt.Errorf("lock error: %w", err)
+	}
+
+	var ds *Dataset
+	for i := range cfg.Datasets {
+		if cfg.Datasets[i].ID == id {
+			ds = &cfg.Datasets[i]
+			break
+		}
+	}
+	if ds == nil {
+		return fmt.Errorf("unknown dataset %q", id)
+	}
+	item := lk.Items[id]
+	if item == nil || item.LocalSHA256 == "" {
+		return fmt.Errorf("%s: not pinned in lockfile (run 'datum fetch %s' first)", id, id)
+	}
+	if item.Files > 0 {
+		return fmt.Errorf("%s: target is a directory, which can't be streamed", id)
+	}
+
+	// Fast path: the local copy is already the pinned content
+	if fileExists(ds.Target) {
+		if h, err := HashFile(ds.Target); err == nil && h == item.LocalSHA256 {
+			return copyFileTo(ds.Target, w)
+		}
+	}
+
+	// Slow path: fetch into a private temp directory and verify before streaming
+	dir, err := fsutil.MkdirTemp("datum-fetch-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, filepath.Base(ds.Target))
+
+	var lastErr error
+	for _, source := range ds.GetSources() {
+		f, ok := registry.Get(source.Type)
+		if !ok {
+			lastErr = fmt.Errorf("unknown source.type=%q", source.Type)
+			continue
+		}
+		source.Progress = newProgress(ds.ID)
+		if err := f.Fetch(ctx, source, dest); err != nil {
+			lastErr = err
+			continue
+		}
+		if _, err := reshape(dest, source); err != nil {
+			lastErr = err
+			continue
+		}
+		if ds.Transform != "" {
+			if err := applyTransform(ctx, *ds, source, dest); err != nil {
+				lastErr = err
+				continue
+			}
+		}
+		h, err := HashFile(dest)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if h != item.LocalSHA256 {
+			// A mirror serving different bytes is no better than a failed one
+			lastErr = fmt.Errorf("content sha256 %s does not match lock %s", h, item.LocalSHA256)
+			continue
+		}
+		return copyFileTo(dest, w)
+	}
+	return fmt.Errorf("%s: %w", id, lastErr)
+}
+
+// Cat writes the verified pinned content of one dataset to stdout.
+//
+// Diagnostics go to stderr so they never mix with the streamed data.
+//
+// Returns:
+//   - 0: Content was streamed successfully
+//   - 1: The dataset could not be fetched or failed verification
+func Cat(cfgPath, lockPath, id string) int {
+	if err := FetchTo(context.Background(), cfgPath, lockPath, id, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERR ] %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// copyFileTo streams the file at path to w.
+func copyFileTo(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
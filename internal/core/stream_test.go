@@ -0,0 +1,84 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchTo(t *testing.T) {
+	tmpDir := t.TempDir()
+	ctx := context.Background()
+
+	// sha256("mock data"), the content written by mockHandler
+	const mockSHA = "2193bef761a9134b6107714e9413f722af42f4e1315f31bd95f1470f133f50ec"
+
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	targetFile := filepath.Join(tmpDir, "target.txt")
+	os.WriteFile(configPath, []byte(`version: 1
+datasets:
+  - id: streamed
+    source:
+      type: mock
+    target: `+targetFile+`
+`), 0o644)
+
+	writeLockFor := func(t *testing.T, sha string) string {
+		lockPath := filepath.Join(t.TempDir(), "lock.yaml")
+		os.WriteFile(lockPath, []byte("version: 1\nitems:\n  streamed:\n    local_sha256: "+sha+"\n    remote_fingerprint: mock-fp\n"), 0o644)
+		return lockPath
+	}
+
+	t.Run("fetches and verifies without touching target", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := FetchTo(ctx, configPath, writeLockFor(t, mockSHA), "streamed", &buf); err != nil {
+			t.Fatalf("FetchTo() error = %v", err)
+		}
+		if buf.String() != "mock data" {
+			t.Errorf("FetchTo() wrote %q, want %q", buf.String(), "mock data")
+		}
+		if fileExists(targetFile) {
+			t.Error("FetchTo() should not create the target")
+		}
+	})
+
+	t.Run("rejects content that does not match the pin", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := FetchTo(ctx, configPath, writeLockFor(t, "0000000000000000000000000000000000000000000000000000000000000000"), "streamed", &buf)
+		if err == nil {
+			t.Fatal("FetchTo() expected error for hash mismatch, got nil")
+		}
+		if buf.Len() != 0 {
+			t.Errorf("FetchTo() wrote %d bytes despite mismatch", buf.Len())
+		}
+	})
+
+	t.Run("streams matching local target", func(t *testing.T) {
+		os.WriteFile(targetFile, []byte("mock data"), 0o644)
+		defer os.Remove(targetFile)
+
+		var buf bytes.Buffer
+		if err := FetchTo(ctx, configPath, writeLockFor(t, mockSHA), "streamed", &buf); err != nil {
+			t.Fatalf("FetchTo() error = %v", err)
+		}
+		if buf.String() != "mock data" {
+			t.Errorf("FetchTo() wrote %q, want %q", buf.String(), "mock data")
+		}
+	})
+
+	t.Run("unpinned dataset", func(t *testing.T) {
+		err := FetchTo(ctx, configPath, filepath.Join(t.TempDir(), "none.yaml"), "streamed", &bytes.Buffer{})
+		if err == nil {
+			t.Error("FetchTo() expected error for unpinned dataset, got nil")
+		}
+	})
+
+	t.Run("unknown dataset", func(t *testing.T) {
+		err := FetchTo(ctx, configPath, writeLockFor(t, mockSHA), "nope", &bytes.Buffer{})
+		if err == nil {
+			t.Error("FetchTo() expected error for unknown dataset, got nil")
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package core
+
+import "slices"
+
+// selectByTags narrows datasets to those tagged with any of include (all of
+// them if include is empty), minus those tagged with any of exclude, so a CI
+// job can check or fetch only what it needs:
+//
+//	datum check --tags geo,raw --exclude-tags nightly
+//
+// Requested tags that no dataset in the config carries are warned about:
+// a typo would otherwise quietly select nothing.
+func selectByTags(datasets []Dataset, include, exclude []string) []Dataset {
+	if len(include) == 0 && len(exclude) == 0 {
+		return datasets
+	}
+	for _, tag := range include {
+		if !slices.ContainsFunc(datasets, func(ds Dataset) bool { return hasTag(ds, tag) }) {
+			logf("[WARN] --tags: no dataset is tagged %q\n", tag)
+		}
+	}
+	var out []Dataset
+	for _, ds := range datasets {
+		if len(include) > 0 && !slices.ContainsFunc(include, func(tag string) bool { return hasTag(ds, tag) }) {
+			continue
+		}
+		if slices.ContainsFunc(exclude, func(tag string) bool { return hasTag(ds, tag) }) {
+			continue
+		}
+		out = append(out, ds)
+	}
+	return out
+}
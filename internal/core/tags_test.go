@@ -0,0 +1,81 @@
+package core
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSelectByTags(t *testing.T) {
+	datasets := []Dataset{
+		{ID: "roads", Tags: []string{"geo", "nightly"}},
+		{ID: "parcels", Tags: []string{"geo"}},
+		{ID: "dump", Tags: []string{"raw"}},
+		{ID: "codes"},
+	}
+	tests := []struct {
+		name             string
+		include, exclude []string
+		want             []string
+	}{
+		{"no filter", nil, nil, []string{"roads", "parcels", "dump", "codes"}},
+		{"any of the tags", []string{"geo", "raw"}, nil, []string{"roads", "parcels", "dump"}},
+		{"excluded", nil, []string{"nightly"}, []string{"parcels", "dump", "codes"}},
+		{"both", []string{"geo"}, []string{"nightly"}, []string{"parcels"}},
+		{"unknown tag", []string{"gep"}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, ds := range selectByTags(datasets, tt.include, tt.exclude) {
+				got = append(got, ds.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("selectByTags(%v, %v) = %v, want %v", tt.include, tt.exclude, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAndFetch_Tags(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+	os.WriteFile(configPath, []byte(`version: 1
+datasets:
+  - id: roads
+    tags: [geo, nightly]
+    policy: update
+    source: {type: mock}
+    target: `+filepath.Join(tmpDir, "roads.txt")+`
+  - id: parcels
+    tags: [geo]
+    policy: update
+    source: {type: mock}
+    target: `+filepath.Join(tmpDir, "parcels.txt")+`
+  - id: codes
+    policy: update
+    source: {type: mock}
+    target: `+filepath.Join(tmpDir, "codes.txt")+`
+`), 0o644)
+
+	if code := CheckWithOptions(configPath, lockPath, Options{Tags: []string{"geo"}, ExcludeTags: []string{"nightly"}}); code != 0 {
+		t.Fatalf("CheckWithOptions() = %d, want 0", code)
+	}
+	lk, _ := readLock(lockPath)
+	if lk.Items["parcels"] == nil || lk.Items["roads"] != nil || lk.Items["codes"] != nil {
+		t.Errorf("check --tags geo --exclude-tags nightly pinned %v, want only parcels", slices.Sorted(maps.Keys(lk.Items)))
+	}
+
+	if code := FetchWithOptions(configPath, lockPath, nil, Options{Tags: []string{"nightly"}}); code != 0 {
+		t.Fatalf("FetchWithOptions() = %d, want 0", code)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "roads.txt")); err != nil {
+		t.Errorf("fetch --tags nightly didn't fetch roads: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "codes.txt")); err == nil {
+		t.Error("fetch --tags nightly fetched the untagged codes")
+	}
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// validateTargetAttrs checks a mtime mode and an xattrs map (from defaults or
+// a dataset). The returned error names the offending key.
+func validateTargetAttrs(mtime string, xattrs map[string]string) error {
+	switch mtime {
+	case "", "fetch", "source":
+	default:
+		return fmt.Errorf("mtime: unknown mode %q (want \"fetch\" or \"source\")", mtime)
+	}
+	for name := range xattrs {
+		if ns, rest, ok := strings.Cut(name, "."); !ok || ns == "" || rest == "" {
+			return fmt.Errorf("xattrs: %q needs a namespace, e.g. \"user.%s\"", name, name)
+		}
+	}
+	return nil
+}
+
+// savedXattrs returns the extended attributes of ds's current target when
+// defaults.preserve_xattrs is set, so they can be restored on the file that
+// replaces it.
+//
+// Fetches write a new file and rename it over the target, and a new file gets
+// default attributes: an SELinux label set with chcon, or tags written by
+// other tools, would be silently lost on every update without this.
+func savedXattrs(ds Dataset, cfg *Config) map[string][]byte {
+	if !cfg.Defaults.PreserveXattrs {
+		return nil
+	}
+	attrs, _ := fsutil.Xattrs(ds.Target)
+	return attrs
+}
+
+// finishTarget applies the configured file attributes to a freshly fetched
+// target: ownership, then extended attributes (saved ones first, configured
+// ones on top), then the modification time, which goes last because nothing
+// after it may touch the file's contents.
+//
+// Problems are returned rather than failing the fetch: the data is correct and
+// recorded in the lock either way, so the caller reports them as warnings.
+func finishTarget(ctx context.Context, f registry.Fetcher, src registry.Source, ds Dataset, cfg *Config, saved map[string][]byte) []error {
+	var errs []error
+	if err := applyOwnership(ds, cfg); err != nil {
+		errs = append(errs, err)
+	}
+
+	attrs := map[string][]byte{}
+	for name, value := range saved {
+		attrs[name] = value
+	}
+	for _, set := range []map[string]string{cfg.Defaults.Xattrs, ds.Xattrs} {
+		for name, value := range set {
+			attrs[name] = []byte(value)
+		}
+	}
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fsutil.SetXattr(ds.Target, name, attrs[name]); err != nil {
+			errs = append(errs, fmt.Errorf("xattrs: %w", err))
+		}
+	}
+
+	if firstNonEmpty(ds.Mtime, cfg.Defaults.Mtime) == "source" {
+		if err := setSourceMtime(ctx, f, src, ds.Target); err != nil {
+			errs = append(errs, fmt.Errorf("mtime: %w", err))
+		}
+	}
+	return errs
+}
+
+// setSourceMtime stamps target with the time src's content last changed.
+func setSourceMtime(ctx context.Context, f registry.Fetcher, src registry.Source, target string) error {
+	mt, ok := f.(registry.ModTimer)
+	if !ok {
+		return fmt.Errorf("%s sources don't report a modification time; keeping the fetch time", f.Name())
+	}
+	t, err := mt.ModTime(ctx, src)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(target, time.Now(), t)
+}
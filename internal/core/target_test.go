@@ -0,0 +1,120 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// mockDatedHandler serves content last modified at mockSourceTime.
+type mockDatedHandler struct{ mockHandler }
+
+var mockSourceTime = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func (m *mockDatedHandler) Name() string { return "mockdated" }
+
+func (m *mockDatedHandler) ModTime(ctx context.Context, src registry.Source) (time.Time, error) {
+	return mockSourceTime, nil
+}
+
+func init() {
+	registry.Register(&mockDatedHandler{})
+}
+
+func TestValidateTargetAttrs(t *testing.T) {
+	if err := validateTargetAttrs("source", map[string]string{"user.origin": "x"}); err != nil {
+		t.Errorf("valid settings rejected: %v", err)
+	}
+	if err := validateTargetAttrs("commit", nil); err == nil || !strings.Contains(err.Error(), "mtime") {
+		t.Errorf("unknown mtime mode: error = %v", err)
+	}
+	if err := validateTargetAttrs("", map[string]string{"origin": "x"}); err == nil || !strings.Contains(err.Error(), "namespace") {
+		t.Errorf("xattr without namespace: error = %v", err)
+	}
+}
+
+func TestFetch_SourceMtime(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, ".data.yaml")
+	lockPath := filepath.Join(tmpDir, ".data.lock.yaml")
+	config := `version: 1
+defaults:
+  mtime: source
+datasets:
+  - id: dated
+    source: {type: mockdated}
+    target: ` + filepath.Join(tmpDir, "dated.csv") + `
+  - id: undated
+    source: {type: mock}
+    target: ` + filepath.Join(tmpDir, "undated.csv") + `
+  - id: fetch_time
+    mtime: fetch
+    source: {type: mockdated}
+    target: ` + filepath.Join(tmpDir, "fetch_time.csv") + `
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := FetchWithOptions(configPath, lockPath, nil, Options{}); code != 0 {
+		t.Errorf("FetchWithOptions() = %d, want 0 (mtime problems are warnings)", code)
+	}
+
+	mtime := func(name string) time.Time {
+		fi, err := os.Stat(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.ModTime()
+	}
+	if got := mtime("dated.csv"); !got.Equal(mockSourceTime) {
+		t.Errorf("dated.csv mtime = %v, want the source's %v", got, mockSourceTime)
+	}
+	if got := mtime("fetch_time.csv"); got.Equal(mockSourceTime) {
+		t.Error("fetch_time.csv got the source mtime despite mtime: fetch")
+	}
+	err := setSourceMtime(context.Background(), &mockHandler{}, registry.Source{}, filepath.Join(tmpDir, "undated.csv"))
+	if err == nil || !strings.Contains(err.Error(), "don't report a modification time") {
+		t.Errorf("setSourceMtime() with a handler without ModTime: error = %v", err)
+	}
+}
+
+func TestFinishTarget_Xattrs(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(target, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsutil.SetXattr(target, "user.kept", []byte("1")); err != nil {
+		t.Skipf("extended attributes unavailable here: %v", err)
+	}
+	ds := Dataset{ID: "x", Target: target, Xattrs: map[string]string{"user.origin": "dataset"}}
+	cfg := &Config{Defaults: Defaults{PreserveXattrs: true, Xattrs: map[string]string{"user.origin": "default", "user.team": "geo"}}}
+
+	saved := savedXattrs(ds, cfg)
+	if err := os.Remove(target); err != nil { // a fetch replaces the file
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if errs := finishTarget(context.Background(), &mockHandler{}, registry.Source{}, ds, cfg, saved); len(errs) != 0 {
+		t.Fatalf("finishTarget() = %v", errs)
+	}
+
+	got, err := fsutil.Xattrs(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"user.kept": "1", "user.origin": "dataset", "user.team": "geo"}
+	for name, value := range want {
+		if string(got[name]) != value {
+			t.Errorf("%s = %q, want %q", name, got[name], value)
+		}
+	}
+}
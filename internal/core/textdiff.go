@@ -0,0 +1,165 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Limits for content diffs. Beyond maxDiffBytes a side is summarised rather
+// than compared line by line, and the line-by-line comparison falls back to
+// "replace the whole changed block" when it would need more than maxLCSCells
+// table cells (the middle of two 5000-line files, roughly).
+const (
+	maxDiffBytes = 1 << 20
+	maxLCSCells  = 25_000_000
+	maxDiffLines = 200
+	diffContext  = 3
+)
+
+// diffOp is one line of a diff: ' ' (unchanged), '-' (removed) or '+' (added).
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines computes a line diff that turns a into b.
+//
+// The common prefix and suffix are matched directly, which handles the usual
+// case of a data file with rows appended or a few values edited cheaply; only
+// the block in between goes through the longest-common-subsequence table.
+//
+// Go learning note: the table is one flat slice indexed by i*(m+1)+j rather
+// than a [][]int, which is a single allocation and keeps rows contiguous.
+func diffLines(a, b []string) []diffOp {
+	p := 0
+	for p < len(a) && p < len(b) && a[p] == b[p] {
+		p++
+	}
+	s := 0
+	for s < len(a)-p && s < len(b)-p && a[len(a)-1-s] == b[len(b)-1-s] {
+		s++
+	}
+
+	var ops []diffOp
+	for _, l := range a[:p] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	am, bm := a[p:len(a)-s], b[p:len(b)-s]
+	n, m := len(am), len(bm)
+	if n*m > maxLCSCells {
+		for _, l := range am {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range bm {
+			ops = append(ops, diffOp{'+', l})
+		}
+	} else {
+		// lcs[i*(m+1)+j] is the LCS length of am[i:] and bm[j:]
+		lcs := make([]int, (n+1)*(m+1))
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if am[i] == bm[j] {
+					lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+				} else {
+					lcs[i*(m+1)+j] = max(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n && j < m {
+			switch {
+			case am[i] == bm[j]:
+				ops = append(ops, diffOp{' ', am[i]})
+				i++
+				j++
+			case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+				ops = append(ops, diffOp{'-', am[i]})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', bm[j]})
+				j++
+			}
+		}
+		for ; i < n; i++ {
+			ops = append(ops, diffOp{'-', am[i]})
+		}
+		for ; j < m; j++ {
+			ops = append(ops, diffOp{'+', bm[j]})
+		}
+	}
+	for _, l := range a[len(a)-s:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+// unifiedDiff formats the differences between two texts as unified diff
+// hunks (without the ---/+++ header), at most maxDiffLines lines. It returns
+// nil when the texts are identical.
+func unifiedDiff(a, b string) []string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	// Keep each change and diffContext unchanged lines either side of it
+	keep := make([]bool, len(ops))
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		for k := max(0, i-diffContext); k <= min(len(ops)-1, i+diffContext); k++ {
+			keep[k] = true
+		}
+	}
+
+	var out []string
+	aLine, bLine := 1, 1
+	for i := 0; i < len(ops); {
+		if !keep[i] {
+			if ops[i].kind != '+' {
+				aLine++
+			}
+			if ops[i].kind != '-' {
+				bLine++
+			}
+			i++
+			continue
+		}
+		// One hunk: a run of kept lines
+		end := i
+		aCount, bCount := 0, 0
+		for end < len(ops) && keep[end] {
+			if ops[end].kind != '+' {
+				aCount++
+			}
+			if ops[end].kind != '-' {
+				bCount++
+			}
+			end++
+		}
+		out = append(out, fmt.Sprintf("@@ -%d,%d +%d,%d @@", aLine, aCount, bLine, bCount))
+		for _, op := range ops[i:end] {
+			out = append(out, string(op.kind)+op.line)
+		}
+		aLine += aCount
+		bLine += bCount
+		i = end
+	}
+	if len(out) > maxDiffLines {
+		out = append(out[:maxDiffLines], fmt.Sprintf("... (%d more lines)", len(out)-maxDiffLines))
+	}
+	return out
+}
+
+// splitLines splits text into lines, ignoring a final newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// isText guesses whether content is text: no NUL bytes in the first 8 KiB,
+// the same heuristic git and diff use.
+func isText(b []byte) bool {
+	return !bytes.Contains(b[:min(len(b), 8192)], []byte{0})
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []string
+	}{
+		{"identical", "a\nb\n", "a\nb\n", nil},
+		{"appended row", "h\n1\n", "h\n1\n2\n", []string{"@@ -1,2 +1,3 @@", " h", " 1", "+2"}},
+		{"edited value", "h\n1\n2\n3\n", "h\n1\nX\n3\n", []string{"@@ -1,4 +1,4 @@", " h", " 1", "-2", "+X", " 3"}},
+		{"from empty", "", "a\n", []string{"@@ -1,0 +1,1 @@", "+a"}},
+		{"separate hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			"X\n2\n3\n4\n5\n6\n7\n8\n9\nY\n",
+			[]string{"@@ -1,4 +1,4 @@", "-1", "+X", " 2", " 3", " 4", "@@ -7,4 +7,4 @@", " 7", " 8", " 9", "-10", "+Y"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unifiedDiff() = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff_Truncated(t *testing.T) {
+	got := unifiedDiff("", strings.Repeat("row\n", 500))
+	if len(got) != maxDiffLines+1 || !strings.HasPrefix(got[maxDiffLines], "... (") {
+		t.Errorf("got %d lines ending %q, want %d plus a truncation note", len(got), got[len(got)-1], maxDiffLines)
+	}
+}
+
+func TestIsText(t *testing.T) {
+	if !isText([]byte("a,b\n1,2\n")) || isText([]byte("PK\x03\x04\x00\x00")) {
+		t.Error("isText misclassified CSV or zip content")
+	}
+}
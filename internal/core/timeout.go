@@ -0,0 +1,83 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// runContext returns the context a run's handler operations use: opts.Context
+// when the caller supplied one (the CLI cancels it on Ctrl-C), otherwise one
+// that is never cancelled.
+func (o Options) runContext() context.Context {
+	if o.Context != nil {
+		return o.Context
+	}
+	return context.Background()
+}
+
+// timeoutError is the cause recorded on a dataset's context when its timeout
+// runs out, so the error can say which limit was hit.
+type timeoutError struct{ limit time.Duration }
+
+func (e *timeoutError) Error() string { return fmt.Sprintf("timed out after %s", e.limit) }
+
+// Unwrap keeps a timeout a context.DeadlineExceeded, which counts as transient.
+func (e *timeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// withDatasetTimeout bounds ds's source operations (fingerprints, fetches and
+// the waits between retries, together) by its timeout, or def if it has none.
+// Zero means no limit. readConfig has checked the duration.
+//
+// Go learning note: context.WithTimeoutCause attaches an error to the deadline.
+// ctx.Err() stays context.DeadlineExceeded, as handlers expect, while
+// context.Cause(ctx) returns the timeoutError for explainTimeout.
+func withDatasetTimeout(ctx context.Context, ds Dataset, def time.Duration) (context.Context, context.CancelFunc) {
+	limit := def
+	if ds.Timeout != "" {
+		limit, _ = time.ParseDuration(ds.Timeout)
+	}
+	if limit <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, limit, &timeoutError{limit})
+}
+
+// explainTimeout prefixes err with the timeout that cut it short, if ctx's
+// deadline is what ended it. A handler only sees "context deadline exceeded".
+func explainTimeout(ctx context.Context, err error) error {
+	var te *timeoutError
+	if err == nil || !errors.As(context.Cause(ctx), &te) {
+		return err
+	}
+	return fmt.Errorf("%v: %w", te, err)
+}
+
+// validateTimeout checks a dataset's timeout setting.
+func validateTimeout(s string) error {
+	if s == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(s); err != nil || d <= 0 {
+		return fmt.Errorf("timeout: invalid duration %q (e.g. \"30s\", \"10m\")", s)
+	}
+	return nil
+}
+
+// interrupted reports whether err comes from the run being cancelled (as
+// opposed to a source failing or timing out). The lock keeps its previous
+// entry for such datasets: nothing was learned about the source.
+func interrupted(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// interruptedResult is the result for a dataset the run was cancelled before
+// it got to.
+func interruptedResult(id string) *datasetResult {
+	res := newDatasetResult(id)
+	res.printf("[SKIP] %s: run interrupted before this dataset\n", id)
+	res.report.Status = "interrupted"
+	res.exit = 1
+	return res
+}
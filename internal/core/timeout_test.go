@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// mockSlowHandler's Fetch never finishes on its own: it waits for its context
+// to end, announcing on started (if set) that it's under way.
+type mockSlowHandler struct{ started chan struct{} }
+
+func (m *mockSlowHandler) Name() string { return "mockslow" }
+func (m *mockSlowHandler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	return "slow-fp", nil
+}
+func (m *mockSlowHandler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	if m.started != nil {
+		m.started <- struct{}{}
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+var slowHandler = &mockSlowHandler{}
+
+func init() { registry.Register(slowHandler) }
+
+func TestFetch_Timeout(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+
+	for _, tt := range []struct {
+		name    string
+		setting string // The dataset's timeout line, if any
+		opts    Options
+		want    string
+	}{
+		{"dataset timeout", "    timeout: 50ms\n", Options{}, "timed out after 50ms"},
+		{"--timeout", "", Options{Timeout: 50 * time.Millisecond}, "timed out after 50ms"},
+		{"dataset overrides --timeout", "    timeout: 20ms\n", Options{Timeout: time.Hour}, "timed out after 20ms"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			lockPath := filepath.Join(dir, tt.name+".lock.yaml")
+			os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: slow
+    source:
+      type: mockslow
+    target: `+filepath.Join(dir, "slow.txt")+"\n"+tt.setting), 0o644)
+
+			done := make(chan int)
+			go func() { done <- FetchWithOptions(cfgPath, lockPath, nil, tt.opts) }()
+			select {
+			case code := <-done:
+				if code != 1 {
+					t.Errorf("exit = %d, want 1", code)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("fetch did not time out")
+			}
+			lk, _ := readLock(lockPath)
+			if item := lk.Items["slow"]; item == nil || !strings.Contains(item.InaccessibleError, tt.want) {
+				t.Errorf("lock entry = %+v, want an inaccessible error containing %q", item, tt.want)
+			}
+		})
+	}
+
+	os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: slow
+    timeout: soon
+    source:
+      type: mockslow
+    target: x
+`), 0o644)
+	if code := Fetch(cfgPath, filepath.Join(dir, "bad.lock.yaml"), nil); code != 2 {
+		t.Errorf("invalid timeout: exit = %d, want 2", code)
+	}
+}
+
+func TestFetch_Interrupted(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	lockPath := filepath.Join(dir, "lock.yaml")
+	os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: fast
+    source:
+      type: mock
+    target: `+filepath.Join(dir, "fast.txt")+`
+  - id: slow
+    source:
+      type: mockslow
+    target: `+filepath.Join(dir, "slow.txt")+`
+  - id: later
+    source:
+      type: mock
+    target: `+filepath.Join(dir, "later.txt")+`
+`), 0o644)
+	os.WriteFile(lockPath, []byte(`version: 1
+items:
+  slow:
+    local_sha256: old-hash
+    remote_fingerprint: old-fp
+`), 0o644)
+
+	slowHandler.started = make(chan struct{})
+	defer func() { slowHandler.started = nil }()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-slowHandler.started
+		cancel() // Ctrl-C while "slow" is downloading
+	}()
+
+	if code := FetchWithOptions(cfgPath, lockPath, nil, Options{Jobs: 1, Context: ctx}); code != 1 {
+		t.Errorf("exit = %d, want 1", code)
+	}
+	lk, err := readLock(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lk.Items["fast"] == nil {
+		t.Error("the dataset that finished before the interrupt wasn't saved")
+	}
+	if slow := lk.Items["slow"]; slow == nil || slow.RemoteFingerprint != "old-fp" || slow.InaccessibleAt != nil {
+		t.Errorf("interrupted dataset's entry = %+v, want the previous one untouched", slow)
+	}
+	if lk.Items["later"] != nil {
+		t.Error("a dataset after the interrupt was fetched")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "later.txt")); !os.IsNotExist(err) {
+		t.Error("a dataset after the interrupt was written")
+	}
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Slowest prints the n datasets whose last measured operations took longest.
+//
+// Check and fetch record how long fingerprinting, fetching, and hashing the
+// local target took for every dataset in the status file (see StatusItem).
+// This report ranks datasets by the sum of those timings, which is the data
+// needed to decide which sources are worth mirroring internally.
+//
+// Datasets that have never been measured are left out. Timings are the most
+// recent measurement of each kind, so FETCH may be older than FINGERPRINT if
+// the dataset hasn't needed downloading since.
+//
+// Parameters:
+//   - cfgPath: Path to the configuration file (only configured datasets are listed)
+//   - lockPath: Path to the lockfile; the status file lives next to it by default
+//   - n: Maximum number of rows to print (0 or less prints all)
+//   - opts: StatusFile overrides where timings are read from
+//
+// Returns:
+//   - 0: Report printed
+//   - 2: Configuration error
+func Slowest(cfgPath, lockPath string, n int, opts Options) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	statusPath := firstNonEmpty(opts.StatusFile, defaultStatusPath(lockPath))
+	st, err := readStatus(statusPath)
+	if err != nil {
+		logf("status file %s: %v\n", statusPath, err)
+		return 2
+	}
+
+	type row struct {
+		id string
+		si *StatusItem
+	}
+	var rows []row
+	for _, ds := range cfg.Datasets {
+		if si := st.Items[ds.ID]; si != nil && si.TimedAt != nil {
+			rows = append(rows, row{ds.ID, si})
+		}
+	}
+	// Stable so ties keep config order
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].si.totalTime() > rows[j].si.totalTime()
+	})
+	if n > 0 && len(rows) > n {
+		rows = rows[:n]
+	}
+
+	if len(rows) == 0 {
+		logln("[INFO] no timings recorded yet; run check or fetch first")
+		return 0
+	}
+	fmt.Printf("%-24s %12s %12s %12s %12s  %s\n", "DATASET", "FINGERPRINT", "FETCH", "VERIFY", "TOTAL", "MEASURED")
+	for _, r := range rows {
+		fmt.Printf("%-24s %12s %12s %12s %12s  %s\n", r.id,
+			formatTiming(r.si.FingerprintTime), formatTiming(r.si.FetchTime),
+			formatTiming(r.si.VerifyTime), formatTiming(r.si.totalTime()),
+			r.si.TimedAt.Format(time.RFC3339))
+	}
+	return 0
+}
+
+// totalTime is the sum of the item's recorded operation timings.
+func (si *StatusItem) totalTime() time.Duration {
+	return si.FingerprintTime + si.FetchTime + si.VerifyTime
+}
+
+// formatTiming renders a duration for the report, "-" if it was never measured.
+func formatTiming(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return roundDuration(d).String()
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimingsRecorded(t *testing.T) {
+	tmpDir := t.TempDir()
+	target := filepath.Join(tmpDir, "data.txt")
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := "version: 1\ndefaults:\n  policy: update\ndatasets:\n" +
+		"  - id: timed\n    source:\n      type: mock\n    target: " + target + "\n"
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	if code := FetchWithOptions(configPath, lockPath, nil, Options{}); code != 0 {
+		t.Fatalf("FetchWithOptions() = %d, want 0", code)
+	}
+	st, err := readStatus(defaultStatusPath(lockPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	si := st.Items["timed"]
+	if si == nil || si.TimedAt == nil {
+		t.Fatalf("fetch recorded no timings: %+v", si)
+	}
+	if si.FetchTime <= 0 || si.FingerprintTime <= 0 {
+		t.Errorf("fetch timings = %v/%v, want both measured", si.FetchTime, si.FingerprintTime)
+	}
+
+	if code := CheckWithOptions(configPath, lockPath, Options{}); code != 0 {
+		t.Fatalf("CheckWithOptions() = %d, want 0", code)
+	}
+	st, _ = readStatus(defaultStatusPath(lockPath))
+	if si := st.Items["timed"]; si.VerifyTime <= 0 {
+		t.Errorf("check recorded VerifyTime = %v, want > 0", si.VerifyTime)
+	}
+
+	if code := Slowest(configPath, lockPath, 10, Options{}); code != 0 {
+		t.Errorf("Slowest() = %d, want 0", code)
+	}
+	if code := Slowest(filepath.Join(tmpDir, "missing.yaml"), lockPath, 10, Options{}); code != 2 {
+		t.Errorf("Slowest() with missing config = %d, want 2", code)
+	}
+}
+
+func TestTimingsReadOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := "version: 1\ndatasets:\n" +
+		"  - id: ro\n    source:\n      type: mock\n    target: " + filepath.Join(tmpDir, "ro.txt") + "\n"
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	FetchWithOptions(configPath, lockPath, nil, Options{NoWriteLock: true})
+	if _, err := os.Stat(defaultStatusPath(lockPath)); !os.IsNotExist(err) {
+		t.Errorf("read-only fetch wrote the status file (err = %v)", err)
+	}
+}
+
+func TestFormatTiming(t *testing.T) {
+	if got := formatTiming(0); got != "-" {
+		t.Errorf("formatTiming(0) = %q, want -", got)
+	}
+	if got := formatTiming(1234567 * time.Microsecond); got != "1.235s" {
+		t.Errorf("formatTiming(1.234567s) = %q, want 1.235s", got)
+	}
+	si := &StatusItem{FingerprintTime: time.Second, FetchTime: 2 * time.Second, VerifyTime: time.Second}
+	if got := si.totalTime(); got != 4*time.Second {
+		t.Errorf("totalTime() = %v, want 4s", got)
+	}
+}
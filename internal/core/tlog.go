@@ -0,0 +1,205 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/httputil"
+)
+
+// TransparencyLog is the config's transparency_log block: an append-only log
+// service that witnesses every pin datum records.
+//
+// When it is set, check and fetch submit each new or changed pin to the log
+// and record the returned entry index in the lock entry (tlog_index). "datum
+// lock verify --tlog" then confirms that every pin in the lockfile is the one
+// the log witnessed, so a pin can't change without a trace in the log.
+//
+// The service speaks a small JSON protocol:
+//
+//	POST {url}/entries        body: tlogEntry         -> {"index": N}
+//	GET  {url}/entries/{N}                            -> tlogEntry
+type TransparencyLog struct {
+	URL      string `yaml:"url"`                 // Base URL of the log service
+	TokenEnv string `yaml:"token_env,omitempty"` // Variable holding a bearer token for the service
+}
+
+// tlogEntry is what the log stores for one pin.
+type tlogEntry struct {
+	Dataset     string    `json:"dataset"`
+	SHA256      string    `json:"sha256"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	RunID       string    `json:"run_id,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// tlogClient talks to a transparency log service.
+type tlogClient struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// newTlogClient returns a client for the configured log, or nil if the config
+// has none.
+func newTlogClient(c *Config) *tlogClient {
+	if c.TransparencyLog == nil {
+		return nil
+	}
+	return &tlogClient{
+		url:    strings.TrimSuffix(c.TransparencyLog.URL, "/"),
+		token:  os.Getenv(c.TransparencyLog.TokenEnv),
+		client: &http.Client{Timeout: time.Minute, Transport: &httputil.BudgetTransport{}},
+	}
+}
+
+// validateTransparencyLog checks the transparency_log block, if any.
+func validateTransparencyLog(t *TransparencyLog) error {
+	if t == nil {
+		return nil
+	}
+	if !strings.HasPrefix(t.URL, "https://") && !strings.HasPrefix(t.URL, "http://") {
+		return fmt.Errorf("transparency_log.url must be an http(s) URL, got %q", t.URL)
+	}
+	return nil
+}
+
+// do sends a request to the log and decodes its JSON answer into out.
+func (c *tlogClient) do(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// append submits an entry and returns its index in the log.
+func (c *tlogClient) append(ctx context.Context, e tlogEntry) (int64, error) {
+	var out struct {
+		Index *int64 `json:"index"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/entries", e, &out); err != nil {
+		return 0, err
+	}
+	if out.Index == nil {
+		return 0, fmt.Errorf("POST /entries: no index in response")
+	}
+	return *out.Index, nil
+}
+
+// entry fetches the entry at index.
+func (c *tlogClient) entry(ctx context.Context, index int64) (tlogEntry, error) {
+	var e tlogEntry
+	err := c.do(ctx, http.MethodGet, "/entries/"+strconv.FormatInt(index, 10), nil, &e)
+	return e, err
+}
+
+// witnessPins submits every pinned lock entry the log hasn't witnessed yet
+// (new and changed pins, and any whose submission failed on an earlier run)
+// and records the indices in the lock. Output lines go to stdout; the result
+// is 1 if any submission failed, else 0.
+//
+// Entries are submitted in ID order, so the log's order is reproducible.
+func witnessPins(ctx context.Context, cfg *Config, lk *Lock, runID string) int {
+	c := newTlogClient(cfg)
+	if c == nil {
+		return 0
+	}
+	var ids []string
+	for _, ds := range cfg.Datasets {
+		if it := lk.Items[ds.ID]; it != nil && it.LocalSHA256 != "" && it.TlogIndex == nil {
+			ids = append(ids, ds.ID)
+		}
+	}
+	sort.Strings(ids)
+
+	exit := 0
+	for _, id := range ids {
+		it := lk.Items[id]
+		index, err := c.append(ctx, tlogEntry{
+			Dataset:     id,
+			SHA256:      it.LocalSHA256,
+			Fingerprint: it.RemoteFingerprint,
+			RunID:       runID,
+			Time:        time.Now().UTC(),
+		})
+		if err != nil {
+			logf("[ERR ] %s: transparency log: %v (will retry on the next run)\n", id, err)
+			exit = 1
+			continue
+		}
+		it.TlogIndex = &index
+		logf("[INFO] %s: witnessed in the transparency log (entry %d)\n", id, index)
+	}
+	return exit
+}
+
+// verifyWitnessed checks every pinned lock entry against the log entry it
+// names, returning one issue per pin the log doesn't back up.
+func verifyWitnessed(ctx context.Context, cfg *Config, lk *Lock) []lockIssue {
+	c := newTlogClient(cfg)
+	if c == nil {
+		return []lockIssue{{Fatal: true, Msg: "--tlog: the config has no transparency_log"}}
+	}
+	ids := make([]string, 0, len(lk.Items))
+	for id, it := range lk.Items {
+		if it != nil && it.LocalSHA256 != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var issues []lockIssue
+	for _, id := range ids {
+		it := lk.Items[id]
+		if it.TlogIndex == nil {
+			issues = append(issues, lockIssue{ID: id, Fatal: true, Msg: "pin was never witnessed by the transparency log"})
+			continue
+		}
+		e, err := c.entry(ctx, *it.TlogIndex)
+		switch {
+		case err != nil:
+			issues = append(issues, lockIssue{ID: id, Fatal: true, Msg: fmt.Sprintf("transparency log: %v", err)})
+		case e.Dataset != id || e.SHA256 != it.LocalSHA256 || e.Fingerprint != it.RemoteFingerprint:
+			issues = append(issues, lockIssue{ID: id, Fatal: true, Msg: fmt.Sprintf(
+				"transparency log entry %d witnessed %s sha256=%s fingerprint=%q, not this pin",
+				*it.TlogIndex, e.Dataset, e.SHA256, e.Fingerprint)})
+		}
+	}
+	return issues
+}
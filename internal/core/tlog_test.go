@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeTlog is an in-memory transparency log service.
+type fakeTlog struct {
+	mu      sync.Mutex
+	entries []tlogEntry
+	down    bool
+	auth    string
+}
+
+func (f *fakeTlog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	f.auth = r.Header.Get("Authorization")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/entries":
+		var e tlogEntry
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.entries = append(f.entries, e)
+		json.NewEncoder(w).Encode(map[string]int{"index": len(f.entries) - 1})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/entries/"):
+		i, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/entries/"))
+		if err != nil || i < 0 || i >= len(f.entries) {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(f.entries[i])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestTransparencyLog(t *testing.T) {
+	log := &fakeTlog{}
+	srv := httptest.NewServer(log)
+	defer srv.Close()
+	t.Setenv("TLOG_TOKEN", "s3cret")
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := "version: 1\ntransparency_log:\n  url: " + srv.URL + "/\n  token_env: TLOG_TOKEN\ndatasets:\n" +
+		"  - id: a\n    source:\n      type: mock\n    target: " + filepath.Join(tmpDir, "a.txt") + "\n" +
+		"  - id: b\n    source:\n      type: mock\n    target: " + filepath.Join(tmpDir, "b.txt") + "\n"
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	// The log is down: the fetch fails, but the pins are kept for the next run
+	log.down = true
+	if code := FetchWithOptions(configPath, lockPath, nil, Options{RunID: "job-1"}); code != 1 {
+		t.Errorf("fetch with the log down: exit %d, want 1", code)
+	}
+	lk, _ := readLock(lockPath)
+	if it := lk.Items["a"]; it == nil || it.LocalSHA256 == "" || it.TlogIndex != nil {
+		t.Fatalf("entry after a failed submission = %+v", it)
+	}
+
+	// The next run submits both pins, in ID order
+	log.down = false
+	if code := CheckWithOptions(configPath, lockPath, Options{}); code != 0 {
+		t.Fatalf("check exit = %d", code)
+	}
+	lk, _ = readLock(lockPath)
+	for i, id := range []string{"a", "b"} {
+		if it := lk.Items[id]; it.TlogIndex == nil || *it.TlogIndex != int64(i) {
+			t.Errorf("%s tlog_index = %v, want %d", id, it.TlogIndex, i)
+		}
+	}
+	if len(log.entries) != 2 || log.entries[0].Dataset != "a" || log.entries[0].SHA256 != lk.Items["a"].LocalSHA256 || log.entries[0].Fingerprint != "mock-fp" {
+		t.Errorf("log entries = %+v", log.entries)
+	}
+	if log.auth != "Bearer s3cret" {
+		t.Errorf("Authorization = %q, want the token from token_env", log.auth)
+	}
+
+	// Witnessed pins aren't submitted again
+	CheckWithOptions(configPath, lockPath, Options{})
+	if len(log.entries) != 2 {
+		t.Errorf("unchanged pins were resubmitted: %d entries", len(log.entries))
+	}
+
+	if code := VerifyLock(configPath, lockPath, true); code != 0 {
+		t.Errorf("lock verify --tlog = %d, want 0", code)
+	}
+
+	// A pin edited after the fact no longer matches its entry
+	lk.Items["b"].LocalSHA256 = strings.Repeat("0", 64)
+	if err := writeLock(lockPath, lk); err != nil {
+		t.Fatal(err)
+	}
+	if code := VerifyLock(configPath, lockPath, true); code != 1 {
+		t.Errorf("lock verify --tlog with a tampered pin = %d, want 1", code)
+	}
+	issues := verifyWitnessed(context.Background(), &Config{TransparencyLog: &TransparencyLog{URL: srv.URL}}, lk)
+	if len(issues) != 1 || issues[0].ID != "b" {
+		t.Errorf("issues = %+v, want one for b", issues)
+	}
+
+	// An unwitnessed pin is reported too
+	lk.Items["a"].TlogIndex = nil
+	issues = verifyWitnessed(context.Background(), &Config{TransparencyLog: &TransparencyLog{URL: srv.URL}}, lk)
+	if len(issues) != 2 || !strings.Contains(issues[0].Msg, "never witnessed") {
+		t.Errorf("issues = %+v", issues)
+	}
+}
+
+func TestStampRunDropsTlogIndex(t *testing.T) {
+	idx := int64(7)
+	old := &LockItem{LocalSHA256: "aa", RemoteFingerprint: "fp1", TlogIndex: &idx}
+
+	inaccessible := &LockItem{LocalSHA256: "aa", RemoteFingerprint: "fp1", TlogIndex: &idx, InaccessibleError: "404"}
+	stampRun(inaccessible, old, "run")
+	if inaccessible.TlogIndex == nil {
+		t.Error("an unreachable source dropped the witnessed pin's index")
+	}
+
+	changed := &LockItem{LocalSHA256: "bb", RemoteFingerprint: "fp2", TlogIndex: &idx}
+	stampRun(changed, old, "run")
+	if changed.TlogIndex != nil {
+		t.Error("a changed pin kept the old pin's tlog index")
+	}
+}
+
+func TestValidateTransparencyLog(t *testing.T) {
+	if err := validateTransparencyLog(&TransparencyLog{URL: "tlog.example.com"}); err == nil {
+		t.Error("a URL without a scheme was accepted")
+	}
+	if err := validateTransparencyLog(nil); err != nil {
+		t.Errorf("no transparency_log: %v", err)
+	}
+}
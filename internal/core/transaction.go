@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Transactional fetches: with Options.Transactional, fetch downloads every
+// dataset into a staging path next to its target instead of over it, and
+// only once all of them have succeeded moves them into place and writes the
+// lockfile. If any dataset fails, or the run is interrupted, the staged
+// files are removed and the data directory and lockfile are left exactly as
+// they were, so a half-failed run never mixes old and new data.
+//
+// Moving the staged files in is a rename each (the staging path is in the
+// target's directory, so on the same filesystem), not one atomic step: the
+// targets being replaced are first renamed aside, and if one of the renames
+// fails, those already moved are put back. Readers may see the new versions
+// appear one by one within that short window, but never a partial file.
+//
+// Staged files are named like datum's temp files, so if the process dies
+// before cleaning up, a later run removes them (see fsutil.CleanStaleTemps).
+
+// fetchTxn is the staging area of a transactional fetch.
+type fetchTxn struct {
+	targets []string // Each dataset's target, in processing order
+	staged  []string // Where its new version is fetched to
+}
+
+// newFetchTxn returns a transaction for fetching datasets.
+func newFetchTxn(datasets []Dataset) *fetchTxn {
+	t := &fetchTxn{targets: make([]string, len(datasets)), staged: make([]string, len(datasets))}
+	for i, ds := range datasets {
+		t.targets[i] = ds.Target
+		t.staged[i] = txnPath(ds.Target, "txn")
+	}
+	return t
+}
+
+// txnPath returns the path next to dest where a transaction keeps dest's new
+// version (kind "txn") or its old one while the new ones are moved in ("old").
+func txnPath(dest, kind string) string {
+	return filepath.Join(filepath.Dir(dest), fmt.Sprintf(".%s.datum-%d-%s.tmp", filepath.Base(dest), os.Getpid(), kind))
+}
+
+// stage returns dataset i with its target replaced by its staging path.
+func (t *fetchTxn) stage(i int, ds Dataset) Dataset {
+	ds.Target = t.staged[i]
+	return ds
+}
+
+// commit moves every staged target into place, or none of them: if one
+// can't be moved, the targets already replaced get their old versions back.
+func (t *fetchTxn) commit() error {
+	type moved struct{ target, old string }
+	var done []moved
+	rollback := func() {
+		for j := len(done) - 1; j >= 0; j-- {
+			m := done[j]
+			os.RemoveAll(m.target)
+			if m.old != "" {
+				os.Rename(m.old, m.target)
+			}
+		}
+	}
+	for i, target := range t.targets {
+		if _, err := os.Lstat(t.staged[i]); err != nil {
+			rollback()
+			return fmt.Errorf("%s: nothing staged: %w", target, err)
+		}
+		old := ""
+		if _, err := os.Lstat(target); err == nil {
+			old = txnPath(target, "old")
+			os.RemoveAll(old) // Left over from an interrupted run
+			if err := os.Rename(target, old); err != nil {
+				rollback()
+				return fmt.Errorf("move %s aside: %w", target, err)
+			}
+		}
+		if err := os.Rename(t.staged[i], target); err != nil {
+			if old != "" {
+				os.Rename(old, target)
+			}
+			rollback()
+			return err
+		}
+		done = append(done, moved{target, old})
+	}
+
+	// Everything is in place; the old versions can go. One that can't be
+	// removed now is a stale temp file to the next run
+	for _, m := range done {
+		if m.old != "" {
+			os.RemoveAll(m.old)
+		}
+	}
+	return nil
+}
+
+// finish commits the transaction if every dataset in reports was fetched
+// and the run wasn't interrupted, and reports whether it did. If it didn't,
+// the reason is the run's error in rep.
+func (t *fetchTxn) finish(ctx context.Context, reports []DatasetReport, rep *Report) bool {
+	var failed []string
+	for _, r := range reports {
+		if r.Status != "fetched" {
+			failed = append(failed, r.ID)
+		}
+	}
+	var err error
+	switch {
+	case len(failed) > 0:
+		err = fmt.Errorf("%d of %d dataset(s) not fetched (%s)", len(failed), len(reports), strings.Join(failed, ", "))
+	case ctx.Err() != nil:
+		err = fmt.Errorf("run interrupted")
+	default:
+		err = t.commit()
+	}
+	if err != nil {
+		rep.Error = "transaction aborted: " + err.Error()
+		logf("[ERR ] %s; no targets were replaced and the lockfile was left as it was\n", rep.Error)
+		return false
+	}
+	logf("[OK  ] transaction committed: %d target(s) replaced\n", len(t.targets))
+	return true
+}
+
+// discard removes whatever is still staged. After a commit there is nothing
+// left to remove.
+func (t *fetchTxn) discard() {
+	for _, path := range t.staged {
+		os.RemoveAll(path)
+	}
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFetch_Transactional(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "source.csv")
+	os.WriteFile(src, []byte("new\n"), 0o644)
+	data := filepath.Join(dir, "data")
+	os.MkdirAll(data, 0o755)
+	cfgPath := filepath.Join(dir, "config.yaml")
+	lockPath := filepath.Join(dir, "lock.yaml")
+	writeConfig := func(brokenType string) {
+		os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: codes
+    source:
+      type: mockpath
+      path: `+src+`
+    target: `+filepath.Join(data, "codes.csv")+`
+  - id: other
+    source:
+      type: `+brokenType+`
+    target: `+filepath.Join(data, "other.txt")+`
+`), 0o644)
+	}
+	os.WriteFile(filepath.Join(data, "codes.csv"), []byte("old\n"), 0o644)
+
+	// One failure: nothing is replaced, nothing is pinned, nothing is left behind
+	writeConfig("mockfail")
+	if code := FetchWithOptions(cfgPath, lockPath, nil, Options{Transactional: true}); code != 1 {
+		t.Errorf("FetchWithOptions() with a failing dataset = %d, want 1", code)
+	}
+	if b, _ := os.ReadFile(filepath.Join(data, "codes.csv")); string(b) != "old\n" {
+		t.Errorf("codes.csv = %q after an aborted transaction, want the old version", b)
+	}
+	if _, err := os.Stat(lockPath); err == nil {
+		t.Error("an aborted transaction wrote the lockfile")
+	}
+	entries, _ := os.ReadDir(data)
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("data dir = %s, want only codes.csv", strings.Join(names, ", "))
+	}
+
+	// All succeed: everything is moved into place and pinned
+	writeConfig("mock")
+	if code := FetchWithOptions(cfgPath, lockPath, nil, Options{Transactional: true}); code != 0 {
+		t.Fatalf("FetchWithOptions() = %d, want 0", code)
+	}
+	if b, _ := os.ReadFile(filepath.Join(data, "codes.csv")); string(b) != "new\n" {
+		t.Errorf("codes.csv = %q after a committed transaction, want the new version", b)
+	}
+	lk, _ := readLock(lockPath)
+	if item := lk.Items["codes"]; item == nil || item.Target != filepath.Join(data, "codes.csv") || item.LocalSHA256 != mustHash(t, filepath.Join(data, "codes.csv")) {
+		t.Errorf("codes lock entry = %+v, want the target and its hash", item)
+	}
+	if lk.Items["other"] == nil {
+		t.Error("other wasn't pinned")
+	}
+	if entries, _ := os.ReadDir(data); len(entries) != 2 {
+		t.Errorf("data dir has %d entries after the commit, want 2", len(entries))
+	}
+}
+
+func TestFetchTxn_CommitRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	os.WriteFile(a, []byte("old a"), 0o644)
+	os.WriteFile(b, []byte("old b"), 0o644)
+	txn := newFetchTxn([]Dataset{{ID: "a", Target: a}, {ID: "b", Target: b}})
+	os.WriteFile(txn.staged[0], []byte("new a"), 0o644)
+	// b's download never landed
+
+	if err := txn.commit(); err == nil {
+		t.Fatal("commit() succeeded with a dataset not staged")
+	}
+	for path, want := range map[string]string{a: "old a", b: "old b"} {
+		if got, _ := os.ReadFile(path); string(got) != want {
+			t.Errorf("%s = %q after a failed commit, want %q", filepath.Base(path), got, want)
+		}
+	}
+}
+
+func mustHash(t *testing.T, path string) string {
+	t.Helper()
+	h, err := HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
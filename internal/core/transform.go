@@ -0,0 +1,50 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jprybylski/datum/internal/registry"
+	runrt "github.com/jprybylski/datum/internal/runtime"
+)
+
+// Transform hooks: some upstream formats aren't what a project wants to read
+// (XLSX instead of CSV, Latin-1 instead of UTF-8). A dataset's transform is a
+// shell command that rewrites the fetched data in place before it's hashed:
+//
+//	datasets:
+//	  - id: facilities
+//	    source:
+//	      type: http
+//	      url: https://example.com/facilities.xlsx
+//	    transform: in2csv {{dest}} > {{dest}}.csv && mv {{dest}}.csv {{dest}}
+//	    target: data/facilities.csv
+//
+// {{dest}} (and $DEST) is the staged copy, which only replaces the target if
+// the command succeeds. It runs after the source's own reshaping (see
+// reshape), with the dataset's env. The lock's local_sha256 is the hash of
+// the transformed target, raw_sha256 the hash of the data as fetched, and
+// transform the command, so changing it fetches the data again. Transforms
+// run shell from the config, so they need --allow-commands just like
+// command sources.
+
+// applyTransform runs ds's transform on the data staged at path.
+func applyTransform(ctx context.Context, ds Dataset, src registry.Source, path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	env := []string{"DEST=" + abs}
+	for _, name := range slices.Sorted(maps.Keys(src.Env)) {
+		env = append(env, name+"="+src.Env[name])
+	}
+	cmd := strings.ReplaceAll(ds.Transform, "{{dest}}", abs)
+	if _, err := runrt.RunShell(ctx, "", cmd, env); err != nil {
+		return fmt.Errorf("transform: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFetch_Transform(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("transform commands use sh")
+	}
+	AllowCommands(true)
+	t.Cleanup(func() { AllowCommands(false) })
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "codes.txt")
+	os.WriteFile(src, []byte("a01 typhoid\n"), 0o644)
+	target := filepath.Join(dir, "codes.csv")
+	lockPath := filepath.Join(dir, "lock.yaml")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	writeConfig := func(transform string) {
+		os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: codes
+    source:
+      type: mockpath
+      path: `+src+`
+    env:
+      SEP: ","
+    transform: '`+transform+`'
+    target: `+target+`
+`), 0o644)
+	}
+
+	upper := `tr " a-z" "$SEP"A-Z < {{dest}} > {{dest}}.new && mv {{dest}}.new {{dest}}`
+	writeConfig(upper)
+	if code := Fetch(cfgPath, lockPath, nil); code != 0 {
+		t.Fatalf("Fetch() = %d, want 0", code)
+	}
+	if got := mustRead(t, target); got != "A01,TYPHOID\n" {
+		t.Errorf("target = %q, want the transformed data", got)
+	}
+	lk, _ := readLock(lockPath)
+	item := lk.Items["codes"]
+	raw, _ := HashFile(src)
+	local, _ := HashFile(target)
+	if item.RawSHA256 != raw || item.LocalSHA256 != local || item.Transform != upper {
+		t.Errorf("lock entry = %+v; want raw_sha256 of the fetched data, local_sha256 of the transformed target", item)
+	}
+	if code := Check(cfgPath, lockPath); code != 0 {
+		t.Errorf("Check() = %d, want 0", code)
+	}
+
+	// A failing transform leaves the target as it was
+	writeConfig("exit 3")
+	if code := Fetch(cfgPath, lockPath, nil); code != 1 {
+		t.Errorf("Fetch() with a failing transform = %d, want 1", code)
+	}
+	if got := mustRead(t, target); got != "A01,TYPHOID\n" {
+		t.Errorf("target = %q after a failed transform", got)
+	}
+}
+
+func TestReadConfig_TransformNeedsOptIn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("version: 1\ndatasets:\n  - id: x\n    source:\n      type: file\n      path: a.csv\n    transform: iconv -f latin1 -t utf-8 {{dest}}\n    target: data/x\n"), 0o644)
+	if _, err := readConfig(path); err == nil || !strings.Contains(err.Error(), "--allow-commands") {
+		t.Errorf("readConfig() error = %v, want transforms refused", err)
+	}
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Update accepts upstream changes on purpose: it fetches the named datasets
+// (all of them if ids is empty) whatever their policy, records the new
+// fingerprints in the lock, and prints what changed in a form that can go
+// straight into the commit message.
+//
+// Under the fail policy, check refuses a changed dataset until someone
+// accepts the change; this is the sanctioned way to do it. It is fetch with
+// a stricter command line (unknown IDs are an error rather than ignored) and
+// a summary of old -> new fingerprints at the end.
+//
+// Parameters:
+//   - cfgPath: Path to the configuration file (.data.yaml)
+//   - lockPath: Path to the lockfile (.data.lock.yaml)
+//   - ids: Datasets to update; empty means all
+//   - opts: Engine options for the fetch
+//
+// Returns:
+//   - 0: Every dataset was updated
+//   - 1: A dataset failed to fetch (its lock entry keeps the old pin)
+//   - 2: Configuration error or unknown dataset
+func Update(cfgPath, lockPath string, ids []string, opts Options) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	if _, err := selectDatasets(cfg, ids); err != nil {
+		logf("update error: %v\n", err)
+		return 2
+	}
+
+	exit, rep := runFetch(cfgPath, lockPath, ids, opts)
+
+	changed, unchanged := pinChanges(rep)
+	if len(changed) == 0 {
+		logf("update: no pins changed (%d already current)\n", len(unchanged))
+		return exit
+	}
+
+	fmt.Printf("\nupdate: %d pin(s) changed, %d already current. For the commit message:\n\n", len(changed), len(unchanged))
+	fmt.Printf("    Update pinned data\n\n")
+	for _, line := range changed {
+		fmt.Printf("    %s\n", line)
+	}
+	if len(unchanged) > 0 {
+		fmt.Printf("\n    Unchanged: %s\n", strings.Join(unchanged, ", "))
+	}
+	return exit
+}
+
+// pinChanges lists the datasets a fetch run re-pinned, as "ID: old -> new",
+// and the IDs of those whose fingerprint stayed the same. Failed datasets are
+// in neither list.
+func pinChanges(rep *Report) (changed, unchanged []string) {
+	for _, d := range rep.Datasets {
+		switch {
+		case d.Status != "fetched":
+			continue
+		case d.OldFingerprint == d.NewFingerprint:
+			unchanged = append(unchanged, d.ID)
+		default:
+			changed = append(changed, fmt.Sprintf("%s: %s -> %s", d.ID, firstNonEmpty(d.OldFingerprint, "(new)"), d.NewFingerprint))
+		}
+	}
+	return changed, unchanged
+}
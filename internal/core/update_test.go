@@ -0,0 +1,59 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := "version: 1\ndefaults:\n  policy: fail\ndatasets:\n"
+	for _, id := range []string{"a", "b"} {
+		config += "  - id: " + id + "\n    source:\n      type: mock\n    target: " + filepath.Join(tmpDir, id+".txt") + "\n"
+	}
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+	if code := Fetch(configPath, lockPath, nil); code != 0 {
+		t.Fatalf("fetch exit = %d", code)
+	}
+
+	// Upstream "changed": the lock holds an older fingerprint for a
+	lk, _ := readLock(lockPath)
+	lk.Items["a"].RemoteFingerprint = "old-fp"
+	writeLock(lockPath, lk)
+	if code := Check(configPath, lockPath); code != 1 {
+		t.Fatalf("check before update = %d, want 1", code)
+	}
+
+	if code := Update(configPath, lockPath, []string{"nope"}, Options{}); code != 2 {
+		t.Errorf("Update(nope) = %d, want 2", code)
+	}
+	if code := Update(configPath, lockPath, nil, Options{}); code != 0 {
+		t.Errorf("Update() = %d, want 0", code)
+	}
+	if code := Check(configPath, lockPath); code != 0 {
+		t.Errorf("check after update = %d, want 0", code)
+	}
+}
+
+func TestPinChanges(t *testing.T) {
+	rep := &Report{Datasets: []DatasetReport{
+		{ID: "a", Status: "fetched", OldFingerprint: "old-fp", NewFingerprint: "mock-fp"},
+		{ID: "b", Status: "fetched", OldFingerprint: "mock-fp", NewFingerprint: "mock-fp"},
+		{ID: "c", Status: "fetched", NewFingerprint: "mock-fp"},
+		{ID: "d", Status: "error", OldFingerprint: "old-fp"},
+	}}
+	changed, unchanged := pinChanges(rep)
+	want := "a: old-fp -> mock-fp|c: (new) -> mock-fp"
+	if got := strings.Join(changed, "|"); got != want {
+		t.Errorf("changed = %q, want %q", got, want)
+	}
+	if strings.Join(unchanged, ",") != "b" {
+		t.Errorf("unchanged = %v, want [b]", unchanged)
+	}
+}
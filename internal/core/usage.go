@@ -0,0 +1,244 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// Usage is the running tally of check and fetch runs kept in the status file,
+// from which "datum report usage" is generated.
+//
+// Nothing here leaves the machine on its own: datum has no telemetry, and the
+// tally only becomes a report when someone asks for one and passes it on.
+// Sources are counted by handler type and host, never by dataset ID, path or
+// URL, so the report says how datum is used without saying what data it holds.
+type Usage struct {
+	Since      *time.Time              `yaml:"since,omitempty"`       // First run recorded
+	Runs       int                     `yaml:"runs,omitempty"`        // Check and fetch runs
+	FailedRuns int                     `yaml:"failed_runs,omitempty"` // Runs that exited non-zero
+	Sources    map[string]*SourceUsage `yaml:"sources,omitempty"`     // Keyed by usageKey
+}
+
+// SourceUsage counts what happened to the datasets of one kind of source.
+type SourceUsage struct {
+	Type         string        `yaml:"type"`
+	Host         string        `yaml:"host,omitempty"`
+	Checks       int           `yaml:"checks,omitempty"`       // Datasets checked
+	Fetches      int           `yaml:"fetches,omitempty"`      // Datasets downloaded
+	Failures     int           `yaml:"failures,omitempty"`     // Datasets that ended in an error
+	Bytes        int64         `yaml:"bytes,omitempty"`        // Bytes downloaded
+	Fingerprints int           `yaml:"fingerprints,omitempty"` // Remote fingerprints timed
+	LatencyTime  time.Duration `yaml:"latency_time,omitempty"` // Their total time
+	FetchTime    time.Duration `yaml:"fetch_time,omitempty"`   // Total time of the downloads
+}
+
+// usageKey identifies a source in Usage.Sources.
+func usageKey(typ, host string) string {
+	if host == "" {
+		return typ
+	}
+	return typ + " " + host
+}
+
+// recordUsage adds one dataset's result to the tally. Interrupted and
+// skipped datasets did nothing and aren't counted.
+func (u *Usage) recordUsage(ds Dataset, res *datasetResult) {
+	r := res.report
+	if r.Status == "interrupted" || r.Status == "skipped" || r.Status == "" {
+		return
+	}
+
+	// Count against the source that answered, or the first one if none did
+	sources := ds.GetSources()
+	if len(sources) == 0 {
+		return
+	}
+	src := sources[0]
+	for _, s := range sources {
+		if r.Source != "" && firstNonEmpty(s.URL, s.Path) == r.Source {
+			src = s
+			break
+		}
+	}
+	host := sourceHost(src)
+	if u.Sources == nil {
+		u.Sources = map[string]*SourceUsage{}
+	}
+	su := u.Sources[usageKey(src.Type, host)]
+	if su == nil {
+		su = &SourceUsage{Type: src.Type, Host: host}
+		u.Sources[usageKey(src.Type, host)] = su
+	}
+
+	su.Checks++
+	if r.Status == "error" {
+		su.Failures++
+	}
+	if r.FingerprintMS > 0 {
+		su.Fingerprints++
+		su.LatencyTime += time.Duration(r.FingerprintMS * float64(time.Millisecond))
+	}
+	if (r.Status == "fetched" || r.Status == "updated") && res.lock != nil {
+		su.Fetches++
+		su.Bytes += res.lock.Size
+		su.FetchTime += time.Duration(r.FetchMS * float64(time.Millisecond))
+	}
+}
+
+// recordRun counts a finished run.
+func (u *Usage) recordRun(start time.Time, exit int) {
+	if u.Since == nil {
+		u.Since = &start
+	}
+	u.Runs++
+	if exit != 0 {
+		u.FailedRuns++
+	}
+}
+
+// UsageReport is the JSON written by "datum report usage". Like Report, its
+// field names are an interface: add fields, don't rename them.
+type UsageReport struct {
+	GeneratedAt     time.Time           `json:"generated_at"`
+	Since           *time.Time          `json:"since,omitempty"` // First run counted
+	Runs            int                 `json:"runs"`
+	FailedRuns      int                 `json:"failed_runs"`
+	DatasetsChecked int                 `json:"datasets_checked"` // Summed over runs
+	DatasetsFetched int                 `json:"datasets_fetched"`
+	BytesFetched    int64               `json:"bytes_fetched"`
+	FailureRate     float64             `json:"failure_rate"` // Failed datasets / datasets checked
+	Sources         []SourceUsageReport `json:"sources"`
+}
+
+// SourceUsageReport is one row of UsageReport.Sources.
+type SourceUsageReport struct {
+	Type             string  `json:"type"`
+	Host             string  `json:"host,omitempty"` // Only with --hosts
+	Checks           int     `json:"checks"`
+	Fetches          int     `json:"fetches"`
+	Failures         int     `json:"failures"`
+	FailureRate      float64 `json:"failure_rate"`
+	BytesFetched     int64   `json:"bytes_fetched"`
+	MeanLatencyMS    float64 `json:"mean_latency_ms,omitempty"`     // Mean remote fingerprint time
+	MeanFetchMS      float64 `json:"mean_fetch_ms,omitempty"`       // Mean download time
+	FetchBytesPerSec float64 `json:"fetch_bytes_per_sec,omitempty"` // Bytes fetched / total fetch time
+}
+
+// usageReport summarizes u. Unless withHosts is set, sources of the same type
+// are merged, so host names (which can reveal internal infrastructure) stay out.
+func (u *Usage) usageReport(withHosts bool, now time.Time) UsageReport {
+	rep := UsageReport{GeneratedAt: now, Since: u.Since, Runs: u.Runs, FailedRuns: u.FailedRuns, Sources: []SourceUsageReport{}}
+
+	merged := map[string]*SourceUsage{}
+	for _, su := range u.Sources {
+		host := ""
+		if withHosts {
+			host = su.Host
+		}
+		m := merged[usageKey(su.Type, host)]
+		if m == nil {
+			m = &SourceUsage{Type: su.Type, Host: host}
+			merged[usageKey(su.Type, host)] = m
+		}
+		m.Checks += su.Checks
+		m.Fetches += su.Fetches
+		m.Failures += su.Failures
+		m.Bytes += su.Bytes
+		m.Fingerprints += su.Fingerprints
+		m.LatencyTime += su.LatencyTime
+		m.FetchTime += su.FetchTime
+	}
+
+	failures := 0
+	for _, m := range merged {
+		row := SourceUsageReport{
+			Type: m.Type, Host: m.Host, Checks: m.Checks, Fetches: m.Fetches,
+			Failures: m.Failures, FailureRate: ratio(m.Failures, m.Checks), BytesFetched: m.Bytes,
+		}
+		if m.Fingerprints > 0 {
+			row.MeanLatencyMS = milliseconds(m.LatencyTime / time.Duration(m.Fingerprints))
+		}
+		if m.Fetches > 0 {
+			row.MeanFetchMS = milliseconds(m.FetchTime / time.Duration(m.Fetches))
+		}
+		if m.FetchTime > 0 {
+			row.FetchBytesPerSec = float64(m.Bytes) / m.FetchTime.Seconds()
+		}
+		rep.Sources = append(rep.Sources, row)
+		rep.DatasetsChecked += m.Checks
+		rep.DatasetsFetched += m.Fetches
+		rep.BytesFetched += m.Bytes
+		failures += m.Failures
+	}
+	rep.FailureRate = ratio(failures, rep.DatasetsChecked)
+	sort.Slice(rep.Sources, func(i, j int) bool {
+		a, b := rep.Sources[i], rep.Sources[j]
+		if a.Checks != b.Checks {
+			return a.Checks > b.Checks
+		}
+		return usageKey(a.Type, a.Host) < usageKey(b.Type, b.Host)
+	})
+	return rep
+}
+
+// ratio returns n/d, or 0 when d is 0.
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// UsageReportJSON writes the usage report built from the status file's tally
+// to out ("-" for stdout).
+//
+// The report is for platform teams deciding what to mirror or support: how
+// many datasets are checked and fetched, how much data moves, and how often
+// and how slowly each kind of source fails. It is only ever generated here,
+// on request; datum never sends it anywhere.
+//
+// Parameters:
+//   - lockPath: Path to the lockfile; the status file lives next to it by default
+//   - withHosts: Break sources down by host instead of only by handler type
+//   - out: Output file, or "-" for stdout
+//   - opts: StatusFile overrides where the tally is read from
+//
+// Returns:
+//   - 0: Report written
+//   - 2: The status file or the output couldn't be read or written
+func UsageReportJSON(lockPath string, withHosts bool, out string, opts Options) int {
+	statusPath := firstNonEmpty(opts.StatusFile, defaultStatusPath(lockPath))
+	st, err := readStatus(statusPath)
+	if err != nil {
+		logf("status file %s: %v\n", statusPath, err)
+		return 2
+	}
+	u := st.Usage
+	if u == nil {
+		u = &Usage{}
+	}
+
+	var w io.Writer = os.Stdout
+	if out != "-" {
+		f, err := os.Create(out)
+		if err != nil {
+			logf("report error: %v\n", err)
+			return 2
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(u.usageReport(withHosts, time.Now().UTC())); err != nil {
+		logf("report error: %v\n", err)
+		return 2
+	}
+	if out != "-" {
+		logf("[OK  ] usage report written to %s (%d runs)\n", out, u.Runs)
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUsageReport(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := `version: 1
+datasets:
+  - id: good
+    source:
+      type: mock
+    target: ` + filepath.Join(tmpDir, "good.txt") + `
+  - id: bad
+    source:
+      type: mockfail
+      url: https://internal.example.org/bad.csv
+    target: ` + filepath.Join(tmpDir, "bad.txt") + `
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	Fetch(configPath, lockPath, nil)
+	Check(configPath, lockPath)
+
+	read := func(withHosts bool) (UsageReport, string) {
+		out := filepath.Join(tmpDir, "usage.json")
+		if code := UsageReportJSON(lockPath, withHosts, out, Options{}); code != 0 {
+			t.Fatalf("UsageReportJSON() = %d", code)
+		}
+		b, _ := os.ReadFile(out)
+		var rep UsageReport
+		if err := json.Unmarshal(b, &rep); err != nil {
+			t.Fatal(err)
+		}
+		return rep, string(b)
+	}
+
+	rep, raw := read(false)
+	if rep.Runs != 2 || rep.FailedRuns != 2 {
+		t.Errorf("runs = %d (%d failed), want 2 (2 failed)", rep.Runs, rep.FailedRuns)
+	}
+	if rep.DatasetsChecked != 4 || rep.DatasetsFetched != 1 || rep.FailureRate != 0.25 {
+		t.Errorf("checked %d, fetched %d, failure rate %v; want 4, 1, 0.25", rep.DatasetsChecked, rep.DatasetsFetched, rep.FailureRate)
+	}
+	if len(rep.Sources) != 2 || rep.Sources[0].Type != "mock" || rep.Sources[1].Failures != 1 {
+		t.Errorf("sources = %+v", rep.Sources)
+	}
+	for _, private := range []string{"good", "internal.example.org", tmpDir} {
+		if strings.Contains(raw, private) {
+			t.Errorf("report mentions %q:\n%s", private, raw)
+		}
+	}
+
+	if rep, _ := read(true); rep.Sources[1].Host != "internal.example.org" {
+		t.Errorf("with hosts, sources = %+v", rep.Sources)
+	}
+}
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// requiredFields lists the source fields each built-in handler can't work
+// without. Handlers only notice a missing one when they first use the source;
+// Validate reports them up front.
+var requiredFields = map[string][]string{
+	"http":           {"url"},
+	"file":           {"path"},
+	"git":            {"url", "ref"},
+	"command":        {"fingerprint_cmd", "fetch_cmd"},
+	"ftp":            {"url"},
+	"sftp":           {"url"},
+	"sql":            {"url"}, // query: see validateQuery
+	"doi":            {"url"},
+	"huggingface":    {"url", "path"},
+	"torrent":        {"url"},
+	"dvc":            {"path"},
+	"github-release": {"url"},
+}
+
+// unknownField matches yaml.v3's error for a key with no matching struct field.
+var unknownField = regexp.MustCompile(`field (\S+) not found in type \S+`)
+
+// Validate checks the configuration strictly, without touching any source,
+// and prints every problem found rather than stopping at the first:
+//   - Unknown keys (a typo like "polcy:" is otherwise silently ignored)
+//   - Everything a normal run checks when it loads the config
+//   - Datasets without an ID or target, and source fields the dataset's
+//     handler requires but aren't set
+//   - Dataset IDs used twice, and datasets writing to the same target
+//
+// Parameters:
+//   - cfgPath: Path to the configuration file (.data.yaml)
+//
+// Returns:
+//   - 0: The config is valid
+//   - 1: One or more problems were found
+//   - 2: The config file can't be read
+func Validate(cfgPath string) int {
+	b, err := os.ReadFile(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	problems := validateConfig(cfgPath, b)
+	for _, p := range problems {
+		logf("[ERR ] %s\n", p)
+	}
+	if len(problems) > 0 {
+		logf("validate: %d error(s) in %s\n", len(problems), cfgPath)
+		return 1
+	}
+	logf("[OK  ] %s is valid\n", cfgPath)
+	return 0
+}
+
+// validateConfig returns every problem found in the config file at path,
+// whose contents are b.
+func validateConfig(path string, b []byte) []string {
+	var problems []string
+	add := func(msg string) {
+		if !slices.Contains(problems, msg) {
+			problems = append(problems, msg)
+		}
+	}
+
+	// Decoding strictly reports unknown keys, but carries on past them, so
+	// raw has everything that could be read
+	var raw Config
+	if err := decodeStrict(b, &raw); err != nil {
+		var terr *yaml.TypeError
+		if !errors.As(err, &terr) {
+			// A syntax error: nothing else can be checked
+			return []string{err.Error()}
+		}
+		for _, msg := range terr.Errors {
+			add(unknownField.ReplaceAllString(msg, `unknown key "$1"`))
+		}
+	}
+
+	// Included files get the same treatment
+	files, _ := includedFiles(path, raw.Include)
+	for _, file := range files {
+		ib, err := os.ReadFile(file)
+		if err != nil {
+			continue // readConfig reports it below
+		}
+		var inc includedConfig
+		var terr *yaml.TypeError
+		if err := decodeStrict(ib, &inc); errors.As(err, &terr) {
+			for _, msg := range terr.Errors {
+				add(file + ": " + unknownField.ReplaceAllString(msg, `unknown key "$1"`))
+			}
+		}
+	}
+
+	// What a run would refuse. Type errors already reported above come back
+	// from the lenient parse too, and are only listed once
+	cfg, err := readConfig(path)
+	if err != nil {
+		var terr *yaml.TypeError
+		if errors.As(err, &terr) {
+			for _, msg := range terr.Errors {
+				add(msg)
+			}
+		} else {
+			for _, line := range strings.Split(err.Error(), "\n") {
+				add(line)
+			}
+		}
+		// Templates and ${VAR}s aren't expanded, but the rest can still be checked
+		applyIncludes(&raw, path)
+		cfg = &raw
+	}
+
+	for _, msg := range checkRequiredFields(cfg) {
+		add(msg)
+	}
+	// Already reported if readConfig got that far; messages are only listed once
+	for _, err := range datasetConflicts(cfg) {
+		add(err.Error())
+	}
+	for _, err := range checkDependencies(cfg) {
+		add(err.Error())
+	}
+	return problems
+}
+
+// decodeStrict decodes YAML into out, rejecting unknown keys.
+func decodeStrict(b []byte, out any) error {
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	return dec.Decode(out)
+}
+
+// checkRequiredFields reports datasets without an ID or target, and sources
+// missing a field their handler requires.
+func checkRequiredFields(cfg *Config) []string {
+	var problems []string
+	for i, ds := range cfg.Datasets {
+		if ds.ID == "" {
+			problems = append(problems, fmt.Sprintf("%s: id is required", datasetRef(i, ds)))
+		}
+		if ds.Target == "" {
+			problems = append(problems, datasetRef(i, ds)+": target is required")
+		}
+		sources := ds.GetSources()
+		for j, src := range sources {
+			var missing []string
+			for _, field := range requiredFields[src.Type] {
+				if strings.TrimSpace(sourceField(src, field)) == "" {
+					missing = append(missing, field)
+				}
+			}
+			if len(missing) == 0 {
+				continue
+			}
+			where := "source"
+			if len(sources) > 1 || len(ds.Sources) > 0 {
+				where = fmt.Sprintf("sources[%d]", j)
+			}
+			problems = append(problems, fmt.Sprintf("%s: %s: %s sources require %s", datasetRef(i, ds), where, src.Type, strings.Join(missing, ", ")))
+		}
+	}
+	return problems
+}
+
+// sourceField returns the value of one of requiredFields' fields of src.
+func sourceField(src registry.Source, field string) string {
+	switch field {
+	case "url":
+		return src.URL
+	case "path":
+		return src.Path
+	case "ref":
+		return src.Ref
+	case "fingerprint_cmd":
+		return src.FingerprintCmd
+	case "fetch_cmd":
+		if src.FetchCmd == "" {
+			return strings.Join(src.FetchArgs, " ") // fetch_args stands in for it
+		}
+		return src.FetchCmd
+	}
+	panic("requiredFields: no accessor for " + field)
+}
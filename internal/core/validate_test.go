@@ -0,0 +1,101 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	b := []byte(`version: 1
+defaults:
+  polcy: update
+datasets:
+  - id: a
+    source: {type: http}
+    target: data/a.csv
+  - id: a
+    source: {type: git, url: https://example.com/repo.git}
+    target: data/./a.csv
+  - id: c
+    source: {type: file, path: c.csv, lines: "zz"}
+    target: data/c.csv
+  - id: d
+    sources:
+      - {type: file, path: d.csv}
+      - {type: sql, query: "select * from codes"}
+    target: data/d.csv
+    polcy: log
+`)
+	os.WriteFile(path, b, 0o644)
+
+	got := validateConfig(path, b)
+	want := []string{
+		`line 3: unknown key "polcy"`,
+		`line 19: unknown key "polcy"`,
+		`dataset 2 (c): lines: invalid range`,
+		`dataset 0 (a): source: http sources require url`,
+		`dataset 1 (a): source: git sources require ref`,
+		`dataset 3 (d): sources[1]: sql sources require url`,
+		`dataset 1 (a): id already used by dataset 0 (a)`,
+		`dataset 1 (a): target data/./a.csv is also the target of dataset 0 (a)`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("validateConfig() = %d problems, want %d:\n%s", len(got), len(want), strings.Join(got, "\n"))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("problem %d = %q, want %q...", i, got[i], want[i])
+		}
+	}
+
+	if code := Validate(path); code != 1 {
+		t.Errorf("Validate() = %d, want 1", code)
+	}
+	os.WriteFile(path, []byte("version: 1\ndatasets:\n  - id: a\n    source: {type: file, path: a.csv}\n    target: data/a.csv\n"), 0o644)
+	if code := Validate(path); code != 0 {
+		t.Errorf("Validate() of a valid config = %d, want 0", code)
+	}
+	os.WriteFile(path, []byte("version: 1\ndatasets: [\n"), 0o644)
+	if code := Validate(path); code != 1 {
+		t.Errorf("Validate() of broken YAML = %d, want 1", code)
+	}
+	if code := Validate(filepath.Join(t.TempDir(), "missing.yaml")); code != 2 {
+		t.Errorf("Validate() of a missing file = %d, want 2", code)
+	}
+}
+
+func TestReadConfig_AllDatasetErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`version: 1
+datasets:
+  - id: a
+    target: data/a.csv
+  - id: b
+    source: {type: file, path: b.csv}
+    target: data/b.csv
+  - id: c
+    source: {type: file, path: c.csv, lines: "zz"}
+    target: data/c.csv
+`), 0o644)
+	_, err := readConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "dataset 0 (a)") || !strings.Contains(err.Error(), "dataset 2 (c)") {
+		t.Errorf("readConfig() error = %v, want both broken datasets", err)
+	}
+}
+
+func TestValidateConfig_Include(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	b := []byte("version: 1\ninclude: [team.yaml]\ndatasets: []\n")
+	os.WriteFile(path, b, 0o644)
+	team := filepath.Join(dir, "team.yaml")
+	os.WriteFile(team, []byte("datasets:\n  - id: a\n    source: {type: file, path: a.csv}\n    target: data/a.csv\n    polcy: log\n"), 0o644)
+
+	got := validateConfig(path, b)
+	if len(got) != 1 || got[0] != team+`: line 5: unknown key "polcy"` {
+		t.Errorf("validateConfig() = %q, want the included file's unknown key", got)
+	}
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Markers delimiting the section of .gitignore/.gitattributes that datum owns.
+// Everything outside the markers is preserved verbatim.
+const (
+	managedBegin = "# BEGIN datum managed block (generated from the datum config; do not edit)"
+	managedEnd   = "# END datum managed block"
+)
+
+// vcsFiles lists the files datum can manage, keyed by the targets_in_git mode
+// that uses them, with the line format for each target: an anchored pattern
+// from repoRelative, and whether the target is a directory.
+var vcsFiles = map[string]struct {
+	name string
+	line func(target string, dir bool) string
+}{
+	"ignore": {".gitignore", func(t string, dir bool) string {
+		// A backslash keeps a space literal, trailing ones included
+		return strings.ReplaceAll(escapeGlob(t), " ", `\ `)
+	}},
+	"lfs": {".gitattributes", func(t string, dir bool) string {
+		// Attributes split lines on whitespace and have no escape for it;
+		// [[:space:]] is what git lfs track writes
+		p := strings.ReplaceAll(escapeGlob(t), " ", "[[:space:]]")
+		if dir {
+			p += "/**" // Attributes apply to files, not to a directory
+		}
+		return p + " filter=lfs diff=lfs merge=lfs -text"
+	}},
+}
+
+// escapeGlob escapes the characters gitignore and gitattributes patterns
+// treat as wildcards, so a target matches only itself. The patterns start
+// with "/", so a name beginning with # or ! isn't read as a comment or a
+// negation.
+func escapeGlob(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		if strings.ContainsRune(`\*?[`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// syncVCSFiles rewrites the managed blocks in .gitignore/.gitattributes (next to
+// the config file) to match the current targets.
+//
+// The file for the active targets_in_git mode gets one line per target,
+// escaped so names with spaces or wildcard characters match only themselves;
+// in .gitattributes a directory target (one on disk) covers the files under
+// it. The other file has any stale managed block removed, so switching modes doesn't
+// leave targets both ignored and LFS-tracked. Targets outside the config's
+// directory can't be expressed in its .gitignore and are skipped.
+//
+// Returns the names of the files that changed.
+func syncVCSFiles(cfg *Config, cfgPath string) ([]string, error) {
+	root := filepath.Dir(cfgPath)
+
+	var targets []string
+	dirs := map[string]bool{}
+	for _, ds := range cfg.Datasets {
+		if p, ok := repoRelative(root, ds.Target); ok {
+			targets = append(targets, p)
+			dirs[p] = isDir(ds.Target)
+		}
+	}
+	sort.Strings(targets)
+
+	var changed []string
+	modes := []string{"ignore", "lfs"}
+	for _, mode := range modes {
+		vf := vcsFiles[mode]
+		var lines []string
+		if mode == cfg.Defaults.TargetsInGit {
+			for _, t := range targets {
+				lines = append(lines, vf.line(t, dirs[t]))
+			}
+		}
+		ok, err := updateManagedBlock(filepath.Join(root, vf.name), lines)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed = append(changed, vf.name)
+		}
+	}
+	return changed, nil
+}
+
+// repoRelative converts a target into an anchored, slash-separated pattern
+// relative to root (e.g. "/data/ref/file.csv"). It reports false for targets
+// outside root.
+func repoRelative(root, target string) (string, bool) {
+	absRoot, err1 := filepath.Abs(root)
+	absTarget, err2 := filepath.Abs(target)
+	if err1 != nil || err2 != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absRoot, absTarget)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return "/" + filepath.ToSlash(rel), true
+}
+
+// updateManagedBlock replaces the managed block in path with lines.
+//
+// An empty lines slice removes the block. The file is created only if there is
+// something to write, and is left alone when its content wouldn't change.
+func updateManagedBlock(path string, lines []string) (bool, error) {
+	old, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if os.IsNotExist(err) && len(lines) == 0 {
+		return false, nil
+	}
+
+	// Split the existing content around any previous block
+	before, after := string(old), ""
+	if i := strings.Index(before, managedBegin); i >= 0 {
+		rest := before[i:]
+		before = before[:i]
+		if j := strings.Index(rest, managedEnd); j >= 0 {
+			after = strings.TrimPrefix(rest[j+len(managedEnd):], "\n")
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString(before)
+	if len(lines) > 0 {
+		if b.Len() > 0 && !strings.HasSuffix(before, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString(managedBegin + "\n")
+		for _, l := range lines {
+			b.WriteString(l + "\n")
+		}
+		b.WriteString(managedEnd + "\n")
+	}
+	b.WriteString(after)
+
+	if bytes.Equal(b.Bytes(), old) {
+		return false, nil
+	}
+	return true, os.WriteFile(path, b.Bytes(), 0o644)
+}
+
+// maybeSyncVCSFiles refreshes the managed blocks after a run when the config
+// asks for it. Failures are reported as warnings; they never fail the run.
+func maybeSyncVCSFiles(cfg *Config, cfgPath string, opts Options) {
+	if cfg.Defaults.TargetsInGit == "" || opts.NoWriteLock {
+		return
+	}
+	changed, err := syncVCSFiles(cfg, cfgPath)
+	for _, name := range changed {
+		logf("[INFO] updated managed block in %s\n", name)
+	}
+	if err != nil {
+		logf("[WARN] managed block: %v\n", err)
+	}
+}
+
+// SyncVCS rewrites the managed .gitignore/.gitattributes blocks from the config.
+//
+// Returns:
+//   - 0: Files are up to date (whether or not anything changed)
+//   - 1: A file could not be written
+//   - 2: Configuration error, or targets_in_git is not set
+func SyncVCS(cfgPath string) int {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	if cfg.Defaults.TargetsInGit == "" {
+		logln("config error: defaults.targets_in_git is not set (want \"ignore\" or \"lfs\")")
+		return 2
+	}
+	changed, err := syncVCSFiles(cfg, cfgPath)
+	if err != nil {
+		logf("[ERR ] %v\n", err)
+		return 1
+	}
+	if len(changed) == 0 {
+		logln("[OK  ] managed blocks are up to date")
+	}
+	for _, name := range changed {
+		logf("[UPD ] %s\n", name)
+	}
+	return 0
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateManagedBlock(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, ".gitignore")
+
+	t.Run("appends block and preserves user content", func(t *testing.T) {
+		os.WriteFile(path, []byte("*.log\n"), 0o644)
+		changed, err := updateManagedBlock(path, []string{"/data/a.csv"})
+		if err != nil || !changed {
+			t.Fatalf("updateManagedBlock() = %v, %v; want true, nil", changed, err)
+		}
+		got, _ := os.ReadFile(path)
+		want := "*.log\n" + managedBegin + "\n/data/a.csv\n" + managedEnd + "\n"
+		if string(got) != want {
+			t.Errorf("content = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("replaces existing block in place", func(t *testing.T) {
+		os.WriteFile(path, []byte("*.log\n"+managedBegin+"\n/old\n"+managedEnd+"\n.env\n"), 0o644)
+		if _, err := updateManagedBlock(path, []string{"/new"}); err != nil {
+			t.Fatalf("updateManagedBlock() error = %v", err)
+		}
+		got, _ := os.ReadFile(path)
+		want := "*.log\n" + managedBegin + "\n/new\n" + managedEnd + "\n.env\n"
+		if string(got) != want {
+			t.Errorf("content = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("unchanged content is not rewritten", func(t *testing.T) {
+		changed, err := updateManagedBlock(path, []string{"/new"})
+		if err != nil || changed {
+			t.Errorf("updateManagedBlock() = %v, %v; want false, nil", changed, err)
+		}
+	})
+
+	t.Run("empty lines remove the block", func(t *testing.T) {
+		if _, err := updateManagedBlock(path, nil); err != nil {
+			t.Fatalf("updateManagedBlock() error = %v", err)
+		}
+		got, _ := os.ReadFile(path)
+		if string(got) != "*.log\n.env\n" {
+			t.Errorf("content = %q, want block removed", got)
+		}
+	})
+
+	t.Run("missing file is not created for an empty block", func(t *testing.T) {
+		missing := filepath.Join(tmpDir, ".gitattributes")
+		if _, err := updateManagedBlock(missing, nil); err != nil {
+			t.Fatalf("updateManagedBlock() error = %v", err)
+		}
+		if fileExists(missing) {
+			t.Error("file should not be created")
+		}
+	})
+}
+
+func TestSyncVCS(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, ".data.yaml")
+	writeConfig := func(mode string) {
+		os.WriteFile(configPath, []byte(`version: 1
+defaults:
+  targets_in_git: `+mode+`
+datasets:
+  - id: inside
+    source:
+      type: mock
+    target: `+filepath.Join(tmpDir, "data", "a.csv")+`
+  - id: outside
+    source:
+      type: mock
+    target: /elsewhere/b.csv
+`), 0o644)
+	}
+
+	writeConfig("ignore")
+	if code := SyncVCS(configPath); code != 0 {
+		t.Fatalf("SyncVCS() = %d, want 0", code)
+	}
+	got, _ := os.ReadFile(filepath.Join(tmpDir, ".gitignore"))
+	if !strings.Contains(string(got), "\n/data/a.csv\n") || strings.Contains(string(got), "b.csv") {
+		t.Errorf(".gitignore = %q, want only the in-repo target", got)
+	}
+
+	// Switching to LFS moves the targets from .gitignore to .gitattributes
+	writeConfig("lfs")
+	if code := SyncVCS(configPath); code != 0 {
+		t.Fatalf("SyncVCS() = %d, want 0", code)
+	}
+	got, _ = os.ReadFile(filepath.Join(tmpDir, ".gitignore"))
+	if strings.Contains(string(got), "a.csv") {
+		t.Errorf(".gitignore still lists targets after switching to lfs: %q", got)
+	}
+	got, _ = os.ReadFile(filepath.Join(tmpDir, ".gitattributes"))
+	if !strings.Contains(string(got), "/data/a.csv filter=lfs diff=lfs merge=lfs -text") {
+		t.Errorf(".gitattributes = %q, want LFS line for target", got)
+	}
+}
+
+func TestVCSFileLines(t *testing.T) {
+	tests := []struct {
+		target string
+		dir    bool
+		ignore string
+		lfs    string
+	}{
+		{"/data/a.csv", false, "/data/a.csv", "/data/a.csv"},
+		{"/data/my file.csv", false, `/data/my\ file.csv`, "/data/my[[:space:]]file.csv"},
+		{"/data/#1 [draft]?*.csv", false, `/data/#1\ \[draft]\?\*.csv`, `/data/#1[[:space:]]\[draft]\?\*.csv`},
+		{`/data/back\slash`, false, `/data/back\\slash`, `/data/back\\slash`},
+		{"/data/images", true, "/data/images", "/data/images/**"},
+	}
+	for _, tt := range tests {
+		if got := vcsFiles["ignore"].line(tt.target, tt.dir); got != tt.ignore {
+			t.Errorf("gitignore line for %q = %q, want %q", tt.target, got, tt.ignore)
+		}
+		if got, want := vcsFiles["lfs"].line(tt.target, tt.dir), tt.lfs+" filter=lfs diff=lfs merge=lfs -text"; got != want {
+			t.Errorf("gitattributes line for %q = %q, want %q", tt.target, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package core
+
+// Verify checks the local targets against the lockfile's local_sha256,
+// without contacting any source or writing anything.
+//
+// It's the integrity check for air-gapped machines: data copied in from
+// outside can be validated against a lockfile reviewed elsewhere. Unlike
+// check, it never asks upstream whether a newer version exists, and unlike
+// lock verify, it reads the data itself. Targets are hashed concurrently
+// (Options.Jobs).
+//
+// Parameters:
+//   - cfgPath: Path to the configuration file (.data.yaml)
+//   - lockPath: Path to the lockfile (.data.lock.yaml)
+//   - ids: Datasets to verify; empty means all
+//   - opts: Engine options (only Jobs is used)
+//
+// Returns:
+//   - 0: Every target matches its pin
+//   - 1: A target is missing, modified, or not pinned
+//   - 2: Configuration error or unreadable lockfile
+func Verify(cfgPath, lockPath string, ids []string, opts Options) (exit int) {
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	if !fileExists(lockPath) {
+		logf("lock error: %s: no such file\n", lockPath)
+		return 2
+	}
+	lk, err := readLock(lockPath)
+	if err != nil {
+		logf("lock error: %v\n", err)
+		return 2
+	}
+
+	datasets, err := selectDatasets(cfg, ids)
+	if err != nil {
+		logf("verify error: %v\n", err)
+		return 2
+	}
+
+	counts := map[string]int{}
+	forEachDataset(opts.Jobs, len(datasets), func(i int) *datasetResult {
+		return verifyDataset(datasets[i], lk.Items[datasets[i].ID])
+	}, func(i int, res *datasetResult) {
+		counts[res.report.Status]++
+		if res.exit > exit {
+			exit = res.exit
+		}
+	})
+	logf("verify: %d ok, %d missing, %d modified, %d not pinned\n",
+		counts["ok"], counts["missing"], counts["modified"], counts["unpinned"])
+	return exit
+}
+
+// verifyDataset hashes one target and compares it with its lock entry.
+func verifyDataset(ds Dataset, item *LockItem) *datasetResult {
+	res := newDatasetResult(ds.ID)
+	switch {
+	case item == nil || item.LocalSHA256 == "":
+		res.report.Status = "unpinned"
+		res.printf("[ERR ] %s: not pinned in the lockfile\n", ds.ID)
+		res.exit = 1
+	case !fileExists(ds.Target):
+		res.report.Status = "missing"
+		res.printf("[ERR ] %s: %s is missing\n", ds.ID, ds.Target)
+		res.exit = 1
+	default:
+		h, _, err := HashPath(ds.Target)
+		if err != nil {
+			res.report.Status = "missing"
+			res.printf("[ERR ] %s: %v\n", ds.ID, err)
+			res.exit = 1
+		} else if h != item.LocalSHA256 {
+			res.report.Status = "modified"
+			res.printf("[ERR ] %s: %s was modified (sha256 %s, lock %s)\n", ds.ID, ds.Target, h, item.LocalSHA256)
+			res.exit = 1
+		} else {
+			res.report.Status = "ok"
+			res.printf("[OK  ] %s\n", ds.ID)
+		}
+	}
+	return res
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	target := func(id string) string { return filepath.Join(tmpDir, id+".txt") }
+	config := "version: 1\ndatasets:\n"
+	for _, id := range []string{"a", "b", "c"} {
+		config += "  - id: " + id + "\n    source:\n      type: mock\n    target: " + target(id) + "\n"
+	}
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+
+	if code := Verify(configPath, lockPath, nil, Options{}); code != 2 {
+		t.Errorf("Verify() without a lockfile = %d, want 2", code)
+	}
+	if code := Fetch(configPath, lockPath, nil); code != 0 {
+		t.Fatalf("fetch exit = %d", code)
+	}
+	before, _ := os.ReadFile(lockPath)
+
+	if code := Verify(configPath, lockPath, nil, Options{}); code != 0 {
+		t.Errorf("Verify() of fresh targets = %d, want 0", code)
+	}
+
+	os.WriteFile(target("a"), []byte("tampered"), 0o644)
+	os.Remove(target("b"))
+	if code := Verify(configPath, lockPath, nil, Options{}); code != 1 {
+		t.Errorf("Verify() with a modified and a missing target = %d, want 1", code)
+	}
+	if code := Verify(configPath, lockPath, []string{"c"}, Options{}); code != 0 {
+		t.Errorf("Verify(c) = %d, want 0: only the selected dataset counts", code)
+	}
+	if code := Verify(configPath, lockPath, []string{"nope"}, Options{}); code != 2 {
+		t.Errorf("Verify(nope) = %d, want 2", code)
+	}
+
+	// Verification never touches the lockfile
+	if after, _ := os.ReadFile(lockPath); string(after) != string(before) {
+		t.Error("Verify() modified the lockfile")
+	}
+
+	tests := []struct {
+		name   string
+		item   *LockItem
+		status string
+	}{
+		{"unpinned", nil, "unpinned"},
+		{"pinned", &LockItem{LocalSHA256: "00"}, "missing"},
+	}
+	for _, tt := range tests {
+		res := verifyDataset(Dataset{ID: "x", Target: filepath.Join(tmpDir, "x.txt")}, tt.item)
+		if res.report.Status != tt.status || res.exit != 1 {
+			t.Errorf("%s: status %q exit %d, want %q exit 1", tt.name, res.report.Status, res.exit, tt.status)
+		}
+	}
+}
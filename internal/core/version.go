@@ -0,0 +1,204 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// versionVar is the placeholder replaced by a dataset's version.
+const versionVar = "{{version}}"
+
+// applyVersions expands {{version}} in every source of every dataset.
+//
+// A dataset whose URL embeds a release number can then say so once:
+//
+//	version: 2.3.0
+//	sources:
+//	  - type: http
+//	    url: https://example.com/data/v{{version}}/file.csv
+//	  - type: http
+//	    url: https://mirror.example.com/v{{version}}/file.csv
+//
+// and "datum bump ID 2.3.1" only has to change that one field. Using the
+// placeholder without setting a version is a config error.
+func applyVersions(c *Config) error {
+	for i := range c.Datasets {
+		ds := &c.Datasets[i]
+		if ds.Source.Type != "" {
+			ds.versioned = expandVersion(&ds.Source, ds.Version) || ds.versioned
+		}
+		for j := range ds.Sources {
+			ds.versioned = expandVersion(&ds.Sources[j], ds.Version) || ds.versioned
+		}
+		if ds.versioned && ds.Version == "" {
+			return fmt.Errorf("dataset %d (%s): source uses %s but the dataset has no version", i, ds.ID, versionVar)
+		}
+		if strings.ContainsAny(ds.Version, " \t\r\n") {
+			return fmt.Errorf("dataset %d (%s): version %q must not contain whitespace", i, ds.ID, ds.Version)
+		}
+	}
+	return nil
+}
+
+// expandVersion replaces {{version}} in the source's string fields with v and
+// reports whether any of them used it.
+func expandVersion(src *registry.Source, v string) bool {
+	used := false
+	for _, field := range sourceTemplateFields(src) {
+		if strings.Contains(*field, versionVar) {
+			*field = strings.ReplaceAll(*field, versionVar, v)
+			used = true
+		}
+	}
+	return used
+}
+
+// Bump moves a dataset to a new version in one step: it sets the dataset's
+// version in the config, fetches the new version, and records it in the lock.
+//
+// If the fetch fails, the config and lockfile are restored to what they were,
+// so a typo in the version can't leave the config pointing at data that was
+// never fetched. The target itself is only replaced by a successful fetch.
+//
+// Parameters:
+//   - cfgPath: Path to the configuration file (edited in place; comments are kept)
+//   - lockPath: Path to the lockfile
+//   - id: The dataset to bump; one of its sources must use {{version}}
+//   - version: The new version
+//   - opts: Engine options for the fetch
+//
+// Returns:
+//   - 0: Bumped and fetched
+//   - 1: The fetch failed (nothing changed)
+//   - 2: Configuration or usage error
+func Bump(cfgPath, lockPath, id, version string, opts Options) int {
+	if requiredConfigSHA256 != "" {
+		logln("bump error: bump edits the config, which --config-sha256 forbids")
+		return 2
+	}
+	if version == "" || strings.ContainsAny(version, " \t\r\n") {
+		logf("bump error: invalid version %q\n", version)
+		return 2
+	}
+	cfg, err := readConfig(cfgPath)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	var ds *Dataset
+	for i := range cfg.Datasets {
+		if cfg.Datasets[i].ID == id {
+			ds = &cfg.Datasets[i]
+		}
+	}
+	if ds == nil {
+		logf("bump error: unknown dataset %q\n", id)
+		return 2
+	}
+	if !ds.versioned {
+		logf("bump error: %s: no source uses %s\n", id, versionVar)
+		return 2
+	}
+
+	// Keep the originals to roll back to. The version is set in the file
+	// that defines the dataset, which may be an included one
+	file := firstNonEmpty(ds.file, cfgPath)
+	cfgBytes, err := os.ReadFile(file)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	lockOut := firstNonEmpty(opts.LockOut, lockPath)
+	lockBytes, lockErr := os.ReadFile(lockOut)
+
+	updated, err := setDatasetVersion(cfgBytes, id, version)
+	if err != nil {
+		logf("config error: %v\n", err)
+		return 2
+	}
+	if err := fsutil.WriteFileAtomic(file, bytes.NewReader(updated)); err != nil {
+		logf("config write error: %v\n", err)
+		return 1
+	}
+
+	if code := FetchWithOptions(cfgPath, lockPath, []string{id}, opts); code != 0 {
+		restoreErr := fsutil.WriteFileAtomic(file, bytes.NewReader(cfgBytes))
+		if lockErr == nil {
+			if err := fsutil.WriteFileAtomic(lockOut, bytes.NewReader(lockBytes)); restoreErr == nil {
+				restoreErr = err
+			}
+		} else if err := os.Remove(lockOut); err != nil && !os.IsNotExist(err) && restoreErr == nil {
+			restoreErr = err
+		}
+		if restoreErr != nil {
+			logf("[ERR ] %s: fetch of version %s failed, and restoring the config/lock failed: %v\n", id, version, restoreErr)
+		} else {
+			logf("[ERR ] %s: fetch of version %s failed; config and lock left unchanged\n", id, version)
+		}
+		return code
+	}
+	logf("[UPD ] %s: version %s -> %s\n", id, firstNonEmpty(ds.Version, "(none)"), version)
+	return 0
+}
+
+// setDatasetVersion sets the version key of dataset id in the config document b.
+//
+// Like addFallbackSources it edits the yaml.Node tree, so comments survive. A
+// dataset without a version key gets one right after its id.
+func setDatasetVersion(b []byte, id, version string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("empty config")
+	}
+	datasets := mappingValue(doc.Content[0], "datasets")
+	if datasets == nil || datasets.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("config has no datasets list")
+	}
+
+	found := false
+	for _, ds := range datasets.Content {
+		if idNode := mappingValue(ds, "id"); idNode == nil || idNode.Value != id {
+			continue
+		}
+		found = true
+		if v := mappingValue(ds, "version"); v != nil {
+			// Quoted, so versions like 1.10 don't turn into numbers
+			v.Kind, v.Tag, v.Value, v.Style = yaml.ScalarNode, "!!str", version, yaml.DoubleQuotedStyle
+			break
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+		val := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: version, Style: yaml.DoubleQuotedStyle}
+		for i := 0; i+1 < len(ds.Content); i += 2 {
+			if ds.Content[i].Value == "id" {
+				rest := append([]*yaml.Node{key, val}, ds.Content[i+2:]...)
+				ds.Content = append(ds.Content[:i+2], rest...)
+				break
+			}
+		}
+		break
+	}
+	if !found {
+		return nil, fmt.Errorf("dataset %q not found in config", id)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// mockPathHandler copies src.Path, file or directory, like the file handler
+// (which core's tests can't import, since it imports core).
+type mockPathHandler struct{}
+
+func (m *mockPathHandler) Name() string { return "mockpath" }
+
+func (m *mockPathHandler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	h, _, err := HashPath(src.Path)
+	return h, err
+}
+
+func (m *mockPathHandler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	if fi, err := os.Stat(src.Path); err == nil && fi.IsDir() {
+		return fsutil.CopyTree(src.Path, dest)
+	}
+	f, err := os.Open(src.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return fsutil.WriteFileAtomic(dest, f)
+}
+
+func init() {
+	registry.Register(&mockPathHandler{})
+}
+
+func TestApplyVersions(t *testing.T) {
+	c := &Config{Datasets: []Dataset{{
+		ID:      "versioned",
+		Version: "2.3.1",
+		Sources: []registry.Source{
+			{Type: "http", URL: "https://example.com/data/v{{version}}/file.csv"},
+			{Type: "command", URL: "https://mirror.example.com/{{version}}.csv"},
+		},
+	}}}
+	c.Datasets[0].Sources[1].FetchCmd = "get {{version}} > {{dest}}"
+	if err := applyVersions(c); err != nil {
+		t.Fatal(err)
+	}
+	ds := c.Datasets[0]
+	if ds.Sources[0].URL != "https://example.com/data/v2.3.1/file.csv" || ds.Sources[1].URL != "https://mirror.example.com/2.3.1.csv" {
+		t.Errorf("URLs not expanded: %+v", ds.Sources)
+	}
+	if ds.Sources[1].FetchCmd != "get 2.3.1 > {{dest}}" {
+		t.Errorf("FetchCmd = %q, want only {{version}} expanded", ds.Sources[1].FetchCmd)
+	}
+	if !ds.versioned {
+		t.Error("dataset not marked versioned")
+	}
+
+	c = &Config{Datasets: []Dataset{{ID: "missing", Sources: []registry.Source{{Type: "http", URL: "https://example.com/v{{version}}.csv"}}}}}
+	if err := applyVersions(c); err == nil || !strings.Contains(err.Error(), "no version") {
+		t.Errorf("applyVersions() without version error = %v", err)
+	}
+}
+
+func TestBump(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, v := range []string{"1.0", "1.1"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, "data-"+v+".csv"), []byte("data "+v), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	target := filepath.Join(tmpDir, "out", "data.csv")
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := `version: 1
+datasets:
+  # pinned release
+  - id: release
+    version: "1.0"
+    source:
+      type: mockpath
+      path: ` + filepath.Join(tmpDir, "data-{{version}}.csv") + `
+    target: ` + target + `
+  - id: plain
+    source:
+      type: mockpath
+      path: ` + filepath.Join(tmpDir, "data-1.0.csv") + `
+    target: ` + filepath.Join(tmpDir, "out", "plain.csv") + `
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "lock.yaml")
+	if code := FetchWithOptions(configPath, lockPath, nil, Options{}); code != 0 {
+		t.Fatalf("initial fetch = %d", code)
+	}
+
+	if code := Bump(configPath, lockPath, "release", "1.1", Options{}); code != 0 {
+		t.Fatalf("Bump() = %d, want 0", code)
+	}
+	if b, _ := os.ReadFile(target); string(b) != "data 1.1" {
+		t.Errorf("target = %q, want the new version's data", b)
+	}
+	cfgBytes, _ := os.ReadFile(configPath)
+	if !strings.Contains(string(cfgBytes), `version: "1.1"`) || !strings.Contains(string(cfgBytes), "# pinned release") {
+		t.Errorf("config after bump:\n%s", cfgBytes)
+	}
+	lk, _ := readLock(lockPath)
+	if h, _ := HashFile(target); lk.Items["release"].LocalSHA256 != h {
+		t.Error("lock not updated to the new version")
+	}
+
+	// A version that can't be fetched leaves everything as it was
+	lockBytes, _ := os.ReadFile(lockPath)
+	if code := Bump(configPath, lockPath, "release", "9.9", Options{}); code != 1 {
+		t.Errorf("Bump() to a missing version = %d, want 1", code)
+	}
+	if b, _ := os.ReadFile(configPath); string(b) != string(cfgBytes) {
+		t.Errorf("config not restored:\n%s", b)
+	}
+	if b, _ := os.ReadFile(lockPath); string(b) != string(lockBytes) {
+		t.Error("lock not restored")
+	}
+
+	if code := Bump(configPath, lockPath, "plain", "2.0", Options{}); code != 2 {
+		t.Errorf("Bump() on a dataset without {{version}} = %d, want 2", code)
+	}
+	if code := Bump(configPath, lockPath, "nope", "2.0", Options{}); code != 2 {
+		t.Errorf("Bump() on an unknown dataset = %d, want 2", code)
+	}
+}
+
+func TestSetDatasetVersion(t *testing.T) {
+	in := "version: 1\ndatasets:\n  - id: a\n    target: a.csv\n"
+	out, err := setDatasetVersion([]byte(in), "a", "1.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "version: 1\ndatasets:\n  - id: a\n    version: \"1.10\"\n    target: a.csv\n"
+	if string(out) != want {
+		t.Errorf("setDatasetVersion() =\n%s\nwant\n%s", out, want)
+	}
+	if _, err := setDatasetVersion([]byte(in), "b", "1"); err == nil {
+		t.Error("setDatasetVersion() on a missing dataset should fail")
+	}
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Watch mode: "datum watch" keeps checking in the foreground, for running
+// datum as a sidecar next to whatever reads the data rather than from cron.
+// Each round is an ordinary check (Options apply to every round, and each
+// gets its own run ID unless one was given), so update-policy datasets are
+// kept fresh and the rest reported. The config is read again by every
+// round; a reload (SIGHUP) starts the next one right away, so an edited
+// config takes effect without a restart. A round that finds a config error
+// is logged and the loop carries on, waiting for the config to be fixed.
+//
+// The optional health endpoint answers GET /healthz with the state of the
+// last round, as JSON: 200 once a round has completed without a config
+// error and the next one isn't overdue, 503 otherwise (including before
+// the first round finishes), so an orchestrator can hold back readers until
+// the data is there.
+
+// WatchOptions controls Watch.
+type WatchOptions struct {
+	// Interval is the time from the start of one round to the start of the next.
+	Interval time.Duration
+
+	// Reload, when a value arrives, starts the next round right away.
+	// The CLI sends one on SIGHUP.
+	Reload <-chan struct{}
+
+	// HealthAddr is where the health endpoint listens (e.g. ":8080").
+	// Empty means no endpoint.
+	HealthAddr string
+}
+
+// WatchHealth is the health endpoint's response.
+type WatchHealth struct {
+	Status    string     `json:"status"`                // "ok", "starting" or "failing"
+	Rounds    int        `json:"rounds"`                // Rounds completed
+	LastRunAt *time.Time `json:"last_run_at,omitempty"` // Start of the last completed round
+	ExitCode  int        `json:"exit_code"`             // Its exit code, as "datum check" would return it
+	NextRunAt *time.Time `json:"next_run_at,omitempty"` // When the next round is due
+}
+
+// watchState is what the health endpoint reports, updated after each round.
+type watchState struct {
+	mu       sync.Mutex
+	interval time.Duration
+	health   WatchHealth
+}
+
+// finished records a round that started at start and returned exit.
+func (s *watchState) finished(start time.Time, exit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := start.Add(s.interval)
+	s.health.Rounds++
+	s.health.LastRunAt, s.health.NextRunAt, s.health.ExitCode = &start, &next, exit
+}
+
+// ServeHTTP answers health checks.
+func (s *watchState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	h := s.health
+	s.mu.Unlock()
+	code := http.StatusOK
+	switch {
+	case h.Rounds == 0:
+		h.Status, code = "starting", http.StatusServiceUnavailable
+	case h.ExitCode == 2 || time.Now().After(h.NextRunAt.Add(s.interval)):
+		// A config error, or a round that should have finished long ago
+		h.Status, code = "failing", http.StatusServiceUnavailable
+	default:
+		h.Status = "ok"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(h)
+}
+
+// Watch checks the datasets every w.Interval until opts.Context is cancelled
+// (see the top of this file).
+//
+// Returns:
+//   - 0: Stopped by cancellation
+//   - 2: Invalid interval, or the health endpoint couldn't listen
+func Watch(cfgPath, lockPath string, w WatchOptions, opts Options) int {
+	if w.Interval <= 0 {
+		logf("watch: --interval must be positive\n")
+		return 2
+	}
+	ctx := opts.runContext()
+	state := &watchState{interval: w.Interval}
+	if w.HealthAddr != "" {
+		ln, err := net.Listen("tcp", w.HealthAddr)
+		if err != nil {
+			logf("watch: health endpoint: %v\n", err)
+			return 2
+		}
+		mux := http.NewServeMux()
+		mux.Handle("GET /healthz", state)
+		srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logf("[WARN] watch: health endpoint: %v\n", err)
+			}
+		}()
+		defer srv.Close()
+		logf("[INFO] health endpoint on http://%s/healthz\n", ln.Addr())
+	}
+
+	logf("[INFO] watching %s every %s\n", cfgPath, w.Interval)
+	for {
+		start := time.Now().UTC()
+		exit := CheckWithOptions(cfgPath, lockPath, opts)
+		if ctx.Err() != nil {
+			return 0
+		}
+		state.finished(start, exit)
+
+		timer := time.NewTimer(time.Until(start.Add(w.Interval)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0
+		case <-timer.C:
+		case <-w.Reload:
+			timer.Stop()
+			logf("[INFO] reloading %s\n", cfgPath)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// reportChan receives each JSON report written to it.
+type reportChan chan Report
+
+func (c reportChan) Write(p []byte) (int, error) {
+	var rep Report
+	if err := json.Unmarshal(p, &rep); err != nil {
+		return 0, err
+	}
+	c <- rep
+	return len(p), nil
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "source.csv")
+	os.WriteFile(src, []byte("a\n"), 0o644)
+	cfgPath := filepath.Join(dir, "config.yaml")
+	writeConfig := func(id string) {
+		os.WriteFile(cfgPath, []byte(`version: 1
+datasets:
+  - id: `+id+`
+    policy: update
+    source:
+      type: mockpath
+      path: `+src+`
+    target: `+filepath.Join(dir, id+".csv")+`
+`), 0o644)
+	}
+	writeConfig("codes")
+	lockPath := filepath.Join(dir, "lock.yaml")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reports := make(reportChan)
+	reload := make(chan struct{})
+	done := make(chan int)
+	go func() {
+		done <- Watch(cfgPath, lockPath, WatchOptions{Interval: time.Hour, Reload: reload}, Options{Context: ctx, Report: reports})
+	}()
+
+	round := func() Report {
+		t.Helper()
+		select {
+		case rep := <-reports:
+			return rep
+		case <-time.After(10 * time.Second):
+			t.Fatal("no round finished")
+			return Report{}
+		}
+	}
+	if rep := round(); rep.ExitCode != 0 || len(rep.Datasets) != 1 || rep.Datasets[0].ID != "codes" {
+		t.Fatalf("first round = %+v", rep)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "codes.csv")); err != nil {
+		t.Errorf("update policy target not fetched: %v", err)
+	}
+
+	// A reload picks up the edited config at once, and a broken one
+	// doesn't stop the loop
+	writeConfig("renamed")
+	reload <- struct{}{}
+	if rep := round(); len(rep.Datasets) != 1 || rep.Datasets[0].ID != "renamed" {
+		t.Errorf("round after reload = %+v, want the renamed dataset", rep)
+	}
+	os.WriteFile(cfgPath, []byte("version: 1\ndatasets: [\n"), 0o644)
+	reload <- struct{}{}
+	if rep := round(); rep.ExitCode != 2 {
+		t.Errorf("round with a broken config exit = %d, want 2", rep.ExitCode)
+	}
+
+	cancel()
+	if code := <-done; code != 0 {
+		t.Errorf("Watch() = %d after cancellation, want 0", code)
+	}
+}
+
+func TestWatchHealth(t *testing.T) {
+	state := &watchState{interval: time.Hour}
+	get := func() (int, WatchHealth) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		state.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		var h WatchHealth
+		if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, h
+	}
+
+	if code, h := get(); code != http.StatusServiceUnavailable || h.Status != "starting" {
+		t.Errorf("before the first round: %d %+v", code, h)
+	}
+	state.finished(time.Now(), 1)
+	if code, h := get(); code != http.StatusOK || h.Status != "ok" || h.ExitCode != 1 {
+		t.Errorf("after a round with changes: %d %+v", code, h)
+	}
+	state.finished(time.Now(), 2)
+	if code, h := get(); code != http.StatusServiceUnavailable || h.Status != "failing" {
+		t.Errorf("after a config error: %d %+v", code, h)
+	}
+	state.finished(time.Now().Add(-3*time.Hour), 0)
+	if code, h := get(); code != http.StatusServiceUnavailable || h.Status != "failing" {
+		t.Errorf("with the next round overdue: %d %+v", code, h)
+	}
+}
+
+func TestWatch_InvalidInterval(t *testing.T) {
+	if code := Watch("x.yaml", "x.lock.yaml", WatchOptions{}, Options{}); code != 2 {
+		t.Errorf("Watch(no interval) = %d, want 2", code)
+	}
+}
@@ -0,0 +1,170 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// sharedTypes are the handlers whose work is sent to the daemon. file,
+// command and dvc sources are read relative to the repository, and are cheap
+// to run in place, so they stay local. sql sources stay local too: a database
+// connection gains nothing from being opened in another process.
+var sharedTypes = []string{"http", "git", "sftp", "ftp", "huggingface", "doi", "torrent", "github-release"}
+
+// Connect checks that a daemon answers on socket, and that the socket is
+// this user's (see checkOwner), then replaces the registered handlers of the
+// shared types with clients of it. Handlers this binary wasn't built with
+// (git without -tags git) are left out, as they would be without the daemon.
+func Connect(socket string) error {
+	if err := checkOwner(socket); err != nil {
+		return err
+	}
+	if _, err := Ping(context.Background(), socket); err != nil {
+		return err
+	}
+	for _, name := range sharedTypes {
+		if local, ok := registry.Get(name); ok {
+			registry.Register(&remote{name: name, socket: socket, local: local})
+		}
+	}
+	return nil
+}
+
+// Ping asks the daemon on socket for its statistics.
+func Ping(ctx context.Context, socket string) (*Stats, error) {
+	resp, err := call(ctx, socket, request{Op: opPing})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Stats, nil
+}
+
+// remote is a handler whose operations run in the daemon.
+type remote struct {
+	name   string
+	socket string
+	local  registry.Fetcher // The same handler in this process, for what it can answer alone
+}
+
+func (r *remote) Name() string { return r.name }
+
+func (r *remote) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	resp, err := call(ctx, r.socket, newRequest(opFingerprint, src))
+	return resp.Fingerprint, err
+}
+
+// Fetch has the daemon download src (or find it in its cache) and copies the
+// daemon's copy to dest. The daemon doesn't report progress.
+func (r *remote) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	resp, err := call(ctx, r.socket, newRequest(opFetch, src))
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(resp.Path); err == nil && fi.IsDir() {
+		return fsutil.CopyTree(resp.Path, dest) // A git subtree
+	}
+	f, err := os.Open(resp.Path)
+	if err != nil {
+		return fmt.Errorf("daemon: %w", err)
+	}
+	defer f.Close()
+	return fsutil.WriteFileAtomic(dest, f)
+}
+
+// ModTime implements registry.ModTimer for handlers that do.
+func (r *remote) ModTime(ctx context.Context, src registry.Source) (time.Time, error) {
+	if _, ok := r.local.(registry.ModTimer); !ok {
+		return time.Time{}, fmt.Errorf("%s sources have no modification time", r.name)
+	}
+	resp, err := call(ctx, r.socket, newRequest(opModTime, src))
+	return resp.ModTime, err
+}
+
+// Relocated implements registry.Relocator.
+func (r *remote) Relocated(ctx context.Context, src registry.Source) (string, error) {
+	if _, ok := r.local.(registry.Relocator); !ok {
+		return "", nil
+	}
+	resp, err := call(ctx, r.socket, newRequest(opRelocated, src))
+	return resp.Location, err
+}
+
+// Probe runs locally: it's interactive, one-off work with nothing to share.
+func (r *remote) Probe(ctx context.Context, location string) (*registry.ProbeResult, error) {
+	if p, ok := r.local.(registry.Prober); ok {
+		return p.Probe(ctx, location)
+	}
+	return nil, nil
+}
+
+// newRequest builds a request for src. Progress stays behind: it's a live
+// object in this process.
+func newRequest(op string, src registry.Source) request {
+	src.Progress = nil
+	return request{Op: op, Source: src}
+}
+
+// call sends req to the daemon on socket and returns its answer. Cancelling
+// ctx closes the connection, which cancels the operation in the daemon.
+func call(ctx context.Context, socket string, req request) (response, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return response{}, fmt.Errorf("daemon: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var resp response
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return response{}, callError(ctx, err)
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return response{}, callError(ctx, err)
+	}
+	if resp.Error != "" {
+		return resp, &remoteError{msg: resp.Error, status: resp.Status, transient: resp.Transient}
+	}
+	return resp, nil
+}
+
+// callError prefers the context's error when cancelling it is what broke
+// the connection.
+func callError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("daemon: %w", err)
+}
+
+// remoteError is an error the daemon reported. It keeps what the engine's
+// retry logic looks for: the HTTP status, if any, and whether the failure
+// was transient (reported as a timeout, which the engine retries).
+type remoteError struct {
+	msg       string
+	status    *httputil.StatusError
+	transient bool
+}
+
+func (e *remoteError) Error() string { return e.msg }
+
+// Unwrap exposes the status, so errors.As finds a *httputil.StatusError.
+func (e *remoteError) Unwrap() error {
+	if e.status == nil {
+		return nil
+	}
+	return e.status
+}
+
+// Timeout and Temporary make remoteError a net.Error.
+func (e *remoteError) Timeout() bool   { return e.transient }
+func (e *remoteError) Temporary() bool { return e.transient }
@@ -0,0 +1,358 @@
+// Package daemon lets the datum commands of many repositories on one machine
+// share a single long-running process for their network work.
+//
+// "datum daemon" serves the handlers' source operations (fingerprint, fetch,
+// modification time, relocation) on a unix socket. A CLI started with
+// --daemon replaces its network handlers with thin clients of that socket
+// (see Connect), while config, lock and targets stay with the CLI. Because
+// every repository's requests then go through one process:
+//
+//   - Downloads are shared: a file another repository fetched at the same
+//     fingerprint is handed over from the daemon's cache instead of being
+//     downloaded again.
+//   - Fingerprints are shared: answers (HEAD requests, git ref lookups) are
+//     reused for a short TTL, and identical requests in flight are made once.
+//   - Rate limits are shared: the connection budget is the daemon's, so ten
+//     repositories checking at once don't open ten times the connections.
+//   - Credentials are the daemon's: handlers read their variables (HF_TOKEN,
+//     GIT_TOKEN, ...) from the daemon's environment, and git and sftp keep
+//     their caches and sessions there. Auth profiles still apply; only the
+//     variable names travel over the socket, never their values.
+//
+// Go learning note: the protocol is one JSON request and one JSON response
+// per connection. Closing the connection early is how a client cancels: the
+// server watches for it and cancels the operation's context.
+package daemon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// DefaultTTL is how long the daemon reuses a fingerprint by default.
+const DefaultTTL = 30 * time.Second
+
+// DefaultSocket returns where the daemon listens and clients connect:
+// $DATUM_DAEMON_SOCKET, else datum.sock in $XDG_RUNTIME_DIR, else a per-user
+// name in the temp directory.
+func DefaultSocket() string {
+	if v := os.Getenv("DATUM_DAEMON_SOCKET"); v != "" {
+		return v
+	}
+	if v := os.Getenv("XDG_RUNTIME_DIR"); v != "" {
+		return filepath.Join(v, "datum.sock")
+	}
+	return filepath.Join(os.TempDir(), "datum-"+strconv.Itoa(os.Getuid())+".sock")
+}
+
+// Operations a request can ask for.
+const (
+	opPing        = "ping"
+	opFingerprint = "fingerprint"
+	opFetch       = "fetch"
+	opModTime     = "modtime"
+	opRelocated   = "relocated"
+)
+
+// request is what a client sends.
+type request struct {
+	Op     string
+	Source registry.Source // Including Credentials: only yaml skips it
+}
+
+// response is what the server answers.
+type response struct {
+	Fingerprint string
+	Path        string    // Fetch: the daemon's cached copy, for the client to copy to its target
+	ModTime     time.Time // ModTime
+	Location    string    // Relocated
+	Stats       *Stats    // Ping
+
+	Error     string
+	Status    *httputil.StatusError // Set when the error was an HTTP status, for retry decisions
+	Transient bool                  // The error is worth retrying
+}
+
+// Stats counts what the daemon has done since it started.
+type Stats struct {
+	Started          time.Time
+	Requests         int
+	FingerprintsRun  int // Fingerprints computed by a handler
+	FingerprintsHit  int // Fingerprints answered from the TTL cache or a request in flight
+	Fetches          int // Downloads made
+	FetchesShared    int // Fetches answered with a download already in the cache
+	BytesSharedTotal int64
+}
+
+// Server answers requests with the handlers registered in this process.
+type Server struct {
+	TTL time.Duration // How long fingerprints are reused (0 = DefaultTTL)
+	Dir string        // Where fetched files are kept (default: <cache dir>/daemon)
+
+	handlers map[string]registry.Fetcher // As registered when Serve started, before any Connect
+
+	mu     sync.Mutex
+	fps    map[string]*fpEntry
+	files  map[string]fileEntry
+	stats  Stats
+	fileMu sync.Map // key -> *sync.Mutex, so one download per source runs at a time
+}
+
+// fpEntry is a fingerprint that was computed, or is being computed.
+type fpEntry struct {
+	done chan struct{} // Closed when fp and err are set
+	fp   string
+	err  error
+	at   time.Time
+}
+
+// fileEntry is a downloaded file and the fingerprint it was fetched at.
+type fileEntry struct {
+	path string
+	fp   string
+}
+
+// Serve listens on socket until ctx is cancelled. A stale socket left by a
+// daemon that died is replaced; a live one is an error, so two daemons
+// never share a socket.
+func (s *Server) Serve(ctx context.Context, socket string) error {
+	if s.TTL <= 0 {
+		s.TTL = DefaultTTL
+	}
+	if s.Dir == "" {
+		s.Dir = filepath.Join(fsutil.CacheDir(), "daemon")
+	}
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return err
+	}
+	s.fps, s.files = map[string]*fpEntry{}, map[string]fileEntry{}
+	s.handlers = map[string]registry.Fetcher{}
+	for _, name := range registry.Names() {
+		s.handlers[name], _ = registry.Get(name)
+	}
+	s.stats.Started = time.Now()
+
+	if c, err := net.Dial("unix", socket); err == nil {
+		c.Close()
+		return fmt.Errorf("a daemon is already listening on %s", socket)
+	}
+	os.Remove(socket)
+	if err := os.MkdirAll(filepath.Dir(socket), 0o700); err != nil {
+		return err
+	}
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	// Only this user may connect: the daemon fetches with their credentials
+	if err := os.Chmod(socket, 0o600); err != nil {
+		ln.Close()
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+	defer os.Remove(socket)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handle(ctx, conn)
+		}()
+	}
+}
+
+// handle answers one connection.
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	var req request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	// The client closing its end cancels the operation
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		io.Copy(io.Discard, conn)
+		cancel()
+	}()
+
+	s.mu.Lock()
+	s.stats.Requests++
+	s.mu.Unlock()
+	json.NewEncoder(conn).Encode(s.serve(ctx, req))
+}
+
+// serve runs req.
+func (s *Server) serve(ctx context.Context, req request) response {
+	var resp response
+	var err error
+	if req.Op == opPing {
+		s.mu.Lock()
+		stats := s.stats
+		s.mu.Unlock()
+		resp.Stats = &stats
+		return resp
+	}
+
+	f, ok := s.handlers[req.Source.Type]
+	if !ok {
+		return response{Error: fmt.Sprintf("daemon: unknown source.type=%q", req.Source.Type)}
+	}
+	switch req.Op {
+	case opFingerprint:
+		resp.Fingerprint, err = s.fingerprint(ctx, f, req.Source)
+	case opFetch:
+		resp.Path, err = s.fetch(ctx, f, req.Source)
+	case opModTime:
+		mt, ok := f.(registry.ModTimer)
+		if !ok {
+			return response{Error: fmt.Sprintf("daemon: %s sources have no modification time", req.Source.Type)}
+		}
+		resp.ModTime, err = mt.ModTime(ctx, req.Source)
+	case opRelocated:
+		if r, ok := f.(registry.Relocator); ok {
+			resp.Location, err = r.Relocated(ctx, req.Source)
+		}
+	default:
+		return response{Error: fmt.Sprintf("daemon: unknown operation %q", req.Op)}
+	}
+	if err != nil {
+		resp.Error, resp.Transient = err.Error(), retryable(err)
+		errors.As(err, &resp.Status)
+	}
+	return resp
+}
+
+// key identifies a source, including whose credentials it is read with, so
+// one identity's download is never handed to another.
+func key(src registry.Source) string {
+	src.Progress = nil
+	b, _ := json.Marshal(src)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// fingerprint returns src's fingerprint from the cache if it's younger than
+// the TTL, joins an identical request already running, or runs the handler.
+func (s *Server) fingerprint(ctx context.Context, f registry.Fetcher, src registry.Source) (string, error) {
+	k := key(src)
+	s.mu.Lock()
+	if e, ok := s.fps[k]; ok {
+		select {
+		case <-e.done:
+			if e.err == nil && time.Since(e.at) < s.TTL {
+				s.stats.FingerprintsHit++
+				s.mu.Unlock()
+				return e.fp, nil
+			}
+		default:
+			s.stats.FingerprintsHit++
+			s.mu.Unlock()
+			select {
+			case <-e.done:
+				return e.fp, e.err
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+	}
+	e := &fpEntry{done: make(chan struct{})}
+	s.fps[k] = e
+	s.stats.FingerprintsRun++
+	s.mu.Unlock()
+
+	e.fp, e.err = f.Fingerprint(ctx, src)
+	e.at = time.Now()
+	close(e.done)
+	if e.err != nil {
+		s.mu.Lock()
+		delete(s.fps, k) // Failures aren't cached
+		s.mu.Unlock()
+	}
+	return e.fp, e.err
+}
+
+// fetch returns the path of a cached copy of src at its current fingerprint,
+// downloading it first unless an earlier fetch already has.
+func (s *Server) fetch(ctx context.Context, f registry.Fetcher, src registry.Source) (string, error) {
+	k := key(src)
+	mu, _ := s.fileMu.LoadOrStore(k, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	fp, err := s.fingerprint(ctx, f, src)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	old, ok := s.files[k]
+	s.mu.Unlock()
+	if ok && old.fp == fp {
+		if fi, err := os.Stat(old.path); err == nil {
+			s.mu.Lock()
+			s.stats.FetchesShared++
+			s.stats.BytesSharedTotal += fi.Size()
+			s.mu.Unlock()
+			return old.path, nil
+		}
+	}
+
+	sum := sha256.Sum256([]byte(k + "\x00" + fp))
+	path := filepath.Join(s.Dir, hex.EncodeToString(sum[:16]))
+	src.Progress = nil
+	if err := f.Fetch(ctx, src, path); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.files[k] = fileEntry{path: path, fp: fp}
+	s.stats.Fetches++
+	s.mu.Unlock()
+	if ok && old.path != path {
+		// Clients given the old copy have had a minute to open it
+		time.AfterFunc(time.Minute, func() { os.RemoveAll(old.path) })
+	}
+	return path, nil
+}
+
+// retryable mirrors the network half of the engine's transient check, which
+// the client can't redo once the error is flattened to text.
+func retryable(err error) bool {
+	var se *httputil.StatusError
+	if errors.As(err, &se) {
+		return se.Temporary()
+	}
+	var netErr net.Error
+	var opErr *net.OpError
+	return errors.As(err, &netErr) && netErr.Timeout() ||
+		errors.As(err, &opErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
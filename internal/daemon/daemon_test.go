@@ -0,0 +1,150 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// countingHandler stands in for http: it counts the work it does, and fails
+// with a 503 for the URL "down".
+type countingHandler struct {
+	fingerprints, fetches atomic.Int32
+}
+
+func (h *countingHandler) Name() string { return "http" }
+
+func (h *countingHandler) Fingerprint(_ context.Context, src registry.Source) (string, error) {
+	h.fingerprints.Add(1)
+	if src.URL == "down" {
+		return "", &httputil.StatusError{Method: "HEAD", URL: src.URL, Code: 503, Status: "503 Service Unavailable"}
+	}
+	return "etag:" + src.URL, nil
+}
+
+func (h *countingHandler) Fetch(_ context.Context, src registry.Source, dest string) error {
+	h.fetches.Add(1)
+	return os.WriteFile(dest, []byte("content of "+src.URL), 0o644)
+}
+
+// startDaemon serves the registered handlers on a fresh socket until the
+// test ends, and connects this process to it.
+func startDaemon(t *testing.T) (socket string) {
+	t.Helper()
+	// Socket paths are limited to about 100 bytes, which t.TempDir can exceed
+	dir, err := os.MkdirTemp("", "datumd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket = filepath.Join(dir, "d.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- (&Server{Dir: t.TempDir()}).Serve(ctx, socket) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() = %v", err)
+		}
+	})
+	for i := 0; ; i++ {
+		if _, err := Ping(context.Background(), socket); err == nil {
+			break
+		} else if i == 100 {
+			t.Fatalf("daemon didn't start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := Connect(socket); err != nil {
+		t.Fatal(err)
+	}
+	return socket
+}
+
+func TestDaemon(t *testing.T) {
+	ctx := context.Background()
+	local := &countingHandler{}
+	registry.Register(local)
+	socket := startDaemon(t)
+
+	f, _ := registry.Get("http")
+	if _, ok := f.(*remote); !ok {
+		t.Fatalf("after Connect, http is a %T, want the daemon client", f)
+	}
+	if _, ok := registry.Get("sftp"); ok {
+		t.Error("Connect registered sftp, which this binary doesn't have")
+	}
+
+	src := registry.Source{Type: "http", URL: "https://example.org/a.csv"}
+	for i := 0; i < 2; i++ {
+		if fp, err := f.Fingerprint(ctx, src); err != nil || fp != "etag:"+src.URL {
+			t.Fatalf("Fingerprint() = %q, %v", fp, err)
+		}
+	}
+	for _, name := range []string{"one.csv", "two.csv"} {
+		dest := filepath.Join(t.TempDir(), name)
+		if err := f.Fetch(ctx, src, dest); err != nil {
+			t.Fatalf("Fetch() = %v", err)
+		}
+		if b, _ := os.ReadFile(dest); string(b) != "content of "+src.URL {
+			t.Errorf("fetched %q", b)
+		}
+	}
+	if got := local.fingerprints.Load(); got != 1 {
+		t.Errorf("handler fingerprinted %d times, want 1 (then reused)", got)
+	}
+	if got := local.fetches.Load(); got != 1 {
+		t.Errorf("handler fetched %d times, want 1 (then shared)", got)
+	}
+
+	stats, err := Ping(ctx, socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FingerprintsRun != 1 || stats.FingerprintsHit != 3 || stats.Fetches != 1 || stats.FetchesShared != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if want := int64(len("content of " + src.URL)); stats.BytesSharedTotal != want {
+		t.Errorf("BytesSharedTotal = %d, want %d", stats.BytesSharedTotal, want)
+	}
+}
+
+func TestDaemonErrors(t *testing.T) {
+	ctx := context.Background()
+	registry.Register(&countingHandler{})
+	socket := startDaemon(t)
+	f, _ := registry.Get("http")
+
+	_, err := f.Fingerprint(ctx, registry.Source{Type: "http", URL: "down"})
+	var se *httputil.StatusError
+	if !errors.As(err, &se) || se.Code != 503 {
+		t.Errorf("Fingerprint() error = %v, want the 503 StatusError", err)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Fingerprint() error = %v, want it transient", err)
+	}
+
+	if _, err := f.(registry.ModTimer).ModTime(ctx, registry.Source{Type: "http", URL: "x"}); err == nil {
+		t.Error("ModTime() succeeded for a handler without modification times")
+	}
+
+	if err := (&Server{Dir: t.TempDir()}).Serve(ctx, socket); err == nil {
+		t.Error("a second Serve() on a live socket succeeded")
+	}
+}
+
+func TestPingNoDaemon(t *testing.T) {
+	if _, err := Ping(context.Background(), filepath.Join(t.TempDir(), "none.sock")); err == nil {
+		t.Error("Ping() with no daemon succeeded")
+	}
+}
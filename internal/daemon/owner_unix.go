@@ -0,0 +1,32 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkOwner refuses a socket this user doesn't own. The fallback socket
+// path in the shared temp directory is predictable, so another user could
+// bind it first and receive every source a client asks about, and hand back
+// whatever content they like. A symlink is refused too, as it could be
+// repointed after the check.
+func checkOwner(socket string) error {
+	fi, err := os.Lstat(socket)
+	if err != nil {
+		return fmt.Errorf("daemon: %w", err)
+	}
+	if fi.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("daemon: %s isn't a socket", socket)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if uid := os.Getuid(); int(st.Uid) != uid {
+		return fmt.Errorf("daemon: %s belongs to user %d, not to you (%d); refusing to use it", socket, st.Uid, uid)
+	}
+	return nil
+}
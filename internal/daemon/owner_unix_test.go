@@ -0,0 +1,47 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckOwner(t *testing.T) {
+	dir, err := os.MkdirTemp("", "datumd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "d.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := checkOwner(socket); err != nil {
+		t.Errorf("checkOwner() of our own socket: %v", err)
+	}
+	link := filepath.Join(dir, "link.sock")
+	os.Symlink(socket, link)
+	if err := checkOwner(link); err == nil || !strings.Contains(err.Error(), "isn't a socket") {
+		t.Errorf("checkOwner() of a symlink: error = %v", err)
+	}
+
+	if os.Getuid() != 0 {
+		return // Only root can give the socket away
+	}
+	if err := os.Lchown(socket, 65534, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOwner(socket); err == nil || !strings.Contains(err.Error(), "refusing") {
+		t.Errorf("checkOwner() of another user's socket: error = %v", err)
+	}
+	if err := Connect(socket); err == nil {
+		t.Error("Connect() to another user's socket succeeded")
+	}
+}
@@ -0,0 +1,184 @@
+// Package fsutil provides the filesystem helpers shared by the engine and handlers.
+//
+// All temporary files and caches datum creates are placed through this package,
+// so a single setting (the scratch directory) can move them off a read-only
+// workspace. Handlers should use WriteFileAtomic instead of hand-rolling the
+// "write .tmp then rename" pattern.
+package fsutil
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// scratchDir is where temp files and caches go when set (empty = defaults).
+// It's configured once at startup from --scratch-dir or DATUM_SCRATCH_DIR.
+var scratchDir = os.Getenv("DATUM_SCRATCH_DIR")
+
+// SetScratchDir redirects all temp files and caches under dir.
+// An empty dir restores the defaults (temp files next to their targets,
+// caches under $XDG_CACHE_HOME or ~/.cache/datum).
+func SetScratchDir(dir string) { scratchDir = dir }
+
+// ScratchDir returns the configured scratch directory, or "" if none is set.
+func ScratchDir() string { return scratchDir }
+
+// tmpDir is where downloads are preferably staged (defaults.tmp_dir), or "".
+var tmpDir string
+
+// SetTmpDir sets the directory WriteFileAtomic stages files in, as long as it
+// is on the same filesystem as the target (see createTemp). Empty means none.
+func SetTmpDir(dir string) { tmpDir = dir }
+
+// CacheDir returns the root directory for datum's persistent caches.
+//
+// Resolution order:
+//  1. <scratch dir>/cache when a scratch directory is configured
+//  2. $XDG_CACHE_HOME/datum
+//  3. ~/.cache/datum
+func CacheDir() string {
+	if scratchDir != "" {
+		return filepath.Join(scratchDir, "cache")
+	}
+	if v := os.Getenv("XDG_CACHE_HOME"); v != "" {
+		return filepath.Join(v, "datum")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cache", "datum")
+}
+
+// MkdirTemp creates a new temporary directory for datum's own use.
+//
+// It lives under the scratch directory when one is configured, otherwise under
+// the system temp directory. Callers are responsible for removing it.
+func MkdirTemp(pattern string) (string, error) {
+	if scratchDir == "" {
+		return os.MkdirTemp("", pattern)
+	}
+	dir := filepath.Join(scratchDir, "tmp")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(dir, pattern)
+}
+
+// WriteFileAtomic streams r into dest so that dest is never left partially written.
+//
+// The data is first written to a temporary file, then renamed over dest. The
+// temp file is placed on dest's filesystem whenever possible (see createTemp),
+// so the rename is atomic; only if it ends up elsewhere is the staged file
+// copied into place instead.
+//
+// Parent directories of dest are created as needed.
+func WriteFileAtomic(dest string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := createTemp(dest)
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	// Temp files are created 0600; give the target the mode a plain create
+	// would, or keep the one it has
+	if err := tmp.Chmod(FileMode(dest)); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, dest); err != nil {
+		// Staged on another filesystem (scratch dir): fall back to a copy
+		if filepath.Dir(tmpPath) != filepath.Dir(dest) {
+			err = copyFile(tmpPath, dest)
+		}
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// FileMode returns the permissions a file staged for dest should get before
+// it's renamed over dest: dest's own, if it exists, or else those os.Create
+// would give a new file (0666 less the umask).
+func FileMode(dest string) os.FileMode {
+	if fi, err := os.Stat(dest); err == nil && fi.Mode().IsRegular() {
+		return fi.Mode().Perm()
+	}
+	return 0o666 &^ os.FileMode(umask)
+}
+
+// createTemp opens the staging file for dest.
+//
+// A rename is only atomic within one filesystem; across filesystems it fails
+// (EXDEV) and the file has to be copied, which a reader can catch half done.
+// So the staging directory is, in order of preference:
+//
+//  1. the tmp_dir, then the scratch directory, if on dest's filesystem. That
+//     keeps partial downloads out of the data directory, which matters on
+//     mounts that act on every new file (sync clients, backup agents).
+//  2. dest's own directory, under a hidden name unique to this write, so
+//     concurrent writers never share a temp file.
+//  3. the tmp_dir or scratch directory on another filesystem, if dest's
+//     directory won't take new files. WriteFileAtomic then copies.
+func createTemp(dest string) (*os.File, error) {
+	dir, name := filepath.Dir(dest), filepath.Base(dest)
+	var elsewhere []string
+	for _, d := range stagingDirs() {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			continue
+		}
+		if sameFilesystem(d, dir) {
+			return os.CreateTemp(d, tempPattern(name))
+		}
+		elsewhere = append(elsewhere, d)
+	}
+	f, err := os.CreateTemp(dir, tempPattern("."+name))
+	if err != nil && len(elsewhere) > 0 {
+		return os.CreateTemp(elsewhere[0], tempPattern(name))
+	}
+	return f, err
+}
+
+// stagingDirs returns the configured directories temp files may be staged
+// in, most preferred first.
+func stagingDirs() []string {
+	var dirs []string
+	if tmpDir != "" {
+		dirs = append(dirs, tmpDir)
+	}
+	if scratchDir != "" {
+		dirs = append(dirs, filepath.Join(scratchDir, "tmp"))
+	}
+	return dirs
+}
+
+// copyFile copies src over dst, used when a rename isn't possible.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
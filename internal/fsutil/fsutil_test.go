@@ -0,0 +1,145 @@
+package fsutil
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	t.Run("writes next to target by default", func(t *testing.T) {
+		SetScratchDir("")
+		dest := filepath.Join(t.TempDir(), "nested", "out.txt")
+
+		if err := WriteFileAtomic(dest, strings.NewReader("hello")); err != nil {
+			t.Fatalf("WriteFileAtomic() error = %v", err)
+		}
+		got, err := os.ReadFile(dest)
+		if err != nil {
+			t.Fatalf("failed to read dest: %v", err)
+		}
+		if string(got) != "hello" {
+			t.Errorf("content = %q, want %q", got, "hello")
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(dest)); len(entries) != 1 {
+			t.Errorf("target dir has %d entries, want just the target (no temp file left behind)", len(entries))
+		}
+	})
+
+	t.Run("stages in tmp_dir on the same filesystem", func(t *testing.T) {
+		SetScratchDir("")
+		root := t.TempDir()
+		tmp := filepath.Join(root, "staging")
+		SetTmpDir(tmp)
+		defer SetTmpDir("")
+
+		// Record where the temp file is created while the write is under way
+		dest := filepath.Join(root, "data", "out.txt")
+		var staged []os.DirEntry
+		r := readerFunc(func(p []byte) (int, error) {
+			staged, _ = os.ReadDir(tmp)
+			return 0, io.EOF
+		})
+		if err := WriteFileAtomic(dest, r); err != nil {
+			t.Fatalf("WriteFileAtomic() error = %v", err)
+		}
+		if len(staged) != 1 {
+			t.Errorf("tmp_dir held %d files during the write, want the staged one", len(staged))
+		}
+		if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+			t.Errorf("tmp_dir has %d leftover files, want 0", len(entries))
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(dest)); len(entries) != 1 {
+			t.Errorf("target dir has %d entries, want just the target", len(entries))
+		}
+	})
+
+	t.Run("concurrent writes use separate temp files", func(t *testing.T) {
+		SetScratchDir("")
+		dest := filepath.Join(t.TempDir(), "out.txt")
+		a, err := createTemp(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer a.Close()
+		b, err := createTemp(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+		if a.Name() == b.Name() {
+			t.Errorf("both writes staged in %s", a.Name())
+		}
+		if !strings.HasPrefix(filepath.Base(a.Name()), ".out.txt.") {
+			t.Errorf("temp file %s should be hidden and named after the target", a.Name())
+		}
+	})
+
+	t.Run("stages in scratch dir when configured", func(t *testing.T) {
+		scratch := t.TempDir()
+		SetScratchDir(scratch)
+		defer SetScratchDir("")
+
+		dest := filepath.Join(t.TempDir(), "out.txt")
+		if err := WriteFileAtomic(dest, strings.NewReader("data")); err != nil {
+			t.Fatalf("WriteFileAtomic() error = %v", err)
+		}
+		if got, _ := os.ReadFile(dest); string(got) != "data" {
+			t.Errorf("content = %q, want %q", got, "data")
+		}
+		entries, _ := os.ReadDir(filepath.Join(scratch, "tmp"))
+		if len(entries) != 0 {
+			t.Errorf("scratch tmp dir has %d leftover files, want 0", len(entries))
+		}
+	})
+
+	t.Run("gives the target a regular file's mode", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("no permission bits on Windows")
+		}
+		SetScratchDir("")
+		dir := t.TempDir()
+		fresh, kept := filepath.Join(dir, "new.txt"), filepath.Join(dir, "kept.txt")
+		if err := os.WriteFile(kept, []byte("old"), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		os.Chmod(kept, 0o640)
+		for dest, want := range map[string]os.FileMode{fresh: 0o666 &^ os.FileMode(umask), kept: 0o640} {
+			if err := WriteFileAtomic(dest, strings.NewReader("data")); err != nil {
+				t.Fatal(err)
+			}
+			if fi, err := os.Stat(dest); err != nil || fi.Mode().Perm() != want {
+				t.Errorf("%s has mode %v, want %v", filepath.Base(dest), fi.Mode().Perm(), want)
+			}
+		}
+	})
+}
+
+func TestCacheDir(t *testing.T) {
+	t.Run("scratch dir takes precedence", func(t *testing.T) {
+		SetScratchDir("/scratch")
+		defer SetScratchDir("")
+		t.Setenv("XDG_CACHE_HOME", "/xdg")
+
+		if got, want := CacheDir(), filepath.Join("/scratch", "cache"); got != want {
+			t.Errorf("CacheDir() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("XDG_CACHE_HOME", func(t *testing.T) {
+		SetScratchDir("")
+		t.Setenv("XDG_CACHE_HOME", "/xdg")
+
+		if got, want := CacheDir(), filepath.Join("/xdg", "datum"); got != want {
+			t.Errorf("CacheDir() = %q, want %q", got, want)
+		}
+	})
+}
+
+// readerFunc adapts a function to io.Reader.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
@@ -0,0 +1,31 @@
+package fsutil
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// lookupUID resolves a user name or numeric ID.
+func lookupUID(owner string) (int, error) {
+	if id, err := strconv.Atoi(owner); err == nil {
+		return id, nil
+	}
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return -1, fmt.Errorf("owner %q: %w", owner, err)
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGID resolves a group name or numeric ID.
+func lookupGID(group string) (int, error) {
+	if id, err := strconv.Atoi(group); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return -1, fmt.Errorf("group %q: %w", group, err)
+	}
+	return strconv.Atoi(g.Gid)
+}
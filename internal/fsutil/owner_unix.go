@@ -0,0 +1,60 @@
+//go:build !windows
+
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// SetOwnership gives path the configured owner and group (names or numeric
+// IDs; empty leaves that part alone).
+//
+// Without a group, path follows its directory's setgid bit: shared data roots
+// are usually setgid directories owned by the analysis group, and files created
+// there inherit that group - but a file staged elsewhere (a scratch directory)
+// and renamed in keeps the group it was created with, so it is fixed up here.
+// Whenever a group applies, the file is also made group-readable.
+//
+// Changing the owner needs root; changing the group needs root or membership
+// of that group. The error says so rather than just "operation not permitted".
+func SetOwnership(path, owner, group string) error {
+	uid, gid := -1, -1
+	var err error
+	if owner != "" {
+		if uid, err = lookupUID(owner); err != nil {
+			return err
+		}
+	}
+	if group != "" {
+		if gid, err = lookupGID(group); err != nil {
+			return err
+		}
+	} else if dir, err := os.Stat(filepath.Dir(path)); err == nil && dir.Mode()&os.ModeSetgid != 0 {
+		if st, ok := dir.Sys().(*syscall.Stat_t); ok {
+			gid = int(st.Gid)
+		}
+	}
+	if uid == -1 && gid == -1 {
+		return nil
+	}
+
+	if err := os.Chown(path, uid, gid); err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("%w (changing the owner needs root; changing the group needs membership of it)", err)
+		}
+		return err
+	}
+	if gid != -1 {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if fi.Mode().Perm()&0o040 == 0 {
+			return os.Chmod(path, fi.Mode().Perm()|0o040)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+//go:build !windows
+
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func ownerOf(t *testing.T, path string) (uid, gid uint32, perm os.FileMode) {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	return st.Uid, st.Gid, fi.Mode().Perm()
+}
+
+func TestSetOwnership(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.csv")
+	if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing configured and no setgid directory: nothing changes
+	uid, gid, _ := ownerOf(t, path)
+	if err := SetOwnership(path, "", ""); err != nil {
+		t.Fatalf("SetOwnership(no settings) = %v", err)
+	}
+	if u, g, _ := ownerOf(t, path); u != uid || g != gid {
+		t.Errorf("owner changed to %d:%d without settings", u, g)
+	}
+
+	if err := SetOwnership(path, "", "no-such-group-datum-test"); err == nil {
+		t.Error("SetOwnership(unknown group) succeeded")
+	}
+
+	if os.Geteuid() != 0 {
+		t.Skip("changing ownership needs root")
+	}
+	if err := SetOwnership(path, "4242", "4343"); err != nil {
+		t.Fatal(err)
+	}
+	if u, g, perm := ownerOf(t, path); u != 4242 || g != 4343 || perm&0o040 == 0 {
+		t.Errorf("got %d:%d %v, want 4242:4343 and group-readable", u, g, perm)
+	}
+}
+
+func TestSetOwnership_SetgidDir(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing ownership needs root")
+	}
+	shared := filepath.Join(t.TempDir(), "shared")
+	if err := os.Mkdir(shared, 0o775); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(shared, -1, 5151); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(shared, 0o775|os.ModeSetgid); err != nil {
+		t.Fatal(err)
+	}
+
+	// Staged outside the directory and renamed in, so it kept its own group
+	staged := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(staged, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(shared, "data.csv")
+	if err := os.Rename(staged, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetOwnership(path, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, g, perm := ownerOf(t, path); g != 5151 || perm&0o040 == 0 {
+		t.Errorf("got group %d %v, want the directory's group 5151 and group-readable", g, perm)
+	}
+}
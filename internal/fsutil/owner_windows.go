@@ -0,0 +1,14 @@
+//go:build windows
+
+package fsutil
+
+import "errors"
+
+// SetOwnership is not supported on Windows, where file access is governed by
+// ACLs inherited from the directory. Without an owner or group it does nothing.
+func SetOwnership(path, owner, group string) error {
+	if owner == "" && group == "" {
+		return nil
+	}
+	return errors.New("owner/group are not supported on Windows (use directory ACLs)")
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package fsutil
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive reports whether a process with this PID is running.
+//
+// Go learning note: signal 0 is never delivered; kill only checks that the
+// process exists. EPERM means it exists but belongs to another user.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
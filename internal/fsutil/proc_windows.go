@@ -0,0 +1,25 @@
+//go:build windows
+
+package fsutil
+
+import (
+	"errors"
+	"syscall"
+)
+
+// stillActive is the exit code Windows reports for a running process.
+const stillActive = 259
+
+// processAlive reports whether a process with this PID is running.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return errors.Is(err, syscall.ERROR_ACCESS_DENIED) // Exists, but not ours
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
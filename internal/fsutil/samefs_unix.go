@@ -0,0 +1,24 @@
+//go:build !windows
+
+package fsutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// sameFilesystem reports whether directories a and b are on the same
+// filesystem (device), so a file can be renamed from one to the other.
+func sameFilesystem(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	as, ok1 := ai.Sys().(*syscall.Stat_t)
+	bs, ok2 := bi.Sys().(*syscall.Stat_t)
+	return ok1 && ok2 && as.Dev == bs.Dev
+}
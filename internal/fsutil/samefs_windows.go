@@ -0,0 +1,16 @@
+//go:build windows
+
+package fsutil
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// sameFilesystem reports whether directories a and b are on the same volume,
+// so a file can be renamed from one to the other.
+func sameFilesystem(a, b string) bool {
+	aa, err1 := filepath.Abs(a)
+	ba, err2 := filepath.Abs(b)
+	return err1 == nil && err2 == nil && strings.EqualFold(filepath.VolumeName(aa), filepath.VolumeName(ba))
+}
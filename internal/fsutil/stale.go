@@ -0,0 +1,95 @@
+package fsutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Temp files and directories are named "<name>.datum-<pid>-<random>.tmp", so
+// a later run can tell whose they are. A run that crashes (or is killed) can't
+// clean up after itself; CleanStaleTemps removes what it left behind once the
+// process that created it is gone.
+
+// tempPattern is the os.CreateTemp / os.MkdirTemp pattern for a temp file
+// named after name and owned by this process.
+func tempPattern(name string) string {
+	return fmt.Sprintf("%s.datum-%d-*.tmp", name, os.Getpid())
+}
+
+// StagingPath returns a path next to dest, named like the temp files, where
+// dest's new content can be prepared before it replaces dest. The path isn't
+// created; it is unique per target and process.
+func StagingPath(dest string) string {
+	name := fmt.Sprintf(".%s.datum-%d-staging.tmp", filepath.Base(dest), os.Getpid())
+	return filepath.Join(filepath.Dir(dest), name)
+}
+
+// PartialPath returns where an interrupted download of dest is kept, so a
+// later run can resume it instead of starting over. Like a temp file, it goes
+// in the tmp_dir or scratch directory if one is on dest's filesystem (named
+// after dest's full path there), otherwise next to dest. Unlike a temp file
+// its name carries no PID, so the next run finds it; but when dest is itself
+// a temp file, the name includes dest's, and it's cleaned up along with it.
+func PartialPath(dest string) string {
+	dir, name := filepath.Dir(dest), filepath.Base(dest)
+	for _, d := range stagingDirs() {
+		if err := os.MkdirAll(d, 0o755); err == nil && sameFilesystem(d, dir) {
+			abs, _ := filepath.Abs(dest)
+			sum := sha256.Sum256([]byte(abs))
+			return filepath.Join(d, fmt.Sprintf("%s-%s.datum-partial.tmp", name, hex.EncodeToString(sum[:8])))
+		}
+	}
+	return filepath.Join(dir, fmt.Sprintf(".%s.datum-partial.tmp", name))
+}
+
+// staleTemp matches the names tempPattern produces, capturing the PID.
+var staleTemp = regexp.MustCompile(`\.datum-(\d+)-[^/\\]*\.tmp$`)
+
+// staleTempGrace is how long a temp file must sit untouched before it's
+// removed. The PID only identifies a process on this host, and a directory on
+// a shared filesystem may hold another host's download in progress; that one
+// is still being written to.
+const staleTempGrace = time.Minute
+
+// CleanStaleTemps removes the temp files and directories in dir whose datum
+// process is no longer running, and returns their paths. A missing dir has
+// nothing to clean.
+func CleanStaleTemps(dir string) (removed []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		m := staleTemp.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		pid, err := strconv.Atoi(m[1])
+		if err != nil || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < staleTempGrace {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if err := os.RemoveAll(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// StagingDirs returns the configured directories temp files may be staged
+// in (tmp_dir, then the scratch directory), for cleaning up after crashes.
+func StagingDirs() []string { return stagingDirs() }
@@ -0,0 +1,90 @@
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deadPID returns the PID of a process that has already exited.
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$") // The test binary, running nothing
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestCleanStaleTemps(t *testing.T) {
+	dir := t.TempDir()
+	dead := deadPID(t)
+	old := time.Now().Add(-time.Hour)
+	touch := func(name string, mtime time.Time) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte("partial"), 0o644)
+		os.Chtimes(path, mtime, mtime)
+		return path
+	}
+
+	crashed := touch(fmt.Sprintf(".data.csv.datum-%d-123.tmp", dead), old)
+	crashedDir := filepath.Join(dir, fmt.Sprintf(".tree.datum-%d-456.tmp", dead))
+	os.MkdirAll(filepath.Join(crashedDir, "sub"), 0o755)
+	os.Chtimes(crashedDir, old, old)
+	ours := touch(fmt.Sprintf(".data.csv.datum-%d-789.tmp", os.Getpid()), old)
+	fresh := touch(fmt.Sprintf(".other.csv.datum-%d-1.tmp", dead), time.Now()) // Maybe another host's
+	unrelated := touch("notes.tmp", old)
+
+	removed, err := CleanStaleTemps(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("removed %v, want the crashed run's file and directory", removed)
+	}
+	for _, gone := range []string{crashed, crashedDir} {
+		if _, err := os.Stat(gone); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", gone)
+		}
+	}
+	for _, kept := range []string{ours, fresh, unrelated} {
+		if _, err := os.Stat(kept); err != nil {
+			t.Errorf("%s was removed", kept)
+		}
+	}
+
+	if removed, err := CleanStaleTemps(filepath.Join(dir, "missing")); err != nil || len(removed) != 0 {
+		t.Errorf("missing dir: %v, %v", removed, err)
+	}
+}
+
+func TestTempNames(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "out.csv")
+	f, err := createTemp(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, name := range []string{filepath.Base(f.Name()), filepath.Base(StagingPath(dest))} {
+		m := staleTemp.FindStringSubmatch(name)
+		if m == nil || m[1] != fmt.Sprint(os.Getpid()) || !strings.HasPrefix(name, ".out.csv.") {
+			t.Errorf("temp name %q doesn't follow the scheme", name)
+		}
+	}
+}
+
+func TestPartialPath(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "out.csv")
+	partial := PartialPath(dest)
+	if filepath.Dir(partial) != filepath.Dir(dest) || staleTemp.MatchString(filepath.Base(partial)) {
+		t.Errorf("PartialPath(%q) = %q, want a name next to it that outlives the process", dest, partial)
+	}
+	// A partial download of a temp file goes when the temp file does
+	if staging := StagingPath(dest); !staleTemp.MatchString(filepath.Base(PartialPath(staging))) {
+		t.Errorf("PartialPath(%q) = %q, want a name CleanStaleTemps removes", staging, PartialPath(staging))
+	}
+}
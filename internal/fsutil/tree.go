@@ -0,0 +1,99 @@
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// CopyTree mirrors the directory src at dest: afterwards dest holds exactly
+// src's files, directories and symlinks (with their permission bits), and
+// nothing else.
+//
+// Like WriteFileAtomic, dest is never left half-written: the copy is built in
+// a sibling directory and swapped in with ReplaceDir at the end. Files that
+// aren't regular files, directories or symlinks (sockets, devices) are skipped.
+func CopyTree(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dest), tempPattern("."+filepath.Base(dest)))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp) // Gone after a successful ReplaceDir anyway
+
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		out := filepath.Join(tmp, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(out, info.Mode().Perm()|0o700) // Owner needs to write into it while copying
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, out)
+		case d.Type().IsRegular():
+			if err := copyFile(path, out); err != nil {
+				return err
+			}
+			return os.Chmod(out, info.Mode().Perm())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, dirMode(src)); err != nil {
+		return err
+	}
+	return ReplaceDir(tmp, dest)
+}
+
+// dirMode returns the permission bits of the directory at path (0755 if it
+// can't be stat'ed).
+func dirMode(path string) fs.FileMode {
+	if fi, err := os.Stat(path); err == nil {
+		return fi.Mode().Perm()
+	}
+	return 0o755
+}
+
+// ReplaceDir moves the directory src to dest, replacing whatever is there.
+//
+// A rename can't replace a non-empty directory, so an existing dest is first
+// renamed aside, then removed once src is in place. If installing src fails,
+// the old dest is put back.
+func ReplaceDir(src, dest string) error {
+	old := ""
+	if _, err := os.Lstat(dest); err == nil {
+		old = dest + ".old"
+		os.RemoveAll(old) // Left over from an interrupted run
+		if err := os.Rename(dest, old); err != nil {
+			return fmt.Errorf("move %s aside: %w", dest, err)
+		}
+	}
+	if err := os.Rename(src, dest); err != nil {
+		if old != "" {
+			os.Rename(old, dest)
+		}
+		return err
+	}
+	if old != "" {
+		return os.RemoveAll(old)
+	}
+	return nil
+}
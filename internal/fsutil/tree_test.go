@@ -0,0 +1,62 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCopyTree(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	os.MkdirAll(filepath.Join(src, "sub", "empty"), 0o755)
+	os.WriteFile(filepath.Join(src, "a.csv"), []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(src, "sub", "b.sh"), []byte("#!/bin/sh"), 0o755)
+	if runtime.GOOS != "windows" {
+		os.Symlink("a.csv", filepath.Join(src, "link"))
+	}
+
+	dest := filepath.Join(t.TempDir(), "out", "dest")
+	// A stale file in dest must not survive the mirror
+	os.MkdirAll(dest, 0o755)
+	os.WriteFile(filepath.Join(dest, "stale.txt"), []byte("old"), 0o644)
+
+	if err := CopyTree(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dest, "sub", "b.sh")); err != nil || string(b) != "#!/bin/sh" {
+		t.Errorf("sub/b.sh = %q, %v", b, err)
+	}
+	if fi, err := os.Stat(filepath.Join(dest, "sub", "b.sh")); runtime.GOOS != "windows" && (err != nil || fi.Mode().Perm() != 0o755) {
+		t.Errorf("sub/b.sh mode = %v, %v; want 0755", fi.Mode(), err)
+	}
+	if fi, err := os.Stat(filepath.Join(dest, "sub", "empty")); err != nil || !fi.IsDir() {
+		t.Errorf("empty directory not mirrored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "stale.txt")); !os.IsNotExist(err) {
+		t.Errorf("stale.txt survived the mirror: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		if target, err := os.Readlink(filepath.Join(dest, "link")); err != nil || target != "a.csv" {
+			t.Errorf("link -> %q, %v; want a.csv", target, err)
+		}
+	}
+	// No temp or aside directories left behind
+	if entries, _ := os.ReadDir(filepath.Dir(dest)); len(entries) != 1 {
+		t.Errorf("parent holds %d entries, want just dest", len(entries))
+	}
+}
+
+func TestReplaceDir_File(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "new")
+	os.Mkdir(src, 0o755)
+	dest := filepath.Join(dir, "target")
+	os.WriteFile(dest, []byte("a plain file used to be here"), 0o644)
+	if err := ReplaceDir(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(dest); err != nil || !fi.IsDir() {
+		t.Errorf("dest is not a directory: %v", err)
+	}
+}
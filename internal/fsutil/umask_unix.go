@@ -0,0 +1,13 @@
+//go:build !windows
+
+package fsutil
+
+import "syscall"
+
+// umask is the process's file mode creation mask. Reading it means setting
+// it, so that's done once here, before any goroutine could create a file.
+var umask = func() uint32 {
+	m := syscall.Umask(0)
+	syscall.Umask(m)
+	return uint32(m)
+}()
@@ -0,0 +1,7 @@
+//go:build windows
+
+package fsutil
+
+// umask is zero: Windows has none, and only the read-only bit of a mode
+// matters there.
+var umask uint32
@@ -0,0 +1,56 @@
+package fsutil
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Xattrs returns the extended attributes of path that the caller can read,
+// including the SELinux label (security.selinux). A missing file, or a
+// filesystem without extended attributes, has none.
+//
+// Go learning note: the xattr syscalls fill a caller-supplied buffer. Calling
+// them with an empty buffer first returns the size needed, so each value is
+// read with exactly one allocation.
+func Xattrs(path string) (map[string][]byte, error) {
+	n, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+	names := make([]byte, n)
+	if n, err = syscall.Listxattr(path, names); err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+
+	attrs := map[string][]byte{}
+	for _, name := range bytes.Split(names[:n], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		size, err := syscall.Getxattr(path, string(name), nil)
+		if err != nil {
+			continue // removed meanwhile, or not readable by us
+		}
+		value := make([]byte, size)
+		if size, err = syscall.Getxattr(path, string(name), value); err != nil {
+			continue
+		}
+		attrs[string(name)] = value[:size]
+	}
+	return attrs, nil
+}
+
+// SetXattr sets the extended attribute name on path. Names carry their
+// namespace: "user." for anyone, "security." and "trusted." usually need
+// privileges (and an SELinux policy that allows the relabel).
+func SetXattr(path, name string, value []byte) error {
+	if err := syscall.Setxattr(path, name, value, 0); err != nil {
+		return &os.PathError{Op: "setxattr " + name, Path: path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestXattrs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if attrs, err := Xattrs(path); err != nil || len(attrs) != 0 {
+		t.Errorf("Xattrs(missing file) = %v, %v; want none", attrs, err)
+	}
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetXattr(path, "user.origin", []byte("https://example.com/data.csv")); err != nil {
+		t.Skipf("extended attributes unavailable here: %v", err)
+	}
+	if err := SetXattr(path, "user.empty", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	attrs, err := Xattrs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(attrs["user.origin"]); got != "https://example.com/data.csv" {
+		t.Errorf("user.origin = %q", got)
+	}
+	if v, ok := attrs["user.empty"]; !ok || len(v) != 0 {
+		t.Errorf("user.empty = %q, %v; want present and empty", v, ok)
+	}
+	if err := SetXattr(path, "nonamespace", []byte("x")); err == nil {
+		t.Error("SetXattr without a namespace succeeded")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package fsutil
+
+import "errors"
+
+// Xattrs reports no extended attributes: they are only supported on Linux.
+func Xattrs(path string) (map[string][]byte, error) { return nil, nil }
+
+// SetXattr always fails: extended attributes are only supported on Linux.
+func SetXattr(path, name string, value []byte) error {
+	return errors.New("extended attributes are only supported on Linux")
+}
@@ -3,7 +3,13 @@ package command
 import (
 	"context"
 	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/jprybylski/datum/internal/registry"
 	runrt "github.com/jprybylski/datum/internal/runtime"
@@ -18,21 +24,119 @@ func (h *handler) Fingerprint(ctx context.Context, src registry.Source) (string,
 	if strings.TrimSpace(src.FingerprintCmd) == "" {
 		return "", errors.New("command: missing fingerprint_cmd")
 	}
-	cmd := substitute(src.FingerprintCmd, src, "")
-	out, err := runrt.RunShell(ctx, cmd, nil)
+	argv, err := runrt.ShellCommand(src.Shell, substitute(src.FingerprintCmd, src, ""))
+	if err != nil {
+		return "", fmt.Errorf("command: %w", err)
+	}
+	out, err := run(ctx, src, argv, environ(src))
 	return strings.TrimSpace(out), err
 }
 
 func (h *handler) Fetch(ctx context.Context, src registry.Source, dest string) error {
-	if strings.TrimSpace(src.FetchCmd) == "" {
-		return errors.New("command: missing fetch_cmd")
+	if strings.TrimSpace(src.FetchCmd) == "" && len(src.FetchArgs) == 0 {
+		return errors.New("command: missing fetch_cmd or fetch_args")
+	}
+	// Commands typically redirect into {{dest}}, which fails if its directory is missing
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	if src.Workdir != "" {
+		// dest is relative to datum's directory, not the command's
+		abs, err := filepath.Abs(dest)
+		if err != nil {
+			return err
+		}
+		dest = abs
 	}
-	env := []string{"DEST=" + dest}
-	cmd := substitute(src.FetchCmd, src, dest)
-	_, err := runrt.RunShell(ctx, cmd, env)
+	var argv []string
+	if len(src.FetchArgs) > 0 {
+		dest = filepath.FromSlash(dest)
+		for _, arg := range src.FetchArgs {
+			argv = append(argv, substitute(arg, src, dest))
+		}
+	} else {
+		dest = shellPath(src.Shell, dest)
+		var err error
+		if argv, err = runrt.ShellCommand(src.Shell, substitute(src.FetchCmd, src, dest)); err != nil {
+			return fmt.Errorf("command: %w", err)
+		}
+	}
+	env := append(environ(src), "DEST="+dest)
+	_, err := run(ctx, src, argv, env)
 	return err
 }
 
+// shellPath writes path the way shell expects it: with forward slashes for
+// sh and bash, which take backslashes for escapes even on Windows (Git Bash,
+// MSYS), and with the platform's own separator for the others.
+func shellPath(shell, path string) string {
+	if shell == "sh" || shell == "bash" {
+		return filepath.ToSlash(path)
+	}
+	return filepath.FromSlash(path)
+}
+
+// run runs argv in src's workdir, stopping it after src's cmd_timeout.
+// readConfig has checked both.
+func run(ctx context.Context, src registry.Source, argv []string, env []string) (string, error) {
+	if src.CmdTimeout != "" {
+		d, err := time.ParseDuration(src.CmdTimeout)
+		if err != nil {
+			return "", fmt.Errorf("command: cmd_timeout: %w", err)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	dir, err := workdir(src.Workdir)
+	if err != nil {
+		return "", err
+	}
+	out, err := runrt.Run(ctx, dir, argv, env)
+	if err != nil && src.CmdTimeout != "" && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return out, fmt.Errorf("command: timed out after %s: %w", src.CmdTimeout, context.DeadlineExceeded)
+	}
+	return out, err
+}
+
+// workdir checks that the directory commands run in is inside datum's own
+// once symlinks are resolved; readConfig could only check the path as written.
+func workdir(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	base, err := filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("command: workdir: %w", err)
+	}
+	if rel, err := filepath.Rel(base, real); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("command: workdir %s leads outside %s", path, cwd)
+	}
+	return path, nil
+}
+
+// environ lists the variables a command gets on top of datum's own
+// environment: the source's env, then its credentials, which win.
+func environ(src registry.Source) []string {
+	var env []string
+	for _, name := range slices.Sorted(maps.Keys(src.Env)) {
+		env = append(env, name+"="+src.Env[name])
+	}
+	return append(env, src.Credentials.Environ()...)
+}
+
 func substitute(tmpl string, src registry.Source, dest string) string {
 	r := strings.NewReplacer(
 		"{{url}}", src.URL,
@@ -2,11 +2,16 @@ package command
 
 import (
 	"context"
+	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jprybylski/datum/internal/handlertest"
 	"github.com/jprybylski/datum/internal/registry"
 )
 
@@ -218,6 +223,105 @@ func TestHandler_Fetch(t *testing.T) {
 	})
 }
 
+func TestHandler_Workdir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping Unix-specific test on Windows")
+	}
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "tools"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "tools", "data.txt"), []byte("from tools\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(t.TempDir(), filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	h := New()
+	ctx := context.Background()
+	src := registry.Source{Workdir: "tools", FetchCmd: "cp data.txt {{dest}}"}
+	if err := h.Fetch(ctx, src, filepath.Join("out", "data.txt")); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "out", "data.txt")); err != nil || string(b) != "from tools\n" {
+		t.Errorf("dest = %q, %v; want the file copied from the workdir", b, err)
+	}
+
+	src = registry.Source{Workdir: "escape", FingerprintCmd: "pwd"}
+	if _, err := h.Fingerprint(ctx, src); err == nil || !strings.Contains(err.Error(), "outside") {
+		t.Errorf("Fingerprint() in a workdir symlinked elsewhere: error = %v, want it refused", err)
+	}
+}
+
+func TestHandler_CmdTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping Unix-specific test on Windows")
+	}
+	src := registry.Source{CmdTimeout: "100ms", FingerprintCmd: "sleep 5"}
+	start := time.Now()
+	_, err := New().Fingerprint(context.Background(), src)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("Fingerprint() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Fingerprint() took %s, want it stopped after cmd_timeout", elapsed)
+	}
+}
+
+func TestHandler_FetchArgs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping Unix-specific test on Windows")
+	}
+	dest := filepath.Join(t.TempDir(), "out dir", "data.csv")
+	// No shell: the quotes and the redirect reach the program as they are
+	src := registry.Source{FetchArgs: []string{"sh", "-c", `printf '%s' "$1" > "$DEST"`, "sh", `it's "quoted" > here`}}
+	if err := New().Fetch(context.Background(), src, dest); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != `it's "quoted" > here` {
+		t.Errorf("target = %q, want the argument verbatim", got)
+	}
+
+	src = registry.Source{FetchArgs: []string{"cp", "{{url}}", "{{dest}}"}, URL: dest}
+	copied := filepath.Join(t.TempDir(), "copy.csv")
+	if err := New().Fetch(context.Background(), src, copied); err != nil {
+		t.Fatalf("Fetch() with placeholders error = %v", err)
+	}
+	if got, _ := os.ReadFile(copied); string(got) != `it's "quoted" > here` {
+		t.Errorf("copy = %q, want the placeholders substituted", got)
+	}
+}
+
+func TestHandler_Shell(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	src := registry.Source{Shell: "bash", FingerprintCmd: "echo ${BASH_VERSION:+bash}"}
+	if fp, err := New().Fingerprint(context.Background(), src); err != nil || fp != "bash" {
+		t.Errorf("Fingerprint() in bash = %q, %v; want bash", fp, err)
+	}
+	src = registry.Source{Shell: "fish", FingerprintCmd: "echo hi"}
+	if _, err := New().Fingerprint(context.Background(), src); err == nil || !strings.Contains(err.Error(), "unknown shell") {
+		t.Errorf("Fingerprint() in an unknown shell: error = %v", err)
+	}
+}
+
+func TestShellPath(t *testing.T) {
+	path := filepath.Join("data", "raw", "x.csv")
+	if got := shellPath("bash", path); got != "data/raw/x.csv" {
+		t.Errorf("shellPath(bash) = %q, want forward slashes", got)
+	}
+	if got := shellPath("cmd", "data/raw/x.csv"); got != path {
+		t.Errorf("shellPath(cmd) = %q, want %q", got, path)
+	}
+}
+
 func TestSubstitute(t *testing.T) {
 	tests := []struct {
 		name string
@@ -272,3 +376,69 @@ func TestSubstitute(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_Credentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh variable syntax")
+	}
+	t.Setenv("TEAM_A_KEY", "team-a-secret")
+	t.Setenv("DATUM_TEST_AMBIENT", "kept")
+	src := registry.Source{
+		FingerprintCmd: `echo "$API_KEY"`,
+		FetchCmd:       `echo "$API_KEY $DATUM_TEST_AMBIENT" > {{dest}}`,
+		Credentials:    &registry.Credentials{Profile: "team-a", Env: map[string]string{"API_KEY": "TEAM_A_KEY"}},
+	}
+	h := New()
+
+	fp, err := h.Fingerprint(context.Background(), src)
+	if err != nil || fp != "team-a-secret" {
+		t.Errorf("Fingerprint() = %q, %v; want the profile's variable", fp, err)
+	}
+	dest := filepath.Join(t.TempDir(), "out.txt")
+	if err := h.Fetch(context.Background(), src, dest); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(dest); string(b) != "team-a-secret kept\n" {
+		t.Errorf("fetch saw %q; want the profile's variable and the inherited environment", b)
+	}
+}
+
+func TestHandler_Env(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh variable syntax")
+	}
+	t.Setenv("REGION", "ambient")
+	t.Setenv("TEAM_A_KEY", "team-a-secret")
+	src := registry.Source{
+		FingerprintCmd: `echo "$REGION $FORMAT"`,
+		FetchCmd:       `echo "$REGION $API_KEY" > {{dest}}`,
+		Env:            map[string]string{"REGION": "us-east-1", "FORMAT": "csv", "API_KEY": "from-env"},
+		Credentials:    &registry.Credentials{Profile: "team-a", Env: map[string]string{"API_KEY": "TEAM_A_KEY"}},
+	}
+	h := New()
+
+	fp, err := h.Fingerprint(context.Background(), src)
+	if err != nil || fp != "us-east-1 csv" {
+		t.Errorf("Fingerprint() = %q, %v; want the source's env over the ambient one", fp, err)
+	}
+	dest := filepath.Join(t.TempDir(), "out.txt")
+	if err := h.Fetch(context.Background(), src, dest); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(dest); string(b) != "us-east-1 team-a-secret\n" {
+		t.Errorf("fetch saw %q; want the credentials to win over env", b)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fixture commands use POSIX shell redirection")
+	}
+	handlertest.Run(t, New(), handlertest.Fixtures{
+		Valid: []handlertest.Fixture{{
+			Source:  registry.Source{Type: "command", FingerprintCmd: "echo v1", FetchCmd: "printf 'command content' > {{dest}}"},
+			Content: []byte("command content"),
+		}},
+		Invalid: []registry.Source{{Type: "command"}},
+	})
+}
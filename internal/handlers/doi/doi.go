@@ -0,0 +1,524 @@
+// Package doi pins files in research data deposits cited by DOI (type: doi):
+// Zenodo records, Figshare articles and Dryad datasets.
+//
+//	source:
+//	  type: doi
+//	  url: 10.5281/zenodo.1234567    # or doi:..., or https://doi.org/...
+//	  path: measurements.csv         # the file in the deposit (optional if it has one)
+//
+// The DOI is resolved through the doi.org handle API ($DOI_RESOLVER to use
+// another) to the deposit's landing page, which tells which repository holds
+// it; that repository's API then lists the deposit's files with the checksums
+// it recorded on upload. That checksum ("md5:<hex>", or "sha256:<hex>" where
+// the repository keeps one) is the fingerprint, so checking never downloads
+// anything. Fetch downloads from the published URL and refuses content that
+// doesn't match it.
+//
+// Under an allowlist (security.allowed_hosts), every host involved must be
+// on it: the resolver, the repository's API and where the file is
+// downloaded from, redirects included.
+//
+// A version DOI names one immutable upload. A concept DOI (Zenodo's "all
+// versions" DOI) resolves to the newest version, so its fingerprint changes
+// when a new version is published.
+package doi
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// defaultResolver is the DOI foundation's resolver.
+const defaultResolver = "https://doi.org"
+
+// defaultFigshareAPI is Figshare's API, which isn't on the landing page's host.
+const defaultFigshareAPI = "https://api.figshare.com"
+
+type handler struct{ client *http.Client }
+
+// New returns the handler. Like http, its requests draw from
+// httputil.DefaultBudget.
+func New() *handler {
+	return &handler{client: &http.Client{Timeout: 60 * time.Second, Transport: &httputil.BudgetTransport{}}}
+}
+
+func (h *handler) Name() string { return "doi" }
+
+// doiPattern matches a bare DOI: the 10. directory prefix, a registrant code
+// and a suffix.
+var doiPattern = regexp.MustCompile(`^10\.\d{4,9}/\S+$`)
+
+// parseDOI accepts 10.x/y, doi:10.x/y and doi.org URLs, returning the bare DOI.
+func parseDOI(raw string) (string, error) {
+	doi := strings.TrimSpace(raw)
+	for _, prefix := range []string{"doi:", "https://doi.org/", "http://doi.org/", "https://dx.doi.org/", "http://dx.doi.org/"} {
+		if len(doi) >= len(prefix) && strings.EqualFold(doi[:len(prefix)], prefix) {
+			doi = doi[len(prefix):]
+			break
+		}
+	}
+	if unescaped, err := url.PathUnescape(doi); err == nil {
+		doi = unescaped
+	}
+	if !doiPattern.MatchString(doi) {
+		return "", fmt.Errorf("doi: %q is not a DOI like 10.5281/zenodo.1234567", raw)
+	}
+	return doi, nil
+}
+
+// file is one file of a deposit, as its repository's API describes it.
+type file struct {
+	name     string
+	size     int64
+	checksum string // algorithm:hex, e.g. md5:9e107d9d372bb6826bd81d3542a419d6
+	download string
+}
+
+// files resolves src's DOI and lists the deposit's files.
+func (h *handler) files(ctx context.Context, src registry.Source) (doi string, files []file, err error) {
+	if src.URL == "" {
+		return "", nil, errors.New("doi: require source.url (the DOI)")
+	}
+	if doi, err = parseDOI(src.URL); err != nil {
+		return "", nil, err
+	}
+	landing, err := h.resolve(ctx, doi, src.Credentials, src.Hosts)
+	if err != nil {
+		return doi, nil, err
+	}
+	switch repository(doi, landing) {
+	case "zenodo":
+		files, err = h.zenodo(ctx, doi, landing, src.Hosts)
+	case "figshare":
+		files, err = h.figshare(ctx, doi, landing, src.Credentials, src.Hosts)
+	case "dryad":
+		files, err = h.dryad(ctx, doi, landing, src.Hosts)
+	default:
+		return doi, nil, fmt.Errorf("doi: %s resolves to %s, which isn't a repository datum knows (Zenodo, Figshare, Dryad); pin the file's URL with the http handler", doi, landing)
+	}
+	return doi, files, err
+}
+
+// pick returns the file of a deposit that path names, or its only file.
+func pick(doi string, files []file, path string) (file, error) {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" && len(files) == 1 {
+		return files[0], nil
+	}
+	names := make([]string, len(files))
+	for i, f := range files {
+		if f.name == path {
+			return f, nil
+		}
+		names[i] = f.name
+	}
+	if path == "" {
+		return file{}, fmt.Errorf("doi: %s has %d files; set source.path to one of: %s", doi, len(files), strings.Join(names, ", "))
+	}
+	return file{}, fmt.Errorf("doi: no file %s in %s (files: %s)", path, doi, strings.Join(names, ", "))
+}
+
+// Fingerprint is the checksum the repository recorded for the file.
+func (h *handler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	doi, files, err := h.files(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	f, err := pick(doi, files, src.Path)
+	if err != nil {
+		return "", err
+	}
+	if f.checksum == "" {
+		return "", fmt.Errorf("doi: %s records no checksum for %s", doi, f.name)
+	}
+	return f.checksum, nil
+}
+
+// Fetch downloads the file into dest, checking it against the recorded
+// checksum on the way.
+func (h *handler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	doi, files, err := h.files(ctx, src)
+	if err != nil {
+		return err
+	}
+	f, err := pick(doi, files, src.Path)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.download, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.do(req, src.Hosts)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return httputil.NewStatusError(http.MethodGet, f.download, resp)
+	}
+	body, err := verifying(resp.Body, f.checksum, doi+" "+f.name)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(dest, httputil.ProgressReader(body, src.Progress, resp.ContentLength))
+}
+
+// Probe implements registry.Prober for DOIs, listing the deposit's files.
+func (h *handler) Probe(ctx context.Context, location string) (*registry.ProbeResult, error) {
+	doi, err := parseDOI(location)
+	if err != nil {
+		return nil, nil
+	}
+	src := registry.Source{Type: "doi", URL: doi}
+	_, files, err := h.files(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	res := &registry.ProbeResult{
+		Source:       src,
+		Fingerprints: []string{"checksum recorded by the repository (no download needed)"},
+		Specific:     true,
+	}
+	if len(files) == 1 {
+		res.Notes = []string{fmt.Sprintf("one file, %s, %d bytes, %s", files[0].name, files[0].size, files[0].checksum)}
+		return res, nil
+	}
+	res.ToDo = []string{"source.path: one of the deposit's files"}
+	for _, f := range files {
+		res.Notes = append(res.Notes, fmt.Sprintf("file %s, %d bytes", f.name, f.size))
+	}
+	return res, nil
+}
+
+// --- resolution ---
+
+// resolve asks the handle API where doi points.
+func (h *handler) resolve(ctx context.Context, doi string, creds *registry.Credentials, hosts *registry.HostPolicy) (string, error) {
+	resolver := strings.TrimSuffix(firstNonEmpty(creds.Getenv("DOI_RESOLVER"), defaultResolver), "/")
+	var answer struct {
+		ResponseCode int `json:"responseCode"`
+		Values       []struct {
+			Type string `json:"type"`
+			Data struct {
+				Value json.RawMessage `json:"value"`
+			} `json:"data"`
+		} `json:"values"`
+	}
+	if err := h.getJSON(ctx, resolver+"/api/handles/"+escapePath(doi), hosts, &answer); err != nil {
+		var se *httputil.StatusError
+		if errors.As(err, &se) && se.Code == http.StatusNotFound {
+			return "", fmt.Errorf("doi: %s is not registered", doi)
+		}
+		return "", err
+	}
+	for _, v := range answer.Values {
+		var s string
+		if v.Type == "URL" && json.Unmarshal(v.Data.Value, &s) == nil && s != "" {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("doi: %s has no URL registered", doi)
+}
+
+// repository tells which repository holds a deposit, by its landing page's
+// host, or failing that by the DOI prefix the repository registers under.
+func repository(doi, landing string) string {
+	host := ""
+	if u, err := url.Parse(landing); err == nil {
+		host = strings.ToLower(u.Hostname())
+	}
+	for _, name := range []string{"zenodo", "figshare", "dryad"} {
+		if strings.Contains(host, name) {
+			return name
+		}
+	}
+	switch strings.SplitN(doi, "/", 2)[0] {
+	case "10.5281":
+		return "zenodo"
+	case "10.6084":
+		return "figshare"
+	case "10.5061":
+		return "dryad"
+	}
+	return ""
+}
+
+// origin returns the scheme and host of rawURL.
+func origin(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("doi: bad landing page URL %q", rawURL)
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// trailingID is the last run of digits in a path, a record or article ID.
+var trailingID = regexp.MustCompile(`(\d+)/?$`)
+
+// zenodo lists a Zenodo record's files. The landing page is the record
+// (https://zenodo.org/records/123); concept DOIs' pages aren't, and fall
+// back on the ID in the DOI (10.5281/zenodo.123), which the API redirects
+// to the newest version.
+func (h *handler) zenodo(ctx context.Context, doi, landing string, hosts *registry.HostPolicy) ([]file, error) {
+	base, err := origin(landing)
+	if err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(landing)
+	id := ""
+	if m := trailingID.FindStringSubmatch(u.Path); m != nil && strings.Contains(u.Path, "/record") {
+		id = m[1]
+	} else if m := regexp.MustCompile(`zenodo\.(\d+)$`).FindStringSubmatch(doi); m != nil {
+		id = m[1]
+	} else {
+		return nil, fmt.Errorf("doi: can't find the Zenodo record of %s in %s", doi, landing)
+	}
+	var record struct {
+		Files []struct {
+			Key      string `json:"key"`
+			Size     int64  `json:"size"`
+			Checksum string `json:"checksum"`
+			Links    struct {
+				Self string `json:"self"`
+			} `json:"links"`
+		} `json:"files"`
+	}
+	if err := h.getJSON(ctx, base+"/api/records/"+id, hosts, &record); err != nil {
+		return nil, err
+	}
+	files := make([]file, len(record.Files))
+	for i, f := range record.Files {
+		files[i] = file{name: f.Key, size: f.Size, checksum: normalizeChecksum(f.Checksum), download: f.Links.Self}
+	}
+	return files, nil
+}
+
+// figshare lists a Figshare article's files, at the version the DOI names
+// (10.6084/m9.figshare.123.v2) if it names one.
+func (h *handler) figshare(ctx context.Context, doi, landing string, creds *registry.Credentials, hosts *registry.HostPolicy) ([]file, error) {
+	api := strings.TrimSuffix(firstNonEmpty(creds.Getenv("FIGSHARE_API"), defaultFigshareAPI), "/")
+	path := ""
+	if m := regexp.MustCompile(`figshare\.(\d+)(?:\.v(\d+))?$`).FindStringSubmatch(doi); m != nil {
+		path = "/v2/articles/" + m[1]
+		if m[2] != "" {
+			path += "/versions/" + m[2]
+		}
+	} else if m := regexp.MustCompile(`/articles/(?:.*/)?(\d+)(?:/(\d+))?/?$`).FindStringSubmatch(landing); m != nil {
+		// Institutional portals mint their own DOIs; their landing pages end
+		// in the article ID and version
+		path = "/v2/articles/" + m[1]
+		if m[2] != "" {
+			path += "/versions/" + m[2]
+		}
+	} else {
+		return nil, fmt.Errorf("doi: can't find the Figshare article of %s in %s", doi, landing)
+	}
+	var article struct {
+		Files []struct {
+			Name        string `json:"name"`
+			Size        int64  `json:"size"`
+			ComputedMD5 string `json:"computed_md5"`
+			DownloadURL string `json:"download_url"`
+		} `json:"files"`
+	}
+	if err := h.getJSON(ctx, api+path, hosts, &article); err != nil {
+		return nil, err
+	}
+	files := make([]file, len(article.Files))
+	for i, f := range article.Files {
+		files[i] = file{name: f.Name, size: f.Size, download: f.DownloadURL}
+		if f.ComputedMD5 != "" {
+			files[i].checksum = "md5:" + strings.ToLower(f.ComputedMD5)
+		}
+	}
+	return files, nil
+}
+
+// dryad lists the files of a Dryad dataset's latest version, following the
+// API's pages.
+func (h *handler) dryad(ctx context.Context, doi, landing string, hosts *registry.HostPolicy) ([]file, error) {
+	base, err := origin(landing)
+	if err != nil {
+		return nil, err
+	}
+	type link struct {
+		Href string `json:"href"`
+	}
+	var dataset struct {
+		Links struct {
+			Version link `json:"stash:version"`
+		} `json:"_links"`
+	}
+	if err := h.getJSON(ctx, base+"/api/v2/datasets/"+url.PathEscape("doi:"+doi), hosts, &dataset); err != nil {
+		return nil, err
+	}
+	if dataset.Links.Version.Href == "" {
+		return nil, fmt.Errorf("doi: Dryad has no published version of %s", doi)
+	}
+	var files []file
+	for next := dataset.Links.Version.Href + "/files"; next != ""; {
+		var page struct {
+			Links struct {
+				Next link `json:"next"`
+			} `json:"_links"`
+			Embedded struct {
+				Files []struct {
+					Path       string `json:"path"`
+					Size       int64  `json:"size"`
+					Digest     string `json:"digest"`
+					DigestType string `json:"digestType"`
+					Links      struct {
+						Download link `json:"stash:download"`
+					} `json:"_links"`
+				} `json:"stash:files"`
+			} `json:"_embedded"`
+		}
+		if err := h.getJSON(ctx, base+next, hosts, &page); err != nil {
+			return nil, err
+		}
+		for _, f := range page.Embedded.Files {
+			fl := file{name: f.Path, size: f.Size, download: base + f.Links.Download.Href}
+			if f.Digest != "" {
+				fl.checksum = normalizeChecksum(f.DigestType + ":" + f.Digest)
+			}
+			files = append(files, fl)
+		}
+		next = page.Links.Next.Href
+	}
+	return files, nil
+}
+
+// --- helpers ---
+
+// getJSON GETs rawURL and decodes the JSON answer into v.
+func (h *handler) getJSON(ctx context.Context, rawURL string, hosts *registry.HostPolicy, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := h.do(req, hosts)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return httputil.NewStatusError(http.MethodGet, rawURL, resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("doi: %s: %w", rawURL, err)
+	}
+	return nil
+}
+
+// do sends req, refusing to when its host, or one it's redirected to, isn't
+// allowed by hosts.
+func (h *handler) do(req *http.Request, hosts *registry.HostPolicy) (*http.Response, error) {
+	if !hosts.Allows(req.URL.Hostname()) {
+		return nil, fmt.Errorf("doi: %s isn't among the allowed hosts", req.URL.Hostname())
+	}
+	if hosts == nil {
+		return h.client.Do(req)
+	}
+	c := *h.client
+	c.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !hosts.Allows(next.URL.Hostname()) {
+			return fmt.Errorf("redirected to %s, which isn't among the allowed hosts", next.URL.Hostname())
+		}
+		return nil
+	}
+	return c.Do(req)
+}
+
+// normalizeChecksum turns the repositories' spellings ("MD5:AB..",
+// "sha-256:..") into datum's (md5:ab.., sha256:...).
+func normalizeChecksum(s string) string {
+	algo, sum, ok := strings.Cut(s, ":")
+	if !ok || sum == "" {
+		return ""
+	}
+	algo = strings.ReplaceAll(strings.ToLower(algo), "-", "")
+	return algo + ":" + strings.ToLower(sum)
+}
+
+// verifying wraps r so that reading it to the end fails if the content
+// doesn't match checksum, which keeps WriteFileAtomic from installing it.
+func verifying(r io.Reader, checksum, what string) (io.Reader, error) {
+	algo, want, _ := strings.Cut(checksum, ":")
+	var h hash.Hash
+	switch algo {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("doi: %s: can't verify checksum %q", what, checksum)
+	}
+	return &verifyingReader{r: io.TeeReader(r, h), h: h, want: want, what: what}, nil
+}
+
+type verifyingReader struct {
+	r    io.Reader
+	h    hash.Hash
+	want string
+	what string
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	if err == io.EOF {
+		if got := hex.EncodeToString(v.h.Sum(nil)); got != v.want {
+			return n, fmt.Errorf("doi: %s: downloaded content has checksum %s, the repository records %s", v.what, got, v.want)
+		}
+	}
+	return n, err
+}
+
+// escapePath escapes each segment of a path.
+func escapePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	return strings.Join(segs, "/")
+}
+
+// firstNonEmpty returns the first non-empty string.
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func init() {
+	registry.Register(New())
+}
@@ -0,0 +1,220 @@
+package doi
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/handlertest"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// fakeRepos serves the handle API and one deposit in each repository:
+//
+//	10.5281/zenodo.11       -> a Zenodo record with two files
+//	10.6084/m9.figshare.22.v3 -> a Figshare article with one file
+//	10.5061/dryad.abc       -> a Dryad dataset whose files span two pages
+//	10.5281/zenodo.99       -> a Zenodo record whose file is served corrupted
+//
+// It points DOI_RESOLVER and FIGSHARE_API at itself for the test.
+func fakeRepos(t *testing.T) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	landings := map[string]string{
+		"10.5281/zenodo.11":         "/records/11",
+		"10.5281/zenodo.99":         "/records/99",
+		"10.6084/m9.figshare.22.v3": "/articles/dataset/Counts/22/3",
+		"10.5061/dryad.abc":         "/stash/dataset/doi:10.5061/dryad.abc",
+		"10.1234/elsewhere":         "https://journal.example.org/article/1",
+	}
+	mux.HandleFunc("/api/handles/", func(w http.ResponseWriter, r *http.Request) {
+		landing, ok := landings[strings.TrimPrefix(r.URL.Path, "/api/handles/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"responseCode":100}`)
+			return
+		}
+		if strings.HasPrefix(landing, "/") {
+			landing = server.URL + landing
+		}
+		fmt.Fprintf(w, `{"responseCode":1,"values":[{"type":"HS_ADMIN","data":{"value":{"index":200}}},{"type":"URL","data":{"value":%q}}]}`, landing)
+	})
+	writeJSON := func(w http.ResponseWriter, v any) { json.NewEncoder(w).Encode(v) }
+	mux.HandleFunc("/api/records/11", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"files": []any{
+			map[string]any{"key": "a.csv", "size": 5, "checksum": "md5:" + md5Hex("a,b\n1"), "links": map[string]any{"self": server.URL + "/content/a.csv"}},
+			map[string]any{"key": "readme.txt", "size": 6, "checksum": "md5:" + md5Hex("readme"), "links": map[string]any{"self": server.URL + "/content/readme.txt"}},
+		}})
+	})
+	mux.HandleFunc("/api/records/99", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"files": []any{
+			map[string]any{"key": "a.csv", "size": 5, "checksum": "md5:" + md5Hex("something else"), "links": map[string]any{"self": server.URL + "/content/a.csv"}},
+		}})
+	})
+	mux.HandleFunc("/v2/articles/22/versions/3", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"files": []any{
+			map[string]any{"name": "counts.tsv", "size": 6, "computed_md5": strings.ToUpper(md5Hex("counts")), "download_url": server.URL + "/content/counts.tsv"},
+		}})
+	})
+	mux.HandleFunc("/api/v2/datasets/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/datasets/doi:10.5061/dryad.abc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]any{"_links": map[string]any{"stash:version": map[string]any{"href": "/api/v2/versions/7"}}})
+	})
+	mux.HandleFunc("/api/v2/versions/7/files", func(w http.ResponseWriter, r *http.Request) {
+		page := map[string]any{"_embedded": map[string]any{"stash:files": []any{
+			map[string]any{"path": "one.csv", "size": 3, "digest": md5Hex("one"), "digestType": "md5", "_links": map[string]any{"stash:download": map[string]any{"href": "/content/one.csv"}}},
+		}}, "_links": map[string]any{"next": map[string]any{"href": "/api/v2/versions/7/files?page=2"}}}
+		if r.URL.Query().Get("page") == "2" {
+			page = map[string]any{"_embedded": map[string]any{"stash:files": []any{
+				map[string]any{"path": "two.csv", "size": 3, "digest": sha256Hex("two"), "digestType": "sha-256", "_links": map[string]any{"stash:download": map[string]any{"href": "/content/two.csv"}}},
+			}}}
+		}
+		writeJSON(w, page)
+	})
+	contents := map[string]string{"a.csv": "a,b\n1", "readme.txt": "readme", "counts.tsv": "counts", "one.csv": "one", "two.csv": "two"}
+	mux.HandleFunc("/content/", func(w http.ResponseWriter, r *http.Request) {
+		content, ok := contents[strings.TrimPrefix(r.URL.Path, "/content/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, content)
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	t.Setenv("DOI_RESOLVER", server.URL)
+	t.Setenv("FIGSHARE_API", server.URL)
+	return server
+}
+
+func TestParseDOI(t *testing.T) {
+	for _, raw := range []string{"10.5281/zenodo.11", "doi:10.5281/zenodo.11", "https://doi.org/10.5281/zenodo.11", "DOI:10.5281%2Fzenodo.11", " http://dx.doi.org/10.5281/zenodo.11 "} {
+		if doi, err := parseDOI(raw); err != nil || doi != "10.5281/zenodo.11" {
+			t.Errorf("parseDOI(%q) = %q, %v", raw, doi, err)
+		}
+	}
+	for _, raw := range []string{"", "zenodo.11", "11.5281/zenodo.11", "https://zenodo.org/records/11"} {
+		if _, err := parseDOI(raw); err == nil {
+			t.Errorf("parseDOI(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	fakeRepos(t)
+	handlertest.Run(t, New(), handlertest.Fixtures{
+		Valid: []handlertest.Fixture{
+			{Name: "zenodo", Source: registry.Source{Type: "doi", URL: "10.5281/zenodo.11", Path: "a.csv"}, Content: []byte("a,b\n1")},
+			{Name: "figshare", Source: registry.Source{Type: "doi", URL: "https://doi.org/10.6084/m9.figshare.22.v3"}, Content: []byte("counts")},
+			{Name: "dryad", Source: registry.Source{Type: "doi", URL: "doi:10.5061/dryad.abc", Path: "two.csv"}, Content: []byte("two")},
+		},
+		Invalid: []registry.Source{{Type: "doi"}, {Type: "doi", URL: "not-a-doi"}},
+	})
+}
+
+func TestFingerprint(t *testing.T) {
+	ctx := context.Background()
+	fakeRepos(t)
+
+	tests := []struct{ doi, path, want string }{
+		{"10.5281/zenodo.11", "readme.txt", "md5:" + md5Hex("readme")},
+		{"10.6084/m9.figshare.22.v3", "", "md5:" + md5Hex("counts")},
+		{"10.5061/dryad.abc", "one.csv", "md5:" + md5Hex("one")},
+		{"10.5061/dryad.abc", "two.csv", "sha256:" + sha256Hex("two")},
+	}
+	for _, tt := range tests {
+		fp, err := New().Fingerprint(ctx, registry.Source{URL: tt.doi, Path: tt.path})
+		if err != nil || fp != tt.want {
+			t.Errorf("Fingerprint(%s %s) = %q, %v; want %q", tt.doi, tt.path, fp, err, tt.want)
+		}
+	}
+
+	errs := []struct{ doi, path, want string }{
+		{"10.5281/zenodo.11", "", "set source.path to one of: a.csv, readme.txt"},
+		{"10.5281/zenodo.11", "b.csv", "no file b.csv"},
+		{"10.5281/zenodo.404", "", "not registered"},
+		{"10.1234/elsewhere", "", "isn't a repository datum knows"},
+	}
+	for _, tt := range errs {
+		_, err := New().Fingerprint(ctx, registry.Source{URL: tt.doi, Path: tt.path})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Fingerprint(%s %s) error = %v, want %q", tt.doi, tt.path, err, tt.want)
+		}
+	}
+}
+
+func TestFetchVerifies(t *testing.T) {
+	fakeRepos(t)
+	dest := filepath.Join(t.TempDir(), "a.csv")
+	err := New().Fetch(context.Background(), registry.Source{URL: "10.5281/zenodo.99"}, dest)
+	if err == nil || !strings.Contains(err.Error(), "the repository records") {
+		t.Fatalf("Fetch() of corrupted content: error = %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("corrupted content was written to the target")
+	}
+}
+
+func TestAllowedHosts(t *testing.T) {
+	server := fakeRepos(t)
+	u, _ := url.Parse(server.URL)
+	host := u.Hostname()
+
+	src := registry.Source{URL: "10.5281/zenodo.11", Path: "a.csv", Hosts: &registry.HostPolicy{Lists: [][]string{{"doi.org"}}}}
+	if _, err := New().Fingerprint(context.Background(), src); err == nil || !strings.Contains(err.Error(), "allowed hosts") {
+		t.Errorf("Fingerprint() through a resolver not allowed: error = %v", err)
+	}
+	src.Hosts = &registry.HostPolicy{Lists: [][]string{{host}}}
+	if _, err := New().Fingerprint(context.Background(), src); err != nil {
+		t.Errorf("Fingerprint() with every host allowed: %v", err)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	ctx := context.Background()
+	fakeRepos(t)
+
+	res, err := New().Probe(ctx, "https://doi.org/10.5281/zenodo.11")
+	if err != nil || res == nil || !res.Specific || res.Source.URL != "10.5281/zenodo.11" || len(res.ToDo) != 1 || len(res.Notes) != 2 {
+		t.Errorf("Probe() of a two-file deposit = %+v, %v", res, err)
+	}
+	res, err = New().Probe(ctx, "10.6084/m9.figshare.22.v3")
+	if err != nil || res == nil || len(res.ToDo) != 0 {
+		t.Errorf("Probe() of a one-file deposit = %+v, %v", res, err)
+	}
+	if res, err := New().Probe(ctx, "https://example.org/data.csv"); res != nil || err != nil {
+		t.Errorf("Probe() of a non-DOI = %+v, %v; want nil, nil", res, err)
+	}
+}
+
+func TestNormalizeChecksum(t *testing.T) {
+	for in, want := range map[string]string{"MD5:ABC": "md5:abc", "sha-256:Ff": "sha256:ff", "md5:": "", "nocolon": ""} {
+		if got := normalizeChecksum(in); got != want {
+			t.Errorf("normalizeChecksum(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+// Package dvc fetches data tracked by DVC (type: dvc): it reads a .dvc
+// pointer file and downloads the object it points to from a DVC remote, so
+// a team moving from DVC to datum keeps its existing remote.
+//
+//	source:
+//	  type: dvc
+//	  path: data/train.csv.dvc   # the .dvc file
+//	  url: storage               # optional: a remote named in .dvc/config, or a remote URL
+//
+// Without url the repository's default remote (core.remote) is used, read
+// from .dvc/config and .dvc/config.local in the first directory above the
+// .dvc file that has a .dvc directory. Relative local remotes are taken
+// relative to that .dvc directory, as DVC does.
+//
+// The fingerprint is the md5 the .dvc file records, "md5:<hex>" for a file
+// or "md5:<hex>.dir" for a directory, read without touching the network: it
+// changes when someone runs dvc commit and commits the .dvc file.
+//
+// Fetch reads objects from the remote in DVC 3's layout (files/md5/ab/cdef...)
+// or, for .dvc files DVC 2 wrote, the older one (ab/cdef...), and checks
+// each against its md5 before it's installed. DVC 2 hashed text files with
+// CRLF line endings as if they had LF ones, so for those either md5 is
+// accepted. A directory is fetched whole, file by file from its manifest,
+// and replaces the target at once.
+//
+// Remotes can be local directories, http(s), webdav(s), s3 and gs. S3
+// requests are signed (SigV4) when AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY are set, with the remote's region and endpointurl;
+// gs requests carry GOOGLE_OAUTH_ACCESS_TOKEN as a bearer token when it's
+// set. Otherwise the bucket must be public.
+package dvc
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+type handler struct{ client *http.Client }
+
+// New returns the handler. Like http, its requests draw from
+// httputil.DefaultBudget.
+func New() *handler {
+	return &handler{client: &http.Client{Timeout: 60 * time.Second, Transport: &httputil.BudgetTransport{}}}
+}
+
+func (h *handler) Name() string { return "dvc" }
+
+// Fingerprint is the md5 the .dvc file records for its output.
+func (h *handler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	out, err := readPointer(src.Path)
+	if err != nil {
+		return "", err
+	}
+	return "md5:" + out.MD5, nil
+}
+
+// Fetch downloads the .dvc file's output from the remote to dest.
+func (h *handler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	out, err := readPointer(src.Path)
+	if err != nil {
+		return err
+	}
+	r, err := resolveRemote(src)
+	if err != nil {
+		return err
+	}
+	dvc3 := out.Hash == "md5"
+	if !out.isDir() {
+		rc, size, err := h.open(ctx, r, objectKey(out.MD5, dvc3), src)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		body := verifying(rc, out.MD5, !dvc3, src.Path)
+		return fsutil.WriteFileAtomic(dest, httputil.ProgressReader(body, src.Progress, size))
+	}
+	return h.fetchDir(ctx, r, out, src, dest)
+}
+
+// maxManifestSize bounds the directory manifests read into memory; one
+// listing a million files is still well under it.
+const maxManifestSize = 256 << 20
+
+// dirWorkers is how many of a directory's files are downloaded at once.
+const dirWorkers = 8
+
+// entry is one file in a directory manifest.
+type entry struct {
+	MD5     string `json:"md5"`
+	RelPath string `json:"relpath"`
+}
+
+// fetchDir downloads the directory out from r: its manifest, then each file
+// the manifest lists into a staging directory that then replaces dest.
+func (h *handler) fetchDir(ctx context.Context, r *remote, out *output, src registry.Source, dest string) error {
+	dvc3 := out.Hash == "md5"
+	rc, _, err := h.open(ctx, r, objectKey(out.MD5, dvc3), src)
+	if err != nil {
+		return err
+	}
+	manifest, err := io.ReadAll(io.LimitReader(verifying(rc, strings.TrimSuffix(out.MD5, ".dir"), !dvc3, src.Path), maxManifestSize))
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	var entries []entry
+	if err := json.Unmarshal(manifest, &entries); err != nil {
+		return fmt.Errorf("dvc: bad directory manifest %s: %w", out.MD5, err)
+	}
+	for _, e := range entries {
+		clean := path.Clean(e.RelPath)
+		if !validMD5.MatchString(e.MD5) || strings.HasSuffix(e.MD5, ".dir") ||
+			e.RelPath == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(e.RelPath, `\`) {
+			return fmt.Errorf("dvc: bad entry %q (%s) in directory manifest %s", e.RelPath, e.MD5, out.MD5)
+		}
+	}
+
+	staging := fsutil.StagingPath(dest)
+	os.RemoveAll(staging)
+	if err := os.MkdirAll(staging, 0o755); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		done     atomic.Int64
+		files    atomic.Int64
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	work := make(chan entry)
+	for range min(dirWorkers, max(len(entries), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range work {
+				err := h.fetchEntry(ctx, r, e, dvc3, src, filepath.Join(staging, filepath.FromSlash(e.RelPath)), func(n int) {
+					if src.Progress != nil {
+						src.Progress.Bytes(done.Add(int64(n)), out.Size)
+					}
+				})
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+					continue
+				}
+				if n := files.Add(1); src.Progress != nil {
+					src.Progress.Status(fmt.Sprintf("%d/%d files", n, len(entries)))
+				}
+			}
+		}()
+	}
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- e
+	}
+	close(work)
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		os.RemoveAll(staging)
+		return firstErr
+	}
+	if err := fsutil.ReplaceDir(staging, dest); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+	return nil
+}
+
+// fetchEntry downloads one file of a directory to dest, reporting each read
+// to count.
+func (h *handler) fetchEntry(ctx context.Context, r *remote, e entry, dvc3 bool, src registry.Source, dest string, count func(int)) error {
+	rc, _, err := h.open(ctx, r, objectKey(e.MD5, dvc3), src)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return fsutil.WriteFileAtomic(dest, &countingReader{r: verifying(rc, e.MD5, !dvc3, e.RelPath), count: count})
+}
+
+type countingReader struct {
+	r     io.Reader
+	count func(int)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.count(n)
+	return n, err
+}
+
+// Probe implements registry.Prober for .dvc files on this machine, naming
+// the output they track and the remote it would be read from.
+func (h *handler) Probe(ctx context.Context, location string) (*registry.ProbeResult, error) {
+	if !strings.HasSuffix(location, ".dvc") || strings.Contains(location, "://") {
+		return nil, nil
+	}
+	if fi, err := os.Stat(location); err != nil || !fi.Mode().IsRegular() {
+		return nil, nil
+	}
+	out, err := readPointer(location)
+	if err != nil {
+		return nil, err
+	}
+	src := registry.Source{Type: "dvc", Path: location}
+	res := &registry.ProbeResult{
+		Source:       src,
+		Fingerprints: []string{"md5 recorded in the .dvc file (no download needed)"},
+		Specific:     true,
+	}
+	if out.isDir() {
+		res.Notes = append(res.Notes, fmt.Sprintf("a directory of %d files, %d bytes, checked out by DVC at %s", out.NFiles, out.Size, out.Path))
+	} else {
+		res.Notes = append(res.Notes, fmt.Sprintf("a file, %d bytes, checked out by DVC at %s", out.Size, out.Path))
+	}
+	if r, err := resolveRemote(src); err != nil {
+		res.Notes = append(res.Notes, strings.TrimPrefix(err.Error(), "dvc: "))
+		res.ToDo = []string{"source.url: the DVC remote to read from (a name from .dvc/config, or its URL)"}
+	} else {
+		res.Notes = append(res.Notes, "objects are read from "+r.String())
+	}
+	return res, nil
+}
+
+// verifying wraps r so that reading it to the end fails if the content
+// doesn't have the given md5, which keeps WriteFileAtomic from installing
+// it. With text set, content whose md5 matches once its CRLF line endings
+// are made LF is accepted too, as DVC 2 hashed text files that way.
+func verifying(r io.Reader, want string, text bool, what string) io.Reader {
+	v := &verifyingReader{raw: md5.New(), want: want, what: what}
+	w := io.Writer(v.raw)
+	if text {
+		v.text = &dos2unix{h: md5.New()}
+		w = io.MultiWriter(v.raw, v.text)
+	}
+	v.r = io.TeeReader(r, w)
+	return v
+}
+
+type verifyingReader struct {
+	r    io.Reader
+	raw  hash.Hash
+	text *dos2unix // nil unless CRLF-normalized content may match
+	want string
+	what string
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	if errors.Is(err, io.EOF) {
+		got := hex.EncodeToString(v.raw.Sum(nil))
+		if got != v.want && (v.text == nil || v.text.sum() != v.want) {
+			return n, fmt.Errorf("dvc: %s: downloaded content has md5 %s, the .dvc file records %s", v.what, got, v.want)
+		}
+	}
+	return n, err
+}
+
+// dos2unix hashes what's written to it with every CRLF turned into LF.
+type dos2unix struct {
+	h  hash.Hash
+	cr bool // The last byte written was a CR, not yet hashed
+}
+
+func (d *dos2unix) Write(p []byte) (int, error) {
+	buf := make([]byte, 0, len(p)+1)
+	for _, c := range p {
+		if d.cr && c != '\n' {
+			buf = append(buf, '\r')
+		}
+		d.cr = c == '\r'
+		if !d.cr {
+			buf = append(buf, c)
+		}
+	}
+	d.h.Write(buf)
+	return len(p), nil
+}
+
+// sum returns the md5 of everything written.
+func (d *dos2unix) sum() string {
+	if d.cr {
+		d.h.Write([]byte{'\r'})
+		d.cr = false
+	}
+	return hex.EncodeToString(d.h.Sum(nil))
+}
+
+func init() {
+	registry.Register(New())
+}
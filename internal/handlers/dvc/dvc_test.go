@@ -0,0 +1,189 @@
+package dvc
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/handlertest"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// fakeRepo builds a DVC repository whose default remote is a local
+// directory, with a second remote, "web", serving the same directory over
+// HTTP. It returns the repository's root. Its data directory has .dvc files
+// for:
+//
+//	one.csv      -> a DVC 3 file
+//	legacy.txt   -> a DVC 2 file with CRLF line endings, hashed as LF
+//	images       -> a DVC 3 directory of two files
+//	corrupt.csv  -> a DVC 3 file whose object doesn't match its md5
+//	missing.csv  -> a DVC 3 file never pushed to the remote
+func fakeRepo(t *testing.T) string {
+	t.Helper()
+	tmp := t.TempDir()
+	root, storage := filepath.Join(tmp, "repo"), filepath.Join(tmp, "storage")
+	server := httptest.NewServer(http.FileServer(http.Dir(storage)))
+	t.Cleanup(server.Close)
+
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	object := func(md5, content string, dvc3 bool) {
+		write(filepath.Join(storage, filepath.FromSlash(objectKey(md5, dvc3))), content)
+	}
+	pointer := func(name, md5 string, size int, dvc3 bool) {
+		hash := ""
+		if dvc3 {
+			hash = "\n  hash: md5"
+		}
+		write(filepath.Join(root, "data", name+".dvc"), fmt.Sprintf("outs:\n- md5: %s\n  size: %d%s\n  path: %s\n", md5, size, hash, name))
+	}
+
+	write(filepath.Join(root, ".dvc", "config"), "[core]\n    remote = storage\n['remote \"storage\"']\n    url = ../../storage\n")
+	write(filepath.Join(root, ".dvc", "config.local"), fmt.Sprintf("['remote \"web\"']\n    url = %s  # served over HTTP\n", server.URL))
+
+	object(md5Hex("a,b\n1,2\n"), "a,b\n1,2\n", true)
+	pointer("one.csv", md5Hex("a,b\n1,2\n"), 8, true)
+
+	object(md5Hex("one\ntwo\n"), "one\r\ntwo\r\n", false)
+	pointer("legacy.txt", md5Hex("one\ntwo\n"), 10, false)
+
+	object(md5Hex("cat"), "cat", true)
+	object(md5Hex("dog"), "dog", true)
+	manifest := fmt.Sprintf(`[{"md5": "%s", "relpath": "cat.png"}, {"md5": "%s", "relpath": "sub/dog.png"}]`, md5Hex("cat"), md5Hex("dog"))
+	object(md5Hex(manifest)+".dir", manifest, true)
+	write(filepath.Join(root, "data", "images.dvc"), fmt.Sprintf("outs:\n- md5: %s.dir\n  size: 6\n  nfiles: 2\n  hash: md5\n  path: images\n", md5Hex(manifest)))
+
+	object(md5Hex("right"), "wrong", true)
+	pointer("corrupt.csv", md5Hex("right"), 5, true)
+
+	pointer("missing.csv", md5Hex("never pushed"), 12, true)
+	return root
+}
+
+func TestConformance(t *testing.T) {
+	root := fakeRepo(t)
+	handlertest.Run(t, New(), handlertest.Fixtures{
+		Valid: []handlertest.Fixture{
+			{Name: "local", Source: registry.Source{Type: "dvc", Path: filepath.Join(root, "data", "one.csv.dvc")}, Content: []byte("a,b\n1,2\n")},
+			{Name: "http", Source: registry.Source{Type: "dvc", Path: filepath.Join(root, "data", "one.csv.dvc"), URL: "web"}, Content: []byte("a,b\n1,2\n")},
+			{Name: "legacy", Source: registry.Source{Type: "dvc", Path: filepath.Join(root, "data", "legacy.txt.dvc")}, Content: []byte("one\r\ntwo\r\n")},
+		},
+		Invalid: []registry.Source{{Type: "dvc"}, {Type: "dvc", Path: filepath.Join(root, "data", "nothing.dvc")}},
+	})
+}
+
+func TestFingerprint(t *testing.T) {
+	root := fakeRepo(t)
+	fp, err := New().Fingerprint(context.Background(), registry.Source{Path: filepath.Join(root, "data", "images.dvc")})
+	if err != nil || !strings.HasPrefix(fp, "md5:") || !strings.HasSuffix(fp, ".dir") {
+		t.Errorf("Fingerprint() of a directory = %q, %v", fp, err)
+	}
+
+	bad := filepath.Join(t.TempDir(), "two.dvc")
+	os.WriteFile(bad, []byte("outs:\n- md5: "+md5Hex("a")+"\n  path: a\n- md5: "+md5Hex("b")+"\n  path: b\n"), 0o644)
+	if _, err := New().Fingerprint(context.Background(), registry.Source{Path: bad}); err == nil || !strings.Contains(err.Error(), "tracks 2 outputs") {
+		t.Errorf("Fingerprint() of a .dvc file with two outputs: error = %v", err)
+	}
+}
+
+func TestFetchDirectory(t *testing.T) {
+	root := fakeRepo(t)
+	dest := filepath.Join(t.TempDir(), "images")
+	if err := os.MkdirAll(filepath.Join(dest, "old"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := New().Fetch(context.Background(), registry.Source{Path: filepath.Join(root, "data", "images.dvc"), URL: "web"}, dest); err != nil {
+		t.Fatalf("Fetch() of a directory: %v", err)
+	}
+	for name, want := range map[string]string{"cat.png": "cat", "sub/dog.png": "dog"} {
+		if got, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name))); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "old")); !os.IsNotExist(err) {
+		t.Error("Fetch() of a directory kept what the target held before")
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	root := fakeRepo(t)
+	tests := []struct{ path, url, want string }{
+		{"corrupt.csv.dvc", "", "the .dvc file records"},
+		{"missing.csv.dvc", "web", "was it pushed"},
+		{"one.csv.dvc", "nosuch", `no remote named "nosuch"`},
+		{"one.csv.dvc", "azure://container/path", "azure remotes aren't supported"},
+	}
+	for _, tt := range tests {
+		dest := filepath.Join(t.TempDir(), "out")
+		err := New().Fetch(context.Background(), registry.Source{Path: filepath.Join(root, "data", tt.path), URL: tt.url}, dest)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Fetch(%s, %q) error = %v, want %q", tt.path, tt.url, err, tt.want)
+		}
+		if _, err := os.Stat(dest); !os.IsNotExist(err) {
+			t.Errorf("Fetch(%s, %q) wrote the target", tt.path, tt.url)
+		}
+	}
+
+	// The allowlist applies to remotes from .dvc/config too
+	src := registry.Source{Path: filepath.Join(root, "data", "one.csv.dvc"), URL: "web", Hosts: &registry.HostPolicy{Lists: [][]string{{"example.org"}}}}
+	if err := New().Fetch(context.Background(), src, filepath.Join(t.TempDir(), "out")); err == nil || !strings.Contains(err.Error(), "allowed hosts") {
+		t.Errorf("Fetch() from a host not allowed: error = %v", err)
+	}
+}
+
+func TestS3Object(t *testing.T) {
+	u, _ := url.Parse("s3://bucket/dvc/store/")
+	tests := []struct {
+		opts map[string]string
+		want string
+	}{
+		{nil, "https://bucket.s3.amazonaws.com/dvc/store"},
+		{map[string]string{"region": "eu-west-2"}, "https://bucket.s3.eu-west-2.amazonaws.com/dvc/store"},
+		{map[string]string{"endpointurl": "https://minio.example.org/"}, "https://minio.example.org/bucket/dvc/store"},
+	}
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ACCESS_KEY_ID"} {
+		t.Setenv(name, "")
+	}
+	for _, tt := range tests {
+		if got, sign := s3Object(u, tt.opts, nil); got != tt.want || sign != nil {
+			t.Errorf("s3Object(%v) = %q, %v; want %q unsigned", tt.opts, got, sign, tt.want)
+		}
+	}
+	creds := &registry.Credentials{Env: map[string]string{"AWS_ACCESS_KEY_ID": "TEST_DVC_KEY"}}
+	t.Setenv("TEST_DVC_KEY", "AKID")
+	if _, sign := s3Object(u, nil, creds); sign == nil || sign.Scheme != "sigv4" || sign.Region != "us-east-1" {
+		t.Errorf("s3Object() with credentials signs with %+v", sign)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	root := fakeRepo(t)
+	res, err := New().Probe(context.Background(), filepath.Join(root, "data", "images.dvc"))
+	if err != nil || res == nil || !res.Specific || res.Source.Type != "dvc" || len(res.ToDo) != 0 || !strings.Contains(strings.Join(res.Notes, "\n"), `remote "storage"`) {
+		t.Errorf("Probe() of a .dvc file = %+v, %v", res, err)
+	}
+	if res, err := New().Probe(context.Background(), filepath.Join(root, "data")); res != nil || err != nil {
+		t.Errorf("Probe() of a directory = %+v, %v; want nil, nil", res, err)
+	}
+}
@@ -0,0 +1,158 @@
+package dvc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// output is the one output a .dvc file tracks.
+type output struct {
+	MD5    string `yaml:"md5"`    // Of the file, or "<md5>.dir" for a directory's manifest
+	Size   int64  `yaml:"size"`   // Of the file, or of all the directory's files
+	NFiles int    `yaml:"nfiles"` // In the directory
+	Hash   string `yaml:"hash"`   // "md5" when written by DVC 3; empty for DVC 2's layout
+	Path   string `yaml:"path"`   // Where DVC checks it out, relative to the .dvc file
+}
+
+// validMD5 matches the md5 of a file or, with .dir, of a directory manifest.
+var validMD5 = regexp.MustCompile(`^[0-9a-f]{32}(\.dir)?$`)
+
+// readPointer reads the .dvc file at path, which must track exactly one
+// output.
+func readPointer(path string) (*output, error) {
+	if path == "" {
+		return nil, errors.New("dvc: missing source.path (the .dvc file)")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("dvc: %w", err)
+	}
+	var f struct {
+		Outs []output `yaml:"outs"`
+	}
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("dvc: %s: %w", path, err)
+	}
+	if len(f.Outs) != 1 {
+		return nil, fmt.Errorf("dvc: %s tracks %d outputs; datum pins .dvc files that track exactly one", path, len(f.Outs))
+	}
+	out := &f.Outs[0]
+	out.MD5 = strings.ToLower(out.MD5)
+	if !validMD5.MatchString(out.MD5) {
+		if out.MD5 == "" {
+			return nil, fmt.Errorf("dvc: %s has no md5 for %s; run dvc commit first", path, out.Path)
+		}
+		return nil, fmt.Errorf("dvc: %s has a bad md5 %q", path, out.MD5)
+	}
+	if out.Hash != "" && out.Hash != "md5" {
+		return nil, fmt.Errorf("dvc: %s uses hash %q; only md5 is supported", path, out.Hash)
+	}
+	return out, nil
+}
+
+// isDir reports whether out is a directory, whose md5 is that of its manifest.
+func (out *output) isDir() bool { return strings.HasSuffix(out.MD5, ".dir") }
+
+// objectKey returns where the object with the given md5 lives under a
+// remote: files/md5/ab/cdef... for DVC 3 outputs, ab/cdef... for DVC 2's.
+func objectKey(md5 string, dvc3 bool) string {
+	key := md5[:2] + "/" + md5[2:]
+	if dvc3 {
+		key = "files/md5/" + key
+	}
+	return key
+}
+
+// repoConfig is a DVC repository's configuration: .dvc/config with
+// .dvc/config.local over it, by section ("core", `remote "storage"`) and key.
+type repoConfig struct {
+	dir      string // The .dvc directory, which relative remote paths are relative to
+	sections map[string]map[string]string
+}
+
+// findConfig looks for the DVC repository the .dvc file at path belongs to,
+// walking up from its directory to the first one with a .dvc directory.
+// It returns nil if there is none.
+func findConfig(path string) (*repoConfig, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		dvcDir := filepath.Join(dir, ".dvc")
+		if fi, err := os.Stat(dvcDir); err == nil && fi.IsDir() {
+			c := &repoConfig{dir: dvcDir, sections: map[string]map[string]string{}}
+			for _, name := range []string{"config", "config.local"} {
+				b, err := os.ReadFile(filepath.Join(dvcDir, name))
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("dvc: %w", err)
+				}
+				c.parse(b)
+			}
+			return c, nil
+		}
+		if filepath.Dir(dir) == dir {
+			return nil, nil
+		}
+	}
+}
+
+// parse reads one config file over what c already holds. DVC writes them in
+// configobj's INI dialect: [core] sections, ['remote "name"'] sections with
+// the name quoted, key = value lines and # comments.
+func (c *repoConfig) parse(b []byte) {
+	var section map[string]string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[' && line[len(line)-1] == ']':
+			name := unquote(strings.TrimSpace(line[1 : len(line)-1]))
+			if c.sections[name] == nil {
+				c.sections[name] = map[string]string{}
+			}
+			section = c.sections[name]
+		case section != nil:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = value[:i]
+			}
+			section[strings.ToLower(strings.TrimSpace(key))] = unquote(strings.TrimSpace(value))
+		}
+	}
+}
+
+// unquote strips one pair of matching quotes around s.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// remote returns the named remote's settings, or the default remote's (core.remote)
+// if name is empty; nil if there's no such remote.
+func (c *repoConfig) remote(name string) (string, map[string]string) {
+	if name == "" {
+		name = c.sections["core"]["remote"]
+	}
+	if name == "" {
+		return "", nil
+	}
+	return name, c.sections[`remote "`+name+`"`]
+}
@@ -0,0 +1,185 @@
+package dvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// remote is where a DVC repository's objects are stored.
+type remote struct {
+	name string            // As configured in .dvc/config; "" for a URL given as source.url
+	url  string            // s3://bucket/prefix, https://host/path, a local directory, ...
+	opts map[string]string // The remote's other settings (region, endpointurl)
+}
+
+// resolveRemote finds the remote src's objects are read from: the remote
+// named by src.URL, or the URL itself, or else the repository's default
+// remote (core.remote).
+func resolveRemote(src registry.Source) (*remote, error) {
+	cfg, err := findConfig(src.Path)
+	if err != nil {
+		return nil, err
+	}
+	if src.URL != "" && (cfg == nil || cfg.sections[`remote "`+src.URL+`"`] == nil) {
+		if !strings.Contains(src.URL, "://") && !strings.ContainsAny(src.URL, `/\`) {
+			return nil, fmt.Errorf("dvc: no remote named %q in the DVC repository of %s", src.URL, src.Path)
+		}
+		return &remote{url: src.URL}, nil
+	}
+	if cfg == nil {
+		return nil, fmt.Errorf("dvc: %s isn't in a DVC repository (no .dvc directory above it); set source.url to the remote", src.Path)
+	}
+	name, opts := cfg.remote(src.URL)
+	switch {
+	case name == "":
+		return nil, fmt.Errorf("dvc: the DVC repository of %s has no default remote (core.remote); set source.url to the remote", src.Path)
+	case opts["url"] == "":
+		return nil, fmt.Errorf("dvc: remote %q has no url in %s", name, cfg.dir)
+	}
+	r := &remote{name: name, url: opts["url"], opts: opts}
+	if !strings.Contains(r.url, "://") && !filepath.IsAbs(r.url) {
+		r.url = filepath.Join(cfg.dir, r.url) // DVC reads relative paths from the config file's directory
+	}
+	return r, nil
+}
+
+func (r *remote) String() string {
+	if r.name != "" {
+		return fmt.Sprintf("remote %q (%s)", r.name, r.url)
+	}
+	return r.url
+}
+
+// open starts reading the object at key (see objectKey) from the remote,
+// returning its size too, or -1 if unknown.
+func (h *handler) open(ctx context.Context, r *remote, key string, src registry.Source) (io.ReadCloser, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	u, err := url.Parse(r.url)
+	if err != nil || !strings.Contains(r.url, "://") || u.Scheme == "file" {
+		dir := r.url
+		if err == nil && u.Scheme == "file" {
+			dir = u.Path
+		}
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(key)))
+		if err != nil {
+			return nil, 0, fmt.Errorf("dvc: %s: %w", r, err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		return f, fi.Size(), nil
+	}
+
+	base := strings.TrimSuffix(r.url, "/")
+	var (
+		target string
+		sign   *registry.Signing
+		bearer string
+	)
+	switch u.Scheme {
+	case "http", "https":
+		target = base + "/" + key
+	case "webdav", "webdavs": // Plain GETs on the WebDAV server
+		target = strings.Replace(u.Scheme, "webdav", "http", 1) + base[len(u.Scheme):] + "/" + key
+	case "s3":
+		target, sign = s3Object(u, r.opts, src.Credentials)
+		target += "/" + key
+	case "gs":
+		target = "https://storage.googleapis.com/" + u.Host + strings.TrimSuffix(u.Path, "/") + "/" + key
+		bearer = src.Credentials.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	default:
+		return nil, 0, fmt.Errorf("dvc: %s: %s remotes aren't supported (local, http(s), webdav(s), s3 and gs are)", r, u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !src.Hosts.Allows(req.URL.Hostname()) {
+		return nil, 0, fmt.Errorf("dvc: %s is on %s, which isn't among the allowed hosts", r, req.URL.Hostname())
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	if err := httputil.Sign(req, sign, src.Credentials, time.Now()); err != nil {
+		return nil, 0, err
+	}
+	resp, err := h.clientFor(src).Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, 0, fmt.Errorf("dvc: %s doesn't have %s; was it pushed (dvc push)?", r, key)
+		}
+		return nil, 0, httputil.NewStatusError(http.MethodGet, target, resp)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// s3Object returns the HTTPS URL of the s3://bucket/prefix remote u, with
+// the signing to read it with: SigV4 when AWS credentials are set, none (a
+// public bucket) otherwise. The remote's endpointurl, for S3-compatible
+// stores, is addressed path-style.
+func s3Object(u *url.URL, opts map[string]string, creds *registry.Credentials) (string, *registry.Signing) {
+	region := firstNonEmpty(opts["region"], creds.Getenv("AWS_REGION"), creds.Getenv("AWS_DEFAULT_REGION"))
+	prefix := strings.TrimSuffix(u.Path, "/")
+	var base string
+	switch {
+	case opts["endpointurl"] != "":
+		base = strings.TrimSuffix(opts["endpointurl"], "/") + "/" + u.Host + prefix
+	case region == "" || region == "us-east-1":
+		base = "https://" + u.Host + ".s3.amazonaws.com" + prefix
+	default:
+		base = "https://" + u.Host + ".s3." + region + ".amazonaws.com" + prefix
+	}
+	if creds.Getenv("AWS_ACCESS_KEY_ID") == "" {
+		return base, nil
+	}
+	return base, &registry.Signing{Scheme: "sigv4", Region: firstNonEmpty(region, "us-east-1")}
+}
+
+// clientFor returns h.client, or a copy of it that refuses redirects to hosts
+// src.Hosts doesn't allow.
+func (h *handler) clientFor(src registry.Source) *http.Client {
+	if src.Hosts == nil {
+		return h.client
+	}
+	c := *h.client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !src.Hosts.Allows(req.URL.Hostname()) {
+			return fmt.Errorf("redirected to %s, which isn't among the allowed hosts", req.URL.Hostname())
+		}
+		return nil
+	}
+	return &c
+}
+
+// firstNonEmpty returns the first non-empty string.
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -3,11 +3,15 @@ package file
 import (
 	"context"
 	"errors"
-	"io"
+	"fmt"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/jprybylski/datum/internal/canon"
 	"github.com/jprybylski/datum/internal/core"
+	"github.com/jprybylski/datum/internal/fsutil"
 	"github.com/jprybylski/datum/internal/registry"
 )
 
@@ -20,6 +24,34 @@ func (h *handler) Fingerprint(ctx context.Context, src registry.Source) (string,
 	if src.Path == "" {
 		return "", errors.New("file: missing source.path")
 	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(src.Path)
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() {
+		// A directory is fingerprinted by its merkle-style tree hash, so any
+		// added, removed, renamed or edited file changes it
+		tree, files, err := core.HashTree(src.Path)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("tree:%s|files:%d", tree, files), nil
+	}
+	if src.Canonicalize != nil {
+		f, err := os.Open(src.Path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		hh, err := canon.Hash(f, src.Canonicalize)
+		if err != nil {
+			return "", err
+		}
+		return "sha256:" + hh, nil
+	}
 	hh, err := core.HashFile(src.Path) // use exported HashFile function
 	if err != nil {
 		return "", err
@@ -31,29 +63,55 @@ func (h *handler) Fetch(ctx context.Context, src registry.Source, dest string) e
 	if src.Path == "" {
 		return errors.New("file: missing source.path")
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(src.Path); err == nil && fi.IsDir() {
+		return fsutil.CopyTree(src.Path, dest) // Mirror the whole tree
+	}
 	in, err := os.Open(src.Path)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
-	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-		return err
+	return fsutil.WriteFileAtomic(dest, in)
+}
+
+// ModTime returns the source file's modification time, implementing registry.ModTimer.
+func (h *handler) ModTime(ctx context.Context, src registry.Source) (time.Time, error) {
+	if src.Path == "" {
+		return time.Time{}, errors.New("file: missing source.path")
 	}
-	tmp := dest + ".tmp"
-	out, err := os.Create(tmp)
+	fi, err := os.Stat(src.Path)
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
-	if _, err := io.Copy(out, in); err != nil {
-		out.Close()
-		_ = os.Remove(tmp)
-		return err
+	return fi.ModTime(), nil
+}
+
+// Probe implements registry.Prober for paths that exist on this machine (or
+// file:// URLs). Files and directories always fingerprint by content.
+func (h *handler) Probe(ctx context.Context, location string) (*registry.ProbeResult, error) {
+	path, isURL := strings.CutPrefix(location, "file://")
+	if !isURL && strings.Contains(location, "://") {
+		return nil, nil
 	}
-	if err := out.Close(); err != nil {
-		_ = os.Remove(tmp)
-		return err
+	fi, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := &registry.ProbeResult{Source: registry.Source{Type: "file", Path: path}}
+	if fi.IsDir() {
+		res.Fingerprints = []string{"tree hash of every file under the directory"}
+		res.Notes = []string{"a directory: fetch copies the whole tree"}
+	} else {
+		res.Fingerprints = []string{"sha256 of the content"}
+		res.Notes = []string{fmt.Sprintf("%d bytes, modified %s", fi.Size(), fi.ModTime().UTC().Format(time.RFC3339))}
 	}
-	return os.Rename(tmp, dest)
+	return res, nil
 }
 
 func init() {
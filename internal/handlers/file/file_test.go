@@ -5,7 +5,10 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/jprybylski/datum/internal/core"
+	"github.com/jprybylski/datum/internal/handlertest"
 	"github.com/jprybylski/datum/internal/registry"
 )
 
@@ -136,3 +139,100 @@ func TestHandler_Fetch(t *testing.T) {
 		}
 	})
 }
+
+func TestHandler_ModTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, want, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := New().ModTime(context.Background(), registry.Source{Path: path})
+	if err != nil || !got.Equal(want) {
+		t.Errorf("ModTime() = %v, %v; want %v", got, err, want)
+	}
+}
+
+func TestHandler_Probe(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.csv")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, loc := range []string{path, "file://" + path, dir} {
+		res, err := New().Probe(ctx, loc)
+		if err != nil || res == nil {
+			t.Fatalf("Probe(%q) = %v, %v", loc, res, err)
+		}
+		if res.Source.Type != "file" || res.Source.Path == "" || len(res.Fingerprints) != 1 {
+			t.Errorf("Probe(%q) = %+v", loc, res)
+		}
+	}
+	for _, loc := range []string{"https://example.org/data.csv", filepath.Join(dir, "missing.csv")} {
+		if res, err := New().Probe(ctx, loc); res != nil || err != nil {
+			t.Errorf("Probe(%q) = %+v, %v; want nil, nil", loc, res, err)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "source.txt")
+	if err := os.WriteFile(src, []byte("file content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	handlertest.Run(t, New(), handlertest.Fixtures{
+		Valid:   []handlertest.Fixture{{Source: registry.Source{Type: "file", Path: src}, Content: []byte("file content")}},
+		Invalid: []registry.Source{{Type: "file"}},
+	})
+}
+
+func TestHandler_Directory(t *testing.T) {
+	ctx := context.Background()
+	src := filepath.Join(t.TempDir(), "tree")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("b"), 0o644)
+	h := New()
+
+	fp, err := h.Fingerprint(ctx, registry.Source{Path: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, _, _ := core.HashTree(src)
+	if want := "tree:" + tree + "|files:2"; fp != want {
+		t.Errorf("Fingerprint() = %q, want %q", fp, want)
+	}
+
+	dest := filepath.Join(t.TempDir(), "out")
+	if err := h.Fetch(ctx, registry.Source{Path: src}, dest); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := core.HashTree(dest); got != tree {
+		t.Errorf("fetched tree hash = %s, want %s", got, tree)
+	}
+
+	os.WriteFile(filepath.Join(src, "sub", "c.txt"), []byte("c"), 0o644)
+	if fp2, _ := h.Fingerprint(ctx, registry.Source{Path: src}); fp2 == fp {
+		t.Error("Fingerprint() unchanged after a file was added")
+	}
+}
+
+func TestHandler_Canonicalize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	src := registry.Source{Path: path, Canonicalize: &registry.Canonicalize{LineEndings: true}}
+	os.WriteFile(path, []byte("id,v\r\n1,a\r\n"), 0o644)
+	crlf, err := New().Fingerprint(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, []byte("id,v\n1,a\n"), 0o644)
+	if lf, _ := New().Fingerprint(context.Background(), src); lf != crlf {
+		t.Errorf("fingerprint changed with only line endings: %q vs %q", crlf, lf)
+	}
+}
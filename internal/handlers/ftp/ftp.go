@@ -0,0 +1,232 @@
+// Package ftp fetches files from FTP and FTPS servers (type: ftp), which many
+// government and scientific data portals still use.
+//
+//	source:
+//	  type: ftp
+//	  url: ftp://ftp.ncei.noaa.gov/pub/data/ghcn/daily/ghcnd-stations.txt
+//
+// ftp:// is plain FTP; ftpes:// upgrades the connection with AUTH TLS
+// (explicit FTPS, port 21); ftps:// speaks TLS from the start (implicit FTPS,
+// port 990). With TLS, transfers are encrypted too.
+//
+// The fingerprint is the file's SHA-256 when the server computes one (the
+// HASH or XSHA256 extensions), and its size and modification time (SIZE and
+// MDTM) otherwise, in the same form as sftp's.
+//
+// Credential variables, all read through the dataset's auth profile:
+//   - FTP_USER: user name (default: the URL's, else anonymous)
+//   - FTP_PASSWORD: password (default for anonymous: "anonymous@")
+//   - FTP_TLS_INSECURE_SKIP_VERIFY=1: accept any certificate (test servers only)
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+type handler struct {
+	sessions tls.ClientSessionCache // Lets data connections resume the control connection's TLS session
+}
+
+func New() *handler {
+	return &handler{sessions: tls.NewLRUClientSessionCache(32)}
+}
+
+func (h *handler) Name() string { return "ftp" }
+
+// target is a parsed source URL.
+type target struct {
+	user string
+	host string
+	addr string // host:port
+	path string
+	tls  tlsMode
+}
+
+// parseURL accepts ftp://, ftpes:// and ftps:// URLs with a file path.
+func parseURL(raw string) (target, error) {
+	var t target
+	u, err := url.Parse(raw)
+	if err != nil {
+		return t, fmt.Errorf("ftp: %w", err)
+	}
+	port := "21"
+	switch u.Scheme {
+	case "ftp":
+	case "ftpes":
+		t.tls = tlsExplicit
+	case "ftps":
+		t.tls, port = tlsImplicit, "990"
+	default:
+		return t, fmt.Errorf("ftp: %q is not an ftp://, ftpes:// or ftps:// URL", raw)
+	}
+	if u.User != nil {
+		if _, hasPass := u.User.Password(); hasPass {
+			return t, fmt.Errorf("ftp: don't put the password in source.url; set FTP_PASSWORD")
+		}
+		t.user = u.User.Username()
+	}
+	t.host, t.path = u.Hostname(), u.Path
+	if t.host == "" || t.path == "" || strings.HasSuffix(t.path, "/") {
+		return t, fmt.Errorf("ftp: %q needs a host and a file path", raw)
+	}
+	t.addr = net.JoinHostPort(t.host, firstNonEmpty(u.Port(), port))
+	return t, nil
+}
+
+// connect parses src's URL, then dials and logs in with its credentials once
+// src's rate_limit allows another connection.
+func (h *handler) connect(ctx context.Context, src registry.Source) (*conn, target, error) {
+	t, err := parseURL(src.URL)
+	if err != nil {
+		return nil, t, err
+	}
+	requests, _ := httputil.SourceLimiters(t.addr, src.RateLimit)
+	if err := requests.Wait(ctx, 1); err != nil {
+		return nil, t, err
+	}
+	return h.dial(ctx, t, src.Credentials)
+}
+
+// dial logs in to t's server.
+func (h *handler) dial(ctx context.Context, t target, creds *registry.Credentials) (*conn, target, error) {
+	user := firstNonEmpty(creds.Getenv("FTP_USER"), firstNonEmpty(t.user, "anonymous"))
+	pass := creds.Getenv("FTP_PASSWORD")
+	if pass == "" && (user == "anonymous" || user == "ftp") {
+		pass = "anonymous@"
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         t.host,
+		ClientSessionCache: h.sessions,
+		InsecureSkipVerify: creds.Getenv("FTP_TLS_INSECURE_SKIP_VERIFY") == "1",
+	}
+	c, err := dial(ctx, t, user, pass, tlsConfig)
+	return c, t, err
+}
+
+// Fingerprint is the server's SHA-256 of the file, or its size and
+// modification time.
+func (h *handler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	c, t, err := h.connect(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	return fingerprint(c, t.path)
+}
+
+// fingerprint identifies path on c's server.
+func fingerprint(c *conn, path string) (string, error) {
+	size, err := c.size(path)
+	if err != nil {
+		return "", fmt.Errorf("ftp: SIZE %s: %w", path, err)
+	}
+	if sum := c.sha256(path); sum != "" {
+		return "sha256:" + sum, nil
+	}
+	mtime, err := c.mdtm(path)
+	if err != nil {
+		return "", fmt.Errorf("ftp: MDTM %s: %w", path, err)
+	}
+	return fmt.Sprintf("size:%d|mtime:%s", size, mtime.Format(time.RFC3339)), nil
+}
+
+// Fetch streams the file into dest.
+func (h *handler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	c, t, err := h.connect(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	size, err := c.size(t.path)
+	if err != nil {
+		size = -1 // Only used for progress
+	}
+	r, err := c.retr(t.path)
+	if err != nil {
+		return fmt.Errorf("ftp: RETR %s: %w", t.path, err)
+	}
+	_, download := httputil.SourceLimiters(t.addr, src.RateLimit)
+	body := httputil.Throttle(ctx, httputil.ProgressReader(r, src.Progress, size), download)
+	if err := fsutil.WriteFileAtomic(dest, body); err != nil {
+		r.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	if err := r.Close(); err != nil {
+		return fmt.Errorf("ftp: RETR %s: %w", t.path, err)
+	}
+	return nil
+}
+
+// ModTime returns the file's modification time (MDTM), implementing
+// registry.ModTimer.
+func (h *handler) ModTime(ctx context.Context, src registry.Source) (time.Time, error) {
+	c, t, err := h.connect(ctx, src)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer c.Close()
+	return c.mdtm(t.path)
+}
+
+// Probe implements registry.Prober for ftp://, ftpes:// and ftps:// URLs. It
+// logs in, checks the file exists, and reports which fingerprint the server
+// allows.
+func (h *handler) Probe(ctx context.Context, location string) (*registry.ProbeResult, error) {
+	if !strings.HasPrefix(location, "ftp://") && !strings.HasPrefix(location, "ftpes://") && !strings.HasPrefix(location, "ftps://") {
+		return nil, nil
+	}
+	t, err := parseURL(location)
+	if err != nil {
+		return nil, err
+	}
+	c, _, err := h.dial(ctx, t, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	size, err := c.size(t.path)
+	if err != nil {
+		return nil, fmt.Errorf("ftp: SIZE %s: %w", t.path, err)
+	}
+
+	res := &registry.ProbeResult{
+		Source:   registry.Source{Type: "ftp", URL: location},
+		Notes:    []string{fmt.Sprintf("%d bytes", size)},
+		Specific: true,
+	}
+	if c.sha256(t.path) != "" {
+		res.Fingerprints = []string{"sha256 (computed by the server)"}
+	} else {
+		res.Fingerprints = []string{"size and modification time (SIZE, MDTM)"}
+		res.Notes = append(res.Notes, "the server can't hash files; a rewrite with the same size in the same second goes unnoticed")
+	}
+	if t.tls == tlsNone {
+		res.Notes = append(res.Notes, "plain FTP: if the server offers TLS, use ftpes://")
+	}
+	return res, nil
+}
+
+func firstNonEmpty(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
+
+func init() {
+	registry.Register(New())
+}
@@ -0,0 +1,309 @@
+package ftp
+
+// This file is a minimal FTP client (RFC 959, with RFC 2228/4217 TLS, RFC
+// 2389 FEAT, RFC 2428 EPSV and RFC 3659 SIZE/MDTM): the handful of commands
+// needed to identify and download one file in binary mode.
+//
+// Go learning note: net/textproto already speaks the line protocol FTP
+// replies use, including multi-line "123-...\r\n123 end" replies, so the
+// client only adds the FTP commands and the separate data connection.
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tlsMode is how a connection is secured.
+type tlsMode int
+
+const (
+	tlsNone     tlsMode = iota // ftp://
+	tlsExplicit                // ftpes://: AUTH TLS on the plain control connection
+	tlsImplicit                // ftps://: TLS from the first byte, usually port 990
+)
+
+// replyError is a reply with an unexpected code. 4xx replies ("transient
+// negative completion") say the command may work if repeated, which
+// Timeout reports so the engine's retries apply.
+type replyError struct {
+	code int
+	msg  string
+}
+
+func (e *replyError) Error() string   { return fmt.Sprintf("ftp: %d %s", e.code, e.msg) }
+func (e *replyError) Timeout() bool   { return e.code >= 400 && e.code < 500 }
+func (e *replyError) Temporary() bool { return e.Timeout() }
+
+// conn is a logged-in control connection.
+type conn struct {
+	nc       net.Conn
+	tp       *textproto.Conn
+	host     string
+	tls      *tls.Config // Non-nil when data connections are protected too
+	features map[string]string
+	ctx      context.Context // Cancelling it closes the connection and any transfer
+	stop     func() bool
+}
+
+// dial connects to t, secures the connection as t asks, and logs in. The
+// connection is closed if ctx is cancelled, aborting any command or transfer.
+func dial(ctx context.Context, t target, user, pass string, tlsConfig *tls.Config) (*conn, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, fmt.Errorf("ftp: %w", err)
+	}
+	if t.tls == tlsImplicit {
+		nc = tls.Client(nc, tlsConfig)
+	}
+	c := &conn{nc: nc, tp: textproto.NewConn(nc), host: t.host, ctx: ctx}
+	c.stop = context.AfterFunc(ctx, func() { c.nc.Close() })
+	fail := func(err error) (*conn, error) {
+		c.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	if _, err := c.read(2); err != nil {
+		return fail(err)
+	}
+	if t.tls == tlsExplicit {
+		if _, err := c.cmd(2, "AUTH TLS"); err != nil {
+			return fail(fmt.Errorf("%w (the server doesn't offer TLS; use ftp:// for plain FTP)", err))
+		}
+		c.nc = tls.Client(c.nc, tlsConfig)
+		c.tp = textproto.NewConn(c.nc)
+	}
+
+	// 331 asks for a password; 230 means none is needed
+	code, msg, err := c.exchange("USER " + user)
+	if err == nil && code == 331 {
+		code, msg, err = c.exchange("PASS " + pass)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if code != 230 && code != 202 {
+		return fail(fmt.Errorf("ftp: login as %s: %w", user, &replyError{code, msg}))
+	}
+
+	if t.tls != tlsNone {
+		if _, err := c.cmd(2, "PBSZ 0"); err != nil {
+			return fail(err)
+		}
+		if _, err := c.cmd(2, "PROT P"); err != nil {
+			return fail(err)
+		}
+		c.tls = tlsConfig
+	}
+	if _, err := c.cmd(2, "TYPE I"); err != nil {
+		return fail(err)
+	}
+	c.features = c.feat()
+	return c, nil
+}
+
+// Close says goodbye and closes the connection.
+func (c *conn) Close() error {
+	c.stop()
+	c.tp.PrintfLine("QUIT")
+	return c.nc.Close()
+}
+
+// exchange sends a command and returns the reply, whatever its code.
+func (c *conn) exchange(line string) (int, string, error) {
+	if err := c.tp.PrintfLine("%s", line); err != nil {
+		return 0, "", fmt.Errorf("ftp: %w", err)
+	}
+	code, msg, err := c.tp.ReadResponse(0)
+	if err != nil {
+		return 0, "", fmt.Errorf("ftp: %w", err)
+	}
+	return code, msg, nil
+}
+
+// cmd sends a command and reads its reply, which must be in the class
+// expected (1 = preliminary, 2 = completion, 3 = more needed).
+func (c *conn) cmd(expect int, line string) (string, error) {
+	if err := c.tp.PrintfLine("%s", line); err != nil {
+		return "", fmt.Errorf("ftp: %w", err)
+	}
+	return c.read(expect)
+}
+
+// read reads a reply in the class expected.
+func (c *conn) read(expect int) (string, error) {
+	code, msg, err := c.tp.ReadResponse(0)
+	if err != nil {
+		return "", fmt.Errorf("ftp: %w", err)
+	}
+	if code/100 != expect {
+		return "", &replyError{code, msg}
+	}
+	return msg, nil
+}
+
+// feat returns the server's extensions (FEAT), by name, with their
+// parameters. Servers that predate FEAT get an empty set.
+func (c *conn) feat() map[string]string {
+	features := map[string]string{}
+	msg, err := c.cmd(2, "FEAT")
+	if err != nil {
+		return features
+	}
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimSpace(line)
+		name, params, _ := strings.Cut(line, " ")
+		if name != "" && !strings.HasSuffix(name, ":") && strings.ToUpper(name) != "END" {
+			features[strings.ToUpper(name)] = params
+		}
+	}
+	return features
+}
+
+// size returns the file's size in bytes (SIZE).
+func (c *conn) size(path string) (int64, error) {
+	msg, err := c.cmd(2, "SIZE "+path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ftp: SIZE %s: unexpected reply %q", path, msg)
+	}
+	return n, nil
+}
+
+// mdtm returns the file's modification time (MDTM), which servers give in
+// UTC as YYYYMMDDHHMMSS with optional fractional seconds.
+func (c *conn) mdtm(path string) (time.Time, error) {
+	msg, err := c.cmd(2, "MDTM "+path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	stamp, frac, _ := strings.Cut(strings.TrimSpace(msg), ".")
+	t, err := time.Parse("20060102150405", stamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ftp: MDTM %s: unexpected reply %q", path, msg)
+	}
+	if frac != "" {
+		if f, err := strconv.ParseFloat("0."+frac, 64); err == nil {
+			t = t.Add(time.Duration(f * float64(time.Second)))
+		}
+	}
+	return t.UTC(), nil
+}
+
+// hexDigest finds a SHA-256 in a hash reply.
+var hexDigest = regexp.MustCompile(`\b([0-9a-fA-F]{64})\b`)
+
+// sha256 asks the server to hash path: with HASH (draft-bryan-ftpext-hash)
+// after selecting SHA-256, or the older XSHA256. It returns "" when the
+// server offers neither, or won't hash this file.
+func (c *conn) sha256(path string) string {
+	var msg string
+	var err error
+	switch {
+	case strings.Contains(strings.ToUpper(c.features["HASH"]), "SHA-256"):
+		if _, err = c.cmd(2, "OPTS HASH SHA-256"); err == nil {
+			msg, err = c.cmd(2, "HASH "+path)
+		}
+	case hasFeature(c.features, "XSHA256"):
+		msg, err = c.cmd(2, "XSHA256 "+path)
+	default:
+		return ""
+	}
+	if err != nil {
+		return ""
+	}
+	if m := hexDigest.FindStringSubmatch(msg); m != nil {
+		return strings.ToLower(m[1])
+	}
+	return ""
+}
+
+// hasFeature reports whether the server listed name in FEAT.
+func hasFeature(features map[string]string, name string) bool {
+	_, ok := features[name]
+	return ok
+}
+
+// retr opens path for reading (RETR). Closing the reader ends the transfer
+// and reads the server's final reply, which is where a transfer the server
+// aborted shows up.
+func (c *conn) retr(path string) (io.ReadCloser, error) {
+	data, err := c.dataConn()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.cmd(1, "RETR "+path); err != nil {
+		data.Close()
+		return nil, err
+	}
+	if c.tls != nil {
+		data = tls.Client(data, c.tls)
+	}
+	stop := context.AfterFunc(c.ctx, func() { data.Close() })
+	return &transfer{Conn: data, c: c, stop: stop}, nil
+}
+
+// transfer is the data connection of a RETR.
+type transfer struct {
+	net.Conn
+	c    *conn
+	stop func() bool
+}
+
+func (t *transfer) Close() error {
+	t.stop()
+	t.Conn.Close()
+	_, err := t.c.read(2)
+	return err
+}
+
+// dataConn opens a passive data connection: EPSV where the server has it,
+// PASV otherwise. The address PASV advertises is ignored in favor of the
+// control connection's host, as servers behind NAT often give a private one.
+func (c *conn) dataConn() (net.Conn, error) {
+	port := 0
+	if msg, err := c.cmd(2, "EPSV"); err == nil {
+		// 229 Entering Extended Passive Mode (|||6446|)
+		if m := regexp.MustCompile(`\(\|\|\|(\d+)\|\)`).FindStringSubmatch(msg); m != nil {
+			port, _ = strconv.Atoi(m[1])
+		}
+	}
+	if port == 0 {
+		msg, err := c.cmd(2, "PASV")
+		if err != nil {
+			return nil, err
+		}
+		// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+		m := regexp.MustCompile(`(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`).FindStringSubmatch(msg)
+		if m == nil {
+			return nil, fmt.Errorf("ftp: unexpected PASV reply %q", msg)
+		}
+		p1, _ := strconv.Atoi(m[5])
+		p2, _ := strconv.Atoi(m[6])
+		port = p1<<8 | p2
+	}
+	if port <= 0 || port > 65535 {
+		return nil, errors.New("ftp: server gave no usable data port")
+	}
+	d := net.Dialer{Timeout: 30 * time.Second}
+	data, err := d.DialContext(c.ctx, "tcp", net.JoinHostPort(c.host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("ftp: data connection: %w", err)
+	}
+	return data, nil
+}
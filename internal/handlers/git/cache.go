@@ -0,0 +1,124 @@
+package git
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Each repository is cached as a bare clone under <cache dir>/git, named by
+// a hash of its URL (see ensureRepo). The directory's mtime is set whenever
+// the clone is used, so "datum cache gc" can tell which ones have gone stale.
+// Only directories named that way, whose origin (if it can be read) hashes
+// to the name, count as datum's: anything else found there is left alone.
+
+// gitCacheDir returns the directory holding the cached clones.
+func gitCacheDir() string {
+	return filepath.Join(fsutil.CacheDir(), "git")
+}
+
+// touch records that the clone at dir was just used.
+func touch(dir string) {
+	now := time.Now()
+	os.Chtimes(dir, now, now)
+}
+
+// CacheEntries lists the cached clones, implementing registry.CacheKeeper.
+func (h *handler) CacheEntries() ([]registry.CacheEntry, error) {
+	dirs, err := os.ReadDir(gitCacheDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []registry.CacheEntry
+	for _, d := range dirs {
+		if !d.IsDir() || !isCacheName(d.Name()) {
+			continue
+		}
+		e := registry.CacheEntry{Path: filepath.Join(gitCacheDir(), d.Name())}
+		if fi, err := d.Info(); err == nil {
+			e.LastUsed = fi.ModTime()
+		}
+		if repo, err := git.PlainOpen(e.Path); err == nil {
+			if remote, err := repo.Remote("origin"); err == nil && len(remote.Config().URLs) > 0 {
+				e.Source = remote.Config().URLs[0]
+			}
+		}
+		if e.Source != "" && shortHash(e.Source) != d.Name() {
+			continue
+		}
+		e.Size = dirSize(e.Path)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// RemoveCacheEntry deletes a cached clone, implementing registry.CacheKeeper.
+// The next dataset from that repository clones it again.
+func (h *handler) RemoveCacheEntry(e registry.CacheEntry) error {
+	if filepath.Dir(e.Path) != gitCacheDir() || !isCacheName(filepath.Base(e.Path)) {
+		return fmt.Errorf("%s isn't one of datum's cached clones", e.Path)
+	}
+	if e.Source != "" {
+		defer lockRepo(e.Source)()
+	}
+	return os.RemoveAll(e.Path)
+}
+
+// CompactCacheEntry repacks a cached clone's objects into a single pack,
+// dropping the ones no ref reaches any more, implementing registry.CacheKeeper.
+// Every fetch of a branch or tag adds a pack; without this they pile up.
+func (h *handler) CompactCacheEntry(e registry.CacheEntry) error {
+	if e.Source != "" {
+		defer lockRepo(e.Source)()
+	}
+	repo, err := git.PlainOpen(e.Path)
+	if err != nil {
+		return err
+	}
+	used := time.Now()
+	if fi, err := os.Stat(e.Path); err == nil {
+		used = fi.ModTime()
+	}
+	if err := repo.RepackObjects(&git.RepackConfig{}); err != nil {
+		return err
+	}
+	// Compacting isn't using: keep the clone's place in line for expiry
+	return os.Chtimes(e.Path, used, used)
+}
+
+// isCacheName reports whether name could be a cached clone's: a shortHash.
+func isCacheName(name string) bool {
+	if len(name) != 16 {
+		return false
+	}
+	for _, c := range name {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// dirSize returns the total size of the files under dir.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if fi, err := d.Info(); err == nil {
+				size += fi.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
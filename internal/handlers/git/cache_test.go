@@ -0,0 +1,93 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestCacheKeeper(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	// Directories datum didn't create are neither listed nor removed
+	for _, name := range []string{"not-datum", "0123456789abcdef"} {
+		other := filepath.Join(gitCacheDir(), name)
+		if _, err := git.PlainInit(other, true); err != nil {
+			t.Fatal(err)
+		}
+		repo, _ := git.PlainOpen(other)
+		repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"https://example.com/other.git"}})
+	}
+	upstream := t.TempDir()
+	repo, err := git.PlainInit(upstream, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, _ := repo.Worktree()
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	commit := func(content string) {
+		t.Helper()
+		os.WriteFile(filepath.Join(upstream, "data.csv"), []byte(content), 0o644)
+		wt.Add("data.csv")
+		if _, err := wt.Commit("data", &git.CommitOptions{Author: sig}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := New()
+	src := registry.Source{URL: upstream, Ref: "master", Path: "data.csv"}
+	commit("a\n")
+	if _, err := h.Fingerprint(context.Background(), src); err != nil {
+		t.Fatal(err)
+	}
+	commit("b\n")
+	if _, err := h.Fingerprint(context.Background(), src); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := h.CacheEntries()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("CacheEntries() = %v, %v; want the one clone", entries, err)
+	}
+	e := entries[0]
+	if e.Source != upstream || e.Size == 0 || time.Since(e.LastUsed) > time.Minute {
+		t.Errorf("CacheEntries() = %+v, want the repository, its size and the last use", e)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(e.Path, old, old)
+	if err := h.CompactCacheEntry(e); err != nil {
+		t.Fatalf("CompactCacheEntry() error = %v", err)
+	}
+	if packs, _ := filepath.Glob(filepath.Join(e.Path, "objects", "pack", "*.pack")); len(packs) != 1 {
+		t.Errorf("%d packs after compacting, want 1", len(packs))
+	}
+	if fi, _ := os.Stat(e.Path); !fi.ModTime().Equal(old) {
+		t.Error("CompactCacheEntry() counted as a use of the clone")
+	}
+	if fp, err := h.Fingerprint(context.Background(), src); err != nil || fp == "" {
+		t.Errorf("Fingerprint() after compacting = %q, %v", fp, err)
+	}
+
+	if err := h.RemoveCacheEntry(e); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := h.CacheEntries(); len(entries) != 0 {
+		t.Errorf("CacheEntries() after removing = %v, want none", entries)
+	}
+	if err := h.RemoveCacheEntry(registry.CacheEntry{Path: filepath.Join(gitCacheDir(), "not-datum")}); err == nil {
+		t.Error("RemoveCacheEntry() removed a directory datum didn't create")
+	}
+	for _, name := range []string{"not-datum", "0123456789abcdef"} {
+		if _, err := os.Stat(filepath.Join(gitCacheDir(), name)); err != nil {
+			t.Errorf("%s was touched: %v", name, err)
+		}
+	}
+}
@@ -1,26 +1,35 @@
 package git
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	git "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	gitclient "github.com/go-git/go-git/v5/plumbing/transport/client"
 	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
 	xssh "golang.org/x/crypto/ssh"
 
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
 	"github.com/jprybylski/datum/internal/registry"
 )
 
@@ -34,25 +43,29 @@ func (h *handler) Fingerprint(_ context.Context, src registry.Source) (string, e
 	if err != nil {
 		return "", err
 	}
+	defer lockRepo(repoURL)()
+	useNetwork(src)
 
-	repo, err := ensureRepo(repoURL)
+	repo, err := ensureRepo(repoURL, src.Credentials, nil)
 	if err != nil {
 		return "", err
 	}
 
-	_ = fetchAllRefs(repoURL, repo) // best-effort
+	_ = fetchAllRefs(repoURL, repo, src.Credentials, nil) // best-effort
 
 	commit, err := resolveRefCommit(repo, refName)
 	if err != nil {
 		return "", err
 	}
 
-	sha, _, err := blobForPathAtCommit(repo, commit, filePath)
+	file, tree, err := entryAtCommit(commit, filePath)
 	if err != nil {
 		return "", err
 	}
-
-	return "gitblob:" + sha, nil
+	if tree != nil {
+		return "gittree:" + tree.Hash.String(), nil
+	}
+	return "gitblob:" + file.Hash.String(), nil
 }
 
 func (h *handler) Fetch(_ context.Context, src registry.Source, dest string) error {
@@ -60,50 +73,207 @@ func (h *handler) Fetch(_ context.Context, src registry.Source, dest string) err
 	if err != nil {
 		return err
 	}
+	defer lockRepo(repoURL)()
+	useNetwork(src)
 
-	repo, err := ensureRepo(repoURL)
+	progress := statusWriter(src.Progress)
+	repo, err := ensureRepo(repoURL, src.Credentials, progress)
 	if err != nil {
 		return err
 	}
 
-	_ = fetchAllRefs(repoURL, repo)
+	_ = fetchAllRefs(repoURL, repo, src.Credentials, progress)
 
 	commit, err := resolveRefCommit(repo, refName)
 	if err != nil {
 		return err
 	}
 
-	_, r, err := blobForPathAtCommit(repo, commit, filePath)
+	file, tree, err := entryAtCommit(commit, filePath)
+	if err != nil {
+		return err
+	}
+	if tree != nil {
+		// A directory is written out next to dest and swapped in whole, like
+		// the file handler's trees
+		staging := fsutil.StagingPath(dest)
+		os.RemoveAll(staging)
+		defer os.RemoveAll(staging)
+		if err := writeTree(tree, staging); err != nil {
+			return err
+		}
+		return fsutil.ReplaceDir(staging, dest)
+	}
+	r, err := file.Reader()
 	if err != nil {
 		return err
 	}
 	defer r.Close()
 
-	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-		return err
+	return fsutil.WriteFileAtomic(dest, r)
+}
+
+// ModTime returns the committer time of the commit ref points at, implementing
+// registry.ModTimer. It reads the cached clone, which Fetch has just updated.
+func (h *handler) ModTime(_ context.Context, src registry.Source) (time.Time, error) {
+	repoURL, refName, _, err := parseGitSource(src)
+	if err != nil {
+		return time.Time{}, err
 	}
-	tmp := dest + ".tmp"
-	f, err := os.Create(tmp)
+	defer lockRepo(repoURL)()
+	useNetwork(src)
+
+	repo, err := ensureRepo(repoURL, src.Credentials, nil)
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
-	if _, err := io.Copy(f, r); err != nil {
-		f.Close()
-		_ = os.Remove(tmp)
-		return err
+	commit, err := resolveRefCommit(repo, refName)
+	if err != nil {
+		return time.Time{}, err
 	}
-	if err := f.Close(); err != nil {
-		_ = os.Remove(tmp)
-		return err
+	return commit.Committer.When, nil
+}
+
+// infoRefs is the smart-HTTP discovery endpoint, which hosting services
+// redirect when a repository is renamed or transferred.
+const infoRefs = "/info/refs?service=git-upload-pack"
+
+// Relocated reports a moved http(s) remote, implementing registry.Relocator.
+// SSH and file remotes can't announce a move, so they always report "".
+func (h *handler) Relocated(ctx context.Context, src registry.Source) (string, error) {
+	u, err := url.Parse(src.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", nil
+	}
+	client := &http.Client{Timeout: 30 * time.Second, Transport: &httputil.BudgetTransport{Base: httputil.NetworkTransport(src)}}
+	loc, err := httputil.PermanentLocation(ctx, client, http.MethodGet, strings.TrimSuffix(src.URL, "/")+infoRefs)
+	if err != nil || loc == "" {
+		return "", err
 	}
-	return os.Rename(tmp, dest)
+	if !strings.HasSuffix(loc, infoRefs) {
+		return "", nil // redirected somewhere that isn't a repository
+	}
+	moved, err := url.Parse(strings.TrimSuffix(loc, infoRefs))
+	if err != nil {
+		return "", err
+	}
+	// Keep credentials embedded in the configured URL
+	moved.User = u.User
+	return moved.String(), nil
+}
+
+// Probe implements registry.Prober for git remotes: URLs ending in .git,
+// ssh:// and git:// URLs, scp-style user@host:repo, and any other http(s) URL
+// that turns out to answer as a repository. It lists the remote's refs
+// without cloning anything.
+func (h *handler) Probe(ctx context.Context, location string) (*registry.ProbeResult, error) {
+	u, err := url.Parse(location)
+	scp := err != nil || u.Scheme == "" // user@host:path doesn't parse as a URL
+	web := !scp && (u.Scheme == "http" || u.Scheme == "https")
+	explicit := strings.HasSuffix(strings.TrimSuffix(location, "/"), ".git") ||
+		(!scp && (u.Scheme == "ssh" || u.Scheme == "git" || u.Scheme == "git+ssh")) ||
+		(scp && strings.Contains(location, "@") && strings.Contains(location, ":"))
+	if !explicit && !web {
+		return nil, nil
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: "origin", URLs: []string{location}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: gitAuth(location, nil)})
+	if err != nil {
+		if !explicit {
+			return nil, nil // A web page, not a repository
+		}
+		return nil, fmt.Errorf("git: list %s: %w", location, err)
+	}
+
+	branches, tags, head := 0, 0, ""
+	var notes []string
+	for _, ref := range refs {
+		switch {
+		case ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference:
+			head = ref.Target().Short()
+		case ref.Name().IsBranch():
+			branches++
+			if head == "" && (ref.Name().Short() == "main" || ref.Name().Short() == "master") {
+				head = ref.Name().Short()
+			}
+		case ref.Name().IsTag():
+			tags++
+		}
+	}
+	if head == "" {
+		head = "main"
+		notes = append(notes, "no default branch advertised; check source.ref")
+	}
+	res := &registry.ProbeResult{
+		Source: registry.Source{Type: "git", URL: location, Ref: head},
+		Fingerprints: []string{
+			"gitblob (the blob SHA of source.path at source.ref)",
+			"gittree (the tree SHA, when source.path is a directory or omitted)",
+		},
+		Notes:    append(notes, fmt.Sprintf("%d branch(es), %d tag(s), default branch %s", branches, tags, head)),
+		ToDo:     []string{"source.path: the file or directory to pin inside the repository (omit for all of it)"},
+		Specific: true,
+	}
+	if tags > 0 {
+		res.Notes = append(res.Notes, "pinning source.ref to a tag keeps the data from moving with the branch")
+	}
+	return res, nil
 }
 
 // --- helpers ---
 
+// statusWriter adapts p to the io.Writer go-git sends a remote's progress
+// messages to, or returns nil (no progress wanted) if p is nil.
+//
+// Go learning note: the nil check matters. Returning a nil *lineStatus as an
+// io.Writer would give go-git a non-nil interface holding a nil pointer, and
+// it would call Write on it.
+func statusWriter(p registry.Progress) io.Writer {
+	if p == nil {
+		return nil
+	}
+	return &lineStatus{p: p}
+}
+
+// lineStatus reports each line of progress text as a Status. Git redraws its
+// counters with carriage returns ("Receiving objects:  45% (450/1000)\r"), so
+// those end a line too.
+type lineStatus struct {
+	p   registry.Progress
+	buf []byte
+}
+
+func (w *lineStatus) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(w.buf[:i])); line != "" {
+			w.p.Status(line)
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// repoLocks holds one mutex per repository URL. Datasets are processed
+// concurrently and several may share a repository; its cache directory must
+// only be cloned into or fetched by one of them at a time.
+var repoLocks sync.Map
+
+// lockRepo locks repoURL's cache and returns the unlock function.
+func lockRepo(repoURL string) func() {
+	mu, _ := repoLocks.LoadOrStore(repoURL, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
 func parseGitSource(src registry.Source) (repoURL string, ref plumbing.ReferenceName, path string, err error) {
-	if src.URL == "" || src.Path == "" || src.Ref == "" {
-		return "", "", "", errors.New("git: require source.url, source.ref, source.path")
+	if src.URL == "" || src.Ref == "" {
+		return "", "", "", errors.New("git: require source.url, source.ref")
 	}
 	repoURL = src.URL
 	if strings.HasPrefix(src.Ref, "refs/") {
@@ -112,12 +282,16 @@ func parseGitSource(src registry.Source) (repoURL string, ref plumbing.Reference
 		// Try branch first; resolveRefCommit will fall back to tag.
 		ref = plumbing.NewBranchReferenceName(src.Ref)
 	}
-	path = filepath.ToSlash(src.Path)
+	// "", "." and "/" all mean the repository root
+	path = strings.Trim(filepath.ToSlash(filepath.Clean("/"+src.Path)), "/")
 	return repoURL, ref, path, nil
 }
 
-func ensureRepo(repoURL string) (*git.Repository, error) {
-	cacheDir := filepath.Join(defaultCacheDir(), "git", shortHash(repoURL))
+// ensureRepo opens repoURL's cached bare clone, creating and fetching it on
+// first use. progress, if not nil, receives the remote's progress messages.
+func ensureRepo(repoURL string, creds *registry.Credentials, progress io.Writer) (*git.Repository, error) {
+	cacheDir := filepath.Join(gitCacheDir(), shortHash(repoURL))
+	defer touch(cacheDir)
 	if _, err := os.Stat(cacheDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(cacheDir, 0o755); err != nil {
 			return nil, err
@@ -130,7 +304,7 @@ func ensureRepo(repoURL string) (*git.Repository, error) {
 		if err != nil && !errors.Is(err, git.ErrRemoteExists) {
 			return nil, err
 		}
-		if err := fetchAllRefs(repoURL, repo); err != nil && !isUpToDate(err) {
+		if err := fetchAllRefs(repoURL, repo, creds, progress); err != nil && !isUpToDate(err) {
 			return nil, err
 		}
 		return repo, nil
@@ -138,8 +312,8 @@ func ensureRepo(repoURL string) (*git.Repository, error) {
 	return git.PlainOpen(cacheDir)
 }
 
-func fetchAllRefs(repoURL string, repo *git.Repository) error {
-	auth := gitAuth(repoURL)
+func fetchAllRefs(repoURL string, repo *git.Repository, creds *registry.Credentials, progress io.Writer) error {
+	auth := gitAuth(repoURL, creds)
 
 	// Fetch heads
 	err1 := repo.Fetch(&git.FetchOptions{
@@ -149,6 +323,7 @@ func fetchAllRefs(repoURL string, repo *git.Repository) error {
 		Depth:      1,
 		Tags:       git.NoTags,
 		Force:      true,
+		Progress:   progress,
 	})
 	if isUpToDate(err1) {
 		err1 = nil
@@ -162,6 +337,7 @@ func fetchAllRefs(repoURL string, repo *git.Repository) error {
 		Depth:      1,
 		Tags:       git.AllTags,
 		Force:      true,
+		Progress:   progress,
 	})
 	if isUpToDate(err2) {
 		err2 = nil
@@ -201,28 +377,104 @@ func resolveRefCommit(repo *git.Repository, name plumbing.ReferenceName) (*objec
 	return repo.CommitObject(hash)
 }
 
-func blobForPathAtCommit(repo *git.Repository, commit *object.Commit, filePath string) (blobSHA string, r io.ReadCloser, err error) {
-	t, err := commit.Tree()
+// entryAtCommit looks up path in commit's tree. It returns the file when path
+// names one, or the tree when it names a directory; an empty path is the
+// repository root.
+func entryAtCommit(commit *object.Commit, path string) (*object.File, *object.Tree, error) {
+	root, err := commit.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+	if path == "" {
+		return nil, root, nil
+	}
+	entry, err := root.FindEntry(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("git: %q not found at %s", path, commit.Hash.String())
+	}
+	if entry.Mode == filemode.Dir {
+		t, err := root.Tree(path)
+		return nil, t, err
+	}
+	f, err := root.TreeEntryFile(entry)
+	return f, nil, err
+}
+
+// writeTree materializes t in dir: its files (executable ones with mode
+// 0755), directories and symlinks. Submodules are commits in another
+// repository, so they are left out, as an empty directory.
+func writeTree(t *object.Tree, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	walker := object.NewTreeWalker(t, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel := filepath.FromSlash(name)
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("git: refusing to write %q outside the target", name)
+		}
+		out := filepath.Join(dir, rel)
+		switch entry.Mode {
+		case filemode.Dir, filemode.Submodule:
+			err = os.MkdirAll(out, 0o755)
+		case filemode.Symlink:
+			err = writeSymlink(t, entry, out)
+		case filemode.Regular, filemode.Executable, filemode.Deprecated:
+			err = writeBlob(t, entry, out)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeBlob writes the file entry to out. Git only records whether a file is
+// executable, so that's all of its mode that carries over.
+func writeBlob(t *object.Tree, entry object.TreeEntry, out string) error {
+	f, err := t.TreeEntryFile(&entry)
 	if err != nil {
-		return "", nil, err
+		return err
 	}
-	f, err := t.File(filePath)
+	r, err := f.Reader()
 	if err != nil {
-		return "", nil, fmt.Errorf("git: file %q not found at %s", filePath, commit.Hash.String())
+		return err
+	}
+	defer r.Close()
+	perm := os.FileMode(0o644)
+	if entry.Mode == filemode.Executable {
+		perm = 0o755
 	}
-	rd, err := f.Reader()
+	w, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
-		return "", nil, err
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
 	}
-	return f.Hash.String(), rd, nil
+	return w.Close()
 }
 
-func defaultCacheDir() string {
-	if v := os.Getenv("XDG_CACHE_HOME"); v != "" {
-		return v
+// writeSymlink recreates the symlink entry at out. Its blob holds the link
+// target.
+func writeSymlink(t *object.Tree, entry object.TreeEntry, out string) error {
+	f, err := t.TreeEntryFile(&entry)
+	if err != nil {
+		return err
 	}
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".cache", "datum")
+	target, err := f.Contents()
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, out)
 }
 
 func shortHash(s string) string {
@@ -234,15 +486,17 @@ func isUpToDate(err error) bool {
 	return err == nil || errors.Is(err, git.NoErrAlreadyUpToDate)
 }
 
+// gitAuth picks credentials for raw from the GIT_* variables, read through creds
+// so a dataset's auth profile can substitute its own.
 // NOTE: return type is from plumbing/transport, not github.com/go-git/go-git/v5.
-func gitAuth(raw string) gittransport.AuthMethod {
+func gitAuth(raw string, creds *registry.Credentials) gittransport.AuthMethod {
 	u, _ := url.Parse(raw)
 
 	// HTTPS (PAT/basic)
 	if u != nil && (u.Scheme == "http" || u.Scheme == "https") {
-		user := os.Getenv("GIT_USERNAME")
-		pass := os.Getenv("GIT_PASSWORD")
-		if t := os.Getenv("GIT_TOKEN"); t != "" {
+		user := creds.Getenv("GIT_USERNAME")
+		pass := creds.Getenv("GIT_PASSWORD")
+		if t := creds.Getenv("GIT_TOKEN"); t != "" {
 			user, pass = "x-access-token", t
 		}
 		if user != "" || pass != "" {
@@ -262,8 +516,8 @@ func gitAuth(raw string) gittransport.AuthMethod {
 		return cb
 	}
 
-	if key := os.Getenv("GIT_SSH_KEY"); key != "" {
-		passphrase := os.Getenv("GIT_SSH_PASSPHRASE")
+	if key := creds.Getenv("GIT_SSH_KEY"); key != "" {
+		passphrase := creds.Getenv("GIT_SSH_PASSPHRASE")
 		if pk, err := gitssh.NewPublicKeysFromFile(user, key, passphrase); err == nil {
 			pk.HostKeyCallback = xssh.InsecureIgnoreHostKey()
 			return pk
@@ -272,4 +526,12 @@ func gitAuth(raw string) gittransport.AuthMethod {
 	return nil
 }
 
-func init() { registry.Register(New()) }
+func init() {
+	registry.Register(New())
+
+	// Clones and fetches over http(s) share the connection budget with the
+	// http handler, and go through their sources' proxy and TLS settings
+	budgeted := githttp.NewClient(&http.Client{Transport: &httputil.BudgetTransport{Base: routingTransport{}}})
+	gitclient.InstallProtocol("http", budgeted)
+	gitclient.InstallProtocol("https", budgeted)
+}
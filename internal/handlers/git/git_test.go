@@ -0,0 +1,139 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// testCommit commits files (slash-separated path -> content) to a new
+// repository, with bin/run.sh executable and link pointing at README.
+func testCommit(t *testing.T, files map[string]string) *object.Commit {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		perm := os.FileMode(0o644)
+		if name == "bin/run.sh" {
+			perm = 0o755
+		}
+		if err := os.WriteFile(path, []byte(content), perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("README", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	hash, err := wt.Commit("data", &git.CommitOptions{Author: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+func TestParseGitSource_Path(t *testing.T) {
+	for in, want := range map[string]string{
+		"":             "",
+		".":            "",
+		"/":            "",
+		"data/":        "data",
+		"./data/a.csv": "data/a.csv",
+	} {
+		_, _, got, err := parseGitSource(registry.Source{URL: "https://example.com/r.git", Ref: "main", Path: in})
+		if err != nil || got != want {
+			t.Errorf("parseGitSource(path %q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, _, _, err := parseGitSource(registry.Source{URL: "https://example.com/r.git"}); err == nil {
+		t.Error("parseGitSource without ref succeeded")
+	}
+}
+
+func TestEntryAtCommit(t *testing.T) {
+	commit := testCommit(t, map[string]string{
+		"README":     "hello\n",
+		"data/a.csv": "x,y\n1,2\n",
+		"data/b.csv": "x,y\n3,4\n",
+		"bin/run.sh": "#!/bin/sh\n",
+	})
+
+	f, tree, err := entryAtCommit(commit, "data/a.csv")
+	if err != nil || f == nil || tree != nil {
+		t.Fatalf("entryAtCommit(file) = %v, %v, %v; want the file", f, tree, err)
+	}
+	_, data, err := entryAtCommit(commit, "data")
+	if err != nil || data == nil {
+		t.Fatalf("entryAtCommit(dir) = %v, %v; want the tree", data, err)
+	}
+	_, root, err := entryAtCommit(commit, "")
+	if err != nil || root == nil || root.Hash != commit.TreeHash {
+		t.Fatalf("entryAtCommit(root) = %v, %v; want the commit's tree", root, err)
+	}
+	if data.Hash == root.Hash {
+		t.Error("subtree and root have the same hash")
+	}
+	if _, _, err := entryAtCommit(commit, "nope"); err == nil {
+		t.Error("entryAtCommit(missing path) succeeded")
+	}
+}
+
+func TestWriteTree(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	commit := testCommit(t, map[string]string{
+		"README":     "hello\n",
+		"data/a.csv": "x,y\n1,2\n",
+		"bin/run.sh": "#!/bin/sh\n",
+	})
+	_, root, err := entryAtCommit(commit, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "repo")
+	if err := writeTree(root, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := os.ReadFile(filepath.Join(out, "data", "a.csv")); err != nil || string(b) != "x,y\n1,2\n" {
+		t.Errorf("data/a.csv = %q, %v", b, err)
+	}
+	if fi, err := os.Stat(filepath.Join(out, "bin", "run.sh")); err != nil || fi.Mode().Perm()&0o100 == 0 {
+		t.Errorf("bin/run.sh isn't executable: %v, %v", fi, err)
+	}
+	if fi, err := os.Stat(filepath.Join(out, "README")); err != nil || fi.Mode().Perm()&0o100 != 0 {
+		t.Errorf("README is executable: %v, %v", fi, err)
+	}
+	if target, err := os.Readlink(filepath.Join(out, "link")); err != nil || target != "README" {
+		t.Errorf("link -> %q, %v; want README", target, err)
+	}
+	if _, err := os.Stat(filepath.Join(out, ".git")); !os.IsNotExist(err) {
+		t.Errorf(".git was written: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package git
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// go-git has a single HTTP client per protocol, installed in init, so a
+// source's proxy and TLS settings can't travel with its clone or fetch.
+// Instead each source registers its transport for its repository's URL, and
+// the installed client routes every request to the transport of the
+// repository it's for.
+
+// repoTransports maps repository URLs (see repoKey) to the transports for
+// their sources' network settings.
+var repoTransports sync.Map
+
+// useNetwork registers src's network settings for its repository, before
+// anything is requested from it.
+func useNetwork(src registry.Source) {
+	key := repoKey(src.URL)
+	if t := httputil.NetworkTransport(src); t != nil {
+		repoTransports.Store(key, t)
+	} else {
+		repoTransports.Delete(key)
+	}
+}
+
+// repoKey returns rawURL without credentials, ending in a slash, so every
+// request for the repository starts with it and none for another does.
+func repoKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.User = nil
+	u.RawQuery, u.Fragment = "", ""
+	return strings.TrimSuffix(u.String(), "/") + "/"
+}
+
+// routingTransport sends each request through the transport registered for
+// its repository, or http.DefaultTransport.
+type routingTransport struct{}
+
+func (routingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *req.URL
+	u.User, u.RawQuery = nil, ""
+	target := u.String()
+	t, longest := http.DefaultTransport, 0
+	repoTransports.Range(func(k, v any) bool {
+		if key := k.(string); len(key) > longest && strings.HasPrefix(target, key) {
+			t, longest = v.(http.RoundTripper), len(key)
+		}
+		return true
+	})
+	return t.RoundTrip(req)
+}
@@ -0,0 +1,423 @@
+// Package githubrelease pins assets attached to GitHub releases (type:
+// github-release): data files, model weights and tarballs published with a
+// tagged release.
+//
+//	source:
+//	  type: github-release
+//	  url: owner/repo          # or https://github.com/owner/repo
+//	  ref: v2024.06            # the release's tag, or latest (the default)
+//	  path: counties.csv.gz    # the asset's name (optional if the release has one)
+//
+// Short forms use the API at $GITHUB_API_URL when set (as in GitHub
+// Actions), or api.github.com. A full URL on another host is taken to be
+// GitHub Enterprise Server, whose API is under /api/v3.
+//
+// The fingerprint comes from the Releases API, so checking never downloads
+// anything: "sha256:<hex>", the digest GitHub records for the asset, or for
+// assets uploaded before GitHub recorded digests "asset:<node id>", which
+// changes whenever the asset is replaced. With ref latest, a new release
+// changes it too. Fetch downloads the asset through the API, following its
+// redirect to GitHub's storage, and checks it against the digest when there
+// is one.
+//
+// Private repositories need a token in GITHUB_TOKEN (or GH_TOKEN), read
+// through the dataset's auth profile; a token also raises the API's rate
+// limit from 60 requests an hour to 5,000. A request that hits the limit
+// waits for it to reset if that's within a minute, and otherwise fails with
+// a rate-limit error that --retries treats as transient.
+package githubrelease
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// defaultAPI is github.com's REST API.
+const defaultAPI = "https://api.github.com"
+
+// maxRateLimitWait is the longest a request waits for the rate limit to
+// reset before giving up with an error instead.
+const maxRateLimitWait = time.Minute
+
+type handler struct{ client *http.Client }
+
+// New returns the handler. Like http, its requests draw from
+// httputil.DefaultBudget.
+func New() *handler {
+	return &handler{client: &http.Client{Timeout: 60 * time.Second, Transport: &httputil.BudgetTransport{}}}
+}
+
+func (h *handler) Name() string { return "github-release" }
+
+// repo is a parsed source.url: which API, which repository.
+type repo struct {
+	api string // https://api.github.com
+	id  string // owner/name
+}
+
+// parseRepo accepts owner/name and repository URLs, with or without .git.
+func parseRepo(raw string, creds *registry.Credentials) (repo, error) {
+	r := repo{api: strings.TrimSuffix(firstNonEmpty(creds.Getenv("GITHUB_API_URL"), defaultAPI), "/")}
+	rest := raw
+	if u, err := url.Parse(raw); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		r.api = u.Scheme + "://" + u.Host + "/api/v3"
+		if u.Host == "github.com" || u.Host == "www.github.com" {
+			r.api = defaultAPI
+		}
+		rest = u.Path
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(rest, "/"), ".git"), "/")
+	if len(parts) != 2 || !validName.MatchString(parts[0]) || !validName.MatchString(parts[1]) {
+		return r, fmt.Errorf("github-release: %q is not a repository like owner/name", raw)
+	}
+	r.id = parts[0] + "/" + parts[1]
+	return r, nil
+}
+
+// validName matches GitHub owner and repository names.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// releaseURL is the API endpoint describing the release tagged tag, or the
+// latest release.
+func (r repo) releaseURL(tag string) string {
+	if tag == "latest" {
+		return fmt.Sprintf("%s/repos/%s/releases/latest", r.api, r.id)
+	}
+	return fmt.Sprintf("%s/repos/%s/releases/tags/%s", r.api, r.id, url.PathEscape(tag))
+}
+
+// release is the part of the Releases API's answer datum uses.
+type release struct {
+	TagName string  `json:"tag_name"`
+	Assets  []asset `json:"assets"`
+}
+
+// asset is one file attached to a release.
+type asset struct {
+	URL    string `json:"url"` // API URL; with Accept: application/octet-stream, the content
+	NodeID string `json:"node_id"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"` // "sha256:<hex>", for assets uploaded since GitHub began recording them
+	State  string `json:"state"`  // "uploaded", or "open" while an upload is under way
+}
+
+// sha256Digest matches the digests GitHub records.
+var sha256Digest = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// fingerprint renders the asset as a fingerprint: its digest, or its node ID.
+func (a *asset) fingerprint() string {
+	if d := strings.ToLower(a.Digest); sha256Digest.MatchString(d) {
+		return d
+	}
+	return "asset:" + a.NodeID
+}
+
+// Fingerprint is the asset's digest, or its node ID, as the Releases API
+// reports it.
+func (h *handler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	a, err := h.asset(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	return a.fingerprint(), nil
+}
+
+// Fetch downloads the asset into dest.
+func (h *handler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	a, err := h.asset(ctx, src)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.URL, nil)
+	if err != nil {
+		return err
+	}
+	// Go drops the Authorization header on the redirect to GitHub's storage,
+	// whose signed URL carries its own authorization
+	req.Header.Set("Accept", "application/octet-stream")
+	authorize(req, src.Credentials)
+	resp, err := h.do(req, src)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var body io.Reader = resp.Body
+	if d := strings.ToLower(a.Digest); sha256Digest.MatchString(d) {
+		body = verifying(body, strings.TrimPrefix(d, "sha256:"), a.Name)
+	}
+	return fsutil.WriteFileAtomic(dest, httputil.ProgressReader(body, src.Progress, a.Size))
+}
+
+// asset asks the Releases API for src's release and picks its asset.
+func (h *handler) asset(ctx context.Context, src registry.Source) (*asset, error) {
+	if src.URL == "" {
+		return nil, errors.New("github-release: require source.url (the repository, owner/name)")
+	}
+	r, err := parseRepo(src.URL, src.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := h.release(ctx, r, firstNonEmpty(src.Ref, "latest"), src)
+	if err != nil {
+		return nil, err
+	}
+	return pick(r, rel, src.Path)
+}
+
+// release fetches the release tagged tag (or the latest) from the API.
+func (h *handler) release(ctx context.Context, r repo, tag string, src registry.Source) (*release, error) {
+	apiURL := r.releaseURL(tag)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	authorize(req, src.Credentials)
+	resp, err := h.do(req, src)
+	if err != nil {
+		var se *httputil.StatusError
+		if errors.As(err, &se) && se.Code == http.StatusNotFound {
+			if tag == "latest" {
+				return nil, fmt.Errorf("github-release: %s has no releases: %w", r.id, err)
+			}
+			return nil, fmt.Errorf("github-release: no release tagged %s in %s: %w", tag, r.id, err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var rel release
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return nil, fmt.Errorf("github-release: %s: %w", apiURL, err)
+	}
+	return &rel, nil
+}
+
+// pick returns the asset named name, or the only one if name is empty.
+func pick(r repo, rel *release, name string) (*asset, error) {
+	var names []string
+	for i := range rel.Assets {
+		a := &rel.Assets[i]
+		if a.Name == name || (name == "" && len(rel.Assets) == 1) {
+			if a.State != "" && a.State != "uploaded" {
+				return nil, fmt.Errorf("github-release: %s in %s %s is still being uploaded", a.Name, r.id, rel.TagName)
+			}
+			return a, nil
+		}
+		names = append(names, a.Name)
+	}
+	switch {
+	case len(names) == 0:
+		return nil, fmt.Errorf("github-release: release %s of %s has no assets", rel.TagName, r.id)
+	case name == "":
+		return nil, fmt.Errorf("github-release: release %s of %s has %d assets; set source.path to one of: %s", rel.TagName, r.id, len(names), strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("github-release: no asset %s in release %s of %s (it has %s)", name, rel.TagName, r.id, strings.Join(names, ", "))
+}
+
+// do sends req, refusing hosts src.Hosts doesn't allow. When GitHub says the
+// rate limit is used up and it resets within maxRateLimitWait, it waits and
+// tries once more.
+func (h *handler) do(req *http.Request, src registry.Source) (*http.Response, error) {
+	if !src.Hosts.Allows(req.URL.Hostname()) {
+		return nil, fmt.Errorf("github-release: %s isn't among the allowed hosts", req.URL.Hostname())
+	}
+	client := h.client
+	if src.Hosts != nil {
+		c := *h.client
+		c.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if !src.Hosts.Allows(next.URL.Hostname()) {
+				return fmt.Errorf("redirected to %s, which isn't among the allowed hosts", next.URL.Hostname())
+			}
+			return nil
+		}
+		client = &c
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 400 {
+			return resp, nil
+		}
+		resp.Body.Close()
+		wait, limited := rateLimit(resp, time.Now())
+		if !limited || attempt > 0 || wait > maxRateLimitWait {
+			return nil, statusError(req, resp, wait, limited)
+		}
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// rateLimit reports whether resp turns a request away for exceeding one of
+// GitHub's rate limits, and how long until another may succeed. The primary
+// limit answers 403 or 429 with X-RateLimit-Remaining: 0 and the time it
+// resets; secondary limits answer with Retry-After.
+func rateLimit(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return 0, resp.StatusCode == http.StatusTooManyRequests
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Minute, true // GitHub's advice when it doesn't say
+	}
+	return max(time.Unix(reset, 0).Sub(now), 0) + time.Second, true
+}
+
+// statusError is httputil's status error, with hints for the answers rate
+// limits and private repositories give. GitHub answers 403 to rate-limited
+// requests too; those count as the 429 they are, so --retries waits them out.
+func statusError(req *http.Request, resp *http.Response, wait time.Duration, limited bool) error {
+	err := httputil.NewStatusError(req.Method, req.URL.String(), resp)
+	token := req.Header.Get("Authorization") != ""
+	switch {
+	case limited:
+		err.Code, err.RetryAfter = http.StatusTooManyRequests, wait
+		if !token {
+			return fmt.Errorf("%w (GitHub API rate limit exceeded, resets in %s; set GITHUB_TOKEN for a higher limit)", err, wait.Round(time.Second))
+		}
+		return fmt.Errorf("%w (GitHub API rate limit exceeded, resets in %s)", err, wait.Round(time.Second))
+	case !token && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden):
+		return fmt.Errorf("%w (private repository? set GITHUB_TOKEN to a token with access)", err)
+	}
+	return err
+}
+
+// authorize adds the GITHUB_TOKEN (or GH_TOKEN) bearer token to req, if one
+// is set.
+func authorize(req *http.Request, creds *registry.Credentials) {
+	if token := firstNonEmpty(creds.Getenv("GITHUB_TOKEN"), creds.Getenv("GH_TOKEN")); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// Probe implements registry.Prober for release pages and asset download
+// URLs on github.com (https://github.com/owner/repo/releases/download/v1/x.csv,
+// say), turning them into a source and asking the API for the fingerprint.
+func (h *handler) Probe(ctx context.Context, location string) (*registry.ProbeResult, error) {
+	u, err := url.Parse(location)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host != "github.com" {
+		return nil, nil
+	}
+	parts := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	for i, p := range parts {
+		parts[i], _ = url.PathUnescape(p)
+	}
+	if len(parts) < 3 || parts[2] != "releases" {
+		return nil, nil // Not a release page
+	}
+	src := registry.Source{Type: "github-release", URL: parts[0] + "/" + parts[1], Ref: "latest"}
+	switch {
+	case len(parts) == 6 && parts[3] == "download":
+		src.Ref, src.Path = parts[4], parts[5]
+	case len(parts) == 7 && parts[3] == "latest" && parts[4] == "download":
+		src.Path = parts[6]
+	case len(parts) == 5 && parts[3] == "tag":
+		src.Ref = parts[4]
+	case len(parts) == 3 || (len(parts) == 4 && parts[3] == "latest"):
+	default:
+		return nil, nil
+	}
+	r, err := parseRepo(src.URL, nil)
+	if err != nil {
+		return nil, nil
+	}
+	rel, err := h.release(ctx, r, src.Ref, src)
+	if err != nil {
+		return nil, err
+	}
+	res := &registry.ProbeResult{Source: src, Specific: true}
+	if src.Path == "" && len(rel.Assets) != 1 {
+		var names []string
+		for _, a := range rel.Assets {
+			names = append(names, a.Name)
+		}
+		res.ToDo = []string{"source.path: the asset to pin, one of: " + strings.Join(names, ", ")}
+		res.Fingerprints = []string{"sha256 digest of the asset, or its node ID for older assets (Releases API)"}
+		return res, nil
+	}
+	a, err := pick(r, rel, src.Path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(a.fingerprint(), "sha256:") {
+		res.Fingerprints = []string{"sha256 digest of the asset (Releases API)"}
+	} else {
+		res.Fingerprints = []string{"asset node ID, which changes when the asset is replaced (Releases API)"}
+	}
+	res.Notes = []string{fmt.Sprintf("%s, %d bytes, in release %s", a.Name, a.Size, rel.TagName)}
+	if src.Ref == "latest" {
+		res.Notes = append(res.Notes, "ref latest moves with each release; a tag pins one release")
+	}
+	return res, nil
+}
+
+// verifying wraps r so that reading it to the end fails if the content's
+// SHA-256 isn't want, which keeps WriteFileAtomic from installing it.
+func verifying(r io.Reader, want, what string) io.Reader {
+	v := &verifyingReader{h: sha256.New(), want: want, what: what}
+	v.r = io.TeeReader(r, v.h)
+	return v
+}
+
+type verifyingReader struct {
+	r    io.Reader
+	h    hash.Hash
+	want string
+	what string
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	if errors.Is(err, io.EOF) {
+		if got := hex.EncodeToString(v.h.Sum(nil)); got != v.want {
+			return n, fmt.Errorf("github-release: %s: downloaded content has sha256 %s, GitHub records %s", v.what, got, v.want)
+		}
+	}
+	return n, err
+}
+
+// firstNonEmpty returns the first non-empty string.
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func init() {
+	registry.Register(New())
+}
@@ -0,0 +1,233 @@
+package githubrelease
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/handlertest"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// fakeAPI serves the Releases API for two repositories, and points
+// GITHUB_API_URL at itself for the test:
+//
+//	acme/data   -> v1 (latest): counts.csv with a digest, old.csv without one,
+//	               bad.csv whose content doesn't match its digest
+//	acme/single -> v2 (latest): one asset
+//	acme/private needs the token "secret"
+//
+// Assets are served by redirecting the asset API URL to /storage/, as GitHub
+// does. The returned counter makes the next n API requests fail with the
+// rate limit exceeded.
+func fakeAPI(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var server *httptest.Server
+	limited := &atomic.Int32{}
+	content := map[string]string{"1": "a,b\n1,2\n", "2": "old", "3": "tampered", "4": "only"}
+	type a = map[string]any
+	releases := map[string]a{
+		"/repos/acme/data/releases/tags/v1": {"tag_name": "v1", "assets": []a{
+			{"url": "/assets/1", "node_id": "RA_one", "name": "counts.csv", "size": 8, "digest": "sha256:" + sha256Hex("a,b\n1,2\n"), "state": "uploaded"},
+			{"url": "/assets/2", "node_id": "RA_two", "name": "old.csv", "size": 3, "digest": nil, "state": "uploaded"},
+			{"url": "/assets/3", "node_id": "RA_three", "name": "bad.csv", "size": 8, "digest": "sha256:" + sha256Hex("expected"), "state": "uploaded"},
+		}},
+		"/repos/acme/single/releases/tags/v2":  {"tag_name": "v2", "assets": []a{{"url": "/assets/4", "node_id": "RA_four", "name": "only.bin", "size": 4, "state": "uploaded"}}},
+		"/repos/acme/private/releases/tags/v3": {"tag_name": "v3", "assets": []a{{"url": "/assets/4", "node_id": "RA_four", "name": "only.bin", "size": 4, "state": "uploaded"}}},
+	}
+	releases["/repos/acme/data/releases/latest"] = releases["/repos/acme/data/releases/tags/v1"]
+	releases["/repos/acme/single/releases/latest"] = releases["/repos/acme/single/releases/tags/v2"]
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/", func(w http.ResponseWriter, r *http.Request) {
+		if limited.Add(-1) >= 0 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		limited.Store(0)
+		if strings.HasPrefix(r.URL.Path, "/repos/acme/private/") && r.Header.Get("Authorization") != "Bearer secret" {
+			http.NotFound(w, r)
+			return
+		}
+		rel, ok := releases[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// Asset URLs are absolute in the API's answers
+		var assets []map[string]any
+		for _, asset := range rel["assets"].([]map[string]any) {
+			copied := map[string]any{}
+			for k, v := range asset {
+				copied[k] = v
+			}
+			copied["url"] = server.URL + asset["url"].(string)
+			assets = append(assets, copied)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"tag_name": rel["tag_name"], "assets": assets})
+	})
+	mux.HandleFunc("/assets/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/octet-stream" {
+			w.Write([]byte(`{"name": "asset metadata"}`))
+			return
+		}
+		http.Redirect(w, r, "/storage/"+strings.TrimPrefix(r.URL.Path, "/assets/"), http.StatusFound)
+	})
+	mux.HandleFunc("/storage/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content[strings.TrimPrefix(r.URL.Path, "/storage/")]))
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	t.Setenv("GITHUB_API_URL", server.URL)
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "")
+	return server, limited
+}
+
+func TestParseRepo(t *testing.T) {
+	t.Setenv("GITHUB_API_URL", "")
+	for raw, want := range map[string]repo{
+		"acme/data":                          {defaultAPI, "acme/data"},
+		"https://github.com/acme/data.git":   {defaultAPI, "acme/data"},
+		"https://git.example.org/acme/data/": {"https://git.example.org/api/v3", "acme/data"},
+	} {
+		if got, err := parseRepo(raw, nil); err != nil || got != want {
+			t.Errorf("parseRepo(%q) = %+v, %v; want %+v", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"acme", "acme/data/extra", "acme/da ta", "https://github.com/acme"} {
+		if _, err := parseRepo(raw, nil); err == nil {
+			t.Errorf("parseRepo(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	fakeAPI(t)
+	handlertest.Run(t, New(), handlertest.Fixtures{
+		Valid: []handlertest.Fixture{
+			{Name: "digest", Source: registry.Source{Type: "github-release", URL: "acme/data", Ref: "v1", Path: "counts.csv"}, Content: []byte("a,b\n1,2\n")},
+			{Name: "node id", Source: registry.Source{Type: "github-release", URL: "acme/data", Path: "old.csv"}, Content: []byte("old")},
+			{Name: "one asset", Source: registry.Source{Type: "github-release", URL: "acme/single"}, Content: []byte("only")},
+		},
+		Invalid: []registry.Source{{Type: "github-release"}, {Type: "github-release", URL: "acme/data", Path: "none.csv"}},
+	})
+}
+
+func TestFingerprint(t *testing.T) {
+	ctx := context.Background()
+	fakeAPI(t)
+
+	tests := []struct{ repo, ref, path, want string }{
+		{"acme/data", "v1", "counts.csv", "sha256:" + sha256Hex("a,b\n1,2\n")},
+		{"acme/data", "", "old.csv", "asset:RA_two"},
+		{"acme/single", "latest", "", "asset:RA_four"},
+	}
+	for _, tt := range tests {
+		fp, err := New().Fingerprint(ctx, registry.Source{URL: tt.repo, Ref: tt.ref, Path: tt.path})
+		if err != nil || fp != tt.want {
+			t.Errorf("Fingerprint(%s %s %s) = %q, %v; want %q", tt.repo, tt.ref, tt.path, fp, err, tt.want)
+		}
+	}
+
+	errs := []struct{ repo, ref, path, want string }{
+		{"acme/data", "", "", "set source.path to one of: counts.csv, old.csv, bad.csv"},
+		{"acme/data", "v9", "counts.csv", "no release tagged v9"},
+		{"acme/private", "v3", "", "set GITHUB_TOKEN"},
+	}
+	for _, tt := range errs {
+		_, err := New().Fingerprint(ctx, registry.Source{URL: tt.repo, Ref: tt.ref, Path: tt.path})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Fingerprint(%s %s %s) error = %v, want %q", tt.repo, tt.ref, tt.path, err, tt.want)
+		}
+	}
+
+	t.Setenv("GITHUB_TOKEN", "secret")
+	if fp, err := New().Fingerprint(ctx, registry.Source{URL: "acme/private", Ref: "v3"}); err != nil || fp != "asset:RA_four" {
+		t.Errorf("Fingerprint() of a private repository with a token = %q, %v", fp, err)
+	}
+}
+
+func TestFetchVerifies(t *testing.T) {
+	fakeAPI(t)
+	dest := filepath.Join(t.TempDir(), "bad.csv")
+	err := New().Fetch(context.Background(), registry.Source{URL: "acme/data", Path: "bad.csv"}, dest)
+	if err == nil || !strings.Contains(err.Error(), "GitHub records") {
+		t.Fatalf("Fetch() of corrupted content: error = %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("corrupted content was written to the target")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	_, limited := fakeAPI(t)
+	limited.Store(1)
+	_, err := New().Fingerprint(context.Background(), registry.Source{URL: "acme/data", Path: "counts.csv"})
+	var se *httputil.StatusError
+	if !errors.As(err, &se) || !se.Temporary() || se.RetryAfter < 59*time.Minute || !strings.Contains(err.Error(), "rate limit") {
+		t.Errorf("Fingerprint() past the rate limit: error = %v, want a temporary one with the reset an hour off", err)
+	}
+
+	now := time.Now()
+	resp := &http.Response{StatusCode: http.StatusForbidden, Header: http.Header{"Retry-After": {"3"}}}
+	if wait, ok := rateLimit(resp, now); !ok || wait != 3*time.Second {
+		t.Errorf("rateLimit(Retry-After: 3) = %v, %v", wait, ok)
+	}
+	resp.Header = http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {strconv.FormatInt(now.Add(10*time.Second).Unix(), 10)}}
+	if wait, ok := rateLimit(resp, now); !ok || wait < 9*time.Second || wait > 11*time.Second {
+		t.Errorf("rateLimit(reset in 10s) = %v, %v", wait, ok)
+	}
+	resp.Header = http.Header{"X-Ratelimit-Remaining": {"12"}}
+	if _, ok := rateLimit(resp, now); ok {
+		t.Error("rateLimit() of a plain 403 reported a rate limit")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	ctx := context.Background()
+	server, _ := fakeAPI(t)
+	// Probe only recognizes github.com; point its API calls at the fake
+	h := New()
+	h.client.Transport = rewriteTransport{to: server.URL}
+
+	res, err := h.Probe(ctx, "https://github.com/acme/data/releases/download/v1/counts.csv")
+	if err != nil || res == nil || !res.Specific || res.Source.Ref != "v1" || res.Source.Path != "counts.csv" || len(res.ToDo) != 0 {
+		t.Errorf("Probe() of an asset URL = %+v, %v", res, err)
+	}
+	res, err = h.Probe(ctx, "https://github.com/acme/data/releases/latest")
+	if err != nil || res == nil || res.Source.Ref != "latest" || len(res.ToDo) != 1 {
+		t.Errorf("Probe() of the latest release = %+v, %v", res, err)
+	}
+	if res, err := h.Probe(ctx, "https://github.com/acme/data/blob/main/x.csv"); res != nil || err != nil {
+		t.Errorf("Probe() of a non-release page = %+v, %v; want nil, nil", res, err)
+	}
+}
+
+// rewriteTransport sends every request to the server at to instead.
+type rewriteTransport struct{ to string }
+
+func (rt rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = "http", strings.TrimPrefix(rt.to, "http://")
+	return http.DefaultTransport.RoundTrip(req)
+}
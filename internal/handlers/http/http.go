@@ -2,93 +2,302 @@ package http
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jprybylski/datum/internal/canon"
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
 	"github.com/jprybylski/datum/internal/registry"
 )
 
 type handler struct{ client *http.Client }
 
-func New() *handler             { return &handler{client: &http.Client{Timeout: 60 * time.Second}} }
+// New returns the handler. Its requests draw from httputil.DefaultBudget, so
+// parallel fetches respect the configured connection limits.
+func New() *handler {
+	return &handler{client: &http.Client{Timeout: 60 * time.Second, Transport: &httputil.BudgetTransport{}}}
+}
+
 func (h *handler) Name() string { return "http" }
 
+// clientFor returns the client to use for src: h.client, or a copy of it that
+// adds headers and authenticates every request when src configures headers,
+// credentials, signing or an auth profile, keeps to src's rate_limit, and
+// connects through src's proxy and TLS settings, and refuses redirects to
+// hosts src.Hosts doesn't allow.
+func (h *handler) clientFor(src registry.Source) *http.Client {
+	t := h.client.Transport
+	if net := httputil.NetworkTransport(src); net != nil {
+		if b, ok := t.(*httputil.BudgetTransport); ok {
+			budgeted := *b
+			budgeted.Base = net
+			t = &budgeted
+		}
+	}
+	if auth := httputil.NewAuthTransport(t, src); auth != nil {
+		t = auth
+	}
+	if rate := httputil.NewRateTransport(t, src); rate != nil {
+		t = rate
+	}
+	if t == h.client.Transport && src.Hosts == nil {
+		return h.client
+	}
+	c := *h.client
+	c.Transport = t
+	if src.Hosts != nil {
+		c.CheckRedirect = checkRedirectHost(src.Hosts)
+	}
+	return &c
+}
+
+// checkRedirectHost follows redirects, up to net/http's usual limit of 10,
+// to hosts the policy allows only.
+func checkRedirectHost(hosts *registry.HostPolicy) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !hosts.Allows(req.URL.Hostname()) {
+			return fmt.Errorf("redirected to %s, which isn't among the allowed hosts", req.URL.Hostname())
+		}
+		return nil
+	}
+}
+
 func (h *handler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	fp, _, err := h.FingerprintCached(ctx, src)
+	return fp, err
+}
+
+// FingerprintCached computes the fingerprint and also returns the response's
+// caching metadata, implementing registry.CacheAwareFetcher. The first of the
+// source's URL and mirrors that answers is used.
+func (h *handler) FingerprintCached(ctx context.Context, src registry.Source) (string, registry.CacheInfo, error) {
 	if src.URL == "" {
-		return "", errors.New("http: missing source.url")
+		return "", registry.CacheInfo{}, errors.New("http: missing source.url")
 	}
-	// Try HEAD for ETag/Last-Modified
-	req, _ := http.NewRequestWithContext(ctx, http.MethodHead, src.URL, nil)
-	resp, err := h.client.Do(req)
-	if err == nil && resp.StatusCode < 400 {
-		etag := strings.TrimSpace(resp.Header.Get("ETag"))
-		if etag != "" {
-			resp.Body.Close()
-			return "etag:" + etag, nil
-		}
-		lm := resp.Header.Get("Last-Modified")
-		cl := resp.Header.Get("Content-Length")
-		resp.Body.Close()
-		if lm != "" || cl != "" {
-			return fmt.Sprintf("lm:%s|len:%s", lm, cl), nil
+	var info registry.CacheInfo
+	fp, err := failover(ctx, src, func(m registry.Source) (fp string, err error) {
+		fp, info, err = h.fingerprintAt(ctx, m)
+		return fp, err
+	})
+	return fp, info, err
+}
+
+// fingerprintAt fingerprints src at its URL, ignoring any mirrors.
+func (h *handler) fingerprintAt(ctx context.Context, src registry.Source) (string, registry.CacheInfo, error) {
+	if src.Member != "" {
+		fp, err := h.memberFingerprint(ctx, src)
+		return fp, registry.CacheInfo{}, err
+	}
+	// Try HEAD for ETag/Last-Modified. Not with canonicalize: a server that
+	// regenerates the content each time also sends a new ETag each time, so
+	// only the canonicalized content itself can tell whether it changed. Nor
+	// for a POST: HEAD says nothing about what a request body would return.
+	if src.Canonicalize == nil && method(src) == http.MethodGet {
+		if fp, info, ok := h.headFingerprint(ctx, src); ok {
+			return fp, info, nil
 		}
 	}
-	// Fallback: GET and hash (may be large)
-	reqG, _ := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
-	resp2, err := h.client.Do(reqG)
+	// Fallback: send the request and hash the response (may be large)
+	reqG := newRequest(ctx, src)
+	resp2, err := h.clientFor(src).Do(reqG)
 	if err != nil {
-		return "", err
+		return "", registry.CacheInfo{}, err
 	}
 	defer resp2.Body.Close()
 	if resp2.StatusCode >= 400 {
-		return "", fmt.Errorf("http GET %s: %s", src.URL, resp2.Status)
+		return "", registry.CacheInfo{}, httputil.NewStatusError(reqG.Method, src.URL, resp2)
+	}
+	info := httputil.CacheInfo(resp2.Header, time.Now())
+	sum, err := canon.Hash(resp2.Body, src.Canonicalize)
+	if err != nil {
+		return "", registry.CacheInfo{}, err
+	}
+	return "sha256:" + sum, info, nil
+}
+
+// headFingerprint fingerprints src from a HEAD response's ETag, or its
+// Last-Modified and Content-Length. ok is false if HEAD failed or the response
+// had none of them.
+func (h *handler) headFingerprint(ctx context.Context, src registry.Source) (fp string, info registry.CacheInfo, ok bool) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodHead, src.URL, nil)
+	resp, err := h.clientFor(src).Do(req)
+	if err != nil {
+		return "", info, false
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return "", info, false
+	}
+	info = httputil.CacheInfo(resp.Header, time.Now())
+	if etag := strings.TrimSpace(resp.Header.Get("ETag")); etag != "" {
+		return "etag:" + etag, info, true
+	}
+	lm := resp.Header.Get("Last-Modified")
+	cl := resp.Header.Get("Content-Length")
+	if lm != "" || cl != "" {
+		return fmt.Sprintf("lm:%s|len:%s", lm, cl), info, true
+	}
+	return "", info, false
+}
+
+// method returns the HTTP method src is requested with, GET by default.
+func method(src registry.Source) string {
+	if src.Method == "" {
+		return http.MethodGet
 	}
-	hh := sha256.New()
-	if _, err := io.Copy(hh, resp2.Body); err != nil {
-		return "", err
+	return strings.ToUpper(src.Method)
+}
+
+// newRequest builds the request for src's content: a plain GET, or src's
+// method with its body and content type, for APIs that answer POSTs.
+func newRequest(ctx context.Context, src registry.Source) *http.Request {
+	var body io.Reader
+	if src.Body != "" {
+		body = strings.NewReader(src.Body) // Also lets a 307/308 redirect resend it
 	}
-	return "sha256:" + hex.EncodeToString(hh.Sum(nil)), nil
+	req, _ := http.NewRequestWithContext(ctx, method(src), src.URL, body)
+	if src.ContentType != "" {
+		req.Header.Set("Content-Type", src.ContentType)
+	}
+	return req
 }
 
 func (h *handler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	_, err := h.FetchIfChanged(ctx, src, dest, "")
+	return err
+}
+
+// FetchIfChanged implements registry.ConditionalFetcher. An "etag:" fingerprint
+// is sent back as If-None-Match and an "lm:" one as If-Modified-Since; on a 304
+// Not Modified nothing is downloaded. Content-hash fingerprints can't be turned
+// into a conditional request, so those fetch unconditionally. Mirrors are
+// tried in order when the source's URL fails. A download that breaks off is
+// resumed where it stopped by the next attempt (see resume.go).
+func (h *handler) FetchIfChanged(ctx context.Context, src registry.Source, dest, fingerprint string) (bool, error) {
 	if src.URL == "" {
-		return errors.New("http: missing source.url")
+		return false, errors.New("http: missing source.url")
 	}
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
-	resp, err := h.client.Do(req)
+	return failover(ctx, src, func(m registry.Source) (bool, error) {
+		return h.fetchAt(ctx, m, dest, fingerprint)
+	})
+}
+
+// fetchAt is FetchIfChanged for src's URL alone.
+func (h *handler) fetchAt(ctx context.Context, src registry.Source, dest, fingerprint string) (bool, error) {
+	if src.Member != "" {
+		return true, h.fetchMember(ctx, src, dest) // Member fingerprints can't be sent as conditions
+	}
+	req := newRequest(ctx, src)
+	if etag, ok := strings.CutPrefix(fingerprint, "etag:"); ok {
+		req.Header.Set("If-None-Match", etag)
+	} else if rest, ok := strings.CutPrefix(fingerprint, "lm:"); ok {
+		if lm, _, _ := strings.Cut(rest, "|len:"); lm != "" {
+			req.Header.Set("If-Modified-Since", lm)
+		}
+	}
+	first, last := int64(0), int64(-1)
+	if src.Range != "" {
+		var err error
+		if first, last, err = httputil.ParseRange(src.Range, 0); err != nil {
+			return false, fmt.Errorf("http: %w", err)
+		}
+		spec := fmt.Sprintf("bytes=%d-", first)
+		if last >= 0 {
+			spec += strconv.FormatInt(last, 10)
+		}
+		req.Header.Set("Range", spec)
+	}
+	var part *partial
+	if resumable(src) {
+		part = loadPartial(dest, src.URL)
+		part.setRange(req)
+	}
+	resp, err := h.clientFor(src).Do(req)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer resp.Body.Close()
+	conditional := req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		return false, nil
+	}
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && part != nil && part.size > 0 {
+		// The partial download is no part of the file as it is now
+		resp.Body.Close()
+		part.discard()
+		return h.fetchAt(ctx, src, dest, fingerprint)
+	}
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("http GET %s: %s", src.URL, resp.Status)
+		return false, httputil.NewStatusError(req.Method, src.URL, resp)
 	}
-	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-		return err
+	// Refuse error/login pages served with 200 before they reach dest
+	if want := src.Expect.ContentType; want != "" {
+		if got := resp.Header.Get("Content-Type"); !httputil.MatchContentType(got, want) {
+			return false, fmt.Errorf("http %s %s: content type %q, expected %q", req.Method, src.URL, got, want)
+		}
 	}
-	tmp := dest + ".tmp"
-	f, err := os.Create(tmp)
+	body, size := io.Reader(resp.Body), resp.ContentLength
+	if src.Range != "" {
+		if body, err = httputil.RangeBody(resp, first, last); err != nil {
+			return false, fmt.Errorf("http %s %s: %w", req.Method, src.URL, err)
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			size = -1 // The whole file came back and is being cut down
+		}
+	}
+	if part != nil {
+		return true, part.write(resp, dest, src.Progress)
+	}
+	return true, fsutil.WriteFileAtomic(dest, httputil.ProgressReader(body, src.Progress, size))
+}
+
+// ModTime returns the source's Last-Modified time, implementing registry.ModTimer.
+// Only GET sources have one: a HEAD can't stand in for another method.
+func (h *handler) ModTime(ctx context.Context, src registry.Source) (time.Time, error) {
+	if src.URL == "" {
+		return time.Time{}, errors.New("http: missing source.url")
+	}
+	if m := method(src); m != http.MethodGet {
+		return time.Time{}, fmt.Errorf("http %s %s: no modification time for %s requests", m, src.URL, m)
+	}
+	return failover(ctx, src, func(m registry.Source) (time.Time, error) {
+		return h.modTimeAt(ctx, m)
+	})
+}
+
+// modTimeAt is ModTime for src's URL alone.
+func (h *handler) modTimeAt(ctx context.Context, src registry.Source) (time.Time, error) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodHead, src.URL, nil)
+	resp, err := h.clientFor(src).Do(req)
 	if err != nil {
-		return err
+		return time.Time{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return time.Time{}, httputil.NewStatusError(http.MethodHead, src.URL, resp)
 	}
-	if _, err := io.Copy(f, resp.Body); err != nil {
-		f.Close()
-		_ = os.Remove(tmp)
-		return err
+	lm := resp.Header.Get("Last-Modified")
+	if lm == "" {
+		return time.Time{}, fmt.Errorf("http HEAD %s: no Last-Modified header", src.URL)
 	}
-	if err := f.Close(); err != nil {
-		_ = os.Remove(tmp)
-		return err
+	return http.ParseTime(lm)
+}
+
+// Relocated reports a permanent redirect (301/308) of src.URL, implementing registry.Relocator.
+func (h *handler) Relocated(ctx context.Context, src registry.Source) (string, error) {
+	if src.URL == "" {
+		return "", errors.New("http: missing source.url")
 	}
-	return os.Rename(tmp, dest)
+	return httputil.PermanentLocation(ctx, h.clientFor(src), http.MethodHead, src.URL)
 }
 
 func init() {
@@ -2,12 +2,18 @@ package http
 
 import (
 	"context"
+	"encoding/pem"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jprybylski/datum/internal/handlertest"
 	"github.com/jprybylski/datum/internal/registry"
 )
 
@@ -173,6 +179,41 @@ func TestHandler_Fetch(t *testing.T) {
 		}
 	})
 
+	t.Run("unexpected content type", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html>please log in</html>"))
+		}))
+		defer server.Close()
+
+		h := New()
+		destFile := filepath.Join(tmpDir, "expect.csv")
+		os.WriteFile(destFile, []byte("good,data\n"), 0o644)
+		src := registry.Source{URL: server.URL, Expect: registry.Expect{ContentType: "text/csv, application/gzip"}}
+
+		err := h.Fetch(ctx, src, destFile)
+		if err == nil || !strings.Contains(err.Error(), "text/html") {
+			t.Fatalf("Fetch() error = %v, want content type error naming text/html", err)
+		}
+		if got, _ := os.ReadFile(destFile); string(got) != "good,data\n" {
+			t.Errorf("target was overwritten: %q", got)
+		}
+	})
+
+	t.Run("expected content type", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+			w.Write([]byte("a,b\n"))
+		}))
+		defer server.Close()
+
+		h := New()
+		src := registry.Source{URL: server.URL, Expect: registry.Expect{ContentType: "text/csv"}}
+		if err := h.Fetch(ctx, src, filepath.Join(tmpDir, "ok.csv")); err != nil {
+			t.Errorf("Fetch() error = %v", err)
+		}
+	})
+
 	t.Run("creates parent directories", func(t *testing.T) {
 		content := "test"
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -196,3 +237,405 @@ func TestHandler_Fetch(t *testing.T) {
 		}
 	})
 }
+
+func TestHandler_Post(t *testing.T) {
+	ctx := context.Background()
+	query := `{"query":"{ codes { id } }"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// An ETag on HEAD says nothing about what the POST returns
+		w.Header().Set("ETag", `"static"`)
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != query || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"data":{"codes":[{"id":1}]}}`))
+	}))
+	defer server.Close()
+
+	h := New()
+	src := registry.Source{URL: server.URL, Method: "post", Body: query, ContentType: "application/json"}
+	fp, err := h.Fingerprint(ctx, src)
+	if err != nil || !strings.HasPrefix(fp, "sha256:") {
+		t.Fatalf("Fingerprint() = %q, %v; want the response's sha256", fp, err)
+	}
+	dest := filepath.Join(t.TempDir(), "codes.json")
+	if err := h.Fetch(ctx, src, dest); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != `{"data":{"codes":[{"id":1}]}}` {
+		t.Errorf("Fetch() wrote %q", got)
+	}
+	if _, err := h.ModTime(ctx, src); err == nil {
+		t.Error("ModTime() of a POST source succeeded")
+	}
+
+	src.Body = `{"query":"{ other }"}`
+	if err := h.Fetch(ctx, src, dest); err == nil || !strings.Contains(err.Error(), "POST") {
+		t.Errorf("Fetch() of a rejected POST error = %v, want a POST status error", err)
+	}
+}
+
+func TestHandler_Relocated(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/new.csv", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/old.csv", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new.csv", http.StatusMovedPermanently)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	h := New()
+	got, err := h.Relocated(context.Background(), registry.Source{URL: server.URL + "/old.csv"})
+	if err != nil {
+		t.Fatalf("Relocated() error = %v", err)
+	}
+	if want := server.URL + "/new.csv"; got != want {
+		t.Errorf("Relocated() = %q, want %q", got, want)
+	}
+
+	got, err = h.Relocated(context.Background(), registry.Source{URL: server.URL + "/new.csv"})
+	if err != nil || got != "" {
+		t.Errorf("Relocated() on canonical URL = %q, %v; want \"\", nil", got, err)
+	}
+}
+
+func TestHandler_RedirectHosts(t *testing.T) {
+	// The server is both 127.0.0.1 and localhost; /moved.csv sends clients
+	// from one to the other
+	var port string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/data.csv", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("a,b\n")) })
+	mux.HandleFunc("/moved.csv", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost:"+port+"/data.csv", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	port = server.URL[strings.LastIndex(server.URL, ":")+1:]
+	moved := "http://127.0.0.1:" + port + "/moved.csv"
+
+	h := New()
+	dest := filepath.Join(t.TempDir(), "data.csv")
+	src := registry.Source{URL: moved, Hosts: &registry.HostPolicy{Lists: [][]string{{"127.0.0.1"}}}}
+	if err := h.Fetch(context.Background(), src, dest); err == nil || !strings.Contains(err.Error(), "allowed hosts") {
+		t.Errorf("Fetch() redirected off the allowed hosts: error = %v, want it refused", err)
+	}
+	src.Hosts.Lists[0] = append(src.Hosts.Lists[0], "localhost")
+	if err := h.Fetch(context.Background(), src, dest); err != nil {
+		t.Errorf("Fetch() redirected to an allowed host: error = %v", err)
+	}
+}
+
+func TestHandler_FetchRange(t *testing.T) {
+	const content = "0123456789abcdef"
+	// /ranged honors Range headers (http.ServeContent does); /plain ignores them
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ranged" {
+			http.ServeContent(w, r, "data.bin", time.Time{}, strings.NewReader(content))
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+	h := New()
+
+	tests := []struct {
+		path, rng, want string
+	}{
+		{"/ranged", "2-5", "2345"},
+		{"/ranged", "10-", "abcdef"},
+		{"/plain", "2-5", "2345"},
+		{"/plain", "10-", "abcdef"},
+	}
+	for _, tt := range tests {
+		dest := filepath.Join(t.TempDir(), "out")
+		err := h.Fetch(context.Background(), registry.Source{URL: server.URL + tt.path, Range: tt.rng}, dest)
+		if b, _ := os.ReadFile(dest); err != nil || string(b) != tt.want {
+			t.Errorf("Fetch(%s, range %s) = %q, %v; want %q", tt.path, tt.rng, b, err, tt.want)
+		}
+	}
+
+	// The fingerprint covers the whole source, whatever the range
+	full, _ := h.Fingerprint(context.Background(), registry.Source{URL: server.URL + "/plain"})
+	ranged, _ := h.Fingerprint(context.Background(), registry.Source{URL: server.URL + "/plain", Range: "2-5"})
+	if full == "" || full != ranged {
+		t.Errorf("Fingerprint with range = %q, without = %q; want the same", ranged, full)
+	}
+}
+
+func TestHandler_ModTime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dated":
+			w.Header().Set("Last-Modified", "Sat, 01 Jun 2024 12:00:00 GMT")
+		case "/rfc850":
+			w.Header().Set("Last-Modified", "Saturday, 01-Jun-24 12:00:00 GMT")
+		case "/asctime":
+			w.Header().Set("Last-Modified", "Sat Jun  1 12:00:00 2024")
+		case "/localized":
+			// What a server formatting with a German locale sends: invalid
+			w.Header().Set("Last-Modified", "Sa, 01 Jun 2024 12:00:00 GMT")
+		}
+	}))
+	defer server.Close()
+	h := New()
+
+	// All three formats HTTP allows, whatever the machine's locale
+	want := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, path := range []string{"/dated", "/rfc850", "/asctime"} {
+		got, err := h.ModTime(context.Background(), registry.Source{URL: server.URL + path})
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ModTime(%s) = %v, %v; want %v", path, got, err, want)
+		}
+	}
+	if got, err := h.ModTime(context.Background(), registry.Source{URL: server.URL + "/localized"}); err == nil {
+		t.Errorf("ModTime() with a localized Last-Modified = %v, want an error", got)
+	}
+	if _, err := h.ModTime(context.Background(), registry.Source{URL: server.URL + "/undated"}); err == nil {
+		t.Error("ModTime() without Last-Modified succeeded")
+	}
+}
+
+func TestHandler_Sign(t *testing.T) {
+	t.Setenv("TEST_SIGN_SECRET", "s3cret")
+	var unsigned int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "HMAC ci:") || r.Header.Get("Date") == "" {
+			unsigned++
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("signed data"))
+	}))
+	defer server.Close()
+
+	h := New()
+	src := registry.Source{URL: server.URL + "/data.csv", Sign: &registry.Signing{Scheme: "hmac", SecretKeyEnv: "TEST_SIGN_SECRET", KeyID: "ci"}}
+	if fp, err := h.Fingerprint(context.Background(), src); err != nil || fp != `etag:"v1"` {
+		t.Errorf("Fingerprint() = %q, %v", fp, err)
+	}
+	dest := filepath.Join(t.TempDir(), "out.csv")
+	if err := h.Fetch(context.Background(), src, dest); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if b, _ := os.ReadFile(dest); string(b) != "signed data" {
+		t.Errorf("fetched %q", b)
+	}
+	if unsigned != 0 {
+		t.Errorf("%d requests arrived unsigned", unsigned)
+	}
+
+	// Missing credentials fail before anything is sent
+	src.Sign.SecretKeyEnv = "TEST_SIGN_UNSET"
+	if err := h.Fetch(context.Background(), src, dest); err == nil || !strings.Contains(err.Error(), "TEST_SIGN_UNSET") {
+		t.Errorf("Fetch() without credentials error = %v", err)
+	}
+}
+
+func TestHandler_BearerToken(t *testing.T) {
+	t.Setenv("TEAM_A_TOKEN", "scoped")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer scoped" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("team data"))
+	}))
+	defer server.Close()
+
+	h := New()
+	src := registry.Source{URL: server.URL, Credentials: &registry.Credentials{Profile: "team-a", TokenEnv: "TEAM_A_TOKEN"}}
+	dest := filepath.Join(t.TempDir(), "out.csv")
+	if err := h.Fetch(context.Background(), src, dest); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	src.Credentials.TokenEnv = "TEAM_A_UNSET_TOKEN"
+	if err := h.Fetch(context.Background(), src, dest); err == nil || !strings.Contains(err.Error(), "TEAM_A_UNSET_TOKEN") {
+		t.Errorf("Fetch() with unset token error = %v, want it to name the variable", err)
+	}
+}
+
+func TestHandler_SourceAuth(t *testing.T) {
+	t.Setenv("API_TOKEN", "t0ken")
+	t.Setenv("API_BASIC", "alice:pa:ss")
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Version") != "2" {
+			http.Error(w, "missing header", http.StatusBadRequest)
+			return
+		}
+		user, pass, basic := r.BasicAuth()
+		if r.Header.Get("Authorization") != "Bearer t0ken" && !(basic && user == "alice" && pass == "pa:ss") {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		methods = append(methods, r.Method)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("private data"))
+	}))
+	defer server.Close()
+
+	h := New()
+	dest := filepath.Join(t.TempDir(), "out.csv")
+	for _, src := range []registry.Source{
+		{URL: server.URL, Headers: map[string]string{"X-Api-Version": "2"}, BearerTokenEnv: "API_TOKEN"},
+		{URL: server.URL, Headers: map[string]string{"X-Api-Version": "2"}, BasicAuthEnv: "API_BASIC"},
+	} {
+		methods = nil
+		if fp, err := h.Fingerprint(context.Background(), src); err != nil || fp != `etag:"v1"` {
+			t.Errorf("Fingerprint() = %q, %v", fp, err)
+		}
+		if err := h.Fetch(context.Background(), src, dest); err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		if strings.Join(methods, ",") != "HEAD,GET" {
+			t.Errorf("authenticated requests = %v, want HEAD and GET", methods)
+		}
+	}
+
+	// An unset variable fails before anything is sent, naming the variable
+	src := registry.Source{URL: server.URL, BearerTokenEnv: "API_TOKEN_UNSET"}
+	if err := h.Fetch(context.Background(), src, dest); err == nil || !strings.Contains(err.Error(), "API_TOKEN_UNSET") {
+		t.Errorf("Fetch() with unset token error = %v", err)
+	}
+	t.Setenv("API_BASIC", "no-colon")
+	src = registry.Source{URL: server.URL, BasicAuthEnv: "API_BASIC"}
+	if err := h.Fetch(context.Background(), src, dest); err == nil || !strings.Contains(err.Error(), "user:password") {
+		t.Errorf("Fetch() with malformed basic auth error = %v", err)
+	}
+}
+
+func TestHandler_Canonicalize(t *testing.T) {
+	var heads, n int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads++
+		}
+		n++
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n)) // Regenerated every time
+		fmt.Fprintf(w, `{"generated_at": "%d", "rows": [1, 2]}`, n)
+	}))
+	defer server.Close()
+	h := New()
+
+	src := registry.Source{URL: server.URL, Canonicalize: &registry.Canonicalize{StripFields: []string{"generated_at"}}}
+	fp1, err := h.Fingerprint(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp2, _ := h.Fingerprint(context.Background(), src)
+	if fp1 != fp2 || !strings.HasPrefix(fp1, "sha256:") {
+		t.Errorf("fingerprints %q, %q; want the same content hash", fp1, fp2)
+	}
+	if heads != 0 {
+		t.Errorf("%d HEAD requests; the ETag can't be trusted with canonicalize", heads)
+	}
+}
+
+func TestHandler_FetchIfChanged(t *testing.T) {
+	const lm = "Sat, 01 Jun 2024 12:00:00 GMT"
+	var downloads int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` || r.Header.Get("If-Modified-Since") == lm {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("big file"))
+	}))
+	defer server.Close()
+	h := New()
+	src := registry.Source{URL: server.URL}
+
+	tests := []struct {
+		fingerprint string
+		wantFetched bool
+	}{
+		{`etag:"v1"`, false},
+		{"lm:" + lm + "|len:8", false},
+		{`etag:"v0"`, true},                         // Changed upstream
+		{"sha256:" + strings.Repeat("0", 64), true}, // Nothing to send conditionally
+		{"lm:|len:8", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		dest := filepath.Join(t.TempDir(), "out.bin")
+		downloads = 0
+		fetched, err := h.FetchIfChanged(context.Background(), src, dest, tt.fingerprint)
+		if err != nil || fetched != tt.wantFetched {
+			t.Errorf("FetchIfChanged(%q) = %v, %v; want %v", tt.fingerprint, fetched, err, tt.wantFetched)
+			continue
+		}
+		_, statErr := os.Stat(dest)
+		if tt.wantFetched && (downloads != 1 || statErr != nil) {
+			t.Errorf("FetchIfChanged(%q): %d downloads, dest: %v", tt.fingerprint, downloads, statErr)
+		}
+		if !tt.wantFetched && !os.IsNotExist(statErr) {
+			t.Errorf("FetchIfChanged(%q) wrote dest on 304", tt.fingerprint)
+		}
+	}
+}
+
+// lastProgress remembers the last byte count reported to it.
+type lastProgress struct{ done, total int64 }
+
+func (p *lastProgress) Bytes(done, total int64) { p.done, p.total = done, total }
+func (p *lastProgress) Status(string)           {}
+
+func TestHandler_FetchProgress(t *testing.T) {
+	body := strings.Repeat("x", 100_000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	p := &lastProgress{}
+	dest := filepath.Join(t.TempDir(), "out")
+	if err := New().Fetch(context.Background(), registry.Source{URL: server.URL, Progress: p}, dest); err != nil {
+		t.Fatal(err)
+	}
+	if p.done != int64(len(body)) || p.total != int64(len(body)) {
+		t.Errorf("last progress = %d of %d, want %d of %d", p.done, p.total, len(body), len(body))
+	}
+}
+
+func TestConformance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("http content"))
+	}))
+	defer server.Close()
+
+	handlertest.Run(t, New(), handlertest.Fixtures{
+		Valid:   []handlertest.Fixture{{Source: registry.Source{Type: "http", URL: server.URL}, Content: []byte("http content")}},
+		Invalid: []registry.Source{{Type: "http"}},
+	})
+}
+
+func TestHandler_CAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "private")
+	}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o644)
+
+	dest := filepath.Join(t.TempDir(), "out.txt")
+	if err := New().Fetch(context.Background(), registry.Source{URL: server.URL}, dest); err == nil {
+		t.Fatal("Fetch() trusted a private CA without ca_file")
+	}
+	if err := New().Fetch(context.Background(), registry.Source{URL: server.URL, CAFile: caFile}, dest); err != nil {
+		t.Fatalf("Fetch() with ca_file error = %v", err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != "private" {
+		t.Errorf("target = %q, want the server's content", got)
+	}
+}
@@ -0,0 +1,30 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// failover runs op against src's URL and then each of its mirrors, until one
+// succeeds. Scientific mirrors go down often enough that a source listing
+// several should keep working while any of them is up. If all of them fail,
+// the errors are returned together, so each location's failure is visible;
+// errors.Join keeps them inspectable with errors.As, which is what retries
+// use to tell a transient failure from a permanent one.
+//
+// A cancelled run stops at once rather than knocking on every mirror.
+func failover[T any](ctx context.Context, src registry.Source, op func(registry.Source) (T, error)) (T, error) {
+	var errs []error
+	for _, m := range src.Mirrored() {
+		v, err := op(m)
+		if err == nil || len(src.Mirrors) == 0 || ctx.Err() != nil {
+			return v, err
+		}
+		errs = append(errs, err) // Already names the URL
+	}
+	var zero T
+	return zero, fmt.Errorf("http: all %d mirrors failed: %w", len(errs), errors.Join(errs...))
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestHandler_Mirrors(t *testing.T) {
+	ctx := context.Background()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("mirrored data"))
+	}))
+	defer up.Close()
+
+	h := New()
+	src := registry.Source{URL: down.URL + "/x", Mirrors: []string{down.URL + "/y", up.URL + "/x"}}
+
+	fp, err := h.Fingerprint(ctx, src)
+	if err != nil || fp != `etag:"v1"` {
+		t.Errorf("Fingerprint() = %q, %v; want the answering mirror's ETag", fp, err)
+	}
+	dest := filepath.Join(t.TempDir(), "out")
+	if err := h.Fetch(ctx, src, dest); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if b, _ := os.ReadFile(dest); string(b) != "mirrored data" {
+		t.Errorf("fetched %q", b)
+	}
+
+	// With every mirror down, each one's failure is reported
+	src.Mirrors = src.Mirrors[:1]
+	_, err = h.Fingerprint(ctx, src)
+	if err == nil || !strings.Contains(err.Error(), "all 2 mirrors failed") || !strings.Contains(err.Error(), "/y") {
+		t.Errorf("Fingerprint() error = %v", err)
+	}
+}
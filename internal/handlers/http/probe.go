@@ -0,0 +1,81 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// checksumHeaders are response headers in which servers and object stores
+// publish a checksum of the content.
+var checksumHeaders = []string{"Content-MD5", "Digest", "Repr-Digest", "X-Goog-Hash", "X-Amz-Checksum-Sha256", "X-Amz-Checksum-Crc32", "X-Amz-Meta-Sha256"}
+
+// Probe implements registry.Prober for http(s) URLs. It sends a HEAD, and a
+// GET (headers only) if the server won't answer HEAD, and reports which of
+// the fingerprints that fingerprintAt tries would work for the URL.
+func (h *handler) Probe(ctx context.Context, location string) (*registry.ProbeResult, error) {
+	u, err := url.Parse(location)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, nil
+	}
+	res := &registry.ProbeResult{Source: registry.Source{Type: "http", URL: location}}
+
+	if moved, err := h.Relocated(ctx, res.Source); err == nil && moved != "" {
+		res.Notes = append(res.Notes, fmt.Sprintf("permanently moved to %s; suggesting the new URL", moved))
+		res.Source.URL = moved
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodHead, res.Source.URL, nil)
+	resp, err := h.client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	headOK := err == nil && resp.StatusCode < 400
+	if !headOK {
+		if err == nil {
+			res.Notes = append(res.Notes, fmt.Sprintf("HEAD not supported (%s), so every check downloads the whole file", resp.Status))
+		}
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, res.Source.URL, nil)
+		if resp, err = h.client.Do(req); err != nil {
+			return nil, err
+		}
+		resp.Body.Close() // Only the headers are of interest
+		if resp.StatusCode >= 400 {
+			return nil, httputil.NewStatusError(http.MethodGet, res.Source.URL, resp)
+		}
+	}
+
+	if headOK {
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			res.Fingerprints = append(res.Fingerprints, fmt.Sprintf("etag %s (HEAD)", etag))
+		}
+		if lm, cl := resp.Header.Get("Last-Modified"), resp.Header.Get("Content-Length"); lm != "" || cl != "" {
+			res.Fingerprints = append(res.Fingerprints, fmt.Sprintf("last-modified %q and length %q (HEAD)", lm, cl))
+		}
+	}
+	res.Fingerprints = append(res.Fingerprints, "sha256 of the content (GET, reads the whole file)")
+
+	for _, name := range checksumHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			res.Notes = append(res.Notes, fmt.Sprintf("checksum header %s: %s", name, v))
+		}
+	}
+	if resp.Header.Get("Accept-Ranges") == "bytes" {
+		res.Notes = append(res.Notes, "supports range requests (range:, and member: for zip archives)")
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		res.Notes = append(res.Notes, "content type "+ct)
+		if strings.HasPrefix(ct, "text/html") {
+			res.Notes = append(res.Notes, "an HTML page: if this is a download link, check it doesn't need a login (see expect.content_type)")
+		}
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "" {
+		res.Notes = append(res.Notes, "cache-control "+cc)
+	}
+	return res, nil
+}
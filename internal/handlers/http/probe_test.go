@@ -0,0 +1,82 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler_Probe(t *testing.T) {
+	ctx := context.Background()
+	h := New()
+
+	t.Run("not an http URL", func(t *testing.T) {
+		for _, loc := range []string{"data/file.csv", "git@github.com:org/repo.git", "sftp://host/x"} {
+			if res, err := h.Probe(ctx, loc); res != nil || err != nil {
+				t.Errorf("Probe(%q) = %+v, %v; want nil, nil", loc, res, err)
+			}
+		}
+	})
+
+	t.Run("HEAD with ETag and checksum", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("X-Goog-Hash", "md5=abc")
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Type", "text/csv")
+		}))
+		defer server.Close()
+
+		res, err := h.Probe(ctx, server.URL+"/data.csv")
+		if err != nil {
+			t.Fatalf("Probe() error = %v", err)
+		}
+		if res.Source.Type != "http" || res.Source.URL != server.URL+"/data.csv" {
+			t.Errorf("Source = %+v", res.Source)
+		}
+		if len(res.Fingerprints) == 0 || !strings.HasPrefix(res.Fingerprints[0], `etag "v1"`) {
+			t.Errorf("Fingerprints = %q, want the ETag first", res.Fingerprints)
+		}
+		notes := strings.Join(res.Notes, "\n")
+		for _, want := range []string{"X-Goog-Hash: md5=abc", "range requests", "text/csv"} {
+			if !strings.Contains(notes, want) {
+				t.Errorf("Notes missing %q: %q", want, res.Notes)
+			}
+		}
+	})
+
+	t.Run("HEAD refused", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Write([]byte("data"))
+		}))
+		defer server.Close()
+
+		res, err := h.Probe(ctx, server.URL+"/x")
+		if err != nil {
+			t.Fatalf("Probe() error = %v", err)
+		}
+		if len(res.Fingerprints) != 1 || !strings.HasPrefix(res.Fingerprints[0], "sha256") {
+			t.Errorf("Fingerprints = %q, want only the content hash", res.Fingerprints)
+		}
+		if !strings.Contains(strings.Join(res.Notes, "\n"), "HEAD not supported") {
+			t.Errorf("Notes = %q", res.Notes)
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		if _, err := h.Probe(ctx, server.URL+"/missing"); err == nil {
+			t.Error("Probe() of a 404 succeeded")
+		}
+	})
+}
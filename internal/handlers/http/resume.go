@@ -0,0 +1,143 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Resumable downloads: a download that's cut off keeps what it got at
+// fsutil.PartialPath, along with the URL and the response's ETag. The next
+// attempt (a retry, or a later run) asks for the rest only, with a Range
+// request guarded by If-Range: a server whose file has changed since sends
+// all of it instead, and the download starts over. Without a strong ETag a
+// partial download can't be checked that way, so it isn't kept.
+
+// resumable reports whether downloads of src can be resumed: GETs of the
+// whole file. A POST's response, or a slice, can't be continued.
+func resumable(src registry.Source) bool {
+	return src.Range == "" && method(src) == http.MethodGet
+}
+
+// partial is the interrupted download of a URL to a destination, if any.
+type partial struct {
+	path string // The partial file
+	url  string
+	etag string // ETag of the response it's from; "" if there is none to resume
+	size int64  // Bytes downloaded so far
+}
+
+// loadPartial returns the partial download of url to dest. One of another
+// URL, or without its ETag, isn't resumed; it's overwritten.
+func loadPartial(dest, url string) *partial {
+	p := &partial{path: fsutil.PartialPath(dest), url: url}
+	b, err := os.ReadFile(p.validatorPath())
+	if err != nil {
+		return p
+	}
+	gotURL, etag, _ := strings.Cut(strings.TrimSpace(string(b)), "\n")
+	fi, err := os.Stat(p.path)
+	if err != nil || gotURL != url || etag == "" {
+		return p
+	}
+	p.etag, p.size = etag, fi.Size()
+	return p
+}
+
+// validatorPath returns where the URL and ETag of p are kept. The name ends
+// like p's own, so CleanStaleTemps treats both the same.
+func (p *partial) validatorPath() string {
+	return strings.TrimSuffix(p.path, ".tmp") + "-etag.tmp"
+}
+
+// setRange asks req for the part of the file p is missing, if p has any.
+func (p *partial) setRange(req *http.Request) {
+	if p.size > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", p.size))
+		req.Header.Set("If-Range", p.etag)
+	}
+}
+
+// discard removes the partial download.
+func (p *partial) discard() {
+	os.Remove(p.path)
+	os.Remove(p.validatorPath())
+	p.etag, p.size = "", 0
+}
+
+// write saves resp's body to dest by way of p: appended to what p has when
+// resp is the rest of it, or in its place when resp is the whole file. If
+// the transfer breaks off, what arrived is kept for the next attempt.
+func (p *partial) write(resp *http.Response, dest string, progress registry.Progress) error {
+	etag := strongETag(resp.Header)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resp.StatusCode == http.StatusPartialContent {
+		if p.size == 0 || etag != p.etag || !continues(resp.Header.Get("Content-Range"), p.size) {
+			p.discard()
+			return fmt.Errorf("http GET %s: range response doesn't continue the partial download; starting over", p.url)
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+	} else if etag != "" {
+		if err := os.MkdirAll(filepath.Dir(p.path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p.validatorPath(), []byte(p.url+"\n"+etag+"\n"), 0o644); err != nil {
+			return err
+		}
+	} else {
+		os.Remove(p.validatorPath())
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p.path, flags, 0o600) // Like WriteFileAtomic's temp files
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(fsutil.FileMode(dest)); err != nil { // And given the target's mode like them
+		f.Close()
+		return err
+	}
+	_, err = io.Copy(f, httputil.ProgressReader(resp.Body, progress, resp.ContentLength))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		if etag == "" {
+			p.discard() // Nothing to resume it by
+		}
+		return err
+	}
+	os.Remove(p.validatorPath())
+	if err := os.Rename(p.path, dest); err != nil {
+		p.discard()
+		return err
+	}
+	return nil
+}
+
+// strongETag returns h's ETag unless it's missing or weak: If-Range only
+// works with strong ones.
+func strongETag(h http.Header) string {
+	etag := strings.TrimSpace(h.Get("ETag"))
+	if strings.HasPrefix(etag, "W/") {
+		return ""
+	}
+	return etag
+}
+
+// continues reports whether a Content-Range header covers the file from
+// byte offset on.
+func continues(contentRange string, offset int64) bool {
+	var first, last int64
+	_, err := fmt.Sscanf(contentRange, "bytes %d-%d/", &first, &last)
+	return err == nil && first == offset
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestHandler_FetchResumes(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	etag := `"v1"`
+	cut := true // Break off the next full download halfway
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", etag)
+		if cut && r.Header.Get("Range") == "" {
+			cut = false
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			return // The client sees the body end early
+		}
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	h := New()
+	src := registry.Source{URL: server.URL}
+	dest := filepath.Join(t.TempDir(), "data.bin")
+
+	if err := h.Fetch(ctx, src, dest); err == nil {
+		t.Fatal("Fetch() of a broken-off download succeeded")
+	}
+	if fi, err := os.Stat(loadPartial(dest, server.URL).path); err != nil || fi.Size() != int64(len(content)/2) {
+		t.Fatalf("partial download not kept: %v", err)
+	}
+
+	if err := h.Fetch(ctx, src, dest); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if want := "bytes=" + strconv.Itoa(len(content)/2) + "-"; ranges[1] != want {
+		t.Errorf("second request's Range = %q, want %q", ranges[1], want)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, content) {
+		t.Errorf("resumed download is %d bytes, want the %d of the file", len(got), len(content))
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(dest)); len(entries) != 1 {
+		t.Errorf("%d files left next to the target, want only the target", len(entries))
+	}
+
+	// The file changed while the download was interrupted: If-Range makes
+	// the server send all of it
+	cut = true
+	h.Fetch(ctx, src, dest)
+	etag = `"v2"`
+	content = bytes.Repeat([]byte("abcdefghij"), 1000)
+	if err := h.Fetch(ctx, src, dest); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, content) {
+		t.Error("download resumed across a change of the file")
+	}
+}
+
+func TestHandler_FetchNoResumeWithoutETag(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("cut short"))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "data.bin")
+	if err := New().Fetch(context.Background(), registry.Source{URL: server.URL}, dest); err == nil {
+		t.Fatal("Fetch() of a broken-off download succeeded")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(dest)); len(entries) != 0 {
+		t.Errorf("%d files left behind, want none: the download can't be validated", len(entries))
+	}
+}
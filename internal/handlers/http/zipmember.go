@@ -0,0 +1,110 @@
+package http
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Zip members: a source with member set names one file inside a remote zip
+// archive. A zip's central directory sits at the end of the archive and
+// records where each member starts, its size and its CRC-32, so with range
+// requests the handler can list the archive and copy one member while
+// downloading only a few blocks of it (see httputil.RangeReader).
+//
+// Servers that ignore Range headers get the slow path: the whole archive is
+// downloaded to a scratch directory and the member read from there.
+
+// memberFingerprint fingerprints src's member as "crc32:<hex>|size:<bytes>",
+// straight from the archive's directory. Unlike the archive's ETag, it only
+// changes when the member itself does.
+func (h *handler) memberFingerprint(ctx context.Context, src registry.Source) (string, error) {
+	f, done, err := h.openMember(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+	return fmt.Sprintf("crc32:%08x|size:%d", f.CRC32, f.UncompressedSize64), nil
+}
+
+// fetchMember writes src's member to dest. archive/zip checks the member's
+// CRC-32 as it's read, so a corrupt copy fails instead of reaching dest.
+func (h *handler) fetchMember(ctx context.Context, src registry.Source, dest string) error {
+	f, done, err := h.openMember(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer done()
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("zip member %s: %w", src.Member, err)
+	}
+	defer rc.Close()
+	return fsutil.WriteFileAtomic(dest, httputil.ProgressReader(rc, src.Progress, int64(f.UncompressedSize64)))
+}
+
+// openMember finds src's member in the remote archive. done releases whatever
+// was needed to read it (a downloaded copy of the archive, on the slow path).
+func (h *handler) openMember(ctx context.Context, src registry.Source) (f *zip.File, done func(), err error) {
+	done = func() {}
+	var zr *zip.Reader
+	rr, err := httputil.NewRangeReader(ctx, h.clientFor(src), src.URL)
+	switch {
+	case errors.Is(err, httputil.ErrRangesUnsupported):
+		dir, err := fsutil.MkdirTemp("datum-zip-*")
+		if err != nil {
+			return nil, done, err
+		}
+		done = func() { os.RemoveAll(dir) }
+		path := filepath.Join(dir, "archive.zip")
+		if err := h.download(ctx, src, path); err != nil {
+			done()
+			return nil, func() {}, err
+		}
+		zc, err := zip.OpenReader(path)
+		if err != nil {
+			done()
+			return nil, func() {}, fmt.Errorf("%s: %w", src.URL, err)
+		}
+		done = func() { zc.Close(); os.RemoveAll(dir) }
+		zr = &zc.Reader
+	case err != nil:
+		return nil, done, err
+	default:
+		if zr, err = zip.NewReader(rr, rr.Size()); err != nil {
+			return nil, done, fmt.Errorf("%s: %w", src.URL, err)
+		}
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(src.Member, "./"), "/")
+	for _, f := range zr.File {
+		if f.Name == name {
+			return f, done, nil
+		}
+	}
+	done()
+	return nil, func() {}, fmt.Errorf("%s: no member %q in the archive (%d entries)", src.URL, src.Member, len(zr.File))
+}
+
+// download saves the whole of src.URL to path.
+func (h *handler) download(ctx context.Context, src registry.Source, path string) error {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+	resp, err := h.clientFor(src).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return httputil.NewStatusError(http.MethodGet, src.URL, resp)
+	}
+	return fsutil.WriteFileAtomic(path, httputil.ProgressReader(resp.Body, src.Progress, resp.ContentLength))
+}
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// buildZip returns a zip archive holding files (name -> content), stored
+// uncompressed so the archive is as big as its contents.
+func buildZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"data/big.bin", "data/wanted.csv", "README"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// countingServer serves archive, honoring Range headers unless ranges is
+// false, and counts the body bytes it sends.
+func countingServer(archive *[]byte, ranges bool, sent *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ranges {
+			r.Header.Del("Range")
+		}
+		cw := &countingWriter{ResponseWriter: w, n: sent}
+		http.ServeContent(cw, r, "archive.zip", time.Time{}, bytes.NewReader(*archive))
+	}))
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c.n += int64(len(p))
+	return c.ResponseWriter.Write(p)
+}
+
+func TestHandler_ZipMember(t *testing.T) {
+	big := make([]byte, 8<<20) // Random, so the member can't be found by accident
+	rand.Read(big)
+	wanted := []byte("id,value\n1,a\n2,b\n")
+	archive := buildZip(t, map[string][]byte{"data/big.bin": big, "data/wanted.csv": wanted, "README": []byte("v1")})
+
+	for _, ranges := range []bool{true, false} {
+		t.Run(fmt.Sprintf("ranges=%v", ranges), func(t *testing.T) {
+			var sent int64
+			server := countingServer(&archive, ranges, &sent)
+			defer server.Close()
+			h := New()
+			src := registry.Source{URL: server.URL + "/archive.zip", Member: "data/wanted.csv"}
+
+			fp, err := h.Fingerprint(context.Background(), src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := fmt.Sprintf("crc32:%08x|size:%d", crc32.ChecksumIEEE(wanted), len(wanted)); fp != want {
+				t.Errorf("Fingerprint() = %q, want %q", fp, want)
+			}
+			dest := filepath.Join(t.TempDir(), "wanted.csv")
+			if err := h.Fetch(context.Background(), src, dest); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(dest); !bytes.Equal(got, wanted) {
+				t.Errorf("fetched %q, want %q", got, wanted)
+			}
+			if ranges && sent > int64(len(archive))/2 {
+				t.Errorf("sent %d bytes of a %d byte archive; want just a few blocks", sent, len(archive))
+			}
+		})
+	}
+
+	// Other members changing doesn't change the member's fingerprint
+	var sent int64
+	server := countingServer(&archive, true, &sent)
+	defer server.Close()
+	h := New()
+	src := registry.Source{URL: server.URL, Member: "./data/wanted.csv"}
+	before, _ := h.Fingerprint(context.Background(), src)
+	archive = buildZip(t, map[string][]byte{"data/big.bin": big[:1<<20], "data/wanted.csv": wanted, "README": []byte("v2")})
+	if after, _ := h.Fingerprint(context.Background(), src); after != before {
+		t.Errorf("fingerprint %q -> %q after only other members changed", before, after)
+	}
+	archive = buildZip(t, map[string][]byte{"data/wanted.csv": []byte("id,value\n1,CHANGED\n")})
+	if after, _ := h.Fingerprint(context.Background(), src); after == before {
+		t.Error("fingerprint unchanged after the member changed")
+	}
+
+	src.Member = "data/missing.csv"
+	if _, err := h.Fingerprint(context.Background(), src); err == nil || !strings.Contains(err.Error(), "no member") {
+		t.Errorf("missing member error = %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+// Package huggingface pins files in Hugging Face Hub repositories (type:
+// huggingface): model weights, dataset shards, tokenizer files.
+//
+// A source names the repository, the file in it and the revision:
+//
+//	source:
+//	  type: huggingface
+//	  url: datasets/allenai/c4       # or a model: meta-llama/Llama-3.1-8B
+//	  path: en/c4-train.00000-of-01024.json.gz
+//	  ref: main                      # branch, tag or commit (default main)
+//
+// The url may also be a full https://huggingface.co/... repository URL, or
+// one on a self-hosted endpoint; short forms use $HF_ENDPOINT when set.
+//
+// The fingerprint comes from the Hub's paths-info API, so checking never
+// downloads anything: "sha256:<hex>" for files stored in LFS (the hash of the
+// content itself, as in the lock's local hash), "gitblob:<sha>" for small
+// files kept in git. Fetch downloads through the resolve endpoint, following
+// its redirect to the CDN.
+//
+// Gated and private repositories need a token in HF_TOKEN, read through the
+// dataset's auth profile. Under an allowlist (security.allowed_hosts), the
+// endpoint - from the url or $HF_ENDPOINT - must be on it before the token
+// is sent there, and so must the CDN the download is redirected to.
+package huggingface
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// defaultEndpoint is the public Hub.
+const defaultEndpoint = "https://huggingface.co"
+
+type handler struct{ client *http.Client }
+
+// New returns the handler. Like http, its requests draw from
+// httputil.DefaultBudget.
+func New() *handler {
+	return &handler{client: &http.Client{Timeout: 60 * time.Second, Transport: &httputil.BudgetTransport{}}}
+}
+
+func (h *handler) Name() string { return "huggingface" }
+
+// repo is a parsed source: which Hub, which kind of repository, which one.
+type repo struct {
+	endpoint string // https://huggingface.co
+	kind     string // "models", "datasets" or "spaces", as in API paths
+	id       string // org/name
+}
+
+// parseRepo accepts org/name, datasets/org/name, spaces/org/name and full
+// repository URLs of the same shapes.
+func parseRepo(raw string, creds *registry.Credentials) (repo, error) {
+	r := repo{endpoint: hubEndpoint(creds), kind: "models"}
+	rest := raw
+	if u, err := url.Parse(raw); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		r.endpoint = u.Scheme + "://" + u.Host
+		rest = u.Path
+	}
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	if parts[0] == "datasets" || parts[0] == "spaces" || parts[0] == "models" {
+		r.kind, parts = parts[0], parts[1:]
+	}
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return r, fmt.Errorf("huggingface: %q is not a repository like org/name or datasets/org/name", raw)
+	}
+	r.id = parts[0] + "/" + parts[1]
+	return r, nil
+}
+
+// hubEndpoint returns $HF_ENDPOINT, or the public Hub.
+func hubEndpoint(creds *registry.Credentials) string {
+	return strings.TrimSuffix(firstNonEmpty(creds.Getenv("HF_ENDPOINT"), defaultEndpoint), "/")
+}
+
+// resolveURL is where the file at rev is downloaded from. Models have no
+// prefix in web URLs, unlike in the API.
+func (r repo) resolveURL(rev, path string) string {
+	prefix := r.kind + "/"
+	if r.kind == "models" {
+		prefix = ""
+	}
+	return fmt.Sprintf("%s/%s%s/resolve/%s/%s", r.endpoint, prefix, r.id, url.PathEscape(rev), escapePath(path))
+}
+
+// pathsInfoURL is the API endpoint describing files at rev.
+func (r repo) pathsInfoURL(rev string) string {
+	return fmt.Sprintf("%s/api/%s/%s/paths-info/%s", r.endpoint, r.kind, r.id, url.PathEscape(rev))
+}
+
+// escapePath escapes each segment of a path within the repository.
+func escapePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	return strings.Join(segs, "/")
+}
+
+// parseSource checks src's fields and returns its repository, file and revision.
+func parseSource(src registry.Source) (r repo, path, rev string, err error) {
+	if src.URL == "" || src.Path == "" {
+		return r, "", "", errors.New("huggingface: require source.url (the repository) and source.path")
+	}
+	r, err = parseRepo(src.URL, src.Credentials)
+	return r, strings.TrimPrefix(src.Path, "/"), firstNonEmpty(src.Ref, "main"), err
+}
+
+// pathInfo is one entry of the paths-info response.
+type pathInfo struct {
+	Type string `json:"type"` // "file" or "directory"
+	Path string `json:"path"`
+	OID  string `json:"oid"` // Git blob SHA
+	Size int64  `json:"size"`
+	LFS  *struct {
+		OID  string `json:"oid"` // SHA-256 of the content
+		Size int64  `json:"size"`
+	} `json:"lfs"`
+}
+
+// Fingerprint is the file's LFS SHA-256, or its git blob SHA for files not
+// in LFS, as reported by the paths-info API at the source's revision.
+func (h *handler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	info, err := h.info(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	return info.fingerprint(), nil
+}
+
+// fingerprint renders the info as a fingerprint.
+func (p *pathInfo) fingerprint() string {
+	if p.LFS != nil && p.LFS.OID != "" {
+		return "sha256:" + p.LFS.OID
+	}
+	return "gitblob:" + p.OID
+}
+
+// info asks the paths-info API about src's file.
+func (h *handler) info(ctx context.Context, src registry.Source) (*pathInfo, error) {
+	r, path, rev, err := parseSource(src)
+	if err != nil {
+		return nil, err
+	}
+	apiURL := r.pathsInfoURL(rev)
+	form := url.Values{"paths": {path}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	authorize(req, src.Credentials)
+	resp, err := h.do(req, src.Hosts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, statusError(http.MethodPost, apiURL, resp)
+	}
+	var infos []pathInfo
+	if err := json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		return nil, fmt.Errorf("huggingface: paths-info %s: %w", r.id, err)
+	}
+	for i := range infos {
+		if infos[i].Path != path {
+			continue
+		}
+		if infos[i].Type == "directory" {
+			return nil, fmt.Errorf("huggingface: %s is a directory in %s; pin each file separately", path, r.id)
+		}
+		return &infos[i], nil
+	}
+	return nil, fmt.Errorf("huggingface: no file %s in %s at %s", path, r.id, rev)
+}
+
+// Fetch downloads the file at the source's revision into dest.
+func (h *handler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	r, path, rev, err := parseSource(src)
+	if err != nil {
+		return err
+	}
+	fileURL := r.resolveURL(rev, path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return err
+	}
+	// Go drops the Authorization header on the redirect to the CDN, whose
+	// signed URL carries its own authorization
+	authorize(req, src.Credentials)
+	resp, err := h.do(req, src.Hosts)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return statusError(http.MethodGet, fileURL, resp)
+	}
+	return fsutil.WriteFileAtomic(dest, httputil.ProgressReader(resp.Body, src.Progress, resp.ContentLength))
+}
+
+// Probe implements registry.Prober for file and repository pages on the Hub
+// (https://huggingface.co/org/name/blob/main/model.safetensors, say), turning
+// them into a source and asking the API for the file's fingerprint.
+func (h *handler) Probe(ctx context.Context, location string) (*registry.ProbeResult, error) {
+	u, err := url.Parse(location)
+	hub, _ := url.Parse(hubEndpoint(nil))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host != hub.Host {
+		return nil, nil
+	}
+	parts := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	for i, p := range parts {
+		parts[i], _ = url.PathUnescape(p)
+	}
+	prefix := ""
+	if len(parts) > 0 && (parts[0] == "datasets" || parts[0] == "spaces") {
+		prefix, parts = parts[0]+"/", parts[1:]
+	}
+	if len(parts) != 2 && (len(parts) < 5 || (parts[2] != "blob" && parts[2] != "resolve")) {
+		return nil, nil // Not a repository or file page
+	}
+
+	res := &registry.ProbeResult{
+		Source:   registry.Source{Type: "huggingface", URL: prefix + parts[0] + "/" + parts[1], Ref: "main"},
+		Specific: true,
+	}
+	if u.Host != "huggingface.co" {
+		res.Source.URL = u.Scheme + "://" + u.Host + "/" + res.Source.URL
+	}
+	if len(parts) == 2 {
+		res.ToDo = []string{"source.path: the file to pin inside the repository"}
+		res.Fingerprints = []string{"sha256 of LFS files, git blob SHA of the rest (paths-info API)"}
+		return res, nil
+	}
+	res.Source.Ref, res.Source.Path = parts[3], strings.Join(parts[4:], "/")
+	info, err := h.info(ctx, res.Source)
+	if err != nil {
+		return nil, err
+	}
+	if info.LFS != nil {
+		res.Fingerprints = []string{"sha256 of the content, from LFS (paths-info API)"}
+	} else {
+		res.Fingerprints = []string{"git blob SHA (paths-info API)"}
+	}
+	res.Notes = []string{fmt.Sprintf("%d bytes", max(info.Size, lfsSize(info)))}
+	if len(res.Source.Ref) != 40 {
+		res.Notes = append(res.Notes, "ref "+res.Source.Ref+" moves; a commit SHA pins one exact revision")
+	}
+	return res, nil
+}
+
+// lfsSize returns the size of an LFS file's content, or 0.
+func lfsSize(p *pathInfo) int64 {
+	if p.LFS == nil {
+		return 0
+	}
+	return p.LFS.Size
+}
+
+// do sends req, refusing to when its host, or one it's redirected to, isn't
+// allowed by hosts.
+func (h *handler) do(req *http.Request, hosts *registry.HostPolicy) (*http.Response, error) {
+	if !hosts.Allows(req.URL.Hostname()) {
+		return nil, fmt.Errorf("huggingface: endpoint %s isn't among the allowed hosts", req.URL.Hostname())
+	}
+	if hosts == nil {
+		return h.client.Do(req)
+	}
+	c := *h.client
+	c.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !hosts.Allows(next.URL.Hostname()) {
+			return fmt.Errorf("redirected to %s, which isn't among the allowed hosts", next.URL.Hostname())
+		}
+		return nil
+	}
+	return c.Do(req)
+}
+
+// authorize adds the HF_TOKEN bearer token to req, if one is set.
+func authorize(req *http.Request, creds *registry.Credentials) {
+	if token := creds.Getenv("HF_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// statusError is httputil's status error, with a hint for the answers gated
+// and private repositories give without a token.
+func statusError(method, rawURL string, resp *http.Response) error {
+	err := httputil.NewStatusError(method, rawURL, resp)
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w (gated or private repository? set HF_TOKEN to a token with access)", err)
+	}
+	return err
+}
+
+// firstNonEmpty returns the first non-empty string.
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func init() {
+	registry.Register(New())
+}
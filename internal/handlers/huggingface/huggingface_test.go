@@ -0,0 +1,191 @@
+package huggingface
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/handlertest"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+const weightsSHA = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+// fakeHub serves the paths-info and resolve endpoints for one dataset repo,
+// org/data, holding an LFS file and a plain one. With token set, requests
+// without it are refused like a gated repository's.
+func fakeHub(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	files := map[string]string{"weights.bin": "weights", "dir/README.md": "readme"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/datasets/org/data/paths-info/main":
+			r.ParseForm()
+			var out []map[string]any
+			for _, p := range r.Form["paths"] {
+				switch p {
+				case "weights.bin":
+					out = append(out, map[string]any{"type": "file", "path": p, "oid": "aaaa", "size": 133,
+						"lfs": map[string]any{"oid": weightsSHA, "size": 7}})
+				case "dir/README.md":
+					out = append(out, map[string]any{"type": "file", "path": p, "oid": "0123456789abcdef0123456789abcdef01234567", "size": 6})
+				case "dir":
+					out = append(out, map[string]any{"type": "directory", "path": p, "oid": "bbbb"})
+				}
+			}
+			json.NewEncoder(w).Encode(out)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/datasets/org/data/resolve/main/"):
+			content, ok := files[strings.TrimPrefix(r.URL.Path, "/datasets/org/data/resolve/main/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(content))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParseRepo(t *testing.T) {
+	t.Setenv("HF_ENDPOINT", "")
+	tests := []struct {
+		raw                string
+		endpoint, kind, id string
+	}{
+		{"meta-llama/Llama-3.1-8B", "https://huggingface.co", "models", "meta-llama/Llama-3.1-8B"},
+		{"datasets/allenai/c4", "https://huggingface.co", "datasets", "allenai/c4"},
+		{"https://hub.internal:8443/spaces/org/demo/", "https://hub.internal:8443", "spaces", "org/demo"},
+	}
+	for _, tt := range tests {
+		r, err := parseRepo(tt.raw, nil)
+		if err != nil || r.endpoint != tt.endpoint || r.kind != tt.kind || r.id != tt.id {
+			t.Errorf("parseRepo(%q) = %+v, %v", tt.raw, r, err)
+		}
+	}
+	for _, raw := range []string{"just-a-name", "a/b/c/d", "datasets/org"} {
+		if _, err := parseRepo(raw, nil); err == nil {
+			t.Errorf("parseRepo(%q) succeeded", raw)
+		}
+	}
+
+	r, _ := parseRepo("org/model", nil)
+	if got, want := r.resolveURL("refs/pr/1", "sub dir/model.bin"), "https://huggingface.co/org/model/resolve/refs%2Fpr%2F1/sub%20dir/model.bin"; got != want {
+		t.Errorf("resolveURL() = %q, want %q", got, want)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	hub := fakeHub(t, "")
+	handlertest.Run(t, New(), handlertest.Fixtures{
+		Valid: []handlertest.Fixture{
+			{Name: "lfs", Source: registry.Source{Type: "huggingface", URL: hub.URL + "/datasets/org/data", Path: "weights.bin"}, Content: []byte("weights")},
+			{Name: "git", Source: registry.Source{Type: "huggingface", URL: hub.URL + "/datasets/org/data", Path: "dir/README.md", Ref: "main"}, Content: []byte("readme")},
+		},
+		Invalid: []registry.Source{{Type: "huggingface"}, {Type: "huggingface", URL: "org/data"}},
+	})
+}
+
+func TestFingerprint(t *testing.T) {
+	ctx := context.Background()
+	hub := fakeHub(t, "")
+	src := registry.Source{URL: hub.URL + "/datasets/org/data"}
+
+	tests := []struct{ path, want string }{
+		{"weights.bin", "sha256:" + weightsSHA},
+		{"dir/README.md", "gitblob:0123456789abcdef0123456789abcdef01234567"},
+	}
+	for _, tt := range tests {
+		src.Path = tt.path
+		if fp, err := New().Fingerprint(ctx, src); err != nil || fp != tt.want {
+			t.Errorf("Fingerprint(%s) = %q, %v; want %q", tt.path, fp, err, tt.want)
+		}
+	}
+
+	for _, path := range []string{"dir", "missing.bin"} {
+		src.Path = path
+		if _, err := New().Fingerprint(ctx, src); err == nil {
+			t.Errorf("Fingerprint(%s) succeeded", path)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	ctx := context.Background()
+	hub := fakeHub(t, "hf_secret")
+	src := registry.Source{URL: hub.URL + "/datasets/org/data", Path: "weights.bin"}
+
+	t.Setenv("HF_TOKEN", "")
+	if _, err := New().Fingerprint(ctx, src); err == nil || !strings.Contains(err.Error(), "HF_TOKEN") {
+		t.Errorf("Fingerprint() without a token: error = %v, want a hint about HF_TOKEN", err)
+	}
+
+	t.Setenv("HF_TOKEN", "hf_secret")
+	dest := filepath.Join(t.TempDir(), "weights.bin")
+	if err := New().Fetch(ctx, src, dest); err != nil {
+		t.Fatalf("Fetch() with a token: %v", err)
+	}
+	if b, _ := os.ReadFile(dest); string(b) != "weights" {
+		t.Errorf("fetched %q", b)
+	}
+}
+
+func TestAllowedHosts(t *testing.T) {
+	hub := fakeHub(t, "hf_secret")
+	t.Setenv("HF_TOKEN", "hf_secret")
+	src := registry.Source{URL: hub.URL + "/datasets/org/data", Path: "weights.bin", Hosts: &registry.HostPolicy{Lists: [][]string{{"huggingface.co"}}}}
+	if _, err := New().Fingerprint(context.Background(), src); err == nil || !strings.Contains(err.Error(), "allowed hosts") {
+		t.Errorf("Fingerprint() from an endpoint not allowed: error = %v", err)
+	}
+	if err := New().Fetch(context.Background(), src, filepath.Join(t.TempDir(), "weights.bin")); err == nil || !strings.Contains(err.Error(), "allowed hosts") {
+		t.Errorf("Fetch() from an endpoint not allowed: error = %v", err)
+	}
+
+	// Short forms go to $HF_ENDPOINT, which must be allowed too
+	t.Setenv("HF_ENDPOINT", hub.URL)
+	src.URL = "datasets/org/data"
+	if _, err := New().Fingerprint(context.Background(), src); err == nil || !strings.Contains(err.Error(), "allowed hosts") {
+		t.Errorf("Fingerprint() from $HF_ENDPOINT not allowed: error = %v", err)
+	}
+	src.Hosts = &registry.HostPolicy{Lists: [][]string{{"127.0.0.1"}}}
+	if _, err := New().Fingerprint(context.Background(), src); err != nil {
+		t.Errorf("Fingerprint() from an allowed endpoint: %v", err)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	ctx := context.Background()
+	hub := fakeHub(t, "")
+	t.Setenv("HF_ENDPOINT", hub.URL)
+
+	res, err := New().Probe(ctx, hub.URL+"/datasets/org/data/blob/main/weights.bin")
+	if err != nil || res == nil {
+		t.Fatalf("Probe() = %v, %v", res, err)
+	}
+	want := registry.Source{Type: "huggingface", URL: hub.URL + "/datasets/org/data", Path: "weights.bin", Ref: "main"}
+	if res.Source.URL != want.URL || res.Source.Path != want.Path || res.Source.Ref != want.Ref || !res.Specific {
+		t.Errorf("Probe() source = %+v, want %+v", res.Source, want)
+	}
+
+	res, err = New().Probe(ctx, hub.URL+"/datasets/org/data")
+	if err != nil || res == nil || len(res.ToDo) != 1 {
+		t.Errorf("Probe() of a repository page = %+v, %v; want a TODO for the path", res, err)
+	}
+
+	for _, loc := range []string{"https://example.org/org/data/blob/main/x", hub.URL + "/docs/hub/index", "org/data"} {
+		if res, err := New().Probe(ctx, loc); res != nil || err != nil {
+			t.Errorf("Probe(%q) = %+v, %v; want nil, nil", loc, res, err)
+		}
+	}
+}
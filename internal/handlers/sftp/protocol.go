@@ -0,0 +1,418 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// This file is a minimal SFTP version 3 client: just enough to stat a file
+// and stream it (draft-ietf-secsh-filexfer-02, which every OpenSSH server
+// speaks). Requests are sent one at a time, except for a file's READs: one
+// 32 KiB chunk per round trip would leave a long link idle most of the time,
+// so, like OpenSSH's sftp, up to maxInFlight of them are kept outstanding.
+//
+// Go learning note: every SFTP packet is a big-endian uint32 length followed
+// by a type byte and the payload. encoding/binary's BigEndian helpers append
+// to and read from byte slices without any reflection.
+
+// Packet types (client requests and server responses).
+const (
+	fxpInit    = 1
+	fxpVersion = 2
+	fxpOpen    = 3
+	fxpClose   = 4
+	fxpRead    = 5
+	fxpStat    = 17
+	fxpStatus  = 101
+	fxpHandle  = 102
+	fxpData    = 103
+	fxpAttrs   = 105
+)
+
+// Status codes, file attribute flags and open flags used below.
+const (
+	fxOK  = 0
+	fxEOF = 1
+
+	attrSize        = 0x00000001
+	attrUIDGID      = 0x00000002
+	attrPermissions = 0x00000004
+	attrACModTime   = 0x00000008
+	attrExtended    = 0x80000000
+
+	openRead = 0x00000001
+)
+
+// chunkSize is how much each READ asks for; servers may return less.
+const chunkSize = 32 * 1024
+
+// maxPacket bounds the packets accepted from the server.
+const maxPacket = 256 * 1024
+
+// maxInFlight is how many READs a file keeps outstanding once it's clearly
+// not a small one: 64 of 32 KiB, 2 MiB, fills the default SSH window.
+const maxInFlight = 64
+
+// statusError is an SSH_FXP_STATUS other than OK.
+type statusError struct {
+	code uint32
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	if e.msg != "" {
+		return fmt.Sprintf("sftp: %s (status %d)", e.msg, e.code)
+	}
+	return fmt.Sprintf("sftp: status %d", e.code)
+}
+
+// fileAttrs is the subset of file attributes datum uses.
+type fileAttrs struct {
+	size    uint64
+	mtime   time.Time
+	hasSize bool
+	hasTime bool
+}
+
+// client speaks SFTP over rw (an SSH "sftp" subsystem channel, or a pipe in tests).
+type client struct {
+	rw     io.ReadWriter
+	nextID uint32
+}
+
+// newClient performs the version handshake.
+func newClient(rw io.ReadWriter) (*client, error) {
+	c := &client{rw: rw}
+	if err := c.send(fxpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return nil, err
+	}
+	typ, _, err := c.recv()
+	if err != nil {
+		return nil, err
+	}
+	if typ != fxpVersion {
+		return nil, fmt.Errorf("sftp: expected version packet, got type %d", typ)
+	}
+	return c, nil
+}
+
+func (c *client) send(typ byte, payload []byte) error {
+	pkt := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	pkt = append(pkt, typ)
+	pkt = append(pkt, payload...)
+	_, err := c.rw.Write(pkt)
+	return err
+}
+
+func (c *client) recv() (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(c.rw, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:4])
+	if n < 1 || n > maxPacket {
+		return 0, nil, fmt.Errorf("sftp: bad packet length %d", n)
+	}
+	body := make([]byte, n-1)
+	if _, err := io.ReadFull(c.rw, body); err != nil {
+		return 0, nil, err
+	}
+	return hdr[4], body, nil
+}
+
+// request sends a request with a fresh ID and returns the matching response
+// (its type and the payload after the ID).
+func (c *client) request(typ byte, payload []byte) (byte, []byte, error) {
+	id, err := c.start(typ, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	got, rtyp, body, err := c.response()
+	if err != nil {
+		return 0, nil, err
+	}
+	if got != id {
+		return 0, nil, fmt.Errorf("sftp: response for request %d, expected %d", got, id)
+	}
+	return result(rtyp, body)
+}
+
+// start sends a request with a fresh ID, returning the ID without waiting
+// for the response.
+func (c *client) start(typ byte, payload []byte) (uint32, error) {
+	c.nextID++
+	return c.nextID, c.send(typ, append(binary.BigEndian.AppendUint32(nil, c.nextID), payload...))
+}
+
+// response reads the next response, returning the ID of the request it
+// answers, its type and the payload after the ID.
+func (c *client) response() (uint32, byte, []byte, error) {
+	typ, body, err := c.recv()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	r := reader{b: body}
+	id := r.uint32()
+	if r.err != nil {
+		return 0, 0, nil, r.err
+	}
+	return id, typ, r.b, nil
+}
+
+// result turns a status response into nil (OK) or a *statusError, and
+// passes other responses through.
+func result(typ byte, body []byte) (byte, []byte, error) {
+	if typ != fxpStatus {
+		return typ, body, nil
+	}
+	r := reader{b: body}
+	code := r.uint32()
+	msg := r.string()
+	if code == fxOK {
+		return typ, nil, nil
+	}
+	return 0, nil, &statusError{code: code, msg: msg}
+}
+
+// stat returns the attributes of path.
+func (c *client) stat(path string) (fileAttrs, error) {
+	typ, body, err := c.request(fxpStat, appendString(nil, path))
+	if err != nil {
+		return fileAttrs{}, err
+	}
+	if typ != fxpAttrs {
+		return fileAttrs{}, fmt.Errorf("sftp: unexpected response type %d to stat", typ)
+	}
+	r := reader{b: body}
+	a := r.attrs()
+	return a, r.err
+}
+
+// open opens path for reading and returns a reader over its contents.
+func (c *client) open(path string) (*file, error) {
+	payload := appendString(nil, path)
+	payload = binary.BigEndian.AppendUint32(payload, openRead)
+	payload = binary.BigEndian.AppendUint32(payload, 0) // no attributes
+	typ, body, err := c.request(fxpOpen, payload)
+	if err != nil {
+		return nil, err
+	}
+	if typ != fxpHandle {
+		return nil, fmt.Errorf("sftp: unexpected response type %d to open", typ)
+	}
+	r := reader{b: body}
+	h := r.string()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &file{c: c, handle: h, window: 2, early: map[uint32]reply{}}, nil
+}
+
+// file reads an open remote file sequentially, keeping READs for the chunks
+// ahead outstanding. Their window starts small, so a small file doesn't cost
+// dozens of READs past its end, and doubles with each chunk that has data.
+type file struct {
+	c       *client
+	handle  string
+	next    uint64           // Offset the next READ sent starts at
+	pending []chunk          // READs sent and not yet read, in file order
+	early   map[uint32]reply // Responses that came before those ahead of them
+	window  int              // How many READs to keep outstanding
+	buf     []byte           // Data received and not yet read
+	eof     bool
+	err     error
+}
+
+// chunk is an outstanding READ.
+type chunk struct {
+	id  uint32
+	off uint64
+	n   uint32
+}
+
+// reply is a response, as returned by client.response.
+type reply struct {
+	typ  byte
+	body []byte
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		if f.eof {
+			return 0, io.EOF
+		}
+		if f.err != nil {
+			return 0, f.err
+		}
+		f.err = f.receive()
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+// receive tops the outstanding READs up to the window, then waits for the
+// first one's data and buffers it.
+func (f *file) receive() error {
+	for len(f.pending) < f.window {
+		id, err := f.c.start(fxpRead, f.readPayload(f.next, chunkSize))
+		if err != nil {
+			return err
+		}
+		f.pending = append(f.pending, chunk{id: id, off: f.next, n: chunkSize})
+		f.next += chunkSize
+	}
+	head := f.pending[0]
+	f.pending = f.pending[1:]
+	typ, body, err := f.wait(head.id)
+	var se *statusError
+	if errors.As(err, &se) && se.code == fxEOF {
+		f.eof = true // The READs past it get EOF too; Close drains them
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if typ != fxpData {
+		return fmt.Errorf("sftp: unexpected response type %d to read", typ)
+	}
+	r := reader{b: body}
+	data := r.string()
+	if r.err != nil {
+		return r.err
+	}
+	if len(data) == 0 || uint32(len(data)) > head.n {
+		return fmt.Errorf("sftp: read of %d bytes returned %d", head.n, len(data))
+	}
+	if rest := head.n - uint32(len(data)); rest > 0 {
+		// A short read: the rest of the chunk comes before the READs ahead
+		off := head.off + uint64(len(data))
+		id, err := f.c.start(fxpRead, f.readPayload(off, rest))
+		if err != nil {
+			return err
+		}
+		f.pending = append([]chunk{{id: id, off: off, n: rest}}, f.pending...)
+	}
+	f.window = min(f.window*2, maxInFlight)
+	f.buf = []byte(data)
+	return nil
+}
+
+// readPayload is the payload of a READ of n bytes at off.
+func (f *file) readPayload(off uint64, n uint32) []byte {
+	payload := appendString(nil, f.handle)
+	payload = binary.BigEndian.AppendUint64(payload, off)
+	return binary.BigEndian.AppendUint32(payload, n)
+}
+
+// wait returns the response to the outstanding READ id, keeping those that
+// arrive before it for later: servers may answer out of order.
+func (f *file) wait(id uint32) (byte, []byte, error) {
+	if rep, ok := f.early[id]; ok {
+		delete(f.early, id)
+		return result(rep.typ, rep.body)
+	}
+	for {
+		got, typ, body, err := f.c.response()
+		if err != nil {
+			return 0, nil, err
+		}
+		if got == id {
+			return result(typ, body)
+		}
+		if !slices.ContainsFunc(f.pending, func(c chunk) bool { return c.id == got }) {
+			return 0, nil, fmt.Errorf("sftp: response for request %d, which isn't outstanding", got)
+		}
+		f.early[got] = reply{typ: typ, body: body}
+	}
+}
+
+// Close collects the responses to the READs still outstanding, so the
+// connection is back in step, then closes the handle.
+func (f *file) Close() error {
+	for len(f.pending) > 0 {
+		head := f.pending[0]
+		f.pending = f.pending[1:]
+		if _, _, err := f.wait(head.id); err != nil {
+			var se *statusError
+			if !errors.As(err, &se) {
+				return err // The connection broke
+			}
+		}
+	}
+	_, _, err := f.c.request(fxpClose, appendString(nil, f.handle))
+	return err
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// reader decodes SFTP fields, remembering the first error so callers can
+// check once at the end.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) uint32() uint32 {
+	if len(r.b) < 4 {
+		r.err = errors.New("sftp: short packet")
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *reader) uint64() uint64 {
+	if len(r.b) < 8 {
+		r.err = errors.New("sftp: short packet")
+		return 0
+	}
+	v := binary.BigEndian.Uint64(r.b)
+	r.b = r.b[8:]
+	return v
+}
+
+func (r *reader) string() string {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.b)) < n {
+		r.err = errors.New("sftp: short packet")
+		return ""
+	}
+	s := string(r.b[:n])
+	r.b = r.b[n:]
+	return s
+}
+
+func (r *reader) attrs() fileAttrs {
+	var a fileAttrs
+	flags := r.uint32()
+	if flags&attrSize != 0 {
+		a.size, a.hasSize = r.uint64(), true
+	}
+	if flags&attrUIDGID != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&attrPermissions != 0 {
+		r.uint32()
+	}
+	if flags&attrACModTime != 0 {
+		r.uint32() // atime
+		a.mtime, a.hasTime = time.Unix(int64(r.uint32()), 0).UTC(), true
+	}
+	if flags&attrExtended != 0 {
+		for n := r.uint32(); n > 0 && r.err == nil; n-- {
+			r.string()
+			r.string()
+		}
+	}
+	return a
+}
@@ -0,0 +1,415 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/jprybylski/datum/internal/handlertest"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// testServer is an in-process SSH server exposing root over SFTP, and
+// optionally answering "sha256sum -- FILE" exec requests.
+type testServer struct {
+	addr    string
+	root    string
+	hostKey ssh.PublicKey
+	exec    bool
+}
+
+// startServer runs a server for root and points the handler's credential
+// variables at a fresh client key and a known_hosts file trusting the server.
+func startServer(t *testing.T, root string, exec bool) *testServer {
+	t.Helper()
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPub, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	authorized, _ := ssh.NewPublicKey(clientPub)
+
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &testServer{addr: ln.Addr().String(), root: root, hostKey: hostSigner.PublicKey(), exec: exec}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveConn(nc, cfg)
+		}
+	}()
+
+	dir := t.TempDir()
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "id_ed25519")
+	os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600)
+	hostsPath := filepath.Join(dir, "known_hosts")
+	os.WriteFile(hostsPath, []byte(knownhosts.Line([]string{s.addr}, s.hostKey)+"\n"), 0o600)
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("SFTP_SSH_KEY", keyPath)
+	t.Setenv("SFTP_KNOWN_HOSTS", hostsPath)
+	t.Setenv("SFTP_INSECURE_IGNORE_HOST_KEY", "")
+	return s
+}
+
+// url returns the source URL for a file under the server root. The scp style
+// can't carry the port, so it's the sftp:// form.
+func (s *testServer) url(name string) string {
+	return "sftp://tester@" + s.addr + "/" + name
+}
+
+func (s *testServer) serveConn(nc net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(nc, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nch := range chans {
+		ch, chReqs, err := nch.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer ch.Close()
+			for req := range chReqs {
+				r := reader{b: req.Payload}
+				arg := r.string()
+				switch {
+				case req.Type == "subsystem" && arg == "sftp":
+					req.Reply(true, nil)
+					s.serveSFTP(ch)
+					return
+				case req.Type == "exec":
+					req.Reply(true, nil)
+					status := uint32(127)
+					if name, ok := strings.CutPrefix(arg, "sha256sum -- "); ok && s.exec {
+						b, err := os.ReadFile(filepath.Join(s.root, strings.Trim(name, "'")))
+						if err == nil {
+							sum := sha256.Sum256(b)
+							io.WriteString(ch, hex.EncodeToString(sum[:])+"  "+name+"\n")
+							status = 0
+						}
+					}
+					ch.SendRequest("exit-status", false, binary.BigEndian.AppendUint32(nil, status))
+					return
+				default:
+					req.Reply(false, nil)
+				}
+			}
+		}()
+	}
+}
+
+// serveSFTP answers the requests the client sends: stat, open, read, close.
+func (s *testServer) serveSFTP(rw io.ReadWriter) {
+	c := &client{rw: rw}
+	files := map[string]*os.File{}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	status := func(id, code uint32) []byte {
+		b := binary.BigEndian.AppendUint32(nil, id)
+		b = binary.BigEndian.AppendUint32(b, code)
+		return appendString(appendString(b, ""), "")
+	}
+	for {
+		typ, body, err := c.recv()
+		if err != nil {
+			return
+		}
+		if typ == fxpInit {
+			c.send(fxpVersion, binary.BigEndian.AppendUint32(nil, 3))
+			continue
+		}
+		r := reader{b: body}
+		id := r.uint32()
+		resp := binary.BigEndian.AppendUint32(nil, id)
+		switch typ {
+		case fxpStat:
+			fi, err := os.Stat(filepath.Join(s.root, r.string()))
+			if err != nil {
+				c.send(fxpStatus, status(id, 2))
+				continue
+			}
+			resp = binary.BigEndian.AppendUint32(resp, attrSize|attrACModTime)
+			resp = binary.BigEndian.AppendUint64(resp, uint64(fi.Size()))
+			resp = binary.BigEndian.AppendUint32(resp, uint32(fi.ModTime().Unix()))
+			resp = binary.BigEndian.AppendUint32(resp, uint32(fi.ModTime().Unix()))
+			c.send(fxpAttrs, resp)
+		case fxpOpen:
+			name := r.string()
+			f, err := os.Open(filepath.Join(s.root, name))
+			if err != nil {
+				c.send(fxpStatus, status(id, 2))
+				continue
+			}
+			files[name] = f
+			c.send(fxpHandle, appendString(resp, name))
+		case fxpRead:
+			f := files[r.string()]
+			off, n := r.uint64(), r.uint32()
+			buf := make([]byte, n)
+			got, err := f.ReadAt(buf, int64(off))
+			if got == 0 && err == io.EOF {
+				c.send(fxpStatus, status(id, fxEOF))
+				continue
+			}
+			c.send(fxpData, appendString(resp, string(buf[:got])))
+		case fxpClose:
+			name := r.string()
+			files[name].Close()
+			delete(files, name)
+			c.send(fxpStatus, status(id, fxOK))
+		}
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want target
+	}{
+		{"alice@data.example.org:/srv/data.csv", target{"alice", "data.example.org:22", "/srv/data.csv"}},
+		{"alice@data.example.org:exports/data.csv", target{"alice", "data.example.org:22", "exports/data.csv"}},
+		{"sftp://bob@data.example.org:2222/srv/data.csv", target{"bob", "data.example.org:2222", "/srv/data.csv"}},
+	}
+	for _, tt := range tests {
+		got, err := parseURL(tt.raw, nil)
+		if err != nil || got != tt.want {
+			t.Errorf("parseURL(%q) = %+v, %v; want %+v", tt.raw, got, err, tt.want)
+		}
+	}
+
+	t.Setenv("SFTP_USER", "svc")
+	if got, _ := parseURL("data.example.org:/srv/x", nil); got.user != "svc" {
+		t.Errorf("user = %q, want SFTP_USER", got.user)
+	}
+	for _, bad := range []string{"", "data.example.org", "alice@:/x", "host:", "sftp://host/"} {
+		if _, err := parseURL(bad, nil); err == nil {
+			t.Errorf("parseURL(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	root := t.TempDir()
+	big := bytes.Repeat([]byte("0123456789abcdef"), 10000) // several read chunks
+	os.WriteFile(filepath.Join(root, "small.csv"), []byte("a,b\n1,2\n"), 0o644)
+	os.WriteFile(filepath.Join(root, "big.bin"), big, 0o644)
+	s := startServer(t, root, false)
+
+	handlertest.Run(t, New(), handlertest.Fixtures{
+		Valid: []handlertest.Fixture{
+			{Name: "small", Source: registry.Source{Type: "sftp", URL: s.url("small.csv")}, Content: []byte("a,b\n1,2\n")},
+			{Name: "chunked", Source: registry.Source{Type: "sftp", URL: s.url("big.bin")}, Content: big},
+		},
+		Invalid: []registry.Source{{Type: "sftp"}, {Type: "sftp", URL: "no-path-here"}},
+	})
+}
+
+// batchServer answers the SFTP requests written to it in batches: whenever
+// the client reads with no answer pending, every request sent since the
+// last batch is answered, in reverse order. READs get at most 20000 bytes.
+type batchServer struct {
+	content []byte
+	in, out bytes.Buffer
+	queued  [][]byte // Request packets (type and payload) not answered yet
+}
+
+func (s *batchServer) Write(p []byte) (int, error) {
+	s.in.Write(p)
+	for s.in.Len() >= 4 {
+		n := int(binary.BigEndian.Uint32(s.in.Bytes()))
+		if s.in.Len() < 4+n {
+			break
+		}
+		s.in.Next(4)
+		s.queued = append(s.queued, bytes.Clone(s.in.Next(n)))
+	}
+	return len(p), nil
+}
+
+func (s *batchServer) Read(p []byte) (int, error) {
+	if s.out.Len() == 0 {
+		c := &client{rw: &s.out}
+		for i := len(s.queued) - 1; i >= 0; i-- {
+			r := reader{b: s.queued[i][1:]}
+			id := r.uint32()
+			resp := binary.BigEndian.AppendUint32(nil, id)
+			switch s.queued[i][0] {
+			case fxpOpen:
+				c.send(fxpHandle, appendString(resp, "h"))
+			case fxpRead:
+				r.string()
+				off, n := r.uint64(), r.uint32()
+				if off >= uint64(len(s.content)) {
+					c.send(fxpStatus, appendString(appendString(binary.BigEndian.AppendUint32(resp, fxEOF), ""), ""))
+					continue
+				}
+				end := min(off+uint64(min(n, 20000)), uint64(len(s.content)))
+				c.send(fxpData, appendString(resp, string(s.content[off:end])))
+			case fxpClose:
+				c.send(fxpStatus, appendString(appendString(binary.BigEndian.AppendUint32(resp, fxOK), ""), ""))
+			}
+		}
+		s.queued = nil
+	}
+	return s.out.Read(p)
+}
+
+func TestPipelinedRead(t *testing.T) {
+	for _, size := range []int{0, 100, chunkSize, 20 * chunkSize, 200 * chunkSize} {
+		content := make([]byte, size)
+		rand.Read(content)
+		srv := &batchServer{content: content}
+		f, err := (&client{rw: srv}).open("data.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got bytes.Buffer
+		outstanding := 0
+		buf := make([]byte, chunkSize)
+		for {
+			n, err := f.Read(buf)
+			got.Write(buf[:n])
+			outstanding = max(outstanding, len(f.pending))
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("reading %d bytes: %v", size, err)
+			}
+		}
+		if !bytes.Equal(got.Bytes(), content) {
+			t.Fatalf("read %d bytes of %d, or not the right ones", got.Len(), size)
+		}
+		if err := f.Close(); err != nil {
+			t.Errorf("Close() after %d bytes: %v", size, err)
+		}
+		if size == 200*chunkSize && outstanding < maxInFlight-1 {
+			t.Errorf("at most %d reads were outstanding, want %d", outstanding+1, maxInFlight)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "data.csv")
+	os.WriteFile(path, []byte("v1"), 0o644)
+	mtime := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	os.Chtimes(path, mtime, mtime)
+	ctx := context.Background()
+
+	t.Run("size and mtime", func(t *testing.T) {
+		s := startServer(t, root, false)
+		fp, err := New().Fingerprint(ctx, registry.Source{URL: s.url("data.csv")})
+		if want := "size:2|mtime:2025-03-04T05:06:07Z"; err != nil || fp != want {
+			t.Errorf("Fingerprint() = %q, %v; want %q", fp, err, want)
+		}
+	})
+
+	t.Run("remote sha256", func(t *testing.T) {
+		s := startServer(t, root, true)
+		fp, err := New().Fingerprint(ctx, registry.Source{URL: s.url("data.csv")})
+		sum := sha256.Sum256([]byte("v1"))
+		if want := "sha256:" + hex.EncodeToString(sum[:]); err != nil || fp != want {
+			t.Errorf("Fingerprint() = %q, %v; want %q", fp, err, want)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		s := startServer(t, root, true)
+		if _, err := New().Fingerprint(ctx, registry.Source{URL: s.url("nope.csv")}); err == nil {
+			t.Error("Fingerprint() of a missing file succeeded")
+		}
+	})
+}
+
+func TestProbe(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "data.csv"), []byte("v1"), 0o644)
+	ctx := context.Background()
+
+	for _, loc := range []string{"https://example.org/x", "git@github.com:org/repo.git", "data/x.csv"} {
+		if res, err := New().Probe(ctx, loc); res != nil || err != nil {
+			t.Errorf("Probe(%q) = %+v, %v; want nil, nil", loc, res, err)
+		}
+	}
+
+	s := startServer(t, root, true)
+	res, err := New().Probe(ctx, s.url("data.csv"))
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if res.Source.URL != s.url("data.csv") || len(res.Fingerprints) != 2 || !strings.HasPrefix(res.Fingerprints[0], "sha256") {
+		t.Errorf("Probe() = %+v", res)
+	}
+
+	s = startServer(t, root, false)
+	res, err = New().Probe(ctx, s.url("data.csv"))
+	if err != nil || len(res.Fingerprints) != 1 || !strings.HasPrefix(res.Fingerprints[0], "size") {
+		t.Errorf("Probe() without sha256sum = %+v, %v", res, err)
+	}
+	if _, err := New().Probe(ctx, s.url("nope.csv")); err == nil {
+		t.Error("Probe() of a missing file succeeded")
+	}
+}
+
+func TestHostKeyVerification(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "data.csv"), []byte("x"), 0o644)
+	s := startServer(t, root, false)
+
+	// Trust some other key for the server's address
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _ := ssh.NewPublicKey(other)
+	hosts := filepath.Join(t.TempDir(), "known_hosts")
+	os.WriteFile(hosts, []byte(knownhosts.Line([]string{s.addr}, otherKey)+"\n"), 0o600)
+	t.Setenv("SFTP_KNOWN_HOSTS", hosts)
+
+	src := registry.Source{URL: s.url("data.csv")}
+	if _, err := New().Fingerprint(context.Background(), src); err == nil {
+		t.Fatal("connected to a server whose host key doesn't match known_hosts")
+	}
+	t.Setenv("SFTP_INSECURE_IGNORE_HOST_KEY", "1")
+	if _, err := New().Fingerprint(context.Background(), src); err != nil {
+		t.Errorf("with SFTP_INSECURE_IGNORE_HOST_KEY=1: %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package torrent
+
+// This file is a bencode codec (BEP 3), the encoding of .torrent files,
+// tracker responses and extension messages: integers (i42e), byte strings
+// (4:spam), lists (l...e) and dictionaries with sorted keys (d...e).
+//
+// Decoded values are int64, string, []any and map[string]any. Byte strings
+// stay strings even when they hold binary data (piece hashes, compact peer
+// lists); Go strings can hold any bytes.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// maxDepth bounds how deeply lists and dictionaries may nest, so a hostile
+// file can't exhaust the stack.
+const maxDepth = 64
+
+// decoder reads bencoded values from data.
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+// decode parses b, which must hold exactly one value.
+func decode(b []byte) (any, error) {
+	v, rest, err := decodePrefix(b)
+	if err == nil && len(rest) > 0 {
+		err = fmt.Errorf("bencode: %d bytes of trailing data", len(rest))
+	}
+	return v, err
+}
+
+// decodePrefix parses the value at the start of b and returns the bytes after
+// it, which extension messages use for raw payloads.
+func decodePrefix(b []byte) (any, []byte, error) {
+	d := &decoder{data: b}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, b[d.pos:], nil
+}
+
+// decodeDict parses b as a dictionary, returning each value's raw encoding
+// alongside: a torrent's info hash is the SHA-1 of its info value exactly as
+// written.
+func decodeDict(b []byte) (map[string]any, map[string][]byte, error) {
+	d := &decoder{data: b}
+	if d.peek() != 'd' {
+		return nil, nil, errors.New("bencode: not a dictionary")
+	}
+	d.pos++
+	dict, raw := map[string]any{}, map[string][]byte{}
+	for d.peek() != 'e' {
+		key, err := d.str()
+		if err != nil {
+			return nil, nil, err
+		}
+		start := d.pos
+		v, err := d.value(1)
+		if err != nil {
+			return nil, nil, err
+		}
+		dict[key], raw[key] = v, b[start:d.pos]
+	}
+	d.pos++
+	if d.pos != len(b) {
+		return nil, nil, fmt.Errorf("bencode: %d bytes of trailing data", len(b)-d.pos)
+	}
+	return dict, raw, nil
+}
+
+// peek returns the next byte, or 0 at the end of the data.
+func (d *decoder) peek() byte {
+	if d.pos >= len(d.data) {
+		return 0
+	}
+	return d.data[d.pos]
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, errors.New("bencode: nested too deeply")
+	}
+	switch c := d.peek(); {
+	case c == 'i':
+		return d.int()
+	case c >= '0' && c <= '9':
+		return d.str()
+	case c == 'l':
+		d.pos++
+		list := []any{}
+		for d.peek() != 'e' {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		d.pos++
+		return list, nil
+	case c == 'd':
+		d.pos++
+		dict := map[string]any{}
+		for d.peek() != 'e' {
+			key, err := d.str()
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			dict[key] = v
+		}
+		d.pos++
+		return dict, nil
+	case c == 0:
+		return nil, errors.New("bencode: unexpected end of data")
+	default:
+		return nil, fmt.Errorf("bencode: unexpected %q at offset %d", c, d.pos)
+	}
+}
+
+// int reads i<digits>e.
+func (d *decoder) int() (int64, error) {
+	end := d.index('e')
+	if end < 0 {
+		return 0, errors.New("bencode: unterminated integer")
+	}
+	n, err := strconv.ParseInt(string(d.data[d.pos+1:end]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bencode: bad integer at offset %d", d.pos)
+	}
+	d.pos = end + 1
+	return n, nil
+}
+
+// str reads <length>:<bytes>.
+func (d *decoder) str() (string, error) {
+	colon := d.index(':')
+	if colon < 0 {
+		return "", fmt.Errorf("bencode: expected a string at offset %d", d.pos)
+	}
+	n, err := strconv.Atoi(string(d.data[d.pos:colon]))
+	if err != nil || n < 0 || n > len(d.data)-colon-1 {
+		return "", fmt.Errorf("bencode: bad string length at offset %d", d.pos)
+	}
+	d.pos = colon + 1 + n
+	return string(d.data[colon+1 : d.pos]), nil
+}
+
+// index returns the offset of the next c at or after pos, or -1.
+func (d *decoder) index(c byte) int {
+	for i := d.pos; i < len(d.data); i++ {
+		if d.data[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// encode renders v, which may hold the decoded types as well as ints and
+// []byte.
+func encode(v any) []byte {
+	var b []byte
+	var enc func(v any)
+	enc = func(v any) {
+		switch v := v.(type) {
+		case int:
+			b = strconv.AppendInt(append(b, 'i'), int64(v), 10)
+			b = append(b, 'e')
+		case int64:
+			b = strconv.AppendInt(append(b, 'i'), v, 10)
+			b = append(b, 'e')
+		case string:
+			b = append(strconv.AppendInt(b, int64(len(v)), 10), ':')
+			b = append(b, v...)
+		case []byte:
+			enc(string(v))
+		case []any:
+			b = append(b, 'l')
+			for _, x := range v {
+				enc(x)
+			}
+			b = append(b, 'e')
+		case map[string]any:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			b = append(b, 'd')
+			for _, k := range keys {
+				enc(k)
+				enc(v[k])
+			}
+			b = append(b, 'e')
+		default:
+			panic(fmt.Sprintf("bencode: can't encode %T", v))
+		}
+	}
+	enc(v)
+	return b
+}
+
+// Accessors for decoded dictionaries; a missing key or a value of another
+// type yields the zero value.
+
+func dictStr(d map[string]any, key string) string {
+	s, _ := d[key].(string)
+	return s
+}
+
+func dictInt(d map[string]any, key string) (int64, bool) {
+	n, ok := d[key].(int64)
+	return n, ok
+}
+
+func dictList(d map[string]any, key string) []any {
+	l, _ := d[key].([]any)
+	return l
+}
+
+func dictDict(d map[string]any, key string) map[string]any {
+	m, _ := d[key].(map[string]any)
+	return m
+}
@@ -0,0 +1,457 @@
+package torrent
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// output is where a download is written: the files wanted from the torrent,
+// in the partial download at root. That's a file when one file is wanted
+// from the torrent, and a directory of them otherwise.
+type output struct {
+	root    string
+	files   []outFile
+	resumed bool // root held a download already, whose pieces may be good
+}
+
+type outFile struct {
+	fileEntry
+	f *os.File
+}
+
+// openOutput creates (or reopens) the partial download of files at root.
+// Files left over from another torrent are removed.
+func openOutput(root string, files []fileEntry, dir bool) (*output, error) {
+	o := &output{root: root}
+	if fi, err := os.Stat(root); err == nil {
+		o.resumed = fi.IsDir() == dir
+		if !o.resumed {
+			if err := os.RemoveAll(root); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if dir {
+		if err := pruneExcept(root, files); err != nil {
+			return nil, err
+		}
+	}
+	for _, fe := range files {
+		p := root
+		if dir {
+			p = filepath.Join(root, filepath.FromSlash(fe.path))
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			o.close()
+			return nil, err
+		}
+		f, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, 0o644)
+		if err == nil {
+			err = f.Truncate(fe.length)
+		}
+		if err != nil {
+			o.close()
+			return nil, err
+		}
+		o.files = append(o.files, outFile{fe, f})
+	}
+	return o, nil
+}
+
+// pruneExcept removes the files under root that aren't among files.
+func pruneExcept(root string, files []fileEntry) error {
+	keep := map[string]bool{}
+	for _, fe := range files {
+		keep[filepath.Join(root, filepath.FromSlash(fe.path))] = true
+	}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || keep[p] {
+			return err
+		}
+		return os.Remove(p)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (o *output) close() error {
+	var errs []error
+	for _, of := range o.files {
+		errs = append(errs, of.f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// size is the number of bytes o's files hold together.
+func (o *output) size() int64 {
+	var n int64
+	for _, of := range o.files {
+		n += of.length
+	}
+	return n
+}
+
+// span is the part of a piece that falls in one of o's files.
+type span struct {
+	f        *os.File
+	pieceOff int64 // Where in the piece it starts
+	fileOff  int64 // Where in the file it starts
+	n        int64
+}
+
+// spans returns the parts of piece i of m that o's files hold, and whether
+// they make up the whole piece.
+func (o *output) spans(m *metainfo, i int) ([]span, bool) {
+	start := int64(i) * m.pieceLen
+	end := start + m.pieceLength(i)
+	var spans []span
+	var covered int64
+	for _, of := range o.files {
+		lo, hi := max(start, of.offset), min(end, of.offset+of.length)
+		if lo < hi {
+			spans = append(spans, span{f: of.f, pieceOff: lo - start, fileOff: lo - of.offset, n: hi - lo})
+			covered += hi - lo
+		}
+	}
+	return spans, covered == end-start
+}
+
+// pieces returns the pieces of m holding any of o's bytes.
+func (o *output) pieces(m *metainfo) []int {
+	var pieces []int
+	for i := range m.pieces {
+		if spans, _ := o.spans(m, i); len(spans) > 0 {
+			pieces = append(pieces, i)
+		}
+	}
+	return pieces
+}
+
+// write stores o's parts of piece i.
+func (o *output) write(m *metainfo, i int, data []byte) (int64, error) {
+	spans, _ := o.spans(m, i)
+	var n int64
+	for _, s := range spans {
+		if _, err := s.f.WriteAt(data[s.pieceOff:s.pieceOff+s.n], s.fileOff); err != nil {
+			return n, err
+		}
+		n += s.n
+	}
+	return n, nil
+}
+
+// have reports whether o already holds piece i intact, from an earlier
+// attempt. Pieces partly in files that aren't wanted can't be checked, and
+// are downloaded again.
+func (o *output) have(m *metainfo, i int) bool {
+	spans, whole := o.spans(m, i)
+	if !o.resumed || !whole {
+		return false
+	}
+	h := sha1.New()
+	for _, s := range spans {
+		if _, err := io.Copy(h, io.NewSectionReader(s.f, s.fileOff, s.n)); err != nil {
+			return false
+		}
+	}
+	return [20]byte(h.Sum(nil)) == m.pieces[i]
+}
+
+// swarm hands out the pieces of a download to the connections fetching them
+// (peers and web seeds), and takes back the ones they fail at.
+type swarm struct {
+	m        *metainfo
+	out      *output
+	progress registry.Progress
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	pending  []int // Pieces nobody is fetching
+	inFlight int   // Pieces being fetched
+	left     int   // Pieces not yet written
+	written  int64 // Bytes of out's files written
+	total    int64
+	lastErr  error // Why the latest attempt at a piece failed
+}
+
+// newSwarm plans the download of out's pieces, skipping the ones it already
+// holds.
+func newSwarm(m *metainfo, out *output, progress registry.Progress) *swarm {
+	s := &swarm{m: m, out: out, progress: progress, total: out.size()}
+	s.cond = sync.NewCond(&s.mu)
+	for _, i := range out.pieces(m) {
+		if out.have(m, i) {
+			spans, _ := out.spans(m, i)
+			for _, sp := range spans {
+				s.written += sp.n
+			}
+			continue
+		}
+		s.pending = append(s.pending, i)
+	}
+	s.left = len(s.pending)
+	s.report()
+	return s
+}
+
+func (s *swarm) report() {
+	if s.progress != nil {
+		s.progress.Bytes(s.written, s.total)
+	}
+}
+
+// done reports whether every piece has been written.
+func (s *swarm) done() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.left == 0
+}
+
+// claim takes a pending piece that has reports the connection can serve,
+// waiting for one to come free while others are being fetched. It returns
+// false once there's nothing left for the connection to do.
+func (s *swarm) claim(ctx context.Context, has func(int) bool) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if s.left == 0 || ctx.Err() != nil {
+			return 0, false
+		}
+		for j, i := range s.pending {
+			if has(i) {
+				s.pending = append(s.pending[:j], s.pending[j+1:]...)
+				s.inFlight++
+				return i, true
+			}
+		}
+		if s.inFlight == 0 {
+			return 0, false // Nothing this connection can serve will come free
+		}
+		s.cond.Wait()
+	}
+}
+
+// release puts back a piece that couldn't be fetched.
+func (s *swarm) release(i int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, i)
+	s.inFlight--
+	s.lastErr = err
+	s.cond.Broadcast()
+}
+
+// complete checks piece i's hash and writes it, or puts it back if it's
+// damaged.
+func (s *swarm) complete(i int, data []byte) error {
+	if sha1.Sum(data) != s.m.pieces[i] {
+		err := fmt.Errorf("piece %d failed its hash check", i)
+		s.release(i, err)
+		return err
+	}
+	n, err := s.out.write(s.m, i, data)
+	if err != nil {
+		s.release(i, err)
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	s.left--
+	s.written += n
+	s.report()
+	s.cond.Broadcast()
+	return nil
+}
+
+// fail records why a connection gave up before claiming anything.
+func (s *swarm) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr = err
+}
+
+// Connections per download.
+const (
+	maxPeers     = 20 // Peers connected at once
+	webSeedConns = 4  // Requests to each web seed at once
+)
+
+// run fetches the pending pieces from the web seeds and peers, and returns
+// once every piece is written or there's nobody left to fetch from.
+func (s *swarm) run(ctx context.Context, client *http.Client, webSeeds, peers []string, peerID [20]byte) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.cond.Broadcast()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	for _, seed := range webSeeds {
+		for range webSeedConns {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.fetchWebSeed(ctx, client, seed)
+			}()
+		}
+	}
+	slots := make(chan struct{}, maxPeers)
+	for _, addr := range peers {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil || s.done() {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			s.fetchPeer(ctx, addr, peerID)
+		}()
+	}
+	wg.Wait()
+
+	if s.done() {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastErr == nil {
+		return fmt.Errorf("torrent: %d pieces missing, and no peer or web seed to fetch them from", s.left)
+	}
+	return fmt.Errorf("torrent: %d pieces missing; last error: %w", s.left, s.lastErr)
+}
+
+// fetchPeer downloads pieces from one peer until none are left that it has.
+func (s *swarm) fetchPeer(ctx context.Context, addr string, peerID [20]byte) {
+	p, err := dialPeer(ctx, addr, s.m.hash, peerID)
+	if err != nil {
+		s.fail(fmt.Errorf("peer %s: %w", addr, err))
+		return
+	}
+	defer p.Close()
+	npieces := len(s.m.pieces)
+	for len(p.have) == 0 { // Peers say what they have right after the handshake
+		if _, _, err := p.read(npieces); err != nil {
+			s.fail(fmt.Errorf("peer %s: %w", addr, err))
+			return
+		}
+	}
+	if err := p.send(msgInterested, nil); err != nil {
+		s.fail(fmt.Errorf("peer %s: %w", addr, err))
+		return
+	}
+	for {
+		i, ok := s.claim(ctx, p.hasPiece)
+		if !ok {
+			return
+		}
+		data, err := p.downloadPiece(s.m, i)
+		if err != nil {
+			s.release(i, fmt.Errorf("peer %s: %w", addr, err))
+			if errors.Is(err, errChoked) {
+				continue
+			}
+			return
+		}
+		if s.complete(i, data) != nil {
+			return // The peer sends bad data
+		}
+	}
+}
+
+// fetchWebSeed downloads pieces over HTTP from a web seed (BEP 19): a server
+// with the torrent's files at <seed>/<name>/<path>, or at the seed URL
+// itself for a single-file torrent.
+func (s *swarm) fetchWebSeed(ctx context.Context, client *http.Client, seed string) {
+	for {
+		i, ok := s.claim(ctx, func(int) bool { return true })
+		if !ok {
+			return
+		}
+		data, err := s.webSeedPiece(ctx, client, seed, i)
+		if err != nil {
+			s.release(i, fmt.Errorf("web seed %s: %w", seed, err))
+			return
+		}
+		if s.complete(i, data) != nil {
+			return
+		}
+	}
+}
+
+// webSeedPiece reads piece i from a web seed, with a range request for each
+// file it's part of.
+func (s *swarm) webSeedPiece(ctx context.Context, client *http.Client, seed string, i int) ([]byte, error) {
+	m := s.m
+	start := int64(i) * m.pieceLen
+	buf := make([]byte, m.pieceLength(i))
+	for _, f := range m.files {
+		lo, hi := max(start, f.offset), min(start+int64(len(buf)), f.offset+f.length)
+		if lo >= hi {
+			continue
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, webSeedURL(seed, m, f), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", lo-f.offset, hi-f.offset-1))
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var body io.Reader
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			err = httputil.NewStatusError("GET", req.URL.String(), resp)
+		} else {
+			body, err = httputil.RangeBody(resp, lo-f.offset, hi-f.offset-1)
+		}
+		if err == nil {
+			_, err = io.ReadFull(body, buf[lo-start:hi-start])
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// webSeedURL is where a web seed serves file f of m.
+func webSeedURL(seed string, m *metainfo, f fileEntry) string {
+	if !m.multi {
+		if strings.HasSuffix(seed, "/") {
+			return seed + url.PathEscape(m.name)
+		}
+		return seed
+	}
+	u := strings.TrimSuffix(seed, "/") + "/" + url.PathEscape(m.name)
+	for _, part := range strings.Split(f.path, "/") {
+		u += "/" + url.PathEscape(part)
+	}
+	return u
+}
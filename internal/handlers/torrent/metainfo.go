@@ -0,0 +1,230 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// infoHash identifies a torrent: the SHA-1 of its bencoded info dictionary.
+type infoHash [20]byte
+
+func (h infoHash) String() string { return hex.EncodeToString(h[:]) }
+
+// fileEntry is one file of a torrent's payload.
+type fileEntry struct {
+	path   string // Slash-separated, relative to the torrent's root
+	length int64
+	offset int64 // Where it starts in the concatenated payload
+}
+
+// metainfo is what a torrent describes: its files and the hashes of the
+// pieces they're cut into, plus where to get them.
+type metainfo struct {
+	hash     infoHash
+	name     string
+	multi    bool // Files live in a directory named name, rather than name being the file
+	pieceLen int64
+	pieces   [][20]byte
+	files    []fileEntry
+	length   int64    // Of the whole payload
+	trackers []string // announce and announce-list (BEP 12)
+	webSeeds []string // url-list (BEP 19)
+}
+
+// parseTorrent reads a .torrent file.
+func parseTorrent(b []byte) (*metainfo, error) {
+	dict, raw, err := decodeDict(b)
+	if err != nil {
+		return nil, fmt.Errorf("torrent: not a .torrent file: %w", err)
+	}
+	if raw["info"] == nil {
+		return nil, errors.New("torrent: .torrent file has no info dictionary")
+	}
+	m, err := parseInfo(raw["info"], sha1.Sum(raw["info"]))
+	if err != nil {
+		return nil, err
+	}
+	m.trackers = appendNew(m.trackers, dictStr(dict, "announce"))
+	for _, tier := range dictList(dict, "announce-list") {
+		tier, _ := tier.([]any)
+		for _, t := range tier {
+			s, _ := t.(string)
+			m.trackers = appendNew(m.trackers, s)
+		}
+	}
+	switch seeds := dict["url-list"].(type) {
+	case string:
+		m.webSeeds = appendNew(m.webSeeds, seeds)
+	case []any:
+		for _, s := range seeds {
+			s, _ := s.(string)
+			m.webSeeds = appendNew(m.webSeeds, s)
+		}
+	}
+	return m, nil
+}
+
+// parseInfo reads a bencoded info dictionary whose SHA-1 must be want, as
+// from a .torrent file or a peer's metadata.
+func parseInfo(b []byte, want infoHash) (*metainfo, error) {
+	if got := sha1.Sum(b); got != want {
+		return nil, fmt.Errorf("torrent: metadata hashes to %x, not the info hash %s", got, want)
+	}
+	v, err := decode(b)
+	info, _ := v.(map[string]any)
+	if err != nil || info == nil {
+		return nil, fmt.Errorf("torrent: bad info dictionary: %v", err)
+	}
+	m := &metainfo{hash: want, name: dictStr(info, "name")}
+	if !validName(m.name) {
+		return nil, fmt.Errorf("torrent: bad torrent name %q", m.name)
+	}
+	m.pieceLen, _ = dictInt(info, "piece length")
+	if m.pieceLen <= 0 || m.pieceLen > maxPieceLen {
+		return nil, fmt.Errorf("torrent: bad piece length %d", m.pieceLen)
+	}
+	pieces := dictStr(info, "pieces")
+	if len(pieces)%20 != 0 {
+		return nil, errors.New("torrent: bad piece hashes")
+	}
+	for i := 0; i < len(pieces); i += 20 {
+		m.pieces = append(m.pieces, [20]byte([]byte(pieces[i:i+20])))
+	}
+
+	if length, ok := dictInt(info, "length"); ok {
+		m.files = []fileEntry{{path: m.name, length: length}}
+	} else {
+		m.multi = true
+		for _, f := range dictList(info, "files") {
+			f, _ := f.(map[string]any)
+			length, ok := dictInt(f, "length")
+			var parts []string
+			for _, p := range dictList(f, "path") {
+				p, _ := p.(string)
+				if !validName(p) {
+					return nil, fmt.Errorf("torrent: bad file name %q", p)
+				}
+				parts = append(parts, p)
+			}
+			if !ok || len(parts) == 0 {
+				return nil, errors.New("torrent: bad file list")
+			}
+			m.files = append(m.files, fileEntry{path: strings.Join(parts, "/"), length: length})
+		}
+		if len(m.files) == 0 {
+			return nil, errors.New("torrent: no files")
+		}
+	}
+	for i := range m.files {
+		if m.files[i].length < 0 {
+			return nil, fmt.Errorf("torrent: bad length of %s", m.files[i].path)
+		}
+		m.files[i].offset = m.length
+		m.length += m.files[i].length
+	}
+	if want := (m.length + m.pieceLen - 1) / m.pieceLen; int64(len(m.pieces)) != want {
+		return nil, fmt.Errorf("torrent: %d piece hashes for %d pieces", len(m.pieces), want)
+	}
+	return m, nil
+}
+
+// maxPieceLen bounds the piece size: each piece is held in memory while it's
+// checked, and real torrents stay well under it.
+const maxPieceLen = 64 << 20
+
+// validName reports whether s can be used as one component of a path: not
+// empty, not . or .., and without separators that could lead outside the
+// target.
+func validName(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, "/\\\x00")
+}
+
+// pieceLength returns the length of piece i; the last one is usually short.
+func (m *metainfo) pieceLength(i int) int64 {
+	if i == len(m.pieces)-1 {
+		return m.length - int64(i)*m.pieceLen
+	}
+	return m.pieceLen
+}
+
+// file returns the file at p (relative to the torrent's root, without the
+// torrent's name for multi-file torrents).
+func (m *metainfo) file(p string) (fileEntry, error) {
+	p = path.Clean(strings.TrimPrefix(p, "/"))
+	for _, f := range m.files {
+		if f.path == p {
+			return f, nil
+		}
+	}
+	var names []string
+	for i, f := range m.files {
+		if i == 5 {
+			names = append(names, "...")
+			break
+		}
+		names = append(names, f.path)
+	}
+	return fileEntry{}, fmt.Errorf("torrent: no file %q in the torrent (it has %s)", p, strings.Join(names, ", "))
+}
+
+// magnet is a parsed magnet link.
+type magnet struct {
+	hash     infoHash
+	trackers []string // tr
+	webSeeds []string // ws
+	sources  []string // xs: URLs of the .torrent file
+}
+
+// parseMagnet reads a magnet link with a BitTorrent v1 info hash, in hex or
+// base32 (urn:btih:).
+func parseMagnet(raw string) (*magnet, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "magnet" {
+		return nil, fmt.Errorf("torrent: %q is not a magnet link", raw)
+	}
+	q, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("torrent: bad magnet link: %w", err)
+	}
+	mg := &magnet{trackers: q["tr"], webSeeds: q["ws"], sources: q["xs"]}
+	found := false
+	for _, xt := range q["xt"] {
+		btih, ok := strings.CutPrefix(xt, "urn:btih:")
+		if !ok {
+			continue
+		}
+		var b []byte
+		switch len(btih) {
+		case 40:
+			b, err = hex.DecodeString(btih)
+		case 32:
+			b, err = base32.StdEncoding.DecodeString(strings.ToUpper(btih))
+		default:
+			err = errors.New("wrong length")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("torrent: bad info hash %q in magnet link", btih)
+		}
+		copy(mg.hash[:], b)
+		found = true
+	}
+	if !found {
+		return nil, errors.New("torrent: magnet link has no urn:btih: info hash (BitTorrent v2-only magnets aren't supported)")
+	}
+	return mg, nil
+}
+
+// appendNew appends s unless it's empty or already in list.
+func appendNew(list []string, s string) []string {
+	if s == "" || slices.Contains(list, s) {
+		return list
+	}
+	return append(list, s)
+}
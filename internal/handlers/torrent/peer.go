@@ -0,0 +1,311 @@
+package torrent
+
+// This file is the client side of the BitTorrent peer wire protocol (BEP 3):
+// the handshake, then length-prefixed messages over TCP. Peers are asked for
+// pieces in 16 KiB blocks, several at a time. The extension protocol (BEP 10)
+// is spoken only for ut_metadata (BEP 9), which lets a magnet link's info
+// dictionary be fetched from peers.
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/jprybylski/datum/internal/httputil"
+)
+
+// Message IDs.
+const (
+	msgChoke      = 0
+	msgUnchoke    = 1
+	msgInterested = 2
+	msgHave       = 4
+	msgBitfield   = 5
+	msgRequest    = 6
+	msgPiece      = 7
+	msgExtended   = 20
+)
+
+const (
+	protocol = "BitTorrent protocol"
+
+	blockSize     = 16 << 10 // Bytes per request; peers refuse larger ones
+	pipeline      = 16       // Requests kept outstanding
+	maxMessageLen = 1 << 20  // Longer messages end the connection
+	dialTimeout   = 10 * time.Second
+	readTimeout   = 60 * time.Second
+
+	// Our ID for ut_metadata messages, announced in the extended handshake
+	utMetadataID = 1
+	// metadataPieceLen is the size of ut_metadata pieces (BEP 9).
+	metadataPieceLen = 16 << 10
+	// maxMetadataSize bounds the info dictionary a peer may announce.
+	maxMetadataSize = 16 << 20
+)
+
+// peerConn is a connection to one peer, after the handshake.
+type peerConn struct {
+	nc   net.Conn
+	r    *bufio.Reader
+	addr string
+	stop func() bool // Stops closing the connection when the context ends
+
+	extensions   bool  // The peer speaks BEP 10
+	utMetadata   int64 // The peer's ID for ut_metadata messages; 0 if none
+	metadataSize int64
+
+	choked bool   // The peer won't serve requests
+	have   []bool // Pieces the peer has, once known
+}
+
+// dialPeer connects to addr and exchanges handshakes for the torrent hash.
+// Reads are throttled by --max-bandwidth, like every other download, and the
+// connection is closed when ctx ends.
+func dialPeer(ctx context.Context, addr string, hash infoHash, peerID [20]byte) (*peerConn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	p := &peerConn{nc: nc, r: bufio.NewReaderSize(httputil.Throttle(ctx, nc), 64<<10), addr: addr, choked: true}
+	p.stop = context.AfterFunc(ctx, func() { nc.Close() })
+	nc.SetDeadline(time.Now().Add(dialTimeout))
+
+	hs := make([]byte, 0, 68)
+	hs = append(hs, byte(len(protocol)))
+	hs = append(hs, protocol...)
+	reserved := [8]byte{5: 0x10} // Extension protocol
+	hs = append(hs, reserved[:]...)
+	hs = append(hs, hash[:]...)
+	hs = append(hs, peerID[:]...)
+	if _, err := nc.Write(hs); err != nil {
+		p.Close()
+		return nil, err
+	}
+	resp := make([]byte, 68)
+	if _, err := io.ReadFull(p.r, resp); err != nil {
+		p.Close()
+		return nil, err
+	}
+	if resp[0] != byte(len(protocol)) || string(resp[1:20]) != protocol {
+		p.Close()
+		return nil, errors.New("not a BitTorrent peer")
+	}
+	if infoHash(resp[28:48]) != hash {
+		p.Close()
+		return nil, errors.New("peer answered for another torrent")
+	}
+	p.extensions = resp[25]&0x10 != 0
+	if p.extensions {
+		hs := encode(map[string]any{"m": map[string]any{"ut_metadata": utMetadataID}})
+		if err := p.send(msgExtended, append([]byte{0}, hs...)); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	nc.SetDeadline(time.Time{})
+	return p, nil
+}
+
+func (p *peerConn) Close() error {
+	p.stop()
+	return p.nc.Close()
+}
+
+// send writes one message.
+func (p *peerConn) send(id byte, payload []byte) error {
+	msg := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(msg, uint32(1+len(payload)))
+	msg[4] = id
+	p.nc.SetWriteDeadline(time.Now().Add(readTimeout))
+	_, err := p.nc.Write(append(msg, payload...))
+	return err
+}
+
+// read returns the next message, skipping keep-alives, after applying what
+// it says about the peer's state (choking, the pieces it has, its
+// extensions).
+func (p *peerConn) read(npieces int) (id byte, payload []byte, err error) {
+	for {
+		p.nc.SetReadDeadline(time.Now().Add(readTimeout))
+		var hdr [4]byte
+		if _, err := io.ReadFull(p.r, hdr[:]); err != nil {
+			return 0, nil, err
+		}
+		n := binary.BigEndian.Uint32(hdr[:])
+		if n == 0 {
+			continue // Keep-alive
+		}
+		if n > maxMessageLen {
+			return 0, nil, fmt.Errorf("message of %d bytes", n)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(p.r, msg); err != nil {
+			return 0, nil, err
+		}
+		id, payload = msg[0], msg[1:]
+		switch id {
+		case msgChoke:
+			p.choked = true
+		case msgUnchoke:
+			p.choked = false
+		case msgHave:
+			if len(payload) == 4 && npieces > 0 {
+				if i := int(binary.BigEndian.Uint32(payload)); i < npieces {
+					p.knowPieces(npieces)
+					p.have[i] = true
+				}
+			}
+		case msgBitfield:
+			if npieces > 0 {
+				p.knowPieces(npieces)
+				for i := range p.have {
+					if i/8 < len(payload) && payload[i/8]&(0x80>>(i%8)) != 0 {
+						p.have[i] = true
+					}
+				}
+			}
+		case msgExtended:
+			if len(payload) > 0 && payload[0] == 0 { // Extended handshake
+				if v, err := decode(payload[1:]); err == nil {
+					hs, _ := v.(map[string]any)
+					p.utMetadata, _ = dictInt(dictDict(hs, "m"), "ut_metadata")
+					p.metadataSize, _ = dictInt(hs, "metadata_size")
+				}
+			}
+		}
+		return id, payload, nil
+	}
+}
+
+// knowPieces sizes p.have once the piece count is known.
+func (p *peerConn) knowPieces(npieces int) {
+	if len(p.have) != npieces {
+		p.have = make([]bool, npieces)
+	}
+}
+
+// hasPiece reports whether the peer has said it has piece i.
+func (p *peerConn) hasPiece(i int) bool {
+	return i < len(p.have) && p.have[i]
+}
+
+// metadata fetches the torrent's info dictionary from the peer (BEP 9) and
+// checks it against hash.
+func (p *peerConn) metadata(hash infoHash) (*metainfo, error) {
+	if !p.extensions {
+		return nil, errors.New("peer doesn't support metadata exchange")
+	}
+	// The peer's extended handshake says whether it can serve metadata
+	for p.utMetadata == 0 || p.metadataSize == 0 {
+		id, payload, err := p.read(0)
+		if err != nil {
+			return nil, err
+		}
+		if id == msgExtended && len(payload) > 0 && payload[0] == 0 && (p.utMetadata == 0 || p.metadataSize == 0) {
+			return nil, errors.New("peer can't serve metadata")
+		}
+	}
+	if p.metadataSize > maxMetadataSize {
+		return nil, fmt.Errorf("peer announced %d bytes of metadata", p.metadataSize)
+	}
+
+	buf := make([]byte, p.metadataSize)
+	npieces := int((p.metadataSize + metadataPieceLen - 1) / metadataPieceLen)
+	for i := 0; i < npieces; i++ {
+		req := encode(map[string]any{"msg_type": 0, "piece": i})
+		if err := p.send(msgExtended, append([]byte{byte(p.utMetadata)}, req...)); err != nil {
+			return nil, err
+		}
+	}
+	for got := 0; got < npieces; {
+		id, payload, err := p.read(0)
+		if err != nil {
+			return nil, err
+		}
+		if id != msgExtended || len(payload) == 0 || payload[0] != utMetadataID {
+			continue
+		}
+		v, data, err := decodePrefix(payload[1:])
+		msg, _ := v.(map[string]any)
+		if err != nil || msg == nil {
+			return nil, errors.New("bad metadata message")
+		}
+		typ, _ := dictInt(msg, "msg_type")
+		piece, _ := dictInt(msg, "piece")
+		switch {
+		case typ == 2:
+			return nil, errors.New("peer refused to send metadata")
+		case typ != 1:
+			continue
+		case piece < 0 || int(piece) >= npieces || piece*metadataPieceLen+int64(len(data)) > p.metadataSize:
+			return nil, errors.New("bad metadata piece")
+		}
+		copy(buf[piece*metadataPieceLen:], data)
+		got++
+	}
+	return parseInfo(buf, hash)
+}
+
+// errChoked is returned by downloadPiece when the peer stops serving
+// requests part way. Peers do that routinely, so the connection is kept for
+// when it unchokes again.
+var errChoked = errors.New("choked by peer")
+
+// downloadPiece fetches piece i of m, which the peer must have, once the
+// peer unchokes. The caller checks its hash.
+func (p *peerConn) downloadPiece(m *metainfo, i int) ([]byte, error) {
+	npieces := len(m.pieces)
+	for p.choked {
+		if _, _, err := p.read(npieces); err != nil {
+			return nil, err
+		}
+	}
+
+	length := m.pieceLength(i)
+	buf := make([]byte, length)
+	var requested, received int64
+	outstanding := 0
+	for received < length {
+		for outstanding < pipeline && requested < length {
+			n := min(blockSize, length-requested)
+			req := make([]byte, 12)
+			binary.BigEndian.PutUint32(req, uint32(i))
+			binary.BigEndian.PutUint32(req[4:], uint32(requested))
+			binary.BigEndian.PutUint32(req[8:], uint32(n))
+			if err := p.send(msgRequest, req); err != nil {
+				return nil, err
+			}
+			requested += n
+			outstanding++
+		}
+		id, payload, err := p.read(npieces)
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case msgChoke:
+			// Requests are dropped when the peer chokes; the piece is
+			// handed to another peer
+			return nil, errChoked
+		case msgPiece:
+			if len(payload) < 8 || int(binary.BigEndian.Uint32(payload)) != i {
+				continue
+			}
+			begin := int64(binary.BigEndian.Uint32(payload[4:]))
+			block := payload[8:]
+			if begin+int64(len(block)) > length {
+				return nil, errors.New("block out of range")
+			}
+			copy(buf[begin:], block)
+			received += int64(len(block))
+			outstanding--
+		}
+	}
+	return buf, nil
+}
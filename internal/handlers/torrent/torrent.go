@@ -0,0 +1,282 @@
+// Package torrent fetches data distributed over BitTorrent (type: torrent),
+// as Academic Torrents distributes many large machine-learning datasets.
+//
+//	source:
+//	  type: torrent
+//	  url: https://academictorrents.com/download/<infohash>.torrent   # or a magnet: link
+//	  path: train/images.tar   # optional: one file of a multi-file torrent
+//
+// The fingerprint is the torrent's info hash, "btih:<hex>". A torrent's info
+// hash covers the hash of every piece of its payload, so the same hash
+// always means the same data: a magnet link is checked without touching the
+// network, and a .torrent URL changes fingerprint only when it's replaced by
+// a different torrent.
+//
+// Fetch writes the torrent's file to the target or, for a multi-file torrent
+// without path, its files under the target directory. Only the pieces the
+// wanted files need are downloaded, each checked against its SHA-1 from the
+// torrent, from the torrent's web seeds (BEP 19) and from peers found
+// through its trackers (HTTP and UDP). For a magnet link the torrent's
+// metadata is first taken from its xs= .torrent URL, if it has one, or else
+// from peers (BEP 9). An interrupted fetch keeps what it got and the next
+// attempt downloads only the pieces still missing.
+//
+// datum only downloads: it doesn't seed, and doesn't accept connections.
+// Trackerless torrents (DHT only) aren't supported.
+package torrent
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/httputil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+type handler struct {
+	client *http.Client
+	peerID [20]byte // Identifies this client to trackers and peers
+}
+
+// New returns the handler. Like http, its requests (to trackers, web seeds
+// and for .torrent files) draw from httputil.DefaultBudget.
+func New() *handler {
+	h := &handler{client: &http.Client{Timeout: 60 * time.Second, Transport: &httputil.BudgetTransport{}}}
+	copy(h.peerID[:], "-DT0100-") // Azureus-style: client and version
+	rand.Read(h.peerID[8:])
+	return h
+}
+
+func (h *handler) Name() string { return "torrent" }
+
+// maxTorrentSize bounds the .torrent files read; those of the largest
+// datasets run to a few megabytes.
+const maxTorrentSize = 32 << 20
+
+// Fingerprint is the torrent's info hash: from the magnet link itself, or
+// from the .torrent file at the source's URL.
+func (h *handler) Fingerprint(ctx context.Context, src registry.Source) (string, error) {
+	if strings.HasPrefix(src.URL, "magnet:") {
+		mg, err := parseMagnet(src.URL)
+		if err != nil {
+			return "", err
+		}
+		return "btih:" + mg.hash.String(), nil
+	}
+	m, err := h.torrentFile(ctx, src.URL)
+	if err != nil {
+		return "", err
+	}
+	if src.Path != "" {
+		if _, err := m.file(src.Path); err != nil {
+			return "", err
+		}
+	}
+	return "btih:" + m.hash.String(), nil
+}
+
+// Fetch downloads the torrent's payload, or the one file of it named by
+// src.Path, to dest.
+func (h *handler) Fetch(ctx context.Context, src registry.Source, dest string) error {
+	m, err := h.metainfo(ctx, src)
+	if err != nil {
+		return err
+	}
+	files, dir := m.files, m.multi
+	if src.Path != "" {
+		f, err := m.file(src.Path)
+		if err != nil {
+			return err
+		}
+		files, dir = []fileEntry{f}, false
+	}
+
+	partial := fsutil.PartialPath(dest)
+	out, err := openOutput(partial, files, dir)
+	if err != nil {
+		return err
+	}
+	s := newSwarm(m, out, src.Progress)
+	if !s.done() {
+		var peers []string
+		if len(m.trackers) > 0 {
+			// Web seeds alone may do, but they're often slow or gone
+			peers, err = h.announceAll(ctx, m.trackers, m.hash, h.peerID, s.total-s.written)
+			if err != nil && len(m.webSeeds) == 0 {
+				out.close()
+				return fmt.Errorf("torrent: no peers: %w", err)
+			}
+		}
+		if len(peers) == 0 && len(m.webSeeds) == 0 {
+			out.close()
+			return fmt.Errorf("torrent: %s has no web seeds and its trackers know no peers", m.hash)
+		}
+		if src.Progress != nil {
+			src.Progress.Status(fmt.Sprintf("%d peers, %d web seeds", len(peers), len(m.webSeeds)))
+		}
+		err = s.run(ctx, h.client, m.webSeeds, peers, h.peerID)
+	}
+	if cerr := out.close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err // The partial download is kept for the next attempt
+	}
+	if dir {
+		return fsutil.ReplaceDir(partial, dest)
+	}
+	return os.Rename(partial, dest)
+}
+
+// metainfo returns the torrent src names: from its .torrent URL or, for a
+// magnet link, from the link's xs= .torrent URLs or from peers.
+func (h *handler) metainfo(ctx context.Context, src registry.Source) (*metainfo, error) {
+	if !strings.HasPrefix(src.URL, "magnet:") {
+		return h.torrentFile(ctx, src.URL)
+	}
+	mg, err := parseMagnet(src.URL)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	m, err := h.magnetSources(ctx, mg)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if m == nil && len(mg.trackers) > 0 {
+		m, err = h.peerMetadata(ctx, mg)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if m == nil {
+		if len(errs) == 0 {
+			return nil, fmt.Errorf("torrent: magnet link for %s has neither trackers (tr=) nor a .torrent URL (xs=) to get its metadata from", mg.hash)
+		}
+		return nil, fmt.Errorf("torrent: no metadata for %s: %w", mg.hash, errors.Join(errs...))
+	}
+	for _, tr := range mg.trackers {
+		m.trackers = appendNew(m.trackers, tr)
+	}
+	for _, ws := range mg.webSeeds {
+		m.webSeeds = appendNew(m.webSeeds, ws)
+	}
+	return m, nil
+}
+
+// magnetSources reads a magnet link's torrent from the .torrent URLs it
+// gives (xs=), the first that has it.
+func (h *handler) magnetSources(ctx context.Context, mg *magnet) (*metainfo, error) {
+	var errs []error
+	for _, xs := range mg.sources {
+		if u, err := url.Parse(xs); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		m, err := h.torrentFile(ctx, xs)
+		if err == nil && m.hash != mg.hash {
+			err = fmt.Errorf("torrent: %s is the torrent %s, not %s", xs, m.hash, mg.hash)
+		}
+		if err == nil {
+			return m, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// peerMetadata asks peers for a magnet link's metadata, several at once,
+// and returns the first that checks out.
+func (h *handler) peerMetadata(ctx context.Context, mg *magnet) (*metainfo, error) {
+	peers, err := h.announceAll(ctx, mg.trackers, mg.hash, h.peerID, 1) // Size unknown, but not done
+	if err != nil {
+		return nil, err
+	}
+	if len(peers) == 0 {
+		return nil, errors.New("the trackers know no peers")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu      sync.Mutex
+		found   *metainfo
+		lastErr error
+		wg      sync.WaitGroup
+	)
+	slots := make(chan struct{}, 8)
+	for _, addr := range peers {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			p, err := dialPeer(ctx, addr, mg.hash, h.peerID)
+			var m *metainfo
+			if err == nil {
+				m, err = p.metadata(mg.hash)
+				p.Close()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				lastErr = fmt.Errorf("peer %s: %w", addr, err)
+				return
+			}
+			if found == nil {
+				found = m
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	if found == nil {
+		return nil, lastErr
+	}
+	return found, nil
+}
+
+// torrentFile downloads and parses the .torrent file at rawURL.
+func (h *handler) torrentFile(ctx context.Context, rawURL string) (*metainfo, error) {
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("torrent: source.url must be a magnet: link or an http(s) URL of a .torrent file, not %q", rawURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, httputil.NewStatusError(http.MethodGet, rawURL, resp)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxTorrentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxTorrentSize {
+		return nil, fmt.Errorf("torrent: %s is over %d MiB, too big for a .torrent file", rawURL, maxTorrentSize>>20)
+	}
+	return parseTorrent(b)
+}
+
+func init() {
+	registry.Register(New())
+}
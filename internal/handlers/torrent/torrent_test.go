@@ -0,0 +1,342 @@
+package torrent
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestHandler_Name(t *testing.T) {
+	if got := New().Name(); got != "torrent" {
+		t.Errorf("Name() = %v, want torrent", got)
+	}
+}
+
+func TestBencode(t *testing.T) {
+	v := map[string]any{"b": []any{int64(-3), "x\x00y"}, "a": map[string]any{"n": int64(42)}}
+	b := encode(v)
+	if want := "d1:ad1:ni42ee1:bli-3e3:x\x00yee"; string(b) != want {
+		t.Errorf("encode() = %q, want %q", b, want)
+	}
+	got, err := decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encode(got)) != string(b) {
+		t.Errorf("decode() = %v, doesn't encode back the same", got)
+	}
+	_, raw, err := decodeDict(b)
+	if err != nil || string(raw["a"]) != "d1:ni42ee" {
+		t.Errorf("decodeDict() raw a = %q, %v", raw["a"], err)
+	}
+	for _, bad := range []string{"", "i42", "5:abc", "l", "d1:ae", "i4x2e", "de junk", strings.Repeat("l", maxDepth+2)} {
+		if _, err := decode([]byte(bad)); err == nil {
+			t.Errorf("decode(%q) succeeded", bad)
+		}
+	}
+}
+
+// testFile is a file of a test torrent; one without a path makes a
+// single-file torrent.
+type testFile struct{ path, data string }
+
+// testTorrent builds a .torrent of files cut into pieces of pieceLen, with
+// the top-level keys in extra.
+func testTorrent(files []testFile, pieceLen int, extra map[string]any) (torrent, info []byte, payload string) {
+	infoDict := map[string]any{"name": "set", "piece length": pieceLen}
+	if len(files) == 1 && files[0].path == "" {
+		infoDict["name"], infoDict["length"] = "data.bin", len(files[0].data)
+	} else {
+		var list []any
+		for _, f := range files {
+			var path []any
+			for _, p := range strings.Split(f.path, "/") {
+				path = append(path, p)
+			}
+			list = append(list, map[string]any{"length": len(f.data), "path": path})
+		}
+		infoDict["files"] = list
+	}
+	for _, f := range files {
+		payload += f.data
+	}
+	var pieces string
+	for i := 0; i < len(payload); i += pieceLen {
+		sum := sha1.Sum([]byte(payload[i:min(i+pieceLen, len(payload))]))
+		pieces += string(sum[:])
+	}
+	infoDict["pieces"] = pieces
+	info = encode(infoDict)
+	top := map[string]any{"info": "placeholder"}
+	for k, v := range extra {
+		top[k] = v
+	}
+	torrent = []byte(strings.Replace(string(encode(top)), "4:info11:placeholder", "4:info"+string(info), 1))
+	return torrent, info, payload
+}
+
+var testFiles = []testFile{
+	{"readme.txt", "a torrent of test data\n"},
+	{"train/a.csv", strings.Repeat("x,y\n", 40)},
+	{"train/b.csv", strings.Repeat("1,2\n", 25)},
+}
+
+func TestParseTorrent(t *testing.T) {
+	b, info, _ := testTorrent(testFiles, 64, map[string]any{
+		"announce":      "http://tracker.example/announce",
+		"announce-list": []any{[]any{"http://tracker.example/announce", "udp://tracker.example:80"}},
+		"url-list":      "https://seed.example/",
+	})
+	m, err := parseTorrent(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.hash != sha1.Sum(info) || !m.multi || len(m.files) != 3 || m.length != 283 || len(m.pieces) != 5 {
+		t.Errorf("parseTorrent() = %+v", m)
+	}
+	if len(m.trackers) != 2 || len(m.webSeeds) != 1 {
+		t.Errorf("trackers %v, web seeds %v; want 2 and 1", m.trackers, m.webSeeds)
+	}
+	if f, err := m.file("/train/b.csv"); err != nil || f.offset != 183 {
+		t.Errorf("file(train/b.csv) = %+v, %v", f, err)
+	}
+	if _, err := m.file("train"); err == nil {
+		t.Error("file(train) found a directory")
+	}
+
+	evil, _, _ := testTorrent([]testFile{{"../escape.txt", "x"}, {"b", "y"}}, 64, nil)
+	if _, err := parseTorrent(evil); err == nil {
+		t.Error("parseTorrent() accepted a file outside the torrent")
+	}
+}
+
+func TestParseMagnet(t *testing.T) {
+	hash := sha1.Sum([]byte("x"))
+	hexHash := infoHash(hash).String()
+	b32 := base32.StdEncoding.EncodeToString(hash[:])
+	for _, link := range []string{
+		"magnet:?xt=urn:btih:" + hexHash + "&dn=set&tr=http%3A%2F%2Ftracker.example%2Fannounce",
+		"magnet:?xt=urn:btih:" + strings.ToUpper(hexHash),
+		"magnet:?xt=urn:btih:" + strings.ToLower(b32),
+	} {
+		mg, err := parseMagnet(link)
+		if err != nil || mg.hash != hash {
+			t.Errorf("parseMagnet(%q) = %+v, %v", link, mg, err)
+		}
+	}
+	for _, bad := range []string{"https://example.com/x.torrent", "magnet:?xt=urn:btmh:1220abcd", "magnet:?xt=urn:btih:xyz"} {
+		if _, err := parseMagnet(bad); err == nil {
+			t.Errorf("parseMagnet(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestHandler_WebSeed(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	b, info, _ := testTorrent(testFiles, 64, map[string]any{"url-list": []any{server.URL + "/seed/"}})
+	mux.HandleFunc("/set.torrent", func(w http.ResponseWriter, r *http.Request) { w.Write(b) })
+	for _, f := range testFiles {
+		mux.HandleFunc("/seed/set/"+f.path, func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, f.path, time.Time{}, strings.NewReader(f.data))
+		})
+	}
+
+	h := New()
+	src := registry.Source{Type: "torrent", URL: server.URL + "/set.torrent"}
+	fp, err := h.Fingerprint(context.Background(), src)
+	if want := "btih:" + infoHash(sha1.Sum(info)).String(); err != nil || fp != want {
+		t.Errorf("Fingerprint() = %q, %v; want %s", fp, err, want)
+	}
+
+	// The whole torrent, as a directory
+	dest := filepath.Join(t.TempDir(), "set")
+	if err := h.Fetch(context.Background(), src, dest); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	for _, f := range testFiles {
+		if got, _ := os.ReadFile(filepath.Join(dest, filepath.FromSlash(f.path))); string(got) != f.data {
+			t.Errorf("%s = %q, want %q", f.path, got, f.data)
+		}
+	}
+
+	// One file of it
+	src.Path = "train/b.csv"
+	dest = filepath.Join(t.TempDir(), "b.csv")
+	if err := h.Fetch(context.Background(), src, dest); err != nil {
+		t.Fatalf("Fetch(path) error = %v", err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != testFiles[2].data {
+		t.Errorf("Fetch(path) wrote %q", got)
+	}
+	src.Path = "train/c.csv"
+	if _, err := h.Fingerprint(context.Background(), src); err == nil || !strings.Contains(err.Error(), "no file") {
+		t.Errorf("Fingerprint() of a missing file error = %v", err)
+	}
+}
+
+func TestHandler_Resume(t *testing.T) {
+	data := strings.Repeat("resumable ", 30)
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.ServeContent(w, r, "data.bin", time.Time{}, strings.NewReader(data))
+	}))
+	defer server.Close()
+	b, _, _ := testTorrent([]testFile{{"", data}}, 32, map[string]any{"url-list": server.URL + "/data.bin"})
+	m, err := parseTorrent(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An earlier attempt got all but the last piece
+	dest := filepath.Join(t.TempDir(), "data.bin")
+	os.WriteFile(fsutil.PartialPath(dest), []byte(data[:len(data)-5]), 0o644)
+	out, err := openOutput(fsutil.PartialPath(dest), m.files, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSwarm(m, out, nil)
+	if err := s.run(context.Background(), New().client, m.webSeeds, nil, [20]byte{}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	out.close()
+	if requests != 1 {
+		t.Errorf("%d web seed requests, want 1 for the missing piece", requests)
+	}
+	if got, _ := os.ReadFile(fsutil.PartialPath(dest)); string(got) != data {
+		t.Errorf("resumed download = %q", got)
+	}
+}
+
+func TestHandler_MagnetFromPeers(t *testing.T) {
+	_, info, payload := testTorrent(testFiles, 64, nil)
+	hash := infoHash(sha1.Sum(info))
+	peer := seed(t, info, payload, 64)
+
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("info_hash") != string(hash[:]) {
+			w.Write(encode(map[string]any{"failure reason": "unknown torrent"}))
+			return
+		}
+		host, port, _ := net.SplitHostPort(peer)
+		compact := make([]byte, 6)
+		copy(compact, net.ParseIP(host).To4())
+		p, _ := net.LookupPort("tcp", port)
+		binary.BigEndian.PutUint16(compact[4:], uint16(p))
+		w.Write(encode(map[string]any{"interval": 1800, "peers": string(compact)}))
+	}))
+	defer tracker.Close()
+
+	h := New()
+	src := registry.Source{Type: "torrent", URL: "magnet:?xt=urn:btih:" + hash.String() + "&tr=" + url.QueryEscape(tracker.URL+"/announce")}
+	if fp, err := h.Fingerprint(context.Background(), src); err != nil || fp != "btih:"+hash.String() {
+		t.Errorf("Fingerprint() = %q, %v", fp, err)
+	}
+	src.Path = "train/a.csv"
+	dest := filepath.Join(t.TempDir(), "a.csv")
+	if err := h.Fetch(context.Background(), src, dest); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != testFiles[1].data {
+		t.Errorf("Fetch() wrote %q, want %q", got, testFiles[1].data)
+	}
+}
+
+// seed serves the torrent with info dictionary info and the given payload
+// to peers on a local port, and returns its address. It speaks just enough
+// of the protocol for the client: the handshakes, metadata and pieces.
+func seed(t *testing.T, info []byte, payload string, pieceLen int) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	hash := sha1.Sum(info)
+	npieces := (len(payload) + pieceLen - 1) / pieceLen
+	send := func(w io.Writer, id byte, payload []byte) {
+		msg := binary.BigEndian.AppendUint32(nil, uint32(1+len(payload)))
+		w.Write(append(append(msg, id), payload...))
+	}
+	serve := func(c net.Conn) {
+		defer c.Close()
+		r := bufio.NewReader(c)
+		hs := make([]byte, 68)
+		if _, err := io.ReadFull(r, hs); err != nil || string(hs[28:48]) != string(hash[:]) {
+			return
+		}
+		reply := append([]byte{19}, "BitTorrent protocol"...)
+		reply = append(reply, 0, 0, 0, 0, 0, 0x10, 0, 0)
+		reply = append(reply, hash[:]...)
+		c.Write(append(reply, "-TS0001-seedseedseed"...))
+		ext := encode(map[string]any{"m": map[string]any{"ut_metadata": 2}, "metadata_size": len(info)})
+		send(c, msgExtended, append([]byte{0}, ext...))
+		bitfield := make([]byte, (npieces+7)/8)
+		for i := 0; i < npieces; i++ {
+			bitfield[i/8] |= 0x80 >> (i % 8)
+		}
+		send(c, msgBitfield, bitfield)
+
+		clientMetadataID := byte(0)
+		for {
+			var hdr [4]byte
+			if _, err := io.ReadFull(r, hdr[:]); err != nil {
+				return
+			}
+			msg := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+			if _, err := io.ReadFull(r, msg); err != nil || len(msg) == 0 {
+				return
+			}
+			switch msg[0] {
+			case msgInterested:
+				send(c, msgUnchoke, nil)
+			case msgRequest:
+				index := int(binary.BigEndian.Uint32(msg[1:]))
+				begin := int(binary.BigEndian.Uint32(msg[5:]))
+				n := int(binary.BigEndian.Uint32(msg[9:]))
+				off := index*pieceLen + begin
+				send(c, msgPiece, append(append([]byte(nil), msg[1:9]...), payload[off:off+n]...))
+			case msgExtended:
+				v, _, _ := decodePrefix(msg[2:])
+				d, _ := v.(map[string]any)
+				if msg[1] == 0 {
+					id, _ := dictInt(dictDict(d, "m"), "ut_metadata")
+					clientMetadataID = byte(id)
+					continue
+				}
+				piece, _ := dictInt(d, "piece")
+				start := int(piece) * metadataPieceLen
+				data := info[start:min(start+metadataPieceLen, len(info))]
+				resp := encode(map[string]any{"msg_type": 1, "piece": piece, "total_size": len(info)})
+				send(c, msgExtended, append(append([]byte{clientMetadataID}, resp...), data...))
+			}
+		}
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(c)
+		}
+	}()
+	return ln.Addr().String()
+}
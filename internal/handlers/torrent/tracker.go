@@ -0,0 +1,240 @@
+package torrent
+
+// Trackers tell a client which peers have a torrent. Both kinds in use are
+// spoken: HTTP trackers (BEP 3, with compact peer lists from BEP 23) and UDP
+// trackers (BEP 15). datum only downloads, so it announces a port it doesn't
+// listen on and never reports progress after the first announce.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jprybylski/datum/internal/httputil"
+)
+
+// announcePort is the port datum claims to listen on. Nothing does; peers
+// that try to connect are turned away by the OS.
+const announcePort = 6881
+
+// trackerTimeout bounds each announce, so one dead tracker among several
+// doesn't hold up the download.
+const trackerTimeout = 15 * time.Second
+
+// announceAll asks every tracker for peers of the torrent at once, and
+// returns the addresses ("host:port") all of them gave, in the order they
+// arrived. It fails only if every tracker does.
+func (h *handler) announceAll(ctx context.Context, trackers []string, hash infoHash, peerID [20]byte, left int64) ([]string, error) {
+	var (
+		mu    sync.Mutex
+		peers []string
+		errs  []error
+		wg    sync.WaitGroup
+	)
+	for _, tr := range trackers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, trackerTimeout)
+			defer cancel()
+			got, err := h.announce(ctx, tr, hash, peerID, left)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("tracker %s: %w", tr, err))
+			}
+			for _, p := range got {
+				peers = appendNew(peers, p)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(peers) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return peers, nil
+}
+
+// announce asks one tracker for peers.
+func (h *handler) announce(ctx context.Context, tracker string, hash infoHash, peerID [20]byte, left int64) ([]string, error) {
+	u, err := url.Parse(tracker)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return h.announceHTTP(ctx, tracker, hash, peerID, left)
+	case "udp":
+		return announceUDP(ctx, u.Host, hash, peerID, left)
+	}
+	return nil, fmt.Errorf("unsupported tracker scheme %q", u.Scheme)
+}
+
+func (h *handler) announceHTTP(ctx context.Context, tracker string, hash infoHash, peerID [20]byte, left int64) ([]string, error) {
+	q := url.Values{
+		"info_hash":  {string(hash[:])},
+		"peer_id":    {string(peerID[:])},
+		"port":       {strconv.Itoa(announcePort)},
+		"uploaded":   {"0"},
+		"downloaded": {"0"},
+		"left":       {strconv.FormatInt(left, 10)},
+		"compact":    {"1"},
+		"event":      {"started"},
+	}
+	sep := "?"
+	if strings.Contains(tracker, "?") {
+		sep = "&"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tracker+sep+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, httputil.NewStatusError("GET", tracker, resp)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+	v, err := decode(body)
+	dict, _ := v.(map[string]any)
+	if err != nil || dict == nil {
+		return nil, fmt.Errorf("bad response: %v", err)
+	}
+	if reason := dictStr(dict, "failure reason"); reason != "" {
+		return nil, errors.New(reason)
+	}
+	var peers []string
+	switch p := dict["peers"].(type) {
+	case string: // Compact: 4-byte IPv4 address and 2-byte port each
+		peers = compactPeers(p, 4)
+	case []any:
+		for _, e := range p {
+			e, _ := e.(map[string]any)
+			port, _ := dictInt(e, "port")
+			if ip := dictStr(e, "ip"); ip != "" && port > 0 && port < 65536 {
+				peers = append(peers, net.JoinHostPort(ip, strconv.FormatInt(port, 10)))
+			}
+		}
+	}
+	return append(peers, compactPeers(dictStr(dict, "peers6"), 16)...), nil
+}
+
+// compactPeers decodes a compact peer list of addresses ipLen bytes long.
+func compactPeers(b string, ipLen int) []string {
+	var peers []string
+	for n := ipLen + 2; len(b) >= n; b = b[n:] {
+		ip := net.IP([]byte(b[:ipLen]))
+		port := binary.BigEndian.Uint16([]byte(b[ipLen:n]))
+		peers = append(peers, net.JoinHostPort(ip.String(), strconv.Itoa(int(port))))
+	}
+	return peers
+}
+
+// UDP tracker actions.
+const (
+	udpConnect  = 0
+	udpAnnounce = 1
+	udpError    = 3
+)
+
+// udpProtocolID is the magic constant a UDP tracker connection starts with.
+const udpProtocolID = 0x41727101980
+
+// announceUDP announces to the UDP tracker at addr: a connect exchange for a
+// connection ID, then the announce itself. Lost datagrams are resent a few
+// times, with growing waits.
+func announceUDP(ctx context.Context, addr string, hash infoHash, peerID [20]byte, left int64) ([]string, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	req := make([]byte, 16)
+	binary.BigEndian.PutUint64(req, udpProtocolID)
+	binary.BigEndian.PutUint32(req[8:], udpConnect)
+	resp, err := udpExchange(ctx, conn, req, 16)
+	if err != nil {
+		return nil, err
+	}
+	connID := resp[8:16]
+
+	req = make([]byte, 98)
+	copy(req, connID)
+	binary.BigEndian.PutUint32(req[8:], udpAnnounce)
+	copy(req[16:], hash[:])
+	copy(req[36:], peerID[:])
+	binary.BigEndian.PutUint64(req[64:], uint64(left))
+	binary.BigEndian.PutUint32(req[80:], 2)          // Event: started
+	binary.BigEndian.PutUint32(req[92:], 0xffffffff) // As many peers as it likes
+	binary.BigEndian.PutUint16(req[96:], announcePort)
+	resp, err = udpExchange(ctx, conn, req, 20)
+	if err != nil {
+		return nil, err
+	}
+	ipLen := 4
+	if ip, ok := conn.RemoteAddr().(*net.UDPAddr); ok && ip.IP.To4() == nil {
+		ipLen = 16 // An IPv6 tracker answers with IPv6 peers
+	}
+	return compactPeers(string(resp[20:]), ipLen), nil
+}
+
+// udpExchange sends req, with a fresh transaction ID, until a response to it
+// of at least min bytes arrives.
+func udpExchange(ctx context.Context, conn net.Conn, req []byte, min int) ([]byte, error) {
+	action := binary.BigEndian.Uint32(req[8:])
+	rand.Read(req[12:16])
+	txID := binary.BigEndian.Uint32(req[12:])
+	buf := make([]byte, 64<<10)
+	wait := 2 * time.Second
+	for attempt := 0; attempt < 3; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(wait))
+		for {
+			n, err := conn.Read(buf)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				break // Resend
+			}
+			if err != nil {
+				return nil, err
+			}
+			if n < 8 || binary.BigEndian.Uint32(buf[4:]) != txID {
+				continue // Stray datagram
+			}
+			switch got := binary.BigEndian.Uint32(buf); {
+			case got == udpError:
+				return nil, errors.New(string(buf[8:n]))
+			case got != action || n < min:
+				return nil, fmt.Errorf("bad response (action %d, %d bytes)", got, n)
+			}
+			return buf[:n], nil
+		}
+		wait *= 2
+	}
+	return nil, errors.New("no response")
+}
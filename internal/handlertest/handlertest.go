@@ -0,0 +1,171 @@
+// Package handlertest is a conformance test kit for registry.Fetcher implementations.
+//
+// Every handler is expected to honor the same contracts, whatever its source:
+//   - Name is non-empty, stable and free of whitespace (it's the config's source.type)
+//   - Fingerprint is deterministic for an unchanged source
+//   - Fetch creates missing parent directories, fully replaces an existing
+//     destination, and leaves no temp files behind
+//   - Sources missing required fields fail both Fingerprint and Fetch without
+//     creating the destination
+//   - A cancelled context makes Fingerprint and Fetch fail without creating the
+//     destination
+//
+// Handler authors call Run from their own tests with fixtures describing a
+// working source and some broken ones:
+//
+//	func TestConformance(t *testing.T) {
+//	    handlertest.Run(t, New(), handlertest.Fixtures{
+//	        Valid:   []handlertest.Fixture{{Source: src, Content: []byte("data")}},
+//	        Invalid: []registry.Source{{}},
+//	    })
+//	}
+package handlertest
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// Fixture is a source the handler under test can fingerprint and fetch.
+type Fixture struct {
+	Name    string          // Subtest name (defaults to the source type)
+	Source  registry.Source // A working source
+	Content []byte          // Expected fetched content; nil skips the comparison
+}
+
+// Fixtures describes the sources Run exercises.
+type Fixtures struct {
+	Valid   []Fixture         // Working sources
+	Invalid []registry.Source // Sources missing required fields
+}
+
+// Run checks h against the handler contracts using fx.
+func Run(t *testing.T, h registry.Fetcher, fx Fixtures) {
+	t.Helper()
+
+	t.Run("Name", func(t *testing.T) {
+		name := h.Name()
+		if name == "" {
+			t.Fatal("Name() is empty")
+		}
+		if strings.ContainsAny(name, " \t\n") {
+			t.Errorf("Name() = %q contains whitespace", name)
+		}
+		if again := h.Name(); again != name {
+			t.Errorf("Name() not stable: %q then %q", name, again)
+		}
+	})
+
+	for _, f := range fx.Valid {
+		name := f.Name
+		if name == "" {
+			name = f.Source.Type
+		}
+		if name == "" {
+			name = "valid"
+		}
+		t.Run(name, func(t *testing.T) {
+			checkValid(t, h, f)
+		})
+	}
+
+	for _, src := range fx.Invalid {
+		src := src
+		t.Run("invalid", func(t *testing.T) {
+			checkFails(t, h, context.Background(), src)
+		})
+	}
+
+	if len(fx.Valid) > 0 {
+		t.Run("cancelled context", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			checkFails(t, h, ctx, fx.Valid[0].Source)
+		})
+	}
+}
+
+// checkValid runs the fingerprint and fetch contracts for a working source.
+func checkValid(t *testing.T, h registry.Fetcher, f Fixture) {
+	ctx := context.Background()
+
+	fp1, err := h.Fingerprint(ctx, f.Source)
+	if err != nil {
+		t.Fatalf("Fingerprint() error = %v", err)
+	}
+	if fp1 == "" {
+		t.Error("Fingerprint() returned an empty fingerprint")
+	}
+	if fp2, err := h.Fingerprint(ctx, f.Source); err != nil || fp2 != fp1 {
+		t.Errorf("Fingerprint() not deterministic: %q then %q (err %v)", fp1, fp2, err)
+	}
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "nested", "deeper", "target.dat")
+	if err := h.Fetch(ctx, f.Source, dest); err != nil {
+		t.Fatalf("Fetch() into missing parent directories: %v", err)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("Fetch() did not create the destination: %v", err)
+	}
+	if f.Content != nil && !bytes.Equal(got, f.Content) {
+		t.Errorf("Fetch() content = %q, want %q", got, f.Content)
+	}
+
+	// A longer existing file must be replaced, not partially overwritten
+	stale := append(bytes.Repeat([]byte("stale "), 64), got...)
+	if err := os.WriteFile(dest, stale, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Fetch(ctx, f.Source, dest); err != nil {
+		t.Fatalf("Fetch() over an existing destination: %v", err)
+	}
+	if again, _ := os.ReadFile(dest); !bytes.Equal(again, got) {
+		t.Errorf("Fetch() over an existing destination left %d bytes, want %d", len(again), len(got))
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(dest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != filepath.Base(dest) {
+			t.Errorf("Fetch() left %q next to the destination", e.Name())
+		}
+	}
+
+	// Conditional fetches must skip an unchanged source without touching dest
+	if cf, ok := h.(registry.ConditionalFetcher); ok {
+		fresh := filepath.Join(dir, "conditional.dat")
+		fetched, err := cf.FetchIfChanged(ctx, f.Source, fresh, fp1)
+		if err != nil {
+			t.Fatalf("FetchIfChanged() with the current fingerprint: %v", err)
+		}
+		_, statErr := os.Stat(fresh)
+		if fetched == os.IsNotExist(statErr) {
+			t.Errorf("FetchIfChanged() = %v, but dest exists: %v", fetched, statErr == nil)
+		}
+	}
+}
+
+// checkFails asserts that both operations fail for src under ctx and that no
+// destination file appears.
+func checkFails(t *testing.T, h registry.Fetcher, ctx context.Context, src registry.Source) {
+	if fp, err := h.Fingerprint(ctx, src); err == nil {
+		t.Errorf("Fingerprint() = %q, want an error", fp)
+	}
+	dest := filepath.Join(t.TempDir(), "target.dat")
+	if err := h.Fetch(ctx, src, dest); err == nil {
+		t.Error("Fetch() succeeded, want an error")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("failed Fetch() created the destination")
+	}
+}
@@ -0,0 +1,156 @@
+package httputil
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// DefaultPerHost is how many requests may be in flight to one host when the
+// config doesn't say otherwise.
+const DefaultPerHost = 4
+
+// Budget caps how many HTTP requests are in flight at once, in total and per
+// host. A request holds its slots from the moment it is sent until its
+// response body is closed (or read to the end), so a slow download counts
+// against the budget for as long as it runs.
+//
+// This is what keeps a high --jobs value from opening dozens of connections to
+// the same server: workers beyond the limit simply wait their turn.
+//
+// Go learning note: each limit is a buffered channel used as a counting
+// semaphore, as in core.forEachDataset. Per-host slots are taken before the
+// global one, always in that order, so a request waiting on a busy host never
+// holds a global slot that requests to idle hosts could use.
+type Budget struct {
+	mu      sync.Mutex
+	total   chan struct{}            // nil = no global limit
+	perHost int                      // <= 0 = no per-host limit
+	hosts   map[string]chan struct{} // Per-host semaphores, created on first use
+}
+
+// DefaultBudget is shared by every transport that doesn't name its own, so
+// all of datum's HTTP traffic draws from one pool. The config sets its limits
+// (defaults.max_connections and defaults.max_connections_per_host).
+var DefaultBudget = NewBudget(0, DefaultPerHost)
+
+// NewBudget returns a budget allowing total requests overall and perHost per
+// host; zero or less means unlimited.
+func NewBudget(total, perHost int) *Budget {
+	b := &Budget{}
+	b.SetLimits(total, perHost)
+	return b
+}
+
+// SetLimits changes the limits for requests started from now on. Requests
+// already in flight keep (and release) the slots they took.
+func (b *Budget) SetLimits(total, perHost int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total = nil
+	if total > 0 {
+		b.total = make(chan struct{}, total)
+	}
+	b.perHost = perHost
+	b.hosts = map[string]chan struct{}{}
+}
+
+// semaphores returns the channels a request to host must acquire, in order.
+func (b *Budget) semaphores(host string) []chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var sems []chan struct{}
+	if b.perHost > 0 {
+		h, ok := b.hosts[host]
+		if !ok {
+			h = make(chan struct{}, b.perHost)
+			b.hosts[host] = h
+		}
+		sems = append(sems, h)
+	}
+	if b.total != nil {
+		sems = append(sems, b.total)
+	}
+	return sems
+}
+
+// acquire waits for a slot for host, returning the function that gives it
+// back, or the request's error if it is cancelled first.
+func (b *Budget) acquire(req *http.Request) (release func(), err error) {
+	sems := b.semaphores(req.URL.Host)
+	for i, sem := range sems {
+		select {
+		case sem <- struct{}{}:
+		case <-req.Context().Done():
+			for _, held := range sems[:i] {
+				<-held
+			}
+			return nil, req.Context().Err()
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			for _, sem := range sems {
+				<-sem
+			}
+		})
+	}, nil
+}
+
+// BudgetTransport is an http.RoundTripper that waits for a slot in Budget
+// (DefaultBudget if nil) before passing each request to Base
+// (http.DefaultTransport if nil).
+type BudgetTransport struct {
+	Base   http.RoundTripper
+	Budget *Budget
+}
+
+// RoundTrip sends req once a slot is free. The slot is released when the
+// response body is closed or fully read, or straight away if the request fails.
+// The body is read no faster than --max-bandwidth allows.
+func (t *BudgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.Budget
+	if b == nil {
+		b = DefaultBudget
+	}
+	release, err := b.acquire(req)
+	if err != nil {
+		return nil, err
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	body := resp.Body
+	if bandwidth != nil {
+		body = throttledBody{Reader: throttle(req.Context(), body, []*Limiter{bandwidth}), Closer: body}
+	}
+	resp.Body = &releasingBody{ReadCloser: body, release: release}
+	return resp, nil
+}
+
+// releasingBody gives back a request's budget slots once its body is done with.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releasingBody) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.release()
+	}
+	return n, err
+}
+
+func (r *releasingBody) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
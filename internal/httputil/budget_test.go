@@ -0,0 +1,104 @@
+package httputil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrencyServer counts how many requests it is serving at once.
+func concurrencyServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var cur, peak int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&cur, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&cur, -1)
+		io.WriteString(w, "data")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &peak
+}
+
+func TestBudgetTransport_Limits(t *testing.T) {
+	tests := []struct {
+		name           string
+		total, perHost int
+		want           int32
+	}{
+		{"per host", 0, 2, 2},
+		{"total", 3, 0, 3},
+		{"tighter of both", 1, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, peak := concurrencyServer(t)
+			client := &http.Client{Transport: &BudgetTransport{Budget: NewBudget(tt.total, tt.perHost)}}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					resp, err := client.Get(srv.URL)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}()
+			}
+			wg.Wait()
+			if got := atomic.LoadInt32(peak); got > tt.want {
+				t.Errorf("peak concurrency = %d, want at most %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBudgetTransport_ReleaseAndCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "data")
+	}))
+	defer srv.Close()
+	b := NewBudget(1, 0)
+	client := &http.Client{Transport: &BudgetTransport{Budget: b}}
+
+	// An open body holds the only slot...
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("second request succeeded while the budget was exhausted")
+	}
+
+	// ...until it is read to the end; closing afterwards must not release twice
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("request %d after release: %v", i, err)
+		}
+		resp.Body.Close()
+	}
+	if n := len(b.total); n != 0 {
+		t.Errorf("%d slots still held, want 0", n)
+	}
+}
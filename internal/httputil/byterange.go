@@ -0,0 +1,54 @@
+package httputil
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ParseRange parses a span "FIRST-LAST" or "FIRST-" (open-ended, returned as
+// last = -1), with both ends inclusive, as in an HTTP Range header. It is also
+// used for line slices, whose numbering starts at 1 rather than 0: min is the
+// smallest allowed FIRST.
+func ParseRange(spec string, min int64) (first, last int64, err error) {
+	a, b, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range %q (want FIRST-LAST or FIRST-)", spec)
+	}
+	first, err = strconv.ParseInt(strings.TrimSpace(a), 10, 64)
+	if err != nil || first < min {
+		return 0, 0, fmt.Errorf("invalid range %q: start must be a number >= %d", spec, min)
+	}
+	if b = strings.TrimSpace(b); b == "" {
+		return first, -1, nil
+	}
+	last, err = strconv.ParseInt(b, 10, 64)
+	if err != nil || last < first {
+		return 0, 0, fmt.Errorf("invalid range %q: end must be a number >= the start", spec)
+	}
+	return first, last, nil
+}
+
+// RangeBody returns the part of resp's body covering bytes first..last (last
+// -1 for the rest), for a request that asked for that range.
+//
+// A 206 Partial Content response already is that part. Servers that don't do
+// ranges answer 200 with the whole body instead; that is cut down here, so the
+// result is the same either way, just slower.
+func RangeBody(resp *http.Response, first, last int64) (io.Reader, error) {
+	if resp.StatusCode == http.StatusPartialContent {
+		return resp.Body, nil
+	}
+	if _, err := io.CopyN(io.Discard, resp.Body, first); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("range starts at byte %d, past the end of the data", first)
+		}
+		return nil, err
+	}
+	if last < 0 {
+		return resp.Body, nil
+	}
+	return io.LimitReader(resp.Body, last-first+1), nil
+}
@@ -0,0 +1,55 @@
+package httputil
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		spec        string
+		min         int64
+		first, last int64
+		ok          bool
+	}{
+		{"0-1048575", 0, 0, 1048575, true},
+		{"100-", 0, 100, -1, true},
+		{" 5 - 5 ", 0, 5, 5, true},
+		{"1-10", 1, 1, 10, true},
+		{"0-10", 1, 0, 0, false}, // lines start at 1
+		{"10-5", 0, 0, 0, false},
+		{"-100", 0, 0, 0, false}, // suffix ranges aren't supported
+		{"abc", 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		first, last, err := ParseRange(tt.spec, tt.min)
+		if (err == nil) != tt.ok || err == nil && (first != tt.first || last != tt.last) {
+			t.Errorf("ParseRange(%q, %d) = %d, %d, %v", tt.spec, tt.min, first, last, err)
+		}
+	}
+}
+
+func TestRangeBody(t *testing.T) {
+	read := func(code int, body string, first, last int64) string {
+		r, err := RangeBody(&http.Response{StatusCode: code, Body: io.NopCloser(strings.NewReader(body))}, first, last)
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		b, _ := io.ReadAll(r)
+		return string(b)
+	}
+	if got := read(206, "cde", 2, 4); got != "cde" {
+		t.Errorf("206: got %q", got)
+	}
+	if got := read(200, "abcdefg", 2, 4); got != "cde" {
+		t.Errorf("200 sliced locally: got %q", got)
+	}
+	if got := read(200, "abcdefg", 5, -1); got != "fg" {
+		t.Errorf("200 open-ended: got %q", got)
+	}
+	if got := read(200, "abc", 10, 20); !strings.HasPrefix(got, "error: ") {
+		t.Errorf("start past the end: got %q", got)
+	}
+}
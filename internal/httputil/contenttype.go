@@ -0,0 +1,35 @@
+package httputil
+
+import (
+	"mime"
+	"strings"
+)
+
+// MatchContentType reports whether a Content-Type header satisfies expected.
+//
+// expected is a comma-separated list of media types; "type/*" matches any
+// subtype, and "*/*" anything. Parameters (charset, boundary, ...) on either
+// side are ignored and comparison is case-insensitive, since servers disagree
+// wildly on how to spell "text/csv; charset=UTF-8". A missing or unparsable
+// header never matches.
+func MatchContentType(header, expected string) bool {
+	got, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return false
+	}
+	for _, want := range strings.Split(expected, ",") {
+		want = strings.ToLower(strings.TrimSpace(want))
+		if i := strings.IndexByte(want, ';'); i >= 0 {
+			want = strings.TrimSpace(want[:i])
+		}
+		switch {
+		case want == "":
+			continue
+		case want == "*/*" || want == got:
+			return true
+		case strings.HasSuffix(want, "/*") && strings.HasPrefix(got, strings.TrimSuffix(want, "*")):
+			return true
+		}
+	}
+	return false
+}
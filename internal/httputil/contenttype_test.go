@@ -0,0 +1,26 @@
+package httputil
+
+import "testing"
+
+func TestMatchContentType(t *testing.T) {
+	tests := []struct {
+		header, expected string
+		want             bool
+	}{
+		{"text/csv", "text/csv", true},
+		{"text/csv; charset=UTF-8", "text/csv", true},
+		{"TEXT/CSV", "text/csv", true},
+		{"application/gzip", "text/csv, application/gzip", true},
+		{"text/plain", "text/*", true},
+		{"application/octet-stream", "*/*", true},
+		{"text/html; charset=utf-8", "text/csv", false},
+		{"text/html", "application/*", false},
+		{"", "text/csv", false},
+		{"not a type", "text/csv", false},
+	}
+	for _, tt := range tests {
+		if got := MatchContentType(tt.header, tt.expected); got != tt.want {
+			t.Errorf("MatchContentType(%q, %q) = %v, want %v", tt.header, tt.expected, got, tt.want)
+		}
+	}
+}
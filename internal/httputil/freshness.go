@@ -0,0 +1,71 @@
+package httputil
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// CacheInfo extracts the caching metadata from a response header.
+//
+// The freshness computation follows RFC 9111 for a private cache, simplified to
+// what a CLI needs:
+//   - "no-store" and "no-cache" mean never fresh
+//   - max-age=N gives a lifetime of N seconds, otherwise Expires minus Date
+//   - the Age header is subtracted, since a proxy may have held the response already
+//
+// now is the time the response was received.
+func CacheInfo(h http.Header, now time.Time) registry.CacheInfo {
+	info := registry.CacheInfo{
+		CacheControl: h.Get("Cache-Control"),
+		Expires:      h.Get("Expires"),
+		Age:          h.Get("Age"),
+	}
+
+	lifetime, ok := freshnessLifetime(h, now)
+	if !ok {
+		return info
+	}
+	if age, err := strconv.Atoi(strings.TrimSpace(info.Age)); err == nil && age > 0 {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	if lifetime > 0 {
+		info.FreshUntil = now.Add(lifetime)
+	}
+	return info
+}
+
+// freshnessLifetime returns how long a response is fresh for, and false if it
+// must always be revalidated or carries no freshness information.
+func freshnessLifetime(h http.Header, now time.Time) (time.Duration, bool) {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.ToLower(strings.TrimSpace(directive)), "=")
+		switch name {
+		case "no-store", "no-cache":
+			return 0, false
+		case "max-age":
+			secs, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || secs <= 0 {
+				return 0, false
+			}
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+
+	exp := h.Get("Expires")
+	if exp == "" {
+		return 0, false
+	}
+	expires, err := http.ParseTime(exp)
+	if err != nil {
+		return 0, false // invalid Expires (often "0" or "-1") means already expired
+	}
+	date := now
+	if d, err := http.ParseTime(h.Get("Date")); err == nil {
+		date = d
+	}
+	return expires.Sub(date), true
+}
@@ -0,0 +1,44 @@
+package httputil
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCacheInfo(t *testing.T) {
+	now := time.Date(2025, 10, 24, 12, 0, 0, 0, time.UTC)
+	header := func(kv ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i+1 < len(kv); i += 2 {
+			h.Set(kv[i], kv[i+1])
+		}
+		return h
+	}
+
+	tests := []struct {
+		name string
+		h    http.Header
+		want time.Time // zero = not fresh
+	}{
+		{"max-age", header("Cache-Control", "public, max-age=3600"), now.Add(time.Hour)},
+		{"max-age minus Age", header("Cache-Control", "max-age=3600", "Age", "600"), now.Add(50 * time.Minute)},
+		{"max-age beats Expires", header("Cache-Control", "max-age=60", "Expires", "Fri, 24 Oct 2025 14:00:00 GMT"), now.Add(time.Minute)},
+		{"Expires relative to Date", header("Date", "Fri, 24 Oct 2025 11:00:00 GMT", "Expires", "Fri, 24 Oct 2025 13:00:00 GMT"), now.Add(2 * time.Hour)},
+		{"no-cache", header("Cache-Control", "no-cache, max-age=3600"), time.Time{}},
+		{"invalid Expires", header("Expires", "0"), time.Time{}},
+		{"Age exceeds max-age", header("Cache-Control", "max-age=60", "Age", "120"), time.Time{}},
+		{"no headers", header(), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CacheInfo(tt.h, now)
+			if !got.FreshUntil.Equal(tt.want) {
+				t.Errorf("FreshUntil = %v, want %v", got.FreshUntil, tt.want)
+			}
+			if got.CacheControl != tt.h.Get("Cache-Control") {
+				t.Errorf("CacheControl = %q, want raw header", got.CacheControl)
+			}
+		})
+	}
+}
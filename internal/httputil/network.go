@@ -0,0 +1,131 @@
+package httputil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// networkKey identifies a combination of network settings. Sources with the
+// same settings share a transport, and with it their pooled connections.
+type networkKey struct {
+	proxy, caFile, clientCert, clientKey string
+	insecure                             bool
+}
+
+func networkKeyOf(src registry.Source) networkKey {
+	return networkKey{src.Proxy, src.CAFile, src.ClientCert, src.ClientKey, src.InsecureSkipVerify}
+}
+
+// transports caches the transports built by NetworkTransport.
+var transports sync.Map // networkKey -> http.RoundTripper
+
+// HasNetworkSettings reports whether src sets a proxy or TLS options.
+func HasNetworkSettings(src registry.Source) bool {
+	return networkKeyOf(src) != networkKey{}
+}
+
+// ValidateNetwork checks src's proxy and TLS settings without reading any
+// files: those are loaded on first use, where they're needed.
+func ValidateNetwork(src registry.Source) error {
+	if !HasNetworkSettings(src) {
+		return nil
+	}
+	if src.Type != "http" && src.Type != "git" {
+		return errors.New("proxy, ca_file, client_cert, client_key, insecure_skip_verify: only supported by http and git sources")
+	}
+	if src.Proxy != "" && src.Proxy != "direct" {
+		u, err := url.Parse(src.Proxy)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return fmt.Errorf("proxy: %q isn't an http://, https:// or socks5:// URL, or \"direct\"", src.Proxy)
+		}
+		if _, ok := u.User.Password(); ok {
+			return errors.New("proxy: don't put a password in the config; set HTTPS_PROXY in the environment for proxies that need one")
+		}
+	}
+	if (src.ClientCert == "") != (src.ClientKey == "") {
+		return errors.New("client_cert and client_key: set both or neither")
+	}
+	return nil
+}
+
+// NetworkTransport returns the transport for src's proxy and TLS settings,
+// or nil if it has none, so the caller's default can be used. If the
+// settings can't be applied (an unreadable CA file, say), every request
+// through the transport fails with the reason.
+func NetworkTransport(src registry.Source) http.RoundTripper {
+	if !HasNetworkSettings(src) {
+		return nil
+	}
+	key := networkKeyOf(src)
+	if t, ok := transports.Load(key); ok {
+		return t.(http.RoundTripper)
+	}
+	var rt http.RoundTripper
+	if t, err := newNetworkTransport(key); err != nil {
+		rt = failingTransport{err}
+	} else {
+		rt = t
+	}
+	t, _ := transports.LoadOrStore(key, rt)
+	return t.(http.RoundTripper)
+}
+
+// newNetworkTransport builds a transport like http.DefaultTransport with
+// key's settings.
+func newNetworkTransport(key networkKey) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	switch key.proxy {
+	case "":
+	case "direct":
+		t.Proxy = nil
+	default:
+		u, err := url.Parse(key.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %w", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: key.insecure}
+	if key.caFile != "" {
+		pem, err := os.ReadFile(key.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool() // No system pool on this platform: just the file's
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file: no PEM certificates in %s", key.caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if key.clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(key.clientCert, key.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("client_cert: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	t.TLSClientConfig = cfg
+	return t, nil
+}
+
+// failingTransport fails every request with err.
+type failingTransport struct{ err error }
+
+func (t failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, t.err
+}
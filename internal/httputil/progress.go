@@ -0,0 +1,33 @@
+package httputil
+
+import (
+	"io"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// ProgressReader returns a reader that passes r through, reporting the bytes
+// read so far to p. total is the expected size, or -1 if unknown (as in
+// http.Response.ContentLength). A nil p returns r itself.
+func ProgressReader(r io.Reader, p registry.Progress, total int64) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{r: r, p: p, total: total}
+}
+
+type progressReader struct {
+	r     io.Reader
+	p     registry.Progress
+	done  int64
+	total int64
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	if n > 0 {
+		pr.done += int64(n)
+		pr.p.Bytes(pr.done, pr.total)
+	}
+	return n, err
+}
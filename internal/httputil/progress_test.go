@@ -0,0 +1,45 @@
+package httputil
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+type recordProgress struct{ done, total []int64 }
+
+func (r *recordProgress) Bytes(done, total int64) {
+	r.done = append(r.done, done)
+	r.total = append(r.total, total)
+}
+func (r *recordProgress) Status(string) {}
+
+func TestProgressReader(t *testing.T) {
+	src := strings.NewReader("hello")
+	if ProgressReader(src, nil, 5) != io.Reader(src) {
+		t.Error("nil progress should return the reader unchanged")
+	}
+
+	p := &recordProgress{}
+	r := ProgressReader(io.LimitReader(strings.NewReader("hello world"), 11), p, 11)
+	buf := make([]byte, 4)
+	var got []byte
+	for {
+		n, err := r.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+	}
+	if string(got) != "hello world" {
+		t.Errorf("read %q", got)
+	}
+	if last := p.done[len(p.done)-1]; last != 11 || p.total[0] != 11 {
+		t.Errorf("last report %d of %d, want 11 of 11", last, p.total[0])
+	}
+	for i := 1; i < len(p.done); i++ {
+		if p.done[i] <= p.done[i-1] {
+			t.Errorf("reports not increasing: %v", p.done)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// rangeBlockSize is how much RangeReader asks for per request, and
+// maxRangeBlocks how many blocks it keeps. Readers like archive/zip make many
+// small reads close together, so fetching whole blocks turns them into a
+// handful of requests, while the cap keeps memory bounded for big members.
+const (
+	rangeBlockSize = 1 << 20
+	maxRangeBlocks = 4
+)
+
+// ErrRangesUnsupported is returned by NewRangeReader when the server ignores
+// Range headers, so the caller can fall back to a full download.
+var ErrRangesUnsupported = errors.New("server does not support range requests")
+
+// RangeReader is an io.ReaderAt over a remote file, reading it with HTTP range
+// requests. It lets a client that only needs a small part of a large file -
+// one member of a zip archive, say - fetch just that part.
+//
+// Go learning note: archive/zip only needs an io.ReaderAt and the total size,
+// not a file, which is what makes this possible at all: zip.NewReader(r, r.Size())
+// reads the central directory from the end of the archive and then only the
+// bytes of the members that are opened.
+type RangeReader struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	size   int64
+
+	blocks   map[int64][]byte // Block index -> content
+	order    []int64          // Cached block indexes, oldest first
+	Requests int              // Range requests made so far
+}
+
+// NewRangeReader probes url with a one-byte range request to learn its size.
+// It fails with ErrRangesUnsupported if the server answers with the whole
+// file instead of a 206 Partial Content.
+func NewRangeReader(ctx context.Context, client *http.Client, url string) (*RangeReader, error) {
+	r := &RangeReader{ctx: ctx, client: client, url: url, blocks: map[int64][]byte{}}
+	resp, err := r.get(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	total := ""
+	if cr := resp.Header.Get("Content-Range"); resp.StatusCode == http.StatusPartialContent {
+		_, total, _ = strings.Cut(cr, "/")
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil || size < 0 {
+		return nil, ErrRangesUnsupported
+	}
+	r.size = size
+	return r, nil
+}
+
+// Size returns the remote file's size in bytes.
+func (r *RangeReader) Size() int64 { return r.size }
+
+// ReadAt implements io.ReaderAt.
+func (r *RangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.size {
+			return n, io.EOF
+		}
+		block, err := r.block(pos / rangeBlockSize)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], block[pos%rangeBlockSize:])
+	}
+	return n, nil
+}
+
+// block returns block i, from the cache or the server.
+func (r *RangeReader) block(i int64) ([]byte, error) {
+	if b, ok := r.blocks[i]; ok {
+		return b, nil
+	}
+	first := i * rangeBlockSize
+	last := min(first+rangeBlockSize, r.size) - 1
+	resp, err := r.get(first, last)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("http GET %s: range %d-%d: got %s", r.url, first, last, resp.Status)
+	}
+	b := make([]byte, last-first+1)
+	if _, err := io.ReadFull(resp.Body, b); err != nil {
+		return nil, fmt.Errorf("http GET %s: range %d-%d: %w", r.url, first, last, err)
+	}
+
+	if len(r.order) >= maxRangeBlocks {
+		delete(r.blocks, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.blocks[i] = b
+	r.order = append(r.order, i)
+	return b, nil
+}
+
+// get requests bytes first-last (inclusive) of the file.
+func (r *RangeReader) get(first, last int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", first, last))
+	r.Requests++
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, NewStatusError(http.MethodGet, r.url, resp)
+	}
+	return resp, nil
+}
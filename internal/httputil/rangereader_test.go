@@ -0,0 +1,66 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRangeReader(t *testing.T) {
+	content := make([]byte, 3*rangeBlockSize+123)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "big.bin", time.Time{}, bytes.NewReader(content)) // Honors Range
+	}))
+	defer server.Close()
+
+	r, err := NewRangeReader(context.Background(), server.Client(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(content)) {
+		t.Errorf("Size() = %d, want %d", r.Size(), len(content))
+	}
+
+	// A read spanning a block boundary
+	p := make([]byte, 100)
+	off := int64(rangeBlockSize - 50)
+	if n, err := r.ReadAt(p, off); n != 100 || err != nil || !bytes.Equal(p, content[off:off+100]) {
+		t.Errorf("ReadAt across blocks = %d, %v", n, err)
+	}
+	requests := r.Requests
+	if _, err := r.ReadAt(p, off+10); err != nil || r.Requests != requests {
+		t.Errorf("cached read made %d more requests (err %v)", r.Requests-requests, err)
+	}
+
+	// Reading past the end
+	tail := make([]byte, 200)
+	n, err := r.ReadAt(tail, int64(len(content)-100))
+	if n != 100 || err != io.EOF || !bytes.Equal(tail[:n], content[len(content)-100:]) {
+		t.Errorf("ReadAt at the end = %d, %v; want 100, EOF", n, err)
+	}
+}
+
+func TestRangeReader_Unsupported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("the whole thing, always"))
+	}))
+	defer server.Close()
+	if _, err := NewRangeReader(context.Background(), server.Client(), server.URL); !errors.Is(err, ErrRangesUnsupported) {
+		t.Errorf("err = %v, want ErrRangesUnsupported", err)
+	}
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	var se *StatusError
+	if _, err := NewRangeReader(context.Background(), missing.Client(), missing.URL); !errors.As(err, &se) || se.Code != 404 {
+		t.Errorf("err = %v, want a 404 StatusError", err)
+	}
+}
@@ -0,0 +1,262 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// byteUnits maps size suffixes to their multipliers. Both SI (KB = 1000) and
+// IEC (KiB = 1024) spellings are accepted since people use them interchangeably.
+var byteUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+	"TIB": 1 << 40,
+}
+
+// ParseByteSize parses sizes like "500MB", "10GiB", or "1048576".
+func ParseByteSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	i := strings.IndexFunc(t, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	num, unit := t, ""
+	if i >= 0 {
+		num, unit = t[:i], strings.TrimSpace(t[i:])
+	}
+	mult, ok := byteUnits[unit]
+	v, err := strconv.ParseFloat(num, 64)
+	if !ok || err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(math.Round(v * mult)), nil
+}
+
+// ParseBandwidth parses a transfer rate such as "2MB/s" or "512KiB" (per
+// second either way) into bytes per second.
+func ParseBandwidth(s string) (float64, error) {
+	n, err := ParseByteSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q (e.g. \"2MB/s\", \"512KiB/s\")", s)
+	}
+	return float64(n), nil
+}
+
+// ParseRequestRate parses a request rate such as "5/s", "30/min" or "1000/h"
+// into requests per second.
+func ParseRequestRate(s string) (float64, error) {
+	num, per, _ := strings.Cut(strings.TrimSpace(s), "/")
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	secs, ok := map[string]float64{"s": 1, "sec": 1, "min": 60, "m": 60, "h": 3600, "hour": 3600}[strings.TrimSpace(per)]
+	if err != nil || !ok || n <= 0 {
+		return 0, fmt.Errorf("invalid request rate %q (e.g. \"5/s\", \"30/min\", \"1000/h\")", s)
+	}
+	return n / secs, nil
+}
+
+// ValidateRateLimit checks a source's rate_limit settings.
+func ValidateRateLimit(rl *registry.RateLimit) error {
+	if rl.Requests == "" && rl.Bandwidth == "" {
+		return fmt.Errorf("rate_limit: set requests, bandwidth or both")
+	}
+	if rl.Requests != "" {
+		if _, err := ParseRequestRate(rl.Requests); err != nil {
+			return fmt.Errorf("rate_limit.requests: %w", err)
+		}
+	}
+	if rl.Bandwidth != "" {
+		if _, err := ParseBandwidth(rl.Bandwidth); err != nil {
+			return fmt.Errorf("rate_limit.bandwidth: %w", err)
+		}
+	}
+	return nil
+}
+
+// Limiter is a token bucket: tokens (requests, or bytes) accrue at rate per
+// second up to burst, and Wait takes them out. A nil *Limiter never waits.
+//
+// Go learning note: rather than refilling on a ticker, the bucket works out
+// how much it has gained since it was last touched, so an idle limiter costs
+// nothing. Taking more than is there leaves it in debt, which the next
+// caller waits out: a 1 MiB read against a 100 KiB/s limit simply makes the
+// following reads wait ten seconds.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens per second
+	burst  float64 // Most tokens the bucket holds
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a full bucket of burst tokens refilling at rate per second.
+func NewLimiter(rate, burst float64) *Limiter {
+	return &Limiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait takes n tokens, sleeping until the bucket has paid for them or ctx
+// is cancelled.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// bandwidth caps all of datum's downloads together (--max-bandwidth), or is
+// nil for no cap. Set once at startup via SetMaxBandwidth.
+var bandwidth *Limiter
+
+// SetMaxBandwidth caps the combined download rate of every handler at
+// bytesPerSec; zero or less removes the cap. HTTP responses that go through
+// BudgetTransport are throttled automatically; handlers with their own
+// connections (sftp, ftp) pass their readers through Throttle.
+func SetMaxBandwidth(bytesPerSec float64) {
+	bandwidth = nil
+	if bytesPerSec > 0 {
+		bandwidth = NewLimiter(bytesPerSec, bytesPerSec)
+	}
+}
+
+// sourceLimits are the limiters of one host's rate_limit setting, created on
+// first use and shared by every source naming the same host and limits, so
+// two datasets on one API still add up to the rate it allows.
+var (
+	sourceLimitsMu sync.Mutex
+	sourceLimits   = map[string][2]*Limiter{}
+)
+
+// SourceLimiters returns the request and bandwidth limiters for a source
+// with rate_limit rl on host, either nil when not limited. readConfig has
+// validated rl.
+func SourceLimiters(host string, rl *registry.RateLimit) (requests, download *Limiter) {
+	if rl == nil {
+		return nil, nil
+	}
+	key := host + "\x00" + rl.Requests + "\x00" + rl.Bandwidth
+	sourceLimitsMu.Lock()
+	defer sourceLimitsMu.Unlock()
+	lims, ok := sourceLimits[key]
+	if !ok {
+		if rate, err := ParseRequestRate(rl.Requests); err == nil {
+			lims[0] = NewLimiter(rate, 1)
+		}
+		if rate, err := ParseBandwidth(rl.Bandwidth); err == nil {
+			lims[1] = NewLimiter(rate, rate)
+		}
+		sourceLimits[key] = lims
+	}
+	return lims[0], lims[1]
+}
+
+// Throttle returns a reader that passes r through no faster than
+// --max-bandwidth and any of limiters allow. Without limits it returns r.
+func Throttle(ctx context.Context, r io.Reader, limiters ...*Limiter) io.Reader {
+	return throttle(ctx, r, append(limiters, bandwidth))
+}
+
+// throttle is Throttle with only the limiters given, nil ones ignored.
+func throttle(ctx context.Context, r io.Reader, limiters []*Limiter) io.Reader {
+	var active []*Limiter
+	for _, l := range limiters {
+		if l != nil {
+			active = append(active, l)
+		}
+	}
+	if len(active) == 0 {
+		return r
+	}
+	return &throttledReader{r: r, ctx: ctx, limiters: active}
+}
+
+type throttledReader struct {
+	r        io.Reader
+	ctx      context.Context
+	limiters []*Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	for _, l := range t.limiters {
+		if werr := l.Wait(t.ctx, n); werr != nil && err == nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// RateTransport is an http.RoundTripper that keeps a source within its
+// rate_limit: each request (HEADs and GETs alike) waits its turn, and the
+// response body is read no faster than the bandwidth allows. Waiting happens
+// before Base is called, so a throttled source holds no connection slot
+// while it waits.
+type RateTransport struct {
+	Base      http.RoundTripper
+	RateLimit *registry.RateLimit
+}
+
+// NewRateTransport returns a RateTransport for src's rate_limit, or nil if it
+// has none (so base can be used as it is).
+func NewRateTransport(base http.RoundTripper, src registry.Source) *RateTransport {
+	if src.RateLimit == nil {
+		return nil
+	}
+	return &RateTransport{Base: base, RateLimit: src.RateLimit}
+}
+
+// RoundTrip sends req once the source's request rate allows it.
+func (t *RateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requests, bw := SourceLimiters(req.URL.Host, t.RateLimit)
+	if err := requests.Wait(req.Context(), 1); err != nil {
+		return nil, err
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil || bw == nil {
+		return resp, err
+	}
+	// --max-bandwidth is BudgetTransport's to apply
+	resp.Body = throttledBody{Reader: throttle(req.Context(), resp.Body, []*Limiter{bw}), Closer: resp.Body}
+	return resp, nil
+}
+
+// throttledBody is a response body read through Throttle.
+type throttledBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,149 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"1048576", 1048576, false},
+		{"500MB", 500_000_000, false},
+		{"10GiB", 10 << 30, false},
+		{"1.5 KiB", 1536, false},
+		{"2kb", 2000, false},
+		{"10 parsecs", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseByteSize(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseByteSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseByteSize(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRates(t *testing.T) {
+	rates := map[string]float64{"5/s": 5, "30/min": 0.5, "3600/h": 1}
+	for in, want := range rates {
+		if got, err := ParseRequestRate(in); err != nil || got != want {
+			t.Errorf("ParseRequestRate(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "5", "0/s", "5/fortnight"} {
+		if _, err := ParseRequestRate(in); err == nil {
+			t.Errorf("ParseRequestRate(%q) succeeded", in)
+		}
+	}
+
+	bandwidths := map[string]float64{"2MB/s": 2e6, "512KiB": 512 << 10}
+	for in, want := range bandwidths {
+		if got, err := ParseBandwidth(in); err != nil || got != want {
+			t.Errorf("ParseBandwidth(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "0/s", "fast"} {
+		if _, err := ParseBandwidth(in); err == nil {
+			t.Errorf("ParseBandwidth(%q) succeeded", in)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(20, 1) // One every 50ms
+	start := time.Now()
+	for range 4 {
+		if err := l.Wait(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 140*time.Millisecond {
+		t.Errorf("4 waits at 20/s took %s, want about 150ms", d)
+	}
+
+	// Cancelling stops the wait
+	l = NewLimiter(1, 1)
+	l.Wait(context.Background(), 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, 1); err == nil {
+		t.Error("Wait() past the deadline succeeded")
+	}
+
+	var none *Limiter
+	if err := none.Wait(context.Background(), 1<<30); err != nil {
+		t.Errorf("nil Limiter: %v", err)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 3000)
+	l := NewLimiter(20000, 1000) // 1000 bytes free, then 20 KB/s
+	start := time.Now()
+	got, err := io.ReadAll(Throttle(context.Background(), bytes.NewReader(data), l))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("ReadAll() = %d bytes, %v", len(got), err)
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("3000 bytes at 20 KB/s took %s, want about 100ms", d)
+	}
+
+	r := bytes.NewReader(data)
+	if Throttle(context.Background(), r) != io.Reader(r) {
+		t.Error("Throttle() without limits wrapped the reader")
+	}
+}
+
+func TestRateTransport(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		io.WriteString(w, "data")
+	}))
+	defer srv.Close()
+
+	src := registry.Source{URL: srv.URL, RateLimit: &registry.RateLimit{Requests: "20/s"}}
+	client := &http.Client{Transport: NewRateTransport(nil, src)}
+	start := time.Now()
+	for range 3 {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("3 requests at 20/s took %s, want about 100ms", d)
+	}
+	if requests != 3 {
+		t.Errorf("server saw %d requests, want 3", requests)
+	}
+
+	// Sources with the same host and limits share one bucket
+	a, _ := SourceLimiters("example.org", src.RateLimit)
+	b, _ := SourceLimiters("example.org", &registry.RateLimit{Requests: "20/s"})
+	if a != b {
+		t.Error("same host and limits got separate limiters")
+	}
+	if NewRateTransport(nil, registry.Source{URL: srv.URL}) != nil {
+		t.Error("NewRateTransport() without rate_limit returned a transport")
+	}
+}
@@ -0,0 +1,59 @@
+// Package httputil holds the HTTP helpers shared by the handlers that talk HTTP
+// (the http handler itself, and git over https).
+package httputil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// maxRedirects bounds how many hops PermanentLocation follows, matching net/http's default.
+const maxRedirects = 10
+
+// PermanentLocation reports where rawURL has permanently moved to.
+//
+// It follows redirects one hop at a time and keeps going only while each hop is
+// permanent (301 Moved Permanently or 308 Permanent Redirect). The first
+// temporary redirect (302, 303, 307) or non-redirect response ends the chain,
+// since a temporary hop says nothing about the canonical location - CDNs and
+// download mirrors use them all the time.
+//
+// Returns the last permanently-redirected URL, or "" if rawURL itself is canonical.
+// client is copied, not modified; method is usually HEAD, but servers that only
+// redirect GETs (like git smart-HTTP endpoints) need GET.
+func PermanentLocation(ctx context.Context, client *http.Client, method, rawURL string) (string, error) {
+	c := *client
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	current := rawURL
+	for hop := 0; hop < maxRedirects; hop++ {
+		req, err := http.NewRequestWithContext(ctx, method, current, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusMovedPermanently && resp.StatusCode != http.StatusPermanentRedirect {
+			break
+		}
+		loc, err := resp.Location()
+		if err != nil {
+			return "", err
+		}
+		current = loc.String()
+	}
+
+	if current == rawURL {
+		return "", nil
+	}
+	if _, err := url.Parse(current); err != nil {
+		return "", errors.New("invalid redirect location: " + current)
+	}
+	return current, nil
+}
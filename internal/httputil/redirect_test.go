@@ -0,0 +1,51 @@
+package httputil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPermanentLocation(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/canonical", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/older-hop", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/older-hop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/canonical", http.StatusPermanentRedirect)
+	})
+	mux.HandleFunc("/mirror", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/canonical", http.StatusFound)
+	})
+	mux.HandleFunc("/moved-then-mirror", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/mirror", http.StatusMovedPermanently)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		path, want string
+	}{
+		{"/canonical", ""},
+		{"/old", server.URL + "/canonical"},
+		{"/mirror", ""},
+		{"/moved-then-mirror", server.URL + "/mirror"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := PermanentLocation(context.Background(), http.DefaultClient, http.MethodHead, server.URL+tt.path)
+			if err != nil {
+				t.Fatalf("PermanentLocation() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("PermanentLocation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if http.DefaultClient.CheckRedirect != nil {
+		t.Error("PermanentLocation must not modify the caller's client")
+	}
+}
@@ -0,0 +1,352 @@
+package httputil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+// emptySHA256 is the hex SHA-256 of an empty body, the payload hash of GET and HEAD.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// ValidateSigning checks a source's signing settings without reading any secrets.
+func ValidateSigning(s *registry.Signing) error {
+	switch s.Scheme {
+	case "sigv4":
+		if s.Region == "" {
+			return errors.New("sign: sigv4 needs a region")
+		}
+	case "hmac":
+		if s.SecretKeyEnv == "" {
+			return errors.New("sign: hmac needs secret_key_env")
+		}
+	case "":
+		return errors.New("sign: missing scheme")
+	default:
+		return fmt.Errorf("sign: unknown scheme %q (want sigv4 or hmac)", s.Scheme)
+	}
+	return nil
+}
+
+// ValidateAuth checks a source's headers, bearer_token_env and basic_auth_env
+// without reading any secrets. A source uses at most one way of filling in the
+// Authorization header, and never a literal one from headers.
+func ValidateAuth(src registry.Source) error {
+	methods := 0
+	for _, set := range []bool{src.Sign != nil, src.BearerTokenEnv != "", src.BasicAuthEnv != ""} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		return errors.New("sign, bearer_token_env and basic_auth_env are mutually exclusive")
+	}
+	for name := range src.Headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("headers: invalid header name %q", name)
+		}
+		if strings.EqualFold(name, "Authorization") {
+			return errors.New("headers: don't put Authorization in the config; use bearer_token_env or basic_auth_env")
+		}
+	}
+	return nil
+}
+
+// Sign adds the headers required by s to req, as of now.
+//
+// It must be called last, after every other header is set, because SigV4
+// covers the request's headers. A nil s leaves req untouched. Secrets are
+// looked up through creds (nil for the plain environment); a missing one is
+// an error naming the environment variable to set.
+func Sign(req *http.Request, s *registry.Signing, creds *registry.Credentials, now time.Time) error {
+	if s == nil {
+		return nil
+	}
+	if err := ValidateSigning(s); err != nil {
+		return err
+	}
+	switch s.Scheme {
+	case "sigv4":
+		return signV4(req, s, creds, now.UTC())
+	default:
+		return signHMAC(req, s, creds, now.UTC())
+	}
+}
+
+// env reads the variable name (or def if name is empty), failing if it is unset.
+func env(creds *registry.Credentials, name, def string) (string, error) {
+	if name == "" {
+		name = def
+	}
+	v := creds.Getenv(name)
+	if v == "" {
+		return "", fmt.Errorf("sign: %s is not set", name)
+	}
+	return v, nil
+}
+
+// signHMAC implements the generic "hmac" scheme.
+func signHMAC(req *http.Request, s *registry.Signing, creds *registry.Credentials, now time.Time) error {
+	secret, err := env(creds, s.SecretKeyEnv, "")
+	if err != nil {
+		return err
+	}
+	date := now.Format(http.TimeFormat)
+	req.Header.Set("Date", date)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s", req.Method, req.URL.RequestURI(), date)
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	header := firstNonEmpty(s.Header, "Authorization")
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "HMAC "
+	}
+	if s.KeyID != "" {
+		sig = s.KeyID + ":" + sig
+	}
+	req.Header.Set(header, prefix+sig)
+	return nil
+}
+
+// signV4 implements AWS Signature Version 4.
+//
+// See https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html.
+// The payload hash covers the request's body, which is read through GetBody
+// so the request can still send it. S3 additionally requires the payload
+// hash as a header, so it is sent (and signed) only for service "s3".
+func signV4(req *http.Request, s *registry.Signing, creds *registry.Credentials, now time.Time) error {
+	accessKey, err := env(creds, s.AccessKeyEnv, "AWS_ACCESS_KEY_ID")
+	if err != nil {
+		return err
+	}
+	secretKey, err := env(creds, s.SecretKeyEnv, "AWS_SECRET_ACCESS_KEY")
+	if err != nil {
+		return err
+	}
+	tokenVar := firstNonEmpty(s.SessionTokenEnv, "AWS_SESSION_TOKEN")
+	token := creds.Getenv(tokenVar)
+	if s.SessionTokenEnv != "" && token == "" {
+		return fmt.Errorf("sign: %s is not set", tokenVar)
+	}
+	service := firstNonEmpty(s.Service, "s3")
+	payload, err := payloadHash(req)
+	if err != nil {
+		return err
+	}
+
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payload)
+	}
+	if token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	// Canonical headers: host, content-type and every x-amz-* header,
+	// lowercased and sorted
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if lk := strings.ToLower(k); lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payload,
+	}, "\n")
+
+	scope := day + "/" + s.Region + "/" + service + "/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signed, sig))
+	return nil
+}
+
+// payloadHash returns the hex SHA-256 of req's body without consuming it.
+func payloadHash(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return emptySHA256, nil
+	}
+	if req.GetBody == nil {
+		return "", errors.New("sign: can't sign a request body that can't be read twice")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", fmt.Errorf("sign: %w", err)
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", fmt.Errorf("sign: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// canonicalQuery encodes q sorted by key then value, with spaces as %20.
+func canonicalQuery(q url.Values) string {
+	type pair struct{ k, v string }
+	var pairs []pair
+	for k, vs := range q {
+		for _, v := range vs {
+			pairs = append(pairs, pair{awsEscape(k), awsEscape(v)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].k != pairs[j].k {
+			return pairs[i].k < pairs[j].k
+		}
+		return pairs[i].v < pairs[j].v
+	})
+	parts := make([]string, len(pairs))
+	for i, p := range pairs {
+		parts[i] = p.k + "=" + p.v
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything but RFC 3986 unreserved characters.
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+func firstNonEmpty(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
+
+// AuthTransport is an http.RoundTripper that authenticates the requests it
+// sends before passing them to Base (http.DefaultTransport if nil). Headers
+// are added first. Then requests are signed when Signing is set; otherwise
+// the source's own bearer token or basic auth is sent, or failing that the
+// credentials' bearer token, if any.
+//
+// Redirect hops are authenticated only while they stay on the host the
+// request was first sent to: the credentials are for that server, and one
+// redirecting elsewhere (to a CDN, or anywhere at all) mustn't hand them on.
+// Hops to other hosts go out as they are, which leaves net/http's own
+// stripping of Authorization on such redirects in effect.
+type AuthTransport struct {
+	Base           http.RoundTripper
+	Signing        *registry.Signing
+	Credentials    *registry.Credentials // Where secrets are looked up (nil: environment)
+	Headers        map[string]string     // Extra headers for every request
+	BearerTokenEnv string                // Variable holding a bearer token
+	BasicAuthEnv   string                // Variable holding "user:password"
+}
+
+// NewAuthTransport returns an AuthTransport for src's authentication settings,
+// or nil if src has none (so base can be used as it is).
+func NewAuthTransport(base http.RoundTripper, src registry.Source) *AuthTransport {
+	if src.Sign == nil && src.Credentials == nil && len(src.Headers) == 0 && src.BearerTokenEnv == "" && src.BasicAuthEnv == "" {
+		return nil
+	}
+	return &AuthTransport{
+		Base:           base,
+		Signing:        src.Sign,
+		Credentials:    src.Credentials,
+		Headers:        src.Headers,
+		BearerTokenEnv: src.BearerTokenEnv,
+		BasicAuthEnv:   src.BasicAuthEnv,
+	}
+}
+
+// RoundTrip authenticates a clone of req (RoundTrippers must not modify their input) and sends it.
+func (t *AuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !strings.EqualFold(req.URL.Host, originalRequest(req).URL.Host) {
+		return base.RoundTrip(req)
+	}
+	r := req.Clone(req.Context())
+	for name, value := range t.Headers {
+		r.Header.Set(name, value)
+	}
+	if t.Signing != nil {
+		if err := Sign(r, t.Signing, t.Credentials, time.Now()); err != nil {
+			return nil, err
+		}
+	} else if t.BearerTokenEnv != "" {
+		token := t.Credentials.Getenv(t.BearerTokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("bearer_token_env: %s is not set", t.BearerTokenEnv)
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+	} else if t.BasicAuthEnv != "" {
+		pair := t.Credentials.Getenv(t.BasicAuthEnv)
+		if pair == "" {
+			return nil, fmt.Errorf("basic_auth_env: %s is not set", t.BasicAuthEnv)
+		}
+		user, pass, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("basic_auth_env: %s must hold \"user:password\"", t.BasicAuthEnv)
+		}
+		r.SetBasicAuth(user, pass)
+	} else if token := t.Credentials.Token(); token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	} else if t.Credentials != nil && t.Credentials.TokenEnv != "" {
+		return nil, fmt.Errorf("auth profile %s: %s is not set", t.Credentials.Profile, t.Credentials.TokenEnv)
+	}
+	return base.RoundTrip(r)
+}
+
+// originalRequest follows a redirect hop back to the request the client
+// was first asked to send: net/http sets Response on each hop to the
+// redirect that led to it.
+func originalRequest(req *http.Request) *http.Request {
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
+	}
+	return req
+}
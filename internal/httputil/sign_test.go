@@ -0,0 +1,200 @@
+package httputil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jprybylski/datum/internal/registry"
+)
+
+func TestSignV4(t *testing.T) {
+	// "get-vanilla" from the AWS SigV4 test suite
+	t.Setenv("TEST_AK", "AKIDEXAMPLE")
+	t.Setenv("TEST_SK", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	s := &registry.Signing{Scheme: "sigv4", Region: "us-east-1", Service: "service", AccessKeyEnv: "TEST_AK", SecretKeyEnv: "TEST_SK"}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	if err := Sign(req, s, nil, now); err != nil {
+		t.Fatal(err)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q\nwant %q", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %q", got)
+	}
+}
+
+func TestSignV4Body(t *testing.T) {
+	// "post-x-www-form-urlencoded" from the AWS SigV4 test suite
+	t.Setenv("TEST_AK", "AKIDEXAMPLE")
+	t.Setenv("TEST_SK", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	s := &registry.Signing{Scheme: "sigv4", Region: "us-east-1", Service: "service", AccessKeyEnv: "TEST_AK", SecretKeyEnv: "TEST_SK"}
+	req, _ := http.NewRequest(http.MethodPost, "https://example.amazonaws.com/", strings.NewReader("Param1=value1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	if err := Sign(req, s, nil, now); err != nil {
+		t.Fatal(err)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q\nwant %q", got, want)
+	}
+	// Hashing the body mustn't use it up
+	if body, _ := io.ReadAll(req.Body); string(body) != "Param1=value1" {
+		t.Errorf("body after signing = %q", body)
+	}
+
+	// A body that can't be read again can't be both hashed and sent
+	req, _ = http.NewRequest(http.MethodPost, "https://example.amazonaws.com/", io.NopCloser(strings.NewReader("x")))
+	if err := Sign(req, s, nil, now); err == nil {
+		t.Error("signing a one-shot body succeeded")
+	}
+}
+
+func TestSignV4S3(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AK")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SK")
+	t.Setenv("AWS_SESSION_TOKEN", "tok")
+	req, _ := http.NewRequest(http.MethodGet, "https://bucket.s3.example.com/a%20b.csv?versionId=3", nil)
+
+	if err := Sign(req, &registry.Signing{Scheme: "sigv4", Region: "eu-west-1"}, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("X-Amz-Content-Sha256"); got != emptySHA256 {
+		t.Errorf("X-Amz-Content-Sha256 = %q, want the empty-body hash", got)
+	}
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "tok" {
+		t.Errorf("X-Amz-Security-Token = %q, want tok", got)
+	}
+	auth := req.Header.Get("Authorization")
+	if !strings.Contains(auth, "/eu-west-1/s3/aws4_request") ||
+		!strings.Contains(auth, "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token,") {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
+
+func TestSignHMAC(t *testing.T) {
+	t.Setenv("TEST_HMAC", "secret")
+	s := &registry.Signing{Scheme: "hmac", SecretKeyEnv: "TEST_HMAC", KeyID: "ci", Header: "X-Signature"}
+	req, _ := http.NewRequest(http.MethodHead, "https://data.example.com/files/x.csv?v=2", nil)
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := Sign(req, s, nil, now); err != nil {
+		t.Fatal(err)
+	}
+	date := "Thu, 02 Jan 2025 03:04:05 GMT"
+	if got := req.Header.Get("Date"); got != date {
+		t.Errorf("Date = %q, want %q", got, date)
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("HEAD\n/files/x.csv?v=2\n" + date))
+	want := "HMAC ci:" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if got := req.Header.Get("X-Signature"); got != want {
+		t.Errorf("X-Signature = %q, want %q", got, want)
+	}
+}
+
+func TestSignErrors(t *testing.T) {
+	t.Setenv("UNSET_FOR_TEST", "")
+	tests := []struct {
+		name string
+		s    registry.Signing
+		want string
+	}{
+		{"no scheme", registry.Signing{}, "missing scheme"},
+		{"unknown scheme", registry.Signing{Scheme: "oauth"}, "unknown scheme"},
+		{"sigv4 without region", registry.Signing{Scheme: "sigv4"}, "needs a region"},
+		{"hmac without secret", registry.Signing{Scheme: "hmac"}, "secret_key_env"},
+		{"unset credentials", registry.Signing{Scheme: "hmac", SecretKeyEnv: "UNSET_FOR_TEST"}, "UNSET_FOR_TEST is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+			err := Sign(req, &tt.s, nil, time.Now())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Sign() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if err := Sign(req, nil, nil, time.Now()); err != nil || len(req.Header) != 0 {
+		t.Errorf("Sign(nil) = %v, headers %v; want no-op", err, req.Header)
+	}
+}
+
+func TestValidateAuth(t *testing.T) {
+	ok := []registry.Source{
+		{},
+		{Headers: map[string]string{"Accept": "text/csv"}, BearerTokenEnv: "TOKEN"},
+		{BasicAuthEnv: "CREDS"},
+		{Sign: &registry.Signing{Scheme: "hmac", SecretKeyEnv: "S"}, Headers: map[string]string{"X-Tenant": "a"}},
+	}
+	for _, src := range ok {
+		if err := ValidateAuth(src); err != nil {
+			t.Errorf("ValidateAuth(%+v) = %v", src, err)
+		}
+	}
+	bad := map[string]registry.Source{
+		"bearer and basic":  {BearerTokenEnv: "T", BasicAuthEnv: "B"},
+		"sign and bearer":   {Sign: &registry.Signing{Scheme: "hmac"}, BearerTokenEnv: "T"},
+		"literal secret":    {Headers: map[string]string{"authorization": "Bearer abc"}},
+		"invalid name":      {Headers: map[string]string{"X Bad": "1"}},
+		"empty header name": {Headers: map[string]string{"": "1"}},
+	}
+	for name, src := range bad {
+		if err := ValidateAuth(src); err == nil {
+			t.Errorf("%s: ValidateAuth succeeded", name)
+		}
+	}
+}
+
+func TestAuthTransportRedirects(t *testing.T) {
+	t.Setenv("TEST_TOKEN", "secret")
+	type seen struct{ auth, header string }
+	var other, own []seen
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		other = append(other, seen{r.Header.Get("Authorization"), r.Header.Get("X-Team")})
+	}))
+	defer elsewhere.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		own = append(own, seen{r.Header.Get("Authorization"), r.Header.Get("X-Team")})
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, "/moved", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, elsewhere.URL+"/file", http.StatusFound)
+		}
+	}))
+	defer origin.Close()
+
+	client := &http.Client{Transport: NewAuthTransport(nil, registry.Source{BearerTokenEnv: "TEST_TOKEN", Headers: map[string]string{"X-Team": "data"}})}
+	resp, err := client.Get(origin.URL + "/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	want := seen{"Bearer secret", "data"}
+	if len(own) != 2 || own[0] != want || own[1] != want {
+		t.Errorf("the origin saw %v, want the credentials on both requests", own)
+	}
+	if len(other) != 1 || other[0] != (seen{}) {
+		t.Errorf("the host redirected to saw %v, want no credentials or headers", other)
+	}
+}
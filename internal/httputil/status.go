@@ -0,0 +1,60 @@
+package httputil
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StatusError is an HTTP response with an error status (4xx or 5xx).
+//
+// Keeping the code rather than just a message lets callers tell a source that
+// is gone (404) from one that is having a bad moment (503), and retry only the
+// latter.
+type StatusError struct {
+	Method string
+	URL    string
+	Code   int
+	Status string // e.g. "404 Not Found"
+
+	// RetryAfter is the server's Retry-After hint, zero if it gave none
+	RetryAfter time.Duration
+}
+
+// NewStatusError describes resp, which was answered to a method request for rawURL.
+func NewStatusError(method, rawURL string, resp *http.Response) *StatusError {
+	return &StatusError{
+		Method:     method,
+		URL:        rawURL,
+		Code:       resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http %s %s: %s", e.Method, e.URL, e.Status)
+}
+
+// Temporary reports whether the request may succeed if repeated: server
+// errors (5xx), request timeouts (408) and rate limiting (429). Other client
+// errors, such as 404 or 403, won't change by asking again.
+func (e *StatusError) Temporary() bool {
+	return e.Code >= 500 || e.Code == http.StatusRequestTimeout || e.Code == http.StatusTooManyRequests
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds
+// or an HTTP date.
+func retryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,47 @@
+package httputil
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		code      int
+		temporary bool
+	}{
+		{404, false}, {403, false}, {410, false},
+		{408, true}, {429, true}, {500, true}, {502, true}, {503, true},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.code, Status: http.StatusText(tt.code), Header: http.Header{}}
+		if got := NewStatusError("GET", "https://x", resp).Temporary(); got != tt.temporary {
+			t.Errorf("Temporary() for %d = %v, want %v", tt.code, got, tt.temporary)
+		}
+	}
+
+	resp := &http.Response{StatusCode: 404, Status: "404 Not Found"}
+	if got, want := NewStatusError("GET", "https://x/a.csv", resp).Error(), "http GET https://x/a.csv: 404 Not Found"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"Wed, 01 Jan 2025 12:00:30 GMT", 30 * time.Second},
+		{"Wed, 01 Jan 2025 11:00:00 GMT", 0}, // already past
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.header, now); got != tt.want {
+			t.Errorf("retryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -10,7 +10,14 @@
 //   - The Fetcher interface provides polymorphism - any type implementing these methods can be a handler
 package registry
 
-import "context"
+import (
+	"context"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
 
 // Source represents the configuration for a data source.
 // It contains fields used by various handler types. Not all fields are used by all handlers.
@@ -18,14 +25,304 @@ import "context"
 // YAML tags control how this struct is serialized/deserialized from configuration files.
 // The `omitempty` tag means the field will be omitted from YAML if it's empty.
 type Source struct {
-	Type string `yaml:"type"`           // Handler type: "http", "file", "git", or "command"
-	URL  string `yaml:"url,omitempty"`  // URL for http and git handlers
-	Path string `yaml:"path,omitempty"` // File path for file and git handlers
-	Ref  string `yaml:"ref,omitempty"`  // Git ref (branch/tag) for git handler
+	Type string `yaml:"type"`           // Handler type: "http", "file", "git", "command", "sftp", "ftp", "huggingface", "doi", "sql", "torrent", "dvc" or "github-release"
+	URL  string `yaml:"url,omitempty"`  // URL for http, git, sftp and ftp handlers; repository for huggingface; the DOI for doi; database for sql; magnet link or .torrent URL for torrent; remote name or URL for dvc; owner/repo for github-release
+	Path string `yaml:"path,omitempty"` // File path for file handlers; path in the repository for git and huggingface; file in the deposit for doi; file in the torrent for torrent; the .dvc file for dvc; asset name for github-release
+	Ref  string `yaml:"ref,omitempty"`  // Branch, tag or commit for git and huggingface handlers; release tag or "latest" for github-release
 
 	// Command handler specific fields
-	FingerprintCmd string `yaml:"fingerprint_cmd,omitempty"` // Command to compute fingerprint
-	FetchCmd       string `yaml:"fetch_cmd,omitempty"`       // Command to fetch data
+	FingerprintCmd string   `yaml:"fingerprint_cmd,omitempty"` // Command to compute fingerprint
+	FetchCmd       string   `yaml:"fetch_cmd,omitempty"`       // Command to fetch data
+	FetchArgs      []string `yaml:"fetch_args,omitempty"`      // Instead of fetch_cmd: program and arguments, run without a shell
+	Shell          string   `yaml:"shell,omitempty"`           // Shell the commands run in: sh, bash, cmd or powershell (default sh; cmd on Windows)
+	CmdTimeout     string   `yaml:"cmd_timeout,omitempty"`     // Longest each command may run, e.g. "30s"
+	Workdir        string   `yaml:"workdir,omitempty"`         // Directory the commands run in, inside datum's own
+
+	// SQL handler specific fields
+	Query            string `yaml:"query,omitempty"`             // Read-only query whose result is pinned
+	FingerprintQuery string `yaml:"fingerprint_query,omitempty"` // Cheaper query whose result changes whenever Query's does
+	Format           string `yaml:"format,omitempty"`            // Result format: "csv" (default) or "json"
+
+	// Request fields for APIs that answer POSTs rather than GETs (http
+	// handler). Such a source is always fingerprinted by hashing the
+	// response, since a HEAD can't stand in for the request.
+	Method      string `yaml:"method,omitempty"`       // HTTP method: "GET" (default) or "POST"
+	Body        string `yaml:"body,omitempty"`         // Request body, e.g. a GraphQL query as JSON
+	ContentType string `yaml:"content_type,omitempty"` // Content-Type of body, e.g. "application/json"
+
+	// Expect lists properties the fetched data must have before it may replace the target
+	Expect Expect `yaml:"expect,omitempty"`
+
+	// Range pins only part of the source: bytes START-END (inclusive, as in
+	// HTTP) or START- for the rest. Used by the http handler; the fingerprint
+	// still covers the whole source.
+	Range string `yaml:"range,omitempty"`
+
+	// Member is the path of one file inside a remote zip archive. The http
+	// handler then reads just that member with range requests, and
+	// fingerprints it by its CRC-32 and size from the archive's directory.
+	Member string `yaml:"member,omitempty"`
+
+	// Mirrors are more URLs that serve exactly the same content as URL
+	// (http handler). Fingerprint and Fetch try URL first and fail over to
+	// the mirrors in order; see Mirrored.
+	Mirrors []string `yaml:"mirrors,omitempty"`
+
+	// Lines keeps only lines FIRST-LAST (1-based, inclusive; FIRST- for the
+	// rest) of the fetched data. Applied by the engine after any handler's Fetch.
+	Lines string `yaml:"lines,omitempty"`
+
+	// Decompress stores a compressed single-file source decompressed:
+	// "gzip", "bzip2", "xz" or "zstd". Applied by the engine after any
+	// handler's Fetch, before Extract and Lines.
+	Decompress string `yaml:"decompress,omitempty"`
+
+	// ArchivePath is the path of one file inside a zip or tar archive that
+	// the source serves. The whole archive is fetched and only that member
+	// written to the target. Applied by the engine after any handler's Fetch,
+	// after Decompress and before Extract and Lines.
+	ArchivePath string `yaml:"archive_path,omitempty"`
+
+	// Extract keeps only part of a JSON response (see Extract). Applied by the
+	// engine after any handler's Fetch, before Lines.
+	Extract *Extract `yaml:"extract,omitempty"`
+
+	// Canonicalize normalizes the content before it's hashed into a
+	// fingerprint, so volatile details don't count as changes (see
+	// Canonicalize). Used by the http and file handlers.
+	Canonicalize *Canonicalize `yaml:"canonicalize,omitempty"`
+
+	// RateLimit throttles this source's requests and downloads (http, ftp
+	// and sftp handlers), for servers that ban clients going faster
+	RateLimit *RateLimit `yaml:"rate_limit,omitempty"`
+
+	// Sign configures request signing for endpoints that need it (http handler)
+	Sign *Signing `yaml:"sign,omitempty"`
+
+	// Headers are sent with every request for this source (http handler).
+	// Secrets don't belong here, since the config is committed: name the
+	// variable that holds them with BearerTokenEnv or BasicAuthEnv instead.
+	Headers        map[string]string `yaml:"headers,omitempty"`
+	BearerTokenEnv string            `yaml:"bearer_token_env,omitempty"` // Variable holding a bearer token (http handler)
+	BasicAuthEnv   string            `yaml:"basic_auth_env,omitempty"`   // Variable holding "user:password" (http handler)
+
+	// Network settings for the source's connections (http handler, and git
+	// over HTTPS), for hosts behind a proxy or serving certificates from a
+	// private CA. Sources without them use the environment's proxy
+	// (HTTPS_PROXY, NO_PROXY) and the system's CAs.
+	Proxy              string `yaml:"proxy,omitempty"`                // Proxy URL, or "direct" for none
+	CAFile             string `yaml:"ca_file,omitempty"`              // PEM file of CAs to trust besides the system's
+	ClientCert         string `yaml:"client_cert,omitempty"`          // PEM certificate presented to the server (mutual TLS)
+	ClientKey          string `yaml:"client_key,omitempty"`           // PEM private key of client_cert
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"` // Don't verify the server's certificate
+
+	// Credentials is the identity to fetch with. It is not configured on the
+	// source itself: core fills it in from the dataset's auth profile.
+	Credentials *Credentials `yaml:"-"`
+
+	// Hosts limits the hosts the source may be redirected to. Core fills it
+	// in from the host allowlist, having checked the source's own URLs.
+	Hosts *HostPolicy `yaml:"-"`
+
+	// Env holds variables to set for external programs the handler runs
+	// (fetch_cmd, fingerprint_cmd), on top of datum's own environment. Core
+	// fills it in from the env maps of the defaults and the dataset.
+	Env map[string]string `yaml:"-"`
+
+	// Progress, when set, receives updates while Fetch transfers data. Core
+	// fills it in for fetches unless progress output is turned off.
+	Progress Progress `yaml:"-"`
+}
+
+// Mirrored returns one copy of s per location it can be read from: s.URL
+// first, then each of s.Mirrors. Each copy has just that URL and no mirrors,
+// so a handler can try them in turn. A source without mirrors is returned as is.
+func (s Source) Mirrored() []Source {
+	if len(s.Mirrors) == 0 {
+		return []Source{s}
+	}
+	out := make([]Source, 0, 1+len(s.Mirrors))
+	for _, u := range append([]string{s.URL}, s.Mirrors...) {
+		m := s
+		m.URL, m.Mirrors = u, nil
+		out = append(out, m)
+	}
+	return out
+}
+
+// Progress receives updates on a transfer while it runs, so a multi-gigabyte
+// fetch doesn't sit silent for minutes. Handlers that can tell how far along
+// they are report through it; the rest ignore it.
+type Progress interface {
+	// Bytes reports that done bytes have arrived so far, out of total, or
+	// -1 if the size isn't known up front.
+	Bytes(done, total int64)
+
+	// Status reports progress that only comes as text, such as git's
+	// "Receiving objects:  45% (450/1000)".
+	Status(text string)
+}
+
+// HostPolicy is a host allowlist: security.allowed_hosts in the config,
+// --allowed-hosts on the command line, or both. A host must be allowed by
+// every list that is set, so a config can narrow what the command line
+// allows but never widen it.
+//
+// A nil *HostPolicy allows every host.
+type HostPolicy struct {
+	Lists [][]string // Host patterns: "data.gov", or "*.example.com" for its subdomains
+}
+
+// Allows reports whether host (without a port) may be reached.
+func (p *HostPolicy) Allows(host string) bool {
+	if p == nil {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, list := range p.Lists {
+		if !slices.ContainsFunc(list, func(pattern string) bool { return MatchHost(pattern, host) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchHost reports whether host matches pattern: the same name, ignoring
+// case, or for "*.example.com" any subdomain of example.com (but not
+// example.com itself).
+func MatchHost(pattern, host string) bool {
+	pattern, host = strings.ToLower(pattern), strings.ToLower(host)
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// Credentials selects which credentials a handler uses for one source.
+//
+// Handlers look up credentials in well-known environment variables
+// (AWS_ACCESS_KEY_ID, GIT_TOKEN, ...). An auth profile remaps those names to
+// other variables, so datasets owned by different teams can be fetched with
+// each team's least-privilege credentials in a single run. Handlers should
+// read every credential through Getenv rather than os.Getenv.
+//
+// A nil *Credentials is valid and means the ambient environment.
+type Credentials struct {
+	Profile  string            // Name of the auth profile, for messages
+	Env      map[string]string // Variable a handler reads -> variable that holds the value
+	TokenEnv string            // Variable holding a bearer token (http handler)
+}
+
+// Getenv returns the value of the credential variable name under this identity.
+func (c *Credentials) Getenv(name string) string {
+	if c != nil {
+		if from, ok := c.Env[name]; ok {
+			return os.Getenv(from)
+		}
+	}
+	return os.Getenv(name)
+}
+
+// Token returns the profile's bearer token, or "" if it has none.
+func (c *Credentials) Token() string {
+	if c == nil || c.TokenEnv == "" {
+		return ""
+	}
+	return os.Getenv(c.TokenEnv)
+}
+
+// Environ returns the remapped variables as "NAME=value" pairs, for handlers
+// that run external programs. Variables whose source is unset are omitted.
+func (c *Credentials) Environ() []string {
+	if c == nil {
+		return nil
+	}
+	names := make([]string, 0, len(c.Env))
+	for name := range c.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var env []string
+	for _, name := range names {
+		if v := os.Getenv(c.Env[name]); v != "" {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
+
+// Expect describes what a source's response should look like.
+//
+// Handlers check these before writing anything, so a server that answers with
+// an error or login page instead of the data fails the fetch instead of
+// silently overwriting a good target.
+type Expect struct {
+	// ContentType is the accepted media type, or a comma-separated list of them
+	// (e.g. "text/csv, application/gzip"). "type/*" matches any subtype and
+	// parameters such as "; charset=utf-8" are ignored. Used by the http handler.
+	ContentType string `yaml:"content_type,omitempty"`
+}
+
+// Extract selects part of a JSON document, so a target can pin "just the
+// data.results array" of an API response. Exactly one of the two fields is
+// set; both take a path expression (fields, array indexes, and iterating an
+// array), not the full languages.
+type Extract struct {
+	JMESPath string `yaml:"jmespath,omitempty"` // e.g. "data.results", "items[*].name"
+	JQ       string `yaml:"jq,omitempty"`       // e.g. ".data.results", ".items[].name"
+}
+
+// Canonicalize lists the normalizations applied to a source's content before
+// its fingerprint is computed. The fetched target itself is left as it is:
+// only the comparison ignores the differences.
+type Canonicalize struct {
+	// LineEndings turns CRLF and CR line endings into LF and drops a leading
+	// UTF-8 byte order mark.
+	LineEndings bool `yaml:"line_endings,omitempty"`
+	// SortKeys hashes JSON content in a canonical form: keys sorted,
+	// insignificant whitespace removed.
+	SortKeys bool `yaml:"sort_keys,omitempty"`
+	// StripFields removes JSON object fields before hashing (implies
+	// SortKeys). A plain name ("generated_at") matches at any depth, a dotted
+	// path ("meta.generated_at") only from the top of the document.
+	StripFields []string `yaml:"strip_fields,omitempty"`
+}
+
+// RateLimit caps how hard a source is hit. Either field may be left out.
+//
+// The limits belong to the source's host: sources on the same host with the
+// same settings share them, so several datasets drawn from one API add up to
+// the rate it allows rather than each getting that much.
+type RateLimit struct {
+	Requests  string `yaml:"requests,omitempty"`  // Request rate, e.g. "5/s", "30/min", "1000/h"
+	Bandwidth string `yaml:"bandwidth,omitempty"` // Download rate, e.g. "2MB/s", "512KiB/s"
+}
+
+// Signing describes how to sign a source's HTTP requests.
+//
+// Secrets never live in the config: it only names the environment variables
+// that hold them, so the config can be committed alongside the lockfile.
+//
+// Two schemes are supported:
+//   - "sigv4": AWS Signature Version 4, for S3-compatible endpoints addressed by
+//     plain URLs. Credentials default to AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+//     and (if set) AWS_SESSION_TOKEN.
+//   - "hmac": a generic HMAC-SHA256 signature over "METHOD\nPATH?QUERY\nDATE",
+//     sent in a header as "<prefix><key id>:<signature>" (base64).
+type Signing struct {
+	Scheme string `yaml:"scheme"` // "sigv4" or "hmac"
+
+	// SigV4 settings
+	Region          string `yaml:"region,omitempty"`            // e.g. "us-east-1"
+	Service         string `yaml:"service,omitempty"`           // e.g. "s3" (the default)
+	AccessKeyEnv    string `yaml:"access_key_env,omitempty"`    // default AWS_ACCESS_KEY_ID
+	SecretKeyEnv    string `yaml:"secret_key_env,omitempty"`    // default AWS_SECRET_ACCESS_KEY
+	SessionTokenEnv string `yaml:"session_token_env,omitempty"` // default AWS_SESSION_TOKEN
+
+	// HMAC settings (SecretKeyEnv is shared)
+	KeyID  string `yaml:"key_id,omitempty"` // Identifies the key to the server
+	Header string `yaml:"header,omitempty"` // default "Authorization"
+	Prefix string `yaml:"prefix,omitempty"` // default "HMAC "
 }
 
 // Fetcher is the interface that all data source handlers must implement.
@@ -50,6 +347,120 @@ type Fetcher interface {
 	Fetch(ctx context.Context, src Source, dest string) error
 }
 
+// Relocator is an optional interface for handlers whose sources can move.
+//
+// Handlers that can tell a dead-but-redirected location from a live one (an HTTP
+// 301/308, a renamed git remote) implement this so check can report the new
+// canonical location and fix-urls can rewrite the config. Callers discover it
+// with a type assertion: if r, ok := f.(Relocator); ok { ... }
+type Relocator interface {
+	// Relocated returns the URL src has permanently moved to, or "" if it hasn't.
+	Relocated(ctx context.Context, src Source) (string, error)
+}
+
+// ModTimer is an optional interface for handlers that know when a source's
+// content last changed: an HTTP Last-Modified header, a file's mtime, a git
+// commit time.
+//
+// When a dataset asks for "mtime: source", the engine stamps the fetched target
+// with this time, so make-style tools see how old the data is rather than when
+// it happened to be downloaded.
+type ModTimer interface {
+	ModTime(ctx context.Context, src Source) (time.Time, error)
+}
+
+// CacheInfo is the HTTP caching metadata that came with a fingerprint.
+type CacheInfo struct {
+	CacheControl string // Raw Cache-Control header
+	Expires      string // Raw Expires header
+	Age          string // Raw Age header
+
+	// FreshUntil is when the response stops being fresh by HTTP semantics
+	// (RFC 9111). Zero means it must be revalidated every time.
+	FreshUntil time.Time
+}
+
+// CacheAwareFetcher is an optional interface for handlers whose sources say how
+// long their answer stays valid.
+//
+// Engines that honor caching call FingerprintCached instead of Fingerprint,
+// record the returned metadata, and can skip re-fingerprinting until FreshUntil.
+type CacheAwareFetcher interface {
+	FingerprintCached(ctx context.Context, src Source) (string, CacheInfo, error)
+}
+
+// ConditionalFetcher is an optional interface for handlers that can ask the
+// source to send its data only if it changed, such as an HTTP GET with
+// If-None-Match or If-Modified-Since.
+//
+// The engine uses it when the target is already there and still matches its
+// lock entry, passing the fingerprint recorded when it was fetched, so an
+// unchanged multi-gigabyte file isn't downloaded again just to be discarded.
+type ConditionalFetcher interface {
+	// FetchIfChanged is Fetch, except that when the source still matches
+	// fingerprint (an earlier result of Fingerprint) it returns false without
+	// writing dest. Fingerprints the handler can't make a conditional request
+	// from simply fetch.
+	FetchIfChanged(ctx context.Context, src Source, dest, fingerprint string) (fetched bool, err error)
+}
+
+// Prober is an optional interface for handlers that can look at a bare URL or
+// path and tell whether, and how, they could serve it. "datum probe" asks
+// every handler that implements it, so someone adding a dataset can see
+// which source types fit before writing the config.
+type Prober interface {
+	// Probe returns nil if location isn't something the handler serves at all
+	// (another scheme, not a local path). If it is but can't be reached, the
+	// error says why.
+	Probe(ctx context.Context, location string) (*ProbeResult, error)
+}
+
+// ProbeResult is what a Prober found out about a location.
+type ProbeResult struct {
+	// Source is the source stanza that would serve the location
+	Source Source
+
+	// Fingerprints lists the ways the handler could fingerprint it, best
+	// first, such as "etag (HEAD)" or "sha256 of the content (GET)"
+	Fingerprints []string
+
+	// Notes are other findings: checksum headers, range support, refs found
+	Notes []string
+
+	// ToDo names what Source still needs filled in by hand, if anything
+	ToDo []string
+
+	// Specific is set when the location is unmistakably this handler's kind
+	// (a git repository, say), as opposed to a generic fallback like a web
+	// server that answers any URL. Specific results are suggested first.
+	Specific bool
+}
+
+// CacheKeeper is an optional interface for handlers that keep a cache of
+// their own between runs, such as the git handler's bare clones. "datum
+// cache" lists, expires and compacts those entries alongside the shared file
+// cache.
+type CacheKeeper interface {
+	// CacheEntries lists the handler's cache entries.
+	CacheEntries() ([]CacheEntry, error)
+
+	// RemoveCacheEntry deletes an entry. The next fetch that needs it
+	// recreates it.
+	RemoveCacheEntry(e CacheEntry) error
+
+	// CompactCacheEntry shrinks an entry that's being kept, without
+	// counting as a use of it.
+	CompactCacheEntry(e CacheEntry) error
+}
+
+// CacheEntry is one item of a CacheKeeper's cache.
+type CacheEntry struct {
+	Path     string    // Where it's kept
+	Source   string    // What it's a cache of, such as a repository URL
+	Size     int64     // Bytes on disk
+	LastUsed time.Time // When a fetch or check last used it
+}
+
 // fetchers is the global registry of all available handlers.
 // This is a package-level variable that persists for the lifetime of the program.
 // It's populated by handler init() functions at startup.
@@ -73,3 +484,13 @@ func Get(kind string) (Fetcher, bool) {
 	f, ok := fetchers[kind]
 	return f, ok
 }
+
+// Names returns the types of all registered handlers, sorted.
+func Names() []string {
+	names := make([]string, 0, len(fetchers))
+	for name := range fetchers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,6 +2,8 @@ package registry
 
 import (
 	"context"
+	"slices"
+	"sort"
 	"testing"
 )
 
@@ -94,6 +96,19 @@ func TestGet(t *testing.T) {
 	})
 }
 
+func TestNames(t *testing.T) {
+	Register(&mockFetcher{name: "names-test-b"})
+	Register(&mockFetcher{name: "names-test-a"})
+
+	names := Names()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("Names() = %v, want sorted", names)
+	}
+	if !slices.Contains(names, "names-test-a") || !slices.Contains(names, "names-test-b") {
+		t.Errorf("Names() = %v, missing registered handlers", names)
+	}
+}
+
 func TestSource(t *testing.T) {
 	t.Run("create source with all fields", func(t *testing.T) {
 		src := Source{
@@ -139,3 +154,81 @@ func TestSource(t *testing.T) {
 		}
 	})
 }
+
+func TestCredentials(t *testing.T) {
+	t.Setenv("GIT_TOKEN", "ambient")
+	t.Setenv("TEAM_A_GIT_TOKEN", "team-a")
+	t.Setenv("TEAM_A_BEARER", "scoped")
+	t.Setenv("TEAM_A_UNSET", "")
+
+	var none *Credentials
+	if got := none.Getenv("GIT_TOKEN"); got != "ambient" {
+		t.Errorf("nil Getenv = %q, want the ambient value", got)
+	}
+	if none.Token() != "" || none.Environ() != nil {
+		t.Error("nil credentials should have no token or environment")
+	}
+
+	c := &Credentials{
+		Profile:  "team-a",
+		Env:      map[string]string{"GIT_TOKEN": "TEAM_A_GIT_TOKEN", "AWS_PROFILE": "TEAM_A_UNSET"},
+		TokenEnv: "TEAM_A_BEARER",
+	}
+	if got := c.Getenv("GIT_TOKEN"); got != "team-a" {
+		t.Errorf("Getenv(GIT_TOKEN) = %q, want the profile's value", got)
+	}
+	if got := c.Getenv("AWS_PROFILE"); got != "" {
+		t.Errorf("Getenv of a remapped but unset variable = %q, want empty (no fallback)", got)
+	}
+	if got := c.Token(); got != "scoped" {
+		t.Errorf("Token() = %q, want scoped", got)
+	}
+	env := c.Environ()
+	if len(env) != 1 || env[0] != "GIT_TOKEN=team-a" {
+		t.Errorf("Environ() = %v, want [GIT_TOKEN=team-a]", env)
+	}
+}
+
+func TestMirrored(t *testing.T) {
+	src := Source{Type: "http", URL: "https://a.example.org/x", Mirrors: []string{"https://b.example.org/x", "https://c.example.org/x"}}
+	got := src.Mirrored()
+	if len(got) != 3 {
+		t.Fatalf("Mirrored() returned %d sources, want 3", len(got))
+	}
+	for i, want := range []string{"https://a.example.org/x", "https://b.example.org/x", "https://c.example.org/x"} {
+		if got[i].URL != want || got[i].Mirrors != nil || got[i].Type != "http" {
+			t.Errorf("Mirrored()[%d] = %+v, want URL %s and no mirrors", i, got[i], want)
+		}
+	}
+	if got := (Source{URL: "https://a.example.org/x"}).Mirrored(); len(got) != 1 {
+		t.Errorf("Mirrored() without mirrors = %v", got)
+	}
+}
+
+func TestHostPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, host string
+		want          bool
+	}{
+		{"data.gov", "data.gov", true},
+		{"data.gov", "DATA.GOV", true},
+		{"data.gov", "www.data.gov", false},
+		{"*.example.com", "files.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "badexample.com", false},
+	} {
+		if got := MatchHost(tc.pattern, tc.host); got != tc.want {
+			t.Errorf("MatchHost(%q, %q) = %v, want %v", tc.pattern, tc.host, got, tc.want)
+		}
+	}
+
+	var none *HostPolicy
+	if !none.Allows("anywhere.test") {
+		t.Error("nil policy refused a host")
+	}
+	p := &HostPolicy{Lists: [][]string{{"data.gov", "*.example.com"}, {"data.gov"}}}
+	if !p.Allows("data.gov") || p.Allows("files.example.com") {
+		t.Error("Allows() doesn't require every list to match")
+	}
+}
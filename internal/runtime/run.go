@@ -0,0 +1,75 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	goruntime "runtime"
+	"time"
+)
+
+// Shells lists the shells a command can be run in. Each platform has its
+// default (see RunShell); the others must be installed to be used.
+var Shells = []string{"sh", "bash", "cmd", "powershell"}
+
+// ShellCommand returns the program and arguments that run cmdline in shell,
+// one of Shells, or the platform's default shell if shell is empty.
+func ShellCommand(shell, cmdline string) ([]string, error) {
+	switch shell {
+	case "":
+		return ShellCommand(defaultShell, cmdline)
+	case "sh", "bash":
+		return []string{shell, "-c", cmdline}, nil
+	case "cmd":
+		// /C: execute the command and then terminate
+		return []string{"cmd", "/C", cmdline}, nil
+	case "powershell":
+		// Windows PowerShell ships with Windows; elsewhere it's PowerShell 7's pwsh
+		exe := "pwsh"
+		if goruntime.GOOS == "windows" {
+			exe = "powershell"
+		}
+		return []string{exe, "-NoProfile", "-NonInteractive", "-Command", cmdline}, nil
+	}
+	return nil, fmt.Errorf("unknown shell %q (want sh, bash, cmd or powershell)", shell)
+}
+
+// Run executes argv[0] with the remaining arguments as they are, without a
+// shell, so no quoting rules apply to them.
+//
+// Parameters:
+//   - ctx: Context for cancellation and timeout control
+//   - dir: Working directory for the command (empty = datum's own)
+//   - argv: The program, looked up in PATH, and its arguments
+//   - env: Optional environment variables in "KEY=value" format (can be nil)
+//
+// Returns:
+//   - The command's combined stdout and stderr output
+//   - An error if the command fails or returns non-zero exit code
+func Run(ctx context.Context, dir string, argv []string, env []string) (string, error) {
+	if len(argv) == 0 {
+		return "", fmt.Errorf("command failed: no program to run")
+	}
+	// CommandContext creates a command that will be killed if ctx is cancelled
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+
+	// Killing a shell on cancellation leaves its children holding the
+	// output pipe; stop waiting for them after a second
+	cmd.WaitDelay = time.Second
+
+	// Append custom environment variables if provided
+	// Note: This adds to the existing environment, not replaces it
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	// CombinedOutput runs the command and captures both stdout and stderr
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		// Include both the error and the output for better debugging
+		return string(out), fmt.Errorf("command failed: %s\n%s", err, string(out))
+	}
+	return string(out), nil
+}
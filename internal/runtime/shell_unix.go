@@ -10,16 +10,16 @@
 // while maintaining the same package interface.
 package runtime
 
-import (
-	"context"
-	"fmt"
-	"os/exec"
-)
+import "context"
+
+// defaultShell is the shell commands run in unless they name another.
+const defaultShell = "sh"
 
 // RunShell executes a shell command using /bin/sh on Unix-like systems.
 //
 // Parameters:
 //   - ctx: Context for cancellation and timeout control
+//   - dir: Working directory for the command (empty = datum's own)
 //   - cmdline: The complete shell command to execute (passed to "sh -c")
 //   - env: Optional environment variables in "KEY=value" format (can be nil)
 //
@@ -29,21 +29,6 @@ import (
 //
 // Security note: cmdline is executed in a shell, so be careful with user input.
 // The command runs with the same permissions as the datum process.
-func RunShell(ctx context.Context, cmdline string, env []string) (string, error) {
-	// CommandContext creates a command that will be killed if ctx is cancelled
-	cmd := exec.CommandContext(ctx, "sh", "-c", cmdline)
-
-	// Append custom environment variables if provided
-	// Note: This adds to the existing environment, not replaces it
-	if env != nil {
-		cmd.Env = append(cmd.Env, env...)
-	}
-
-	// CombinedOutput runs the command and captures both stdout and stderr
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		// Include both the error and the output for better debugging
-		return string(out), fmt.Errorf("command failed: %s\n%s", err, string(out))
-	}
-	return string(out), nil
+func RunShell(ctx context.Context, dir, cmdline string, env []string) (string, error) {
+	return Run(ctx, dir, []string{"sh", "-c", cmdline}, env)
 }
@@ -8,13 +8,13 @@
 // and to avoid PowerShell's UTF-16 LE default encoding for file redirects (the > operator).
 // PowerShell 5.x uses UTF-16 LE by default which causes issues with cross-platform tests
 // that expect UTF-8. cmd.exe uses the system code page which is more predictable.
+// Commands that ask for PowerShell (shell: powershell) get it anyway.
 package runtime
 
-import (
-	"context"
-	"fmt"
-	"os/exec"
-)
+import "context"
+
+// defaultShell is the shell commands run in unless they name another.
+const defaultShell = "cmd"
 
 // RunShell executes a shell command using cmd.exe on Windows.
 //
@@ -24,6 +24,7 @@ import (
 //
 // Parameters:
 //   - ctx: Context for cancellation and timeout control
+//   - dir: Working directory for the command (empty = datum's own)
 //   - cmdline: The complete shell command to execute
 //   - env: Optional environment variables in "KEY=value" format (can be nil)
 //
@@ -33,21 +34,6 @@ import (
 //
 // cmd.exe flags explained:
 //   - /C: Execute the command and then terminate
-func RunShell(ctx context.Context, cmdline string, env []string) (string, error) {
-	// Use cmd.exe for consistent cross-platform behavior
-	// /C means "execute command and then terminate"
-	cmd := exec.CommandContext(ctx, "cmd", "/C", cmdline)
-
-	// Append custom environment variables if provided
-	if env != nil {
-		cmd.Env = append(cmd.Env, env...)
-	}
-
-	// CombinedOutput runs the command and captures both stdout and stderr
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		// Include both the error and the output for better debugging
-		return string(out), fmt.Errorf("command failed: %s\n%s", err, string(out))
-	}
-	return string(out), nil
+func RunShell(ctx context.Context, dir, cmdline string, env []string) (string, error) {
+	return Run(ctx, dir, []string{"cmd", "/C", cmdline}, env)
 }
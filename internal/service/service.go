@@ -0,0 +1,243 @@
+// Package service installs datum as a scheduled job of the operating system,
+// so a fleet of machines can verify their data the same way without each
+// one hand-writing cron entries.
+//
+// On Linux it writes a systemd service and timer; on Windows it registers a
+// Task Scheduler task. Either way the job runs "datum check" in the
+// repository at a fixed interval, with the global flags it was installed
+// with, and its status lines go somewhere an operator will look: the
+// journal, or a log file.
+//
+// Go learning note: the unit files and task arguments are built by plain
+// functions of a Spec, independent of the platform datum runs on, so they
+// are tested everywhere; only Install touches the system.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jprybylski/datum/internal/fsutil"
+)
+
+// DefaultInterval is how often the job runs by default.
+const DefaultInterval = time.Hour
+
+// Spec describes the job to install.
+type Spec struct {
+	Name     string        // Unit or task name (default: DefaultName(Dir))
+	Binary   string        // Absolute path of the datum executable
+	Dir      string        // Repository the job runs in
+	Args     []string      // Global flags to run check with, e.g. --config=... --log-format=json
+	Interval time.Duration // Time between runs (0 = DefaultInterval)
+	LogFile  string        // Append output here ("" = the journal on Linux, <cache dir>/service/<name>.log on Windows)
+	EnvFile  string        // systemd EnvironmentFile with credentials such as HF_TOKEN (optional)
+	User     bool          // Install a systemd user unit instead of a system one
+}
+
+// DefaultName derives a job name from the repository directory, e.g.
+// "datum-analysis" for /srv/analysis.
+func DefaultName(dir string) string {
+	return "datum-" + strings.Trim(unsafeName.ReplaceAllString(filepath.Base(dir), "-"), "-")
+}
+
+// unsafeName matches characters that don't belong in unit or task names.
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// command is the job's command line.
+func (s Spec) command() []string {
+	return append(append([]string{s.Binary}, s.Args...), "check")
+}
+
+// withDefaults fills in Name and Interval.
+func (s Spec) withDefaults() Spec {
+	if s.Name == "" {
+		s.Name = DefaultName(s.Dir)
+	}
+	if s.Interval <= 0 {
+		s.Interval = DefaultInterval
+	}
+	return s
+}
+
+// SystemdUnits returns the contents of <name>.service and <name>.timer.
+// The service is a oneshot run of datum check; the timer starts it shortly
+// after boot and then every Interval after the previous run.
+func SystemdUnits(s Spec) (service, timer string) {
+	s = s.withDefaults()
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\nDescription=datum check of %s\n", s.Dir)
+	b.WriteString("Wants=network-online.target\nAfter=network-online.target\n\n")
+	b.WriteString("[Service]\nType=oneshot\n")
+	if !s.User {
+		// A system unit would otherwise run as root, with root's cache and no
+		// access to the installing user's credentials
+		if u, err := user.Current(); err == nil && u.Uid != "0" {
+			fmt.Fprintf(&b, "User=%s\n", u.Username)
+		}
+	}
+	fmt.Fprintf(&b, "WorkingDirectory=%s\n", systemdQuote(s.Dir))
+	if s.EnvFile != "" {
+		fmt.Fprintf(&b, "EnvironmentFile=%s\n", systemdQuote(s.EnvFile))
+	}
+	quoted := make([]string, 0, len(s.command()))
+	for _, arg := range s.command() {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(quoted, " "))
+	fmt.Fprintf(&b, "SyslogIdentifier=%s\n", s.Name)
+	if s.LogFile != "" {
+		fmt.Fprintf(&b, "StandardOutput=append:%s\nStandardError=append:%s\n", s.LogFile, s.LogFile)
+	} else {
+		b.WriteString("StandardOutput=journal\nStandardError=journal\n")
+	}
+	service = b.String()
+
+	timer = fmt.Sprintf(`[Unit]
+Description=Run datum check of %s every %s
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=%ds
+Unit=%s.service
+
+[Install]
+WantedBy=timers.target
+`, s.Dir, s.Interval, int64(s.Interval/time.Second), s.Name)
+	return service, timer
+}
+
+// systemdQuote quotes a word for a unit file: specifiers (%) and variable
+// references ($) are escaped, and words with spaces are double-quoted.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// WindowsScript returns the batch file the scheduled task runs: Task
+// Scheduler's own command line is limited to 261 characters, and has no
+// redirection, so the working directory, command and log live here.
+func WindowsScript(s Spec) string {
+	s = s.withDefaults()
+	quoted := make([]string, 0, len(s.command()))
+	for _, arg := range s.command() {
+		quoted = append(quoted, `"`+strings.ReplaceAll(arg, "%", "%%")+`"`)
+	}
+	return fmt.Sprintf("@echo off\r\ncd /d \"%s\"\r\n%s >> \"%s\" 2>&1\r\n", s.Dir, strings.Join(quoted, " "), windowsLogFile(s))
+}
+
+// windowsLogFile is where the task's output goes.
+func windowsLogFile(s Spec) string {
+	if s.LogFile != "" {
+		return s.LogFile
+	}
+	return filepath.Join(fsutil.CacheDir(), "service", s.Name+".log")
+}
+
+// WindowsTaskArgs returns the schtasks arguments that register script to run
+// every Interval, rounded up to whole minutes (or days, past a day).
+func WindowsTaskArgs(s Spec, script string) []string {
+	s = s.withDefaults()
+	minutes := int((s.Interval + time.Minute - 1) / time.Minute)
+	schedule := []string{"/SC", "MINUTE", "/MO", fmt.Sprint(minutes)}
+	if minutes >= 24*60 {
+		schedule = []string{"/SC", "DAILY", "/MO", fmt.Sprint((minutes + 24*60 - 1) / (24 * 60))}
+	}
+	return append([]string{"/Create", "/F", "/TN", s.Name, "/TR", `"` + script + `"`}, schedule...)
+}
+
+// Install writes the job for this platform and enables it, reporting each
+// step on w. With dryRun set it only prints what it would write and run.
+func Install(s Spec, dryRun bool, w io.Writer) error {
+	s = s.withDefaults()
+	switch runtime.GOOS {
+	case "linux":
+		return installSystemd(s, dryRun, w)
+	case "windows":
+		return installWindows(s, dryRun, w)
+	default:
+		return fmt.Errorf("install-service supports systemd (Linux) and Windows; on %s, schedule %q with cron or launchd",
+			runtime.GOOS, strings.Join(s.command(), " "))
+	}
+}
+
+// installSystemd writes the units and enables the timer.
+func installSystemd(s Spec, dryRun bool, w io.Writer) error {
+	dir, ctl := "/etc/systemd/system", []string{"systemctl"}
+	if s.User {
+		ctl = append(ctl, "--user")
+		config, err := os.UserConfigDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(config, "systemd", "user")
+	}
+	service, timer := SystemdUnits(s)
+	files := map[string]string{s.Name + ".service": service, s.Name + ".timer": timer}
+	for _, name := range []string{s.Name + ".service", s.Name + ".timer"} {
+		path := filepath.Join(dir, name)
+		if dryRun {
+			fmt.Fprintf(w, "# %s\n%s\n", path, files[name])
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(files[name]), 0o644); err != nil {
+			if errors.Is(err, os.ErrPermission) && !s.User {
+				return fmt.Errorf("%w (run as root, or install a user unit with --user)", err)
+			}
+			return err
+		}
+		fmt.Fprintf(w, "wrote %s\n", path)
+	}
+	return run(dryRun, w,
+		append(append([]string{}, ctl...), "daemon-reload"),
+		append(append([]string{}, ctl...), "enable", "--now", s.Name+".timer"))
+}
+
+// installWindows writes the script and registers the task.
+func installWindows(s Spec, dryRun bool, w io.Writer) error {
+	script := filepath.Join(fsutil.CacheDir(), "service", s.Name+".cmd")
+	content := WindowsScript(s)
+	if dryRun {
+		fmt.Fprintf(w, "# %s\n%s\n", script, content)
+	} else {
+		if err := os.MkdirAll(filepath.Dir(script), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(script, []byte(content), 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "wrote %s\n", script)
+	}
+	return run(dryRun, w, append([]string{"schtasks"}, WindowsTaskArgs(s, script)...))
+}
+
+// run runs each command in turn, or prints them with dryRun set.
+func run(dryRun bool, w io.Writer, cmds ...[]string) error {
+	for _, args := range cmds {
+		fmt.Fprintf(w, "$ %s\n", strings.Join(args, " "))
+		if dryRun {
+			continue
+		}
+		out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+		w.Write(out)
+		if err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+	}
+	return nil
+}
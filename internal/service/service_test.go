@@ -0,0 +1,96 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultName(t *testing.T) {
+	for dir, want := range map[string]string{
+		"/srv/analysis":      "datum-analysis",
+		"/home/a/My Project": "datum-My-Project",
+		"/data/ünïcode!":     "datum-n-code",
+	} {
+		if got := DefaultName(dir); got != want {
+			t.Errorf("DefaultName(%q) = %q, want %q", dir, got, want)
+		}
+	}
+}
+
+func TestSystemdUnits(t *testing.T) {
+	spec := Spec{
+		Binary:   "/usr/local/bin/datum",
+		Dir:      "/srv/my repo",
+		Args:     []string{"--config=.data.yaml", "--log-format=json"},
+		Interval: 90 * time.Minute,
+		User:     true,
+	}
+	service, timer := SystemdUnits(spec)
+	for _, want := range []string{
+		"Type=oneshot\n",
+		`WorkingDirectory="/srv/my repo"` + "\n",
+		"ExecStart=/usr/local/bin/datum --config=.data.yaml --log-format=json check\n",
+		"SyslogIdentifier=datum-my-repo\n",
+		"StandardError=journal\n",
+	} {
+		if !strings.Contains(service, want) {
+			t.Errorf("service lacks %q:\n%s", want, service)
+		}
+	}
+	if strings.Contains(service, "User=") {
+		t.Errorf("user unit sets User=:\n%s", service)
+	}
+	for _, want := range []string{"OnUnitActiveSec=5400s\n", "Unit=datum-my-repo.service\n", "WantedBy=timers.target\n"} {
+		if !strings.Contains(timer, want) {
+			t.Errorf("timer lacks %q:\n%s", want, timer)
+		}
+	}
+
+	spec.LogFile, spec.EnvFile, spec.Name = "/var/log/datum.log", "/etc/datum/env", "nightly"
+	service, timer = SystemdUnits(spec)
+	if !strings.Contains(service, "StandardOutput=append:/var/log/datum.log\n") || !strings.Contains(service, "EnvironmentFile=/etc/datum/env\n") {
+		t.Errorf("service ignores LogFile or EnvFile:\n%s", service)
+	}
+	if !strings.Contains(timer, "Unit=nightly.service\n") {
+		t.Errorf("timer ignores Name:\n%s", timer)
+	}
+}
+
+func TestSystemdQuote(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain":          "plain",
+		"50%":            "50%%",
+		"$HOME":          "$$HOME",
+		`a "b" c`:        `"a \"b\" c"`,
+		`C:\path\x.yaml`: `"C:\\path\\x.yaml"`,
+	} {
+		if got := systemdQuote(in); got != want {
+			t.Errorf("systemdQuote(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWindows(t *testing.T) {
+	spec := Spec{Name: "datum-repo", Binary: `C:\bin\datum.exe`, Dir: `C:\repo`, LogFile: `C:\logs\datum.log`}
+	script := WindowsScript(spec)
+	if want := "cd /d \"C:\\repo\"\r\n\"C:\\bin\\datum.exe\" \"check\" >> \"C:\\logs\\datum.log\" 2>&1\r\n"; !strings.HasSuffix(script, want) {
+		t.Errorf("script = %q, want suffix %q", script, want)
+	}
+
+	tests := []struct {
+		interval time.Duration
+		want     string
+	}{
+		{0, "/SC MINUTE /MO 60"},
+		{90 * time.Second, "/SC MINUTE /MO 2"},
+		{36 * time.Hour, "/SC DAILY /MO 2"},
+	}
+	for _, tt := range tests {
+		spec.Interval = tt.interval
+		args := strings.Join(WindowsTaskArgs(spec, `C:\x.cmd`), " ")
+		if !strings.HasPrefix(args, `/Create /F /TN datum-repo /TR "C:\x.cmd" `) || !strings.HasSuffix(args, tt.want) {
+			t.Errorf("WindowsTaskArgs(%s) = %s, want it to end %s", tt.interval, args, tt.want)
+		}
+	}
+}